@@ -0,0 +1,252 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A/B protocol experiments.
+//
+// A change to how replicas handle a consensus message, a new vote rule say,
+// can be tried on part of a simulated cluster before every node adopts it.
+// Each implementation of a message type's handler is registered as a named
+// variant; the handlers PBFT ships with are the "v1" variants. A replica
+// uses the variants in its Handlers and the built-in handler for any other
+// type. An experiment runs the same requests with the same seed twice:
+// once with every replica on the control variant and once with the treated
+// replicas on the treatment. It reports every sequence number the replicas
+// of the second run executed differently, including entries only some of
+// them executed, and how the commit latency moved. A treatment that
+// diverges where the control does not is not safe to adopt.
+
+var (
+	ErrVariantRegistered = errors.New("handler variant already registered")
+	ErrUnknownVariant    = errors.New("unknown handler variant")
+)
+
+// BaselineVariant names the handlers PBFT ships with
+const BaselineVariant = "v1"
+
+// PBFTHandler handles one consensus message on a replica. It runs under
+// r.Lock.
+type PBFTHandler func(r *PBFTReplica, from string, m Message) error
+
+var handlerVariants = map[MessageType]map[string]PBFTHandler{}
+
+func init() {
+	RegisterHandlerVariant(MsgPrePrepare, BaselineVariant, func(r *PBFTReplica, from string, m Message) error {
+		return r.handlePrePrepare(from, m.(*PrePrepare))
+	})
+	RegisterHandlerVariant(MsgPrepare, BaselineVariant, func(r *PBFTReplica, from string, m Message) error {
+		return r.handlePrepare(from, m.(*Prepare))
+	})
+	RegisterHandlerVariant(MsgCommit, BaselineVariant, func(r *PBFTReplica, from string, m Message) error {
+		return r.handleCommit(from, m.(*Commit))
+	})
+}
+
+// RegisterHandlerVariant adds an implementation of the handler for a
+// message type under name
+func RegisterHandlerVariant(t MessageType, name string, handler PBFTHandler) error {
+	if handlerVariants[t] == nil {
+		handlerVariants[t] = make(map[string]PBFTHandler)
+	}
+	if _, exists := handlerVariants[t][name]; exists {
+		return fmt.Errorf("%w: %v %s", ErrVariantRegistered, t, name)
+	}
+	handlerVariants[t][name] = handler
+	return nil
+}
+
+// HandlerVariant returns the registered handler variant
+func HandlerVariant(t MessageType, name string) (PBFTHandler, error) {
+	handler, exists := handlerVariants[t][name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %v %q, have %v", ErrUnknownVariant, t, name, sortedKeys(handlerVariants[t]))
+	}
+	return handler, nil
+}
+
+// ABExperiment splits four replicas, f=1, between two handler variants
+type ABExperiment struct {
+	Message   MessageType
+	Control   string   // Variant of the other replicas, BaselineVariant if empty
+	Treatment string   // Variant of the treated replicas
+	Treated   []string // Replicas among A to D running the treatment
+	Requests  int      // Client requests to order, 1 if zero
+	Seed      int64
+}
+
+// ABDivergence is a sequence number the replicas executed differently
+type ABDivergence struct {
+	Seq     uint64            `json:"seq"`
+	Digests map[string]string `json:"digests"` // Replica to the digest it executed, "" if none
+}
+
+// ABReport is the outcome of an experiment
+type ABReport struct {
+	Message   MessageType    `json:"message"`
+	Control   string         `json:"control"`
+	Treatment string         `json:"treatment"`
+	Treated   []string       `json:"treated"`
+	Diverged  []ABDivergence `json:"diverged"` // In the run with the treatment
+	// ControlDiverged counts divergences with every replica on the control
+	ControlDiverged int           `json:"control_diverged"`
+	Committed       int           `json:"committed"`         // Requests committed with the treatment
+	ControlLatency  time.Duration `json:"control_latency"`   // Mean commit latency with every replica on the control
+	TreatedLatency  time.Duration `json:"treatment_latency"` // Mean commit latency with the treatment
+}
+
+// Diverges reports whether the treatment made replicas disagree where the
+// control alone did not
+func (r *ABReport) Diverges() bool {
+	return len(r.Diverged) > r.ControlDiverged
+}
+
+func (r *ABReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v handler: %s on %v against %s\n", r.Message, r.Treatment, r.Treated, r.Control)
+	fmt.Fprintf(&b, "Committed %d requests, mean latency %v (control %v)\n", r.Committed, r.TreatedLatency, r.ControlLatency)
+	for _, d := range r.Diverged {
+		var digests []string
+		for _, id := range sortedKeys(d.Digests) {
+			digest := d.Digests[id]
+			if digest == "" {
+				digest = "-"
+			}
+			digests = append(digests, fmt.Sprintf("%s=%.8s", id, digest))
+		}
+		fmt.Fprintf(&b, "Diverged at seq %d: %s\n", d.Seq, strings.Join(digests, " "))
+	}
+	if !r.Diverges() {
+		b.WriteString("No divergence\n")
+	}
+	return b.String()
+}
+
+// RunABExperiment runs the requests with every replica on the control and
+// again with the treated replicas on the treatment, and compares the runs
+func RunABExperiment(exp ABExperiment) (*ABReport, error) {
+	if exp.Control == "" {
+		exp.Control = BaselineVariant
+	}
+	if exp.Requests == 0 {
+		exp.Requests = 1
+	}
+	control, err := HandlerVariant(exp.Message, exp.Control)
+	if err != nil {
+		return nil, err
+	}
+	treatment, err := HandlerVariant(exp.Message, exp.Treatment)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := runVariants(exp, control, nil)
+	if err != nil {
+		return nil, err
+	}
+	treated, err := runVariants(exp, control, treatment)
+	if err != nil {
+		return nil, err
+	}
+	report := &ABReport{
+		Message:         exp.Message,
+		Control:         exp.Control,
+		Treatment:       exp.Treatment,
+		Treated:         exp.Treated,
+		Diverged:        divergences(treated.pbft),
+		ControlDiverged: len(divergences(baseline.pbft)),
+		Committed:       treated.committed,
+		ControlLatency:  baseline.latency,
+		TreatedLatency:  treated.latency,
+	}
+	return report, nil
+}
+
+// abRun is one run of an experiment
+type abRun struct {
+	pbft      *PBFT
+	committed int
+	latency   time.Duration // Mean over the committed requests
+}
+
+// runVariants orders the experiment's requests with the treated replicas on
+// treatment, or every replica on control if treatment is nil
+func runVariants(exp ABExperiment, control, treatment PBFTHandler) (*abRun, error) {
+	system := NewSystem()
+	for _, id := range []string{"A", "B", "C", "D"} {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			return nil, err
+		}
+		system.AddNode(node)
+	}
+	system.SetLeader("A")
+	scheduler := NewScheduler(exp.Seed)
+	scheduler.Jitter = LocalLatency
+	system.UseScheduler(scheduler)
+	pbft, err := NewPBFT(system, 1)
+	if err != nil {
+		return nil, err
+	}
+	for id, replica := range pbft.Replicas {
+		replica.Handlers = map[MessageType]PBFTHandler{exp.Message: control}
+		for _, treated := range exp.Treated {
+			if treated == id && treatment != nil {
+				replica.Handlers[exp.Message] = treatment
+			}
+		}
+	}
+
+	digests := make([]string, exp.Requests)
+	for i := range digests {
+		if digests[i], err = pbft.Submit([]byte(fmt.Sprintf("ab-request-%d", i))); err != nil {
+			return nil, err
+		}
+	}
+	pbft.Run()
+	run := &abRun{pbft: pbft}
+	var total time.Duration
+	for _, digest := range digests {
+		if outcome := pbft.Outcome(digest); outcome.Committed {
+			run.committed++
+			total += outcome.Latency
+		}
+	}
+	if run.committed > 0 {
+		run.latency = total / time.Duration(run.committed)
+	}
+	return run, nil
+}
+
+// divergences returns the sequence numbers the replicas did not all execute
+// with the same digest
+func divergences(pbft *PBFT) []ABDivergence {
+	executed := make(map[string]map[uint64]string)
+	var last uint64
+	for id, replica := range pbft.Replicas {
+		replica.Lock.Lock()
+		executed[id] = make(map[uint64]string)
+		for _, execution := range replica.Executed {
+			executed[id][execution.Seq] = execution.Digest
+			last = max(last, execution.Seq)
+		}
+		replica.Lock.Unlock()
+	}
+	ids := sortedKeys(executed)
+	var diverged []ABDivergence
+	for seq := uint64(1); seq <= last; seq++ {
+		d := ABDivergence{Seq: seq, Digests: make(map[string]string)}
+		agreed := true
+		for _, id := range ids {
+			d.Digests[id] = executed[id][seq]
+			agreed = agreed && d.Digests[id] == executed[ids[0]][seq]
+		}
+		if !agreed {
+			diverged = append(diverged, d)
+		}
+	}
+	return diverged
+}
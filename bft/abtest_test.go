@@ -0,0 +1,74 @@
+package bft
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// registerRewriteVariant registers a pre-prepare handler that prepares a
+// different payload than the primary proposed
+func registerRewriteVariant(t *testing.T) {
+	err := RegisterHandlerVariant(MsgPrePrepare, "rewrite", func(r *PBFTReplica, from string, m Message) error {
+		pp := *m.(*PrePrepare)
+		if err := r.check("pre-prepare", from, pp.Replica, pp.View, pp.Seq, pp.Digest, pp.Signature); err != nil {
+			return err
+		}
+		pp.Payload = append([]byte("rewritten-"), pp.Payload...)
+		pp.Digest = PayloadDigest(pp.Payload)
+		if r.slot(pp.Seq).prePrepare == nil {
+			r.accept(&pp)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrVariantRegistered) {
+		t.Fatal(err)
+	}
+}
+
+// TestABExperimentSameVariant tests that running the control as the treatment changes nothing
+func TestABExperimentSameVariant(t *testing.T) {
+	report, err := RunABExperiment(ABExperiment{Message: MsgCommit, Treatment: BaselineVariant, Treated: []string{"B"}, Requests: 3, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Diverges() || report.Committed != 3 || report.TreatedLatency != report.ControlLatency {
+		t.Errorf("Expected identical runs, got %+v", report)
+	}
+	if !strings.Contains(report.String(), "No divergence") {
+		t.Errorf("Expected the report to show no divergence, got:\n%s", report)
+	}
+}
+
+// TestABExperimentDiverges tests that a treatment preparing other payloads is reported as diverging
+func TestABExperimentDiverges(t *testing.T) {
+	registerRewriteVariant(t)
+	report, err := RunABExperiment(ABExperiment{Message: MsgPrePrepare, Treatment: "rewrite", Treated: []string{"B"}, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Diverges() || report.ControlDiverged != 0 || len(report.Diverged) != 1 {
+		t.Fatalf("Expected one divergence caused by the treatment, got %+v", report)
+	}
+	digests := report.Diverged[0].Digests
+	if digests["B"] != "" || digests["A"] == "" || digests["A"] != digests["C"] || digests["A"] != digests["D"] {
+		t.Errorf("Expected B alone to miss the entry the others executed, got %v", digests)
+	}
+	if report.Committed != 1 {
+		t.Errorf("Expected the others to still commit the request, got %d", report.Committed)
+	}
+}
+
+// TestHandlerVariantRegistry tests that variants are unique per message type and looked up by name
+func TestHandlerVariantRegistry(t *testing.T) {
+	noop := func(r *PBFTReplica, from string, m Message) error { return nil }
+	if err := RegisterHandlerVariant(MsgPrepare, BaselineVariant, noop); !errors.Is(err, ErrVariantRegistered) {
+		t.Errorf("Expected the baseline prepare handler to be registered already, got %v", err)
+	}
+	if _, err := HandlerVariant(MsgCommit, "missing"); !errors.Is(err, ErrUnknownVariant) {
+		t.Errorf("Expected an unknown variant to be rejected, got %v", err)
+	}
+	if _, err := RunABExperiment(ABExperiment{Message: MsgPrepare, Treatment: "missing"}); !errors.Is(err, ErrUnknownVariant) {
+		t.Errorf("Expected an experiment on an unknown variant to fail, got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package bft
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AnomalyType identifies a class of consistency anomaly
+type AnomalyType string
+
+const (
+	// LostUpdate: two transactions read the same version of a key and both
+	// overwrite it, so one write silently discards the other
+	LostUpdate AnomalyType = "lost-update"
+	// StaleRead: a read returns a version older than a write to the same key
+	// that had already completed before the read was invoked
+	StaleRead AnomalyType = "stale-read"
+	// WriteSkew: two transactions read an overlapping set of keys, then write
+	// disjoint keys without either observing the other's write
+	WriteSkew AnomalyType = "write-skew"
+)
+
+// Anomaly is a single detected anomaly and the operations involved
+type Anomaly struct {
+	Type        AnomalyType
+	Ops         []int
+	Description string
+}
+
+// AnomalyReport is the structured result of scanning one scenario's history
+type AnomalyReport struct {
+	Scenario  string
+	Anomalies []Anomaly
+}
+
+// Detector scans a history for one anomaly pattern
+type Detector func(ops []HistoryOp) []Anomaly
+
+// DefaultDetectors are the detectors run by DetectAnomalies
+var DefaultDetectors = []Detector{
+	DetectLostUpdates,
+	DetectStaleReads,
+	DetectWriteSkew,
+}
+
+// DetectAnomalies runs the default detectors over a recorded history
+func DetectAnomalies(scenario string, history *History) *AnomalyReport {
+	ops := history.Snapshot()
+	report := &AnomalyReport{Scenario: scenario}
+	for _, detect := range DefaultDetectors {
+		report.Anomalies = append(report.Anomalies, detect(ops)...)
+	}
+	return report
+}
+
+// Counts returns the number of anomalies of each type
+func (r *AnomalyReport) Counts() map[AnomalyType]int {
+	counts := make(map[AnomalyType]int)
+	for _, anomaly := range r.Anomalies {
+		counts[anomaly.Type]++
+	}
+	return counts
+}
+
+// String renders the report for terminal output
+func (r *AnomalyReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Anomaly report for %s: %d found\n", r.Scenario, len(r.Anomalies))
+	for _, anomaly := range r.Anomalies {
+		fmt.Fprintf(&b, "  [%s] ops %v: %s\n", anomaly.Type, anomaly.Ops, anomaly.Description)
+	}
+	return b.String()
+}
+
+// txnView groups the successful reads and writes of one transaction
+type txnView struct {
+	name   string
+	reads  map[string]HistoryOp
+	writes map[string]HistoryOp
+}
+
+// groupTransactions groups successful operations by transaction. Operations
+// without a Txn are treated as single-operation transactions.
+func groupTransactions(ops []HistoryOp) []*txnView {
+	byName := make(map[string]*txnView)
+	var txns []*txnView
+	for _, op := range ops {
+		if !op.OK {
+			continue
+		}
+		name := op.Txn
+		if name == "" {
+			name = fmt.Sprintf("op-%d", op.ID)
+		}
+		txn, exists := byName[name]
+		if !exists {
+			txn = &txnView{
+				name:   name,
+				reads:  make(map[string]HistoryOp),
+				writes: make(map[string]HistoryOp),
+			}
+			byName[name] = txn
+			txns = append(txns, txn)
+		}
+		if op.Kind == OpRead {
+			if _, seen := txn.reads[op.Key]; !seen {
+				txn.reads[op.Key] = op
+			}
+		} else {
+			txn.writes[op.Key] = op
+		}
+	}
+	return txns
+}
+
+// DetectLostUpdates finds pairs of read-modify-write transactions that based
+// their writes to the same key on the same version
+func DetectLostUpdates(ops []HistoryOp) []Anomaly {
+	var anomalies []Anomaly
+	txns := groupTransactions(ops)
+	for i, t1 := range txns {
+		for _, t2 := range txns[i+1:] {
+			for _, key := range sortedKeys(t1.writes) {
+				r1, ok1 := t1.reads[key]
+				r2, ok2 := t2.reads[key]
+				w2, wrote := t2.writes[key]
+				if !ok1 || !ok2 || !wrote || r1.Version != r2.Version {
+					continue
+				}
+				w1 := t1.writes[key]
+				anomalies = append(anomalies, Anomaly{
+					Type: LostUpdate,
+					Ops:  []int{r1.ID, w1.ID, r2.ID, w2.ID},
+					Description: fmt.Sprintf("%s and %s both read %s@%d and overwrote it",
+						t1.name, t2.name, key, r1.Version),
+				})
+			}
+		}
+	}
+	return anomalies
+}
+
+// DetectStaleReads finds reads that missed a write completed before they began
+func DetectStaleReads(ops []HistoryOp) []Anomaly {
+	var anomalies []Anomaly
+	for _, read := range ops {
+		if read.Kind != OpRead || !read.OK {
+			continue
+		}
+		// Report only the newest write the read should have observed
+		var missed *HistoryOp
+		for i := range ops {
+			write := &ops[i]
+			if write.Kind != OpWrite || !write.OK || write.Key != read.Key {
+				continue
+			}
+			if write.Complete < read.Invoke && write.Version > read.Version {
+				if missed == nil || write.Version > missed.Version {
+					missed = write
+				}
+			}
+		}
+		if missed != nil {
+			anomalies = append(anomalies, Anomaly{
+				Type: StaleRead,
+				Ops:  []int{missed.ID, read.ID},
+				Description: fmt.Sprintf("read of %s returned version %d after version %d was committed",
+					read.Key, read.Version, missed.Version),
+			})
+		}
+	}
+	return anomalies
+}
+
+// DetectWriteSkew finds pairs of transactions that each read a key the other
+// writes, missed the other's write, and wrote disjoint keys
+func DetectWriteSkew(ops []HistoryOp) []Anomaly {
+	var anomalies []Anomaly
+	txns := groupTransactions(ops)
+	for i, t1 := range txns {
+		for _, t2 := range txns[i+1:] {
+			if overlaps(t1.writes, t2.writes) {
+				continue
+			}
+			a, b, ok := skewedKeys(t1, t2)
+			if !ok {
+				continue
+			}
+			anomalies = append(anomalies, Anomaly{
+				Type: WriteSkew,
+				Ops:  []int{t1.reads[b].ID, t1.writes[a].ID, t2.reads[a].ID, t2.writes[b].ID},
+				Description: fmt.Sprintf("%s wrote %s and %s wrote %s, each without seeing the other",
+					t1.name, a, t2.name, b),
+			})
+		}
+	}
+	return anomalies
+}
+
+// skewedKeys looks for a key a written by t1 and a key b written by t2 where
+// each transaction read the other's key at a version older than its write
+func skewedKeys(t1, t2 *txnView) (string, string, bool) {
+	for _, a := range sortedKeys(t1.writes) {
+		readA, ok := t2.reads[a]
+		if !ok || readA.Version >= t1.writes[a].Version {
+			continue
+		}
+		for _, b := range sortedKeys(t2.writes) {
+			readB, ok := t1.reads[b]
+			if ok && readB.Version < t2.writes[b].Version {
+				return a, b, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func overlaps(a, b map[string]HistoryOp) bool {
+	for key := range a {
+		if _, exists := b[key]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
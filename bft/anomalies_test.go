@@ -0,0 +1,121 @@
+package bft
+
+import (
+	"testing"
+	"time"
+)
+
+// op builds a completed, successful history operation for detector tests
+func op(id int, txn string, kind OpKind, key string, version int64, invoke, complete time.Duration) HistoryOp {
+	return HistoryOp{
+		ID:       id,
+		Client:   "c-" + txn,
+		Txn:      txn,
+		Kind:     kind,
+		Key:      key,
+		Version:  version,
+		Invoke:   invoke,
+		Complete: complete,
+		OK:       true,
+	}
+}
+
+// TestAnomalyDetectors tests each detector against a history exhibiting its anomaly
+func TestAnomalyDetectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		ops      []HistoryOp
+		expected map[AnomalyType]int
+	}{
+		{
+			name: "lost update",
+			ops: []HistoryOp{
+				op(0, "T1", OpRead, "x", 1, 0, 1),
+				op(1, "T2", OpRead, "x", 1, 0, 1),
+				op(2, "T1", OpWrite, "x", 2, 2, 3),
+				op(3, "T2", OpWrite, "x", 3, 2, 4),
+			},
+			expected: map[AnomalyType]int{LostUpdate: 1},
+		},
+		{
+			name: "stale read",
+			ops: []HistoryOp{
+				op(0, "", OpWrite, "x", 1, 0, 1),
+				op(1, "", OpWrite, "x", 2, 2, 3),
+				op(2, "", OpRead, "x", 1, 5, 6),
+			},
+			expected: map[AnomalyType]int{StaleRead: 1},
+		},
+		{
+			name: "concurrent read is not stale",
+			ops: []HistoryOp{
+				op(0, "", OpWrite, "x", 1, 0, 5),
+				op(1, "", OpRead, "x", 0, 2, 3),
+			},
+			expected: map[AnomalyType]int{},
+		},
+		{
+			name: "write skew",
+			ops: []HistoryOp{
+				op(0, "T1", OpRead, "x", 1, 0, 1),
+				op(1, "T1", OpRead, "y", 1, 0, 1),
+				op(2, "T2", OpRead, "x", 1, 0, 1),
+				op(3, "T2", OpRead, "y", 1, 0, 1),
+				op(4, "T1", OpWrite, "x", 2, 2, 3),
+				op(5, "T2", OpWrite, "y", 3, 2, 3),
+			},
+			expected: map[AnomalyType]int{WriteSkew: 1},
+		},
+		{
+			name: "serial transactions",
+			ops: []HistoryOp{
+				op(0, "T1", OpRead, "x", 1, 0, 1),
+				op(1, "T1", OpWrite, "x", 2, 1, 2),
+				op(2, "T2", OpRead, "x", 2, 3, 4),
+				op(3, "T2", OpWrite, "x", 3, 4, 5),
+			},
+			expected: map[AnomalyType]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := NewHistory()
+			history.Ops = tt.ops
+			report := DetectAnomalies(tt.name, history)
+			counts := report.Counts()
+			if len(counts) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v\n%s", tt.expected, counts, report)
+			}
+			for anomalyType, n := range tt.expected {
+				if counts[anomalyType] != n {
+					t.Errorf("Expected %d %s anomalies, got %d", n, anomalyType, counts[anomalyType])
+				}
+			}
+		})
+	}
+}
+
+// TestSystemRecordsHistory tests that writes and reads through the system are recorded
+func TestSystemRecordsHistory(t *testing.T) {
+	system := newGeoSystem(t)
+	system.History = NewHistory()
+
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := system.Read("us-east", "x"); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	ops := system.History.Snapshot()
+	if len(ops) != 2 {
+		t.Fatalf("Expected 2 recorded operations, got %d", len(ops))
+	}
+	if ops[0].Kind != OpWrite || ops[0].Version != 1 || !ops[0].OK {
+		t.Errorf("Unexpected write record: %+v", ops[0])
+	}
+	if ops[1].Kind != OpRead || ops[1].Value != "1" || ops[1].Version != 1 {
+		t.Errorf("Unexpected read record: %+v", ops[1])
+	}
+}
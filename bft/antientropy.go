@@ -0,0 +1,259 @@
+package bft
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Anti-entropy.
+//
+// Pushing every update to every neighbor each round is one synchronous
+// fan-out: an update lost to a partition is gone, and the receiver only
+// catches up on the sender's next update. With AntiEntropy the nodes
+// reconcile instead. Each round every node signs a fresh update of its
+// own, and every Interval rounds it picks Fanout random reachable
+// neighbors and swaps clock digests with each: the sequence number of the
+// latest update it holds from every node, its own included. Each side then
+// pulls the updates the other holds newer versions of, relayed with their
+// origin's signature, so they verify and are checked for Byzantine
+// behavior as if they came from the origin directly. Convergence after a
+// partition heals is measured in rounds by ConvergenceRounds: until every
+// reachable honest node holds, from every other, an update at least as
+// recent as the last one that node signed when the measurement started.
+
+const (
+	DefaultAntiEntropyFanout   = 2
+	DefaultAntiEntropyInterval = 1
+)
+
+// ClockDigest is the sequence number of the latest update a node holds
+// from each node
+type ClockDigest map[string]uint64
+
+// digestSize is the wire size of a digest: an ID and a sequence number per
+// entry
+func digestSize(digest ClockDigest) int {
+	size := 0
+	for id := range digest {
+		size += len(id) + 8
+	}
+	return size
+}
+
+// AntiEntropyStats count what anti-entropy did
+type AntiEntropyStats struct {
+	Rounds    int
+	Exchanges int // Digest swaps between two nodes
+	Pulled    int // Updates transferred because a digest was behind
+	Bytes     int // Of digests and pulled updates
+}
+
+// AntiEntropy disseminates clock updates by periodic digest exchange
+type AntiEntropy struct {
+	Fanout   int // Peers a node exchanges digests with per exchange round
+	Interval int // Rounds between a node's exchanges
+	Stats    AntiEntropyStats
+	Lock     sync.Mutex
+	rng      *rand.Rand
+}
+
+// NewAntiEntropy creates anti-entropy with the given fanout and interval,
+// choosing peers with a generator seeded by seed
+func NewAntiEntropy(fanout, interval int, seed int64) (*AntiEntropy, error) {
+	if fanout < 1 || interval < 1 {
+		return nil, fmt.Errorf("anti-entropy fanout and interval must be positive, got %d and %d", fanout, interval)
+	}
+	return &AntiEntropy{Fanout: fanout, Interval: interval, rng: rand.New(rand.NewSource(seed))}, nil
+}
+
+// clone returns a copy with the same settings and statistics and a
+// generator continuing from a fresh seed drawn from this one's
+func (a *AntiEntropy) clone() *AntiEntropy {
+	if a == nil {
+		return nil
+	}
+	a.Lock.Lock()
+	defer a.Lock.Unlock()
+	return &AntiEntropy{Fanout: a.Fanout, Interval: a.Interval, Stats: a.Stats, rng: rand.New(rand.NewSource(a.rng.Int63()))}
+}
+
+// Digest returns the node's clock digest
+func (n *Node) Digest() ClockDigest {
+	n.Lock.RLock()
+	defer n.Lock.RUnlock()
+	digest := make(ClockDigest, len(n.updates))
+	for id, update := range n.updates {
+		digest[id] = update.Seq
+	}
+	return digest
+}
+
+// newer returns the updates the node holds that are newer than digest
+// covers, as sent to peer, in origin order
+func (n *Node) newer(peer string, digest ClockDigest) []*ClockUpdate {
+	n.Lock.Lock()
+	defer n.Lock.Unlock()
+	var updates []*ClockUpdate
+	for _, id := range sortedKeys(n.updates) {
+		update := n.updates[id]
+		if update.Seq <= digest[id] {
+			continue
+		}
+		if id == n.ID {
+			// The node's own update, which a Byzantine node may vary by peer
+			if update = n.outgoing(peer, update); update == nil {
+				continue
+			}
+		}
+		updates = append(updates, update)
+	}
+	return updates
+}
+
+// publish signs a fresh update of the node's own for anti-entropy to serve
+func (n *Node) publish() {
+	update := n.GetClockUpdate()
+	n.Lock.Lock()
+	defer n.Lock.Unlock()
+	update = n.mutate(update)
+	if n.updates == nil {
+		n.updates = make(map[string]*ClockUpdate)
+	}
+	n.updates[n.ID] = update
+}
+
+// round runs one anti-entropy round over the nodes in ids
+func (a *AntiEntropy) round(s *System, ids []string) {
+	a.Lock.Lock()
+	a.Stats.Rounds++
+	exchanging := (a.Stats.Rounds-1)%a.Interval == 0
+	a.Lock.Unlock()
+
+	var nodes []*Node
+	for _, id := range ids {
+		s.Lock.RLock()
+		node := s.Nodes[id]
+		reachable := node != nil && s.reachable(node)
+		s.Lock.RUnlock()
+		if reachable {
+			node.publish()
+			nodes = append(nodes, node)
+		}
+	}
+	if !exchanging {
+		return
+	}
+	for _, node := range nodes {
+		for _, peer := range a.peers(s, node) {
+			a.exchange(s, node, peer)
+		}
+	}
+}
+
+// peers picks up to Fanout of the node's neighbors it can reach
+func (a *AntiEntropy) peers(s *System, node *Node) []*Node {
+	node.Lock.RLock()
+	neighbors := append([]string(nil), node.Neighbors...)
+	node.Lock.RUnlock()
+	sort.Strings(neighbors)
+	var candidates []*Node
+	for _, id := range neighbors {
+		s.Lock.RLock()
+		peer := s.Nodes[id]
+		s.Lock.RUnlock()
+		if peer != nil && !s.IsPartitioned(id) && !s.IsFenced(id) && !s.IsSevered(node.ID, id) {
+			candidates = append(candidates, peer)
+		}
+	}
+	a.Lock.Lock()
+	defer a.Lock.Unlock()
+	a.rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	return candidates[:min(a.Fanout, len(candidates))]
+}
+
+// exchange swaps digests between node and peer and has each pull the
+// updates the other holds newer versions of. Either digest may be lost on
+// its link, and with it that side's pull.
+func (a *AntiEntropy) exchange(s *System, node, peer *Node) {
+	if _, err := s.Handshake(node, peer); err != nil {
+		return
+	}
+	ours, theirs := node.Digest(), peer.Digest()
+	_, sent := s.sendOver(node, peer, digestSize(ours))
+	_, replied := s.sendOver(peer, node, digestSize(theirs))
+	a.Lock.Lock()
+	a.Stats.Exchanges++
+	a.Stats.Bytes += digestSize(ours) + digestSize(theirs)
+	a.Lock.Unlock()
+	if replied {
+		a.pull(s, node, peer, ours)
+	}
+	if sent {
+		a.pull(s, peer, node, theirs)
+	}
+}
+
+// pull delivers to receiver the updates source holds beyond its digest
+func (a *AntiEntropy) pull(s *System, receiver, source *Node, digest ClockDigest) {
+	for _, update := range source.newer(receiver.ID, digest) {
+		size := wireSize("clock-update", *update)
+		if _, delivered := s.sendOver(source, receiver, size); !delivered {
+			s.Metrics.add(metricDropped, "clock-update", 1)
+			continue
+		}
+		a.Lock.Lock()
+		a.Stats.Pulled++
+		a.Stats.Bytes += size
+		a.Lock.Unlock()
+		s.trace(TraceEvent{Type: EventSend, Node: source.ID, Peer: receiver.ID, Update: update, Detail: "anti-entropy"})
+		s.receiveClockUpdate(update.NodeID, receiver, update)
+	}
+}
+
+// honestReachable returns the IDs of the reachable honest nodes
+func (s *System) honestReachable() []string {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	var ids []string
+	for _, id := range sortedKeys(s.Nodes) {
+		if node := s.Nodes[id]; !node.IsByzantine && s.reachable(node) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ConvergenceRounds runs gossip rounds until every reachable honest node
+// holds, from every other, an update at least as recent as the last one
+// that node signed when the call started, and returns how many it took. It gives up after limit rounds and returns -1.
+func (s *System) ConvergenceRounds(limit int) int {
+	s.Lock.RLock()
+	all := sortedKeys(s.Nodes)
+	s.Lock.RUnlock()
+	honest := s.honestReachable()
+	target := make(ClockDigest, len(honest))
+	for _, id := range honest {
+		node := s.Nodes[id]
+		node.Lock.RLock()
+		target[id] = node.sent
+		node.Lock.RUnlock()
+	}
+	for round := 1; round <= limit; round++ {
+		s.propagateRound(all)
+		converged := true
+		for _, id := range honest {
+			digest := s.Nodes[id].Digest()
+			for origin, seq := range target {
+				if origin != id && digest[origin] < seq {
+					converged = false
+				}
+			}
+		}
+		if converged {
+			return round
+		}
+	}
+	return -1
+}
@@ -0,0 +1,80 @@
+package bft
+
+import (
+	"io"
+	"testing"
+)
+
+// TestAntiEntropyConvergesAfterPartition tests that nodes cut off catch up on updates they missed by pulling them
+func TestAntiEntropyConvergesAfterPartition(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	system := newGossipSystem(t, nil)
+	var err error
+	if system.AntiEntropy, err = NewAntiEntropy(1, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	system.CreatePartition([]string{"A", "B"}, []string{"C", "D"})
+	for i := 0; i < 3; i++ {
+		system.propagateRound([]string{"A", "B", "C", "D"})
+	}
+	if digest := system.Nodes["A"].Digest(); digest["C"] != 0 || digest["B"] == 0 {
+		t.Fatalf("Expected A to hold B's updates and none of C's, got %v", digest)
+	}
+	system.HealPartition()
+	rounds := system.ConvergenceRounds(20)
+	if rounds < 1 {
+		t.Fatal("Expected the cluster to converge after the heal")
+	}
+	stats := system.AntiEntropy.Stats
+	if stats.Exchanges != 4*stats.Rounds || stats.Pulled == 0 {
+		t.Errorf("Expected one exchange per node and round and pulled updates, got %+v", stats)
+	}
+	for _, id := range []string{"A", "B", "C", "D"} {
+		if entries := len(system.Nodes[id].VectorClock.Timestamps()); entries != 4 {
+			t.Errorf("Expected %s to have entries for all four nodes, got %d", id, entries)
+		}
+	}
+}
+
+// TestAntiEntropyRelaysVerified tests that an update relayed by a third node still verifies under its origin's key and a forged one does not
+func TestAntiEntropyRelaysVerified(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	system := newGossipSystem(t, nil)
+	system.AntiEntropy, _ = NewAntiEntropy(1, 1, 1)
+	// A reaches C only through B
+	system.Nodes["A"].Neighbors = []string{"B"}
+	system.Nodes["C"].Neighbors = []string{"B"}
+	system.Nodes["B"].Neighbors = []string{"A", "C"}
+	if rounds := system.ConvergenceRounds(10); rounds < 0 {
+		t.Fatal("Expected A's updates to reach C through B")
+	}
+	if system.Nodes["C"].Digest()["A"] == 0 {
+		t.Error("Expected C to hold an update from A")
+	}
+
+	forged := *system.Nodes["A"].updates["A"]
+	forged.Seq += 100
+	system.Nodes["B"].Lock.Lock()
+	system.Nodes["B"].updates["A"] = &forged
+	system.Nodes["B"].Lock.Unlock()
+	system.propagateRound([]string{"B"})
+	if system.Nodes["C"].Digest()["A"] == forged.Seq {
+		t.Error("Expected C to reject an update B altered in relay")
+	}
+}
+
+// TestNewAntiEntropyValidates tests that a zero fanout or interval is refused
+func TestNewAntiEntropyValidates(t *testing.T) {
+	if _, err := NewAntiEntropy(0, 1, 1); err == nil {
+		t.Error("Expected a zero fanout to be refused")
+	}
+	if _, err := NewAntiEntropy(1, 0, 1); err == nil {
+		t.Error("Expected a zero interval to be refused")
+	}
+}
@@ -0,0 +1,331 @@
+package bft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Offline artifact verification.
+//
+// Auditors check what a cluster exported without running a node. Commit
+// proofs are checked against the public keys the nodes exported with
+// ExportKeys, one PEM file per node named after it. Write-ahead logs are
+// checked record by record: checksums, increasing sequence numbers and the
+// index blocks readers seek by; a torn tail, which a crash may leave and
+// opening the log drops, is reported but not an error, while a corrupt
+// record is. Snapshots are checked for a known header and consistent
+// entries. Sealed logs and snapshots are authenticated too when the node's
+// at-rest secret is given.
+
+var ErrSnapshotInvalid = errors.New("snapshot is inconsistent")
+
+// keyFileExt is the extension of exported public key files
+const keyFileExt = ".pem"
+
+// ExportKeys writes every node's public key to dir as <id>.pem
+func (s *System) ExportKeys(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	for _, id := range sortedKeys(s.Nodes) {
+		node := s.Nodes[id]
+		node.Lock.RLock()
+		data, err := crypto.MarshalPublicKey(node.PublicKey)
+		node.Lock.RUnlock()
+		if err != nil {
+			return fmt.Errorf("node %s: %w", id, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, id+keyFileExt), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadKeys reads the public keys exported to dir by node ID
+func LoadKeys(dir string) (map[string]crypto.PublicKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := crypto.ParsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys[strings.TrimSuffix(filepath.Base(path), keyFileExt)] = key
+	}
+	return keys, nil
+}
+
+// ExportCommitProof writes a proof to path as JSON
+func ExportCommitProof(path string, proof *CommitProof) error {
+	data, err := json.MarshalIndent(proof, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// VerifyCommitProofFile reads the proof at path and checks its signature
+// against its leader's key
+func VerifyCommitProofFile(path string, keys map[string]crypto.PublicKey) (*CommitProof, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var proof CommitProof
+	if err := decoder.Decode(&proof); err != nil {
+		return nil, fmt.Errorf("proof %s: %w", path, err)
+	}
+	key, exists := keys[proof.Leader]
+	if !exists {
+		return &proof, fmt.Errorf("%w: no key for leader %q", ErrUnknownNode, proof.Leader)
+	}
+	if err := crypto.Verify(key, proofDigest(&proof), proof.Signature); err != nil {
+		return &proof, fmt.Errorf("%w: %v", ErrInvalidCommitProof, err)
+	}
+	return &proof, nil
+}
+
+// WALReport describes a verified write-ahead log
+type WALReport struct {
+	Records    int
+	FirstSeq   uint64
+	LastSeq    uint64
+	Bytes      int64 // Of valid records
+	TornBytes  int64 // Of an incomplete last record, dropped when the log is opened
+	StaleIndex bool  // The index does not match the log and is rebuilt when it is opened
+	Sealed     bool  // Payloads were authenticated with the node's key
+}
+
+func (r *WALReport) String() string {
+	var b strings.Builder
+	if r.Records == 0 {
+		b.WriteString("WAL is empty")
+	} else {
+		fmt.Fprintf(&b, "WAL holds %d records, sequence %d to %d, in %d bytes", r.Records, r.FirstSeq, r.LastSeq, r.Bytes)
+	}
+	if r.Sealed {
+		b.WriteString(", every payload authenticated")
+	}
+	b.WriteString("\n")
+	if r.TornBytes > 0 {
+		fmt.Fprintf(&b, "Warning: %d bytes of a torn last record follow\n", r.TornBytes)
+	}
+	if r.StaleIndex {
+		b.WriteString("Warning: the index does not match the log\n")
+	}
+	return b.String()
+}
+
+// VerifyWAL checks the log in dir, opening sealed payloads with keyring
+// unless it is nil
+func VerifyWAL(dir string, keyring *Keyring) (*WALReport, error) {
+	log, err := os.ReadFile(filepath.Join(dir, walFile))
+	if err != nil {
+		return nil, err
+	}
+	report := &WALReport{Sealed: keyring != nil}
+	var index []byte // The blocks the index should hold
+	for offset := int64(0); offset < int64(len(log)); {
+		rec, size, err := decodeRecord(log[offset:])
+		if err != nil {
+			if torn(log[offset:]) {
+				report.TornBytes = int64(len(log)) - offset
+				break
+			}
+			return report, fmt.Errorf("%w: record %d at offset %d", ErrWALCorrupt, report.Records+1, offset)
+		}
+		if report.Records > 0 && rec.Seq <= report.LastSeq {
+			return report, fmt.Errorf("%w: %d after %d at offset %d", ErrWALSequence, rec.Seq, report.LastSeq, offset)
+		}
+		if keyring != nil {
+			if _, err := keyring.DecryptRecords([]WALRecord{rec}); err != nil {
+				return report, err
+			}
+		}
+		if report.Records%IndexInterval == 0 {
+			index = binary.BigEndian.AppendUint64(index, rec.Seq)
+			index = binary.BigEndian.AppendUint64(index, uint64(offset))
+		}
+		if report.Records == 0 {
+			report.FirstSeq = rec.Seq
+		}
+		report.Records++
+		report.LastSeq = rec.Seq
+		offset += int64(size)
+		report.Bytes = offset
+	}
+	actual, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return report, err
+	}
+	report.StaleIndex = !bytes.Equal(actual, index)
+	return report, nil
+}
+
+// torn reports whether buf starts with a record cut short by the end of the
+// log, as opposed to a complete record that fails its checks
+func torn(buf []byte) bool {
+	if len(buf) < recordHeaderSize {
+		return true
+	}
+	length := int(binary.BigEndian.Uint32(buf[8:12]))
+	return length <= MaxRecordSize && len(buf) < recordHeaderSize+length
+}
+
+// SnapshotReport describes a verified snapshot
+type SnapshotReport struct {
+	Sealed      bool
+	CommitIndex int64
+	Entries     int
+}
+
+func (r *SnapshotReport) String() string {
+	kind := "Plaintext"
+	if r.Sealed {
+		kind = "Sealed"
+	}
+	return fmt.Sprintf("%s snapshot at commit index %d holds %d entries\n", kind, r.CommitIndex, r.Entries)
+}
+
+// VerifySnapshot checks the snapshot at path, which needs keyring if it is
+// sealed: entries must have distinct keys, be in increasing index order and
+// be covered by the commit index, or their namespace's if an engine ordered
+// it. Entries of different index spaces may share an index.
+func VerifySnapshot(path string, keyring *Keyring) (*SnapshotReport, error) {
+	snapshot, sealed, err := readSnapshot(path, keyring)
+	if err != nil {
+		return nil, err
+	}
+	report := &SnapshotReport{Sealed: sealed, CommitIndex: snapshot.CommitIndex, Entries: len(snapshot.Entries)}
+	keys := make(map[string]int64, len(snapshot.Entries))
+	for i, entry := range snapshot.Entries {
+		bound := snapshot.CommitIndex
+		if index, exists := snapshot.Namespaces[Namespace(entry.Key)]; exists {
+			bound = max(bound, index)
+		}
+		switch {
+		case entry.Key == "":
+			return report, fmt.Errorf("%w: entry %d has no key", ErrSnapshotInvalid, entry.Index)
+		case keys[entry.Key] != 0:
+			return report, fmt.Errorf("%w: key %q at indexes %d and %d", ErrSnapshotInvalid, entry.Key, keys[entry.Key], entry.Index)
+		case entry.Index <= 0 || entry.Index > bound:
+			return report, fmt.Errorf("%w: entry %d outside commit index %d", ErrSnapshotInvalid, entry.Index, bound)
+		case i > 0 && (entry.Index < snapshot.Entries[i-1].Index || entry.Index == snapshot.Entries[i-1].Index && len(snapshot.Namespaces) == 0):
+			return report, fmt.Errorf("%w: entry %d after %d", ErrSnapshotInvalid, entry.Index, snapshot.Entries[i-1].Index)
+		}
+		keys[entry.Key] = entry.Index
+	}
+	return report, nil
+}
+
+// artifactKeyring builds the keyring for node from the at-rest secret in
+// secretFile, nil if no file is given
+func artifactKeyring(node, secretFile string) (*Keyring, error) {
+	if secretFile == "" {
+		return nil, nil
+	}
+	if node == "" {
+		return nil, fmt.Errorf("-secret-file needs -node")
+	}
+	secret, err := os.ReadFile(secretFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(node, SecretKeySource{Secret: bytes.TrimSpace(secret)}, 1)
+}
+
+// VerifyProofCommand implements `wahello verify-proof -proof file -keys dir`
+func VerifyProofCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("verify-proof", flag.ContinueOnError)
+	path := flags.String("proof", "", "JSON file with the commit proof")
+	dir := flags.String("keys", "", "directory of the nodes' exported public keys")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" || *dir == "" {
+		return fmt.Errorf("usage: verify-proof -proof file -keys dir")
+	}
+	keys, err := LoadKeys(*dir)
+	if err != nil {
+		return err
+	}
+	proof, err := VerifyCommitProofFile(*path, keys)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "Proof that request %s committed at index %d is signed by leader %s (%s)\n",
+		proof.Digest, proof.Index, proof.Leader, crypto.SchemeOf(keys[proof.Leader]))
+	return err
+}
+
+// VerifyWALCommand implements `wahello verify-wal -path dir [-node id
+// -secret-file file]`
+func VerifyWALCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("verify-wal", flag.ContinueOnError)
+	dir := flags.String("path", "", "directory of the write-ahead log")
+	node := flags.String("node", "", "node the log belongs to, for opening sealed records")
+	secretFile := flags.String("secret-file", "", "file with the node's at-rest secret, to authenticate sealed records")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("usage: verify-wal -path dir [-node id -secret-file file]")
+	}
+	keyring, err := artifactKeyring(*node, *secretFile)
+	if err != nil {
+		return err
+	}
+	report, err := VerifyWAL(*dir, keyring)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(stdout, report.String())
+	return err
+}
+
+// VerifySnapshotCommand implements `wahello verify-snapshot -path file
+// [-node id -secret-file file]`
+func VerifySnapshotCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("verify-snapshot", flag.ContinueOnError)
+	path := flags.String("path", "", "snapshot file")
+	node := flags.String("node", "", "node the snapshot belongs to, for opening a sealed one")
+	secretFile := flags.String("secret-file", "", "file with the node's at-rest secret, to open a sealed snapshot")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return fmt.Errorf("usage: verify-snapshot -path file [-node id -secret-file file]")
+	}
+	keyring, err := artifactKeyring(*node, *secretFile)
+	if err != nil {
+		return err
+	}
+	report, err := VerifySnapshot(*path, keyring)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(stdout, report.String())
+	return err
+}
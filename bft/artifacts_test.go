@@ -0,0 +1,154 @@
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// TestVerifyProofCommand tests that an exported proof verifies against exported keys of either scheme and a tampered one does not
+func TestVerifyProofCommand(t *testing.T) {
+	system := newGeoSystem(t)
+	if err := system.Nodes[system.Leader].UseSignatureScheme(crypto.SchemeEd25519); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys")
+	if err := system.ExportKeys(keys); err != nil {
+		t.Fatal(err)
+	}
+	req := &ClientRequest{Client: "c", RequestID: 7, Payload: payload(OpWrite, "x", "1")}
+	proof, err := system.IssueCommitProof(req, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "proof.json")
+	if err := ExportCommitProof(path, proof); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := VerifyProofCommand([]string{"-proof", path, "-keys", keys}, &out); err != nil {
+		t.Fatalf("Expected the proof to verify, got %v", err)
+	}
+	if !strings.Contains(out.String(), "at index 3 is signed by leader "+system.Leader+" (ed25519)") {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+
+	forged := *proof
+	forged.Index = 4
+	ExportCommitProof(path, &forged)
+	if err := VerifyProofCommand([]string{"-proof", path, "-keys", keys}, &out); !errors.Is(err, ErrInvalidCommitProof) {
+		t.Errorf("Expected a rebound proof to fail, got %v", err)
+	}
+	os.Remove(filepath.Join(keys, system.Leader+".pem"))
+	if err := VerifyProofCommand([]string{"-proof", path, "-keys", keys}, &out); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("Expected a missing leader key to fail, got %v", err)
+	}
+	if err := VerifyProofCommand(nil, &out); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("Expected a usage error, got %v", err)
+	}
+}
+
+// TestVerifyWAL tests that a WAL passes with a torn tail but not with a flipped byte
+func TestVerifyWAL(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := OpenWAL(dir, SyncPolicy{Mode: SyncPerCommit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq := 1; seq <= 100; seq++ {
+		if err := wal.Append(uint64(seq), []byte(fmt.Sprintf("v%d", seq))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wal.Close()
+	var out bytes.Buffer
+	if err := VerifyWALCommand([]string{"-path", dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "WAL holds 100 records, sequence 1 to 100, in 1892 bytes\n" {
+		t.Errorf("Unexpected report: %q", out.String())
+	}
+
+	log := filepath.Join(dir, walFile)
+	data, _ := os.ReadFile(log)
+	os.WriteFile(log, append(data, encodeRecord(101, []byte("v101"))[:10]...), 0o644)
+	report, err := VerifyWAL(dir, nil)
+	if err != nil || report.TornBytes != 10 || report.StaleIndex {
+		t.Errorf("Expected a torn tail to be reported, got %+v, %v", report, err)
+	}
+
+	data[recordHeaderSize] ^= 1
+	os.WriteFile(log, data, 0o644)
+	if _, err := VerifyWAL(dir, nil); !errors.Is(err, ErrWALCorrupt) {
+		t.Errorf("Expected a flipped byte to be corrupt, got %v", err)
+	}
+	os.Truncate(log, 0)
+	if report, err := VerifyWAL(dir, nil); err != nil || !report.StaleIndex {
+		t.Errorf("Expected the index of an emptied log to be stale, got %+v, %v", report, err)
+	}
+}
+
+// TestVerifySealedArtifacts tests that sealed logs and snapshots verify only with the node's secret
+func TestVerifySealedArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	os.WriteFile(secretFile, []byte("correct horse battery staple\n"), 0o600)
+	keyring := newTestKeyring(t, "A", SecretKeySource{Secret: []byte("correct horse battery staple")})
+
+	walDir := filepath.Join(dir, "wal")
+	wal, err := OpenEncryptedWAL(walDir, SyncPolicy{Mode: SyncPerCommit}, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal.Append(1, []byte("secret"))
+	wal.Close()
+	var out bytes.Buffer
+	if err := VerifyWALCommand([]string{"-path", walDir, "-node", "A", "-secret-file", secretFile}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "every payload authenticated") {
+		t.Errorf("Expected the payloads to be authenticated, got %q", out.String())
+	}
+	if err := VerifyWALCommand([]string{"-path", walDir, "-node", "B", "-secret-file", secretFile}, &out); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected another node's key to fail, got %v", err)
+	}
+
+	store := NewStore()
+	store.Apply(Entry{Index: 1, Key: "x", Value: "1"})
+	store.Apply(Entry{Index: 2, Key: "y", Value: "2"})
+	path := filepath.Join(dir, "store.snap")
+	if err := SaveSnapshot(path, store, keyring); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := VerifySnapshotCommand([]string{"-path", path, "-node", "A", "-secret-file", secretFile}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Sealed snapshot at commit index 2 holds 2 entries\n" {
+		t.Errorf("Unexpected report: %q", out.String())
+	}
+	if err := VerifySnapshotCommand([]string{"-path", path}, &out); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected a sealed snapshot to need the secret, got %v", err)
+	}
+}
+
+// TestVerifySnapshotInconsistent tests that entries beyond the commit index are caught
+func TestVerifySnapshotInconsistent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.snap")
+	store := NewStore()
+	store.Apply(Entry{Index: 5, Key: "x", Value: "1"})
+	store.CommitIndex = 3
+	if err := SaveSnapshot(path, store, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySnapshot(path, nil); !errors.Is(err, ErrSnapshotInvalid) {
+		t.Errorf("Expected ErrSnapshotInvalid, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package bft
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hard and soft scenario assertions.
+//
+// A chaos run checks two kinds of assertion after every round. A hard
+// assertion is a safety invariant: if it fails the run has found a bug, so
+// it stops with an *InvariantViolation and the schedule can be shrunk. A
+// soft assertion is a liveness or performance expectation that faults are
+// allowed to degrade: a miss is recorded as a warning with its round and
+// counted in the run's metrics, and the run continues. Only hard violations
+// fail a run.
+
+// Severity says whether a failed assertion fails the run
+type Severity string
+
+const (
+	SeverityHard Severity = "hard" // Safety invariant, fails the run
+	SeveritySoft Severity = "soft" // Expectation, warns and records metrics
+)
+
+// Assertion is a named check run after every round
+type Assertion struct {
+	Name     string
+	Severity Severity
+	Check    func(system *System) error
+}
+
+// Hard returns a safety invariant
+func Hard(name string, check func(system *System) error) Assertion {
+	return Assertion{Name: name, Severity: SeverityHard, Check: check}
+}
+
+// Soft returns a liveness or performance expectation
+func Soft(name string, check func(system *System) error) Assertion {
+	return Assertion{Name: name, Severity: SeveritySoft, Check: check}
+}
+
+// Warning is a missed soft expectation
+type Warning struct {
+	Round     int
+	Assertion string
+	Err       error
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("round %d: %s: %v", w.Round, w.Assertion, w.Err)
+}
+
+// ChaosReport collects the warnings and metrics of a chaos run
+type ChaosReport struct {
+	Rounds         int
+	Warnings       []Warning
+	PostMortem     *PostMortem // Set if the run failed
+	PostMortemPath string      // Where the post-mortem was written, if anywhere
+	misses         map[string]int
+}
+
+func newChaosReport(assertions []Assertion) *ChaosReport {
+	report := &ChaosReport{misses: make(map[string]int)}
+	for _, assertion := range assertions {
+		if assertion.Severity == SeveritySoft {
+			report.misses[assertion.Name] = 0
+		}
+	}
+	return report
+}
+
+// assertions returns the run's assertions, with Invariant first as a hard one
+func (c *ChaosRun) assertions() []Assertion {
+	var assertions []Assertion
+	if c.Invariant != nil {
+		assertions = append(assertions, Hard("invariant", c.Invariant))
+	}
+	return append(assertions, c.Assertions...)
+}
+
+// check runs every assertion against the system, recording soft misses and
+// returning the first hard violation
+func (r *ChaosReport) check(system *System, round int, assertions []Assertion) error {
+	for _, assertion := range assertions {
+		err := assertion.Check(system)
+		if err == nil {
+			continue
+		}
+		if assertion.Severity == SeveritySoft {
+			r.misses[assertion.Name]++
+			r.Warnings = append(r.Warnings, Warning{Round: round, Assertion: assertion.Name, Err: err})
+			system.trace(TraceEvent{Type: EventWarning, Detail: assertion.Name + ": " + err.Error()})
+			continue
+		}
+		system.trace(TraceEvent{Type: EventViolation, Detail: err.Error()})
+		return &InvariantViolation{Round: round, Err: fmt.Errorf("%s: %w", assertion.Name, err)}
+	}
+	return nil
+}
+
+// Metrics returns, per soft assertion, the number of rounds it was missed
+// and the fraction of checked rounds that is
+func (r *ChaosReport) Metrics() map[string]float64 {
+	metrics := map[string]float64{"rounds": float64(r.Rounds), "warnings": float64(len(r.Warnings))}
+	for name, misses := range r.misses {
+		metrics[name+"_misses"] = float64(misses)
+		if r.Rounds > 0 {
+			metrics[name+"_miss_rate"] = float64(misses) / float64(r.Rounds)
+		}
+	}
+	return metrics
+}
+
+func (r *ChaosReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d rounds, %d warnings\n", r.Rounds, len(r.Warnings))
+	for _, name := range sortedKeys(r.misses) {
+		fmt.Fprintf(&b, "  soft %s: missed in %d of %d rounds\n", name, r.misses[name], r.Rounds)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(&b, "  %s\n", warning)
+	}
+	return b.String()
+}
+
+// livenessLost returns the soft expectations still missed in the last round,
+// and the round since which the first of them has been missed without a break
+func (r *ChaosReport) livenessLost() (int, []string) {
+	last := r.Rounds - 1
+	var missed []string
+	since := last
+	for _, warning := range r.Warnings {
+		if warning.Round == last {
+			missed = append(missed, fmt.Sprintf("%s: %v", warning.Assertion, warning.Err))
+		}
+	}
+	if len(missed) == 0 {
+		return 0, nil
+	}
+	rounds := make(map[int]bool)
+	name := strings.SplitN(missed[0], ":", 2)[0]
+	for _, warning := range r.Warnings {
+		if warning.Assertion == name {
+			rounds[warning.Round] = true
+		}
+	}
+	for since > 0 && rounds[since-1] {
+		since--
+	}
+	return since, missed
+}
+
+// QuorumAvailable is a soft expectation that the voters keep a quorum
+func QuorumAvailable(system *System) error {
+	if health := system.QuorumHealth(); health.Lost() {
+		return fmt.Errorf("%d of %d voters reachable, need %d", health.Reachable, len(health.Voters), health.Quorum)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package bft
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestSoftAssertionsWarn tests that missed expectations are recorded without failing the run
+func TestSoftAssertionsWarn(t *testing.T) {
+	run := newChaosRun()
+	run.Assertions = []Assertion{Soft("quorum-available", QuorumAvailable)}
+	schedule := Schedule{{At: 2, Kind: FaultPartition, Nodes: []string{"B", "C", "D"}, Duration: 2}}
+
+	report, err := run.RunReport(schedule)
+	if err != nil {
+		t.Fatalf("Expected losing the quorum to be tolerated as degradation, got %v", err)
+	}
+	if len(report.Warnings) != 2 || report.Warnings[0].Round != 2 || report.Warnings[1].Round != 3 {
+		t.Errorf("Expected warnings in rounds 2 and 3, got %v", report.Warnings)
+	}
+	metrics := report.Metrics()
+	if metrics["quorum-available_misses"] != 2 || metrics["rounds"] != 6 {
+		t.Errorf("Expected 2 misses over 6 rounds, got %v", metrics)
+	}
+	if !strings.Contains(report.String(), "soft quorum-available: missed in 2 of 6 rounds") {
+		t.Errorf("Expected the report to summarize the misses:\n%s", report)
+	}
+}
+
+// TestHardAssertionsFail tests that a safety violation stops the run even alongside soft warnings
+func TestHardAssertionsFail(t *testing.T) {
+	run := newChaosRun()
+	run.Invariant = nil
+	run.Assertions = []Assertion{
+		Soft("quorum-available", QuorumAvailable),
+		Hard("leader-reachable", leaderReachable),
+	}
+	schedule := Schedule{
+		{At: 1, Kind: FaultPartition, Nodes: []string{"B", "C", "D"}},
+		{At: 3, Kind: FaultPartition, Nodes: []string{"A"}},
+	}
+
+	report, err := run.RunReport(schedule)
+	var violation *InvariantViolation
+	if !errors.As(err, &violation) || violation.Round != 3 || !strings.Contains(err.Error(), "leader-reachable") {
+		t.Fatalf("Expected a leader-reachable violation in round 3, got %v", err)
+	}
+	if len(report.Warnings) != 3 {
+		t.Errorf("Expected warnings in rounds 1 to 3 before the violation, got %v", report.Warnings)
+	}
+
+	shrunk, err := run.Shrink(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shrunk.Schedule) != 1 || shrunk.Schedule[0].Nodes[0] != "A" {
+		t.Errorf("Expected shrinking to keep only the fault behind the hard violation, got %v", shrunk.Schedule)
+	}
+}
@@ -0,0 +1,411 @@
+package bft
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Encryption at rest.
+//
+// A node encrypts what it persists, its WAL records and store snapshots,
+// with AES-256-GCM under a key of its own. Keys come from a KeySource:
+// either derived with HKDF from a configured secret and the node's ID, so
+// no two nodes share a key, or fetched from a KMS. Every sealed blob starts
+// with the version of the key that sealed it, so rotating the key affects
+// only new writes and older data stays readable. Rewrapping the WAL or a
+// snapshot reseals it under the current version, after which older key
+// versions can be destroyed. The authenticated data binds a WAL record to
+// its sequence number, so records cannot be swapped or replayed in place.
+//
+// A sealed blob is laid out as
+//
+//	key version (4 bytes) | nonce (12 bytes) | ciphertext and tag
+
+var (
+	ErrNoKey   = errors.New("encryption key unavailable")
+	ErrDecrypt = errors.New("encrypted data failed authentication")
+)
+
+const sealedHeaderSize = 4
+
+// KeySource provides a node's data key at a version
+type KeySource interface {
+	DataKey(nodeID string, version uint32) ([]byte, error)
+}
+
+// SecretKeySource derives node keys from a configured secret
+type SecretKeySource struct {
+	Secret []byte
+}
+
+// DataKey derives a 256-bit key from the secret with HKDF-SHA256
+func (s SecretKeySource) DataKey(nodeID string, version uint32) ([]byte, error) {
+	if len(s.Secret) < 16 {
+		return nil, fmt.Errorf("%w: secret must be at least 16 bytes", ErrNoKey)
+	}
+	return hkdf.Key(sha256.New, s.Secret, nil, fmt.Sprintf("wahello at-rest %s v%d", nodeID, version), 32)
+}
+
+// MemoryKMS stands in for a key management service: it generates a random
+// data key the first time a node asks for a version and can destroy it
+type MemoryKMS struct {
+	keys map[string]map[uint32][]byte
+	Lock sync.Mutex
+}
+
+// NewMemoryKMS creates an empty KMS
+func NewMemoryKMS() *MemoryKMS {
+	return &MemoryKMS{keys: make(map[string]map[uint32][]byte)}
+}
+
+// DataKey returns the node's key at version, generating it if new
+func (k *MemoryKMS) DataKey(nodeID string, version uint32) ([]byte, error) {
+	k.Lock.Lock()
+	defer k.Lock.Unlock()
+	if k.keys[nodeID] == nil {
+		k.keys[nodeID] = make(map[uint32][]byte)
+	}
+	key, exists := k.keys[nodeID][version]
+	if exists && key == nil {
+		return nil, fmt.Errorf("key %s v%d was destroyed", nodeID, version)
+	}
+	if !exists {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		k.keys[nodeID][version] = key
+	}
+	return key, nil
+}
+
+// Destroy deletes a node's key version. Later requests for it fail.
+func (k *MemoryKMS) Destroy(nodeID string, version uint32) {
+	k.Lock.Lock()
+	defer k.Lock.Unlock()
+	if k.keys[nodeID] == nil {
+		k.keys[nodeID] = make(map[uint32][]byte)
+	}
+	k.keys[nodeID][version] = nil
+}
+
+// Keyring seals and opens a node's persisted data
+type Keyring struct {
+	NodeID  string
+	Source  KeySource
+	Version uint32     // Key version new data is sealed with
+	Audit   *AuditSink // Receives key rotations when set
+	Lock    sync.Mutex
+	aeads   map[uint32]cipher.AEAD
+}
+
+// NewKeyring creates a keyring sealing with the given version of the
+// node's key, 1 for a new node
+func NewKeyring(nodeID string, source KeySource, version uint32) (*Keyring, error) {
+	if version < 1 {
+		return nil, fmt.Errorf("%w: key versions start at 1", ErrNoKey)
+	}
+	k := &Keyring{NodeID: nodeID, Source: source, Version: version, aeads: make(map[uint32]cipher.AEAD)}
+	if _, err := k.aead(version); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// aead returns the cipher for a key version. The caller must hold k.Lock
+// or be constructing the keyring.
+func (k *Keyring) aead(version uint32) (cipher.AEAD, error) {
+	if aead, exists := k.aeads[version]; exists {
+		return aead, nil
+	}
+	key, err := k.Source.DataKey(k.NodeID, version)
+	if err == nil && len(key) != 32 {
+		err = fmt.Errorf("key is %d bytes, want 32", len(key))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s v%d: %v", ErrNoKey, k.NodeID, version, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k.aeads[version] = aead
+	return aead, nil
+}
+
+// Rotate switches sealing to the next key version once it is available
+func (k *Keyring) Rotate() (uint32, error) {
+	k.Lock.Lock()
+	defer k.Lock.Unlock()
+	if _, err := k.aead(k.Version + 1); err != nil {
+		return k.Version, err
+	}
+	k.Version++
+	if k.Audit != nil {
+		k.Audit.Emit(AuditEvent{Kind: AuditKeyRotation, Node: k.NodeID, Detail: fmt.Sprintf("data key rotated to version %d", k.Version)})
+	}
+	return k.Version, nil
+}
+
+// Seal encrypts plaintext under the current key version, authenticating aad
+func (k *Keyring) Seal(aad, plaintext []byte) ([]byte, error) {
+	k.Lock.Lock()
+	defer k.Lock.Unlock()
+	aead, err := k.aead(k.Version)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, sealedHeaderSize+aead.NonceSize(), sealedHeaderSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	binary.BigEndian.PutUint32(sealed, k.Version)
+	nonce := sealed[sealedHeaderSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(sealed, nonce, plaintext, sealedAAD(sealed[:sealedHeaderSize], aad)), nil
+}
+
+// Open decrypts a blob sealed under any key version still available
+func (k *Keyring) Open(aad, sealed []byte) ([]byte, error) {
+	version, err := SealedVersion(sealed)
+	if err != nil {
+		return nil, err
+	}
+	k.Lock.Lock()
+	aead, err := k.aead(version)
+	k.Lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < sealedHeaderSize+aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%w: truncated", ErrDecrypt)
+	}
+	nonce := sealed[sealedHeaderSize : sealedHeaderSize+aead.NonceSize()]
+	ciphertext := sealed[sealedHeaderSize+aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, sealedAAD(sealed[:sealedHeaderSize], aad))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return plaintext, nil
+}
+
+// SealedVersion returns the key version a blob was sealed with
+func SealedVersion(sealed []byte) (uint32, error) {
+	if len(sealed) < sealedHeaderSize {
+		return 0, fmt.Errorf("%w: truncated", ErrDecrypt)
+	}
+	return binary.BigEndian.Uint32(sealed), nil
+}
+
+// sealedAAD authenticates the key version along with the caller's data
+func sealedAAD(version, aad []byte) []byte {
+	return append(append([]byte(nil), version...), aad...)
+}
+
+// walAAD binds a WAL record's payload to its sequence number
+func walAAD(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte("wal"), seq)
+}
+
+// OpenEncryptedWAL opens the log in dir, sealing appended payloads with keyring
+func OpenEncryptedWAL(dir string, policy SyncPolicy, keyring *Keyring) (*WAL, error) {
+	w, err := OpenWAL(dir, policy)
+	if err != nil {
+		return nil, err
+	}
+	w.keyring = keyring
+	return w, nil
+}
+
+// DecryptRecords returns the plaintext of records read from an encrypted WAL
+func (k *Keyring) DecryptRecords(records []WALRecord) ([]WALRecord, error) {
+	plain := make([]WALRecord, len(records))
+	for i, rec := range records {
+		payload, err := k.Open(walAAD(rec.Seq), rec.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("wal record %d: %w", rec.Seq, err)
+		}
+		plain[i] = WALRecord{Seq: rec.Seq, Payload: payload}
+	}
+	return plain, nil
+}
+
+// RewrapWAL reseals every record of the closed log in dir under the
+// keyring's current version and returns the number of records rewritten.
+// The new log replaces the old one atomically; a torn tail is dropped.
+func RewrapWAL(dir string, keyring *Keyring) (int, error) {
+	file, err := os.Open(filepath.Join(dir, walFile))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	tmpPath := filepath.Join(dir, walFile+".rewrap")
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpPath)
+	out := bufio.NewWriter(tmp)
+	count := 0
+	var rewrapErr error
+	err = scanRecords(file, 0, func(rec WALRecord, _ int64, _ int) bool {
+		var payload []byte
+		if payload, rewrapErr = keyring.Open(walAAD(rec.Seq), rec.Payload); rewrapErr != nil {
+			rewrapErr = fmt.Errorf("wal record %d: %w", rec.Seq, rewrapErr)
+			return false
+		}
+		if payload, rewrapErr = keyring.Seal(walAAD(rec.Seq), payload); rewrapErr != nil {
+			return false
+		}
+		if _, rewrapErr = out.Write(encodeRecord(rec.Seq, payload)); rewrapErr != nil {
+			return false
+		}
+		count++
+		return true
+	})
+	if err == nil || errors.Is(err, ErrWALCorrupt) {
+		err = rewrapErr
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, walFile)); err != nil {
+		return 0, err
+	}
+	// The index is rebuilt from the new log the next time it is opened
+	return count, os.Truncate(filepath.Join(dir, indexFile), 0)
+}
+
+// Snapshot file headers
+var (
+	snapshotPlain  = []byte("WHSNAP0\n")
+	snapshotSealed = []byte("WHSNAP1\n")
+)
+
+// storeSnapshot is the persisted form of a store
+type storeSnapshot struct {
+	CommitIndex int64            `json:"commit_index"`
+	Namespaces  map[string]int64 `json:"namespaces,omitempty"` // See Store.Namespaces
+	Entries     []Entry          `json:"entries"`
+}
+
+// SaveSnapshot writes store to path, sealed with keyring unless it is nil.
+// The file is replaced atomically.
+func SaveSnapshot(path string, store *Store, keyring *Keyring) error {
+	snapshot := storeSnapshot{CommitIndex: store.CommitIndex, Namespaces: store.Namespaces}
+	for _, key := range sortedKeys(store.Entries) {
+		snapshot.Entries = append(snapshot.Entries, store.Entries[key])
+	}
+	sort.Slice(snapshot.Entries, func(i, j int) bool { return snapshot.Entries[i].Index < snapshot.Entries[j].Index })
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	header := snapshotPlain
+	if keyring != nil {
+		if data, err = keyring.Seal([]byte("snapshot"), data); err != nil {
+			return err
+		}
+		header = snapshotSealed
+	}
+
+	tmpPath := path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	_, err = tmp.Write(append(append([]byte(nil), header...), data...))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// LoadSnapshot reads a store written by SaveSnapshot. A sealed snapshot
+// needs keyring; a plaintext one is read either way, so saving it again
+// with a keyring encrypts an existing deployment's snapshots.
+func LoadSnapshot(path string, keyring *Keyring) (*Store, error) {
+	snapshot, _, err := readSnapshot(path, keyring)
+	if err != nil {
+		return nil, err
+	}
+	store := NewStore()
+	for _, entry := range snapshot.Entries {
+		store.Entries[entry.Key] = entry
+	}
+	store.CommitIndex = snapshot.CommitIndex
+	store.Namespaces = snapshot.Namespaces
+	return store, nil
+}
+
+// readSnapshot reads and decodes the snapshot at path, opening it with
+// keyring if it is sealed, and reports whether it was
+func readSnapshot(path string, keyring *Keyring) (*storeSnapshot, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	sealed := false
+	switch {
+	case len(data) >= len(snapshotSealed) && string(data[:len(snapshotSealed)]) == string(snapshotSealed):
+		if keyring == nil {
+			return nil, false, fmt.Errorf("%w: snapshot %s is encrypted", ErrNoKey, path)
+		}
+		if data, err = keyring.Open([]byte("snapshot"), data[len(snapshotSealed):]); err != nil {
+			return nil, false, fmt.Errorf("snapshot %s: %w", path, err)
+		}
+		sealed = true
+	case len(data) >= len(snapshotPlain) && string(data[:len(snapshotPlain)]) == string(snapshotPlain):
+		data = data[len(snapshotPlain):]
+	default:
+		return nil, false, fmt.Errorf("snapshot %s: unknown format", path)
+	}
+
+	var snapshot storeSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, false, fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	return &snapshot, sealed, nil
+}
+
+// RewrapSnapshot reseals the snapshot at path under the keyring's current
+// version, encrypting it if it was plaintext
+func RewrapSnapshot(path string, keyring *Keyring) error {
+	store, err := LoadSnapshot(path, keyring)
+	if err != nil {
+		return err
+	}
+	return SaveSnapshot(path, store, keyring)
+}
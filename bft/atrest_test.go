@@ -0,0 +1,171 @@
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestKeyring creates a keyring for node backed by kms
+func newTestKeyring(t *testing.T, node string, kms KeySource) *Keyring {
+	t.Helper()
+	keyring, err := NewKeyring(node, kms, 1)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return keyring
+}
+
+// TestSealOpen tests that sealed data round-trips and rejects tampering and the wrong context
+func TestSealOpen(t *testing.T) {
+	keyring := newTestKeyring(t, "A", SecretKeySource{Secret: []byte("correct horse battery staple")})
+	sealed, err := keyring.Seal([]byte("ctx"), []byte("commit 42"))
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("commit 42")) {
+		t.Error("Expected the sealed blob not to contain the plaintext")
+	}
+	if plain, err := keyring.Open([]byte("ctx"), sealed); err != nil || string(plain) != "commit 42" {
+		t.Errorf("Expected to open the blob, got %q, %v", plain, err)
+	}
+	if _, err := keyring.Open([]byte("other"), sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for the wrong context, got %v", err)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := keyring.Open([]byte("ctx"), sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for a tampered blob, got %v", err)
+	}
+}
+
+// TestNodeKeysDiffer tests that nodes derive distinct keys from a shared secret
+func TestNodeKeysDiffer(t *testing.T) {
+	source := SecretKeySource{Secret: []byte("correct horse battery staple")}
+	sealed, _ := newTestKeyring(t, "A", source).Seal(nil, []byte("state"))
+	if _, err := newTestKeyring(t, "B", source).Open(nil, sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected B to be unable to open A's data, got %v", err)
+	}
+	if _, err := NewKeyring("A", SecretKeySource{Secret: []byte("short")}, 1); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey for a short secret, got %v", err)
+	}
+}
+
+// TestEncryptedWAL tests that WAL payloads are encrypted on disk and recovered after a crash
+func TestEncryptedWAL(t *testing.T) {
+	dir := t.TempDir()
+	keyring := newTestKeyring(t, "A", NewMemoryKMS())
+	wal, err := OpenEncryptedWAL(dir, SyncPolicy{Mode: SyncPerCommit}, keyring)
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	for seq := 1; seq <= 10; seq++ {
+		if err := wal.Append(uint64(seq), []byte(fmt.Sprintf("secret-%d", seq))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	wal.Crash()
+
+	raw, _ := os.ReadFile(filepath.Join(dir, walFile))
+	if bytes.Contains(raw, []byte("secret-")) {
+		t.Error("Expected no plaintext in the log file")
+	}
+	recovered, err := OpenEncryptedWAL(dir, SyncPolicy{Mode: SyncPerCommit}, keyring)
+	if err != nil || recovered.LastSeq() != 10 {
+		t.Fatalf("Expected all 10 records to survive, got %v", err)
+	}
+	recovered.Close()
+
+	records, _ := ReadRangeNaive(dir, 3, 4)
+	plain, err := keyring.DecryptRecords(records)
+	if err != nil || len(plain) != 2 || string(plain[1].Payload) != "secret-4" {
+		t.Errorf("Expected records 3-4 to decrypt, got %v, %v", plain, err)
+	}
+	records[0].Seq = 4
+	if _, err := keyring.DecryptRecords(records[:1]); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected a record moved to another sequence number to fail, got %v", err)
+	}
+}
+
+// TestKeyRotation tests that rotation keeps old data readable and rewrapping retires the old key
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	kms := NewMemoryKMS()
+	keyring := newTestKeyring(t, "A", kms)
+	wal, _ := OpenEncryptedWAL(dir, SyncPolicy{Mode: SyncOSCached}, keyring)
+	wal.Append(1, []byte("before"))
+	if version, err := keyring.Rotate(); err != nil || version != 2 {
+		t.Fatalf("Expected rotation to version 2, got %d, %v", version, err)
+	}
+	wal.Append(2, []byte("after"))
+	wal.Close()
+
+	records, _ := ReadRangeNaive(dir, 1, 2)
+	v1, _ := SealedVersion(records[0].Payload)
+	v2, _ := SealedVersion(records[1].Payload)
+	if v1 != 1 || v2 != 2 {
+		t.Errorf("Expected records sealed with versions 1 and 2, got %d and %d", v1, v2)
+	}
+	if _, err := keyring.DecryptRecords(records); err != nil {
+		t.Errorf("Expected both versions to open, got %v", err)
+	}
+
+	snapshot := filepath.Join(dir, "store.snap")
+	store := NewStore()
+	store.Apply(Entry{Index: 1, Key: "x", Value: "1"})
+	if err := SaveSnapshot(snapshot, store, nil); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+	if count, err := RewrapWAL(dir, keyring); err != nil || count != 2 {
+		t.Fatalf("Expected 2 rewrapped records, got %d, %v", count, err)
+	}
+	if err := RewrapSnapshot(snapshot, keyring); err != nil {
+		t.Fatalf("RewrapSnapshot failed: %v", err)
+	}
+
+	// A restarted node holding only the current key reads everything
+	kms.Destroy("A", 1)
+	restarted, err := NewKeyring("A", kms, 2)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	records, _ = ReadRangeNaive(dir, 1, 2)
+	if plain, err := restarted.DecryptRecords(records); err != nil || string(plain[0].Payload) != "before" {
+		t.Errorf("Expected the rewrapped log to open with version 2 alone, got %v", err)
+	}
+	if loaded, err := LoadSnapshot(snapshot, restarted); err != nil || loaded.Entries["x"].Value != "1" {
+		t.Errorf("Expected the rewrapped snapshot to open with version 2 alone, got %v", err)
+	}
+	if _, err := NewKeyring("A", kms, 1); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected the destroyed version to be unavailable, got %v", err)
+	}
+}
+
+// TestEncryptedSnapshot tests that snapshots are sealed on disk and need the key to load
+func TestEncryptedSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.snap")
+	keyring := newTestKeyring(t, "A", NewMemoryKMS())
+	store := NewStore()
+	store.Apply(Entry{Index: 1, Key: "x", Value: "plaintext-value"})
+	store.Apply(Entry{Index: 2})
+	if err := SaveSnapshot(path, store, keyring); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, []byte("plaintext-value")) {
+		t.Error("Expected no plaintext in the snapshot file")
+	}
+	loaded, err := LoadSnapshot(path, keyring)
+	if err != nil || loaded.CommitIndex != 2 || loaded.Entries["x"].Value != "plaintext-value" {
+		t.Errorf("Expected the snapshot to load, got %+v, %v", loaded, err)
+	}
+	if _, err := LoadSnapshot(path, nil); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey without a keyring, got %v", err)
+	}
+	if _, err := LoadSnapshot(path, newTestKeyring(t, "B", NewMemoryKMS())); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt with another node's key, got %v", err)
+	}
+}
@@ -0,0 +1,372 @@
+package bft
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Byzantine strategies under budgets.
+//
+// A Byzantine PBFT replica follows a strategy: it equivocates as primary and
+// backs the forgery with its votes, it only forges votes, or it floods the
+// other replicas with junk that each of them has to check before the
+// messages queued behind it. An unbounded
+// attacker can flood a replica into uselessness, but a real one owns a
+// machine: it sends so many messages and computes so many signatures in a
+// given time. A ByzantineBudget caps both, metered in virtual time per
+// BudgetRound and per second, and the messages it does not cover are never
+// sent. A replica's own protocol messages count against its budget too.
+//
+// AnalyzeBudgets runs every strategy against the same cluster at increasing
+// budgets. An attack succeeds if the request it targets is not committed
+// within AttackLatencyBound. Comparing the smallest budget an attack
+// succeeds with to RealisticBudget separates the attacks to defend against
+// from those that only work for an attacker with implausible resources.
+
+// BudgetRound is the window a budget's messages are counted in
+const BudgetRound = 100 * time.Millisecond
+
+// SimulatedVerifyCost is how long a replica spends checking a message in
+// the attack scenarios
+const SimulatedVerifyCost = 500 * time.Microsecond
+
+const (
+	// FloodCap is the most junk a flooding replica sends per round if its
+	// budget does not bound the messages
+	FloodCap = 10000
+	// AttackWarmup is how long the attacker runs before the request arrives
+	AttackWarmup = 500 * time.Millisecond
+	// AttackDuration is how long a flood lasts
+	AttackDuration = 3 * time.Second
+	// AttackLatencyBound is the commit latency an attack must exceed
+	AttackLatencyBound = DefaultViewTimeout
+)
+
+// PBFTAttack is a misbehaving PBFT replica strategy
+type PBFTAttack string
+
+const (
+	AttackEquivocate PBFTAttack = "equivocate"  // As primary, send conflicting pre-prepares; forge votes
+	AttackForgeVotes PBFTAttack = "forge-votes" // As backup, vote for forged digests
+	AttackFlood      PBFTAttack = "flood"       // Send as much signed junk as the budget allows
+)
+
+// PBFTAttacks are the attacks AnalyzeBudgets runs
+var PBFTAttacks = []PBFTAttack{AttackEquivocate, AttackForgeVotes, AttackFlood}
+
+// ByzantineBudget bounds what a Byzantine replica sends. A zero limit is
+// unbounded.
+type ByzantineBudget struct {
+	MessagesPerRound    int `json:"messages_per_round"`
+	SignaturesPerSecond int `json:"signatures_per_second"`
+}
+
+func (b ByzantineBudget) String() string {
+	limit := func(n int) string {
+		if n == 0 {
+			return "unbounded"
+		}
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%s msgs/round, %s sigs/s", limit(b.MessagesPerRound), limit(b.SignaturesPerSecond))
+}
+
+// Within reports whether the budget is no larger than limit in both dimensions
+func (b ByzantineBudget) Within(limit ByzantineBudget) bool {
+	within := func(n, max int) bool { return max == 0 || n != 0 && n <= max }
+	return within(b.MessagesPerRound, limit.MessagesPerRound) && within(b.SignaturesPerSecond, limit.SignaturesPerSecond)
+}
+
+// RealisticBudget is what one compromised replica plausibly affords. Tune it
+// to the deployment's links and hardware.
+var RealisticBudget = ByzantineBudget{MessagesPerRound: 200, SignaturesPerSecond: 2000}
+
+// BudgetLevels are the budgets AnalyzeBudgets tries, smallest first
+var BudgetLevels = []ByzantineBudget{
+	{MessagesPerRound: 10, SignaturesPerSecond: 100},
+	{MessagesPerRound: 50, SignaturesPerSecond: 500},
+	{MessagesPerRound: 200, SignaturesPerSecond: 2000},
+	{MessagesPerRound: 1000, SignaturesPerSecond: 10000},
+	{MessagesPerRound: 5000, SignaturesPerSecond: 50000},
+}
+
+// follows reports whether the replica is Byzantine and its attack includes
+// attack
+func (r *PBFTReplica) follows(attack PBFTAttack) bool {
+	if !r.Node.IsByzantine {
+		return false
+	}
+	own := r.Attack
+	if own == "" {
+		own = AttackEquivocate
+	}
+	return own == attack || own == AttackEquivocate && attack == AttackForgeVotes
+}
+
+// budgetMeter is what a Byzantine replica spent in the current windows
+type budgetMeter struct {
+	round, second        int64
+	messages, signatures int
+}
+
+// spend spends a message, and a signature if sign is set, if the budget
+// covers them
+func (m *budgetMeter) spend(budget ByzantineBudget, now time.Duration, sign bool) bool {
+	if round := int64(now / BudgetRound); round != m.round {
+		m.round, m.messages = round, 0
+	}
+	if second := int64(now / time.Second); second != m.second {
+		m.second, m.signatures = second, 0
+	}
+	if budget.MessagesPerRound > 0 && m.messages >= budget.MessagesPerRound {
+		return false
+	}
+	if sign && budget.SignaturesPerSecond > 0 && m.signatures >= budget.SignaturesPerSecond {
+		return false
+	}
+	m.messages++
+	if sign {
+		m.signatures++
+	}
+	return true
+}
+
+// affords reports whether a replica may send one more message, which needs
+// a new signature if sign is set. Honest replicas always may.
+func (p *PBFT) affords(replica *PBFTReplica, sign bool) bool {
+	if !replica.Node.IsByzantine {
+		return true
+	}
+	meter := p.meters[replica.Node.ID]
+	if meter == nil {
+		meter = &budgetMeter{}
+		p.meters[replica.Node.ID] = meter
+	}
+	if !meter.spend(p.Budget, p.Scheduler.Now, sign) {
+		p.Stats.Throttled++
+		return false
+	}
+	return true
+}
+
+// flood has a replica send the junk its budget allows this round, each
+// message signed once and sent to every other replica, and schedules the
+// next round until until. Junk is modeled by its cost alone: it occupies
+// every receiver for VerifyCost and is then rejected.
+func (p *PBFT) flood(replica *PBFTReplica, until time.Duration) {
+	s := p.System
+	for sent := 0; sent < FloodCap; {
+		signed := false
+		for _, id := range replica.Replicas {
+			if id == replica.Node.ID || sent >= FloodCap || !p.affords(replica, !signed) {
+				continue
+			}
+			signed = true
+			sent++
+			s.Lock.RLock()
+			from, to := replica.Node, s.Nodes[id]
+			latency := s.regionLatency(from.Region, to.Region)
+			reachable := s.reachable(from) && s.reachable(to)
+			s.Lock.RUnlock()
+			if !reachable {
+				p.Stats.Dropped++
+				continue
+			}
+			p.Scheduler.Deliver(latency, "junk "+from.ID+"->"+id, func() { p.arrive(from.ID, id, nil) })
+		}
+		if !signed {
+			break
+		}
+	}
+	if next := p.Scheduler.Now + BudgetRound; next < until {
+		p.Scheduler.schedule(next, "flood by "+replica.Node.ID, false, func() { p.flood(replica, until) })
+	}
+}
+
+// AttackResult is how one strategy fared with one budget
+type AttackResult struct {
+	Attack      PBFTAttack      `json:"attack"`
+	Budget      ByzantineBudget `json:"budget"`
+	Attacker    string          `json:"attacker"`
+	Succeeded   bool            `json:"succeeded"`
+	Committed   bool            `json:"committed"`
+	Latency     time.Duration   `json:"latency"` // Commit latency of the targeted request
+	ViewChanges int             `json:"view_changes"`
+	Throttled   int             `json:"throttled"`
+}
+
+// RunAttack runs strategy with budget against four replicas, f=1, that
+// check messages at SimulatedVerifyCost each. The primary A equivocates;
+// D forges votes or floods, starting AttackWarmup before a client request.
+func RunAttack(strategy PBFTAttack, budget ByzantineBudget, seed int64) (*AttackResult, error) {
+	attacker := "D"
+	switch strategy {
+	case AttackEquivocate:
+		attacker = "A"
+	case AttackForgeVotes, AttackFlood:
+	default:
+		return nil, fmt.Errorf("unknown Byzantine strategy %q", strategy)
+	}
+	system := NewSystem()
+	for _, id := range []string{"A", "B", "C", "D"} {
+		node, err := NewNode(id, id == attacker, false)
+		if err != nil {
+			return nil, err
+		}
+		system.AddNode(node)
+	}
+	system.SetLeader("A")
+	scheduler := NewScheduler(seed)
+	scheduler.Jitter = LocalLatency
+	system.UseScheduler(scheduler)
+
+	pbft, err := NewPBFT(system, 1)
+	if err != nil {
+		return nil, err
+	}
+	pbft.Budget = budget
+	pbft.VerifyCost = SimulatedVerifyCost
+	replica := pbft.Replicas[attacker]
+	replica.Attack = strategy
+	if strategy == AttackFlood {
+		pbft.flood(replica, AttackDuration)
+	}
+
+	var digest string
+	scheduler.At(AttackWarmup, func() {
+		digest, err = pbft.Submit([]byte("attacked-request"))
+	})
+	pbft.Run()
+	if err != nil {
+		return nil, err
+	}
+	outcome := pbft.Outcome(digest)
+	return &AttackResult{
+		Attack:      strategy,
+		Budget:      budget,
+		Attacker:    attacker,
+		Succeeded:   !outcome.Committed || outcome.Latency > AttackLatencyBound,
+		Committed:   outcome.Committed,
+		Latency:     outcome.Latency,
+		ViewChanges: pbft.Stats.ViewChanges,
+		Throttled:   pbft.Stats.Throttled,
+	}, nil
+}
+
+// AttackAnalysis is how a strategy fared across budgets
+type AttackAnalysis struct {
+	Attack  PBFTAttack     `json:"attack"`
+	Results []AttackResult `json:"results"` // In budget order
+	// MinBudget is the smallest budget the attack succeeded with, nil if none
+	MinBudget *ByzantineBudget `json:"min_budget,omitempty"`
+	// Unrealistic is set if the attack only succeeds beyond RealisticBudget
+	Unrealistic bool `json:"unrealistic"`
+}
+
+// Verdict summarizes the analysis in a few words
+func (a *AttackAnalysis) Verdict() string {
+	switch {
+	case a.MinBudget == nil:
+		return "fails at every budget"
+	case a.Unrealistic:
+		return "succeeds only with an unrealistic budget"
+	}
+	return "succeeds with a realistic budget"
+}
+
+// BudgetAnalysis is how every strategy fared across budgets
+type BudgetAnalysis struct {
+	Seed      int64            `json:"seed"`
+	Realistic ByzantineBudget  `json:"realistic"`
+	Attacks   []AttackAnalysis `json:"attacks"`
+}
+
+// AnalyzeBudgets runs every strategy at every budget level
+func AnalyzeBudgets(seed int64, levels []ByzantineBudget) (*BudgetAnalysis, error) {
+	analysis := &BudgetAnalysis{Seed: seed, Realistic: RealisticBudget}
+	for _, strategy := range PBFTAttacks {
+		result := AttackAnalysis{Attack: strategy}
+		for _, budget := range levels {
+			attack, err := RunAttack(strategy, budget, seed)
+			if err != nil {
+				return nil, err
+			}
+			result.Results = append(result.Results, *attack)
+			if attack.Succeeded && result.MinBudget == nil {
+				result.MinBudget = &attack.Budget
+			}
+		}
+		result.Unrealistic = result.MinBudget != nil && !result.MinBudget.Within(RealisticBudget)
+		analysis.Attacks = append(analysis.Attacks, result)
+	}
+	return analysis, nil
+}
+
+// Unrealistic returns the strategies that only succeed beyond the realistic budget
+func (a *BudgetAnalysis) Unrealistic() []PBFTAttack {
+	var strategies []PBFTAttack
+	for _, strategy := range a.Attacks {
+		if strategy.Unrealistic {
+			strategies = append(strategies, strategy.Attack)
+		}
+	}
+	return strategies
+}
+
+// String renders the analysis as a table of outcomes per budget
+func (a *BudgetAnalysis) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Realistic budget: %s\n", a.Realistic)
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprint(w, "STRATEGY\tBUDGET\tRESULT\tLATENCY\tVIEW CHANGES\tTHROTTLED\n")
+	for _, strategy := range a.Attacks {
+		for _, result := range strategy.Results {
+			outcome, latency := "held", result.Latency.Round(time.Millisecond).String()
+			if result.Succeeded {
+				outcome = "succeeded"
+			}
+			if !result.Committed {
+				latency = "never"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\n", result.Attack, result.Budget, outcome, latency, result.ViewChanges, result.Throttled)
+		}
+	}
+	w.Flush()
+	for _, strategy := range a.Attacks {
+		fmt.Fprintf(&b, "%s: %s", strategy.Attack, strategy.Verdict())
+		if strategy.MinBudget != nil {
+			fmt.Fprintf(&b, " (from %s)", strategy.MinBudget)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// AttacksCommand implements `wahello attacks [-seed n] [-json]`
+func AttacksCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("attacks", flag.ContinueOnError)
+	seed := flags.Int64("seed", 1, "seed of the attack runs")
+	asJSON := flags.Bool("json", false, "print the analysis as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	analysis, err := AnalyzeBudgets(*seed, BudgetLevels)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(analysis, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	}
+	_, err = io.WriteString(stdout, analysis.String())
+	return err
+}
@@ -0,0 +1,101 @@
+package bft
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBudgetMeter tests that messages are counted per round and signatures per second
+func TestBudgetMeter(t *testing.T) {
+	budget := ByzantineBudget{MessagesPerRound: 3, SignaturesPerSecond: 4}
+	meter := &budgetMeter{}
+	var allowed []bool
+	for _, sign := range []bool{true, false, true, true} {
+		allowed = append(allowed, meter.spend(budget, 0, sign))
+	}
+	if !reflect.DeepEqual(allowed, []bool{true, true, true, false}) {
+		t.Errorf("Expected the fourth message of the round to be refused, got %v", allowed)
+	}
+	if !meter.spend(budget, BudgetRound, true) || !meter.spend(budget, BudgetRound, true) || meter.spend(budget, BudgetRound, true) {
+		t.Errorf("Expected the next round to afford two more signatures, the fifth of the second being refused")
+	}
+	if !meter.spend(budget, time.Second, true) {
+		t.Errorf("Expected the next second to afford signatures again")
+	}
+	if unbounded := (&budgetMeter{}); !unbounded.spend(ByzantineBudget{}, 0, true) {
+		t.Errorf("Expected a zero budget to be unbounded")
+	}
+}
+
+// TestPBFTBudgetThrottles tests that a Byzantine replica's messages beyond its budget are never sent
+func TestPBFTBudgetThrottles(t *testing.T) {
+	pbft := newPBFT(t, "A")
+	pbft.Budget = ByzantineBudget{MessagesPerRound: 1}
+	pbft.Submit([]byte("op-1"))
+	pbft.Run()
+
+	if pbft.Stats.Throttled == 0 {
+		t.Errorf("Expected A's pre-prepares past the first to be throttled, got %+v", pbft.Stats)
+	}
+	if executed := pbft.Replicas["B"].Executed; len(executed) != 1 || string(executed[0].Payload) != "op-1" {
+		t.Errorf("Expected the honest replicas to execute op-1 after replacing A, got %+v", executed)
+	}
+}
+
+// TestRunAttackFlood tests that a flood delays commits only once it saturates the receivers
+func TestRunAttackFlood(t *testing.T) {
+	held, err := RunAttack(AttackFlood, RealisticBudget, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held.Succeeded || !held.Committed || held.Latency > AttackLatencyBound {
+		t.Errorf("Expected a realistic flood to only slow the request down, got %+v", held)
+	}
+	heavy, err := RunAttack(AttackFlood, ByzantineBudget{MessagesPerRound: 1000, SignaturesPerSecond: 10000}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !heavy.Succeeded || heavy.Latency <= held.Latency {
+		t.Errorf("Expected a heavy flood to push the commit past %v, got %+v", AttackLatencyBound, heavy)
+	}
+	if _, err := RunAttack("silence", RealisticBudget, 1); err == nil {
+		t.Errorf("Expected an unknown strategy to be rejected")
+	}
+}
+
+// TestAnalyzeBudgets tests that the analysis tells realistic attacks from unrealistic ones
+func TestAnalyzeBudgets(t *testing.T) {
+	analysis, err := AnalyzeBudgets(1, BudgetLevels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verdicts := make(map[PBFTAttack]string)
+	for _, strategy := range analysis.Attacks {
+		verdicts[strategy.Attack] = strategy.Verdict()
+		if len(strategy.Results) != len(BudgetLevels) {
+			t.Errorf("Expected %s to run at every budget, got %d runs", strategy.Attack, len(strategy.Results))
+		}
+	}
+	expected := map[PBFTAttack]string{
+		AttackEquivocate: "succeeds with a realistic budget",
+		AttackForgeVotes: "fails at every budget",
+		AttackFlood:      "succeeds only with an unrealistic budget",
+	}
+	if !reflect.DeepEqual(verdicts, expected) {
+		t.Errorf("Expected %v, got %v", expected, verdicts)
+	}
+	if !reflect.DeepEqual(analysis.Unrealistic(), []PBFTAttack{AttackFlood}) {
+		t.Errorf("Expected only the flood to need an unrealistic budget, got %v", analysis.Unrealistic())
+	}
+
+	var out bytes.Buffer
+	if err := AttacksCommand([]string{"-seed", "1"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "flood: succeeds only with an unrealistic budget (from 1000 msgs/round, 10000 sigs/s)") {
+		t.Errorf("Expected the flood's smallest successful budget, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,278 @@
+package bft
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Audit export to a SIEM.
+//
+// Security-relevant events, replies with bad signatures, signed evidence
+// of a replica contradicting a certified answer, membership changes and
+// key rotations, are streamed to an external collector over TCP, either as
+// JSON lines or as RFC 5424 syslog messages with octet-counting framing
+// (RFC 6587). Emitting never stalls the protocol for long: events go into
+// a bounded buffer drained by a background sender, and an emitter facing a
+// full buffer waits at most MaxBlock before the oldest event is dropped and
+// counted. While the collector is unreachable the sender keeps the buffer
+// and reconnects with exponential backoff, so short outages lose nothing.
+// Delivery is at least once: an event whose write failed is resent on the
+// next connection.
+
+// AuditKind is the category of an audit event
+type AuditKind string
+
+const (
+	AuditSignatureFailure AuditKind = "signature_failure"
+	AuditEquivocation     AuditKind = "equivocation"
+	AuditMembership       AuditKind = "membership_change"
+	AuditKeyRotation      AuditKind = "key_rotation"
+	AuditCertificate      AuditKind = "certificate" // Issued, or refused on a message
+)
+
+// auditSeverities are the syslog severities of each kind
+var auditSeverities = map[AuditKind]int{
+	AuditEquivocation:     2, // Critical
+	AuditSignatureFailure: 4, // Warning
+	AuditMembership:       5, // Notice
+	AuditKeyRotation:      5,
+	AuditCertificate:      4,
+}
+
+// syslogAuthPriv is the security/authorization facility
+const syslogAuthPriv = 10
+
+// AuditEvent is one security-relevant event
+type AuditEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   AuditKind `json:"kind"`
+	Node   string    `json:"node,omitempty"`
+	Peer   string    `json:"peer,omitempty"`
+	Detail string    `json:"detail"`
+}
+
+// AuditFormat is the wire format of exported events
+type AuditFormat string
+
+const (
+	AuditJSON   AuditFormat = "json"
+	AuditSyslog AuditFormat = "syslog"
+)
+
+// AuditStats counts what the sink did with events
+type AuditStats struct {
+	Sent       uint64
+	Dropped    uint64
+	Reconnects uint64
+}
+
+// AuditSink streams audit events to a collector
+type AuditSink struct {
+	Addr       string
+	Format     AuditFormat
+	MaxBlock   time.Duration // How long Emit waits for buffer room before dropping the oldest event
+	Backoff    time.Duration // First reconnect delay, doubled up to MaxBackoff
+	MaxBackoff time.Duration
+	Timeout    time.Duration // Dial and write deadline
+	Hostname   string
+	Now        func() time.Time
+	Dial       func(addr string, timeout time.Duration) (net.Conn, error)
+	Lock       sync.Mutex // Serializes emitters dropping the oldest event
+	start      sync.Once
+	events     chan AuditEvent
+	pending    atomic.Int64 // Buffered or in flight
+	sent       atomic.Uint64
+	dropped    atomic.Uint64
+	reconnects atomic.Uint64
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// NewAuditSink creates a sink buffering up to capacity events. Its sender
+// starts on the first Emit, so fields may be adjusted until then.
+func NewAuditSink(addr string, format AuditFormat, capacity int) (*AuditSink, error) {
+	if format != AuditJSON && format != AuditSyslog {
+		return nil, fmt.Errorf("unknown audit format %q, want %q or %q", format, AuditJSON, AuditSyslog)
+	}
+	if capacity < 1 {
+		return nil, fmt.Errorf("audit buffer capacity must be positive")
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	s := &AuditSink{
+		Addr:       addr,
+		Format:     format,
+		MaxBlock:   10 * time.Millisecond,
+		Backoff:    100 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+		Timeout:    time.Second,
+		Hostname:   hostname,
+		Now:        time.Now,
+		Dial: func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, timeout)
+		},
+		events: make(chan AuditEvent, capacity),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	return s, nil
+}
+
+// Emit queues an event for export, stamping its time if unset
+func (s *AuditSink) Emit(event AuditEvent) {
+	s.start.Do(func() { go s.run() })
+	if event.Time.IsZero() {
+		event.Time = s.Now()
+	}
+	s.pending.Add(1)
+	select {
+	case s.events <- event:
+		return
+	default:
+	}
+	if s.MaxBlock > 0 {
+		timer := time.NewTimer(s.MaxBlock)
+		defer timer.Stop()
+		select {
+		case s.events <- event:
+			return
+		case <-timer.C:
+		}
+	}
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	for {
+		select {
+		case s.events <- event:
+			return
+		default:
+		}
+		select {
+		case <-s.events:
+			s.dropped.Add(1)
+			s.pending.Add(-1)
+		default:
+		}
+	}
+}
+
+// Stats returns the sink's counters
+func (s *AuditSink) Stats() AuditStats {
+	return AuditStats{Sent: s.sent.Load(), Dropped: s.dropped.Load(), Reconnects: s.reconnects.Load()}
+}
+
+// Flush waits until every emitted event has been sent or dropped
+func (s *AuditSink) Flush(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for s.pending.Load() > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("audit sink %s: %d events not delivered", s.Addr, s.pending.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// Close flushes for up to timeout and stops the sender. Events still
+// buffered are counted as dropped.
+func (s *AuditSink) Close(timeout time.Duration) error {
+	s.start.Do(func() { go s.run() })
+	err := s.Flush(timeout)
+	close(s.stop)
+	<-s.done
+	for {
+		select {
+		case <-s.events:
+			s.dropped.Add(1)
+			s.pending.Add(-1)
+		default:
+			return err
+		}
+	}
+}
+
+// run sends events in order, holding on to an event until it is written
+func (s *AuditSink) run() {
+	defer close(s.done)
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	backoff := s.Backoff
+	connected := false
+	for {
+		var event AuditEvent
+		select {
+		case event = <-s.events:
+		case <-s.stop:
+			return
+		}
+		frame := s.encode(event)
+		for {
+			if conn == nil {
+				c, err := s.Dial(s.Addr, s.Timeout)
+				if err != nil {
+					select {
+					case <-time.After(backoff):
+					case <-s.stop:
+						s.dropped.Add(1)
+						s.pending.Add(-1)
+						return
+					}
+					if backoff *= 2; backoff > s.MaxBackoff {
+						backoff = s.MaxBackoff
+					}
+					continue
+				}
+				if connected {
+					s.reconnects.Add(1)
+				}
+				conn, connected, backoff = c, true, s.Backoff
+			}
+			conn.SetWriteDeadline(time.Now().Add(s.Timeout))
+			if _, err := conn.Write(frame); err != nil {
+				conn.Close()
+				conn = nil
+				continue
+			}
+			s.sent.Add(1)
+			s.pending.Add(-1)
+			break
+		}
+	}
+}
+
+// encode frames an event in the sink's format
+func (s *AuditSink) encode(event AuditEvent) []byte {
+	data, _ := json.Marshal(event)
+	if s.Format == AuditJSON {
+		return append(data, '\n')
+	}
+	priority := syslogAuthPriv*8 + auditSeverities[event.Kind]
+	msg := fmt.Sprintf("<%d>1 %s %s wahello - %s - %s",
+		priority, event.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), s.Hostname, event.Kind, data)
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
+
+// audit exports a security event if the system has an audit sink attached
+func (s *System) audit(kind AuditKind, node, peer, detail string) {
+	if kind == AuditSignatureFailure {
+		s.Metrics.add(metricVerification, "signature", 1)
+	}
+	if s.Logger != nil {
+		// Some callers hold s.Lock, so this goes without the node's tags
+		s.Logger.Warn("security event", "kind", kind, "node", node, "peer", peer, "detail", detail)
+	}
+	if s.Audit != nil {
+		s.Audit.Emit(AuditEvent{Kind: kind, Node: node, Peer: peer, Detail: detail})
+	}
+}
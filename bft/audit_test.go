@@ -0,0 +1,235 @@
+package bft
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// auditCollector accepts connections on addr and sends each received line
+// or syslog frame to the returned channel
+func auditCollector(t *testing.T, addr string, format AuditFormat) (net.Listener, chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	frames := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					if format == AuditJSON {
+						line, err := reader.ReadString('\n')
+						if err != nil {
+							return
+						}
+						frames <- strings.TrimSuffix(line, "\n")
+						continue
+					}
+					length, err := reader.ReadString(' ')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(length))
+					msg := make([]byte, n)
+					if _, err := io.ReadFull(reader, msg); err != nil {
+						return
+					}
+					frames <- string(msg)
+				}
+			}()
+		}
+	}()
+	return listener, frames
+}
+
+// receive waits for the next frame
+func receive(t *testing.T, frames chan string) string {
+	t.Helper()
+	select {
+	case frame := <-frames:
+		return frame
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an audit event")
+		return ""
+	}
+}
+
+// TestAuditJSON tests that events arrive as JSON lines
+func TestAuditJSON(t *testing.T) {
+	listener, frames := auditCollector(t, "127.0.0.1:0", AuditJSON)
+	defer listener.Close()
+	sink, err := NewAuditSink(listener.Addr().String(), AuditJSON, 16)
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	defer sink.Close(time.Second)
+
+	sink.Emit(AuditEvent{Kind: AuditKeyRotation, Node: "A", Detail: "rotated"})
+	var event AuditEvent
+	if err := json.Unmarshal([]byte(receive(t, frames)), &event); err != nil {
+		t.Fatalf("Expected a JSON event, got %v", err)
+	}
+	if event.Kind != AuditKeyRotation || event.Node != "A" || event.Time.IsZero() {
+		t.Errorf("Expected a timestamped key rotation by A, got %+v", event)
+	}
+}
+
+// TestAuditSyslog tests that events are framed as RFC 5424 messages
+func TestAuditSyslog(t *testing.T) {
+	listener, frames := auditCollector(t, "127.0.0.1:0", AuditSyslog)
+	defer listener.Close()
+	sink, _ := NewAuditSink(listener.Addr().String(), AuditSyslog, 16)
+	sink.Hostname = "sim"
+	defer sink.Close(time.Second)
+
+	sink.Emit(AuditEvent{Kind: AuditEquivocation, Node: "F", Detail: "forged reply"})
+	frame := receive(t, frames)
+	// authpriv (10) * 8 + critical (2)
+	if !strings.HasPrefix(frame, "<82>1 ") || !strings.Contains(frame, " sim wahello - equivocation - {") {
+		t.Errorf("Expected a syslog message for the equivocation, got %q", frame)
+	}
+}
+
+// TestAuditOutage tests that events emitted while the collector is down are
+// delivered once it comes up
+func TestAuditOutage(t *testing.T) {
+	probe, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := probe.Addr().String()
+	probe.Close()
+
+	sink, _ := NewAuditSink(addr, AuditJSON, 16)
+	sink.Backoff, sink.MaxBackoff = time.Millisecond, 10*time.Millisecond
+	defer sink.Close(time.Second)
+	for _, node := range []string{"A", "B", "C"} {
+		sink.Emit(AuditEvent{Kind: AuditMembership, Node: node, Detail: "suspected"})
+	}
+	if err := sink.Flush(20 * time.Millisecond); err == nil {
+		t.Fatal("Expected events to stay buffered while the collector is down")
+	}
+
+	listener, frames := auditCollector(t, addr, AuditJSON)
+	defer listener.Close()
+	for _, expected := range []string{`"node":"A"`, `"node":"B"`, `"node":"C"`} {
+		if frame := receive(t, frames); !strings.Contains(frame, expected) {
+			t.Errorf("Expected events in order, got %q for %s", frame, expected)
+		}
+	}
+	if err := sink.Flush(time.Second); err != nil {
+		t.Errorf("Expected the buffer to drain, got %v", err)
+	}
+	if stats := sink.Stats(); stats.Sent != 3 || stats.Dropped != 0 {
+		t.Errorf("Expected 3 sent and none dropped, got %+v", stats)
+	}
+}
+
+// TestAuditBackpressure tests that a full buffer drops its oldest events
+// instead of blocking the emitter
+func TestAuditBackpressure(t *testing.T) {
+	sink, _ := NewAuditSink("127.0.0.1:0", AuditJSON, 4)
+	sink.MaxBlock = time.Millisecond
+	dialed := make(chan bool, 1)
+	sink.Dial = func(string, time.Duration) (net.Conn, error) {
+		select {
+		case dialed <- true:
+		default:
+		}
+		return nil, net.ErrClosed
+	}
+	sink.Emit(AuditEvent{Kind: AuditSignatureFailure, Detail: "0"})
+	<-dialed
+	started := time.Now()
+	for i := 1; i < 20; i++ {
+		sink.Emit(AuditEvent{Kind: AuditSignatureFailure, Detail: strconv.Itoa(i)})
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Expected Emit not to block, took %v", elapsed)
+	}
+	// The sender holds one event, the buffer the newest four
+	if dropped := sink.Stats().Dropped; dropped != 15 {
+		t.Errorf("Expected 15 dropped events, got %d", dropped)
+	}
+	sink.Close(0)
+	if stats := sink.Stats(); stats.Dropped != 20 || stats.Sent != 0 {
+		t.Errorf("Expected every undelivered event counted as dropped on close, got %+v", stats)
+	}
+}
+
+// TestAuditSources tests that byzantine replies, membership changes and key
+// rotations are exported
+func TestAuditSources(t *testing.T) {
+	listener, frames := auditCollector(t, "127.0.0.1:0", AuditJSON)
+	defer listener.Close()
+	sink, _ := NewAuditSink(listener.Addr().String(), AuditJSON, 64)
+	defer sink.Close(time.Second)
+
+	system := newTestSystem(t, nodeIDs(4), func(node *Node) { node.IsByzantine = node.ID == "D" })
+	system.SetLeader("A")
+	system.Audit = sink
+	client := &BFTClient{System: system, F: 1}
+	replies, _ := client.collect("r1", "x")
+	replies[1].Signature = replies[0].Signature
+	result, err := client.Accept("r1", "x", replies)
+	if err != nil || len(result.Evidence) != 1 || result.Evidence[0] != "D" {
+		t.Fatalf("Expected evidence against D, got %+v, %v", result, err)
+	}
+
+	keyring := newTestKeyring(t, "A", NewMemoryKMS())
+	keyring.Audit = sink
+	keyring.Rotate()
+
+	kinds := make(map[AuditKind]string)
+	for i := 0; i < 3; i++ {
+		var event AuditEvent
+		json.Unmarshal([]byte(receive(t, frames)), &event)
+		kinds[event.Kind] = event.Node
+	}
+	expected := map[AuditKind]string{AuditSignatureFailure: "B", AuditEquivocation: "D", AuditKeyRotation: "A"}
+	for kind, node := range expected {
+		if kinds[kind] != node {
+			t.Errorf("Expected a %s event for %s, got %v", kind, node, kinds)
+		}
+	}
+}
+
+// TestAuditMembership tests that SWIM exports suspicions and confirmed deaths
+func TestAuditMembership(t *testing.T) {
+	listener, frames := auditCollector(t, "127.0.0.1:0", AuditJSON)
+	defer listener.Close()
+	sink, _ := NewAuditSink(listener.Addr().String(), AuditJSON, 256)
+	defer sink.Close(time.Second)
+
+	system := newTestSystem(t, nodeIDs(3))
+	swim := NewSWIM(system, DefaultMembershipConfig(), 1)
+	for i := 0; i < 10; i++ {
+		swim.Tick()
+	}
+	system.Audit = sink
+	system.SetPartition("C", true)
+	for i := 0; i < 20; i++ {
+		swim.Tick()
+	}
+
+	var suspected, dead bool
+	for len(frames) > 0 || !(suspected && dead) {
+		var event AuditEvent
+		json.Unmarshal([]byte(receive(t, frames)), &event)
+		if event.Kind != AuditMembership || event.Peer != "C" {
+			t.Errorf("Expected only membership changes about C, got %+v", event)
+		}
+		suspected = suspected || strings.HasPrefix(event.Detail, "suspected")
+		dead = dead || strings.HasPrefix(event.Detail, "confirmed dead")
+	}
+}
@@ -0,0 +1,312 @@
+package bft
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Node certificates.
+//
+// A CertificateAuthority vouches for the key each node signs with. It
+// issues a NodeCertificate binding the node's ID to its public key for a
+// validity window, signed with the authority's own key. With an authority
+// attached to the system, a receiver checks the sender's certificate
+// against the authority's key and its own physical clock before it takes a
+// clock update or a PBFT message from the sender, and refuses the message
+// if the certificate is missing, forged, issued for another key or outside
+// its window. Refusals are counted per sender and audited. A node whose
+// certificate lapsed is cut off although it runs and its links are up, a
+// classic production outage, until it renews through the authority, see
+// RenewCertificate. The cert-expiry fault lets certificates lapse mid-run
+// and renews them when reverted.
+
+var (
+	ErrNoAuthority            = errors.New("system has no certificate authority")
+	ErrNoCertificate          = errors.New("no node certificate")
+	ErrInvalidNodeCertificate = errors.New("invalid node certificate")
+	ErrCertificateExpired     = errors.New("node certificate expired")
+)
+
+// DefaultCertificateValidity is how long certificates are issued for
+const DefaultCertificateValidity = 24 * time.Hour
+
+// NodeCertificate binds a node's ID to its public key for a time window
+type NodeCertificate struct {
+	Node      string
+	PublicKey string // The node's key, encoded
+	Serial    uint64
+	NotBefore time.Time
+	NotAfter  time.Time // First instant the certificate is no longer valid
+	Signature string    // The authority's
+}
+
+// digest returns what the authority signs
+func (c *NodeCertificate) digest() []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("cert:%s:%s:%d:%d:%d", c.Node, c.PublicKey, c.Serial, c.NotBefore.UnixNano(), c.NotAfter.UnixNano())))
+	return sum[:]
+}
+
+// CertificateAuthority issues and checks node certificates
+type CertificateAuthority struct {
+	Validity   time.Duration // DefaultCertificateValidity if zero
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+	Lock       sync.Mutex
+	serial     uint64
+	refused    map[string]int // Messages refused by sender
+}
+
+// NewCertificateAuthority creates an authority with a fresh key issuing
+// certificates valid for validity
+func NewCertificateAuthority(validity time.Duration) (*CertificateAuthority, error) {
+	privateKey, publicKey, err := crypto.GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	return &CertificateAuthority{Validity: validity, PrivateKey: privateKey, PublicKey: publicKey, refused: make(map[string]int)}, nil
+}
+
+// clone returns an authority with the same key and refusal counts
+func (ca *CertificateAuthority) clone() *CertificateAuthority {
+	if ca == nil {
+		return nil
+	}
+	ca.Lock.Lock()
+	defer ca.Lock.Unlock()
+	clone := &CertificateAuthority{Validity: ca.Validity, PrivateKey: ca.PrivateKey, PublicKey: ca.PublicKey,
+		serial: ca.serial, refused: make(map[string]int, len(ca.refused))}
+	for id, count := range ca.refused {
+		clone.refused[id] = count
+	}
+	return clone
+}
+
+// Issue signs a certificate for a node's current key valid from now
+func (ca *CertificateAuthority) Issue(node *Node, now time.Time) (*NodeCertificate, error) {
+	validity := ca.Validity
+	if validity <= 0 {
+		validity = DefaultCertificateValidity
+	}
+	return ca.issue(node, now, now.Add(validity))
+}
+
+// issue signs a certificate for a node's current key valid in [notBefore,
+// notAfter)
+func (ca *CertificateAuthority) issue(node *Node, notBefore, notAfter time.Time) (*NodeCertificate, error) {
+	node.Lock.RLock()
+	cert := &NodeCertificate{Node: node.ID, PublicKey: crypto.EncodePublicKey(node.PublicKey), NotBefore: notBefore, NotAfter: notAfter}
+	node.Lock.RUnlock()
+	ca.Lock.Lock()
+	ca.serial++
+	cert.Serial = ca.serial
+	ca.Lock.Unlock()
+	signature, err := crypto.Sign(ca.PrivateKey, cert.digest())
+	if err != nil {
+		return nil, err
+	}
+	cert.Signature = signature
+	return cert, nil
+}
+
+// Verify checks that a certificate was issued by the authority for the
+// node's current key and is valid at now
+func (ca *CertificateAuthority) Verify(node *Node, cert *NodeCertificate, now time.Time) error {
+	if cert == nil {
+		return fmt.Errorf("%w: %s", ErrNoCertificate, node.ID)
+	}
+	if crypto.Verify(ca.PublicKey, cert.digest(), cert.Signature) != nil {
+		return fmt.Errorf("%w: %s's certificate %d is not signed by the authority", ErrInvalidNodeCertificate, node.ID, cert.Serial)
+	}
+	if cert.Node != node.ID || cert.PublicKey != crypto.EncodePublicKey(node.PublicKey) {
+		return fmt.Errorf("%w: certificate %d was issued for another node or key than %s's", ErrInvalidNodeCertificate, cert.Serial, node.ID)
+	}
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("%w: %s's certificate %d is not valid before %s", ErrInvalidNodeCertificate, node.ID, cert.Serial, cert.NotBefore.Format(time.RFC3339))
+	}
+	if !now.Before(cert.NotAfter) {
+		return fmt.Errorf("%w: %s's certificate %d expired at %s", ErrCertificateExpired, node.ID, cert.Serial, cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Refused returns how many messages from a node were refused for its
+// certificate
+func (ca *CertificateAuthority) Refused(id string) int {
+	ca.Lock.Lock()
+	defer ca.Lock.Unlock()
+	return ca.refused[id]
+}
+
+// UseCertificateAuthority has the system's nodes check each other's
+// certificates and issues every node one
+func (s *System) UseCertificateAuthority(ca *CertificateAuthority) error {
+	s.Lock.Lock()
+	s.CA = ca
+	ids := sortedKeys(s.Nodes)
+	s.Lock.Unlock()
+	for _, id := range ids {
+		if err := s.RenewCertificate(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenewCertificate has a node obtain a fresh certificate from the system's
+// authority
+func (s *System) RenewCertificate(id string) error {
+	nodes, err := s.lookupNodes([]string{id})
+	if err != nil {
+		return err
+	}
+	if s.CA == nil {
+		return ErrNoAuthority
+	}
+	cert, err := s.CA.Issue(nodes[0], s.now())
+	if err != nil {
+		return err
+	}
+	s.setCertificate(nodes[0], cert)
+	s.audit(AuditCertificate, id, "", fmt.Sprintf("certificate %d issued until %s", cert.Serial, cert.NotAfter.Format(time.RFC3339)))
+	return nil
+}
+
+// ExpireCertificate replaces a node's certificate with one that lapses now,
+// as if the node had missed its renewal
+func (s *System) ExpireCertificate(id string) error {
+	nodes, err := s.lookupNodes([]string{id})
+	if err != nil {
+		return err
+	}
+	if s.CA == nil {
+		return ErrNoAuthority
+	}
+	now := s.now()
+	cert, err := s.CA.issue(nodes[0], now.Add(-DefaultCertificateValidity), now)
+	if err != nil {
+		return err
+	}
+	s.setCertificate(nodes[0], cert)
+	return nil
+}
+
+func (s *System) setCertificate(node *Node, cert *NodeCertificate) {
+	node.Lock.Lock()
+	defer node.Lock.Unlock()
+	node.Certificate = cert
+}
+
+// certified checks the certificate of the sender of a message by the
+// receiver's clock, refusing the message if it fails. Without an authority
+// every sender is trusted.
+func (s *System) certified(receiver *Node, from string) error {
+	ca := s.CA
+	if ca == nil {
+		return nil
+	}
+	s.Lock.RLock()
+	sender := s.Nodes[from]
+	s.Lock.RUnlock()
+	if sender == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownNode, from)
+	}
+	receiver.Lock.RLock()
+	now := receiver.physicalNow(s)
+	receiver.Lock.RUnlock()
+	sender.Lock.RLock()
+	cert := sender.Certificate
+	sender.Lock.RUnlock()
+	err := ca.Verify(sender, cert, now)
+	if err == nil {
+		return nil
+	}
+	ca.Lock.Lock()
+	if ca.refused == nil {
+		ca.refused = make(map[string]int)
+	}
+	ca.refused[from]++
+	ca.Lock.Unlock()
+	s.audit(AuditCertificate, receiver.ID, from, err.Error())
+	s.trace(TraceEvent{Type: EventReject, Node: receiver.ID, Peer: from, Detail: err.Error()})
+	return err
+}
+
+// certExpiryFault lets nodes' certificates lapse; reverting renews them
+type certExpiryFault []string
+
+func (f certExpiryFault) Apply(system *System, round int) error {
+	for _, id := range f {
+		if err := system.ExpireCertificate(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f certExpiryFault) Revert(system *System, round int) error {
+	for _, id := range f {
+		if err := system.RenewCertificate(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CertificateOutage is what a lapsed certificate cost a run
+type CertificateOutage struct {
+	Node    string
+	Rounds  int
+	Expired int // Round the certificate lapsed in
+	Renewed int // Round it was renewed in
+	Refused int // Messages from the node refused
+	Cut     int // Rounds in which peers refused the node's messages
+}
+
+// Availability returns the share of rounds the node was heard in
+func (o *CertificateOutage) Availability() float64 {
+	if o.Rounds == 0 {
+		return 1
+	}
+	return 1 - float64(o.Cut)/float64(o.Rounds)
+}
+
+func (o *CertificateOutage) String() string {
+	return fmt.Sprintf("Certificate of %s expired in round %d and was renewed in round %d: %d messages refused over %d of %d rounds, %.0f%% available",
+		o.Node, o.Expired, o.Renewed, o.Refused, o.Cut, o.Rounds, 100*o.Availability())
+}
+
+// RunCertificateExpiry runs rounds of gossip on a system with an authority,
+// letting a node's certificate lapse in round expired and renewing it in
+// round renewed, and reports the outage
+func RunCertificateExpiry(system *System, id string, expired, renewed, rounds int) (*CertificateOutage, error) {
+	if system.CA == nil {
+		return nil, ErrNoAuthority
+	}
+	step := FaultStep{At: expired, Kind: FaultCertExpiry, Nodes: []string{id}, Duration: renewed - expired}
+	outage := &CertificateOutage{Node: id, Rounds: rounds, Expired: expired, Renewed: renewed}
+	sim := NewSimulation(system)
+	for round := 0; round < rounds; round++ {
+		var err error
+		switch round {
+		case step.At:
+			err = system.ApplyFault(step)
+		case step.At + step.Duration:
+			err = system.RevertFault(step, round)
+		}
+		if err != nil {
+			return nil, err
+		}
+		before := system.CA.Refused(id)
+		sim.Advance(1)
+		if refused := system.CA.Refused(id) - before; refused > 0 {
+			outage.Refused += refused
+			outage.Cut++
+		}
+	}
+	return outage, nil
+}
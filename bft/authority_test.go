@@ -0,0 +1,114 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newCertifiedSystem creates a four-node cluster whose nodes hold certificates
+func newCertifiedSystem(t *testing.T) (*System, *CertificateAuthority) {
+	system := newGossipSystem(t, nil)
+	ca, err := NewCertificateAuthority(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := system.UseCertificateAuthority(ca); err != nil {
+		t.Fatal(err)
+	}
+	return system, ca
+}
+
+// TestCertificateVerify tests that only the authority's unexpired certificates for a node's current key pass
+func TestCertificateVerify(t *testing.T) {
+	system, ca := newCertifiedSystem(t)
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	now := system.now()
+	if err := ca.Verify(a, a.Certificate, now); err != nil {
+		t.Fatalf("Expected A's certificate to be valid, got %v", err)
+	}
+	other, err := NewCertificateAuthority(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, _ := other.Issue(a, now)
+	tests := []struct {
+		name     string
+		node     *Node
+		cert     *NodeCertificate
+		at       time.Time
+		expected error
+	}{
+		{"missing", a, nil, now, ErrNoCertificate},
+		{"forged", a, forged, now, ErrInvalidNodeCertificate},
+		{"another node's", b, a.Certificate, now, ErrInvalidNodeCertificate},
+		{"not yet valid", a, a.Certificate, now.Add(-time.Second), ErrInvalidNodeCertificate},
+		{"expired", a, a.Certificate, now.Add(time.Hour), ErrCertificateExpired},
+	}
+	for _, test := range tests {
+		if err := ca.Verify(test.node, test.cert, test.at); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+// TestExpiredCertificateRefused tests that peers refuse a node with a lapsed certificate until it renews
+func TestExpiredCertificateRefused(t *testing.T) {
+	system, ca := newCertifiedSystem(t)
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	if err := system.ExpireCertificate("A"); err != nil {
+		t.Fatal(err)
+	}
+	system.receiveClockUpdate("A", b, a.GetClockUpdate())
+	if b.VectorClock.GetTimestamp("A") != 0 || ca.Refused("A") != 1 {
+		t.Errorf("Expected B to refuse A's update, %d refused", ca.Refused("A"))
+	}
+	if err := system.RenewCertificate("A"); err != nil {
+		t.Fatal(err)
+	}
+	system.receiveClockUpdate("A", b, a.GetClockUpdate())
+	if b.VectorClock.GetTimestamp("A") == 0 {
+		t.Error("Expected B to accept A's update after renewal")
+	}
+	if err := NewSystem().RenewCertificate("A"); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("Expected ErrUnknownNode, got %v", err)
+	}
+	system.CA = nil
+	if err := system.RenewCertificate("A"); !errors.Is(err, ErrNoAuthority) {
+		t.Errorf("Expected ErrNoAuthority, got %v", err)
+	}
+}
+
+// TestCertificateExpiryOutage tests that the outage covers exactly the rounds the certificate was lapsed
+func TestCertificateExpiryOutage(t *testing.T) {
+	system, _ := newCertifiedSystem(t)
+	outage, err := RunCertificateExpiry(system, "A", 2, 5, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outage.Cut != 3 || outage.Refused != 9 || outage.Availability() != 5.0/8 {
+		t.Errorf("Expected three peers refusing A for three rounds, got %s", outage)
+	}
+	if _, err := RunCertificateExpiry(newGossipSystem(t, nil), "A", 2, 5, 8); !errors.Is(err, ErrNoAuthority) {
+		t.Errorf("Expected ErrNoAuthority, got %v", err)
+	}
+}
+
+// TestCertificateExpiryStallsPBFT tests that replicas refuse consensus messages from a primary with a lapsed certificate
+func TestCertificateExpiryStallsPBFT(t *testing.T) {
+	system, ca := newCertifiedSystem(t)
+	if err := system.ApplyFault(FaultStep{Kind: FaultCertExpiry, Nodes: []string{"A"}}); err != nil {
+		t.Fatal(err)
+	}
+	pbft, err := NewPBFT(system, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pbft.Submit([]byte("x=1")); err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+	if pbft.Stats.Rejected == 0 || ca.Refused("A") == 0 {
+		t.Errorf("Expected A's messages to be refused, got %+v", pbft.Stats)
+	}
+}
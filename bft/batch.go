@@ -0,0 +1,192 @@
+package bft
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Batched operations.
+//
+// A client may submit several operations in one request. The leader
+// evaluates them in order against its current state, and the batch's writes
+// are committed as a single consensus entry: one index, one signature, one
+// quorum round trip. Reads in a batch observe the writes before them. A
+// check operation asserts that a key is still at a given version; if any
+// check fails the whole batch aborts and nothing is written, which is enough
+// for compare-and-set style transactions.
+
+// OpCheck asserts a key's version inside a batch
+const OpCheck OpKind = "check"
+
+var (
+	ErrEmptyBatch   = errors.New("empty batch")
+	ErrBatchAborted = errors.New("batch aborted")
+)
+
+// BatchOp is one operation in a batch. For a check, Version is the version
+// the key must be at, 0 for a key never written.
+type BatchOp struct {
+	Kind    OpKind
+	Key     string
+	Value   string
+	Version int64
+}
+
+// OpResult is the outcome of one operation in a batch. A read returns the
+// value it observed; a write returns the version it created.
+type OpResult struct {
+	Kind    OpKind
+	Key     string
+	Value   string
+	Version int64
+}
+
+// BatchResult describes a committed batch
+type BatchResult struct {
+	Index     int64 // Index of the consensus entry, shared by all writes
+	Leader    string
+	Forwarded bool
+	Results   []OpResult
+	Total     time.Duration
+	Timing    *OpTiming
+}
+
+// batchSeq numbers batches for the history's transaction IDs
+var batchSeq atomic.Int64
+
+// SubmitBatch submits ops from a client in clientRegion to nodeID, forwarding
+// to the leader like SubmitWrite. The ops commit atomically or not at all.
+func (s *System) SubmitBatch(clientRegion, nodeID string, ops []BatchOp) (result *BatchResult, err error) {
+	if len(ops) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	txn := fmt.Sprintf("batch-%d", batchSeq.Add(1))
+	recorded := make([]int, len(ops))
+	for i, op := range ops {
+		kind := op.Kind
+		if kind == OpCheck {
+			kind = OpRead
+		}
+		recorded[i] = s.recordInvokeTxn(clientRegion, txn, kind, op.Key, op.Value)
+	}
+	defer func() {
+		for i, id := range recorded {
+			if err != nil {
+				s.recordComplete(id, "", 0, false)
+			} else {
+				s.recordComplete(id, result.Results[i].Value, result.Results[i].Version, true)
+			}
+		}
+	}()
+
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	contact, leader, err := s.route(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The batch is evaluated against the index it commits at, so no other
+	// commit may come in between
+	s.commitLock.Lock()
+	defer s.commitLock.Unlock()
+	leader.Lock.RLock()
+	committed := leader.Store.CommitIndex
+	results, entries, err := evaluateBatch(leader, committed+1, ops)
+	leader.Lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i], err = s.Payloads.seal(entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	index := committed + 1
+	timing := NewOpTiming(fmt.Sprintf("b%d", index), "client@"+clientRegion)
+	if len(entries) > 0 {
+		if err := s.commit(timing, clientRegion, contact, leader, batchDigest(index, entries), entries); err != nil {
+			return nil, err
+		}
+	} else {
+		// A read-only batch is answered by the leader without a consensus entry
+		index = committed
+		forwarded := contact.ID != leader.ID
+		timing.Stamp(contact.ID, "received", s.regionLatency(clientRegion, contact.Region))
+		if forwarded {
+			timing.Stamp(leader.ID, "forwarded", s.regionLatency(contact.Region, leader.Region))
+			timing.Stamp(contact.ID, "replied", s.regionLatency(contact.Region, leader.Region))
+		}
+		timing.Stamp(timing.Client, "replied", s.regionLatency(clientRegion, contact.Region))
+	}
+	return &BatchResult{
+		Index:     index,
+		Leader:    leader.ID,
+		Forwarded: contact.ID != leader.ID,
+		Results:   results,
+		Total:     timing.Total(),
+		Timing:    timing,
+	}, nil
+}
+
+// evaluateBatch runs ops in order over a view of the leader's store and
+// returns the per-op results and the entries to commit at index. Sealed
+// values are read with the leader's payload keys. The caller must hold
+// leader.Lock.
+func evaluateBatch(leader *Node, index int64, ops []BatchOp) ([]OpResult, []Entry, error) {
+	pending := make(map[string]Entry)
+	lookup := func(key string) (Entry, string, error) {
+		if entry, ok := pending[key]; ok {
+			return entry, entry.Value, nil
+		}
+		entry := leader.Store.Entries[key]
+		value, err := leader.plaintext(entry)
+		return entry, value, err
+	}
+
+	results := make([]OpResult, len(ops))
+	var entries []Entry
+	for i, op := range ops {
+		switch op.Kind {
+		case OpRead:
+			entry, value, err := lookup(op.Key)
+			if err != nil {
+				return nil, nil, err
+			}
+			results[i] = OpResult{Kind: op.Kind, Key: op.Key, Value: value, Version: entry.Index}
+		case OpCheck:
+			entry, value, err := lookup(op.Key)
+			if err != nil {
+				return nil, nil, err
+			}
+			if entry.Index != op.Version {
+				return nil, nil, fmt.Errorf("%w: op %d expects %s at version %d, found %d",
+					ErrBatchAborted, i, op.Key, op.Version, entry.Index)
+			}
+			results[i] = OpResult{Kind: op.Kind, Key: op.Key, Value: value, Version: entry.Index}
+		case OpWrite:
+			entry := Entry{Index: index, Key: op.Key, Value: op.Value}
+			pending[op.Key] = entry
+			entries = append(entries, entry)
+			results[i] = OpResult{Kind: op.Kind, Key: op.Key, Value: op.Value, Version: index}
+		default:
+			return nil, nil, fmt.Errorf("%w: op %d has unknown kind %q", ErrBatchAborted, i, op.Kind)
+		}
+	}
+	return results, entries, nil
+}
+
+// batchDigest returns the digest signed for a batch's consensus entry
+func batchDigest(index int64, entries []Entry) []byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "batch:%d:", index)
+	for _, entry := range entries {
+		h.Write(entryDigest(entry))
+	}
+	return h.Sum(nil)
+}
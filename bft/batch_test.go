@@ -0,0 +1,117 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestSubmitBatchCommitsAtomically tests that a batch commits as one entry
+func TestSubmitBatchCommitsAtomically(t *testing.T) {
+	system := newGeoSystem(t)
+	system.History = NewHistory()
+
+	result, err := system.SubmitBatch("ap-south", "G", []BatchOp{
+		{Kind: OpWrite, Key: "x", Value: "1"},
+		{Kind: OpWrite, Key: "y", Value: "2"},
+		{Kind: OpRead, Key: "x"},
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if result.Index != 1 || !result.Forwarded || len(result.Results) != 3 {
+		t.Fatalf("Expected one forwarded entry at index 1 with three results, got %+v", result)
+	}
+	if read := result.Results[2]; read.Value != "1" || read.Version != 1 {
+		t.Errorf("Expected the read to observe the batch's own write, got %+v", read)
+	}
+	for _, id := range []string{"A", "B", "D", "G"} {
+		store := system.Nodes[id].Store
+		if store.CommitIndex != 1 || store.Entries["x"].Value != "1" || store.Entries["y"].Value != "2" {
+			t.Errorf("Expected %s to hold both writes at index 1, got %+v", id, store)
+		}
+	}
+
+	ops := system.History.Snapshot()
+	if len(ops) != 3 || ops[0].Txn == "" || ops[0].Txn != ops[2].Txn {
+		t.Errorf("Expected the batch to be recorded as one transaction, got %+v", ops)
+	}
+}
+
+// TestSubmitBatchCheckAborts tests compare-and-set style aborts
+func TestSubmitBatchCheckAborts(t *testing.T) {
+	system := newGeoSystem(t)
+	if _, err := system.SubmitWrite("us-east", "A", "balance", "10"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := system.SubmitBatch("us-east", "A", []BatchOp{
+		{Kind: OpWrite, Key: "audit", Value: "debit"},
+		{Kind: OpCheck, Key: "balance", Version: 0},
+		{Kind: OpWrite, Key: "balance", Value: "5"},
+	})
+	if !errors.Is(err, ErrBatchAborted) {
+		t.Fatalf("Expected ErrBatchAborted, got %v", err)
+	}
+	store := system.Nodes["A"].Store
+	if _, written := store.Entries["audit"]; written || store.Entries["balance"].Value != "10" || store.CommitIndex != 1 {
+		t.Errorf("Expected an aborted batch to write nothing, got %+v", store)
+	}
+
+	result, err := system.SubmitBatch("us-east", "A", []BatchOp{
+		{Kind: OpCheck, Key: "balance", Version: 1},
+		{Kind: OpWrite, Key: "balance", Value: "5"},
+	})
+	if err != nil || result.Index != 2 || store.Entries["balance"].Value != "5" {
+		t.Errorf("Expected the check to pass and the write to commit at 2, got %+v, %v", result, err)
+	}
+}
+
+// TestSubmitBatchReadOnly tests that read-only batches need no consensus entry
+func TestSubmitBatchReadOnly(t *testing.T) {
+	system := newGeoSystem(t)
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := system.SubmitBatch("eu-west", "D", []BatchOp{{Kind: OpRead, Key: "x"}, {Kind: OpRead, Key: "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Index != 1 || system.Nodes["A"].Store.CommitIndex != 1 || result.Results[0].Value != "1" {
+		t.Errorf("Expected reads at index 1 without a new entry, got %+v", result)
+	}
+	if _, err := system.SubmitBatch("eu-west", "D", nil); !errors.Is(err, ErrEmptyBatch) {
+		t.Errorf("Expected ErrEmptyBatch, got %v", err)
+	}
+}
+
+// TestSubmitBatchConcurrentChecks tests that of concurrent compare-and-set
+// batches on the same version exactly one commits, each at its own index
+func TestSubmitBatchConcurrentChecks(t *testing.T) {
+	system := newGeoSystem(t)
+	var wg sync.WaitGroup
+	errs := make([]error, 32)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = system.SubmitBatch("us-east", "A", []BatchOp{
+				{Kind: OpCheck, Key: "x", Version: 0},
+				{Kind: OpWrite, Key: "x", Value: fmt.Sprint(i)},
+			})
+		}()
+	}
+	wg.Wait()
+	committed := 0
+	for _, err := range errs {
+		if err == nil {
+			committed++
+		} else if !errors.Is(err, ErrBatchAborted) {
+			t.Errorf("Expected the losers to abort, got %v", err)
+		}
+	}
+	if store := system.Nodes["A"].Store; committed != 1 || store.CommitIndex != 1 {
+		t.Errorf("Expected one batch committed at index 1, got %d at %d", committed, store.CommitIndex)
+	}
+}
@@ -0,0 +1,217 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// Byzantine node strategies.
+//
+// A Byzantine node built with NewByzantineNode runs a strategy on every clock
+// update it propagates. MutateOutgoing rewrites the update once, DecideDrop
+// may withhold it from a neighbor, and Equivocate picks the version each
+// neighbor receives. The node owns its key and signs every version whose
+// signature no longer matches, so signature checks pass and receivers have
+// to catch the attack by its content. A correct node signs each update
+// afresh, so an honest receiver rejects an update carrying a signature it
+// already accepted as a replay. It also
+// rejects an update stamped more than MaxClockSkew past the current time,
+// wall-clock or virtual as read by its own clock, see SimClock, as
+// inflated. Both are traced as detections. An
+// older update replayed by a relay fails the sequence number check of
+// VerifyAndApplyClockUpdate and is traced as a rejection.
+// Equivocation and dropping leave no trace at a single receiver and only
+// show as diverging clocks, see DiffNodes.
+
+// MaxClockSkew is how many seconds past the current time a receiver accepts
+// a timestamp
+const MaxClockSkew = 5
+
+var ErrUnknownStrategy = errors.New("unknown Byzantine strategy")
+
+// ByzantineStrategy is how a Byzantine node misbehaves on clock updates
+type ByzantineStrategy interface {
+	Name() string
+	// MutateOutgoing returns the update the node sends in place of update
+	MutateOutgoing(update *ClockUpdate) *ClockUpdate
+	// DecideDrop reports whether the node withholds update from peer
+	DecideDrop(peer string, update *ClockUpdate) bool
+	// Equivocate returns the version of update peer receives
+	Equivocate(peer string, update *ClockUpdate) *ClockUpdate
+}
+
+// HonestStrategy sends every update unchanged to everyone. Strategies embed
+// it to override only the behavior they change.
+type HonestStrategy struct{}
+
+func (HonestStrategy) Name() string                                             { return "honest" }
+func (HonestStrategy) MutateOutgoing(update *ClockUpdate) *ClockUpdate          { return update }
+func (HonestStrategy) DecideDrop(peer string, update *ClockUpdate) bool         { return false }
+func (HonestStrategy) Equivocate(peer string, update *ClockUpdate) *ClockUpdate { return update }
+
+// TimestampInflation stamps updates Skew ahead of the node's clock
+type TimestampInflation struct {
+	HonestStrategy
+	Skew int64
+}
+
+func (s *TimestampInflation) Name() string { return "timestamp-inflation" }
+
+func (s *TimestampInflation) MutateOutgoing(update *ClockUpdate) *ClockUpdate {
+	inflated := *update
+	inflated.Timestamp += s.Skew
+	return &inflated
+}
+
+// Equivocation sends each neighbor a different version of an update: the
+// first one gets it unchanged, each next one Spread later than the one before
+type Equivocation struct {
+	HonestStrategy
+	Spread int64
+	last   *ClockUpdate
+	sent   int64
+}
+
+func (s *Equivocation) Name() string { return "equivocation" }
+
+func (s *Equivocation) Equivocate(peer string, update *ClockUpdate) *ClockUpdate {
+	if update != s.last {
+		s.last, s.sent = update, 0
+	}
+	version := *update
+	version.Timestamp += s.sent * s.Spread
+	s.sent++
+	return &version
+}
+
+// MessageDrop withholds each update from each neighbor with probability Rate
+type MessageDrop struct {
+	HonestStrategy
+	Rate float64
+	rng  *rand.Rand
+}
+
+// NewMessageDrop creates a dropping strategy drawing from seed
+func NewMessageDrop(rate float64, seed int64) *MessageDrop {
+	return &MessageDrop{Rate: rate, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (s *MessageDrop) Name() string { return "message-drop" }
+
+func (s *MessageDrop) DecideDrop(peer string, update *ClockUpdate) bool {
+	return s.rng.Float64() < s.Rate
+}
+
+// Replay sends the first update the node ever sent instead of every later one
+type Replay struct {
+	HonestStrategy
+	first *ClockUpdate
+}
+
+func (s *Replay) Name() string { return "replay" }
+
+func (s *Replay) MutateOutgoing(update *ClockUpdate) *ClockUpdate {
+	if s.first == nil {
+		s.first = update
+	}
+	return s.first
+}
+
+// StrategyNames are the names NewStrategy accepts
+var StrategyNames = []string{"honest", "timestamp-inflation", "equivocation", "message-drop", "replay"}
+
+// NewStrategy returns the built-in strategy with the given name and its
+// default parameters: an hour of inflation, a second of spread between
+// versions and half of the updates dropped, drawn from seed
+func NewStrategy(name string, seed int64) (ByzantineStrategy, error) {
+	switch name {
+	case "honest":
+		return HonestStrategy{}, nil
+	case "timestamp-inflation":
+		return &TimestampInflation{Skew: 3600}, nil
+	case "equivocation":
+		return &Equivocation{Spread: 1}, nil
+	case "message-drop":
+		return NewMessageDrop(0.5, seed), nil
+	case "replay":
+		return &Replay{}, nil
+	}
+	return nil, fmt.Errorf("%w: %q, want one of %v", ErrUnknownStrategy, name, StrategyNames)
+}
+
+// NewByzantineNode creates a Byzantine node that misbehaves according to
+// strategy
+func NewByzantineNode(id string, strategy ByzantineStrategy) (*Node, error) {
+	node, err := NewNode(id, true, false)
+	if err != nil {
+		return nil, err
+	}
+	node.Strategy = strategy
+	return node, nil
+}
+
+// mutate returns the update the node's strategy sends in place of update.
+// The caller must hold n.Lock.
+func (n *Node) mutate(update *ClockUpdate) *ClockUpdate {
+	if n.Strategy == nil {
+		return update
+	}
+	return n.resign(n.Strategy.MutateOutgoing(update))
+}
+
+// outgoing returns the version of update the node sends to peer, or nil if
+// it withholds it. The caller must hold n.Lock.
+func (n *Node) outgoing(peer string, update *ClockUpdate) *ClockUpdate {
+	if n.Strategy == nil {
+		return update
+	}
+	if n.Strategy.DecideDrop(peer, update) {
+		return nil
+	}
+	return n.resign(n.Strategy.Equivocate(peer, update))
+}
+
+// resign signs a copy of the node's own update if its signature does not
+// match its content
+func (n *Node) resign(update *ClockUpdate) *ClockUpdate {
+	if update.NodeID != n.ID || VerifyClockUpdate(n.PublicKey, update) {
+		return update
+	}
+	signed := *update
+	if signature, err := SignClockUpdate(n.PrivateKey, &signed); err == nil {
+		signed.Signature = signature
+	}
+	return &signed
+}
+
+// detect returns why an honest receiver refuses an update, or "" if it
+// accepts it
+func (s *System) detect(receiver *Node, update *ClockUpdate) string {
+	receiver.Lock.RLock()
+	defer receiver.Lock.RUnlock()
+	if receiver.IsByzantine || update.Signature == "" {
+		return ""
+	}
+	if receiver.accepted[update.NodeID] == update.Signature {
+		return fmt.Sprintf("replayed update from %s: signature already accepted", update.NodeID)
+	}
+	if now := receiver.physicalNow(s).Unix(); update.Timestamp > now+MaxClockSkew {
+		return fmt.Sprintf("inflated update from %s: timestamp %d ahead of %d", update.NodeID, update.Timestamp, now)
+	}
+	return ""
+}
+
+// remember records the signature of an update the node accepted
+func (n *Node) remember(update *ClockUpdate) {
+	n.Lock.Lock()
+	defer n.Lock.Unlock()
+	if n.accepted == nil {
+		n.accepted = make(map[string]string)
+	}
+	n.accepted[update.NodeID] = update.Signature
+	if n.updates == nil {
+		n.updates = make(map[string]*ClockUpdate)
+	}
+	n.updates[update.NodeID] = update
+}
@@ -0,0 +1,132 @@
+package bft
+
+import (
+	"strings"
+	"testing"
+)
+
+// newStrategySystem creates a Byzantine A following strategy and honest
+// neighbors B, C and D, with a trace
+func newStrategySystem(t *testing.T, strategy ByzantineStrategy) *System {
+	system := NewSystem()
+	system.Trace = NewTrace()
+	attacker, err := NewByzantineNode("A", strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attacker.Neighbors = []string{"B", "C", "D"}
+	system.AddNode(attacker)
+	for _, id := range attacker.Neighbors {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		system.AddNode(node)
+	}
+	return system
+}
+
+// events returns the traced events of the given type
+func events(system *System, kind EventType) []TraceEvent {
+	var matching []TraceEvent
+	for _, event := range system.Trace.Snapshot() {
+		if event.Type == kind {
+			matching = append(matching, event)
+		}
+	}
+	return matching
+}
+
+// TestHonestStrategy tests that a node following the honest strategy sends signed, unchanged updates
+func TestHonestStrategy(t *testing.T) {
+	system := newStrategySystem(t, HonestStrategy{})
+	a := system.Nodes["A"]
+	update := a.GetClockUpdate()
+	a.PropagateClockUpdate(update, system)
+
+	if !VerifyClockUpdate(a.PublicKey, update) {
+		t.Errorf("Expected the update to be signed")
+	}
+	for _, id := range a.Neighbors {
+		if got := system.Nodes[id].VectorClock.GetTimestamp("A"); got != update.Timestamp {
+			t.Errorf("Expected %s to hold %d, got %d", id, update.Timestamp, got)
+		}
+	}
+	if len(events(system, EventDetection)) != 0 {
+		t.Errorf("Expected no detections")
+	}
+}
+
+// TestTimestampInflationDetected tests that receivers reject validly signed timestamps from the future
+func TestTimestampInflationDetected(t *testing.T) {
+	system := newStrategySystem(t, &TimestampInflation{Skew: 3600})
+	a := system.Nodes["A"]
+	a.PropagateClockUpdate(a.GetClockUpdate(), system)
+
+	detections := events(system, EventDetection)
+	if len(detections) != 3 || !strings.Contains(detections[0].Detail, "inflated update from A") {
+		t.Fatalf("Expected every neighbor to detect the inflation, got %+v", detections)
+	}
+	if !VerifyClockUpdate(a.PublicKey, detections[0].Update) {
+		t.Errorf("Expected the inflated update to carry a valid signature")
+	}
+	if system.Nodes["B"].VectorClock.GetTimestamp("A") != 0 {
+		t.Errorf("Expected B not to apply the inflated timestamp")
+	}
+}
+
+// TestEquivocationDivergesClocks tests that neighbors of an equivocating node end up with different entries
+func TestEquivocationDivergesClocks(t *testing.T) {
+	system := newStrategySystem(t, &Equivocation{Spread: 1})
+	a := system.Nodes["A"]
+	update := a.GetClockUpdate()
+	a.PropagateClockUpdate(update, system)
+
+	seen := make(map[int64]string)
+	for i, id := range a.Neighbors {
+		got := system.Nodes[id].VectorClock.GetTimestamp("A")
+		if got != update.Timestamp+int64(i) {
+			t.Errorf("Expected %s to hold %d, got %d", id, update.Timestamp+int64(i), got)
+		}
+		seen[got] = id
+	}
+	if len(seen) != 3 || len(events(system, EventDetection)) != 0 {
+		t.Errorf("Expected three undetected versions, got %v", seen)
+	}
+}
+
+// TestMessageDrop tests that a dropping node withholds updates from its neighbors
+func TestMessageDrop(t *testing.T) {
+	system := newStrategySystem(t, NewMessageDrop(1, 1))
+	a := system.Nodes["A"]
+	a.PropagateClockUpdate(a.GetClockUpdate(), system)
+	if sends := events(system, EventSend); len(sends) != 0 {
+		t.Errorf("Expected every update to be dropped, got %d sends", len(sends))
+	}
+
+	system = newStrategySystem(t, NewMessageDrop(0.5, 1))
+	a = system.Nodes["A"]
+	for i := 0; i < 10; i++ {
+		a.PropagateClockUpdate(a.GetClockUpdate(), system)
+	}
+	if sends := len(events(system, EventSend)); sends == 0 || sends == 30 {
+		t.Errorf("Expected some of the 30 updates to be dropped, got %d sends", sends)
+	}
+}
+
+// TestReplayDetected tests that receivers reject an update they already accepted
+func TestReplayDetected(t *testing.T) {
+	system := newStrategySystem(t, &Replay{})
+	a := system.Nodes["A"]
+	first := a.GetClockUpdate()
+	a.PropagateClockUpdate(first, system)
+	if len(events(system, EventApply)) != 3 {
+		t.Fatalf("Expected the first update to be applied everywhere")
+	}
+
+	a.PropagateClockUpdate(a.GetClockUpdate(), system)
+	detections := events(system, EventDetection)
+	if len(detections) != 3 || detections[0].Update.Signature != first.Signature || !strings.Contains(detections[0].Detail, "replayed") {
+		t.Errorf("Expected every neighbor to detect the replay, got %+v", detections)
+	}
+}
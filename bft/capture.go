@@ -0,0 +1,221 @@
+package bft
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Packet capture of simulated traffic.
+//
+// With a capture attached, every message the simulator sends between nodes
+// is written as one JSON line: when it was sent, on which link, between
+// which nodes and regions, what kind of message it was, its size on the
+// wire and its one-way latency. Sizes come from the message's current wire
+// schema, so the dump reflects what a real deployment would put on the
+// network. The format is meant for jq, pandas and custom scripts comparing
+// the traffic of dissemination strategies.
+
+// Packet is one captured message
+type Packet struct {
+	Seq       uint64        `json:"seq"`
+	At        time.Duration `json:"ts_ns"` // Send time from the start of the capture
+	Link      string        `json:"link"`
+	Src       string        `json:"src"`
+	Dst       string        `json:"dst"`
+	SrcRegion string        `json:"src_region,omitempty"`
+	DstRegion string        `json:"dst_region,omitempty"`
+	Kind      string        `json:"kind"`
+	Size      int           `json:"size"`
+	Latency   time.Duration `json:"latency_ns"`
+	Dropped   bool          `json:"dropped,omitempty"` // Sent but never delivered
+}
+
+// PacketCapture writes packets as JSON lines
+type PacketCapture struct {
+	Now     func() time.Duration // Time source, defaults to time since creation
+	Packets uint64
+	Bytes   int64
+	Lock    sync.Mutex
+	enc     *json.Encoder
+	err     error
+}
+
+// NewPacketCapture creates a capture writing to w
+func NewPacketCapture(w io.Writer) *PacketCapture {
+	start := time.Now()
+	return &PacketCapture{
+		Now: func() time.Duration { return time.Since(start) },
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Record writes a packet, assigning its sequence number and, if unset, its
+// send time. After a write error further packets are discarded.
+func (c *PacketCapture) Record(packet Packet) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	if c.err != nil {
+		return
+	}
+	packet.Seq = c.Packets
+	if packet.At == 0 {
+		packet.At = c.Now()
+	}
+	if err := c.enc.Encode(packet); err != nil {
+		c.err = err
+		return
+	}
+	c.Packets++
+	c.Bytes += int64(packet.Size)
+}
+
+// Err returns the first write error
+func (c *PacketCapture) Err() error {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	return c.err
+}
+
+// newPacket describes a message from one node to another
+func newPacket(from, to *Node, kind string, size int, latency time.Duration) Packet {
+	return Packet{
+		Link:      NewLink(from.ID, to.ID).String(),
+		Src:       from.ID,
+		Dst:       to.ID,
+		SrcRegion: from.Region,
+		DstRegion: to.Region,
+		Kind:      kind,
+		Size:      size,
+		Latency:   latency,
+	}
+}
+
+// capture records a packet if the system has a capture attached and counts
+// it in the metrics
+func (s *System) capture(packet Packet) {
+	if packet.Dropped {
+		s.Metrics.add(metricDropped, packet.Kind, 1)
+	} else {
+		s.Metrics.add(metricSent, packet.Kind, 1)
+		s.Metrics.add(metricBytes, packet.Kind, float64(packet.Size))
+	}
+	if s.Capture != nil {
+		s.Capture.Record(packet)
+	}
+}
+
+// wireSize returns the encoded size of msgs under the newest registered
+// version of message's schema
+func wireSize(message string, msgs ...interface{}) int {
+	var newest WireSchema
+	for _, schema := range schemas[message] {
+		if schema.Version > newest.Version {
+			newest = schema
+		}
+	}
+	size := 0
+	for _, msg := range msgs {
+		if data, err := newest.Encode(msg); err == nil {
+			size += len(data)
+		}
+	}
+	return size
+}
+
+// entriesSize returns the encoded size of replicated entries
+func entriesSize(entries []Entry) int {
+	data, _ := json.Marshal(entries)
+	return len(data)
+}
+
+// memberUpdatesSize returns the encoded size of piggybacked membership updates
+func memberUpdatesSize(updates []MemberUpdate) int {
+	msgs := make([]interface{}, len(updates))
+	for i, update := range updates {
+		msgs[i] = update
+	}
+	return wireSize("member-update", msgs...)
+}
+
+// CaptureStrategies are the dissemination strategies the capture command runs
+var CaptureStrategies = []string{"flood", "swim"}
+
+// RunCaptured runs a dissemination strategy for rounds on n nodes spread
+// over three regions, capturing its traffic. Time advances period per round.
+func RunCaptured(strategy string, n, rounds int, period time.Duration, capture *PacketCapture) error {
+	system := NewSystem()
+	regions := []string{"us-east", "eu-west", "ap-south"}
+	var ids []string
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("N%d", i+1)
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			return err
+		}
+		node.Region = regions[i%len(regions)]
+		node.Clock = func() int64 { return 0 }
+		ids = append(ids, id)
+		system.AddNode(node)
+	}
+	for _, id := range ids {
+		for _, peer := range ids {
+			if peer != id {
+				system.Nodes[id].Neighbors = append(system.Nodes[id].Neighbors, peer)
+			}
+		}
+	}
+	system.SetRegionLatency("us-east", "eu-west", 40*time.Millisecond)
+	system.SetRegionLatency("us-east", "ap-south", 110*time.Millisecond)
+	system.SetRegionLatency("eu-west", "ap-south", 70*time.Millisecond)
+
+	round := 0
+	capture.Now = func() time.Duration { return time.Duration(round) * period }
+	system.Capture = capture
+
+	switch strategy {
+	case "flood":
+		for round = 1; round <= rounds; round++ {
+			system.propagateRound(ids)
+		}
+	case "swim":
+		swim := NewSWIM(system, DefaultMembershipConfig(), 1)
+		for round = 1; round <= rounds; round++ {
+			swim.Tick()
+		}
+	default:
+		return fmt.Errorf("unknown strategy %q, want one of %v", strategy, CaptureStrategies)
+	}
+	return capture.Err()
+}
+
+// CaptureCommand dumps the traffic of a dissemination strategy to a JSON lines file
+func CaptureCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("capture", flag.ContinueOnError)
+	strategy := flags.String("strategy", "flood", fmt.Sprintf("dissemination strategy, one of %v", CaptureStrategies))
+	nodes := flags.Int("nodes", 7, "number of nodes")
+	rounds := flags.Int("rounds", 10, "rounds to simulate")
+	period := flags.Duration("period", 200*time.Millisecond, "simulated time per round")
+	output := flags.String("o", "", "file to write the capture to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return fmt.Errorf("usage: capture -o file [-strategy name] [-nodes n] [-rounds n] [-period d]")
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	capture := NewPacketCapture(f)
+	if err := RunCaptured(*strategy, *nodes, *rounds, *period, capture); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Captured %d packets, %d bytes to %s\n", capture.Packets, capture.Bytes, *output)
+	return nil
+}
@@ -0,0 +1,95 @@
+package bft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// decodePackets parses a JSON lines capture
+func decodePackets(t *testing.T, data []byte) []Packet {
+	var packets []Packet
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var packet Packet
+		if err := json.Unmarshal(scanner.Bytes(), &packet); err != nil {
+			t.Fatalf("Expected a JSON packet per line, got %q: %v", scanner.Text(), err)
+		}
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+// TestCaptureFlood tests that flooding sends every node's update to every peer each round
+func TestCaptureFlood(t *testing.T) {
+	var buf bytes.Buffer
+	capture := NewPacketCapture(&buf)
+	if err := RunCaptured("flood", 4, 3, 100*time.Millisecond, capture); err != nil {
+		t.Fatal(err)
+	}
+	packets := decodePackets(t, buf.Bytes())
+	if len(packets) != 4*3*3 || capture.Packets != uint64(len(packets)) {
+		t.Fatalf("Expected 36 packets, got %d", len(packets))
+	}
+	first, last := packets[0], packets[len(packets)-1]
+	if first.Kind != "clock-update" || first.Link != "N1-N2" || first.Size == 0 {
+		t.Errorf("Expected a sized clock update on link N1-N2 first, got %+v", first)
+	}
+	if first.At != 100*time.Millisecond || last.At != 300*time.Millisecond {
+		t.Errorf("Expected timestamps from 100ms to 300ms, got %v and %v", first.At, last.At)
+	}
+	if first.SrcRegion != "us-east" || first.DstRegion != "eu-west" || first.Latency != 40*time.Millisecond {
+		t.Errorf("Expected the us-east to eu-west latency of 40ms, got %+v", first)
+	}
+}
+
+// TestCaptureSWIMDropsPings tests that pings to a partitioned node are captured as dropped
+func TestCaptureSWIMDropsPings(t *testing.T) {
+	system := newGeoSystem(t)
+	var buf bytes.Buffer
+	system.Capture = NewPacketCapture(&buf)
+	swim := NewSWIM(system, DefaultMembershipConfig(), 1)
+	for i := 0; i < 5; i++ {
+		swim.Tick()
+	}
+	system.SetPartition("G", true)
+	for i := 0; i < 5; i++ {
+		swim.Tick()
+	}
+
+	dropped := 0
+	for _, packet := range decodePackets(t, buf.Bytes()) {
+		if packet.Kind != "swim-ping" && packet.Kind != "swim-ack" {
+			t.Errorf("Expected only SWIM messages, got %q", packet.Kind)
+		}
+		if packet.Dropped {
+			dropped++
+			if packet.Dst != "G" {
+				t.Errorf("Expected only pings to G to be dropped, got %+v", packet)
+			}
+		}
+	}
+	if dropped == 0 {
+		t.Errorf("Expected pings to the partitioned node to be captured as dropped")
+	}
+}
+
+// TestCaptureReplication tests that a forwarded write captures the forward and append messages
+func TestCaptureReplication(t *testing.T) {
+	system := newGeoSystem(t)
+	var buf bytes.Buffer
+	system.Capture = NewPacketCapture(&buf)
+	if _, err := system.SubmitWrite("ap-south", "G", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := make(map[string]int)
+	for _, packet := range decodePackets(t, buf.Bytes()) {
+		kinds[packet.Kind]++
+	}
+	if kinds["forward"] != 1 || kinds["append"] != 3 {
+		t.Errorf("Expected one forward and three appends, got %v", kinds)
+	}
+}
@@ -0,0 +1,154 @@
+package bft
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Caches of verified certificates.
+//
+// Gossip and catch-up hand a node the same certificates again and again: a
+// NEW-VIEW carries view changes its replicas already checked, a quorum
+// certificate reaches a node once per commit that carries it. Every node
+// keeps the digests of the signatures and quorum certificates it verified
+// in a bounded LRU cache and skips verifying them again. Only successful
+// checks are cached, so a forgery costs its full price every time it is
+// presented. Signature keys cover the public key, so a rotated key misses
+// the cache; quorum certificate keys cover the voters, their keys and k, so
+// a reconfiguration misses it too.
+
+// DefaultCertCacheSize is how many verified digests a new node remembers
+const DefaultCertCacheSize = 4096
+
+// CertCacheStats count the lookups of a cache
+type CertCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// CertCache remembers the digests of verified certificates, evicting the
+// least recently used beyond its capacity
+type CertCache struct {
+	Capacity int
+	Stats    CertCacheStats
+	Lock     sync.Mutex
+	order    *list.List // Digests, most recently used first
+	entries  map[string]*list.Element
+}
+
+// NewCertCache creates an empty cache holding up to capacity digests
+func NewCertCache(capacity int) *CertCache {
+	return &CertCache{Capacity: capacity, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Len returns the number of cached digests
+func (c *CertCache) Len() int {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	return c.order.Len()
+}
+
+// clone returns a cache with the same digests and fresh stats. Verified
+// certificates stay verified in any future of a run.
+func (c *CertCache) clone() *CertCache {
+	if c == nil {
+		return nil
+	}
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	clone := NewCertCache(c.Capacity)
+	for e := c.order.Back(); e != nil; e = e.Prev() {
+		clone.entries[e.Value.(string)] = clone.order.PushFront(e.Value)
+	}
+	return clone
+}
+
+// verify reports whether the certificate with the given digest passes
+// check, without running check if it passed before. Lookups are counted in
+// metrics, if not nil, under kind. A nil cache always checks.
+func (c *CertCache) verify(metrics *Metrics, kind, digest string, check func() bool) bool {
+	if c == nil {
+		return check()
+	}
+	c.Lock.Lock()
+	if e, cached := c.entries[digest]; cached {
+		c.order.MoveToFront(e)
+		c.Stats.Hits++
+		c.Lock.Unlock()
+		metrics.add(metricCacheHits, kind, 1)
+		return true
+	}
+	c.Stats.Misses++
+	c.Lock.Unlock()
+	metrics.add(metricCacheMisses, kind, 1)
+	if !check() {
+		return false
+	}
+
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	if _, cached := c.entries[digest]; !cached {
+		c.entries[digest] = c.order.PushFront(digest)
+	}
+	for c.order.Len() > max(c.Capacity, 0) {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(string))
+		c.Stats.Evictions++
+		metrics.add(metricCacheEvictions, kind, 1)
+	}
+	return true
+}
+
+// keyDigest identifies a public key in cache keys
+func keyDigest(key crypto.PublicKey) string {
+	return crypto.EncodePublicKey(key)
+}
+
+// signatureKey is the cache key of a signature over digest by key
+func signatureKey(key crypto.PublicKey, digest []byte, signature string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("sig:%s:%x:%s", keyDigest(key), digest, signature)))
+	return hex.EncodeToString(sum[:])
+}
+
+// certs returns the node's cache, none for a nil node
+func (n *Node) certs() *CertCache {
+	if n == nil {
+		return nil
+	}
+	return n.Certs
+}
+
+// verifySignature checks a signature over digest by key, through the
+// node's cache
+func (n *Node) verifySignature(metrics *Metrics, key crypto.PublicKey, digest []byte, signature string) bool {
+	if key == nil {
+		return false
+	}
+	return n.certs().verify(metrics, "signature", signatureKey(key, digest, signature), func() bool {
+		return crypto.Verify(key, digest, signature) == nil
+	})
+}
+
+// certificateKey is the cache key of a quorum certificate under the current
+// configuration. The caller must hold s.Lock.
+func (s *System) certificateKey(cert *QuorumCertificate) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "qc:%x:%s:%d", clockUpdateDigest(cert.Update), cert.Update.Signature, s.quorumSize())
+	if sender := s.Nodes[cert.Update.NodeID]; sender != nil {
+		fmt.Fprintf(h, ":%s", keyDigest(sender.PublicKey))
+	}
+	for _, voter := range s.voters() {
+		fmt.Fprintf(h, ":%s=%s", voter.ID, keyDigest(voter.PublicKey))
+	}
+	for _, ack := range cert.Acks {
+		fmt.Fprintf(h, ":%s:%s", ack.Node, ack.Signature)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
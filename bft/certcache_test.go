@@ -0,0 +1,95 @@
+package bft
+
+import "testing"
+
+// TestCertCacheEvictsLeastRecentlyUsed tests that a full cache forgets the digest used longest ago
+func TestCertCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCertCache(2)
+	checks := 0
+	check := func() bool { checks++; return true }
+	for _, digest := range []string{"a", "b", "a", "c", "a", "b"} {
+		cache.verify(nil, "signature", digest, check)
+	}
+	// a, b miss; a hits; c misses and evicts b; a hits; b misses and evicts c
+	want := CertCacheStats{Hits: 2, Misses: 4, Evictions: 2}
+	if cache.Stats != want || checks != 4 || cache.Len() != 2 {
+		t.Errorf("Expected %+v after 4 checks with 2 cached, got %+v after %d with %d", want, cache.Stats, checks, cache.Len())
+	}
+	if clone := cache.clone(); clone.Len() != 2 || clone.Stats != (CertCacheStats{}) {
+		t.Errorf("Expected the clone to hold the digests with fresh stats, got %d and %+v", clone.Len(), clone.Stats)
+	}
+}
+
+// TestCertCacheSkipsOnlyVerified tests that a failed check is run again every time
+func TestCertCacheSkipsOnlyVerified(t *testing.T) {
+	cache := NewCertCache(8)
+	metrics := NewMetrics()
+	for i := 0; i < 3; i++ {
+		if cache.verify(metrics, "signature", "forged", func() bool { return false }) {
+			t.Fatal("Expected the forgery to fail")
+		}
+	}
+	if cache.Len() != 0 || metrics.Count(metricCacheMisses.name, "signature") != 3 {
+		t.Errorf("Expected three uncached misses, got %d cached and %v misses", cache.Len(), metrics.Count(metricCacheMisses.name, "signature"))
+	}
+	var none *CertCache
+	if !none.verify(metrics, "signature", "x", func() bool { return true }) {
+		t.Error("Expected a nil cache to run the check")
+	}
+}
+
+// TestCommitClockUpdateCached tests that a certificate delivered again is not verified again, until the configuration changes
+func TestCommitClockUpdateCached(t *testing.T) {
+	system := newGeoSystem(t)
+	system.Metrics = NewMetrics()
+	cert, err := system.CollectQuorum(system.Nodes["A"].GetClockUpdate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := system.CommitClockUpdate(cert); err != nil {
+		t.Fatal(err)
+	}
+	hits := system.Metrics.Count(metricCacheHits.name, "quorum-cert")
+	misses := system.Metrics.Count(metricCacheMisses.name, "quorum-cert")
+	if hits != 0 || misses != 3 {
+		t.Fatalf("Expected B, D and G to verify the certificate once each, got %v hits and %v misses", hits, misses)
+	}
+	if _, err := system.CommitClockUpdate(cert); err != nil {
+		t.Fatal(err)
+	}
+	if hits := system.Metrics.Count(metricCacheHits.name, "quorum-cert"); hits != 3 {
+		t.Errorf("Expected the redelivered certificate to hit every cache, got %v hits", hits)
+	}
+
+	// A rotated key changes what the certificate is checked against
+	rotated, err := NewNode("G", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	system.Nodes["G"].PublicKey = rotated.PublicKey
+	if _, err := system.CommitClockUpdate(cert); err == nil {
+		t.Error("Expected the certificate to fail against G's new key rather than pass from the cache")
+	}
+}
+
+// TestPBFTViewChangeCached tests that replicas installing a NEW-VIEW skip the view changes they checked already
+func TestPBFTViewChangeCached(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.System.Metrics = NewMetrics()
+	for _, replica := range pbft.Replicas {
+		replica.Metrics = pbft.System.Metrics
+	}
+	pbft.Submit([]byte("op-1"))
+	pbft.Run()
+	if _, err := pbft.KillPrimary(); err != nil {
+		t.Fatal(err)
+	}
+	digest, _ := pbft.Submit([]byte("op-2"))
+	pbft.Run()
+	if !pbft.Outcome(digest).Committed {
+		t.Fatal("Expected op-2 to commit after the view change")
+	}
+	if hits := pbft.System.Metrics.Count(metricCacheHits.name, "signature"); hits == 0 {
+		t.Error("Expected view changes carried in the NEW-VIEW to hit the caches")
+	}
+}
@@ -0,0 +1,196 @@
+package bft
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Quorum certificates for clock updates.
+//
+// A signed clock update only proves who sent it. Before the update counts
+// as committed, k = n - f + 1 voters must each check the sender's signature
+// and sign an acknowledgement over the update. Any two sets of k voters
+// share at least f+1 of them, so at least one honest voter is in both and
+// no two conflicting updates can both be certified. The certificate carries
+// the update and the acknowledgements; whoever receives it checks every
+// signature against the system's keys and recomputes k itself rather than
+// trusting the one recorded in the certificate.
+
+var (
+	ErrNoAcknowledgements = errors.New("not enough acknowledgements")
+	ErrInvalidQuorumCert  = errors.New("invalid quorum certificate")
+)
+
+// Acknowledgement is a voter's signature over a clock update it verified
+type Acknowledgement struct {
+	Node      string
+	Signature string
+}
+
+// QuorumCertificate aggregates k acknowledgements over a clock update
+type QuorumCertificate struct {
+	Update *ClockUpdate
+	K      int
+	Acks   []Acknowledgement
+}
+
+// Signers returns the voters that acknowledged the update
+func (c *QuorumCertificate) Signers() []string {
+	signers := make([]string, len(c.Acks))
+	for i, ack := range c.Acks {
+		signers[i] = ack.Node
+	}
+	return signers
+}
+
+// ackDigest is what a voter signs to acknowledge an update
+func ackDigest(voter string, update *ClockUpdate) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("ack:%s:%x", voter, clockUpdateDigest(update))))
+	return sum[:]
+}
+
+// Acknowledge signs an acknowledgement of an update whose signature the
+// caller has checked. A Byzantine node without a strategy refuses, as it
+// refuses to apply updates.
+func (n *Node) Acknowledge(update *ClockUpdate) (*Acknowledgement, error) {
+	n.Lock.RLock()
+	defer n.Lock.RUnlock()
+	if n.IsByzantine && n.Strategy == nil {
+		return nil, fmt.Errorf("%s refuses to acknowledge", n.ID)
+	}
+	signature, err := crypto.Sign(n.PrivateKey, ackDigest(n.ID, update))
+	if err != nil {
+		return nil, err
+	}
+	return &Acknowledgement{Node: n.ID, Signature: signature}, nil
+}
+
+// quorumSize returns k = n - f + 1 over the voters. The caller must hold
+// s.Lock.
+func (s *System) quorumSize() int {
+	n := len(s.voters())
+	return n - s.faultThreshold(n) + 1
+}
+
+// CollectQuorum asks the reachable voters to acknowledge update and returns
+// a certificate once k of them have. The update must carry a valid
+// signature of its sender.
+func (s *System) CollectQuorum(update *ClockUpdate) (*QuorumCertificate, error) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	sender, exists := s.Nodes[update.NodeID]
+	if !exists {
+		return nil, fmt.Errorf("%w: unknown sender %s", ErrNoAcknowledgements, update.NodeID)
+	}
+	if !VerifyClockUpdate(sender.PublicKey, update) {
+		s.audit(AuditSignatureFailure, update.NodeID, "", fmt.Sprintf("invalid signature on clock update %d", update.Seq))
+		return nil, fmt.Errorf("%w: invalid signature from %s", ErrNoAcknowledgements, update.NodeID)
+	}
+	k := s.quorumSize()
+	cert := &QuorumCertificate{Update: update, K: k}
+	for _, voter := range s.voters() {
+		if !s.reachable(voter) {
+			continue
+		}
+		ack, err := voter.Acknowledge(update)
+		if err != nil {
+			continue
+		}
+		cert.Acks = append(cert.Acks, *ack)
+		if len(cert.Acks) == k {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: need %d, got %d", ErrNoAcknowledgements, k, len(cert.Acks))
+}
+
+// VerifyCertificate checks the sender's signature and that k distinct
+// voters acknowledged the update with valid signatures
+func (s *System) VerifyCertificate(cert *QuorumCertificate) error {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	return s.verifyCertificate(nil, cert)
+}
+
+// verifyCertificate is VerifyCertificate for a caller holding s.Lock, run
+// by verifier through its cache if not nil
+func (s *System) verifyCertificate(verifier *Node, cert *QuorumCertificate) error {
+	if cert == nil || cert.Update == nil {
+		return fmt.Errorf("%w: no update", ErrInvalidQuorumCert)
+	}
+	var err error
+	verifier.certs().verify(s.Metrics, "quorum-cert", s.certificateKey(cert), func() bool {
+		err = s.checkCertificate(verifier, cert)
+		return err == nil
+	})
+	return err
+}
+
+// checkCertificate checks every signature of a certificate. The caller must
+// hold s.Lock.
+func (s *System) checkCertificate(verifier *Node, cert *QuorumCertificate) error {
+	sender, exists := s.Nodes[cert.Update.NodeID]
+	if !exists || !verifier.verifySignature(s.Metrics, sender.PublicKey, clockUpdateDigest(cert.Update), cert.Update.Signature) {
+		return fmt.Errorf("%w: bad update signature from %s", ErrInvalidQuorumCert, cert.Update.NodeID)
+	}
+	signed := make(map[string]bool)
+	for _, ack := range cert.Acks {
+		voter, exists := s.Nodes[ack.Node]
+		if !exists || voter.Standby {
+			return fmt.Errorf("%w: acknowledgement from non-voter %s", ErrInvalidQuorumCert, ack.Node)
+		}
+		if signed[ack.Node] {
+			return fmt.Errorf("%w: duplicate acknowledgement from %s", ErrInvalidQuorumCert, ack.Node)
+		}
+		if !verifier.verifySignature(s.Metrics, voter.PublicKey, ackDigest(ack.Node, cert.Update), ack.Signature) {
+			return fmt.Errorf("%w: bad acknowledgement signature from %s", ErrInvalidQuorumCert, ack.Node)
+		}
+		signed[ack.Node] = true
+	}
+	if k := s.quorumSize(); len(signed) < k {
+		return fmt.Errorf("%w: %d acknowledgements, need %d", ErrInvalidQuorumCert, len(signed), k)
+	}
+	return nil
+}
+
+// CommitClockUpdate has every reachable node verify a certificate and apply
+// its update. Each node checks the certificate itself, skipping the
+// signatures its cache holds, so a certificate delivered again costs a node
+// a lookup. It returns the nodes that applied the update.
+func (s *System) CommitClockUpdate(cert *QuorumCertificate) ([]string, error) {
+	s.Lock.RLock()
+	if cert == nil || cert.Update == nil {
+		s.Lock.RUnlock()
+		return nil, fmt.Errorf("%w: no update", ErrInvalidQuorumCert)
+	}
+	var nodes []*Node
+	for _, id := range sortedKeys(s.Nodes) {
+		if node := s.Nodes[id]; s.reachable(node) && id != cert.Update.NodeID {
+			nodes = append(nodes, node)
+		}
+	}
+	// With nobody to apply it the certificate is still checked, uncached
+	verifiers := nodes
+	if len(verifiers) == 0 {
+		verifiers = []*Node{nil}
+	}
+	for _, node := range verifiers {
+		if err := s.verifyCertificate(node, cert); err != nil {
+			s.Lock.RUnlock()
+			return nil, err
+		}
+	}
+	s.Lock.RUnlock()
+
+	var applied []string
+	for _, node := range nodes {
+		if node.VerifyAndApplyClockUpdate(cert.Update) {
+			applied = append(applied, node.ID)
+		}
+	}
+	return applied, nil
+}
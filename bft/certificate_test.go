@@ -0,0 +1,80 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCollectQuorum tests that k acknowledgements certify an update every reachable node then applies
+func TestCollectQuorum(t *testing.T) {
+	system := newGeoSystem(t)
+	update := system.Nodes["A"].GetClockUpdate()
+
+	cert, err := system.CollectQuorum(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.K != 4 || len(cert.Acks) != 4 {
+		t.Errorf("Expected k=4 with 4 acknowledgements for n=4, f=1, got k=%d with %v", cert.K, cert.Signers())
+	}
+	applied, err := system.CommitClockUpdate(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 3 {
+		t.Errorf("Expected B, D and G to apply the update, got %v", applied)
+	}
+	if system.Nodes["G"].VectorClock.GetTimestamp("A") != update.Timestamp {
+		t.Errorf("Expected G to hold A's timestamp")
+	}
+}
+
+// TestCollectQuorumShortOfK tests that an update is not certified without k acknowledgements
+func TestCollectQuorumShortOfK(t *testing.T) {
+	system := newGeoSystem(t)
+	system.SetPartition("G", true)
+
+	if _, err := system.CollectQuorum(system.Nodes["A"].GetClockUpdate()); !errors.Is(err, ErrNoAcknowledgements) {
+		t.Errorf("Expected ErrNoAcknowledgements with G partitioned, got %v", err)
+	}
+	system.SetPartition("G", false)
+	system.Nodes["D"].IsByzantine = true
+	if _, err := system.CollectQuorum(system.Nodes["A"].GetClockUpdate()); !errors.Is(err, ErrNoAcknowledgements) {
+		t.Errorf("Expected ErrNoAcknowledgements with D refusing, got %v", err)
+	}
+}
+
+// TestVerifyCertificateRejectsTampering tests that forged, duplicated and retargeted certificates are not committed
+func TestVerifyCertificateRejectsTampering(t *testing.T) {
+	system := newGeoSystem(t)
+	update := system.Nodes["A"].GetClockUpdate()
+	cert, err := system.CollectQuorum(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	duplicated := *cert
+	duplicated.Acks = append([]Acknowledgement{}, cert.Acks[:3]...)
+	duplicated.Acks = append(duplicated.Acks, cert.Acks[0])
+	forged := *cert
+	forged.Acks = append([]Acknowledgement{}, cert.Acks...)
+	forged.Acks[1].Signature = cert.Acks[2].Signature
+	retargeted := *cert
+	later := *update
+	later.Timestamp++
+	retargeted.Update = &later
+	short := *cert
+	short.Acks = cert.Acks[:3]
+	short.K = 3
+
+	for name, tampered := range map[string]*QuorumCertificate{
+		"duplicated": &duplicated, "forged": &forged, "retargeted": &retargeted, "short": &short,
+	} {
+		if _, err := system.CommitClockUpdate(tampered); !errors.Is(err, ErrInvalidQuorumCert) {
+			t.Errorf("Expected the %s certificate to be rejected, got %v", name, err)
+		}
+	}
+	if system.Nodes["B"].VectorClock.GetTimestamp("A") != 0 {
+		t.Errorf("Expected no node to apply an update from a rejected certificate")
+	}
+}
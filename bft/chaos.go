@@ -0,0 +1,315 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FaultKind is the kind of an injected fault
+type FaultKind string
+
+const (
+	FaultPartition  FaultKind = "partition"   // Isolate the nodes from the network
+	FaultHeal       FaultKind = "heal"        // Reconnect previously partitioned nodes
+	FaultByzantine  FaultKind = "byzantine"   // Turn the nodes Byzantine
+	FaultCrash      FaultKind = "crash"       // Crash-stop the nodes by fencing them
+	FaultCertExpiry FaultKind = "cert-expiry" // Let the nodes' certificates lapse, renewing them on revert
+)
+
+// FaultStep injects one fault at the start of a round
+type FaultStep struct {
+	At       int
+	Kind     FaultKind
+	Nodes    []string
+	Duration int // Rounds until the fault is reverted, never if zero
+}
+
+// Schedule is an ordered list of fault injections for a chaos run
+type Schedule []FaultStep
+
+// InvariantViolation reports the first round in which an invariant failed
+type InvariantViolation struct {
+	Round int
+	Err   error
+}
+
+func (v *InvariantViolation) Error() string {
+	return fmt.Sprintf("invariant violated in round %d: %v", v.Round, v.Err)
+}
+
+func (v *InvariantViolation) Unwrap() error {
+	return v.Err
+}
+
+// ChaosRun describes a chaos experiment: how to build a fresh system, how
+// many rounds to run, and the invariant and assertions checked after every
+// round. Invariant, if set, is checked as a hard assertion. A failed run's
+// post-mortem is written to PostMortemDir if it is set.
+type ChaosRun struct {
+	Build         func() (*System, error)
+	Rounds        int
+	Invariant     func(system *System) error
+	Assertions    []Assertion
+	PostMortemDir string
+}
+
+// String renders a fault step compactly, e.g. "@2 partition [D E] for 3"
+func (f FaultStep) String() string {
+	s := fmt.Sprintf("@%d %s %v", f.At, f.Kind, f.Nodes)
+	if f.Duration > 0 {
+		s += fmt.Sprintf(" for %d", f.Duration)
+	}
+	return s
+}
+
+// ApplyFault injects the fault a step describes
+func (s *System) ApplyFault(step FaultStep) error {
+	fault, err := NewFault(step)
+	if err != nil {
+		return err
+	}
+	return fault.Apply(s, step.At)
+}
+
+// RevertFault undoes the fault a step injected
+func (s *System) RevertFault(step FaultStep, round int) error {
+	fault, err := NewFault(step)
+	if err != nil {
+		return err
+	}
+	return fault.Revert(s, round)
+}
+
+// Run executes the schedule on a fresh system. In every round expiring faults
+// are reverted, the due faults are injected, each reachable node propagates
+// a clock update to its neighbors, and the assertions are checked. A hard
+// violation is returned as an *InvariantViolation.
+func (c *ChaosRun) Run(schedule Schedule) error {
+	_, err := c.RunReport(schedule)
+	return err
+}
+
+// RunReport runs the schedule like Run and also returns the soft assertion
+// warnings and metrics gathered up to the end of the run or the first hard
+// violation. A run that violates an invariant or loses liveness also gets a
+// post-mortem; the system is traced for it if Build did not attach a trace.
+func (c *ChaosRun) RunReport(schedule Schedule) (*ChaosReport, error) {
+	system, err := c.Build()
+	if err != nil {
+		return nil, err
+	}
+	if system.Trace == nil {
+		system.Trace = NewTrace()
+	}
+	assertions := c.assertions()
+	report := newChaosReport(assertions)
+	recorder := &postMortemRecorder{}
+	ids := make([]string, 0, len(system.Nodes))
+	for id := range system.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for round := 0; round < c.Rounds; round++ {
+		recorder.startRound(system)
+		for _, step := range schedule {
+			if step.Duration > 0 && step.At+step.Duration == round {
+				if err := system.RevertFault(step, round); err != nil {
+					return report, err
+				}
+			}
+		}
+		for _, step := range schedule {
+			if step.At != round {
+				continue
+			}
+			if err := system.ApplyFault(step); err != nil {
+				return report, err
+			}
+		}
+		system.propagateRound(ids)
+		report.Rounds++
+		recorder.endRound(system, round)
+		if err := report.check(system, round, assertions); err != nil {
+			var violation *InvariantViolation
+			if errors.As(err, &violation) {
+				report.PostMortem = recorder.write(system, schedule, report, PostMortemViolation, round, violation.Err.Error())
+				err = c.writePostMortem(report, err)
+			}
+			return report, err
+		}
+	}
+	if since, missed := report.livenessLost(); len(missed) > 0 {
+		report.PostMortem = recorder.write(system, schedule, report, PostMortemLiveness, since, strings.Join(missed, "; "))
+		return report, c.writePostMortem(report, nil)
+	}
+	return report, nil
+}
+
+// writePostMortem writes the report's post-mortem to PostMortemDir, if set,
+// and returns err together with any write error
+func (c *ChaosRun) writePostMortem(report *ChaosReport, err error) error {
+	if c.PostMortemDir == "" {
+		return err
+	}
+	path, writeErr := report.PostMortem.WriteFile(c.PostMortemDir)
+	if writeErr != nil {
+		return errors.Join(err, fmt.Errorf("writing post-mortem: %w", writeErr))
+	}
+	report.PostMortemPath = path
+	return err
+}
+
+// propagateRound has each reachable node, in ids order, propagate a clock
+// update to its neighbors, or with adaptive gossip to the neighbors whose
+// links are due and behind. Under a scheduler the round ends once the last
+// update arrived. With anti-entropy the nodes exchange digests instead.
+func (s *System) propagateRound(ids []string) {
+	if s.AntiEntropy != nil {
+		s.AntiEntropy.round(s, ids)
+		return
+	}
+	var settled time.Duration
+	for _, id := range ids {
+		s.Lock.RLock()
+		node := s.Nodes[id]
+		reachable := s.reachable(node)
+		s.Lock.RUnlock()
+		if !reachable {
+			continue
+		}
+		if s.Gossip == nil {
+			settled = max(settled, node.propagate(node.GetClockUpdate(), s))
+		} else if targets := s.Gossip.due(s, node); len(targets) > 0 {
+			settled = max(settled, node.propagateTo(node.GetClockUpdate(), s, targets))
+		}
+	}
+	s.Gossip.endRound()
+	if s.Scheduler != nil {
+		s.Scheduler.RunUntil(settled)
+	}
+}
+
+// ShrinkResult is a minimized schedule and the number of runs it took
+type ShrinkResult struct {
+	Schedule Schedule
+	Runs     int
+}
+
+// Shrink minimizes a failing schedule for this run. A candidate schedule is
+// kept only if it reproduces the same invariant violation as the original.
+func (c *ChaosRun) Shrink(schedule Schedule) (*ShrinkResult, error) {
+	// Shrinking reruns known failures, which need no post-mortems
+	quiet := *c
+	quiet.PostMortemDir = ""
+	var original *InvariantViolation
+	if err := quiet.Run(schedule); !errors.As(err, &original) {
+		return nil, fmt.Errorf("schedule does not violate the invariant: %v", err)
+	}
+	reproduces := func(candidate Schedule) bool {
+		var violation *InvariantViolation
+		err := quiet.Run(candidate)
+		return errors.As(err, &violation) && violation.Err.Error() == original.Err.Error()
+	}
+	return ShrinkSchedule(schedule, reproduces), nil
+}
+
+// ShrinkSchedule reduces a schedule to a locally minimal one for which
+// reproduces still holds. It alternates delta debugging over whole steps
+// with simplification of the remaining steps (fewer nodes, earlier rounds)
+// until neither makes progress.
+func ShrinkSchedule(schedule Schedule, reproduces func(Schedule) bool) *ShrinkResult {
+	result := &ShrinkResult{}
+	check := func(candidate Schedule) bool {
+		result.Runs++
+		return reproduces(candidate)
+	}
+
+	current := cloneSchedule(schedule)
+	for {
+		reduced := ddmin(current, check)
+		simplified := simplifySteps(reduced, check)
+		if scheduleEqual(simplified, current) {
+			break
+		}
+		current = simplified
+	}
+	result.Schedule = current
+	return result
+}
+
+// ddmin removes chunks of steps, halving the chunk size when nothing can be removed
+func ddmin(schedule Schedule, check func(Schedule) bool) Schedule {
+	chunk := len(schedule) / 2
+	for chunk >= 1 && len(schedule) > 1 {
+		removed := false
+		for start := 0; start < len(schedule); start += chunk {
+			end := start + chunk
+			if end > len(schedule) {
+				end = len(schedule)
+			}
+			candidate := append(cloneSchedule(schedule[:start]), schedule[end:]...)
+			if len(candidate) > 0 && check(candidate) {
+				schedule = candidate
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			chunk /= 2
+		} else if chunk > len(schedule)/2 {
+			chunk = len(schedule) / 2
+		}
+	}
+	return schedule
+}
+
+// simplifySteps tries to drop nodes from each step and move it to round zero
+func simplifySteps(schedule Schedule, check func(Schedule) bool) Schedule {
+	schedule = cloneSchedule(schedule)
+	for i := range schedule {
+		for j := 0; j < len(schedule[i].Nodes) && len(schedule[i].Nodes) > 1; {
+			candidate := cloneSchedule(schedule)
+			nodes := candidate[i].Nodes
+			candidate[i].Nodes = append(append([]string{}, nodes[:j]...), nodes[j+1:]...)
+			if check(candidate) {
+				schedule = candidate
+			} else {
+				j++
+			}
+		}
+		for at := 0; at < schedule[i].At; at++ {
+			candidate := cloneSchedule(schedule)
+			candidate[i].At = at
+			if check(candidate) {
+				schedule = candidate
+				break
+			}
+		}
+	}
+	return schedule
+}
+
+func cloneSchedule(schedule Schedule) Schedule {
+	clone := make(Schedule, len(schedule))
+	for i, step := range schedule {
+		clone[i] = step
+		clone[i].Nodes = append([]string(nil), step.Nodes...)
+	}
+	return clone
+}
+
+func scheduleEqual(a, b Schedule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// leaderReachable is an invariant requiring the leader to stay connected
+func leaderReachable(system *System) error {
+	leader := system.GetLeader()
+	if system.IsPartitioned(leader) {
+		return fmt.Errorf("leader %s is partitioned", leader)
+	}
+	return nil
+}
+
+// newChaosRun builds a chaos run over a fully connected five-node cluster
+func newChaosRun() *ChaosRun {
+	return &ChaosRun{
+		Rounds:    6,
+		Invariant: leaderReachable,
+		Build: func() (*System, error) {
+			system := NewSystem()
+			ids := []string{"A", "B", "C", "D", "E"}
+			for _, id := range ids {
+				node, err := NewNode(id, false, false)
+				if err != nil {
+					return nil, err
+				}
+				for _, peer := range ids {
+					if peer != id {
+						node.Neighbors = append(node.Neighbors, peer)
+					}
+				}
+				system.AddNode(node)
+			}
+			system.SetLeader("A")
+			return system, nil
+		},
+	}
+}
+
+// TestChaosRunDetectsViolation tests that invariant violations are reported with their round
+func TestChaosRunDetectsViolation(t *testing.T) {
+	run := newChaosRun()
+	if err := run.Run(Schedule{{At: 1, Kind: FaultPartition, Nodes: []string{"B"}}}); err != nil {
+		t.Errorf("Expected partitioning a follower to be harmless, got %v", err)
+	}
+
+	err := run.Run(Schedule{{At: 3, Kind: FaultPartition, Nodes: []string{"A"}}})
+	var violation *InvariantViolation
+	if !errors.As(err, &violation) || violation.Round != 3 {
+		t.Errorf("Expected violation in round 3, got %v", err)
+	}
+}
+
+// TestShrinkChaosSchedule tests that noisy failing schedules shrink to the essential fault
+func TestShrinkChaosSchedule(t *testing.T) {
+	run := newChaosRun()
+	schedule := Schedule{
+		{At: 0, Kind: FaultPartition, Nodes: []string{"C"}},
+		{At: 1, Kind: FaultByzantine, Nodes: []string{"E"}},
+		{At: 2, Kind: FaultHeal, Nodes: []string{"C"}},
+		{At: 3, Kind: FaultPartition, Nodes: []string{"D", "A", "B"}},
+		{At: 4, Kind: FaultHeal, Nodes: []string{"D"}},
+		{At: 5, Kind: FaultByzantine, Nodes: []string{"B"}},
+	}
+
+	result, err := run.Shrink(schedule)
+	if err != nil {
+		t.Fatalf("Shrink failed: %v", err)
+	}
+	if len(result.Schedule) != 1 {
+		t.Fatalf("Expected a single-step schedule, got %v", result.Schedule)
+	}
+	step := result.Schedule[0]
+	if step.Kind != FaultPartition || len(step.Nodes) != 1 || step.Nodes[0] != "A" || step.At != 0 {
+		t.Errorf("Expected minimal step @0 partition [A], got %v", step)
+	}
+	if result.Runs == 0 {
+		t.Errorf("Expected shrinking to re-run the schedule")
+	}
+	if len(schedule[3].Nodes) != 3 {
+		t.Errorf("Expected the original schedule to be left untouched")
+	}
+}
+
+// TestShrinkRequiresFailingSchedule tests that passing schedules are not shrunk
+func TestShrinkRequiresFailingSchedule(t *testing.T) {
+	run := newChaosRun()
+	if _, err := run.Shrink(Schedule{{At: 0, Kind: FaultHeal, Nodes: []string{"B"}}}); err == nil {
+		t.Errorf("Expected an error for a schedule that does not fail")
+	}
+}
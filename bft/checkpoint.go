@@ -0,0 +1,314 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft/clock"
+)
+
+// Checkpoints and branching futures.
+//
+// A simulation advances in rounds of virtual time. A scenario can label the
+// current round as a checkpoint, which snapshots the whole system, and later
+// branch from it: every future starts from its own copy of the snapshot,
+// applies its own decisions (heal the partition or not, fail another node)
+// and runs on. The futures' outcomes are measured the same way and reported
+// side by side.
+
+var ErrUnknownCheckpoint = errors.New("unknown checkpoint")
+
+// Clone returns a deep copy of the system. Keys, capabilities, clocks, hooks
+// and the scheduler are shared, so a future continues in the same virtual
+// time; node state, network state, history and trace are copied, and a
+// congestion model starts over with empty queues.
+// Packet capture, audit export and logging stay with the original, so a
+// hypothetical future does not report events that never happened.
+func (s *System) Clone() *System {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	clone := &System{
+		Nodes:          make(map[string]*Node, len(s.Nodes)),
+		Leader:         s.Leader,
+		View:           s.View,
+		Partition:      make(map[string]bool, len(s.Partition)),
+		Latencies:      make(map[[2]string]time.Duration, len(s.Latencies)),
+		RegionAffinity: s.RegionAffinity,
+		QueueDelay:     s.QueueDelay,
+		OnFailure:      s.OnFailure,
+		Scheduler:      s.Scheduler,
+		Congestion:     s.Congestion.clone(),
+		CA:             s.CA.clone(),
+		Gossip:         s.Gossip.clone(),
+		Keys:           s.Keys.clone(),
+		AntiEntropy:    s.AntiEntropy.clone(),
+		Payloads:       s.Payloads,
+	}
+	for id, node := range s.Nodes {
+		clone.Nodes[id] = node.clone()
+		if node.Registry != nil {
+			clone.Nodes[id].Registry = clone.Keys
+		}
+	}
+	for id, isolated := range s.Partition {
+		clone.Partition[id] = isolated
+	}
+	for namespace, engine := range s.Engines {
+		if clone.Engines == nil {
+			clone.Engines = make(map[string]ConsensusEngine, len(s.Engines))
+		}
+		// Engines are bound to their system, the clone gets fresh ones
+		clone.Engines[namespace], _ = NewEngine(engine.Name(), clone)
+	}
+	if s.Severed != nil {
+		clone.Severed = make(map[Link]bool, len(s.Severed))
+		for link, severed := range s.Severed {
+			clone.Severed[link] = severed
+		}
+	}
+	if s.LinkProfiles != nil {
+		clone.LinkProfiles = make(map[[2]string]LinkProfile, len(s.LinkProfiles))
+		for direction, profile := range s.LinkProfiles {
+			clone.LinkProfiles[direction] = profile
+		}
+	}
+	for pair, latency := range s.Latencies {
+		clone.Latencies[pair] = latency
+	}
+	if s.Fenced != nil {
+		clone.Fenced = make(map[string]*NodeFailure, len(s.Fenced))
+		for id, failure := range s.Fenced {
+			clone.Fenced[id] = failure
+		}
+	}
+	if s.handshakes != nil {
+		clone.handshakes = make(map[[2]string]handshakeResult, len(s.handshakes))
+		for pair, result := range s.handshakes {
+			clone.handshakes[pair] = result
+		}
+	}
+	if s.Faults != nil {
+		faults := *s.Faults
+		clone.Faults = &faults
+	}
+	if s.History != nil {
+		clone.History = s.History.Clone()
+	}
+	if s.Trace != nil {
+		clone.Trace = s.Trace.Clone()
+	}
+	return clone
+}
+
+// clone returns a deep copy of a node's mutable state
+func (n *Node) clone() *Node {
+	n.Lock.RLock()
+	defer n.Lock.RUnlock()
+	clone := &Node{
+		ID:           n.ID,
+		Name:         n.Name,
+		PrivateKey:   n.PrivateKey,
+		PublicKey:    n.PublicKey,
+		IsByzantine:  n.IsByzantine,
+		Strategy:     n.Strategy,
+		IsIsolated:   n.IsIsolated,
+		Standby:      n.Standby,
+		Region:       n.Region,
+		Neighbors:    append([]string(nil), n.Neighbors...),
+		Store:        NewStore(),
+		Sessions:     n.Sessions.clone(),
+		Certs:        n.Certs.clone(),
+		Clock:        n.Clock,
+		SimClock:     n.SimClock,
+		Certificate:  n.Certificate,
+		Capabilities: n.Capabilities,
+		Reconnect:    n.Reconnect,
+		Payloads:     n.Payloads,
+		sent:         n.sent,
+	}
+	if n.updates != nil {
+		clone.updates = make(map[string]*ClockUpdate, len(n.updates))
+		for id, update := range n.updates {
+			clone.updates[id] = update
+		}
+	}
+	if n.seen != nil {
+		clone.seen = make(map[string]uint64, len(n.seen))
+		for id, seq := range n.seen {
+			clone.seen[id] = seq
+		}
+	}
+	if n.peers != nil {
+		clone.peers = make(map[string]*PeerHealth, len(n.peers))
+		for id, health := range n.peers {
+			copied := *health
+			clone.peers[id] = &copied
+		}
+	}
+	switch c := n.VectorClock.(type) {
+	case *clock.VectorClock:
+		clone.VectorClock = c.Clone()
+	case *clock.HLC:
+		hlc := c.Clone()
+		hlc.Physical = clone.wallClock
+		clone.VectorClock = hlc
+	default:
+		clone.VectorClock = clock.NewVectorClock()
+	}
+	if n.Store != nil {
+		for key, entry := range n.Store.Entries {
+			clone.Store.Entries[key] = entry
+		}
+		clone.Store.CommitIndex = n.Store.CommitIndex
+		clone.Store.Namespaces = maps.Clone(n.Store.Namespaces)
+	}
+	return clone
+}
+
+// Checkpoint is a labelled snapshot of a simulation at a round
+type Checkpoint struct {
+	Label  string
+	Round  int
+	system *System
+}
+
+// Simulation advances a system in rounds and can branch from checkpoints
+type Simulation struct {
+	System  *System
+	Round   int
+	Step    func(system *System, round int) // Runs one round, propagateRound if nil
+	Measure func(system *System) map[string]float64
+	saved   map[string]*Checkpoint
+}
+
+// NewSimulation wraps a system for round-based execution
+func NewSimulation(system *System) *Simulation {
+	return &Simulation{System: system, Measure: MeasureConvergence, saved: make(map[string]*Checkpoint)}
+}
+
+// Advance runs the given number of rounds
+func (sim *Simulation) Advance(rounds int) {
+	for i := 0; i < rounds; i++ {
+		if sim.Step != nil {
+			sim.Step(sim.System, sim.Round)
+		} else {
+			sim.System.propagateRound(sortedKeys(sim.System.Nodes))
+		}
+		sim.Round++
+	}
+}
+
+// Checkpoint labels the current round and snapshots the system
+func (sim *Simulation) Checkpoint(label string) *Checkpoint {
+	checkpoint := &Checkpoint{Label: label, Round: sim.Round, system: sim.System.Clone()}
+	sim.saved[label] = checkpoint
+	return checkpoint
+}
+
+// fork starts a new simulation from a checkpoint
+func (sim *Simulation) fork(checkpoint *Checkpoint) *Simulation {
+	return &Simulation{
+		System:  checkpoint.system.Clone(),
+		Round:   checkpoint.Round,
+		Step:    sim.Step,
+		Measure: sim.Measure,
+		saved:   make(map[string]*Checkpoint),
+	}
+}
+
+// Outcome is the measured end state of one future
+type Outcome struct {
+	Future  string
+	Round   int
+	Results map[string]float64
+}
+
+// BranchReport compares the futures branched from one checkpoint
+type BranchReport struct {
+	Checkpoint string
+	Round      int
+	Outcomes   []Outcome
+}
+
+// Branch runs every future from the labelled checkpoint, in name order, each
+// on its own copy of the snapshot. The simulation itself is left untouched.
+func (sim *Simulation) Branch(label string, futures map[string]func(future *Simulation)) (*BranchReport, error) {
+	checkpoint, exists := sim.saved[label]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCheckpoint, label)
+	}
+	names := make([]string, 0, len(futures))
+	for name := range futures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &BranchReport{Checkpoint: label, Round: checkpoint.Round}
+	for _, name := range names {
+		future := sim.fork(checkpoint)
+		futures[name](future)
+		report.Outcomes = append(report.Outcomes, Outcome{
+			Future:  name,
+			Round:   future.Round,
+			Results: future.Measure(future.System),
+		})
+	}
+	return report, nil
+}
+
+// MeasureConvergence reports how far the nodes' state has converged
+func MeasureConvergence(system *System) map[string]float64 {
+	system.Lock.RLock()
+	defer system.Lock.RUnlock()
+	results := map[string]float64{}
+	var minIndex, maxIndex int64 = -1, 0
+	for _, node := range system.Nodes {
+		node.Lock.RLock()
+		if system.reachable(node) {
+			results["reachable_nodes"]++
+		}
+		results["clock_entries"] += float64(node.VectorClock.Len())
+		index := node.Store.CommitIndex
+		node.Lock.RUnlock()
+		if minIndex < 0 || index < minIndex {
+			minIndex = index
+		}
+		if index > maxIndex {
+			maxIndex = index
+		}
+	}
+	results["commit_index_spread"] = float64(maxIndex - minIndex)
+	return results
+}
+
+// String renders the outcomes as a table with one column per future
+func (r *BranchReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Futures from checkpoint %q (round %d):\n", r.Checkpoint, r.Round)
+	keys := make(map[string]bool)
+	for _, outcome := range r.Outcomes {
+		for key := range outcome.Results {
+			keys[key] = true
+		}
+	}
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprint(w, "METRIC")
+	for _, outcome := range r.Outcomes {
+		fmt.Fprintf(w, "\t%s", outcome.Future)
+	}
+	fmt.Fprintln(w)
+	for _, key := range sortedKeys(keys) {
+		fmt.Fprint(w, key)
+		for _, outcome := range r.Outcomes {
+			fmt.Fprintf(w, "\t%g", outcome.Results[key])
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package bft
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestSystemClone tests that a clone shares no mutable state with the original
+func TestSystemClone(t *testing.T) {
+	system := newGeoSystem(t)
+	system.History = NewHistory()
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	clone := system.Clone()
+
+	if _, err := clone.SubmitWrite("us-east", "A", "x", "2"); err != nil {
+		t.Fatal(err)
+	}
+	clone.SetPartition("D", true)
+	clone.Nodes["B"].VectorClock.Update("A", 42)
+
+	if system.Nodes["A"].Store.Entries["x"].Value != "1" || system.Nodes["A"].Store.CommitIndex != 1 {
+		t.Errorf("Expected the original store to be unchanged")
+	}
+	if system.IsPartitioned("D") || system.Nodes["B"].VectorClock.GetTimestamp("A") != 0 {
+		t.Errorf("Expected the original network and clocks to be unchanged")
+	}
+	if len(system.History.Snapshot()) != 1 || len(clone.History.Snapshot()) != 2 {
+		t.Errorf("Expected histories to diverge after cloning")
+	}
+}
+
+// TestBranchFutures tests that futures start from the same checkpoint
+func TestBranchFutures(t *testing.T) {
+	system, err := newChaosRun().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	system.SetPartition("E", true)
+	sim := NewSimulation(system)
+	sim.Advance(2)
+	sim.Checkpoint("split")
+	sim.Advance(5)
+
+	report, err := sim.Branch("split", map[string]func(*Simulation){
+		"heal": func(future *Simulation) {
+			future.System.SetPartition("E", false)
+			future.Advance(1)
+		},
+		"stay": func(future *Simulation) {
+			future.Advance(1)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Round != 2 || len(report.Outcomes) != 2 || report.Outcomes[0].Future != "heal" {
+		t.Fatalf("Expected two futures from round 2 in name order, got %+v", report)
+	}
+	heal, stay := report.Outcomes[0], report.Outcomes[1]
+	if heal.Round != 3 || stay.Round != 3 {
+		t.Errorf("Expected each future to run one round from the checkpoint, got %d and %d", heal.Round, stay.Round)
+	}
+	if heal.Results["reachable_nodes"] != 5 || stay.Results["reachable_nodes"] != 4 {
+		t.Errorf("Expected healing to reconnect E, got %v and %v", heal.Results, stay.Results)
+	}
+	if heal.Results["clock_entries"] <= stay.Results["clock_entries"] {
+		t.Errorf("Expected the healed future to spread more clock entries")
+	}
+	if sim.Round != 7 || !sim.System.IsPartitioned("E") {
+		t.Errorf("Expected branching to leave the main simulation untouched")
+	}
+	if !strings.Contains(report.String(), "heal") || !strings.Contains(report.String(), "reachable_nodes") {
+		t.Errorf("Expected the report to list futures and metrics, got %s", report)
+	}
+
+	if _, err := sim.Branch("missing", nil); !errors.Is(err, ErrUnknownCheckpoint) {
+		t.Errorf("Expected ErrUnknownCheckpoint, got %v", err)
+	}
+}
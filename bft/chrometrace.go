@@ -0,0 +1,125 @@
+package bft
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Chrome trace export.
+//
+// WriteChromeTrace turns a trace into the Trace Event Format read by
+// chrome://tracing and Perfetto, so the interleaving of a run's messages
+// can be looked at on a timeline instead of read from a log. Every node is
+// a thread of its own, with its sends, receives, applies, commits and view
+// changes as zero-length slices at their time in the run, virtual under a
+// scheduler. Events of no particular node, such as invariant violations,
+// go to a thread named system. A flow arrow joins every send to the
+// receive it caused: clock updates are paired by the update they carry,
+// consensus messages in order of sending per link and phase.
+
+// chromeSystemThread is the thread of events of no particular node
+const chromeSystemThread = "system"
+
+// chromeEvent is an event of the Trace Event Format
+type chromeEvent struct {
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Phase string                 `json:"ph"`
+	Ts    float64                `json:"ts"`            // Microseconds
+	Dur   *float64               `json:"dur,omitempty"` // Of complete events
+	Pid   int                    `json:"pid"`
+	Tid   int                    `json:"tid"`
+	ID    int                    `json:"id,omitempty"` // Of flow events
+	Bind  string                 `json:"bp,omitempty"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+// chromeMicros converts a trace time to Trace Event Format microseconds
+func chromeMicros(at time.Duration) float64 {
+	return float64(at) / float64(time.Microsecond)
+}
+
+// chromeThread returns the thread an event goes to
+func chromeThread(event TraceEvent) string {
+	if event.Node == "" {
+		return chromeSystemThread
+	}
+	return event.Node
+}
+
+// chromeLink identifies the messages a send and its receive pair up on
+func chromeLink(from, to string, event TraceEvent) string {
+	if event.Update != nil {
+		return fmt.Sprintf("%s>%s clock %s/%d/%d", from, to, event.Update.NodeID, event.Update.Seq, event.Update.Timestamp)
+	}
+	return fmt.Sprintf("%s>%s %s", from, to, event.Detail)
+}
+
+// WriteChromeTrace writes the retained events of the trace as a Chrome
+// trace, with one thread per node and flow arrows from sends to receives
+func (tr *Trace) WriteChromeTrace(w io.Writer) error {
+	events := tr.Snapshot()
+
+	threads := make(map[string]int)
+	for _, event := range events {
+		threads[chromeThread(event)] = 0
+	}
+	names := sortedKeys(threads)
+	for i, name := range names {
+		threads[name] = i + 1
+	}
+
+	out := []chromeEvent{{Name: "process_name", Phase: "M", Pid: 1, Args: map[string]interface{}{"name": "wahello"}}}
+	for _, name := range names {
+		out = append(out, chromeEvent{Name: "thread_name", Phase: "M", Pid: 1, Tid: threads[name], Args: map[string]interface{}{"name": name}})
+		out = append(out, chromeEvent{Name: "thread_sort_index", Phase: "M", Pid: 1, Tid: threads[name], Args: map[string]interface{}{"sort_index": threads[name]}})
+	}
+
+	var zero float64
+	in := make(map[string][]int) // Flow IDs of unreceived sends by link
+	flows := 0
+	for _, event := range events {
+		name := string(event.Type)
+		if event.Detail != "" && event.Type != EventViolation && event.Type != EventWarning {
+			name += " " + event.Detail
+		}
+		args := map[string]interface{}{"seq": event.Seq, "view": event.View}
+		if event.Peer != "" {
+			args["peer"] = event.Peer
+		}
+		if event.Detail != "" {
+			args["detail"] = event.Detail
+		}
+		if event.Update != nil {
+			args["update"] = event.Update
+		}
+		ts := chromeMicros(event.At)
+		out = append(out, chromeEvent{Name: name, Cat: string(event.Type), Phase: "X", Ts: ts, Dur: &zero, Pid: 1, Tid: threads[chromeThread(event)], Args: args})
+
+		switch {
+		case event.Peer == "":
+		case event.Type == EventSend:
+			flows++
+			link := chromeLink(event.Node, event.Peer, event)
+			in[link] = append(in[link], flows)
+			out = append(out, chromeEvent{Name: "message", Cat: "message", Phase: "s", Ts: ts, Pid: 1, Tid: threads[chromeThread(event)], ID: flows})
+		case event.Type == EventReceive:
+			link := chromeLink(event.Peer, event.Node, event)
+			if len(in[link]) == 0 {
+				continue
+			}
+			id := in[link][0]
+			in[link] = in[link][1:]
+			out = append(out, chromeEvent{Name: "message", Cat: "message", Phase: "f", Bind: "e", Ts: ts, Pid: 1, Tid: threads[chromeThread(event)], ID: id})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{out, "ms"})
+}
@@ -0,0 +1,111 @@
+package bft
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// decodeChromeTrace writes a trace in Chrome format and decodes its events
+func decodeChromeTrace(t *testing.T, trace *Trace) []chromeEvent {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := trace.WriteChromeTrace(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &file); err != nil {
+		t.Fatalf("Chrome trace is not valid JSON: %v", err)
+	}
+	return file.TraceEvents
+}
+
+// TestChromeTraceOfPBFTViewChange tests that a PBFT run with a view change
+// exports its messages, commits and view change, every receive joined to
+// an earlier send
+func TestChromeTraceOfPBFTViewChange(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.System.Trace = NewTrace()
+	pbft.System.Trace.Now = pbft.Scheduler.Elapsed()
+	if _, err := pbft.Submit([]byte("w1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pbft.Run(); err != nil {
+		t.Fatal(err)
+	}
+	pbft.KillPrimary()
+	if _, err := pbft.Submit([]byte("w2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pbft.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := decodeChromeTrace(t, pbft.System.Trace)
+	threads := make(map[string]int)
+	categories := make(map[string]int)
+	starts := make(map[int]chromeEvent)
+	flows := 0
+	for _, event := range events {
+		switch event.Phase {
+		case "M":
+			if event.Name == "thread_name" {
+				threads[event.Args["name"].(string)] = event.Tid
+			}
+		case "X":
+			categories[event.Cat]++
+		case "s":
+			starts[event.ID] = event
+		case "f":
+			start, exists := starts[event.ID]
+			if !exists || start.Ts > event.Ts || start.Tid == event.Tid {
+				t.Fatalf("Flow %d ends at %v on thread %d without an earlier send on another thread: %+v", event.ID, event.Ts, event.Tid, start)
+			}
+			flows++
+		}
+	}
+	for _, id := range []string{"A", "B", "C", "D"} {
+		if threads[id] == 0 {
+			t.Errorf("Expected a thread for node %s, got %v", id, threads)
+		}
+	}
+	if categories[string(EventCommit)] == 0 || categories[string(EventViewChange)] == 0 {
+		t.Errorf("Expected commits and a view change, got %v", categories)
+	}
+	if flows == 0 || flows != categories[string(EventReceive)] {
+		t.Errorf("Expected a flow into each of the %d receives, got %d", categories[string(EventReceive)], flows)
+	}
+}
+
+// TestChromeTracePairsClockUpdates tests that clock updates on the same link
+// are joined to the receive of the same update even when they arrive out of
+// order, and that events of no node go to the system thread
+func TestChromeTracePairsClockUpdates(t *testing.T) {
+	trace := NewTrace()
+	first := &ClockUpdate{NodeID: "A", Timestamp: 1, Seq: 1}
+	second := &ClockUpdate{NodeID: "A", Timestamp: 2, Seq: 2}
+	trace.Record(TraceEvent{At: time.Millisecond, Type: EventSend, Node: "A", Peer: "B", Update: first})
+	trace.Record(TraceEvent{At: 2 * time.Millisecond, Type: EventSend, Node: "A", Peer: "B", Update: second})
+	trace.Record(TraceEvent{At: 3 * time.Millisecond, Type: EventReceive, Node: "B", Peer: "A", Update: second})
+	trace.Record(TraceEvent{At: 4 * time.Millisecond, Type: EventReceive, Node: "B", Peer: "A", Update: first})
+	trace.Record(TraceEvent{At: 5 * time.Millisecond, Type: EventViolation, Detail: "diverged"})
+
+	flows := make(map[int][]float64)
+	var system int
+	for _, event := range decodeChromeTrace(t, trace) {
+		switch {
+		case event.Phase == "s" || event.Phase == "f":
+			flows[event.ID] = append(flows[event.ID], event.Ts)
+		case event.Phase == "M" && event.Name == "thread_name" && event.Args["name"] == chromeSystemThread:
+			system = event.Tid
+		case event.Phase == "X" && event.Cat == string(EventViolation) && event.Tid != system:
+			t.Errorf("Expected the violation on the system thread %d, got thread %d", system, event.Tid)
+		}
+	}
+	if len(flows) != 2 || len(flows[1]) != 2 || flows[1][0] != 1000 || flows[1][1] != 4000 || flows[2][1] != 3000 {
+		t.Errorf("Expected the first update to flow from 1ms to 4ms and the second from 2ms to 3ms, got %v", flows)
+	}
+}
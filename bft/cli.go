@@ -0,0 +1,347 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Experiment subcommands.
+//
+// The run, check, bench and keys subcommands share ExperimentFlags, so one
+// experiment can be simulated, checked, timed and given keys with the same
+// arguments. The cluster comes from -scenario, or is generated with -nodes
+// and -topology, or is the built-in partition scenario. -byzantine then
+// makes that many nodes Byzantine, counting back from the last one and
+// skipping the leader, and the rest honest; -1 keeps the scenario's own.
+// -format picks text for people or JSON for scripts.
+
+var (
+	ErrUnknownOutputFormat = errors.New("unknown output format")
+	ErrCheckFailed         = errors.New("scenario check failed")
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ExperimentFlags select the cluster an experiment runs on and how its
+// results are printed
+type ExperimentFlags struct {
+	Scenario  string
+	Topology  string
+	Nodes     int
+	Byzantine int
+	Strategy  string
+	Seed      int64
+	Format    string
+}
+
+// Register defines the flags on flags
+func (e *ExperimentFlags) Register(flags *flag.FlagSet) {
+	flags.StringVar(&e.Scenario, "scenario", "", "JSON or YAML file with the cluster to simulate; the built-in partition scenario if empty")
+	flags.StringVar(&e.Topology, "topology", "complete", fmt.Sprintf("generator of the -nodes cluster, one of %v", Topologies()))
+	flags.IntVar(&e.Nodes, "nodes", 0, "generate a cluster of this many nodes instead of loading one")
+	flags.IntVar(&e.Byzantine, "byzantine", -1, "number of Byzantine nodes; the scenario's own if negative")
+	flags.StringVar(&e.Strategy, "strategy", "timestamp-inflation", fmt.Sprintf("strategy of the -byzantine nodes, one of %v", StrategyNames))
+	flags.Int64Var(&e.Seed, "seed", 0, "seed of the simulation, for replaying a run; random if 0")
+	flags.StringVar(&e.Format, "format", FormatText, "output format: text or json")
+}
+
+// Prepare checks the flags, draws a seed if none was given and returns the
+// scenario they select
+func (e *ExperimentFlags) Prepare() (*ScenarioSpec, error) {
+	if e.Format != FormatText && e.Format != FormatJSON {
+		return nil, fmt.Errorf("%w %q, want %q or %q", ErrUnknownOutputFormat, e.Format, FormatText, FormatJSON)
+	}
+	if e.Seed == 0 {
+		e.Seed = time.Now().UnixNano()
+	}
+	var sc *ScenarioSpec
+	var err error
+	switch {
+	case e.Scenario != "" && e.Nodes > 0:
+		return nil, fmt.Errorf("%w: -scenario and -nodes both pick the cluster", ErrInvalidScenario)
+	case e.Scenario != "":
+		sc, err = LoadScenario(e.Scenario)
+	case e.Nodes > 0:
+		sc, err = GenerateTopology(e.Topology, TopologyParams{Nodes: e.Nodes, Density: 0.2, Seed: e.Seed})
+	default:
+		sc = DefaultScenario()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if e.Byzantine >= 0 {
+		if err := sc.SetByzantine(e.Byzantine, e.Strategy); err != nil {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// SetByzantine makes count nodes Byzantine with the given strategy,
+// counting back from the last node and skipping the leader, and the rest
+// honest
+func (sc *ScenarioSpec) SetByzantine(count int, strategy string) error {
+	if count > len(sc.Nodes)-1 {
+		return fmt.Errorf("%w: %d Byzantine nodes leave no honest leader among %d", ErrInvalidScenario, count, len(sc.Nodes))
+	}
+	if _, err := NewStrategy(strategy, 0); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidScenario, err)
+	}
+	for i := range sc.Nodes {
+		sc.Nodes[i].Byzantine, sc.Nodes[i].Strategy = false, ""
+	}
+	for i := len(sc.Nodes) - 1; i >= 0 && count > 0; i-- {
+		if sc.Nodes[i].ID != sc.Leader {
+			sc.Nodes[i].Byzantine, sc.Nodes[i].Strategy = true, strategy
+			count--
+		}
+	}
+	return sc.Validate()
+}
+
+// byzantineIDs returns the IDs of the scenario's Byzantine nodes
+func (sc *ScenarioSpec) byzantineIDs() []string {
+	var ids []string
+	for _, node := range sc.Nodes {
+		if node.Byzantine {
+			ids = append(ids, node.ID)
+		}
+	}
+	return ids
+}
+
+// printJSON writes v to w as indented JSON
+func printJSON(w io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// WriteRunJSON writes a simulation's results as JSON, what `wahello run
+// -format json` prints instead of the narrative, with the expectations the
+// run missed if any
+func WriteRunJSON(w io.Writer, scenario *ScenarioSpec, seed int64, results map[string]float64, mismatches []ExpectationMismatch) error {
+	return printJSON(w, struct {
+		Scenario   string                `json:"scenario"`
+		Nodes      int                   `json:"nodes"`
+		Seed       int64                 `json:"seed"`
+		Results    map[string]float64    `json:"results"`
+		Mismatches []ExpectationMismatch `json:"mismatches,omitempty"`
+	}{scenario.Name, len(scenario.Nodes), seed, results, mismatches})
+}
+
+// CheckReport is what the scenario's cluster can tolerate
+type CheckReport struct {
+	Scenario  string        `json:"scenario"`
+	Nodes     int           `json:"nodes"`
+	Byzantine []string      `json:"byzantine"`
+	Health    *QuorumHealth `json:"health"`
+	Formable  int           `json:"formable_quorums"`
+	Problems  []string      `json:"problems,omitempty"`
+	geometry  *QuorumGeometry
+}
+
+// OK reports whether the check found no problem
+func (r *CheckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// String renders the report for people
+func (r *CheckReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Scenario %s: %d nodes, %d Byzantine %v\n", r.Scenario, r.Nodes, len(r.Byzantine), r.Byzantine)
+	fmt.Fprintf(&b, "Tolerates f=%d with quorums of %d, %d voters reachable\n", r.Health.F, r.Health.Quorum, r.Health.Reachable)
+	b.WriteString(r.geometry.String())
+	for _, problem := range r.Problems {
+		fmt.Fprintf(&b, "Problem: %s\n", problem)
+	}
+	if r.OK() {
+		b.WriteString("OK\n")
+	}
+	return b.String()
+}
+
+// CheckScenario builds the scenario and checks that it tolerates its
+// Byzantine nodes, n >= 3f+1, and can form a quorum
+func CheckScenario(sc *ScenarioSpec, seed int64) (*CheckReport, error) {
+	system := NewSystem()
+	if err := sc.Build(system, seed); err != nil {
+		return nil, err
+	}
+	report := &CheckReport{Scenario: sc.Name, Nodes: len(sc.Nodes), Byzantine: sc.byzantineIDs(), Health: system.QuorumHealth()}
+	report.geometry = AnalyzeQuorums(system, -1)
+	report.Formable = report.geometry.FormableCount
+	if len(report.Byzantine) > report.Health.F {
+		report.Problems = append(report.Problems, fmt.Sprintf("%d Byzantine nodes exceed f=%d; %d nodes tolerate at most %d",
+			len(report.Byzantine), report.Health.F, report.Nodes, (report.Nodes-1)/3))
+	}
+	if report.Health.Lost() {
+		report.Problems = append(report.Problems, fmt.Sprintf("only %d voters reachable, a quorum needs %d", report.Health.Reachable, report.Health.Quorum))
+	}
+	if report.Formable == 0 {
+		report.Problems = append(report.Problems, "the topology leaves no quorum of connected nodes")
+	}
+	return report, nil
+}
+
+// BenchReport is how fast the simulation propagated clock updates
+type BenchReport struct {
+	Scenario        string        `json:"scenario"`
+	Nodes           int           `json:"nodes"`
+	Byzantine       []string      `json:"byzantine"`
+	Elapsed         time.Duration `json:"elapsed_ns"`
+	Rounds          int           `json:"rounds"`
+	RoundsPerSecond float64       `json:"rounds_per_second"`
+	Sent            int           `json:"updates_sent"`
+	Bytes           int64         `json:"bytes_on_wire"`
+	Detections      int           `json:"detections"`
+	Caught          []string      `json:"caught"` // Byzantine nodes detected at least once
+	Usage           ResourceUsage `json:"usage"`
+}
+
+// String renders the report for people
+func (r *BenchReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Scenario %s: %d nodes, %d Byzantine %v\n", r.Scenario, r.Nodes, len(r.Byzantine), r.Byzantine)
+	fmt.Fprintf(&b, "%d gossip rounds in %v, %.1f rounds/s\n", r.Rounds, r.Elapsed.Round(time.Millisecond), r.RoundsPerSecond)
+	fmt.Fprintf(&b, "%d clock updates sent, %d bytes on the wire, %d detections, caught %v\n", r.Sent, r.Bytes, r.Detections, r.Caught)
+	fmt.Fprintf(&b, "%v CPU, %d MiB peak RSS\n", r.Usage.CPUTime.Round(time.Millisecond), r.Usage.PeakRSS>>20)
+	return b.String()
+}
+
+// RunBench propagates clock updates round after round for duration of wall
+// time and measures the throughput
+func RunBench(sc *ScenarioSpec, seed int64, duration time.Duration) (*BenchReport, error) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	system := NewSystem()
+	system.Metrics = NewMetrics()
+	if err := sc.Build(system, seed); err != nil {
+		return nil, err
+	}
+	ids := sortedKeys(system.Nodes)
+	report := &BenchReport{Scenario: sc.Name, Nodes: len(sc.Nodes), Byzantine: sc.byzantineIDs()}
+	started := time.Now()
+	report.Usage = MeasureResources(func() {
+		for report.Rounds == 0 || time.Since(started) < duration {
+			system.propagateRound(ids)
+			report.Rounds++
+		}
+	})
+	report.Elapsed = time.Since(started)
+	report.RoundsPerSecond = float64(report.Rounds) / report.Elapsed.Seconds()
+	report.Sent = int(system.Metrics.Count(metricSent.name, "clock-update"))
+	report.Bytes = int64(system.Metrics.Count(metricBytes.name, "clock-update"))
+	for _, id := range ids {
+		if count := int(system.Metrics.Count(metricDetections.name, id)); count > 0 {
+			report.Detections += count
+			report.Caught = append(report.Caught, id)
+		}
+	}
+	return report, nil
+}
+
+// CheckCommand implements `wahello check [experiment flags]`, failing if the
+// cluster cannot tolerate its Byzantine nodes or form a quorum
+func CheckCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	var experiment ExperimentFlags
+	experiment.Register(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sc, err := experiment.Prepare()
+	if err != nil {
+		return err
+	}
+	report, err := CheckScenario(sc, experiment.Seed)
+	if err != nil {
+		return err
+	}
+	if experiment.Format == FormatJSON {
+		err = printJSON(stdout, report)
+	} else {
+		_, err = io.WriteString(stdout, report.String())
+	}
+	if err == nil && !report.OK() {
+		err = fmt.Errorf("%w: %s", ErrCheckFailed, strings.Join(report.Problems, "; "))
+	}
+	return err
+}
+
+// BenchCommand implements `wahello bench [-duration d] [experiment flags]`
+func BenchCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	var experiment ExperimentFlags
+	experiment.Register(flags)
+	duration := flags.Duration("duration", 2*time.Second, "how long to propagate clock updates")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sc, err := experiment.Prepare()
+	if err != nil {
+		return err
+	}
+	report, err := RunBench(sc, experiment.Seed, *duration)
+	if err != nil {
+		return err
+	}
+	if experiment.Format == FormatJSON {
+		return printJSON(stdout, report)
+	}
+	_, err = io.WriteString(stdout, report.String())
+	return err
+}
+
+// KeysCommand implements `wahello keys [-dir dir] [-scheme name]
+// [experiment flags]`, generating a key pair for every node of the cluster
+// in the layout of GenerateKeys
+func KeysCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("keys", flag.ContinueOnError)
+	var experiment ExperimentFlags
+	experiment.Register(flags)
+	dir := flags.String("dir", "keys", "directory to write the keys to")
+	scheme := flags.String("scheme", string(crypto.SchemeECDSA), "signature scheme: ecdsa or ed25519")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	parsed, err := crypto.ParseSignatureScheme(*scheme)
+	if err != nil {
+		return err
+	}
+	sc, err := experiment.Prepare()
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(sc.Nodes))
+	for i, node := range sc.Nodes {
+		ids[i] = node.ID
+	}
+	if err := GenerateKeys(*dir, ids, parsed); err != nil {
+		return err
+	}
+	if experiment.Format == FormatJSON {
+		return printJSON(stdout, struct {
+			Dir    string   `json:"dir"`
+			Scheme string   `json:"scheme"`
+			Nodes  []string `json:"nodes"`
+		}{*dir, string(parsed), ids})
+	}
+	_, err = fmt.Fprintf(stdout, "Generated %s keys for %s in %s\n", parsed, strings.Join(ids, ","), *dir)
+	return err
+}
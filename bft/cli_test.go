@@ -0,0 +1,107 @@
+package bft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestExperimentFlags tests that the flags generate a cluster and pick its Byzantine nodes
+func TestExperimentFlags(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var experiment ExperimentFlags
+	experiment.Register(flags)
+	if err := flags.Parse([]string{"-nodes", "7", "-byzantine", "2", "-seed", "5"}); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := experiment.Prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Name != "complete-7" || len(sc.Links) != 21 {
+		t.Errorf("Expected a complete graph of 7 nodes, got %s with %d links", sc.Name, len(sc.Links))
+	}
+	if ids := sc.byzantineIDs(); len(ids) != 2 || ids[0] != "N6" || ids[1] != "N7" {
+		t.Errorf("Expected N6 and N7 Byzantine, got %v", ids)
+	}
+
+	// The default scenario keeps its own Byzantine node unless told otherwise
+	experiment = ExperimentFlags{Byzantine: -1, Format: FormatText}
+	if sc, err = experiment.Prepare(); err != nil || len(sc.byzantineIDs()) != 1 || experiment.Seed == 0 {
+		t.Errorf("Expected the default scenario with a drawn seed, got %v, %d", err, experiment.Seed)
+	}
+	experiment = ExperimentFlags{Nodes: 4, Topology: "complete", Byzantine: 4, Strategy: "equivocation", Format: FormatText}
+	if _, err := experiment.Prepare(); !errors.Is(err, ErrInvalidScenario) {
+		t.Errorf("Expected a Byzantine leader to be refused, got %v", err)
+	}
+	experiment = ExperimentFlags{Byzantine: -1, Format: "xml"}
+	if _, err := experiment.Prepare(); !errors.Is(err, ErrUnknownOutputFormat) {
+		t.Errorf("Expected an unknown format to be refused, got %v", err)
+	}
+}
+
+// TestCheckCommand tests that check passes within f and fails beyond it
+func TestCheckCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := CheckCommand([]string{"-nodes", "7", "-byzantine", "2"}, &out); err != nil {
+		t.Fatalf("Expected 2 of 7 Byzantine to pass, got %v\n%s", err, out.String())
+	}
+	out.Reset()
+	err := CheckCommand([]string{"-nodes", "7", "-byzantine", "3", "-format", "json"}, &out)
+	if !errors.Is(err, ErrCheckFailed) {
+		t.Fatalf("Expected 3 of 7 Byzantine to fail, got %v", err)
+	}
+	var report CheckReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Health.F != 2 || len(report.Byzantine) != 3 || len(report.Problems) != 1 {
+		t.Errorf("Expected f=2, 3 Byzantine and one problem, got %+v", report)
+	}
+}
+
+// TestBenchCatchesByzantine tests that a benchmark runs rounds and catches the Byzantine nodes
+func TestBenchCatchesByzantine(t *testing.T) {
+	sc, err := GenerateTopology("complete", TopologyParams{Nodes: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.SetByzantine(1, "timestamp-inflation"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := RunBench(sc, 1, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Rounds == 0 || report.Sent == 0 || report.RoundsPerSecond <= 0 {
+		t.Errorf("Expected rounds and updates, got %+v", report)
+	}
+	if len(report.Caught) != 1 || report.Caught[0] != "N4" {
+		t.Errorf("Expected N4 caught, got %v", report.Caught)
+	}
+}
+
+// TestKeysCommand tests that generated keys load back for every node
+func TestKeysCommand(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	if err := KeysCommand([]string{"-dir", dir, "-nodes", "4", "-scheme", "ed25519"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"N1", "N2", "N3", "N4"} {
+		keys, err := LoadNodeKeys(filepath.Join(dir, "keys", id))
+		if err != nil || keys[id] == nil {
+			t.Errorf("Expected %s's keys, got %v", id, err)
+		}
+	}
+	public, err := LoadKeys(filepath.Join(dir, "public"))
+	if err != nil || len(public) != 4 {
+		t.Errorf("Expected 4 public keys, got %d, %v", len(public), err)
+	}
+}
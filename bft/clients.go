@@ -0,0 +1,321 @@
+package bft
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Byzantine clients.
+//
+// Replicas admit client requests only after checking them, and every check
+// depends solely on the request and on replicated state, so all correct
+// replicas reach the same verdict with the same reason. A request carries a
+// client-chosen ID: retrying an ID with the same payload is a harmless
+// duplicate, but reusing it for a different payload is rejected. A request
+// may also carry a commit proof, the leader's signature binding an earlier
+// commit to its request; a proof presented with any other request is a
+// replay and is rejected.
+
+// MaxValueSize is the largest value a write may carry
+const MaxValueSize = 4096
+
+var (
+	ErrMalformedRequest   = errors.New("malformed request")
+	ErrConflictingRetry   = errors.New("request ID reused with a different payload")
+	ErrReplayedProof      = errors.New("commit proof does not match request")
+	ErrInvalidCommitProof = errors.New("commit proof signature invalid")
+)
+
+// RequestPayload is the decoded operation a client request carries
+type RequestPayload struct {
+	Kind  OpKind `json:"kind"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// CommitProof is the leader's signed statement that a request was committed
+type CommitProof struct {
+	Leader    string `json:"leader"`
+	Index     int64  `json:"index"`
+	Digest    string `json:"digest"` // Request digest the proof covers
+	Signature string `json:"signature"`
+}
+
+// ClientRequest is a request as it arrives at a replica
+type ClientRequest struct {
+	Client    string
+	RequestID uint64
+	Payload   []byte
+	Proof     *CommitProof
+}
+
+// Digest identifies the request's client, ID and payload
+func (r *ClientRequest) Digest() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%x", r.Client, r.RequestID, sha256.Sum256(r.Payload))))
+	return hex.EncodeToString(sum[:])
+}
+
+// DecodePayload parses a payload strictly: unknown fields, trailing data,
+// unknown kinds, empty keys and oversized values are all malformed
+func DecodePayload(data []byte) (*RequestPayload, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var payload RequestPayload
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("%w: bad encoding", ErrMalformedRequest)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: trailing data", ErrMalformedRequest)
+	}
+	switch {
+	case payload.Kind != OpRead && payload.Kind != OpWrite:
+		return nil, fmt.Errorf("%w: unknown kind", ErrMalformedRequest)
+	case payload.Key == "":
+		return nil, fmt.Errorf("%w: empty key", ErrMalformedRequest)
+	case len(payload.Value) > MaxValueSize:
+		return nil, fmt.Errorf("%w: value too large", ErrMalformedRequest)
+	case payload.Kind == OpRead && payload.Value != "":
+		return nil, fmt.Errorf("%w: read with value", ErrMalformedRequest)
+	}
+	return &payload, nil
+}
+
+// Verdict is a replica's decision on a request
+type Verdict string
+
+const (
+	VerdictAccepted  Verdict = "accepted"
+	VerdictDuplicate Verdict = "duplicate"
+	VerdictRejected  Verdict = "rejected"
+)
+
+// Admission is a verdict and, for rejections, the reason
+type Admission struct {
+	Verdict Verdict
+	Reason  string
+}
+
+// SessionTable remembers the requests a replica has admitted per client
+type SessionTable struct {
+	requests map[string]map[uint64]string // Client -> request ID -> digest
+}
+
+// NewSessionTable creates an empty session table
+func NewSessionTable() *SessionTable {
+	return &SessionTable{requests: make(map[string]map[uint64]string)}
+}
+
+// clone returns an independent copy of the table
+func (t *SessionTable) clone() *SessionTable {
+	clone := NewSessionTable()
+	if t == nil {
+		return clone
+	}
+	for client, ids := range t.requests {
+		clone.requests[client] = make(map[uint64]string, len(ids))
+		for id, digest := range ids {
+			clone.requests[client][id] = digest
+		}
+	}
+	return clone
+}
+
+// reject builds a rejection whose reason is the same on every replica
+func reject(err error) Admission {
+	return Admission{Verdict: VerdictRejected, Reason: err.Error()}
+}
+
+// Admit checks a request at a replica. verifyProof checks a proof's
+// signature against the leader's key.
+func (t *SessionTable) Admit(req *ClientRequest, verifyProof func(*CommitProof) error) Admission {
+	if req.Client == "" || req.RequestID == 0 {
+		return reject(fmt.Errorf("%w: missing client or request ID", ErrMalformedRequest))
+	}
+	if _, err := DecodePayload(req.Payload); err != nil {
+		return reject(err)
+	}
+	digest := req.Digest()
+	if req.Proof != nil {
+		if req.Proof.Digest != digest {
+			return reject(ErrReplayedProof)
+		}
+		if err := verifyProof(req.Proof); err != nil {
+			return reject(ErrInvalidCommitProof)
+		}
+	}
+	seen, exists := t.requests[req.Client][req.RequestID]
+	switch {
+	case exists && seen != digest:
+		return reject(ErrConflictingRetry)
+	case exists:
+		return Admission{Verdict: VerdictDuplicate}
+	}
+	if t.requests[req.Client] == nil {
+		t.requests[req.Client] = make(map[uint64]string)
+	}
+	t.requests[req.Client][req.RequestID] = digest
+	return Admission{Verdict: VerdictAccepted}
+}
+
+// proofDigest is what the leader signs in a commit proof
+func proofDigest(proof *CommitProof) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("proof:%s:%d:%s", proof.Leader, proof.Index, proof.Digest)))
+	return sum[:]
+}
+
+// IssueCommitProof has the leader sign a proof that req committed at index
+func (s *System) IssueCommitProof(req *ClientRequest, index int64) (*CommitProof, error) {
+	s.Lock.RLock()
+	leader, exists := s.Nodes[s.Leader]
+	s.Lock.RUnlock()
+	if !exists {
+		return nil, ErrNoLeader
+	}
+	proof := &CommitProof{Leader: leader.ID, Index: index, Digest: req.Digest()}
+	signature, err := crypto.Sign(leader.PrivateKey, proofDigest(proof))
+	if err != nil {
+		return nil, err
+	}
+	proof.Signature = signature
+	return proof, nil
+}
+
+// verifyCommitProof checks a proof against the named leader's public key
+func (s *System) verifyCommitProof(proof *CommitProof) error {
+	s.Lock.RLock()
+	leader, exists := s.Nodes[proof.Leader]
+	s.Lock.RUnlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownNode, proof.Leader)
+	}
+	return crypto.Verify(leader.PublicKey, proofDigest(proof), proof.Signature)
+}
+
+// AdmitRequest delivers a request, in consensus order, to every replica and
+// returns each replica's admission
+func (s *System) AdmitRequest(req *ClientRequest) map[string]Admission {
+	s.Lock.RLock()
+	ids := sortedKeys(s.Nodes)
+	s.Lock.RUnlock()
+	admissions := make(map[string]Admission, len(ids))
+	for _, id := range ids {
+		node := s.Nodes[id]
+		node.Lock.Lock()
+		admissions[id] = node.Sessions.Admit(req, s.verifyCommitProof)
+		node.Lock.Unlock()
+	}
+	return admissions
+}
+
+// MaliciousProfile is a misbehaving client strategy
+type MaliciousProfile string
+
+const (
+	ProfileMalformed          MaliciousProfile = "malformed"
+	ProfileContradictoryRetry MaliciousProfile = "contradictory-retry"
+	ProfileReplayedProof      MaliciousProfile = "replayed-proof"
+)
+
+// AttackReport summarizes how replicas handled a malicious client
+type AttackReport struct {
+	Profile   MaliciousProfile
+	Requests  int
+	Malicious int
+	Rejected  int      // Malicious requests rejected by every replica
+	Divergent []uint64 // Request IDs on which replicas disagreed
+	Reasons   map[string]int
+}
+
+// payload encodes a well-formed operation
+func payload(kind OpKind, key, value string) []byte {
+	data, _ := json.Marshal(RequestPayload{Kind: kind, Key: key, Value: value})
+	return data
+}
+
+// RunMaliciousClient runs an honest client interleaved with attacks from
+// profile against a four-node cluster and reports the replicas' verdicts
+func RunMaliciousClient(profile MaliciousProfile, seed int64) (*AttackReport, error) {
+	system := NewSystem()
+	for _, id := range []string{"A", "B", "C", "D"} {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			return nil, err
+		}
+		system.AddNode(node)
+	}
+	system.SetLeader("A")
+
+	rng := rand.New(rand.NewSource(seed))
+	report := &AttackReport{Profile: profile, Reasons: make(map[string]int)}
+	malformed := [][]byte{
+		[]byte(`{"kind":"write","key":"x"`),
+		[]byte(`{"kind":"delete","key":"x"}`),
+		[]byte(`{"kind":"write","key":""}`),
+		[]byte(`{"kind":"write","key":"x","value":"1","admin":true}`),
+		[]byte(`{"kind":"write","key":"x","value":"1"} {"kind":"write","key":"y"}`),
+		[]byte(`{"kind":"read","key":"x","value":"1"}`),
+		payload(OpWrite, "x", string(make([]byte, MaxValueSize+1))),
+	}
+
+	var proofs []*CommitProof
+	deliver := func(req *ClientRequest, malicious bool) {
+		report.Requests++
+		admissions := system.AdmitRequest(req)
+		first := admissions["A"]
+		for _, admission := range admissions {
+			if admission != first {
+				report.Divergent = append(report.Divergent, req.RequestID)
+				return
+			}
+		}
+		if first.Verdict == VerdictAccepted {
+			if proof, err := system.IssueCommitProof(req, int64(report.Requests)); err == nil {
+				proofs = append(proofs, proof)
+			}
+		}
+		if malicious {
+			report.Malicious++
+			if first.Verdict == VerdictRejected {
+				report.Rejected++
+				report.Reasons[first.Reason]++
+			}
+		}
+	}
+
+	var id uint64
+	for round := 0; round < 20; round++ {
+		id++
+		honest := &ClientRequest{Client: "honest", RequestID: id, Payload: payload(OpWrite, fmt.Sprintf("k%d", round), "v")}
+		deliver(honest, false)
+
+		switch profile {
+		case ProfileMalformed:
+			id++
+			deliver(&ClientRequest{Client: "mallory", RequestID: id, Payload: malformed[rng.Intn(len(malformed))]}, true)
+		case ProfileContradictoryRetry:
+			id++
+			original := &ClientRequest{Client: "mallory", RequestID: id, Payload: payload(OpWrite, "x", "1")}
+			deliver(original, false)
+			deliver(&ClientRequest{Client: "mallory", RequestID: id, Payload: payload(OpWrite, "x", fmt.Sprint(rng.Intn(1000)+2))}, true)
+		case ProfileReplayedProof:
+			if len(proofs) > 0 {
+				id++
+				stolen := proofs[rng.Intn(len(proofs))]
+				deliver(&ClientRequest{Client: "mallory", RequestID: id, Payload: payload(OpWrite, "x", "1"), Proof: stolen}, true)
+			}
+		default:
+			return nil, fmt.Errorf("unknown client profile %q", profile)
+		}
+	}
+	sort.Slice(report.Divergent, func(i, j int) bool { return report.Divergent[i] < report.Divergent[j] })
+	return report, nil
+}
@@ -0,0 +1,96 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDecodePayload tests strict payload validation
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		data  string
+		valid bool
+	}{
+		{`{"kind":"write","key":"x","value":"1"}`, true},
+		{`{"kind":"read","key":"x"}`, true},
+		{`{"kind":"write","key":"x"`, false},
+		{`{"kind":"delete","key":"x"}`, false},
+		{`{"kind":"write","key":""}`, false},
+		{`{"kind":"write","key":"x","extra":1}`, false},
+		{`{"kind":"write","key":"x"} []`, false},
+		{`{"kind":"read","key":"x","value":"1"}`, false},
+	}
+	for _, tt := range tests {
+		_, err := DecodePayload([]byte(tt.data))
+		if tt.valid && err != nil {
+			t.Errorf("%s: Expected valid payload, got %v", tt.data, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrMalformedRequest) {
+			t.Errorf("%s: Expected ErrMalformedRequest, got %v", tt.data, err)
+		}
+	}
+}
+
+// TestSessionTableRetries tests duplicate and contradictory retries
+func TestSessionTableRetries(t *testing.T) {
+	table := NewSessionTable()
+	noProof := func(*CommitProof) error { return nil }
+	req := &ClientRequest{Client: "c", RequestID: 1, Payload: payload(OpWrite, "x", "1")}
+
+	if got := table.Admit(req, noProof); got.Verdict != VerdictAccepted {
+		t.Errorf("Expected first request to be accepted, got %+v", got)
+	}
+	if got := table.Admit(req, noProof); got.Verdict != VerdictDuplicate {
+		t.Errorf("Expected identical retry to be a duplicate, got %+v", got)
+	}
+	conflicting := &ClientRequest{Client: "c", RequestID: 1, Payload: payload(OpWrite, "x", "2")}
+	if got := table.Admit(conflicting, noProof); got.Verdict != VerdictRejected || got.Reason != ErrConflictingRetry.Error() {
+		t.Errorf("Expected contradictory retry to be rejected, got %+v", got)
+	}
+}
+
+// TestMaliciousClientProfiles tests that every attack is rejected identically by all replicas
+func TestMaliciousClientProfiles(t *testing.T) {
+	for _, profile := range []MaliciousProfile{ProfileMalformed, ProfileContradictoryRetry, ProfileReplayedProof} {
+		report, err := RunMaliciousClient(profile, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Divergent) != 0 {
+			t.Errorf("%s: Expected replicas to agree, diverged on %v", profile, report.Divergent)
+		}
+		if report.Malicious == 0 || report.Rejected != report.Malicious {
+			t.Errorf("%s: Expected all %d malicious requests rejected, got %d", profile, report.Malicious, report.Rejected)
+		}
+	}
+	report, _ := RunMaliciousClient(ProfileReplayedProof, 1)
+	if report.Reasons[ErrReplayedProof.Error()] != report.Rejected {
+		t.Errorf("Expected replayed proofs to be rejected as replays, got %v", report.Reasons)
+	}
+}
+
+// TestCommitProofForgery tests that a proof rebound to a new request fails verification
+func TestCommitProofForgery(t *testing.T) {
+	system := newGeoSystem(t)
+	req := &ClientRequest{Client: "c", RequestID: 7, Payload: payload(OpWrite, "x", "1")}
+	proof, err := system.IssueCommitProof(req, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admissions := system.AdmitRequest(&ClientRequest{Client: "c", RequestID: 7, Payload: req.Payload, Proof: proof})
+	for id, admission := range admissions {
+		if admission.Verdict != VerdictAccepted {
+			t.Errorf("Expected %s to accept a genuine proof, got %+v", id, admission)
+		}
+	}
+
+	forged := *proof
+	other := &ClientRequest{Client: "c", RequestID: 8, Payload: payload(OpWrite, "x", "9")}
+	forged.Digest = other.Digest()
+	other.Proof = &forged
+	for id, admission := range system.AdmitRequest(other) {
+		if admission.Reason != ErrInvalidCommitProof.Error() {
+			t.Errorf("Expected %s to reject a rebound proof, got %+v", id, admission)
+		}
+	}
+}
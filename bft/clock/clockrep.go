@@ -0,0 +1,295 @@
+package clock
+
+import (
+	"fmt"
+)
+
+// Vector clock representations.
+//
+// A map is the obvious representation and the cheapest to update, but
+// merging or comparing two clocks hashes every entry of both. With
+// thousands of entries the alternatives win: a sorted slice merges and
+// compares with a single linear walk over both clocks; a sparse clock does
+// the same over node IDs interned as int32 by a shared ClockIndex, so it
+// compares integers instead of strings and stores 12 bytes an entry instead
+// of a string header and a map slot; and a dense array indexed by slot
+// reduces merge and compare to a loop over two int64 slices, at the cost
+// of a slot for every interned node whether the clock has seen it or not.
+// Which one a clock uses is chosen at runtime (DefaultClockRepresentation,
+// or the -clock flag); all four behave identically and encode to the same
+// string-keyed wire format. A timestamp of zero is the same as no entry.
+
+// ClockOrdering is how two vector clocks relate
+type ClockOrdering int
+
+const (
+	ClockBefore     ClockOrdering = -1 // Every entry is at most the other's, and one is lower
+	ClockEqual      ClockOrdering = 0
+	ClockAfter      ClockOrdering = 1 // Every entry is at least the other's, and one is higher
+	ClockConcurrent ClockOrdering = 2 // Each clock has an entry higher than the other's
+)
+
+func (o ClockOrdering) String() string {
+	switch o {
+	case ClockBefore:
+		return "before"
+	case ClockEqual:
+		return "equal"
+	case ClockAfter:
+		return "after"
+	default:
+		return "concurrent"
+	}
+}
+
+// clockOrdering combines whether any entry was lower and any was higher
+func clockOrdering(less, greater bool) ClockOrdering {
+	switch {
+	case less && greater:
+		return ClockConcurrent
+	case less:
+		return ClockBefore
+	case greater:
+		return ClockAfter
+	}
+	return ClockEqual
+}
+
+// ClockRepresentation selects how a vector clock stores its entries
+type ClockRepresentation string
+
+const (
+	ClockMap    ClockRepresentation = "map"
+	ClockSorted ClockRepresentation = "sorted"
+	ClockSparse ClockRepresentation = "sparse"
+	ClockDense  ClockRepresentation = "dense"
+)
+
+// DefaultClockRepresentation is used by NewVectorClock
+var DefaultClockRepresentation = ClockMap
+
+// ParseClockRepresentation checks a representation name
+func ParseClockRepresentation(name string) (ClockRepresentation, error) {
+	switch rep := ClockRepresentation(name); rep {
+	case ClockMap, ClockSorted, ClockSparse, ClockDense:
+		return rep, nil
+	}
+	return "", fmt.Errorf("unknown clock representation %q, want %q, %q, %q or %q", name, ClockMap, ClockSorted, ClockSparse, ClockDense)
+}
+
+// clockVector is the storage behind a VectorClock
+type clockVector interface {
+	get(id string) int64
+	set(id string, ts int64)
+	each(fn func(id string, ts int64)) // In no particular order, skipping zeros
+	len() int
+	merge(other clockVector) // Element-wise maximum
+	compare(other clockVector) ClockOrdering
+	clone() clockVector
+	empty() clockVector // Same representation and index, no entries
+	rep() ClockRepresentation
+}
+
+// newClockVector creates empty storage of the given representation,
+// interning node IDs in index if it uses one
+func newClockVector(rep ClockRepresentation, index *ClockIndex) clockVector {
+	switch rep {
+	case ClockSorted:
+		return &sortedClock{}
+	case ClockSparse:
+		return &sparseClock{index: index}
+	case ClockDense:
+		return &denseClock{index: index}
+	default:
+		return mapClock{}
+	}
+}
+
+// mergeGeneric merges clocks of different representations entry by entry
+func mergeGeneric(into, other clockVector) {
+	other.each(func(id string, ts int64) {
+		if ts > into.get(id) {
+			into.set(id, ts)
+		}
+	})
+}
+
+// compareGeneric compares clocks of different representations entry by entry
+func compareGeneric(a, b clockVector) ClockOrdering {
+	var less, greater bool
+	a.each(func(id string, ts int64) {
+		if other := b.get(id); ts < other {
+			less = true
+		} else if ts > other {
+			greater = true
+		}
+	})
+	b.each(func(id string, ts int64) {
+		if a.get(id) < ts {
+			less = true
+		}
+	})
+	return clockOrdering(less, greater)
+}
+
+// mapClock stores entries in a map
+type mapClock map[string]int64
+
+func (c mapClock) get(id string) int64 { return c[id] }
+
+func (c mapClock) set(id string, ts int64) {
+	if ts == 0 {
+		delete(c, id)
+		return
+	}
+	c[id] = ts
+}
+
+func (c mapClock) each(fn func(id string, ts int64)) {
+	for id, ts := range c {
+		fn(id, ts)
+	}
+}
+
+func (c mapClock) len() int { return len(c) }
+
+func (c mapClock) merge(other clockVector) {
+	o, ok := other.(mapClock)
+	if !ok {
+		mergeGeneric(c, other)
+		return
+	}
+	for id, ts := range o {
+		if ts > c[id] {
+			c[id] = ts
+		}
+	}
+}
+
+func (c mapClock) compare(other clockVector) ClockOrdering {
+	o, ok := other.(mapClock)
+	if !ok {
+		return compareGeneric(c, other)
+	}
+	var less, greater bool
+	for id, ts := range c {
+		if theirs := o[id]; ts < theirs {
+			less = true
+		} else if ts > theirs {
+			greater = true
+		}
+	}
+	for id, ts := range o {
+		if _, exists := c[id]; !exists && ts > 0 {
+			less = true
+		}
+	}
+	return clockOrdering(less, greater)
+}
+
+func (c mapClock) empty() clockVector { return mapClock{} }
+
+func (c mapClock) rep() ClockRepresentation { return ClockMap }
+
+func (c mapClock) clone() clockVector {
+	clone := make(mapClock, len(c))
+	for id, ts := range c {
+		clone[id] = ts
+	}
+	return clone
+}
+
+// denseClock stores entries in an array indexed by ClockIndex slot
+type denseClock struct {
+	index *ClockIndex
+	ts    []int64
+	count int // Nonzero entries
+}
+
+func (c *denseClock) get(id string) int64 {
+	if slot, exists := c.index.Lookup(id); exists && int(slot) < len(c.ts) {
+		return c.ts[slot]
+	}
+	return 0
+}
+
+func (c *denseClock) set(id string, ts int64) {
+	if ts == 0 {
+		if slot, exists := c.index.Lookup(id); exists && int(slot) < len(c.ts) && c.ts[slot] != 0 {
+			c.ts[slot] = 0
+			c.count--
+		}
+		return
+	}
+	slot := int(c.index.Intern(id))
+	c.grow(slot + 1)
+	if c.ts[slot] == 0 {
+		c.count++
+	}
+	c.ts[slot] = ts
+}
+
+// grow extends the array to n slots
+func (c *denseClock) grow(n int) {
+	if n > len(c.ts) {
+		c.ts = append(c.ts, make([]int64, n-len(c.ts))...)
+	}
+}
+
+func (c *denseClock) each(fn func(id string, ts int64)) {
+	for slot, ts := range c.ts {
+		if ts != 0 {
+			fn(c.index.Name(int32(slot)), ts)
+		}
+	}
+}
+
+func (c *denseClock) len() int { return c.count }
+
+func (c *denseClock) merge(other clockVector) {
+	o, ok := other.(*denseClock)
+	if !ok || o.index != c.index {
+		mergeGeneric(c, other)
+		return
+	}
+	c.grow(len(o.ts))
+	for slot, ts := range o.ts {
+		if ts > c.ts[slot] {
+			if c.ts[slot] == 0 {
+				c.count++
+			}
+			c.ts[slot] = ts
+		}
+	}
+}
+
+func (c *denseClock) compare(other clockVector) ClockOrdering {
+	o, ok := other.(*denseClock)
+	if !ok || o.index != c.index {
+		return compareGeneric(c, other)
+	}
+	var less, greater bool
+	n := min(len(c.ts), len(o.ts))
+	for slot := 0; slot < n; slot++ {
+		if c.ts[slot] < o.ts[slot] {
+			less = true
+		} else if c.ts[slot] > o.ts[slot] {
+			greater = true
+		}
+	}
+	for _, ts := range c.ts[n:] {
+		greater = greater || ts != 0
+	}
+	for _, ts := range o.ts[n:] {
+		less = less || ts != 0
+	}
+	return clockOrdering(less, greater)
+}
+
+func (c *denseClock) empty() clockVector { return &denseClock{index: c.index} }
+
+func (c *denseClock) rep() ClockRepresentation { return ClockDense }
+
+func (c *denseClock) clone() clockVector {
+	return &denseClock{index: c.index, ts: append([]int64(nil), c.ts...), count: c.count}
+}
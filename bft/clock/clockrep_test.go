@@ -0,0 +1,240 @@
+package clock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+var clockReps = []ClockRepresentation{ClockMap, ClockSorted, ClockSparse, ClockDense}
+
+// TestClockOrderings tests before, after, equal and concurrent in every representation
+func TestClockOrderings(t *testing.T) {
+	for _, rep := range clockReps {
+		a, b := NewVectorClockWith(rep), NewVectorClockWith(rep)
+		a.Update("A", 1)
+		b.Update("A", 1)
+		if got := a.Compare(b); got != ClockEqual {
+			t.Errorf("%s: expected equal clocks, got %s", rep, got)
+		}
+		b.Update("B", 2)
+		if got := a.Compare(b); got != ClockBefore {
+			t.Errorf("%s: expected a missing entry to order a before b, got %s", rep, got)
+		}
+		if got := b.Compare(a); got != ClockAfter {
+			t.Errorf("%s: expected b after a, got %s", rep, got)
+		}
+		a.Update("C", 1)
+		if got := a.Compare(b); got != ClockConcurrent {
+			t.Errorf("%s: expected concurrent clocks, got %s", rep, got)
+		}
+		a.Merge(b)
+		if got := a.Compare(b); got != ClockAfter || a.Len() != 3 {
+			t.Errorf("%s: expected the merge to dominate b with 3 entries, got %s with %d", rep, got, a.Len())
+		}
+		a.Update("C", 0)
+		if got := a.Compare(b); got != ClockEqual || a.Len() != 2 {
+			t.Errorf("%s: expected a zero timestamp to remove the entry, got %s with %d", rep, got, a.Len())
+		}
+	}
+}
+
+// TestClockRepsAgree tests that random operations give the same results in
+// every representation, including between representations
+func TestClockRepsAgree(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	clocks := make(map[ClockRepresentation][2]*VectorClock)
+	for _, rep := range clockReps {
+		clocks[rep] = [2]*VectorClock{NewVectorClockWith(rep), NewVectorClockWith(rep)}
+	}
+	for op := 0; op < 2000; op++ {
+		which, id, ts := rng.Intn(2), fmt.Sprintf("n%d", rng.Intn(50)), rng.Int63n(20)
+		merge, compare := rng.Intn(20) == 0, rng.Intn(5) == 0
+		var orderings []ClockOrdering
+		for _, rep := range clockReps {
+			pair := clocks[rep]
+			switch {
+			case merge:
+				pair[which].Merge(pair[1-which])
+			default:
+				pair[which].Update(id, ts)
+			}
+			if compare {
+				orderings = append(orderings, pair[0].Compare(pair[1]))
+			}
+		}
+		for _, ordering := range orderings {
+			if ordering != orderings[0] {
+				t.Fatalf("Op %d: representations disagree: %v", op, orderings)
+			}
+		}
+	}
+
+	expected := clocks[ClockMap][0].Timestamps()
+	for _, rep := range clockReps {
+		if got := clocks[rep][0].Timestamps(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", rep, expected, got)
+		}
+		if got := clocks[rep][0].Compare(clocks[ClockMap][0]); got != ClockEqual {
+			t.Errorf("%s: expected equal to the map clock across representations, got %s", rep, got)
+		}
+	}
+	mixed := NewVectorClockWith(ClockSorted)
+	mixed.Merge(clocks[ClockDense][1])
+	if !reflect.DeepEqual(mixed.Timestamps(), clocks[ClockMap][1].Timestamps()) {
+		t.Error("Expected a merge across representations to copy every entry")
+	}
+}
+
+// TestClockClone tests that clones keep the representation and are independent
+func TestClockClone(t *testing.T) {
+	for _, rep := range clockReps {
+		clock := NewVectorClockWith(rep)
+		clock.Update("A", 1)
+		clone := clock.Clone()
+		clone.Update("A", 2)
+		if clock.GetTimestamp("A") != 1 || reflect.TypeOf(clone.entries) != reflect.TypeOf(clock.entries) {
+			t.Errorf("%s: expected an independent clone of the same representation", rep)
+		}
+	}
+}
+
+// TestClockWireFormat tests that every representation encodes to the same
+// string-keyed JSON and decodes back into its own representation
+func TestClockWireFormat(t *testing.T) {
+	const wire = `{"A":3,"B":1}`
+	for _, rep := range clockReps {
+		clock := FromTimestamps(rep, map[string]int64{"B": 1, "A": 3})
+		data, err := json.Marshal(clock)
+		if err != nil || string(data) != wire {
+			t.Errorf("%s: expected %s, got %s, %v", rep, wire, data, err)
+		}
+		decoded := NewVectorClockWith(rep)
+		decoded.Update("C", 9)
+		if err := json.Unmarshal(data, decoded); err != nil || decoded.Representation() != rep || decoded.Compare(clock) != ClockEqual {
+			t.Errorf("%s: expected the decoded clock to replace its entries, got %v, %v", rep, decoded.Timestamps(), err)
+		}
+	}
+	var zero VectorClock
+	if err := json.Unmarshal([]byte(wire), &zero); err != nil || zero.GetTimestamp("A") != 3 || zero.Representation() != DefaultClockRepresentation {
+		t.Errorf("Expected a zero clock to decode with the default representation, got %v", err)
+	}
+}
+
+// TestClockConvert tests migrating a clock between representations
+func TestClockConvert(t *testing.T) {
+	clock := FromTimestamps(ClockMap, map[string]int64{"A": 1, "B": 2})
+	for _, rep := range clockReps {
+		converted := clock.Convert(rep)
+		if converted.Representation() != rep || !reflect.DeepEqual(converted.Timestamps(), clock.Timestamps()) {
+			t.Errorf("Expected a %s copy of %v, got %s %v", rep, clock.Timestamps(), converted.Representation(), converted.Timestamps())
+		}
+	}
+}
+
+// TestClockIndex tests that interning is stable and that sparse clocks on
+// separate indexes still compare by node ID
+func TestClockIndex(t *testing.T) {
+	index := NewClockIndex()
+	if index.Intern("B") != 0 || index.Intern("A") != 1 || index.Intern("B") != 0 || index.Name(1) != "A" || index.Len() != 2 {
+		t.Error("Expected slots in first-seen order")
+	}
+	if _, exists := index.Lookup("C"); exists {
+		t.Error("Expected lookup not to intern")
+	}
+
+	a := NewVectorClockIndexed(ClockSparse, index)
+	b := NewVectorClockIndexed(ClockSparse, NewClockIndex())
+	a.Update("A", 1)
+	a.Update("B", 2)
+	b.Update("B", 2)
+	b.Update("A", 1)
+	if got := a.Compare(b); got != ClockEqual {
+		t.Errorf("Expected clocks on different indexes to be equal, got %s", got)
+	}
+	b.Merge(FromTimestamps(ClockSparse, map[string]int64{"C": 1}))
+	if got := a.Compare(b); got != ClockBefore {
+		t.Errorf("Expected a before b after the merge, got %s", got)
+	}
+}
+
+// TestParseClockRepresentation tests that unknown representations are rejected
+func TestParseClockRepresentation(t *testing.T) {
+	if rep, err := ParseClockRepresentation("dense"); err != nil || rep != ClockDense {
+		t.Errorf("Expected dense, got %q, %v", rep, err)
+	}
+	if _, err := ParseClockRepresentation("tree"); err == nil {
+		t.Error("Expected an error for an unknown representation")
+	}
+}
+
+// clockBenchEntries is the clock size the benchmarks run at
+const clockBenchEntries = 10000
+
+// benchClocks builds two clocks of clockBenchEntries entries, b lagging a
+// on every tenth entry
+func benchClocks(rep ClockRepresentation) (*VectorClock, *VectorClock, []string) {
+	ids := make([]string, clockBenchEntries)
+	a, b := NewVectorClockWith(rep), NewVectorClockWith(rep)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("node-%05d", i)
+		a.Update(ids[i], int64(i+10))
+		if i%10 == 0 {
+			b.Update(ids[i], int64(i+5))
+		} else {
+			b.Update(ids[i], int64(i+10))
+		}
+	}
+	return a, b, ids
+}
+
+func BenchmarkClockBuild(b *testing.B) {
+	for _, rep := range clockReps {
+		b.Run(string(rep), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				benchClocks(rep)
+			}
+		})
+	}
+}
+
+func BenchmarkClockUpdate(b *testing.B) {
+	for _, rep := range clockReps {
+		b.Run(string(rep), func(b *testing.B) {
+			clock, _, ids := benchClocks(rep)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				clock.Update(ids[i%len(ids)], int64(i))
+			}
+		})
+	}
+}
+
+func BenchmarkClockMerge(b *testing.B) {
+	for _, rep := range clockReps {
+		b.Run(string(rep), func(b *testing.B) {
+			into, from, _ := benchClocks(rep)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				into.Merge(from)
+			}
+		})
+	}
+}
+
+func BenchmarkClockCompare(b *testing.B) {
+	for _, rep := range clockReps {
+		b.Run(string(rep), func(b *testing.B) {
+			x, y, _ := benchClocks(rep)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if x.Compare(y) != ClockAfter {
+					b.Fatal("Expected the clock to be after the lagging one")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package clock
+
+import (
+	"fmt"
+	"time"
+)
+
+// Hybrid logical clocks.
+//
+// A hybrid logical clock (Kulkarni et al., "Logical Physical Clocks", 2014)
+// stamps events with a wall component, the highest physical time the node
+// has seen, and a logical counter that orders events sharing a wall time.
+// On a local or send event the wall time becomes the maximum of itself and
+// the physical clock, and the counter increments if the wall time did not
+// move and resets otherwise. On a receive event the maximum also takes in
+// the message's wall time, and the counter continues from whichever of the
+// local and the message stamp held that maximum. Stamps never go backwards,
+// even when the physical clock does, and stay within the clock skew of
+// physical time. Unlike a vector clock an HLC is a single stamp, so it
+// orders every pair of events and cannot tell concurrent ones apart.
+//
+// Both clocks implement Clock, the interface a node keeps what it knows of
+// other nodes' timestamps through. An HLC records the latest timestamp
+// received from each node like a vector clock does, and also takes it in
+// as a receive event.
+
+// Clock records the timestamps a node received from other nodes
+type Clock interface {
+	Update(nodeID string, timestamp int64)
+	GetTimestamp(nodeID string) int64
+	Len() int
+	Timestamps() map[string]int64
+}
+
+// ClockKind selects how a node tracks causality
+type ClockKind string
+
+const (
+	KindVector ClockKind = "vector"
+	KindHLC    ClockKind = "hlc"
+)
+
+// ParseClockKind checks a clock kind name
+func ParseClockKind(name string) (ClockKind, error) {
+	switch kind := ClockKind(name); kind {
+	case KindVector, KindHLC:
+		return kind, nil
+	}
+	return "", fmt.Errorf("unknown clock kind %q, want %q or %q", name, KindVector, KindHLC)
+}
+
+// NewClock creates an empty clock of the given kind. An HLC reads physical
+// time from physical, wall-clock seconds if nil.
+func NewClock(kind ClockKind, physical func() int64) Clock {
+	if kind == KindHLC {
+		return NewHLC(physical)
+	}
+	return NewVectorClock()
+}
+
+// HLCTimestamp is a hybrid logical clock stamp
+type HLCTimestamp struct {
+	Wall    int64
+	Logical int64
+}
+
+// Compare orders two stamps by wall time, then by logical counter
+func (t HLCTimestamp) Compare(other HLCTimestamp) ClockOrdering {
+	switch {
+	case t.Wall < other.Wall || t.Wall == other.Wall && t.Logical < other.Logical:
+		return ClockBefore
+	case t == other:
+		return ClockEqual
+	}
+	return ClockAfter
+}
+
+func (t HLCTimestamp) String() string {
+	return fmt.Sprintf("%d.%d", t.Wall, t.Logical)
+}
+
+// HLC is a hybrid logical clock
+type HLC struct {
+	Physical func() int64 // Physical time source, wall-clock seconds if nil
+	latest   HLCTimestamp
+	received map[string]int64
+}
+
+// NewHLC creates a clock at zero reading physical time from physical
+func NewHLC(physical func() int64) *HLC {
+	return &HLC{Physical: physical, received: make(map[string]int64)}
+}
+
+// physical reads the physical clock
+func (h *HLC) physical() int64 {
+	if h.Physical == nil {
+		return time.Now().Unix()
+	}
+	return h.Physical()
+}
+
+// Now ticks the clock for a local or send event and returns its stamp
+func (h *HLC) Now() HLCTimestamp {
+	wall := max(h.latest.Wall, h.physical())
+	if wall == h.latest.Wall {
+		h.latest.Logical++
+	} else {
+		h.latest = HLCTimestamp{Wall: wall}
+	}
+	return h.latest
+}
+
+// Receive ticks the clock for the receipt of a message stamped m and
+// returns the stamp of the receive event
+func (h *HLC) Receive(m HLCTimestamp) HLCTimestamp {
+	wall := max(h.latest.Wall, m.Wall, h.physical())
+	switch {
+	case wall == h.latest.Wall && wall == m.Wall:
+		h.latest.Logical = max(h.latest.Logical, m.Logical) + 1
+	case wall == h.latest.Wall:
+		h.latest.Logical++
+	case wall == m.Wall:
+		h.latest = HLCTimestamp{Wall: wall, Logical: m.Logical + 1}
+	default:
+		h.latest = HLCTimestamp{Wall: wall}
+	}
+	return h.latest
+}
+
+// Latest returns the stamp of the last event without ticking
+func (h *HLC) Latest() HLCTimestamp {
+	return h.latest
+}
+
+// Compare orders the clocks' latest stamps; they are never concurrent
+func (h *HLC) Compare(other *HLC) ClockOrdering {
+	return h.latest.Compare(other.latest)
+}
+
+// Update records a timestamp received from nodeID and takes it in as a
+// receive event with a logical counter of zero
+func (h *HLC) Update(nodeID string, timestamp int64) {
+	if timestamp == 0 {
+		delete(h.received, nodeID)
+	} else {
+		h.received[nodeID] = timestamp
+	}
+	h.Receive(HLCTimestamp{Wall: timestamp})
+}
+
+// GetTimestamp returns the latest timestamp received from nodeID
+func (h *HLC) GetTimestamp(nodeID string) int64 {
+	return h.received[nodeID]
+}
+
+// Len returns the number of nodes with a nonzero timestamp
+func (h *HLC) Len() int {
+	return len(h.received)
+}
+
+// Timestamps returns a copy of the received timestamps
+func (h *HLC) Timestamps() map[string]int64 {
+	timestamps := make(map[string]int64, len(h.received))
+	for id, ts := range h.received {
+		timestamps[id] = ts
+	}
+	return timestamps
+}
+
+// Clone returns a copy of the clock reading the same physical clock
+func (h *HLC) Clone() *HLC {
+	clone := NewHLC(h.Physical)
+	clone.latest = h.latest
+	for id, ts := range h.received {
+		clone.received[id] = ts
+	}
+	return clone
+}
@@ -0,0 +1,83 @@
+package clock
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	_ Clock = (*VectorClock)(nil)
+	_ Clock = (*HLC)(nil)
+)
+
+// TestHLCNow tests that local events stay monotonic while the physical clock goes backwards
+func TestHLCNow(t *testing.T) {
+	physical := int64(100)
+	h := NewHLC(func() int64 { return physical })
+	var stamps []HLCTimestamp
+	for _, pt := range []int64{100, 100, 90, 101} {
+		physical = pt
+		stamps = append(stamps, h.Now())
+	}
+	expected := []HLCTimestamp{{100, 0}, {100, 1}, {100, 2}, {101, 0}}
+	if !reflect.DeepEqual(stamps, expected) {
+		t.Errorf("Expected %v, got %v", expected, stamps)
+	}
+	for i := 1; i < len(stamps); i++ {
+		if stamps[i].Compare(stamps[i-1]) != ClockAfter {
+			t.Errorf("Expected %v after %v", stamps[i], stamps[i-1])
+		}
+	}
+}
+
+// TestHLCReceive tests the receive rule for each source of the maximum wall time
+func TestHLCReceive(t *testing.T) {
+	physical := int64(100)
+	h := NewHLC(func() int64 { return physical })
+	h.Now()
+	cases := []struct {
+		physical int64
+		message  HLCTimestamp
+		expected HLCTimestamp
+	}{
+		{100, HLCTimestamp{100, 4}, HLCTimestamp{100, 5}}, // Same wall time: past both counters
+		{100, HLCTimestamp{90, 7}, HLCTimestamp{100, 6}},  // Local wall time is ahead
+		{100, HLCTimestamp{105, 2}, HLCTimestamp{105, 3}}, // Message is ahead
+		{110, HLCTimestamp{105, 9}, HLCTimestamp{110, 0}}, // Physical time is ahead
+	}
+	for _, c := range cases {
+		physical = c.physical
+		if got := h.Receive(c.message); got != c.expected {
+			t.Errorf("Expected receiving %v at %d to give %v, got %v", c.message, c.physical, c.expected, got)
+		}
+	}
+	if h.Latest().String() != "110.0" {
+		t.Errorf("Expected the latest stamp 110.0, got %v", h.Latest())
+	}
+}
+
+// TestHLCClock tests that an HLC records received timestamps like a vector clock
+func TestHLCClock(t *testing.T) {
+	physical := int64(50)
+	a := NewClock(KindHLC, func() int64 { return physical }).(*HLC)
+	a.Update("B", 60)
+	a.Update("C", 40)
+	if a.GetTimestamp("B") != 60 || a.Len() != 2 || !reflect.DeepEqual(a.Timestamps(), map[string]int64{"B": 60, "C": 40}) {
+		t.Errorf("Expected B at 60 and C at 40, got %v", a.Timestamps())
+	}
+	if a.Latest() != (HLCTimestamp{60, 2}) {
+		t.Errorf("Expected the update from B to pull the clock to 60.1 and C's to tick it to 60.2, got %v", a.Latest())
+	}
+
+	b := a.Clone()
+	b.Update("C", 0)
+	if b.Len() != 1 || a.Len() != 2 || b.Compare(a) != ClockAfter {
+		t.Errorf("Expected the clone to drop C on its own and move ahead, got %v and %v", b.Timestamps(), a.Timestamps())
+	}
+	if _, ok := NewClock(KindVector, nil).(*VectorClock); !ok {
+		t.Errorf("Expected a vector clock")
+	}
+	if _, err := ParseClockKind("lamport"); err == nil {
+		t.Errorf("Expected an unknown clock kind to be rejected")
+	}
+}
@@ -0,0 +1,59 @@
+package clock
+
+import "sync"
+
+// ClockIndex interns node IDs as small integers. Dense clocks sharing an
+// index line up slot by slot, and sparse clocks sharing one compare int32
+// keys instead of strings. Slots are assigned in first-seen order and never
+// reused.
+type ClockIndex struct {
+	Lock  sync.RWMutex
+	slots map[string]int32
+	names []string
+}
+
+// NewClockIndex creates an empty index
+func NewClockIndex() *ClockIndex {
+	return &ClockIndex{slots: make(map[string]int32)}
+}
+
+// defaultClockIndex is shared by the clocks NewVectorClockWith creates
+var defaultClockIndex = NewClockIndex()
+
+// Lookup returns the slot of id if it has one
+func (x *ClockIndex) Lookup(id string) (int32, bool) {
+	x.Lock.RLock()
+	defer x.Lock.RUnlock()
+	slot, exists := x.slots[id]
+	return slot, exists
+}
+
+// Intern returns the slot of id, assigning the next one if it has none
+func (x *ClockIndex) Intern(id string) int32 {
+	if slot, exists := x.Lookup(id); exists {
+		return slot
+	}
+	x.Lock.Lock()
+	defer x.Lock.Unlock()
+	if slot, exists := x.slots[id]; exists {
+		return slot
+	}
+	slot := int32(len(x.names))
+	x.slots[id] = slot
+	x.names = append(x.names, id)
+	return slot
+}
+
+// Name returns the node ID of a slot
+func (x *ClockIndex) Name(slot int32) string {
+	x.Lock.RLock()
+	defer x.Lock.RUnlock()
+	return x.names[slot]
+}
+
+// Len returns the number of interned node IDs
+func (x *ClockIndex) Len() int {
+	x.Lock.RLock()
+	defer x.Lock.RUnlock()
+	return len(x.names)
+}
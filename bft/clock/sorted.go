@@ -0,0 +1,206 @@
+package clock
+
+import (
+	"cmp"
+	"slices"
+)
+
+// sortedEntries are parallel key and timestamp slices sorted by key, the
+// storage of sorted clocks (keyed by node ID) and sparse clocks (keyed by
+// interned slot)
+type sortedEntries[K cmp.Ordered] struct {
+	keys []K
+	ts   []int64
+}
+
+func (e *sortedEntries[K]) get(key K) int64 {
+	if i, found := slices.BinarySearch(e.keys, key); found {
+		return e.ts[i]
+	}
+	return 0
+}
+
+// put sets the timestamp of key, removing the entry if it is zero
+func (e *sortedEntries[K]) put(key K, ts int64) {
+	i, found := slices.BinarySearch(e.keys, key)
+	switch {
+	case found && ts == 0:
+		e.keys = slices.Delete(e.keys, i, i+1)
+		e.ts = slices.Delete(e.ts, i, i+1)
+	case found:
+		e.ts[i] = ts
+	case ts != 0:
+		e.keys = slices.Insert(e.keys, i, key)
+		e.ts = slices.Insert(e.ts, i, ts)
+	}
+}
+
+// mergeFrom raises entries to o's. Entries only raised in place need no
+// new slices.
+func (e *sortedEntries[K]) mergeFrom(o *sortedEntries[K]) {
+	i, j, missing := 0, 0, 0
+	for i < len(e.keys) && j < len(o.keys) {
+		switch {
+		case e.keys[i] == o.keys[j]:
+			if o.ts[j] > e.ts[i] {
+				e.ts[i] = o.ts[j]
+			}
+			i++
+			j++
+		case e.keys[i] < o.keys[j]:
+			i++
+		default:
+			missing++
+			j++
+		}
+	}
+	missing += len(o.keys) - j
+	if missing == 0 {
+		return
+	}
+
+	keys := make([]K, 0, len(e.keys)+missing)
+	ts := make([]int64, 0, len(e.keys)+missing)
+	i, j = 0, 0
+	for i < len(e.keys) || j < len(o.keys) {
+		switch {
+		case j == len(o.keys) || (i < len(e.keys) && e.keys[i] < o.keys[j]):
+			keys, ts = append(keys, e.keys[i]), append(ts, e.ts[i])
+			i++
+		case i == len(e.keys) || o.keys[j] < e.keys[i]:
+			keys, ts = append(keys, o.keys[j]), append(ts, o.ts[j])
+			j++
+		default:
+			// Already raised by the first pass
+			keys, ts = append(keys, e.keys[i]), append(ts, e.ts[i])
+			i++
+			j++
+		}
+	}
+	e.keys, e.ts = keys, ts
+}
+
+// compareTo walks both entry lists once
+func (e *sortedEntries[K]) compareTo(o *sortedEntries[K]) ClockOrdering {
+	var less, greater bool
+	i, j := 0, 0
+	for i < len(e.keys) && j < len(o.keys) {
+		switch {
+		case e.keys[i] == o.keys[j]:
+			if e.ts[i] < o.ts[j] {
+				less = true
+			} else if e.ts[i] > o.ts[j] {
+				greater = true
+			}
+			i++
+			j++
+		case e.keys[i] < o.keys[j]:
+			greater = true
+			i++
+		default:
+			less = true
+			j++
+		}
+	}
+	if i < len(e.keys) {
+		greater = true
+	}
+	if j < len(o.keys) {
+		less = true
+	}
+	return clockOrdering(less, greater)
+}
+
+func (e *sortedEntries[K]) clone() sortedEntries[K] {
+	return sortedEntries[K]{keys: slices.Clone(e.keys), ts: slices.Clone(e.ts)}
+}
+
+// sortedClock stores entries sorted by node ID
+type sortedClock struct {
+	entries sortedEntries[string]
+}
+
+func (c *sortedClock) get(id string) int64 { return c.entries.get(id) }
+
+func (c *sortedClock) set(id string, ts int64) { c.entries.put(id, ts) }
+
+func (c *sortedClock) each(fn func(id string, ts int64)) {
+	for i, id := range c.entries.keys {
+		fn(id, c.entries.ts[i])
+	}
+}
+
+func (c *sortedClock) len() int { return len(c.entries.keys) }
+
+func (c *sortedClock) merge(other clockVector) {
+	if o, ok := other.(*sortedClock); ok {
+		c.entries.mergeFrom(&o.entries)
+		return
+	}
+	mergeGeneric(c, other)
+}
+
+func (c *sortedClock) compare(other clockVector) ClockOrdering {
+	if o, ok := other.(*sortedClock); ok {
+		return c.entries.compareTo(&o.entries)
+	}
+	return compareGeneric(c, other)
+}
+
+func (c *sortedClock) clone() clockVector { return &sortedClock{entries: c.entries.clone()} }
+
+func (c *sortedClock) empty() clockVector { return &sortedClock{} }
+
+func (c *sortedClock) rep() ClockRepresentation { return ClockSorted }
+
+// sparseClock stores entries sorted by the node ID's slot in a ClockIndex
+type sparseClock struct {
+	index   *ClockIndex
+	entries sortedEntries[int32]
+}
+
+func (c *sparseClock) get(id string) int64 {
+	if slot, exists := c.index.Lookup(id); exists {
+		return c.entries.get(slot)
+	}
+	return 0
+}
+
+func (c *sparseClock) set(id string, ts int64) {
+	if ts != 0 {
+		c.entries.put(c.index.Intern(id), ts)
+	} else if slot, exists := c.index.Lookup(id); exists {
+		c.entries.put(slot, 0)
+	}
+}
+
+func (c *sparseClock) each(fn func(id string, ts int64)) {
+	for i, slot := range c.entries.keys {
+		fn(c.index.Name(slot), c.entries.ts[i])
+	}
+}
+
+func (c *sparseClock) len() int { return len(c.entries.keys) }
+
+func (c *sparseClock) merge(other clockVector) {
+	if o, ok := other.(*sparseClock); ok && o.index == c.index {
+		c.entries.mergeFrom(&o.entries)
+		return
+	}
+	mergeGeneric(c, other)
+}
+
+func (c *sparseClock) compare(other clockVector) ClockOrdering {
+	if o, ok := other.(*sparseClock); ok && o.index == c.index {
+		return c.entries.compareTo(&o.entries)
+	}
+	return compareGeneric(c, other)
+}
+
+func (c *sparseClock) clone() clockVector {
+	return &sparseClock{index: c.index, entries: c.entries.clone()}
+}
+
+func (c *sparseClock) empty() clockVector { return &sparseClock{index: c.index} }
+
+func (c *sparseClock) rep() ClockRepresentation { return ClockSparse }
@@ -0,0 +1,113 @@
+// Package clock implements vector clocks in interchangeable
+// representations, and hybrid logical clocks.
+package clock
+
+import "encoding/json"
+
+// VectorClock represents a vector clock with timestamps
+type VectorClock struct {
+	entries clockVector
+}
+
+// NewVectorClock creates a new vector clock using DefaultClockRepresentation
+func NewVectorClock() *VectorClock {
+	return NewVectorClockWith(DefaultClockRepresentation)
+}
+
+// NewVectorClockWith creates a new vector clock with the given
+// representation, interning node IDs in a process-wide index
+func NewVectorClockWith(rep ClockRepresentation) *VectorClock {
+	return NewVectorClockIndexed(rep, defaultClockIndex)
+}
+
+// NewVectorClockIndexed creates a new vector clock with the given
+// representation, interning node IDs in index if it is sparse or dense
+func NewVectorClockIndexed(rep ClockRepresentation, index *ClockIndex) *VectorClock {
+	return &VectorClock{entries: newClockVector(rep, index)}
+}
+
+// FromTimestamps creates a clock of the given representation from
+// string-keyed timestamps, such as a decoded wire clock
+func FromTimestamps(rep ClockRepresentation, timestamps map[string]int64) *VectorClock {
+	vc := NewVectorClockWith(rep)
+	for id, ts := range timestamps {
+		vc.Update(id, ts)
+	}
+	return vc
+}
+
+// Update updates the vector clock with a new timestamp
+func (vc *VectorClock) Update(nodeID string, timestamp int64) {
+	vc.entries.set(nodeID, timestamp)
+}
+
+// GetTimestamp gets the timestamp for a specific node
+func (vc *VectorClock) GetTimestamp(nodeID string) int64 {
+	return vc.entries.get(nodeID)
+}
+
+// Merge raises every entry to the other clock's where that is higher
+func (vc *VectorClock) Merge(other *VectorClock) {
+	vc.entries.merge(other.entries)
+}
+
+// Compare reports how the clock relates to other: ClockBefore (-1),
+// ClockEqual (0), ClockAfter (1) or ClockConcurrent
+func (vc *VectorClock) Compare(other *VectorClock) ClockOrdering {
+	return vc.entries.compare(other.entries)
+}
+
+// Len returns the number of nodes with a nonzero timestamp
+func (vc *VectorClock) Len() int {
+	return vc.entries.len()
+}
+
+// Timestamps returns a copy of the clock's entries
+func (vc *VectorClock) Timestamps() map[string]int64 {
+	timestamps := make(map[string]int64, vc.entries.len())
+	vc.entries.each(func(id string, ts int64) {
+		timestamps[id] = ts
+	})
+	return timestamps
+}
+
+// Representation returns how the clock stores its entries
+func (vc *VectorClock) Representation() ClockRepresentation {
+	return vc.entries.rep()
+}
+
+// Convert returns a copy of the clock in another representation
+func (vc *VectorClock) Convert(rep ClockRepresentation) *VectorClock {
+	converted := NewVectorClockWith(rep)
+	converted.entries.merge(vc.entries)
+	return converted
+}
+
+// MarshalJSON encodes the clock in the string-keyed wire format, an object
+// from node ID to timestamp, whatever its representation
+func (vc *VectorClock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(vc.Timestamps())
+}
+
+// UnmarshalJSON decodes the string-keyed wire format, keeping the clock's
+// representation, or DefaultClockRepresentation for a zero VectorClock
+func (vc *VectorClock) UnmarshalJSON(data []byte) error {
+	var timestamps map[string]int64
+	if err := json.Unmarshal(data, &timestamps); err != nil {
+		return err
+	}
+	if vc.entries == nil {
+		vc.entries = newClockVector(DefaultClockRepresentation, defaultClockIndex)
+	} else {
+		vc.entries = vc.entries.empty()
+	}
+	for id, ts := range timestamps {
+		vc.entries.set(id, ts)
+	}
+	return nil
+}
+
+// Clone returns a copy of the clock with the same representation
+func (vc *VectorClock) Clone() *VectorClock {
+	return &VectorClock{entries: vc.entries.clone()}
+}
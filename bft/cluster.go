@@ -0,0 +1,617 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Local multi-process clusters.
+//
+// Between the in-memory simulation and a full deployment, `wahello cluster
+// up` runs every node as its own process on this machine. The launcher
+// generates each node's keys with GenerateKeys into a directory of its
+// own, with every public key in a shared one, and listens on a loopback port
+// for each node, so that every address is known and held before any node
+// starts. It writes a config naming the node's address, its peers' addresses
+// and, for a Byzantine node, its strategy; then it starts `wahello node
+// -config <file> -listen-fd 3` once per node, handing the node its listening
+// socket. Nodes talk gRPC, see grpc.go: every Interval each node signs a
+// clock update and sends it to its peers with Clock.PropagateClockUpdate,
+// and they verify it against the shared public keys and run the same
+// Byzantine detection as the simulation. The nodes form a
+// full mesh unless the cluster runs a scenario, see ClusterOptions.Scenario:
+// then its nodes and Byzantine strategies are the cluster's, a node's peers
+// are its neighbors over the link directions that are up, dropping the
+// share of updates the direction loses, and partitioned nodes have no
+// links. Latency, jitter and bandwidth are left to the loopback network,
+// and a scenario with a timeline is refused, as the processes run in real
+// time rather than on a scheduler. After Duration
+// the launcher collects every node's status over HTTP, checks that every honest node
+// heard from each honest node linked to it and which of them caught
+// the Byzantine ones, and
+// stops the processes. A node's output goes to <id>.log in the cluster
+// directory, which is removed afterwards unless one was given.
+
+var ErrClusterStart = errors.New("cluster node did not start")
+
+const (
+	// DefaultClusterInterval is how often cluster nodes send clock updates
+	DefaultClusterInterval = 100 * time.Millisecond
+	// DefaultClusterStrategy is the strategy of a Byzantine cluster node
+	// that names none
+	DefaultClusterStrategy = "timestamp-inflation"
+	// clusterStartTimeout bounds the wait for a node to serve its status
+	clusterStartTimeout = 10 * time.Second
+)
+
+// NodeConfig is the config file of one cluster node process
+type NodeConfig struct {
+	ID        string             `json:"id"`
+	Addr      string             `json:"addr"`
+	Peers     map[string]string  `json:"peers"`              // Address by node ID
+	Drop      map[string]float64 `json:"drop,omitempty"`     // Share of updates lost, by peer
+	KeyDir    string             `json:"key_dir"`            // The node's own key pair
+	PublicDir string             `json:"public_dir"`         // Every node's public key
+	Strategy  string             `json:"strategy,omitempty"` // Byzantine if set
+	Interval  time.Duration      `json:"interval"`
+	Seed      int64              `json:"seed"`
+}
+
+// NodeStatus is what a cluster node reports about itself
+type NodeStatus struct {
+	ID        string           `json:"id"`
+	Byzantine bool             `json:"byzantine"`
+	Sent      uint64           `json:"sent"`
+	Clock     map[string]int64 `json:"clock"`
+	Detected  map[string]int   `json:"detected,omitempty"` // Detections by culprit
+}
+
+// RunNode serves a cluster node from config on listener, or on config.Addr
+// if listener is nil, until stop is closed
+func RunNode(config *NodeConfig, listener net.Listener, stop <-chan struct{}) error {
+	if listener != nil {
+		defer listener.Close()
+	}
+	keys, err := LoadNodeKeys(config.KeyDir)
+	if err != nil {
+		return err
+	}
+	public, err := LoadKeys(config.PublicDir)
+	if err != nil {
+		return err
+	}
+	own, exists := keys[config.ID]
+	if !exists {
+		return fmt.Errorf("%w: no keys for %s in %s", ErrUnknownNode, config.ID, config.KeyDir)
+	}
+	node, err := NewNode(config.ID, config.Strategy != "", false)
+	if err != nil {
+		return err
+	}
+	node.UseKeys(own)
+	if config.Strategy != "" {
+		if node.Strategy, err = NewStrategy(config.Strategy, config.Seed); err != nil {
+			return err
+		}
+	}
+	system := NewSystem()
+	system.Metrics = NewMetrics()
+	system.AddNode(node)
+	for id, key := range public {
+		if id != config.ID {
+			if err := system.Keys.Register(id, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	if listener == nil {
+		if listener, err = net.Listen("tcp", config.Addr); err != nil {
+			return err
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+grpcPropagateClockUpdate, grpcUnary(func() *ClockUpdate { return new(ClockUpdate) }, func(update *ClockUpdate) error {
+		system.receiveClockUpdate(update.NodeID, node, update)
+		return nil
+	}))
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(nodeStatus(system, node, config.Peers))
+	})
+	server := &http.Server{Handler: mux, Protocols: grpcProtocols()}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := newGRPCClient(config.Interval)
+	rng := rand.New(rand.NewSource(config.Seed))
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			sendClusterUpdate(client, rng, node, config.Peers, config.Drop)
+		}
+	}
+}
+
+// sendClusterUpdate signs a fresh update and sends it to every peer, as
+// the node's strategy has it, losing the share of updates drop has for the
+// peer
+func sendClusterUpdate(client *http.Client, rng *rand.Rand, node *Node, peers map[string]string, drop map[string]float64) {
+	update := node.GetClockUpdate()
+	node.Lock.Lock()
+	update = node.mutate(update)
+	versions := make(map[string]*ClockUpdate, len(peers))
+	for id := range peers {
+		if version := node.outgoing(id, update); version != nil {
+			versions[id] = version
+		}
+	}
+	node.Lock.Unlock()
+	for _, id := range sortedKeys(versions) {
+		if rng.Float64() < drop[id] {
+			continue
+		}
+		grpcCall(client, peers[id], grpcPropagateClockUpdate, versions[id])
+	}
+}
+
+// nodeStatus reports a cluster node's clock and detections
+func nodeStatus(system *System, node *Node, peers map[string]string) *NodeStatus {
+	node.Lock.RLock()
+	status := &NodeStatus{ID: node.ID, Byzantine: node.IsByzantine, Sent: node.sent, Clock: node.VectorClock.Timestamps()}
+	node.Lock.RUnlock()
+	for id := range peers {
+		if count := int(system.Metrics.Count(metricDetections.name, id)); count > 0 {
+			if status.Detected == nil {
+				status.Detected = make(map[string]int)
+			}
+			status.Detected[id] = count
+		}
+	}
+	return status
+}
+
+// ClusterOptions configure a local cluster
+type ClusterOptions struct {
+	N         int
+	Byzantine map[string]string // Strategy by node ID
+	Duration  time.Duration
+	Interval  time.Duration
+	Dir       string // For keys, configs and logs; a temporary one if empty
+	Seed      int64
+	// Scenario, if set, gives the nodes, their strategies and the links
+	// between them in place of N, Byzantine and a full mesh
+	Scenario *ScenarioSpec
+	// Spawn starts a node from its config file, serving on listener, which
+	// it takes over, and returns a function stopping it; a `wahello node`
+	// process if nil
+	Spawn func(id, configPath, logPath string, listener net.Listener) (func() error, error)
+}
+
+// ClusterReport is the outcome of a cluster run
+type ClusterReport struct {
+	Nodes     []*NodeStatus
+	Converged bool                // Every honest node heard from every honest node linked to it
+	Detectors map[string][]string // Honest nodes that caught each Byzantine node
+}
+
+// Caught reports whether every Byzantine node was caught by at least min
+// honest nodes
+func (r *ClusterReport) Caught(min int) bool {
+	for _, status := range r.Nodes {
+		if status.Byzantine && len(r.Detectors[status.ID]) < min {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ClusterReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-6s %-10s %6s %8s  %s\n", "NODE", "ROLE", "SENT", "CLOCK", "DETECTED")
+	for _, status := range r.Nodes {
+		role := "honest"
+		if status.Byzantine {
+			role = "byzantine"
+		}
+		var detected []string
+		for _, id := range sortedKeys(status.Detected) {
+			detected = append(detected, fmt.Sprintf("%s×%d", id, status.Detected[id]))
+		}
+		fmt.Fprintf(&b, "%-6s %-10s %6d %8d  %s\n", status.ID, role, status.Sent, len(status.Clock), strings.Join(detected, " "))
+	}
+	if r.Converged {
+		b.WriteString("Honest nodes converged: every one heard from every other linked to it\n")
+	} else {
+		b.WriteString("Honest nodes did not converge\n")
+	}
+	for _, id := range sortedKeys(r.Detectors) {
+		fmt.Fprintf(&b, "%s caught by %v\n", id, r.Detectors[id])
+	}
+	return b.String()
+}
+
+// clusterIDs names n nodes A, B, C and so on, then N26, N27 and on
+func clusterIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		if i < 26 {
+			ids[i] = string(rune('A' + i))
+		} else {
+			ids[i] = fmt.Sprintf("N%d", i)
+		}
+	}
+	return ids
+}
+
+// clusterLinks returns the drop rate of every link direction that is up, by
+// sender then receiver: a full mesh of ids without a scenario, and the
+// scenario's links otherwise
+func clusterLinks(ids []string, scenario *ScenarioSpec) map[string]map[string]float64 {
+	links := make(map[string]map[string]float64, len(ids))
+	for _, id := range ids {
+		links[id] = make(map[string]float64)
+	}
+	if scenario == nil {
+		for _, from := range ids {
+			for _, to := range ids {
+				if from != to {
+					links[from][to] = 0
+				}
+			}
+		}
+		return links
+	}
+	partitioned := make(map[string]bool)
+	for _, id := range scenario.Partitioned {
+		partitioned[id] = true
+	}
+	add := func(from, to string, direction *ScenarioDirection) {
+		if partitioned[from] || partitioned[to] || direction != nil && direction.Down {
+			return
+		}
+		links[from][to] = 0
+		if direction != nil {
+			links[from][to] = direction.Drop
+		}
+	}
+	for _, link := range scenario.Links {
+		add(link.From, link.To, link.Forward)
+		if !link.OneWay {
+			add(link.To, link.From, link.Reverse)
+		}
+	}
+	return links
+}
+
+// linked reports whether updates can travel from one node to another
+func linked(links map[string]map[string]float64, from, to string) bool {
+	drop, up := links[from][to]
+	return up && drop < 1
+}
+
+// spawnProcess starts `wahello node` from the running executable, passing
+// it listener as its first extra file
+func spawnProcess(id, configPath, logPath string, listener net.Listener) (func() error, error) {
+	defer listener.Close()
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	tcp, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("cannot hand a %T to a process", listener)
+	}
+	socket, err := tcp.File()
+	if err != nil {
+		return nil, err
+	}
+	defer socket.Close()
+	log, err := os.Create(logPath)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(executable, "node", "-config", configPath, "-listen-fd", "3")
+	cmd.Stdout, cmd.Stderr = log, log
+	cmd.ExtraFiles = []*os.File{socket}
+	if err := cmd.Start(); err != nil {
+		log.Close()
+		return nil, err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	return func() error {
+		defer log.Close()
+		cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-exited:
+		case <-time.After(2 * time.Second):
+			cmd.Process.Kill()
+			<-exited
+		}
+		return nil
+	}, nil
+}
+
+// RunCluster starts a local cluster, lets it run for the configured
+// duration and returns what its nodes report before stopping them
+func RunCluster(options ClusterOptions) (*ClusterReport, error) {
+	if scenario := options.Scenario; scenario != nil {
+		if len(scenario.Timeline) > 0 {
+			return nil, fmt.Errorf("%w: scenario %s has a timeline, which a cluster cannot play", ErrInvalidScenario, scenario.Name)
+		}
+		options.N, options.Byzantine = len(scenario.Nodes), make(map[string]string)
+		for _, node := range scenario.Nodes {
+			if node.Byzantine {
+				options.Byzantine[node.ID] = node.Strategy
+				if node.Strategy == "" {
+					options.Byzantine[node.ID] = DefaultClusterStrategy
+				}
+			}
+		}
+	}
+	if options.N < 1 {
+		return nil, fmt.Errorf("a cluster needs at least one node, got %d", options.N)
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultClusterInterval
+	}
+	if options.Spawn == nil {
+		options.Spawn = spawnProcess
+	}
+	dir := options.Dir
+	if dir == "" {
+		temp, err := os.MkdirTemp("", "wahello-cluster-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(temp)
+		dir = temp
+	}
+	ids := clusterIDs(options.N)
+	if options.Scenario != nil {
+		ids = ids[:0]
+		for _, node := range options.Scenario.Nodes {
+			ids = append(ids, node.ID)
+		}
+	}
+	for id := range options.Byzantine {
+		if !containsID(ids, id) {
+			return nil, fmt.Errorf("%w: %s is not one of %v", ErrUnknownNode, id, ids)
+		}
+	}
+
+	publicDir := filepath.Join(dir, "public")
+	if err := GenerateKeys(dir, ids, ""); err != nil {
+		return nil, err
+	}
+	// Listening before any node starts leaves no window for another process
+	// to take a port between choosing it and a node binding it
+	listeners := make(map[string]net.Listener, len(ids))
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+	addrs := make(map[string]string, len(ids))
+	for _, id := range ids {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		listeners[id], addrs[id] = listener, listener.Addr().String()
+	}
+
+	links := clusterLinks(ids, options.Scenario)
+	var stops []func() error
+	defer func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}()
+	for i, id := range ids {
+		config := &NodeConfig{ID: id, Addr: addrs[id], Peers: make(map[string]string),
+			KeyDir: filepath.Join(dir, "keys", id), PublicDir: publicDir,
+			Strategy: options.Byzantine[id], Interval: options.Interval, Seed: options.Seed + int64(i)}
+		for peer, drop := range links[id] {
+			config.Peers[peer] = addrs[peer]
+			if drop > 0 {
+				if config.Drop == nil {
+					config.Drop = make(map[string]float64)
+				}
+				config.Drop[peer] = drop
+			}
+		}
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		configPath := filepath.Join(dir, id+".json")
+		if err := os.WriteFile(configPath, data, 0o644); err != nil {
+			return nil, err
+		}
+		listener := listeners[id]
+		delete(listeners, id)
+		stop, err := options.Spawn(id, configPath, filepath.Join(dir, id+".log"), listener)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", id, err)
+		}
+		stops = append(stops, stop)
+	}
+
+	client := &http.Client{Timeout: time.Second}
+	for _, id := range ids {
+		if err := awaitNode(client, addrs[id]); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrClusterStart, id, err)
+		}
+	}
+	time.Sleep(options.Duration)
+
+	report := &ClusterReport{Converged: true, Detectors: make(map[string][]string)}
+	for _, id := range ids {
+		status, err := fetchStatus(client, addrs[id])
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", id, err)
+		}
+		report.Nodes = append(report.Nodes, status)
+	}
+	for _, status := range report.Nodes {
+		if status.Byzantine {
+			continue
+		}
+		for _, other := range report.Nodes {
+			if _, heard := status.Clock[other.ID]; !other.Byzantine && linked(links, other.ID, status.ID) && !heard {
+				report.Converged = false
+			}
+		}
+		for _, suspect := range sortedKeys(status.Detected) {
+			report.Detectors[suspect] = append(report.Detectors[suspect], status.ID)
+		}
+	}
+	return report, nil
+}
+
+// containsID reports whether ids holds id
+func containsID(ids []string, id string) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+// awaitNode polls a node's status until it answers
+func awaitNode(client *http.Client, addr string) error {
+	deadline := time.Now().Add(clusterStartTimeout)
+	for {
+		_, err := fetchStatus(client, addr)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// fetchStatus reads a node's status
+func fetchStatus(client *http.Client, addr string) (*NodeStatus, error) {
+	resp, err := client.Get("http://" + addr + "/status")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status returned %s", resp.Status)
+	}
+	var status NodeStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// LoadNodeConfig reads a node config written by RunCluster
+func LoadNodeConfig(path string) (*NodeConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config NodeConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// NodeCommand implements `wahello node -config file [-listen-fd n]`,
+// serving one cluster node until interrupted
+func NodeCommand(args []string, stop <-chan struct{}) error {
+	flags := flag.NewFlagSet("node", flag.ContinueOnError)
+	path := flags.String("config", "", "JSON node config written by cluster up")
+	fd := flags.Int("listen-fd", -1, "descriptor of an inherited listening socket to serve on, in place of binding the config's address")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return fmt.Errorf("usage: node -config file [-listen-fd n]")
+	}
+	config, err := LoadNodeConfig(*path)
+	if err != nil {
+		return err
+	}
+	var listener net.Listener
+	if *fd >= 0 {
+		socket := os.NewFile(uintptr(*fd), "listener")
+		listener, err = net.FileListener(socket)
+		socket.Close()
+		if err != nil {
+			return fmt.Errorf("listen-fd %d: %w", *fd, err)
+		}
+	}
+	return RunNode(config, listener, stop)
+}
+
+// ClusterCommand implements `wahello cluster up -n 7 -byzantine F`
+func ClusterCommand(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "up" {
+		return fmt.Errorf("usage: cluster up [-n nodes] [-byzantine ids] [-strategy name] [-scenario file] [-duration d] [-interval d] [-dir dir]")
+	}
+	flags := flag.NewFlagSet("cluster up", flag.ContinueOnError)
+	n := flags.Int("n", 4, "number of node processes")
+	byzantine := flags.String("byzantine", "", "comma-separated IDs of Byzantine nodes")
+	strategy := flags.String("strategy", "timestamp-inflation", fmt.Sprintf("strategy of the Byzantine nodes, one of %v", StrategyNames))
+	duration := flags.Duration("duration", 2*time.Second, "how long the cluster runs")
+	interval := flags.Duration("interval", DefaultClusterInterval, "how often each node sends a clock update")
+	dir := flags.String("dir", "", "directory for keys, configs and logs, kept afterwards; a temporary one if empty")
+	seed := flags.Int64("seed", 1, "seed of the Byzantine strategies and link drops")
+	scenarioPath := flags.String("scenario", "", "JSON or YAML scenario giving the nodes and links, in place of -n, -byzantine and -strategy")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *scenarioPath != "" {
+		var conflicting []string
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "n" || f.Name == "byzantine" || f.Name == "strategy" {
+				conflicting = append(conflicting, "-"+f.Name)
+			}
+		})
+		if len(conflicting) > 0 {
+			return fmt.Errorf("-scenario gives the nodes and their strategies, so it cannot be combined with %s", strings.Join(conflicting, " and "))
+		}
+	}
+	options := ClusterOptions{N: *n, Byzantine: make(map[string]string), Duration: *duration, Interval: *interval, Dir: *dir, Seed: *seed}
+	if *scenarioPath != "" {
+		scenario, err := LoadScenario(*scenarioPath)
+		if err != nil {
+			return err
+		}
+		options.Scenario = scenario
+		*n = len(scenario.Nodes)
+	}
+	for _, id := range strings.Split(*byzantine, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			options.Byzantine[id] = *strategy
+		}
+	}
+	fmt.Fprintf(stdout, "Starting %d node processes for %s\n", *n, *duration)
+	report, err := RunCluster(options)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(stdout, report.String())
+	return err
+}
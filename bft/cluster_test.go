@@ -0,0 +1,161 @@
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// spawnInProcess runs a cluster node as a goroutine instead of a process
+func spawnInProcess(t *testing.T) func(id, configPath, logPath string, listener net.Listener) (func() error, error) {
+	return func(id, configPath, logPath string, listener net.Listener) (func() error, error) {
+		config, err := LoadNodeConfig(configPath)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		stop := make(chan struct{})
+		done := make(chan error, 1)
+		go func() { done <- RunNode(config, listener, stop) }()
+		return func() error {
+			close(stop)
+			if err := <-done; err != nil {
+				t.Errorf("node %s: %v", id, err)
+			}
+			return nil
+		}, nil
+	}
+}
+
+// TestRunCluster tests that node processes exchanging updates over gRPC converge and catch the Byzantine node
+func TestRunCluster(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	dir := t.TempDir()
+	report, err := RunCluster(ClusterOptions{
+		N:         4,
+		Byzantine: map[string]string{"D": "timestamp-inflation"},
+		Duration:  300 * time.Millisecond,
+		Interval:  20 * time.Millisecond,
+		Dir:       dir,
+		Spawn:     spawnInProcess(t),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Converged {
+		t.Errorf("Expected the honest nodes to converge:\n%s", report)
+	}
+	if !report.Caught(2) || len(report.Detectors["D"]) != 3 {
+		t.Errorf("Expected every honest node to catch D:\n%s", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keys", "A", "A.key")); err != nil {
+		t.Errorf("Expected the cluster directory to hold the keys, got %v", err)
+	}
+}
+
+// TestRunClusterScenario tests that a cluster running a scenario gossips
+// only over its link directions that are up, never with a partitioned node
+func TestRunClusterScenario(t *testing.T) {
+	scenario, err := ParseScenario([]byte(`{
+		"name": "cluster", "leader": "A",
+		"nodes": [{"id": "A", "region": "r"}, {"id": "B", "region": "r"}, {"id": "C", "region": "r"},
+			{"id": "D", "region": "r"}, {"id": "E", "region": "r"}, {"id": "F", "region": "r", "byzantine": true}],
+		"links": [{"from": "A", "to": "B"}, {"from": "B", "to": "C", "reverse": {"down": true}},
+			{"from": "C", "to": "D", "one_way": true}, {"from": "A", "to": "E"}, {"from": "F", "to": "A"}],
+		"partitioned": ["E"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := RunCluster(ClusterOptions{
+		Scenario: scenario,
+		Duration: 300 * time.Millisecond,
+		Interval: 20 * time.Millisecond,
+		Dir:      t.TempDir(),
+		Spawn:    spawnInProcess(t),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Converged {
+		t.Errorf("Expected every honest node to hear from those reaching it:\n%s", report)
+	}
+	clocks := make(map[string]map[string]int64)
+	for _, status := range report.Nodes {
+		clocks[status.ID] = status.Clock
+	}
+	for _, unheard := range [][2]string{{"B", "C"}, {"C", "D"}, {"D", "A"}, {"A", "E"}, {"E", "A"}} {
+		if _, heard := clocks[unheard[0]][unheard[1]]; heard {
+			t.Errorf("Expected %s not to hear from %s:\n%s", unheard[0], unheard[1], report)
+		}
+	}
+	for _, heard := range [][2]string{{"B", "A"}, {"C", "B"}, {"D", "C"}} {
+		if _, exists := clocks[heard[0]][heard[1]]; !exists {
+			t.Errorf("Expected %s to hear from %s:\n%s", heard[0], heard[1], report)
+		}
+	}
+	if len(report.Detectors["F"]) == 0 {
+		t.Errorf("Expected F to be caught:\n%s", report)
+	}
+
+	scenario.Timeline = []string{"at t=1s crash A"}
+	if _, err := RunCluster(ClusterOptions{Scenario: scenario}); !errors.Is(err, ErrInvalidScenario) {
+		t.Errorf("Expected a scenario with a timeline to be refused, got %v", err)
+	}
+}
+
+// TestRunClusterRejectsForeignKeys tests that a node signing with a key the others do not hold is not heard from
+func TestRunClusterRejectsForeignKeys(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	dir := t.TempDir()
+	spawn := spawnInProcess(t)
+	report, err := RunCluster(ClusterOptions{
+		N:        3,
+		Duration: 200 * time.Millisecond,
+		Interval: 20 * time.Millisecond,
+		Dir:      dir,
+		Spawn: func(id, configPath, logPath string, listener net.Listener) (func() error, error) {
+			if id == "C" {
+				// C starts with keys of its own the others never saw
+				node, _ := NewNode("C", false, false)
+				node.SaveKeys(filepath.Join(dir, "keys", "C"))
+			}
+			return spawn(id, configPath, logPath, listener)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range report.Nodes {
+		if _, heard := status.Clock["C"]; heard && status.ID != "C" {
+			t.Errorf("Expected %s to reject C's updates", status.ID)
+		}
+	}
+}
+
+// TestClusterCommandUsage tests argument checking
+func TestClusterCommandUsage(t *testing.T) {
+	var out bytes.Buffer
+	if err := ClusterCommand(nil, &out); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("Expected a usage error, got %v", err)
+	}
+	if err := ClusterCommand([]string{"up", "-n", "3", "-byzantine", "Z"}, &out); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("Expected an unknown Byzantine node to be refused, got %v", err)
+	}
+	for _, args := range [][]string{{"up", "-scenario", "s.json", "-n", "5"}, {"up", "-byzantine", "F", "-scenario", "s.json"}} {
+		if err := ClusterCommand(args, &out); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+			t.Errorf("Expected %v to be refused, got %v", args, err)
+		}
+	}
+}
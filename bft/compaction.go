@@ -0,0 +1,390 @@
+package bft
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Log compaction.
+//
+// A replica's executed log grows without bound, yet auditors may need to
+// show long after the fact that a given request committed. Compact replaces
+// a range of executed entries with a LogSummary: the range, a Merkle root
+// over the entries' leaves and a history digest chaining the root to the
+// summary before it, signed by a quorum of replicas that computed the same
+// summary from their own logs. Each signing replica drops the range and
+// keeps, per compacted entry, an InclusionProof: the entry's sequence
+// number, view and request digest with its Merkle path to the root. A
+// verifier holding the replicas' public keys checks a proof offline with
+// VerifyInclusion: the summary must carry valid signatures of 2f+1
+// distinct replicas, f being the most the key set tolerates rather than
+// anything the summary claims, and the path must lead from the entry's leaf
+// to the signed root. Replicas that lag or disagree keep their log
+// uncompacted.
+//
+// The summary is also the replica's stable checkpoint: the slots, prepared
+// certificates and executed digests it covers are dropped, and view changes
+// carry the summary instead of them, so re-proposals start above it.
+//
+// Leaves and inner nodes are hashed with distinct prefixes, and an odd node
+// is carried up a level unhashed, so no two trees share a root.
+
+var (
+	ErrNothingToCompact   = errors.New("nothing to compact")
+	ErrNoCompactionQuorum = errors.New("no quorum agrees on the summary")
+	ErrInvalidLogSummary  = errors.New("invalid log summary")
+	ErrInvalidInclusion   = errors.New("inclusion proof does not match summary")
+	ErrNotCompacted       = errors.New("entry not compacted")
+)
+
+// LogSummary stands in for a compacted range of executed entries
+type LogSummary struct {
+	From    uint64            `json:"from"` // First sequence number covered
+	To      uint64            `json:"to"`   // Last sequence number covered
+	Count   int               `json:"count"`
+	Root    string            `json:"root"`    // Merkle root over the range's leaves
+	History string            `json:"history"` // Digest of every summary through this one
+	Acks    []Acknowledgement `json:"acks"`
+}
+
+// Signers returns the replicas that signed the summary
+func (s *LogSummary) Signers() []string {
+	signers := make([]string, len(s.Acks))
+	for i, ack := range s.Acks {
+		signers[i] = ack.Node
+	}
+	return signers
+}
+
+// InclusionProof shows that an entry is covered by a summary
+type InclusionProof struct {
+	Seq     uint64      `json:"seq"`
+	View    int64       `json:"view"`
+	Digest  string      `json:"digest"` // Request digest of the entry
+	Index   int         `json:"index"`  // Of the leaf in the range
+	Path    []string    `json:"path"`   // Sibling hashes from the leaf up, empty where a node was carried up
+	Summary *LogSummary `json:"summary"`
+}
+
+// leafHash hashes an executed entry
+func leafHash(seq uint64, view int64, digest string) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("\x00%d:%d:%s", seq, view, digest)))
+	return sum[:]
+}
+
+// nodeHash hashes two children
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleTree returns the root of leaves and the path of every leaf
+func merkleTree(leaves [][]byte) ([]byte, [][]string) {
+	paths := make([][]string, len(leaves))
+	positions := make([]int, len(leaves))
+	for i := range positions {
+		positions[i] = i
+	}
+	level := leaves
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, nodeHash(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		for leaf, pos := range positions {
+			sibling := pos ^ 1
+			if sibling < len(level) {
+				paths[leaf] = append(paths[leaf], hex.EncodeToString(level[sibling]))
+			} else {
+				paths[leaf] = append(paths[leaf], "")
+			}
+			positions[leaf] = pos / 2
+		}
+		level = next
+	}
+	return level[0], paths
+}
+
+// merkleRoot recomputes the root from a leaf, its index and its path
+func merkleRoot(leaf []byte, index int, path []string) ([]byte, error) {
+	hash := leaf
+	for _, sibling := range path {
+		if sibling != "" {
+			other, err := hex.DecodeString(sibling)
+			if err != nil {
+				return nil, err
+			}
+			if index%2 == 0 {
+				hash = nodeHash(hash, other)
+			} else {
+				hash = nodeHash(other, hash)
+			}
+		}
+		index /= 2
+	}
+	return hash, nil
+}
+
+// summaryDigest is what a replica signs to vouch for a summary
+func summaryDigest(summary *LogSummary) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("summary:%d:%d:%d:%s:%s", summary.From, summary.To, summary.Count, summary.Root, summary.History)))
+	return sum[:]
+}
+
+// summarize computes the replica's summary of its entries through seq,
+// with the leaf paths, or nil if it has not executed that far. The caller
+// must hold r.Lock.
+func (r *PBFTReplica) summarize(through uint64) (*LogSummary, []PBFTExecution, [][]string) {
+	if r.LastExecuted < through {
+		return nil, nil, nil
+	}
+	summary := &LogSummary{From: 1}
+	previous := ""
+	if n := len(r.Summaries); n > 0 {
+		summary.From = r.Summaries[n-1].To + 1
+		previous = r.Summaries[n-1].History
+	}
+	if through < summary.From {
+		return nil, nil, nil
+	}
+	summary.To = through
+	var entries []PBFTExecution
+	var leaves [][]byte
+	for _, execution := range r.Executed {
+		if execution.Seq >= summary.From && execution.Seq <= through {
+			entries = append(entries, execution)
+			leaves = append(leaves, leafHash(execution.Seq, execution.View, execution.Digest))
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil, nil
+	}
+	root, paths := merkleTree(leaves)
+	summary.Count = len(entries)
+	summary.Root = hex.EncodeToString(root)
+	history := sha256.Sum256([]byte(fmt.Sprintf("history:%s:%d:%s", previous, through, summary.Root)))
+	summary.History = hex.EncodeToString(history[:])
+	return summary, entries, paths
+}
+
+// compact replaces the summarized entries with the summary and their
+// proofs. The caller must hold r.Lock.
+func (r *PBFTReplica) compact(summary *LogSummary, entries []PBFTExecution, paths [][]string) {
+	if r.proofs == nil {
+		r.proofs = make(map[uint64]*InclusionProof)
+	}
+	for i, execution := range entries {
+		r.proofs[execution.Seq] = &InclusionProof{Seq: execution.Seq, View: execution.View, Digest: execution.Digest,
+			Index: i, Path: paths[i], Summary: summary}
+	}
+	kept := r.Executed[:0]
+	for _, execution := range r.Executed {
+		if execution.Seq > summary.To {
+			kept = append(kept, execution)
+		} else {
+			delete(r.done, execution.Digest)
+		}
+	}
+	r.Executed = kept
+	for seq := range r.slots {
+		if seq <= summary.To {
+			delete(r.slots, seq)
+		}
+	}
+	for seq := range r.certs {
+		if seq <= summary.To {
+			delete(r.certs, seq)
+		}
+	}
+	r.Summaries = append(r.Summaries, summary)
+}
+
+// catchUp compacts the replica with the checkpoints after its own whose
+// summary it computes alike. The caller must hold r.Lock.
+func (r *PBFTReplica) catchUp(checkpoints []*LogSummary) {
+	var last uint64
+	if n := len(r.Summaries); n > 0 {
+		last = r.Summaries[n-1].To
+	}
+	for _, checkpoint := range checkpoints {
+		if checkpoint.To <= last {
+			continue
+		}
+		summary, entries, paths := r.summarize(checkpoint.To)
+		if summary == nil || !bytes.Equal(summaryDigest(summary), summaryDigest(checkpoint)) {
+			return
+		}
+		r.compact(checkpoint, entries, paths)
+	}
+}
+
+// ProveInclusion returns the retained proof of a compacted entry
+func (r *PBFTReplica) ProveInclusion(seq uint64) (*InclusionProof, error) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	proof, exists := r.proofs[seq]
+	if !exists {
+		return nil, fmt.Errorf("%w: seq %d at %s", ErrNotCompacted, seq, r.Node.ID)
+	}
+	return proof, nil
+}
+
+// Compact summarizes every replica's executed entries through seq. The
+// replicas that computed the most common summary sign it, and if they are
+// a quorum they compact their logs with it.
+func (p *PBFT) Compact(through uint64) (*LogSummary, error) {
+	type candidate struct {
+		replica *PBFTReplica
+		summary *LogSummary
+		entries []PBFTExecution
+		paths   [][]string
+	}
+	groups := make(map[string][]candidate)
+	var best string
+	for _, id := range sortedKeys(p.Replicas) {
+		replica := p.Replicas[id]
+		replica.Lock.Lock()
+		summary, entries, paths := replica.summarize(through)
+		replica.Lock.Unlock()
+		if summary == nil {
+			continue
+		}
+		key := hex.EncodeToString(summaryDigest(summary))
+		groups[key] = append(groups[key], candidate{replica, summary, entries, paths})
+		if len(groups[key]) > len(groups[best]) {
+			best = key
+		}
+	}
+	agreeing := groups[best]
+	if len(agreeing) == 0 {
+		return nil, fmt.Errorf("%w through seq %d", ErrNothingToCompact, through)
+	}
+	quorum := agreeing[0].replica.quorum(through)
+	if len(agreeing) < quorum {
+		return nil, fmt.Errorf("%w: %d of %d needed", ErrNoCompactionQuorum, len(agreeing), quorum)
+	}
+	summary := agreeing[0].summary
+	for _, c := range agreeing {
+		c.replica.Node.Lock.RLock()
+		signature, err := crypto.Sign(c.replica.Node.PrivateKey, summaryDigest(summary))
+		c.replica.Node.Lock.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		summary.Acks = append(summary.Acks, Acknowledgement{Node: c.replica.Node.ID, Signature: signature})
+	}
+	for _, c := range agreeing {
+		c.replica.Lock.Lock()
+		c.replica.compact(summary, c.entries, c.paths)
+		c.replica.Lock.Unlock()
+	}
+	return summary, nil
+}
+
+// VerifySummary checks that 2f+1 distinct replicas signed the summary, f
+// being the most the keys tolerate
+func VerifySummary(summary *LogSummary, keys map[string]crypto.PublicKey) error {
+	need := 2*((len(keys)-1)/3) + 1
+	signed := make(map[string]bool)
+	for _, ack := range summary.Acks {
+		key, exists := keys[ack.Node]
+		if !exists || signed[ack.Node] {
+			continue
+		}
+		if crypto.Verify(key, summaryDigest(summary), ack.Signature) == nil {
+			signed[ack.Node] = true
+		}
+	}
+	if len(signed) < need {
+		return fmt.Errorf("%w: %d valid signatures, need %d", ErrInvalidLogSummary, len(signed), need)
+	}
+	return nil
+}
+
+// VerifyInclusion checks that the proof's entry is covered by its summary
+// and that a quorum of replicas signed the summary
+func VerifyInclusion(proof *InclusionProof, keys map[string]crypto.PublicKey) error {
+	summary := proof.Summary
+	if summary == nil {
+		return fmt.Errorf("%w: no summary", ErrInvalidInclusion)
+	}
+	if err := VerifySummary(summary, keys); err != nil {
+		return err
+	}
+	if proof.Seq < summary.From || proof.Seq > summary.To || proof.Index < 0 || proof.Index >= summary.Count {
+		return fmt.Errorf("%w: seq %d at leaf %d outside %d-%d", ErrInvalidInclusion, proof.Seq, proof.Index, summary.From, summary.To)
+	}
+	root, err := merkleRoot(leafHash(proof.Seq, proof.View, proof.Digest), proof.Index, proof.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInclusion, err)
+	}
+	if hex.EncodeToString(root) != summary.Root {
+		return fmt.Errorf("%w: seq %d does not lead to root %s", ErrInvalidInclusion, proof.Seq, summary.Root)
+	}
+	return nil
+}
+
+// ExportInclusionProof writes a proof with its summary to path as JSON
+func ExportInclusionProof(path string, proof *InclusionProof) error {
+	data, err := json.MarshalIndent(proof, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// VerifyInclusionFile reads the proof at path and checks it against keys
+func VerifyInclusionFile(path string, keys map[string]crypto.PublicKey) (*InclusionProof, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var proof InclusionProof
+	if err := decoder.Decode(&proof); err != nil {
+		return nil, fmt.Errorf("proof %s: %w", path, err)
+	}
+	return &proof, VerifyInclusion(&proof, keys)
+}
+
+// VerifyInclusionCommand implements `wahello verify-inclusion -proof file
+// -keys dir`
+func VerifyInclusionCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("verify-inclusion", flag.ContinueOnError)
+	path := flags.String("proof", "", "JSON file with the inclusion proof and its summary")
+	dir := flags.String("keys", "", "directory of the nodes' exported public keys")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" || *dir == "" {
+		return fmt.Errorf("usage: verify-inclusion -proof file -keys dir")
+	}
+	keys, err := LoadKeys(*dir)
+	if err != nil {
+		return err
+	}
+	proof, err := VerifyInclusionFile(*path, keys)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "Request %s committed at seq %d in view %d, compacted into seq %d-%d signed by %d replicas\n",
+		proof.Digest, proof.Seq, proof.View, proof.Summary.From, proof.Summary.To, len(proof.Summary.Acks))
+	return err
+}
@@ -0,0 +1,205 @@
+package bft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// runUpdates has PBFT order n clock updates from A and returns their digests
+func runUpdates(t *testing.T, pbft *PBFT, n int) []string {
+	var digests []string
+	for i := 0; i < n; i++ {
+		digest, err := pbft.SubmitClockUpdate(pbft.System.Nodes["A"].GetClockUpdate())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pbft.Run()
+		digests = append(digests, digest)
+	}
+	return digests
+}
+
+// pbftKeys returns the replicas' public keys
+func pbftKeys(pbft *PBFT) map[string]crypto.PublicKey {
+	keys := make(map[string]crypto.PublicKey)
+	for id, replica := range pbft.Replicas {
+		keys[id] = replica.Node.PublicKey
+	}
+	return keys
+}
+
+// TestCompactionProvesOldCommits tests that compacted entries are still provable from the signed summaries
+func TestCompactionProvesOldCommits(t *testing.T) {
+	pbft := newPBFT(t)
+	digests := runUpdates(t, pbft, 7)
+	first, err := pbft.Compact(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pbft.Compact(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.From != 1 || first.To != 5 || first.Count != 5 || second.From != 6 || len(second.Acks) != 4 {
+		t.Errorf("Expected seq 1-5 and 6-7 signed by all, got %+v and %+v", first, second)
+	}
+	if first.History == second.History {
+		t.Error("Expected the history digest to chain across summaries")
+	}
+	replica := pbft.Replicas["C"]
+	if len(replica.Executed) != 0 || len(replica.Summaries) != 2 {
+		t.Errorf("Expected C's log replaced by two summaries, got %d entries", len(replica.Executed))
+	}
+
+	keys := pbftKeys(pbft)
+	for seq := uint64(1); seq <= 7; seq++ {
+		proof, err := replica.ProveInclusion(seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.Digest != digests[seq-1] {
+			t.Errorf("Expected seq %d to prove %s, got %s", seq, digests[seq-1], proof.Digest)
+		}
+		if err := VerifyInclusion(proof, keys); err != nil {
+			t.Errorf("Expected seq %d to verify, got %v", seq, err)
+		}
+	}
+
+	// Forged entries and summaries are refused
+	proof, _ := replica.ProveInclusion(3)
+	forged := *proof
+	forged.Digest = digests[0]
+	if err := VerifyInclusion(&forged, keys); !errors.Is(err, ErrInvalidInclusion) {
+		t.Errorf("Expected a forged digest to be refused, got %v", err)
+	}
+	summary := *proof.Summary
+	summary.Acks = summary.Acks[:2]
+	forged = *proof
+	forged.Summary = &summary
+	if err := VerifyInclusion(&forged, keys); !errors.Is(err, ErrInvalidLogSummary) {
+		t.Errorf("Expected a summary short of a quorum to be refused, got %v", err)
+	}
+	if _, err := pbft.Compact(7); !errors.Is(err, ErrNothingToCompact) {
+		t.Errorf("Expected nothing left to compact, got %v", err)
+	}
+}
+
+// TestCompactionNeedsQuorum tests that replicas that have not executed a range cannot compact it
+func TestCompactionNeedsQuorum(t *testing.T) {
+	pbft := newPBFT(t)
+	runUpdates(t, pbft, 2)
+	for _, id := range []string{"B", "C"} {
+		pbft.Replicas[id].LastExecuted = 1
+	}
+	if _, err := pbft.Compact(2); !errors.Is(err, ErrNoCompactionQuorum) {
+		t.Errorf("Expected two of four replicas to fall short, got %v", err)
+	}
+	if len(pbft.Replicas["A"].Executed) != 2 {
+		t.Error("Expected A to keep its log")
+	}
+}
+
+// TestCompactionIsViewChangeCheckpoint tests that compaction drops the
+// state it covers and that view changes re-propose only above it
+func TestCompactionIsViewChangeCheckpoint(t *testing.T) {
+	pbft := newPBFT(t)
+	runUpdates(t, pbft, 20)
+	if _, err := pbft.Compact(15); err != nil {
+		t.Fatal(err)
+	}
+	for id, replica := range pbft.Replicas {
+		if len(replica.Executed) != 5 || len(replica.slots) != 5 || len(replica.certs) != 5 || len(replica.done) != 5 {
+			t.Errorf("Expected %s to keep seq 16-20 only, got %d executed, %d slots, %d certs, %d done",
+				id, len(replica.Executed), len(replica.slots), len(replica.certs), len(replica.done))
+		}
+	}
+
+	live := []string{"B", "C", "D"}
+	for _, id := range live {
+		replica := pbft.Replicas[id]
+		replica.Lock.Lock()
+		replica.startViewChange(1)
+		replica.Lock.Unlock()
+	}
+	var nv NewView
+	routePBFT(t, pbft, live, func(m Message) bool {
+		if announce, ok := m.(*NewViewAnnouncement); ok {
+			json.Unmarshal(announce.Proof, &nv)
+		}
+		return false
+	})
+	if nv.Stable != 15 || len(nv.Proposals) != 5 || nv.Proposals[0].Seq != 16 {
+		t.Errorf("Expected view 1 to re-propose seq 16-20 above the checkpoint, got stable %d and %d proposals", nv.Stable, len(nv.Proposals))
+	}
+
+	for _, id := range live {
+		pbft.Replicas[id].Request([]byte("op-21"))
+	}
+	routePBFT(t, pbft, live, nil)
+	for _, id := range live {
+		if executed := pbft.Replicas[id].Executed; executed[len(executed)-1].Seq != 21 {
+			t.Errorf("Expected %s to execute the next request at seq 21, got %+v", id, executed[len(executed)-1])
+		}
+	}
+}
+
+// TestPBFTCheckpointsBoundViewChanges tests that periodic checkpoints keep
+// view changes from carrying the whole history
+func TestPBFTCheckpointsBoundViewChanges(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.CheckpointInterval = 8
+	runUpdates(t, pbft, 20)
+
+	for id, replica := range pbft.Replicas {
+		if len(replica.Summaries) != 2 || len(replica.certs) != 4 || len(replica.slots) != 4 {
+			t.Errorf("Expected %s to checkpoint at seq 16 and keep 4 entries, got %d summaries, %d certs, %d slots",
+				id, len(replica.Summaries), len(replica.certs), len(replica.slots))
+		}
+	}
+	b := pbft.Replicas["B"]
+	b.Lock.Lock()
+	b.startViewChange(1)
+	b.Lock.Unlock()
+	sends, _ := b.drain()
+	change := sends[0].Msg.(*ViewChangeRequest)
+	var certs []PreparedCert
+	if err := json.Unmarshal(change.Prepared, &certs); err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 4 || certs[0].Seq != 17 || len(change.Checkpoint) == 0 {
+		t.Errorf("Expected B's view change to carry the checkpoint and seq 17-20, got %d certificates", len(certs))
+	}
+}
+
+// TestVerifyInclusionCommand tests the offline check of an exported proof
+func TestVerifyInclusionCommand(t *testing.T) {
+	pbft := newPBFT(t)
+	runUpdates(t, pbft, 3)
+	if _, err := pbft.Compact(3); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := pbft.System.ExportKeys(filepath.Join(dir, "keys")); err != nil {
+		t.Fatal(err)
+	}
+	proof, err := pbft.Replicas["B"].ProveInclusion(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "proof.json")
+	if err := ExportInclusionProof(path, proof); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := VerifyInclusionCommand([]string{"-proof", path, "-keys", filepath.Join(dir, "keys")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("seq 2")) {
+		t.Errorf("Expected the report to name seq 2, got %q", out.String())
+	}
+}
@@ -0,0 +1,203 @@
+package bft
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Confidential payloads.
+//
+// Consensus needs to agree on the order of writes, not to read them. With a
+// PayloadPolicy set, every value is sealed with AES-256-GCM before it is
+// proposed, so the leader signs, replicates and persists the ciphertext and
+// whoever sees only the log, the WAL, a snapshot or the wire learns keys and
+// versions but no values. Values are sealed per scope: a namespace the
+// policy restricts has a key of its own, granted only to the nodes that own
+// it, and every other key shares the cluster key, granted to every member
+// that is not an observer. The sealed value authenticates its key, so a
+// ciphertext cannot be moved under another key. A node serves a read by
+// opening the value with the keys it holds and refuses with
+// ErrPayloadSealed when it has none for the scope. Keys come from a
+// KeySource like the at-rest keys, under the pseudo node ID payload/<scope>.
+// A removed node keeps the keys it was granted; excluding it from later
+// writes needs a new policy with a fresh source.
+
+var ErrPayloadSealed = errors.New("payload sealed")
+
+// clusterScope is the scope of keys in no restricted namespace
+const clusterScope = ""
+
+// PayloadPolicy decides how written values are sealed and which nodes can
+// open them
+type PayloadPolicy struct {
+	Source     KeySource
+	Restricted map[string][]string // Namespace -> the nodes that own it
+	Observers  map[string]bool     // Nodes that replicate without reading
+	Lock       sync.Mutex
+	keyrings   map[string]*Keyring // By scope
+}
+
+// NewPayloadPolicy creates a policy sealing every value under the cluster
+// key from source
+func NewPayloadPolicy(source KeySource) *PayloadPolicy {
+	return &PayloadPolicy{
+		Source:     source,
+		Restricted: make(map[string][]string),
+		Observers:  make(map[string]bool),
+		keyrings:   make(map[string]*Keyring),
+	}
+}
+
+// Restrict seals the values of a namespace under a key only owners hold.
+// Like Observe, it takes effect when the policy is put in use.
+func (p *PayloadPolicy) Restrict(namespace string, owners ...string) {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	p.Restricted[namespace] = append([]string(nil), owners...)
+}
+
+// Observe makes nodes observers, which replicate sealed values without a
+// key to open any of them
+func (p *PayloadPolicy) Observe(ids ...string) {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	for _, id := range ids {
+		p.Observers[id] = true
+	}
+}
+
+// scope returns the scope a key's value is sealed in. The caller must hold
+// p.Lock.
+func (p *PayloadPolicy) scope(key string) string {
+	if namespace := Namespace(key); namespace != "" {
+		if _, restricted := p.Restricted[namespace]; restricted {
+			return namespace
+		}
+	}
+	return clusterScope
+}
+
+// keyring returns the keyring of a scope. The caller must hold p.Lock.
+func (p *PayloadPolicy) keyring(scope string) (*Keyring, error) {
+	if keyring, exists := p.keyrings[scope]; exists {
+		return keyring, nil
+	}
+	keyring, err := NewKeyring("payload/"+scope, p.Source, 1)
+	if err != nil {
+		return nil, err
+	}
+	p.keyrings[scope] = keyring
+	return keyring, nil
+}
+
+// scopes returns the scopes a node is granted, in order. The caller must
+// hold p.Lock.
+func (p *PayloadPolicy) scopes(id string) []string {
+	var scopes []string
+	if !p.Observers[id] {
+		scopes = append(scopes, clusterScope)
+	}
+	for namespace, owners := range p.Restricted {
+		if containsID(owners, id) {
+			scopes = append(scopes, namespace)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// seal returns the entry with its value sealed, unchanged without a policy
+// or for a no-op entry
+func (p *PayloadPolicy) seal(entry Entry) (Entry, error) {
+	if p == nil || entry.Key == "" || entry.Sealed {
+		return entry, nil
+	}
+	p.Lock.Lock()
+	keyring, err := p.keyring(p.scope(entry.Key))
+	p.Lock.Unlock()
+	if err != nil {
+		return entry, err
+	}
+	sealed, err := keyring.Seal([]byte(entry.Key), []byte(entry.Value))
+	if err != nil {
+		return entry, err
+	}
+	entry.Value, entry.Sealed = base64.StdEncoding.EncodeToString(sealed), true
+	return entry, nil
+}
+
+// UseConfidentialPayloads seals values written from now on under policy
+// and grants every node the keys of its scopes
+func (s *System) UseConfidentialPayloads(policy *PayloadPolicy) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.Payloads = policy
+	for _, id := range sortedKeys(s.Nodes) {
+		if err := s.grantPayloads(s.Nodes[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grantPayloads hands a node the keys of the scopes the policy grants it,
+// replacing any it held. The caller must hold s.Lock.
+func (s *System) grantPayloads(node *Node) error {
+	if s.Payloads == nil {
+		return nil
+	}
+	s.Payloads.Lock.Lock()
+	defer s.Payloads.Lock.Unlock()
+	keys := make(map[string]*Keyring)
+	for _, scope := range s.Payloads.scopes(node.ID) {
+		keyring, err := s.Payloads.keyring(scope)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", node.ID, err)
+		}
+		keys[scope] = keyring
+	}
+	node.Lock.Lock()
+	defer node.Lock.Unlock()
+	node.Payloads = keys
+	return nil
+}
+
+// plaintext returns an entry's value, opening it if it is sealed. A value
+// in a namespace is tried under the namespace key, then the cluster key it
+// was sealed under if the namespace was restricted after the write. The
+// caller must hold n.Lock.
+func (n *Node) plaintext(entry Entry) (string, error) {
+	if !entry.Sealed {
+		return entry.Value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(entry.Value)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrDecrypt, entry.Key, err)
+	}
+	err = fmt.Errorf("%w: node %s holds no key for %s", ErrPayloadSealed, n.ID, entry.Key)
+	for _, scope := range []string{Namespace(entry.Key), clusterScope} {
+		keyring, exists := n.Payloads[scope]
+		if !exists {
+			continue
+		}
+		plaintext, openErr := keyring.Open([]byte(entry.Key), sealed)
+		if openErr == nil {
+			return string(plaintext), nil
+		}
+		if scope != clusterScope || Namespace(entry.Key) == "" {
+			err = openErr
+		}
+	}
+	return "", err
+}
+
+// Plaintext returns the value the node holds for key, opened with its own
+// payload keys
+func (n *Node) Plaintext(key string) (string, error) {
+	n.Lock.RLock()
+	defer n.Lock.RUnlock()
+	return n.plaintext(n.Store.Entries[key])
+}
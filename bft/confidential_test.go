@@ -0,0 +1,99 @@
+package bft
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newConfidentialSystem builds the geo system with values sealed, secrets/
+// restricted to A and B and G an observer
+func newConfidentialSystem(t *testing.T) *System {
+	system := newGeoSystem(t)
+	policy := NewPayloadPolicy(SecretKeySource{Secret: []byte("payload secret for tests")})
+	policy.Restrict("secrets", "A", "B")
+	policy.Observe("G")
+	if err := system.UseConfidentialPayloads(policy); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{"x": "hello", "secrets/pin": "1234"} {
+		if _, err := system.SubmitWrite("us-east", "A", key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return system
+}
+
+// TestConfidentialPayloads tests that replicas hold ciphertext only members, or a namespace's owners, can open
+func TestConfidentialPayloads(t *testing.T) {
+	system := newConfidentialSystem(t)
+	stored := system.Nodes["G"].Store.Entries["x"]
+	if !stored.Sealed || strings.Contains(stored.Value, "hello") {
+		t.Fatalf("Expected the observer to replicate ciphertext, got %+v", stored)
+	}
+	if read, err := system.Read("us-east", "x"); err != nil || read.Value != "hello" {
+		t.Errorf("Expected the leader to read hello, got %v, %v", read, err)
+	}
+	for _, c := range []struct {
+		node, key, value string
+		sealed           bool
+	}{
+		{"D", "x", "hello", false},
+		{"G", "x", "", true},
+		{"D", "secrets/pin", "", true},
+		{"B", "secrets/pin", "1234", false},
+	} {
+		read, err := system.LocalRead("eu-west", c.node, c.key)
+		if c.sealed {
+			if !errors.Is(err, ErrPayloadSealed) {
+				t.Errorf("Expected %s to be refused %s, got %v", c.node, c.key, err)
+			}
+		} else if err != nil || read.Value != c.value {
+			t.Errorf("Expected %s to read %s=%s, got %v, %v", c.node, c.key, c.value, read, err)
+		}
+	}
+
+	// A ciphertext moved under another key fails to open
+	b := system.Nodes["B"]
+	b.Store.Entries["y"] = Entry{Index: stored.Index, Key: "y", Value: stored.Value, Sealed: true}
+	if _, err := b.Plaintext("y"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected a moved ciphertext to fail authentication, got %v", err)
+	}
+}
+
+// TestConfidentialBatchAndAdmission tests batches over sealed values and that admitted members get the keys
+func TestConfidentialBatchAndAdmission(t *testing.T) {
+	system := newConfidentialSystem(t)
+	batch, err := system.SubmitBatch("us-east", "B", []BatchOp{
+		{Kind: OpRead, Key: "x"},
+		{Kind: OpWrite, Key: "z", Value: "batched"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Results[0].Value != "hello" {
+		t.Errorf("Expected the batch to read hello, got %q", batch.Results[0].Value)
+	}
+	if entry := system.Nodes["D"].Store.Entries["z"]; !entry.Sealed {
+		t.Errorf("Expected the batched write sealed, got %+v", entry)
+	}
+
+	h, err := NewNode("H", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := system.AdmitNode(h); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"x", "secrets/pin"} {
+		if _, err := system.SubmitWrite("us-east", "A", key, "again"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, err := h.Plaintext("x"); err != nil || value != "again" {
+		t.Errorf("Expected the admitted node to read again, got %q, %v", value, err)
+	}
+	if _, err := h.Plaintext("secrets/pin"); !errors.Is(err, ErrPayloadSealed) {
+		t.Errorf("Expected the admitted node to be refused the secrets, got %v", err)
+	}
+}
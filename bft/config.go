@@ -0,0 +1,241 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+)
+
+// Live configuration reload.
+//
+// A node reads its tunables from a JSON file at startup. On SIGHUP, or when
+// an operator posts a new config to the admin API, the file or request body
+// is parsed and validated in full before anything changes. A valid config
+// replaces the current one in a single atomic swap, so readers see either
+// the old or the new tunables and never a mix. An invalid config is rejected
+// and the node keeps running with what it had. The simulation reads the
+// tunables of DefaultConfig as each section that uses them starts, so a
+// change applies from the next such section on.
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// DefaultConfig holds the running node's tunables; nil runs on the defaults
+var DefaultConfig *ConfigReloader
+
+// LogLevels are the accepted values of Tunables.LogLevel
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// Tunables are the settings that may change while a node runs
+type Tunables struct {
+	ElectionTimeout  int    `json:"election_timeout_ticks"`
+	RequestTimeoutMs int    `json:"request_timeout_ms"`
+	BatchSize        int    `json:"batch_size"`
+	GossipFanout     int    `json:"gossip_fanout"`
+	LogLevel         string `json:"log_level"`
+
+	// Degradation maps namespaces to the policy for writes without a
+	// quorum. The simulation queues orders and merges carts if it is empty.
+	Degradation map[string]DegradationPolicy `json:"degradation,omitempty"`
+}
+
+// DefaultTunables returns the settings used when no config file is given
+func DefaultTunables() *Tunables {
+	return &Tunables{
+		ElectionTimeout:  10,
+		RequestTimeoutMs: 1000,
+		BatchSize:        64,
+		GossipFanout:     3,
+		LogLevel:         "info",
+	}
+}
+
+// Validate checks every field and reports the first problem
+func (t *Tunables) Validate() error {
+	switch {
+	case t.ElectionTimeout < 1:
+		return fmt.Errorf("%w: election_timeout_ticks must be at least 1", ErrInvalidConfig)
+	case t.RequestTimeoutMs < 1:
+		return fmt.Errorf("%w: request_timeout_ms must be at least 1", ErrInvalidConfig)
+	case t.BatchSize < 1:
+		return fmt.Errorf("%w: batch_size must be at least 1", ErrInvalidConfig)
+	case t.GossipFanout < 1:
+		return fmt.Errorf("%w: gossip_fanout must be at least 1", ErrInvalidConfig)
+	}
+	for namespace, policy := range t.Degradation {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("%w: degradation for namespace %q: %v", ErrInvalidConfig, namespace, err)
+		}
+	}
+	for _, level := range LogLevels {
+		if t.LogLevel == level {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unknown log_level %q", ErrInvalidConfig, t.LogLevel)
+}
+
+// currentTunables returns the tunables of DefaultConfig, or the defaults
+func currentTunables() *Tunables {
+	if DefaultConfig == nil {
+		return DefaultTunables()
+	}
+	return DefaultConfig.Current()
+}
+
+// ParseTunables decodes a config, filling omitted fields with defaults
+func ParseTunables(data []byte) (*Tunables, error) {
+	t := DefaultTunables()
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ConfigReloader holds a node's current tunables and replaces them on reload
+type ConfigReloader struct {
+	Path     string
+	OnChange func(old, new *Tunables) // Called after each successful swap
+	Lock     sync.Mutex               // Serializes reloads
+	current  atomic.Pointer[Tunables]
+}
+
+// NewConfigReloader loads the config at path, or the defaults if path is empty
+func NewConfigReloader(path string) (*ConfigReloader, error) {
+	r := &ConfigReloader{Path: path}
+	if path == "" {
+		r.current.Store(DefaultTunables())
+		return r, nil
+	}
+	t, err := loadTunables(path)
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(t)
+	return r, nil
+}
+
+// loadTunables reads and validates a config file
+func loadTunables(path string) (*Tunables, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := ParseTunables(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Current returns the tunables in effect. Callers must not modify them.
+func (r *ConfigReloader) Current() *Tunables {
+	return r.current.Load()
+}
+
+// Reload re-reads the config file and applies it if valid
+func (r *ConfigReloader) Reload() (*Tunables, error) {
+	if r.Path == "" {
+		return r.Current(), nil
+	}
+	t, err := loadTunables(r.Path)
+	if err != nil {
+		return nil, err
+	}
+	return t, r.Apply(t)
+}
+
+// Apply validates t and makes it the current config
+func (r *ConfigReloader) Apply(t *Tunables) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	old := r.current.Swap(t)
+	if r.OnChange != nil {
+		r.OnChange(old, t)
+	}
+	return nil
+}
+
+// WatchSignals reloads the config on every SIGHUP until stop is closed.
+// Failed reloads are passed to report and leave the config unchanged. It
+// does nothing on platforms without SIGHUP.
+func (r *ConfigReloader) WatchSignals(stop <-chan struct{}, report func(error)) {
+	if len(reloadSignals) == 0 {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, reloadSignals...)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-signals:
+				if _, err := r.Reload(); err != nil && report != nil {
+					report(err)
+				}
+			}
+		}
+	}()
+}
+
+// AdminHandler serves the config admin API. GET /config returns the current
+// tunables; POST /config sets the tunables in the body, keeping the others
+// and merging degradation policies into the current ones; POST /reload
+// re-reads the config file.
+func (r *ConfigReloader) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config", func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, r.Current())
+		case http.MethodPost:
+			t := *r.Current()
+			// Decode into a map of our own, not the one current shares
+			t.Degradation = maps.Clone(t.Degradation)
+			if err := json.NewDecoder(req.Body).Decode(&t); err != nil {
+				http.Error(w, fmt.Sprintf("%v: %v", ErrInvalidConfig, err), http.StatusBadRequest)
+				return
+			}
+			if err := r.Apply(&t); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusOK, &t)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		t, err := r.Reload()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	})
+	return mux
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,115 @@
+package bft
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseTunables tests defaults and validation of config files
+func TestParseTunables(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"empty object uses defaults", `{}`, true},
+		{"partial override", `{"batch_size": 128, "log_level": "debug"}`, true},
+		{"zero timeout", `{"election_timeout_ticks": 0}`, false},
+		{"negative fanout", `{"gossip_fanout": -1}`, false},
+		{"unknown log level", `{"log_level": "verbose"}`, false},
+		{"malformed json", `{"batch_size": `, false},
+	}
+	for _, tt := range tests {
+		_, err := ParseTunables([]byte(tt.data))
+		if tt.valid && err != nil {
+			t.Errorf("%s: Expected valid config, got %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: Expected ErrInvalidConfig, got %v", tt.name, err)
+		}
+	}
+}
+
+// writeConfig writes a config file for a test
+func writeConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReloadKeepsConfigOnError tests that an invalid reload changes nothing
+func TestReloadKeepsConfigOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.json")
+	writeConfig(t, path, `{"batch_size": 32}`)
+	reloader, err := NewConfigReloader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes int
+	reloader.OnChange = func(old, new *Tunables) { changes++ }
+
+	writeConfig(t, path, `{"batch_size": 0}`)
+	if _, err := reloader.Reload(); err == nil {
+		t.Errorf("Expected invalid reload to fail")
+	}
+	if reloader.Current().BatchSize != 32 || changes != 0 {
+		t.Errorf("Expected config to stay at batch size 32, got %d", reloader.Current().BatchSize)
+	}
+
+	writeConfig(t, path, `{"batch_size": 256, "gossip_fanout": 5}`)
+	if _, err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if current := reloader.Current(); current.BatchSize != 256 || current.GossipFanout != 5 || changes != 1 {
+		t.Errorf("Expected reloaded config, got %+v after %d changes", current, changes)
+	}
+}
+
+// TestAdminAPI tests reading and replacing the config over HTTP
+func TestAdminAPI(t *testing.T) {
+	reloader, err := NewConfigReloader("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(reloader.AdminHandler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/config", "application/json", strings.NewReader(`{"gossip_fanout": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || reloader.Current().GossipFanout != 3 {
+		t.Errorf("Expected invalid config to be rejected, got status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL+"/config", "application/json", strings.NewReader(`{"gossip_fanout": 7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || reloader.Current().GossipFanout != 7 {
+		t.Errorf("Expected fanout 7, got status %d and fanout %d", resp.StatusCode, reloader.Current().GossipFanout)
+	}
+
+	// Fields left out keep the values set before
+	before := reloader.Current()
+	for _, body := range []string{`{"degradation": {"cart": "crdt"}}`, `{"batch_size": 16, "degradation": {"orders": "queue"}}`} {
+		resp, err = http.Post(server.URL+"/config", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	current := reloader.Current()
+	if current.GossipFanout != 7 || current.BatchSize != 16 || len(current.Degradation) != 2 || before.Degradation != nil {
+		t.Errorf("Expected fanout 7, batch size 16 and two policies set without changing the old config, got %+v", current)
+	}
+}
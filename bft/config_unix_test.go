@@ -0,0 +1,43 @@
+//go:build unix
+
+package bft
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestSIGHUPReload tests that a SIGHUP re-reads the config file
+func TestSIGHUPReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.json")
+	writeConfig(t, path, `{"log_level": "info"}`)
+	reloader, err := NewConfigReloader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := make(chan *Tunables, 1)
+	reloader.OnChange = func(old, new *Tunables) { changed <- new }
+	stop := make(chan struct{})
+	defer close(stop)
+	reloader.WatchSignals(stop, nil)
+
+	writeConfig(t, path, `{"log_level": "debug"}`)
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := self.Signal(syscall.SIGHUP); err != nil {
+		t.Skipf("cannot signal self: %v", err)
+	}
+	select {
+	case tunables := <-changed:
+		if tunables.LogLevel != "debug" {
+			t.Errorf("Expected log level debug, got %s", tunables.LogLevel)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected SIGHUP to reload the config")
+	}
+}
@@ -0,0 +1,167 @@
+package bft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Replicated configuration keyspace.
+//
+// Tunables set through a node's admin API only reach that node. The
+// replicated keyspace instead sets one tunable, by its JSON name, for every
+// PBFT replica at once: the change is a ConfigChange entry ordered like any
+// request, so it needs the same 2f+1 quorum and survives the same faults,
+// and every replica applies it at the same sequence number. Each change
+// names the version it creates, one past the version it was proposed
+// against. A replica skips a change that does not follow its latest
+// version or that leaves the tunables invalid, and since every replica
+// executes the same entries in the same order, all of them skip it alike.
+// A replica's tunables are swapped atomically through a ConfigReloader, and
+// code running on the node watches them for changes.
+
+var ErrConfigConflict = errors.New("configuration changed concurrently")
+
+// ConfigChange is a configuration entry setting one tunable
+type ConfigChange struct {
+	Version int64
+	Key     string // JSON name of the tunable
+	Value   string // JSON encoding of its new value
+}
+
+// ConfigStore is a replica's copy of the replicated configuration
+type ConfigStore struct {
+	Version  int64             // Version of the latest applied change
+	Keys     map[string]string // JSON value of every key set so far
+	Lock     sync.Mutex
+	reloader *ConfigReloader
+	watchers []func(old, new *Tunables)
+}
+
+// NewConfigStore creates a store holding the default tunables at version 0
+func NewConfigStore() *ConfigStore {
+	c := &ConfigStore{Keys: make(map[string]string)}
+	c.reloader, _ = NewConfigReloader("")
+	c.reloader.OnChange = func(old, new *Tunables) {
+		for _, watch := range c.watchers {
+			watch(old, new)
+		}
+	}
+	return c
+}
+
+// Current returns the tunables in effect. Callers must not modify them.
+func (c *ConfigStore) Current() *Tunables {
+	return c.reloader.Current()
+}
+
+// Watch calls fn after every applied change with the old and new tunables
+func (c *ConfigStore) Watch(fn func(old, new *Tunables)) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	c.watchers = append(c.watchers, fn)
+}
+
+// set returns the tunables with key set to the JSON value, without
+// applying them
+func (c *ConfigStore) set(key, value string) (*Tunables, error) {
+	current := c.Current()
+	t := *current
+	if key == "degradation" {
+		// The value replaces the policies instead of merging into the
+		// map shared with the current tunables
+		t.Degradation = nil
+	}
+	data, err := json.Marshal(map[string]json.RawMessage{key: json.RawMessage(value)})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, key, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&t); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, key, err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// check reports whether change can be applied on top of the store
+func (c *ConfigStore) check(change *ConfigChange) error {
+	if change.Version != c.Version+1 {
+		return fmt.Errorf("%w: version %d does not follow %d", ErrConfigConflict, change.Version, c.Version)
+	}
+	_, err := c.set(change.Key, change.Value)
+	return err
+}
+
+// apply applies a committed change, or skips it if it does not follow the
+// latest version or leaves the tunables invalid
+func (c *ConfigStore) apply(change *ConfigChange) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	if change.Version != c.Version+1 {
+		return
+	}
+	t, err := c.set(change.Key, change.Value)
+	if err != nil {
+		return
+	}
+	c.Version = change.Version
+	c.Keys[change.Key] = change.Value
+	c.reloader.Apply(t)
+}
+
+// configure applies a committed config change to the replica's store and
+// reports whether payload was one
+func (r *PBFTReplica) configure(payload []byte) bool {
+	m, err := DecodeFrame(payload)
+	if err != nil {
+		return false
+	}
+	change, ok := m.(*ConfigChange)
+	if !ok {
+		return false
+	}
+	r.Config.apply(change)
+	return true
+}
+
+// SubmitConfigChange orders a configuration entry setting the tunable
+// named key to value. The change is checked against the primary's store
+// first, so a conflicting or invalid change fails before it is ordered.
+func (p *PBFT) SubmitConfigChange(key string, value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidConfig, key, err)
+	}
+	store := p.Primary().Config
+	store.Lock.Lock()
+	change := &ConfigChange{Version: store.Version + 1, Key: key, Value: string(data)}
+	err = store.check(change)
+	store.Lock.Unlock()
+	if err != nil {
+		return "", err
+	}
+	frame, err := EncodeFrame(change)
+	if err != nil {
+		return "", err
+	}
+	return p.Submit(frame)
+}
+
+// ConfigVersions returns the config version each replica has applied, so
+// callers can tell when a change has rolled out everywhere
+func (p *PBFT) ConfigVersions() map[string]int64 {
+	versions := make(map[string]int64)
+	for id, replica := range p.Replicas {
+		store := replica.Config
+		store.Lock.Lock()
+		versions[id] = store.Version
+		store.Lock.Unlock()
+	}
+	return versions
+}
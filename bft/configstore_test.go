@@ -0,0 +1,85 @@
+package bft
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestConfigChangeRollsOut tests that a committed change reaches every replica's tunables and watchers
+func TestConfigChangeRollsOut(t *testing.T) {
+	pbft := newPBFT(t)
+	var changes []int
+	pbft.Replicas["B"].Config.Watch(func(old, new *Tunables) {
+		changes = append(changes, old.BatchSize, new.BatchSize)
+	})
+	if _, err := pbft.SubmitConfigChange("batch_size", 128); err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+
+	expected := map[string]int64{"A": 1, "B": 1, "C": 1, "D": 1}
+	if versions := pbft.ConfigVersions(); !reflect.DeepEqual(versions, expected) {
+		t.Errorf("Expected every replica at version 1, got %v", versions)
+	}
+	for id, replica := range pbft.Replicas {
+		if replica.Config.Current().BatchSize != 128 || replica.Config.Keys["batch_size"] != "128" {
+			t.Errorf("Expected %s to use a batch size of 128, got %+v", id, replica.Config.Current())
+		}
+	}
+	if !reflect.DeepEqual(changes, []int{64, 128}) {
+		t.Errorf("Expected B's watcher to see 64 -> 128, got %v", changes)
+	}
+
+	if _, err := pbft.SubmitConfigChange("degradation", map[string]DegradationPolicy{"cart": "crdt"}); err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+	if current := pbft.Replicas["C"].Config.Current(); current.Degradation["cart"] != "crdt" || current.BatchSize != 128 {
+		t.Errorf("Expected C to keep its batch size and add the policy, got %+v", current)
+	}
+}
+
+// TestConfigChangeValidation tests that invalid and stale changes are refused or skipped by every replica
+func TestConfigChangeValidation(t *testing.T) {
+	pbft := newPBFT(t)
+	if _, err := pbft.SubmitConfigChange("batch_size", 0); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected a batch size of 0 to be invalid, got %v", err)
+	}
+	if _, err := pbft.SubmitConfigChange("batch_sizes", 10); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected an unknown key to be invalid, got %v", err)
+	}
+	if _, err := pbft.SubmitConfigChange("log_level", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+
+	// Proposed against version 0, committed after version 1
+	stale, _ := EncodeFrame(&ConfigChange{Version: 1, Key: "log_level", Value: `"error"`})
+	if _, err := pbft.Submit(stale); err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+	for id, replica := range pbft.Replicas {
+		if replica.Config.Version != 1 || replica.Config.Current().LogLevel != "debug" {
+			t.Errorf("Expected %s to skip the stale change, got version %d with %+v", id, replica.Config.Version, replica.Config.Current())
+		}
+	}
+}
+
+// TestConfigChangeToleratesCrash tests that a change commits with a replica down and skips only that replica
+func TestConfigChangeToleratesCrash(t *testing.T) {
+	pbft := newPBFT(t)
+	if err := pbft.System.ApplyFault(FaultStep{Kind: FaultCrash, Nodes: []string{"D"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pbft.SubmitConfigChange("gossip_fanout", 5); err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+
+	expected := map[string]int64{"A": 1, "B": 1, "C": 1, "D": 0}
+	if versions := pbft.ConfigVersions(); !reflect.DeepEqual(versions, expected) {
+		t.Errorf("Expected the change on every live replica, got %v", versions)
+	}
+}
@@ -0,0 +1,333 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bandwidth and congestion.
+//
+// Without a congestion model a message takes its link's latency however
+// much else is on the link, which is fine for consensus traffic alone but
+// hides what a large transfer does to it. A Congestion model gives each
+// direction of every link a bandwidth and a queue: a message waits for the
+// ones ahead of it, takes its size over the bandwidth to serialize and then
+// the latency to propagate.
+//
+// Snapshots and catch-up run as a Transfer, which sends segments under a
+// TCP-like congestion window. Slow start grows the window by a segment per
+// acknowledgement, doubling it every round trip, until the first loss;
+// after that it grows by one segment per round trip, and every round trip
+// with a loss halves it. A link queues one bandwidth-delay product of bulk
+// bytes, so a transfer keeps its link busy, and loses segments beyond that.
+//
+// Consensus messages sharing a link with a transfer queue behind its
+// segments, up to a round trip's worth of them. With PriorityLanes the link
+// serves the consensus lane first, so a consensus message waits for at most
+// the one segment already being serialized.
+
+var ErrNoCongestion = errors.New("system has no congestion model")
+
+// Lane is the class of traffic a message travels in
+type Lane int
+
+const (
+	LaneConsensus Lane = iota // Protocol messages, small and urgent
+	LaneBulk                  // Snapshot and catch-up segments
+)
+
+const (
+	// DefaultSegmentSize is the size of transfer segments unless set;
+	// large segments keep the number of events of a transfer low
+	DefaultSegmentSize = 8 << 10
+	// InitialWindow is the congestion window of a new transfer, in segments
+	InitialWindow = 2
+	// minQueueSegments is the least a link queues, in segments, however
+	// small its bandwidth-delay product
+	minQueueSegments = 4
+)
+
+// CongestionStats count what the queues did
+type CongestionStats struct {
+	Queued        int           // Messages that waited for others ahead of them
+	Lost          int           // Bulk segments lost to a full queue
+	ConsensusWait time.Duration // Longest a consensus message waited
+	BulkWait      time.Duration // Longest a bulk segment waited
+}
+
+// Congestion queues messages behind the bandwidth of their links
+type Congestion struct {
+	Bandwidth     int64 // Bytes per second in each direction of every link
+	SegmentSize   int   // Bytes per transfer segment, DefaultSegmentSize if zero
+	PriorityLanes bool  // Serve the consensus lane ahead of the bulk lane
+	Stats         CongestionStats
+	Lock          sync.Mutex
+	links         map[[2]string]*linkQueue
+}
+
+// NewCongestion creates a model giving every link direction bandwidth
+// bytes per second
+func NewCongestion(bandwidth int64) *Congestion {
+	return &Congestion{Bandwidth: bandwidth, links: make(map[[2]string]*linkQueue)}
+}
+
+// clone returns a model with the same settings and empty queues
+func (c *Congestion) clone() *Congestion {
+	if c == nil {
+		return nil
+	}
+	clone := NewCongestion(c.Bandwidth)
+	clone.SegmentSize, clone.PriorityLanes = c.SegmentSize, c.PriorityLanes
+	return clone
+}
+
+func (c *Congestion) segmentSize() int {
+	if c.SegmentSize > 0 {
+		return c.SegmentSize
+	}
+	return DefaultSegmentSize
+}
+
+// serialization returns how long size bytes take to put on a link
+func (c *Congestion) serialization(size int) time.Duration {
+	return time.Duration(int64(size) * int64(time.Second) / c.Bandwidth)
+}
+
+// BandwidthDelay returns the bandwidth-delay product of a link with the
+// given one-way latency: the bytes that keep it busy for a round trip
+func (c *Congestion) BandwidthDelay(latency time.Duration) int {
+	return int(c.Bandwidth * int64(2*latency) / int64(time.Second))
+}
+
+// queuedMessage is a message waiting for its link
+type queuedMessage struct {
+	size    int
+	lane    Lane
+	label   string
+	queued  time.Duration // When it joined the queue
+	deliver func()
+}
+
+// linkQueue is one direction of a link
+type linkQueue struct {
+	latency time.Duration
+	waiting [2][]queuedMessage // By lane, or all in the first without priority lanes
+	bulk    int                // Bulk bytes waiting
+	busy    bool               // A message is being serialized
+}
+
+// send queues a message of size bytes on the direction of the link from one
+// node to another, to arrive latency after it was serialized, and reports
+// whether it was sent rather than lost to a full queue. Without a model the
+// message is delivered after latency.
+func (c *Congestion) send(sched *Scheduler, from, to string, size int, lane Lane, latency time.Duration, label string, deliver func()) bool {
+	if c == nil || c.Bandwidth <= 0 {
+		sched.Deliver(latency, label, deliver)
+		return true
+	}
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	if c.links == nil {
+		c.links = make(map[[2]string]*linkQueue)
+	}
+	q := c.links[[2]string{from, to}]
+	if q == nil {
+		q = &linkQueue{}
+		c.links[[2]string{from, to}] = q
+	}
+	q.latency = latency
+	if lane == LaneBulk {
+		if q.bulk+size > max(c.BandwidthDelay(latency), minQueueSegments*c.segmentSize()) {
+			c.Stats.Lost++
+			return false
+		}
+		q.bulk += size
+	}
+	queue := LaneConsensus
+	if c.PriorityLanes {
+		queue = lane
+	}
+	q.waiting[queue] = append(q.waiting[queue], queuedMessage{size: size, lane: lane, label: label, queued: sched.Now, deliver: deliver})
+	if !q.busy {
+		c.next(sched, q)
+	}
+	return true
+}
+
+// next starts serializing the first waiting message, consensus lane first.
+// The caller must hold c.Lock.
+func (c *Congestion) next(sched *Scheduler, q *linkQueue) {
+	for i := range q.waiting {
+		if len(q.waiting[i]) == 0 {
+			continue
+		}
+		msg := q.waiting[i][0]
+		q.waiting[i] = q.waiting[i][1:]
+		if msg.lane == LaneBulk {
+			q.bulk -= msg.size
+		}
+		if wait := sched.Now - msg.queued; wait > 0 {
+			c.Stats.Queued++
+			if msg.lane == LaneBulk {
+				c.Stats.BulkWait = max(c.Stats.BulkWait, wait)
+			} else {
+				c.Stats.ConsensusWait = max(c.Stats.ConsensusWait, wait)
+			}
+		}
+		q.busy = true
+		sched.Timer(c.serialization(msg.size), "serialize "+msg.label, func() {
+			sched.Deliver(q.latency, msg.label, msg.deliver)
+			c.Lock.Lock()
+			defer c.Lock.Unlock()
+			q.busy = false
+			c.next(sched, q)
+		})
+		return
+	}
+}
+
+// Transfer is a bulk transfer, a snapshot or catch-up, from one node to
+// another
+type Transfer struct {
+	From, To  string
+	Size      int
+	Started   time.Duration
+	Finished  time.Duration // When the last segment was acknowledged
+	Done      bool
+	Aborted   bool    // The link went down during the transfer
+	Sent      int     // Segments sent, retransmissions included
+	Lost      int     // Segments lost to full queues
+	Window    float64 // Congestion window, in segments
+	Threshold float64 // Slow start threshold, in segments; 0 until the first loss
+	system    *System
+	latency   time.Duration
+	segments  int
+	next      int           // Segments sent for the first time
+	acked     int           // Segments acknowledged
+	inFlight  int           // Segments sent and neither acknowledged nor lost
+	resend    int           // Lost segments waiting to be sent again
+	halved    bool          // The window was halved at least once
+	cut       time.Duration // When the window was last halved
+	done      func(*Transfer)
+}
+
+// StartTransfer starts sending size bytes from one node to another in the
+// bulk lane, and calls done, if not nil, once the last segment was
+// acknowledged or the transfer aborted. The system needs a scheduler and a
+// congestion model.
+func (s *System) StartTransfer(from, to string, size int, done func(*Transfer)) (*Transfer, error) {
+	s.Lock.RLock()
+	sender, receiver := s.Nodes[from], s.Nodes[to]
+	var latency time.Duration
+	if sender != nil && receiver != nil {
+		latency = s.regionLatency(sender.Region, receiver.Region)
+	}
+	s.Lock.RUnlock()
+	if sender == nil || receiver == nil {
+		return nil, fmt.Errorf("%w: %s or %s", ErrUnknownNode, from, to)
+	}
+	if s.Congestion == nil || s.Scheduler == nil {
+		return nil, ErrNoCongestion
+	}
+	segment := s.Congestion.segmentSize()
+	t := &Transfer{
+		From:     from,
+		To:       to,
+		Size:     size,
+		Started:  s.Scheduler.Now,
+		Window:   InitialWindow,
+		system:   s,
+		latency:  latency,
+		segments: max((size+segment-1)/segment, 1),
+		done:     done,
+	}
+	t.pump()
+	return t, nil
+}
+
+// pump sends segments while the window has room
+func (t *Transfer) pump() {
+	s := t.system
+	for !t.Aborted && t.inFlight < int(t.Window) && (t.resend > 0 || t.next < t.segments) {
+		if s.IsPartitioned(t.From) || s.IsPartitioned(t.To) || s.IsFenced(t.From) || s.IsFenced(t.To) || s.IsSevered(t.From, t.To) {
+			t.Aborted = true
+			if t.done != nil {
+				t.done(t)
+			}
+			return
+		}
+		if t.resend > 0 {
+			t.resend--
+		} else {
+			t.next++
+		}
+		t.inFlight++
+		t.Sent++
+		label := fmt.Sprintf("transfer %s->%s", t.From, t.To)
+		size := min(s.Congestion.segmentSize(), t.Size)
+		if s.Congestion.send(s.Scheduler, t.From, t.To, size, LaneBulk, t.latency, label, t.arrived) {
+			s.Metrics.add(metricSent, "transfer", 1)
+			s.Metrics.add(metricBytes, "transfer", float64(size))
+		} else {
+			// The sender learns of the loss a round trip later
+			s.Metrics.add(metricDropped, "transfer", 1)
+			s.Scheduler.Timer(2*t.latency, label+" loss", t.lost)
+		}
+	}
+}
+
+// arrived acknowledges a segment the receiver got, over the reverse latency
+func (t *Transfer) arrived() {
+	t.system.Scheduler.Deliver(t.latency, fmt.Sprintf("transfer ack %s->%s", t.To, t.From), t.acknowledged)
+}
+
+// acknowledged grows the window and sends on
+func (t *Transfer) acknowledged() {
+	if t.Aborted {
+		return
+	}
+	t.inFlight--
+	t.acked++
+	if t.Threshold == 0 || t.Window < t.Threshold {
+		t.Window++
+	} else {
+		t.Window += 1 / t.Window
+	}
+	if t.acked == t.segments {
+		t.Done = true
+		t.Finished = t.system.Scheduler.Now
+		if t.done != nil {
+			t.done(t)
+		}
+		return
+	}
+	t.pump()
+}
+
+// lost halves the window, once per round trip of losses, and sends the
+// segment again
+func (t *Transfer) lost() {
+	if t.Aborted {
+		return
+	}
+	now := t.system.Scheduler.Now
+	t.inFlight--
+	t.Lost++
+	t.resend++
+	if !t.halved || now-t.cut >= 2*t.latency {
+		t.Threshold = max(t.Window/2, InitialWindow)
+		t.Window = t.Threshold
+		t.halved, t.cut = true, now
+	}
+	t.pump()
+}
+
+// Throughput returns the bytes per second of a finished transfer
+func (t *Transfer) Throughput() float64 {
+	if !t.Done || t.Finished == t.Started {
+		return 0
+	}
+	return float64(t.Size) / (t.Finished - t.Started).Seconds()
+}
@@ -0,0 +1,115 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newCongestedSystem creates voters A-D in regions of their own under a
+// scheduler, with links of the given bandwidth
+func newCongestedSystem(t *testing.T, bandwidth int64, lanes bool) *System {
+	system := newTestSystem(t, nodeIDs(4), func(node *Node) { node.Region = "region-" + node.ID })
+	system.UseScheduler(NewScheduler(1))
+	system.Congestion = NewCongestion(bandwidth)
+	system.Congestion.PriorityLanes = lanes
+	return system
+}
+
+// TestTransferCongestionWindow tests that a transfer fills its link, loses segments beyond the queue and backs off
+func TestTransferCongestionWindow(t *testing.T) {
+	system := newCongestedSystem(t, 1<<20, false)
+	var finished *Transfer
+	transfer, err := system.StartTransfer("A", "B", 4<<20, func(t *Transfer) { finished = t })
+	if err != nil {
+		t.Fatal(err)
+	}
+	system.Scheduler.Run()
+	if finished != transfer || !transfer.Done || transfer.Aborted {
+		t.Fatalf("Expected the transfer to finish, got %+v", transfer)
+	}
+	if transfer.Lost == 0 || transfer.Threshold == 0 || transfer.Sent != transfer.segments+transfer.Lost {
+		t.Errorf("Expected slow start to overrun the queue and every loss to be sent again, got %+v", transfer)
+	}
+	// At best the link is busy all the time after the first round trip
+	if throughput := transfer.Throughput(); throughput > 1<<20 || throughput < 0.5*(1<<20) {
+		t.Errorf("Expected between half and all of the bandwidth, got %.0f bytes/s", throughput)
+	}
+}
+
+// TestPriorityLanesBoundConsensusWait tests that a consensus message waits behind a transfer's queue unless it has a lane of its own
+func TestPriorityLanesBoundConsensusWait(t *testing.T) {
+	const bandwidth = 1 << 20
+	waits := make(map[bool]time.Duration)
+	for _, lanes := range []bool{false, true} {
+		system := newCongestedSystem(t, bandwidth, lanes)
+		if _, err := system.StartTransfer("A", "B", 4<<20, nil); err != nil {
+			t.Fatal(err)
+		}
+		var sent, arrived time.Duration
+		system.Scheduler.At(2*time.Second, func() {
+			sent = system.Scheduler.Now
+			system.Congestion.send(system.Scheduler, "A", "B", 200, LaneConsensus, DefaultCrossRegionLatency, "prepare A->B", func() {
+				arrived = system.Scheduler.Now
+			})
+		})
+		system.Scheduler.Run()
+		waits[lanes] = arrived - sent - DefaultCrossRegionLatency
+	}
+	segment := NewCongestion(bandwidth).serialization(DefaultSegmentSize)
+	if waits[false] < 4*segment {
+		t.Errorf("Expected a queue of segments ahead without lanes, waited %v", waits[false])
+	}
+	if waits[true] > segment+time.Millisecond {
+		t.Errorf("Expected at most one segment ahead with lanes, waited %v", waits[true])
+	}
+}
+
+// TestCatchUpDelaysConsensus tests that catch-up transfers from the primary delay a PBFT commit, and that priority lanes mitigate it
+func TestCatchUpDelaysConsensus(t *testing.T) {
+	latencies := make(map[string]time.Duration)
+	for _, run := range []string{"idle", "fifo", "lanes"} {
+		system := newCongestedSystem(t, 1<<20, run == "lanes")
+		pbft, err := NewPBFT(system, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run != "idle" {
+			for _, to := range []string{"B", "C", "D"} {
+				if _, err := system.StartTransfer("A", to, 2<<20, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		var digest string
+		pbft.After(time.Second, func() {
+			if digest, err = pbft.Submit([]byte("op")); err != nil {
+				t.Error(err)
+			}
+		})
+		pbft.Run()
+		outcome := pbft.Outcome(digest)
+		if !outcome.Committed {
+			t.Fatalf("Expected the request to commit in the %s run, got %+v", run, outcome)
+		}
+		latencies[run] = outcome.Latency
+	}
+	if latencies["fifo"] < latencies["idle"]+50*time.Millisecond {
+		t.Errorf("Expected catch-up to delay the commit visibly, got %v idle and %v behind transfers", latencies["idle"], latencies["fifo"])
+	}
+	if latencies["lanes"] > latencies["idle"]+2*NewCongestion(1<<20).serialization(DefaultSegmentSize) {
+		t.Errorf("Expected priority lanes to leave at most a segment of delay per hop, got %v idle and %v with lanes", latencies["idle"], latencies["lanes"])
+	}
+}
+
+// TestStartTransferErrors tests that a transfer needs known nodes and a congestion model
+func TestStartTransferErrors(t *testing.T) {
+	system := newCongestedSystem(t, 1<<20, false)
+	if _, err := system.StartTransfer("A", "Z", 1, nil); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("Expected ErrUnknownNode, got %v", err)
+	}
+	system.Congestion = nil
+	if _, err := system.StartTransfer("A", "B", 1, nil); !errors.Is(err, ErrNoCongestion) {
+		t.Errorf("Expected ErrNoCongestion, got %v", err)
+	}
+}
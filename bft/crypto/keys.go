@@ -0,0 +1,113 @@
+// Package crypto generates node key pairs for each signature scheme and
+// signs and verifies digests with their canonical signature encodings.
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrKeyEncoding reports a key file that is not a PEM-encoded key
+var ErrKeyEncoding = errors.New("key encoding invalid")
+
+// curve is the elliptic curve used for all node key pairs
+var curve = elliptic.P256()
+
+// GenerateKeyPair generates an ECDSA key pair, the default scheme's
+func GenerateKeyPair() (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return privateKey, &privateKey.PublicKey, nil
+}
+
+// MarshalPublicKey encodes a public key of any scheme as a PEM block of
+// PKIX DER, the form other tools read
+func MarshalPublicKey(key PublicKey) ([]byte, error) {
+	if SchemeOf(key) == "" {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// ParsePublicKey decodes a key written by MarshalPublicKey, refusing keys
+// of other types and ECDSA keys on other curves
+func ParsePublicKey(data []byte) (PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%w: no PUBLIC KEY block", ErrKeyEncoding)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyEncoding, err)
+	}
+	if ecdsaKey, ok := key.(*ecdsa.PublicKey); ok && ecdsaKey.Curve != curve {
+		return nil, fmt.Errorf("%w: ECDSA key on %s", ErrUnsupportedKey, ecdsaKey.Curve.Params().Name)
+	}
+	if SchemeOf(key) == "" {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+	return key, nil
+}
+
+// MarshalPrivateKey encodes a private key of any scheme as a PEM block of
+// PKCS #8 DER
+func MarshalPrivateKey(key PrivateKey) ([]byte, error) {
+	switch key.(type) {
+	case *ecdsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKey decodes a key written by MarshalPrivateKey and returns it
+// with its public key, refusing keys ParsePublicKey would refuse
+func ParsePrivateKey(data []byte) (PrivateKey, PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, nil, fmt.Errorf("%w: no PRIVATE KEY block", ErrKeyEncoding)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrKeyEncoding, err)
+	}
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		if key.Curve != curve {
+			return nil, nil, fmt.Errorf("%w: ECDSA key on %s", ErrUnsupportedKey, key.Curve.Params().Name)
+		}
+		return key, &key.PublicKey, nil
+	case ed25519.PrivateKey:
+		return key, key.Public().(ed25519.PublicKey), nil
+	}
+	return nil, nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+}
+
+// NonceSize is the number of random bytes in a nonce
+const NonceSize = 8
+
+// NewNonce returns NonceSize random bytes, hex encoded
+func NewNonce() (string, error) {
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
@@ -0,0 +1,152 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Signature schemes.
+//
+// Nodes sign with ECDSA over P-256 unless they pick Ed25519, which signs
+// faster, deterministically, and with a simpler encoding: the 64-byte
+// signature in lower-case hex, with no second valid encoding for a relay to
+// produce, as Ed25519 verification rejects non-canonical signatures itself.
+// Keys are typed like the standard library's, as the concrete key of their
+// scheme, and Sign and Verify pick the scheme by the key.
+
+var (
+	ErrUnknownScheme  = errors.New("unknown signature scheme")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// PrivateKey is *ecdsa.PrivateKey or ed25519.PrivateKey
+type PrivateKey any
+
+// PublicKey is *ecdsa.PublicKey or ed25519.PublicKey
+type PublicKey any
+
+// SignatureScheme selects how nodes sign, named as in handshakes
+type SignatureScheme string
+
+const (
+	SchemeECDSA   SignatureScheme = "ecdsa-p256-sha256"
+	SchemeEd25519 SignatureScheme = "ed25519"
+)
+
+// SignatureSchemes lists the supported schemes, the default first
+var SignatureSchemes = []SignatureScheme{SchemeECDSA, SchemeEd25519}
+
+// ParseSignatureScheme checks a scheme name, ECDSA if empty
+func ParseSignatureScheme(name string) (SignatureScheme, error) {
+	if name == "" {
+		return SchemeECDSA, nil
+	}
+	for _, scheme := range SignatureSchemes {
+		if SignatureScheme(name) == scheme {
+			return scheme, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownScheme, name)
+}
+
+// GenerateKeyPair generates a key pair of the scheme
+func (s SignatureScheme) GenerateKeyPair() (PrivateKey, PublicKey, error) {
+	switch s {
+	case SchemeECDSA, "":
+		return GenerateKeyPair()
+	case SchemeEd25519:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return privateKey, publicKey, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %q", ErrUnknownScheme, s)
+}
+
+// SchemeOf returns the scheme of a public key, empty if unsupported
+func SchemeOf(key PublicKey) SignatureScheme {
+	switch key.(type) {
+	case *ecdsa.PublicKey:
+		return SchemeECDSA
+	case ed25519.PublicKey:
+		return SchemeEd25519
+	}
+	return ""
+}
+
+// EncodePublicKey renders a public key as text, the hex coordinates of an
+// ECDSA key or the hex bytes of an Ed25519 one, empty if missing or
+// unsupported
+func EncodePublicKey(key PublicKey) string {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if key == nil {
+			return ""
+		}
+		return fmt.Sprintf("%x/%x", key.X.Bytes(), key.Y.Bytes())
+	case ed25519.PublicKey:
+		return hex.EncodeToString(key)
+	}
+	return ""
+}
+
+// Sign signs a digest with the key's scheme, encoding the signature
+// canonically
+func Sign(privateKey PrivateKey, digest []byte) (string, error) {
+	switch key := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return "", err
+		}
+		return EncodeSignature(r, s), nil
+	case ed25519.PrivateKey:
+		return hex.EncodeToString(ed25519.Sign(key, digest)), nil
+	}
+	return "", fmt.Errorf("%w: %T", ErrUnsupportedKey, privateKey)
+}
+
+// Verify checks an encoded signature over a digest with the key's scheme
+func Verify(publicKey PublicKey, digest []byte, signature string) error {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		r, s, err := ParseSignature(signature)
+		if err != nil {
+			return err
+		}
+		if !ecdsa.Verify(key, digest, r, s) {
+			return ErrSignatureInvalid
+		}
+		return nil
+	case ed25519.PublicKey:
+		raw, err := parseEd25519Signature(signature)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(key, digest, raw) {
+			return ErrSignatureInvalid
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %T", ErrUnsupportedKey, publicKey)
+}
+
+// parseEd25519Signature strictly parses an encoded Ed25519 signature
+func parseEd25519Signature(signature string) ([]byte, error) {
+	if signature == "" {
+		return nil, ErrSignatureEmpty
+	}
+	if len(signature) != 2*ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: got %d characters, want %d", ErrSignatureLength, len(signature), 2*ed25519.SignatureSize)
+	}
+	raw, err := hex.DecodeString(signature)
+	if err != nil || hex.EncodeToString(raw) != signature {
+		return nil, ErrSignatureEncoding
+	}
+	return raw, nil
+}
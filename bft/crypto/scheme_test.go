@@ -0,0 +1,154 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestSchemesSignAndVerify tests that each scheme's signatures verify under its key only
+func TestSchemesSignAndVerify(t *testing.T) {
+	digest := sha256.Sum256([]byte("A:42"))
+	for _, scheme := range SignatureSchemes {
+		privateKey, publicKey, err := scheme.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if SchemeOf(publicKey) != scheme {
+			t.Errorf("%s: expected the key to report its scheme, got %q", scheme, SchemeOf(publicKey))
+		}
+		signature, err := Sign(privateKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Verify(publicKey, digest[:], signature); err != nil {
+			t.Errorf("%s: expected the signature to verify, got %v", scheme, err)
+		}
+		_, other, _ := scheme.GenerateKeyPair()
+		if err := Verify(other, digest[:], signature); !errors.Is(err, ErrSignatureInvalid) {
+			t.Errorf("%s: expected another key to fail, got %v", scheme, err)
+		}
+	}
+}
+
+// TestEd25519Deterministic tests that Ed25519 signs a digest the same way every time in one encoding
+func TestEd25519Deterministic(t *testing.T) {
+	privateKey, publicKey, _ := SchemeEd25519.GenerateKeyPair()
+	digest := sha256.Sum256([]byte("A:42"))
+	first, _ := Sign(privateKey, digest[:])
+	second, _ := Sign(privateKey, digest[:])
+	if first != second || len(first) != 2*ed25519.SignatureSize {
+		t.Errorf("Expected one %d character signature, got %q and %q", 2*ed25519.SignatureSize, first, second)
+	}
+	for _, test := range []struct {
+		name      string
+		signature string
+		expected  error
+	}{
+		{"empty", "", ErrSignatureEmpty},
+		{"truncated", first[:len(first)-2], ErrSignatureLength},
+		{"upper case", strings.ToUpper(first), ErrSignatureEncoding},
+	} {
+		if err := Verify(publicKey, digest[:], test.signature); !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+// TestSchemeErrors tests unknown scheme names and key types
+func TestSchemeErrors(t *testing.T) {
+	if scheme, err := ParseSignatureScheme(""); err != nil || scheme != SchemeECDSA {
+		t.Errorf("Expected ECDSA by default, got %q, %v", scheme, err)
+	}
+	if _, err := ParseSignatureScheme("rsa"); !errors.Is(err, ErrUnknownScheme) {
+		t.Errorf("Expected ErrUnknownScheme, got %v", err)
+	}
+	if _, err := Sign("key", nil); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("Expected ErrUnsupportedKey signing, got %v", err)
+	}
+	if err := Verify(nil, nil, "00"); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("Expected ErrUnsupportedKey verifying, got %v", err)
+	}
+}
+
+// benchmarkScheme measures signing or verifying digests of distinct messages
+func benchmarkScheme(b *testing.B, scheme SignatureScheme, verify bool) {
+	privateKey, publicKey, err := scheme.GenerateKeyPair()
+	if err != nil {
+		b.Fatal(err)
+	}
+	digests := make([][]byte, 64)
+	signatures := make([]string, len(digests))
+	for i := range digests {
+		sum := sha256.Sum256([]byte{byte(i)})
+		digests[i] = sum[:]
+		signatures[i], _ = Sign(privateKey, digests[i])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := i % len(digests)
+		if verify {
+			if err := Verify(publicKey, digests[j], signatures[j]); err != nil {
+				b.Fatal(err)
+			}
+		} else if _, err := Sign(privateKey, digests[j]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSignECDSA(b *testing.B)     { benchmarkScheme(b, SchemeECDSA, false) }
+func BenchmarkSignEd25519(b *testing.B)   { benchmarkScheme(b, SchemeEd25519, false) }
+func BenchmarkVerifyECDSA(b *testing.B)   { benchmarkScheme(b, SchemeECDSA, true) }
+func BenchmarkVerifyEd25519(b *testing.B) { benchmarkScheme(b, SchemeEd25519, true) }
+
+// TestPublicKeyEncoding tests that keys of every scheme round-trip through PEM and other keys are refused
+func TestPublicKeyEncoding(t *testing.T) {
+	for _, scheme := range SignatureSchemes {
+		_, publicKey, _ := scheme.GenerateKeyPair()
+		data, err := MarshalPublicKey(publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParsePublicKey(data)
+		if err != nil || EncodePublicKey(parsed) != EncodePublicKey(publicKey) {
+			t.Errorf("%s: expected the key to round-trip, got %v", scheme, err)
+		}
+	}
+	if _, err := ParsePublicKey([]byte("not a key")); !errors.Is(err, ErrKeyEncoding) {
+		t.Errorf("Expected ErrKeyEncoding, got %v", err)
+	}
+	if _, err := MarshalPublicKey("key"); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("Expected ErrUnsupportedKey, got %v", err)
+	}
+}
+
+// TestPrivateKeyEncoding tests that private keys of either scheme round-trip through PEM and still sign
+func TestPrivateKeyEncoding(t *testing.T) {
+	digest := sha256.Sum256([]byte("x"))
+	for _, scheme := range SignatureSchemes {
+		privateKey, publicKey, _ := scheme.GenerateKeyPair()
+		data, err := MarshalPrivateKey(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, parsedPublic, err := ParsePrivateKey(data)
+		if err != nil || EncodePublicKey(parsedPublic) != EncodePublicKey(publicKey) {
+			t.Fatalf("%s: expected the key to round-trip, got %v", scheme, err)
+		}
+		signature, err := Sign(parsed, digest[:])
+		if err != nil || Verify(publicKey, digest[:], signature) != nil {
+			t.Errorf("%s: expected the parsed key to sign for the original public key, got %v", scheme, err)
+		}
+	}
+	_, publicKey, _ := GenerateKeyPair()
+	public, _ := MarshalPublicKey(publicKey)
+	if _, _, err := ParsePrivateKey(public); !errors.Is(err, ErrKeyEncoding) {
+		t.Errorf("Expected a public key file to be refused, got %v", err)
+	}
+	if _, err := MarshalPrivateKey("key"); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("Expected ErrUnsupportedKey, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ECDSA signatures are encoded as the fixed-length concatenation r || s, each
+// left-padded to the curve's byte size, in lower-case hex. There is exactly
+// one accepted encoding per signature: s must be in the lower half of the
+// curve order (low-S) and any other length, case or padding is rejected, so a
+// relay cannot produce a second valid encoding of a signature it observed.
+
+var (
+	ErrSignatureEmpty    = errors.New("signature is empty")
+	ErrSignatureLength   = errors.New("signature has wrong length")
+	ErrSignatureEncoding = errors.New("signature is not canonical lower-case hex")
+	ErrSignatureRange    = errors.New("signature component out of range")
+	ErrSignatureHighS    = errors.New("signature s value is not low-S")
+	ErrSignatureInvalid  = errors.New("signature verification failed")
+)
+
+// scalarSize is the byte length of one signature component for the curve
+func scalarSize() int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// SignatureLength is the length in hex characters of an encoded signature
+func SignatureLength() int {
+	return 4 * scalarSize()
+}
+
+// halfOrder is N/2, the largest s value accepted as low-S
+var halfOrder = new(big.Int).Rsh(curve.Params().N, 1)
+
+// EncodeSignature encodes r and s canonically, normalizing s to low-S
+func EncodeSignature(r, s *big.Int) string {
+	if s.Cmp(halfOrder) > 0 {
+		s = new(big.Int).Sub(curve.Params().N, s)
+	}
+	size := scalarSize()
+	buf := make([]byte, 2*size)
+	r.FillBytes(buf[:size])
+	s.FillBytes(buf[size:])
+	return hex.EncodeToString(buf)
+}
+
+// ParseSignature strictly parses an encoded signature
+func ParseSignature(signature string) (*big.Int, *big.Int, error) {
+	if signature == "" {
+		return nil, nil, ErrSignatureEmpty
+	}
+	if len(signature) != SignatureLength() {
+		return nil, nil, fmt.Errorf("%w: got %d characters, want %d", ErrSignatureLength, len(signature), SignatureLength())
+	}
+	raw, err := hex.DecodeString(signature)
+	if err != nil || hex.EncodeToString(raw) != signature {
+		return nil, nil, ErrSignatureEncoding
+	}
+
+	size := scalarSize()
+	r := new(big.Int).SetBytes(raw[:size])
+	s := new(big.Int).SetBytes(raw[size:])
+	n := curve.Params().N
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return nil, nil, ErrSignatureRange
+	}
+	if s.Cmp(halfOrder) > 0 {
+		return nil, nil, ErrSignatureHighS
+	}
+	return r, s, nil
+}
@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// signed returns a public key, a digest and a fresh signature over it
+func signed(t *testing.T) (*ecdsa.PublicKey, []byte, string) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	digest := sha256.Sum256([]byte("A:42"))
+	signature, err := Sign(privateKey, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return publicKey, digest[:], signature
+}
+
+// TestSignatureEncodingIsCanonical tests that signing always produces a fixed-length low-S encoding
+func TestSignatureEncodingIsCanonical(t *testing.T) {
+	_, _, signature := signed(t)
+	if len(signature) != SignatureLength() {
+		t.Fatalf("Expected %d character signature, got %d", SignatureLength(), len(signature))
+	}
+	if _, _, err := ParseSignature(signature); err != nil {
+		t.Errorf("Expected own signature to parse, got %v", err)
+	}
+}
+
+// TestSignatureMalleability tests that malformed and non-canonical signatures are rejected
+func TestSignatureMalleability(t *testing.T) {
+	publicKey, digest, signature := signed(t)
+	r, s, err := ParseSignature(signature)
+	if err != nil {
+		t.Fatalf("Failed to parse signature: %v", err)
+	}
+	n := curve.Params().N
+	half := SignatureLength() / 2
+	highS := new(big.Int).Sub(n, s)
+	zero := strings.Repeat("0", half)
+
+	// encodeRaw encodes r and s without low-S normalization
+	encodeRaw := func(r, s *big.Int) string {
+		size := scalarSize()
+		buf := make([]byte, 2*size)
+		r.FillBytes(buf[:size])
+		s.FillBytes(buf[size:])
+		return hex.EncodeToString(buf)
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		expected  error
+	}{
+		{"empty", "", ErrSignatureEmpty},
+		{"legacy r:s format", signature[:half] + ":" + signature[half:], ErrSignatureLength},
+		{"truncated", signature[:len(signature)-2], ErrSignatureLength},
+		{"extra leading zeros", "00" + signature, ErrSignatureLength},
+		{"upper-case hex", strings.ToUpper(signature), ErrSignatureEncoding},
+		{"non-hex characters", "zz" + signature[2:], ErrSignatureEncoding},
+		{"empty r", zero + signature[half:], ErrSignatureRange},
+		{"empty s", signature[:half] + zero, ErrSignatureRange},
+		{"s not below order", encodeRaw(r, n), ErrSignatureRange},
+		{"high-S", encodeRaw(r, highS), ErrSignatureHighS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseSignature(tt.signature); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+			if Verify(publicKey, digest, tt.signature) == nil {
+				t.Errorf("Expected malformed signature to fail verification")
+			}
+		})
+	}
+}
+
+// TestSignatureRejectsWrongKeyAndPayload tests verification against other keys and altered digests
+func TestSignatureRejectsWrongKeyAndPayload(t *testing.T) {
+	publicKey, digest, signature := signed(t)
+	other, _, _ := signed(t)
+	if err := Verify(other, digest, signature); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("Expected verification with another key to fail, got %v", err)
+	}
+
+	altered := sha256.Sum256([]byte("A:43"))
+	if err := Verify(publicKey, altered[:], signature); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("Expected verification of an altered digest to fail, got %v", err)
+	}
+	if err := Verify(publicKey, digest, signature); err != nil {
+		t.Errorf("Expected the signature to verify, got %v", err)
+	}
+}
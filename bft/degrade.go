@@ -0,0 +1,341 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Graceful degradation when a quorum is unreachable.
+//
+// A write that cannot reach a leader with a quorum is handled by the policy
+// of the namespace it falls in, the part of its key before the first "/".
+// Reject fails the write, as consensus alone would. Queue holds the write
+// at the contacted node and tells the client it is uncommitted; queued
+// writes are replayed in order once a quorum is back. CRDT switches the
+// namespace to last-writer-wins registers: every node accepts writes
+// locally, and on recovery the replicas are merged, the winners committed
+// through the leader, and the namespace returns to consensus. Namespaces
+// that can tolerate lost updates stay writable; the rest keep their
+// guarantees.
+
+var (
+	ErrWriteRejected = errors.New("write rejected while quorum is unreachable")
+	ErrUnknownPolicy = errors.New("unknown degradation policy")
+)
+
+// DegradationPolicy is how a namespace handles writes without a quorum
+type DegradationPolicy string
+
+const (
+	PolicyReject DegradationPolicy = "reject"
+	PolicyQueue  DegradationPolicy = "queue"
+	PolicyCRDT   DegradationPolicy = "crdt"
+)
+
+// Validate checks that the policy is known
+func (p DegradationPolicy) Validate() error {
+	switch p {
+	case PolicyReject, PolicyQueue, PolicyCRDT:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownPolicy, p)
+}
+
+// WriteStatus tells a client what became of its write
+type WriteStatus string
+
+const (
+	StatusCommitted   WriteStatus = "committed"   // Committed by a quorum
+	StatusUncommitted WriteStatus = "uncommitted" // Queued locally, not yet committed
+	StatusCRDT        WriteStatus = "crdt"        // Accepted by a CRDT replica, may lose to a concurrent write
+)
+
+// Namespace returns the namespace of a key, empty if it has none
+func Namespace(key string) string {
+	namespace, _, found := strings.Cut(key, "/")
+	if !found {
+		return ""
+	}
+	return namespace
+}
+
+// DegradedWrite is the outcome of a write under a degradation policy
+type DegradedWrite struct {
+	Key    string
+	Value  string
+	Node   string // Node that accepted the write
+	Policy DegradationPolicy
+	Status WriteStatus
+	Index  int64 // Commit index, if committed
+}
+
+// QueuedWrite is a write held at a node until a quorum is reachable
+type QueuedWrite struct {
+	Seq   int
+	Node  string
+	Key   string
+	Value string
+}
+
+// lwwRegister is a last-writer-wins register; higher stamps win and ties
+// go to the higher node ID
+type lwwRegister struct {
+	Value string
+	Stamp int64
+	Node  string
+}
+
+func (r lwwRegister) wins(other lwwRegister) bool {
+	if r.Stamp != other.Stamp {
+		return r.Stamp > other.Stamp
+	}
+	return r.Node > other.Node
+}
+
+// Degradation applies per-namespace policies to writes
+type Degradation struct {
+	System   *System
+	Policies map[string]DegradationPolicy // By namespace
+	Default  DegradationPolicy            // For namespaces without a policy
+	Lock     sync.Mutex
+	seq      int
+	queued   map[string][]QueuedWrite                     // By node
+	replicas map[string]map[string]map[string]lwwRegister // Namespace -> node -> key
+}
+
+// NewDegradation creates an engine rejecting writes in namespaces without
+// a policy
+func NewDegradation(system *System, policies map[string]DegradationPolicy) *Degradation {
+	return &Degradation{
+		System:   system,
+		Policies: policies,
+		Default:  PolicyReject,
+		queued:   make(map[string][]QueuedWrite),
+		replicas: make(map[string]map[string]map[string]lwwRegister),
+	}
+}
+
+// Policy returns the policy for a namespace
+func (d *Degradation) Policy(namespace string) DegradationPolicy {
+	if policy, exists := d.Policies[namespace]; exists {
+		return policy
+	}
+	return d.Default
+}
+
+// CRDTMode reports whether a namespace is accepting writes as a CRDT
+func (d *Degradation) CRDTMode(namespace string) bool {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+	return d.replicas[namespace] != nil
+}
+
+// available returns why nodeID cannot commit through a leader with a
+// quorum, or nil if it can
+func (d *Degradation) available(nodeID string) error {
+	s := d.System
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	_, leader, err := s.route(nodeID)
+	if err != nil {
+		return err
+	}
+	_, err = s.heartbeatQuorum(leader)
+	return err
+}
+
+// Write submits a write through nodeID, committing it if a quorum is
+// reachable and applying the namespace's policy if not. A namespace in CRDT
+// mode takes writes as a CRDT, and a node with queued writes queues further
+// ones, until Recover.
+func (d *Degradation) Write(clientRegion, nodeID, key, value string) (*DegradedWrite, error) {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+	namespace := Namespace(key)
+	policy := d.Policy(namespace)
+	write := &DegradedWrite{Key: key, Value: value, Node: nodeID, Policy: policy}
+
+	switch {
+	case d.replicas[namespace] != nil:
+		// The namespace stays a CRDT until Recover merges it
+	case policy == PolicyQueue && len(d.queued[nodeID]) > 0:
+		// Later writes wait behind queued ones to keep their order
+	default:
+		err := d.available(nodeID)
+		if err == nil {
+			result, err := d.System.SubmitWrite(clientRegion, nodeID, key, value)
+			if err != nil {
+				return nil, err
+			}
+			write.Status, write.Index = StatusCommitted, result.Index
+			return write, nil
+		}
+		if errors.Is(err, ErrUnknownNode) || policy == PolicyReject {
+			return nil, fmt.Errorf("%w: %w", ErrWriteRejected, err)
+		}
+	}
+
+	switch policy {
+	case PolicyQueue:
+		d.seq++
+		d.queued[nodeID] = append(d.queued[nodeID], QueuedWrite{Seq: d.seq, Node: nodeID, Key: key, Value: value})
+		write.Status = StatusUncommitted
+	case PolicyCRDT:
+		if err := d.crdtWrite(namespace, nodeID, key, value); err != nil {
+			return nil, err
+		}
+		write.Status = StatusCRDT
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPolicy, policy)
+	}
+	return write, nil
+}
+
+// crdtWrite sets key in nodeID's replica of a CRDT namespace, stamping it
+// past any value the replica has seen
+func (d *Degradation) crdtWrite(namespace, nodeID, key, value string) error {
+	d.System.Lock.RLock()
+	node, exists := d.System.Nodes[nodeID]
+	d.System.Lock.RUnlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownNode, nodeID)
+	}
+	stamp := time.Now().Unix()
+	if node.Clock != nil {
+		stamp = node.Clock()
+	}
+
+	if d.replicas[namespace] == nil {
+		d.replicas[namespace] = make(map[string]map[string]lwwRegister)
+	}
+	replica := d.replicas[namespace][nodeID]
+	if replica == nil {
+		replica = make(map[string]lwwRegister)
+		d.replicas[namespace][nodeID] = replica
+	}
+	if current, exists := replica[key]; exists && stamp <= current.Stamp {
+		stamp = current.Stamp + 1
+	}
+	replica[key] = lwwRegister{Value: value, Stamp: stamp, Node: nodeID}
+	return nil
+}
+
+// DegradedRead is a node's view of a key including writes not yet committed
+type DegradedRead struct {
+	Value  string
+	Status WriteStatus
+}
+
+// Read returns nodeID's latest value for key: its newest queued write, its
+// CRDT replica's value, or its committed store, in that order
+func (d *Degradation) Read(nodeID, key string) (*DegradedRead, error) {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+	queued := d.queued[nodeID]
+	for i := len(queued) - 1; i >= 0; i-- {
+		if queued[i].Key == key {
+			return &DegradedRead{Value: queued[i].Value, Status: StatusUncommitted}, nil
+		}
+	}
+	if register, exists := d.replicas[Namespace(key)][nodeID][key]; exists {
+		return &DegradedRead{Value: register.Value, Status: StatusCRDT}, nil
+	}
+
+	d.System.Lock.RLock()
+	node, exists := d.System.Nodes[nodeID]
+	d.System.Lock.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, nodeID)
+	}
+	node.Lock.RLock()
+	defer node.Lock.RUnlock()
+	value, err := node.plaintext(node.Store.Entries[key])
+	if err != nil {
+		return nil, err
+	}
+	return &DegradedRead{Value: value, Status: StatusCommitted}, nil
+}
+
+// Queued returns the writes held at nodeID
+func (d *Degradation) Queued(nodeID string) []QueuedWrite {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+	return append([]QueuedWrite(nil), d.queued[nodeID]...)
+}
+
+// RecoveryReport describes what Recover committed
+type RecoveryReport struct {
+	Flushed   int      // Queued writes committed
+	Merged    int      // CRDT keys committed
+	Conflicts []string // CRDT keys written concurrently with different values
+	Restored  []string // Namespaces returned to consensus
+}
+
+func (r *RecoveryReport) String() string {
+	return fmt.Sprintf("flushed %d queued writes, merged %d CRDT keys (%d conflicts), restored %v",
+		r.Flushed, r.Merged, len(r.Conflicts), r.Restored)
+}
+
+// Recover commits queued writes in the order they were accepted and merges
+// CRDT namespaces back into consensus. It fails while the leader has no
+// quorum; writes it could not commit stay queued.
+func (d *Degradation) Recover(clientRegion string) (*RecoveryReport, error) {
+	d.Lock.Lock()
+	defer d.Lock.Unlock()
+	d.System.Lock.RLock()
+	leader := d.System.Leader
+	d.System.Lock.RUnlock()
+	if err := d.available(leader); err != nil {
+		return nil, err
+	}
+
+	report := &RecoveryReport{}
+	var pending []QueuedWrite
+	for _, id := range sortedKeys(d.queued) {
+		pending = append(pending, d.queued[id]...)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Seq < pending[j].Seq })
+	for i, write := range pending {
+		if _, err := d.System.SubmitWrite(clientRegion, leader, write.Key, write.Value); err != nil {
+			d.queued = make(map[string][]QueuedWrite)
+			for _, rest := range pending[i:] {
+				d.queued[rest.Node] = append(d.queued[rest.Node], rest)
+			}
+			return report, err
+		}
+		report.Flushed++
+	}
+	d.queued = make(map[string][]QueuedWrite)
+
+	for _, namespace := range sortedKeys(d.replicas) {
+		merged := make(map[string]lwwRegister)
+		values := make(map[string]map[string]bool)
+		for _, replica := range d.replicas[namespace] {
+			for key, register := range replica {
+				if current, exists := merged[key]; !exists || register.wins(current) {
+					merged[key] = register
+				}
+				if values[key] == nil {
+					values[key] = make(map[string]bool)
+				}
+				values[key][register.Value] = true
+			}
+		}
+		for _, key := range sortedKeys(merged) {
+			if _, err := d.System.SubmitWrite(clientRegion, leader, key, merged[key].Value); err != nil {
+				return report, err
+			}
+			report.Merged++
+			if len(values[key]) > 1 {
+				report.Conflicts = append(report.Conflicts, key)
+			}
+		}
+		delete(d.replicas, namespace)
+		report.Restored = append(report.Restored, namespace)
+	}
+	return report, nil
+}
@@ -0,0 +1,154 @@
+package bft
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// newDegradationSystem builds four nodes A-D led by A with logical clocks
+// and C and D partitioned, leaving A without a quorum
+func newDegradationSystem(t *testing.T) *System {
+	t.Helper()
+	system := newTestSystem(t, nodeIDs(4), countingClock)
+	system.SetLeader("A")
+	system.SetPartition("C", true)
+	system.SetPartition("D", true)
+	return system
+}
+
+// heal reconnects the partitioned nodes
+func heal(system *System) {
+	system.SetPartition("C", false)
+	system.SetPartition("D", false)
+}
+
+// TestNamespace tests that the namespace is the key's first path segment
+func TestNamespace(t *testing.T) {
+	for key, expected := range map[string]string{"cart/a": "cart", "orders/1/line": "orders", "x": ""} {
+		if got := Namespace(key); got != expected {
+			t.Errorf("Expected namespace %q for %q, got %q", expected, key, got)
+		}
+	}
+}
+
+// TestRejectPolicy tests that a rejecting namespace fails without a quorum and commits with one
+func TestRejectPolicy(t *testing.T) {
+	system := newDegradationSystem(t)
+	degraded := NewDegradation(system, nil)
+
+	_, err := degraded.Write("", "A", "x", "1")
+	if !errors.Is(err, ErrWriteRejected) || !errors.Is(err, ErrNoQuorum) {
+		t.Fatalf("Expected a rejected write wrapping ErrNoQuorum, got %v", err)
+	}
+	heal(system)
+	write, err := degraded.Write("", "A", "x", "1")
+	if err != nil || write.Status != StatusCommitted || write.Index != 1 {
+		t.Errorf("Expected the write to commit at index 1 with a quorum, got %+v, %v", write, err)
+	}
+}
+
+// TestQueuePolicy tests that queued writes are uncommitted until recovery replays them in order
+func TestQueuePolicy(t *testing.T) {
+	system := newDegradationSystem(t)
+	degraded := NewDegradation(system, map[string]DegradationPolicy{"orders": PolicyQueue})
+
+	for _, value := range []string{"placed", "paid"} {
+		write, err := degraded.Write("", "C", "orders/1", value)
+		if err != nil || write.Status != StatusUncommitted {
+			t.Fatalf("Expected an uncommitted write, got %+v, %v", write, err)
+		}
+	}
+	if read, _ := degraded.Read("C", "orders/1"); read.Value != "paid" || read.Status != StatusUncommitted {
+		t.Errorf("Expected C to read its own uncommitted write, got %+v", read)
+	}
+	if _, err := degraded.Recover(""); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Expected recovery to need a quorum, got %v", err)
+	}
+
+	heal(system)
+	write, err := degraded.Write("", "C", "orders/1", "shipped")
+	if err != nil || write.Status != StatusUncommitted {
+		t.Errorf("Expected a write behind queued ones to be queued too, got %+v, %v", write, err)
+	}
+	report, err := degraded.Recover("")
+	if err != nil || report.Flushed != 3 {
+		t.Fatalf("Expected 3 flushed writes, got %+v, %v", report, err)
+	}
+	if read, _ := degraded.Read("C", "orders/1"); read.Value != "shipped" || read.Status != StatusCommitted {
+		t.Errorf("Expected the last queued write to be committed, got %+v", read)
+	}
+	if queued := degraded.Queued("C"); len(queued) != 0 {
+		t.Errorf("Expected an empty queue, got %v", queued)
+	}
+}
+
+// TestCRDTPolicy tests that both sides of a partition accept writes that merge on recovery
+func TestCRDTPolicy(t *testing.T) {
+	system := newDegradationSystem(t)
+	degraded := NewDegradation(system, map[string]DegradationPolicy{"cart": PolicyCRDT})
+
+	writes := []struct{ node, key, value string }{
+		{"C", "cart/a", "pear"},
+		{"A", "cart/a", "apple"},
+		{"A", "cart/a", "apples"},
+		{"D", "cart/b", "plum"},
+	}
+	for _, w := range writes {
+		write, err := degraded.Write("", w.node, w.key, w.value)
+		if err != nil || write.Status != StatusCRDT {
+			t.Fatalf("Expected a CRDT write, got %+v, %v", write, err)
+		}
+	}
+	if !degraded.CRDTMode("cart") {
+		t.Fatal("Expected cart to be in CRDT mode")
+	}
+
+	heal(system)
+	report, err := degraded.Recover("")
+	if err != nil {
+		t.Fatalf("Expected recovery to succeed, got %v", err)
+	}
+	if report.Merged != 2 || !reflect.DeepEqual(report.Conflicts, []string{"cart/a"}) || !reflect.DeepEqual(report.Restored, []string{"cart"}) {
+		t.Errorf("Expected 2 merged keys with a conflict on cart/a, got %+v", report)
+	}
+	// A's second write has the highest stamp
+	if read, _ := degraded.Read("D", "cart/a"); read.Value != "apples" || read.Status != StatusCommitted {
+		t.Errorf("Expected the last writer to win everywhere, got %+v", read)
+	}
+	if write, err := degraded.Write("", "A", "cart/c", "fig"); err != nil || write.Status != StatusCommitted {
+		t.Errorf("Expected cart to be back under consensus, got %+v, %v", write, err)
+	}
+}
+
+// TestSimulationDegradationFromConfig tests that the simulation degrades
+// writes by the policies of the running config
+func TestSimulationDegradationFromConfig(t *testing.T) {
+	saved, savedConfig := Output, DefaultConfig
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output, DefaultConfig = saved, savedConfig }()
+
+	tunables := DefaultTunables()
+	tunables.Degradation = map[string]DegradationPolicy{"orders": PolicyReject, "cart": PolicyReject}
+	DefaultConfig, _ = NewConfigReloader("")
+	if err := DefaultConfig.Apply(tunables); err != nil {
+		t.Fatal(err)
+	}
+	results := SimulatePartition(5, nil, nil, nil, nil, nil)
+	if results["degraded_uncommitted"] != 0 || results["degraded_recovered"] != 0 || results["degraded_rejected"] == 0 {
+		t.Errorf("Expected every write without a quorum rejected, got %v uncommitted, %v recovered and %v rejected",
+			results["degraded_uncommitted"], results["degraded_recovered"], results["degraded_rejected"])
+	}
+}
+
+// TestDegradationConfig tests that tunables reject unknown policies
+func TestDegradationConfig(t *testing.T) {
+	tunables, err := ParseTunables([]byte(`{"degradation": {"cart": "crdt", "orders": "queue"}}`))
+	if err != nil || tunables.Degradation["cart"] != PolicyCRDT {
+		t.Errorf("Expected the policies to parse, got %+v, %v", tunables, err)
+	}
+	if _, err := ParseTunables([]byte(`{"degradation": {"cart": "eventual"}}`)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for an unknown policy, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package bft
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cluster diagrams.
+//
+// ExportDOT draws the cluster as it stands as a Graphviz digraph, so any
+// step of a simulation can be looked at rather than read from node dumps.
+// Nodes are filled with the color of their region, Byzantine nodes have a
+// red octagon outline, isolated, partitioned and fenced nodes are dashed
+// and the leader is drawn with a double border. Every neighbor link is an
+// arrow labelled with its one-way latency, one arrow with two heads when
+// both directions are alike; a link that is down, or touches a node that
+// cannot take part in replication, is dashed red.
+
+// regionColors are the fill colors of regions, in order of first use
+var regionColors = []string{"lightblue", "palegreen", "khaki", "plum", "lightsalmon", "lightcyan", "wheat", "lightpink"}
+
+// dotEdge is one direction of a neighbor link
+type dotEdge struct {
+	latency time.Duration
+	cut     bool
+}
+
+// ExportDOT writes the cluster's nodes, links and leader as a Graphviz
+// digraph
+func (s *System) ExportDOT(w io.Writer) error {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	ids := sortedKeys(s.Nodes)
+
+	colors := make(map[string]string)
+	var regions []string
+	for _, id := range ids {
+		region := s.Nodes[id].Region
+		if _, seen := colors[region]; !seen {
+			colors[region] = regionColors[len(regions)%len(regionColors)]
+			regions = append(regions, region)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph \"cluster\" {\n")
+	fmt.Fprintf(&b, "\tlabel=%q;\n", fmt.Sprintf("view %d, leader %s", s.View, s.Leader))
+	fmt.Fprintf(&b, "\tnode [shape=circle, style=filled];\n")
+	for _, region := range regions {
+		fmt.Fprintf(&b, "\tsubgraph %q {\n", "cluster_"+region)
+		fmt.Fprintf(&b, "\t\tlabel=%q;\n", region)
+		for _, id := range ids {
+			node := s.Nodes[id]
+			if node.Region != region {
+				continue
+			}
+			attrs := []string{"fillcolor=" + colors[region]}
+			var notes []string
+			if id == s.Leader {
+				attrs = append(attrs, "peripheries=2")
+				notes = append(notes, "leader")
+			}
+			if node.IsByzantine {
+				attrs = append(attrs, "shape=octagon", "color=red", "penwidth=2")
+				notes = append(notes, "Byzantine")
+			}
+			switch {
+			case s.Fenced[id] != nil:
+				notes = append(notes, "fenced")
+			case node.IsIsolated:
+				notes = append(notes, "isolated")
+			case s.Partition[id]:
+				notes = append(notes, "partitioned")
+			}
+			if !s.reachable(node) {
+				attrs = append(attrs, `style="filled,dashed"`)
+			}
+			label := id
+			if len(notes) > 0 {
+				label += "\n" + strings.Join(notes, ", ")
+			}
+			attrs = append([]string{fmt.Sprintf("label=%q", label)}, attrs...)
+			fmt.Fprintf(&b, "\t\t%q [%s];\n", id, strings.Join(attrs, ", "))
+		}
+		fmt.Fprintf(&b, "\t}\n")
+	}
+
+	edges := make(map[[2]string]dotEdge)
+	for _, id := range ids {
+		from := s.Nodes[id]
+		for _, neighbor := range from.Neighbors {
+			to, exists := s.Nodes[neighbor]
+			if !exists {
+				continue
+			}
+			profile := s.LinkProfiles[[2]string{id, neighbor}]
+			latency := profile.Latency
+			if latency <= 0 {
+				latency = s.regionLatency(from.Region, to.Region)
+			}
+			cut := profile.Down || profile.Drop >= 1 || !s.reachable(from) || !s.reachable(to)
+			edges[[2]string{id, neighbor}] = dotEdge{latency: latency, cut: cut}
+		}
+	}
+	links := make([][2]string, 0, len(edges))
+	for link := range edges {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i][0] != links[j][0] {
+			return links[i][0] < links[j][0]
+		}
+		return links[i][1] < links[j][1]
+	})
+	for _, link := range links {
+		edge := edges[link]
+		reverse, both := edges[[2]string{link[1], link[0]}]
+		if both && reverse == edge && link[0] > link[1] {
+			continue // Drawn with its reverse
+		}
+		attrs := []string{fmt.Sprintf("label=%q", edge.latency.String())}
+		if both && reverse == edge {
+			attrs = append(attrs, "dir=both")
+		}
+		if edge.cut {
+			attrs = append(attrs, "style=dashed", "color=red")
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [%s];\n", link[0], link[1], strings.Join(attrs, ", "))
+	}
+	fmt.Fprintf(&b, "}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// DotCommand implements `wahello dot [experiment flags] [-o file]`, writing
+// the scenario's cluster as it starts as a Graphviz digraph
+func DotCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("dot", flag.ContinueOnError)
+	var experiment ExperimentFlags
+	experiment.Register(flags)
+	output := flags.String("o", "", "write the digraph to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sc, err := experiment.Prepare()
+	if err != nil {
+		return err
+	}
+	system := NewSystem()
+	if err := sc.Build(system, experiment.Seed); err != nil {
+		return err
+	}
+	if *output == "" {
+		return system.ExportDOT(stdout)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := system.ExportDOT(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,55 @@
+package bft
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExportDOT tests the diagram of the default scenario's cluster
+func TestExportDOT(t *testing.T) {
+	system := NewSystem()
+	if err := DefaultScenario().Build(system, 1); err != nil {
+		t.Fatal(err)
+	}
+	system.SetLinkProfile("B", "A", LinkProfile{Down: true})
+	var b strings.Builder
+	if err := system.ExportDOT(&b); err != nil {
+		t.Fatal(err)
+	}
+	dot := b.String()
+	for _, line := range []string{
+		`digraph "cluster" {`,
+		`subgraph "cluster_eu-west" {`,
+		`"A" [label="A\nleader", fillcolor=lightblue, peripheries=2];`,
+		`"D" [label="D\nisolated", fillcolor=palegreen, style="filled,dashed"];`,
+		`"F" [label="F\nByzantine", fillcolor=khaki, shape=octagon, color=red, penwidth=2];`,
+		`"A" -> "C" [label="1ms", dir=both];`,
+		`"A" -> "B" [label="1ms"];`,
+		`"B" -> "A" [label="1ms", style=dashed, color=red];`,
+		`"A" -> "D" [label="40ms", style=dashed, color=red];`,
+	} {
+		if !strings.Contains(dot, line+"\n") {
+			t.Errorf("Expected line %q in\n%s", line, dot)
+		}
+	}
+	if strings.Contains(dot, `"C" -> "A"`) {
+		t.Errorf("Expected a link alike both ways drawn once\n%s", dot)
+	}
+}
+
+// TestDotCommand tests writing a generated topology's diagram to a file
+func TestDotCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring.dot")
+	if err := DotCommand([]string{"-topology", "ring", "-nodes", "4", "-seed", "1", "-o", path}, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `digraph "cluster" {`) || strings.Count(string(data), "->") < 4 {
+		t.Errorf("Expected a digraph of a 4-node ring, got\n%s", data)
+	}
+}
@@ -0,0 +1,230 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Consensus drivers.
+//
+// PBFT, Raft and HotStuff each run a member on every voter and exchange
+// their messages over the system's simulated network. A driver does the part
+// they share: it hands requests to the reachable members, encodes what a
+// member wants sent and puts it on the network, subject to the links and
+// the congestion model, delivers and decodes it at the receiver, and starts
+// the member's timers on the scheduler. The protocol embeds a driver and
+// fills in its hooks for what differs: how messages are named, how long
+// timers run, and what it records once a member moved on.
+
+// consensusSend is a message a member wants sent, to To or, if empty, to
+// every other member
+type consensusSend struct {
+	To  string
+	Msg Message
+}
+
+// consensusMember is one voter's state in a protocol a driver runs, with
+// timers of type T
+type consensusMember[T any] interface {
+	node() *Node     // The voter it runs on
+	group() []string // Every member's ID, its own included
+	Request(payload []byte)
+	Deliver(from string, m Message) error
+	Timeout(timer T)
+	// drain returns and clears the messages waiting to be sent and the
+	// timers waiting to be started
+	drain() ([]consensusSend, []T)
+}
+
+// MessageStats counts the messages a protocol put on the network
+type MessageStats struct {
+	Sent      int // Messages put on the network, dropped or not
+	Delivered int // Messages handed to a member
+	Dropped   int // Messages lost on unreachable links
+	Rejected  int // Delivered messages a member refused
+}
+
+// driver carries the messages of a protocol's members, of type M, and fires
+// their timers, of type T
+type driver[M consensusMember[T], T any] struct {
+	System *System
+	// Scheduler carries the messages and fires the timers: the system's if
+	// it has one, else one of the protocol's own
+	Scheduler *Scheduler
+	protocol  string // Labels the consensus metrics
+	members   map[string]M
+	stats     *MessageStats
+	// kind is the capture kind of a message
+	kind func(Message) string
+	// timer returns how long a member's timer runs and its label
+	timer func(member M, timer T) (time.Duration, string)
+	// settle records what a member did after it took a request, a message or
+	// a timeout
+	settle func(member M)
+	// affords, if set, reports whether the member's budget covers sending
+	// another message, signing it first if sign
+	affords func(member M, sign bool) bool
+	// arrive, if set, takes a frame off the network in place of deliver
+	arrive func(from, to string, frame []byte)
+	// outstanding reports whether a submitted request is not yet committed
+	outstanding func() bool
+	// status describes a member for diagnostics
+	status func(member M) string
+}
+
+// newDriver returns a driver for members with the given metric label,
+// counting traffic in stats
+func newDriver[M consensusMember[T], T any](system *System, protocol string, members map[string]M, stats *MessageStats) driver[M, T] {
+	d := driver[M, T]{System: system, Scheduler: system.Scheduler, protocol: protocol, members: members, stats: stats}
+	if d.Scheduler == nil {
+		d.Scheduler = NewScheduler(0)
+	}
+	return d
+}
+
+// reachable reports whether node is up and not cut off
+func (d *driver[M, T]) reachable(node *Node) bool {
+	d.System.Lock.RLock()
+	defer d.System.Lock.RUnlock()
+	return d.System.reachable(node)
+}
+
+// submit hands payload to every reachable member
+func (d *driver[M, T]) submit(payload []byte) {
+	for _, id := range sortedKeys(d.members) {
+		member := d.members[id]
+		if !d.reachable(member.node()) {
+			continue
+		}
+		member.Request(payload)
+		d.settle(member)
+		d.send(member)
+	}
+}
+
+// Run delivers messages and fires timers in time order until nothing is
+// left, or until a watchdog finds the run stalled, see Watch
+func (d *driver[M, T]) Run() error {
+	return d.Scheduler.Run()
+}
+
+// Watch fails later runs that go window of virtual time without executing a
+// request, or that run out of messages and timers before every submitted
+// request committed. The report dumps every member's state.
+func (d *driver[M, T]) Watch(window time.Duration) *Watchdog {
+	w := &Watchdog{
+		Window:   window,
+		System:   d.System,
+		Busy:     d.outstanding,
+		Describe: d.describe,
+	}
+	d.Scheduler.Watch(w)
+	return w
+}
+
+// describe summarizes every member's state for diagnostics
+func (d *driver[M, T]) describe() []string {
+	var lines []string
+	for _, id := range sortedKeys(d.members) {
+		lines = append(lines, d.status(d.members[id]))
+	}
+	return lines
+}
+
+// deliver hands a frame to its receiver, unless the receiver went down while
+// it was in flight
+func (d *driver[M, T]) deliver(from, to string, frame []byte) {
+	member := d.members[to]
+	if !d.reachable(member.node()) {
+		d.stats.Dropped++
+		return
+	}
+	if d.System.certified(member.node(), from) != nil {
+		d.stats.Rejected++
+		return
+	}
+	m, err := DecodeFrame(frame)
+	if err == nil {
+		d.System.trace(TraceEvent{Type: EventReceive, Node: to, Peer: from, Detail: d.kind(m)})
+		d.stats.Delivered++
+		err = member.Deliver(from, m)
+	}
+	switch {
+	case errors.Is(err, ErrConflictingPrePrepare):
+		d.System.audit(AuditEquivocation, to, from, err.Error())
+	case errors.Is(err, ErrConsensusSignature):
+		d.System.audit(AuditSignatureFailure, to, from, err.Error())
+	}
+	if err != nil {
+		d.stats.Rejected++
+	}
+	d.settle(member)
+	d.send(member)
+}
+
+// send puts a member's outgoing messages on the network and starts its
+// timers. Messages from or to an unreachable member are lost, and so are the
+// timers of an unreachable member; the others queue in the consensus lane of
+// the system's congestion model, if any.
+func (d *driver[M, T]) send(member M) {
+	s := d.System
+	self := member.node()
+	sends, timers := member.drain()
+	for _, timer := range timers {
+		timeout, label := d.timer(member, timer)
+		d.Scheduler.Timer(timeout, label, func() {
+			if !d.reachable(self) {
+				return
+			}
+			member.Timeout(timer)
+			d.settle(member)
+			d.send(member)
+		})
+	}
+	for _, out := range sends {
+		frame, err := EncodeFrame(out.Msg)
+		if err != nil {
+			continue
+		}
+		targets := member.group()
+		if out.To != "" {
+			targets = []string{out.To}
+		}
+		kind := d.kind(out.Msg)
+		signed := false
+		var sent []TraceEvent
+		s.Lock.RLock()
+		for _, id := range targets {
+			if id == self.ID {
+				continue
+			}
+			if d.affords != nil && !d.affords(member, !signed) {
+				continue
+			}
+			signed = true
+			to := s.Nodes[id]
+			latency, delivered := s.transit(self, to, len(frame))
+			packet := newPacket(self, to, kind, len(frame), latency)
+			d.stats.Sent++
+			s.Metrics.add(metricConsensus, d.protocol, 1)
+			if !delivered || !s.reachable(self) || !s.reachable(to) {
+				packet.Dropped = true
+				d.stats.Dropped++
+			} else {
+				arrive := d.arrive
+				if arrive == nil {
+					arrive = d.deliver
+				}
+				label := fmt.Sprintf("%s %s->%s", kind, self.ID, id)
+				sent = append(sent, TraceEvent{Type: EventSend, Node: self.ID, Peer: id, Detail: kind})
+				s.Congestion.send(d.Scheduler, self.ID, id, len(frame), LaneConsensus, latency, label, func() { arrive(self.ID, id, frame) })
+			}
+			s.capture(packet)
+		}
+		s.Lock.RUnlock()
+		for _, event := range sent {
+			s.trace(event)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Durability oracle.
+//
+// An acknowledged commit must outlive every fault the cluster tolerates:
+// the leader acknowledges an entry only once a quorum of 2f+1 voters has
+// it, so however nodes crash and restart afterwards, at least f+1 replicas
+// hold it and one of them is correct. The DurabilityOracle records every
+// write acknowledged with a commit proof during a run and checks at the end
+// that each one is still held by f+1 correct replicas; Byzantine replicas
+// claiming to hold it do not count. RunDurability drives such a run: it
+// injects a fault schedule, gossips, and writes a fresh key through the
+// leader every round.
+//
+// A crash only loses state the node had not persisted. A node with a
+// NodeDisk, see UseDisks, logs every entry it applies to a write-ahead log
+// and periodically snapshots its store; a crash wipes its memory and
+// discards whatever the log had not synced under its policy, and a restart
+// rebuilds the store from the snapshot and the log. A node without a disk
+// keeps its store across a crash, as if every write were synced.
+
+var ErrCommitLost = errors.New("acknowledged commit lost")
+
+// DurabilityClient is the client RunDurability writes as
+const DurabilityClient = "durability"
+
+// AckedCommit is a write the cluster acknowledged with a proof
+type AckedCommit struct {
+	Entry Entry
+	Proof *CommitProof
+	Round int
+}
+
+// DurabilityOracle records acknowledged commits and checks they survive
+type DurabilityOracle struct {
+	Acked []AckedCommit
+	Lock  sync.Mutex
+}
+
+// NewDurabilityOracle creates an oracle with nothing acknowledged
+func NewDurabilityOracle() *DurabilityOracle {
+	return &DurabilityOracle{}
+}
+
+// Acknowledge records a committed entry after checking that the proof is
+// the leader's and covers req at the entry's index
+func (o *DurabilityOracle) Acknowledge(system *System, req *ClientRequest, entry Entry, proof *CommitProof, round int) error {
+	if proof == nil || proof.Digest != req.Digest() || proof.Index != entry.Index {
+		return ErrReplayedProof
+	}
+	if err := system.verifyCommitProof(proof); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCommitProof, err)
+	}
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+	o.Acked = append(o.Acked, AckedCommit{Entry: entry, Proof: proof, Round: round})
+	return nil
+}
+
+// Holders returns the correct replicas whose stores hold a committed entry,
+// or a later write that replaced it
+func (o *DurabilityOracle) Holders(system *System, entry Entry) []string {
+	system.Lock.RLock()
+	defer system.Lock.RUnlock()
+	var holders []string
+	for _, id := range sortedKeys(system.Nodes) {
+		node := system.Nodes[id]
+		node.Lock.RLock()
+		stored, exists := node.Store.Entries[entry.Key]
+		byzantine := node.IsByzantine
+		node.Lock.RUnlock()
+		if byzantine {
+			continue
+		}
+		if exists && (stored.Index > entry.Index || stored.Index == entry.Index && stored.Value == entry.Value) {
+			holders = append(holders, id)
+		}
+	}
+	return holders
+}
+
+// Check returns the acknowledged commits held by fewer than f+1 replicas,
+// and an error wrapping ErrCommitLost if there are any
+func (o *DurabilityOracle) Check(system *System) ([]AckedCommit, error) {
+	system.Lock.RLock()
+	required := system.faultThreshold(len(system.voters())) + 1
+	system.Lock.RUnlock()
+	o.Lock.Lock()
+	acked := append([]AckedCommit(nil), o.Acked...)
+	o.Lock.Unlock()
+
+	var lost []AckedCommit
+	var reasons []string
+	for _, commit := range acked {
+		if holders := o.Holders(system, commit.Entry); len(holders) < required {
+			lost = append(lost, commit)
+			reasons = append(reasons, fmt.Sprintf("index %d (%s) acknowledged in round %d is held by %v, need %d replicas",
+				commit.Entry.Index, commit.Entry.Key, commit.Round, holders, required))
+		}
+	}
+	if len(lost) > 0 {
+		return lost, fmt.Errorf("%w: %s", ErrCommitLost, strings.Join(reasons, "; "))
+	}
+	return nil, nil
+}
+
+// DurabilityReport is the outcome of a durability run
+type DurabilityReport struct {
+	Rounds   int
+	Acked    int           // Writes acknowledged with a proof
+	Refused  int           // Writes the cluster refused, never acknowledged
+	Required int           // Replicas each acknowledged write must be on, f+1
+	Lost     []AckedCommit // Acknowledged writes held by fewer replicas
+}
+
+func (r *DurabilityReport) String() string {
+	return fmt.Sprintf("%d writes acknowledged and %d refused over %d rounds; %d acknowledged writes on fewer than %d replicas",
+		r.Acked, r.Refused, r.Rounds, len(r.Lost), r.Required)
+}
+
+// durabilitySnapshotInterval is how many rounds apart RunDurability
+// snapshots the stores of nodes with disks
+const durabilitySnapshotInterval = 4
+
+// RunDurability runs rounds of a fault schedule on system, writing a fresh
+// key through the leader every round and recording the acknowledged writes
+// with oracle, and checks at the end that none was lost. Nodes with disks
+// snapshot their stores every few rounds. A lost commit is reported and
+// returned as an error wrapping ErrCommitLost.
+func RunDurability(system *System, oracle *DurabilityOracle, schedule Schedule, rounds int) (*DurabilityReport, error) {
+	system.Lock.RLock()
+	ids := sortedKeys(system.Nodes)
+	system.Lock.RUnlock()
+	report := &DurabilityReport{Rounds: rounds}
+	for round := 0; round < rounds; round++ {
+		for _, step := range schedule {
+			if step.Duration > 0 && step.At+step.Duration == round {
+				if err := system.RevertFault(step, round); err != nil {
+					return report, err
+				}
+			}
+		}
+		for _, step := range schedule {
+			if step.At == round {
+				if err := system.ApplyFault(step); err != nil {
+					return report, err
+				}
+			}
+		}
+		system.propagateRound(ids)
+		if round > 0 && round%durabilitySnapshotInterval == 0 {
+			if err := system.snapshotDisks(); err != nil {
+				return report, err
+			}
+		}
+
+		key, value := fmt.Sprintf("durable/%d", round), fmt.Sprint(round)
+		data, err := json.Marshal(RequestPayload{Kind: OpWrite, Key: key, Value: value})
+		if err != nil {
+			return report, err
+		}
+		req := &ClientRequest{Client: DurabilityClient, RequestID: uint64(round + 1), Payload: data}
+		system.Lock.RLock()
+		leader := system.Leader
+		system.Lock.RUnlock()
+		result, err := system.SubmitWrite("", leader, key, value)
+		if err != nil {
+			report.Refused++
+			continue
+		}
+		proof, err := system.IssueCommitProof(req, result.Index)
+		if err != nil {
+			return report, err
+		}
+		if err := oracle.Acknowledge(system, req, Entry{Index: result.Index, Key: key, Value: value}, proof, round); err != nil {
+			return report, err
+		}
+		report.Acked++
+	}
+	system.Lock.RLock()
+	report.Required = system.faultThreshold(len(system.voters())) + 1
+	system.Lock.RUnlock()
+	lost, err := oracle.Check(system)
+	report.Lost = lost
+	return report, err
+}
+
+// diskWAL and diskSnapshot name a node disk's log directory and snapshot
+const (
+	diskWAL      = "wal"
+	diskSnapshot = "snapshot"
+)
+
+// NodeDisk persists a node's store in Dir: every entry applied to the store
+// is appended to a write-ahead log synced under Policy, and Snapshot writes
+// the whole store and starts the log afresh
+type NodeDisk struct {
+	Dir    string
+	Policy SyncPolicy
+	wal    *WAL  // Nil while the node is crashed
+	err    error // First append that failed since the disk was opened
+}
+
+// diskRecord is an applied entry as logged
+type diskRecord struct {
+	Entry     Entry `json:"entry"`
+	Namespace bool  `json:"namespace,omitempty"` // Applied with Store.ApplyNamespace
+}
+
+// OpenNodeDisk opens or creates a node disk in dir
+func OpenNodeDisk(dir string, policy SyncPolicy) (*NodeDisk, error) {
+	wal, err := OpenWAL(filepath.Join(dir, diskWAL), policy)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeDisk{Dir: dir, Policy: policy, wal: wal}, nil
+}
+
+// log appends an applied entry. Failures are kept for Err.
+func (d *NodeDisk) log(entry Entry, namespace bool) {
+	if d.wal == nil || d.err != nil {
+		return
+	}
+	data, err := json.Marshal(diskRecord{Entry: entry, Namespace: namespace})
+	if err == nil {
+		err = d.wal.Append(d.wal.LastSeq()+1, data)
+	}
+	d.err = err
+}
+
+// Err returns the first append that failed since the disk was opened or
+// recovered
+func (d *NodeDisk) Err() error {
+	return d.err
+}
+
+// Snapshot writes store to the disk and starts a fresh log, so a restart
+// replays only what is applied from then on
+func (d *NodeDisk) Snapshot(store *Store) error {
+	if d.wal == nil {
+		return fmt.Errorf("snapshot of a crashed disk in %s", d.Dir)
+	}
+	if err := SaveSnapshot(filepath.Join(d.Dir, diskSnapshot), store, nil); err != nil {
+		return err
+	}
+	if err := d.wal.Close(); err != nil {
+		return err
+	}
+	d.wal = nil
+	if err := os.RemoveAll(filepath.Join(d.Dir, diskWAL)); err != nil {
+		return err
+	}
+	wal, err := OpenWAL(filepath.Join(d.Dir, diskWAL), d.Policy)
+	if err != nil {
+		return err
+	}
+	d.wal = wal
+	return nil
+}
+
+// crash loses whatever the log had not synced and closes it
+func (d *NodeDisk) crash() error {
+	if d.wal == nil {
+		return nil
+	}
+	err := d.wal.Crash()
+	d.wal = nil
+	return err
+}
+
+// Recover reopens the disk and rebuilds the store it persisted: the latest
+// snapshot, then every entry the log kept, in order. The store logs to the
+// disk from then on.
+func (d *NodeDisk) Recover() (*Store, error) {
+	if d.wal != nil {
+		if err := d.wal.Close(); err != nil {
+			return nil, err
+		}
+		d.wal = nil
+	}
+	store := NewStore()
+	path := filepath.Join(d.Dir, diskSnapshot)
+	if _, err := os.Stat(path); err == nil {
+		if store, err = LoadSnapshot(path, nil); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	dir := filepath.Join(d.Dir, diskWAL)
+	wal, err := OpenWAL(dir, d.Policy)
+	if err != nil {
+		return nil, err
+	}
+	records, err := ReadRangeNaive(dir, 1, wal.LastSeq())
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+	for _, rec := range records {
+		var logged diskRecord
+		if err := json.Unmarshal(rec.Payload, &logged); err != nil {
+			wal.Close()
+			return nil, fmt.Errorf("%w: record %d in %s: %v", ErrWALCorrupt, rec.Seq, dir, err)
+		}
+		if logged.Namespace {
+			store.ApplyNamespace(logged.Entry)
+		} else {
+			store.Apply(logged.Entry)
+		}
+	}
+	d.wal, d.err = wal, nil
+	store.Disk = d
+	return store, nil
+}
+
+// Close closes the disk's log
+func (d *NodeDisk) Close() error {
+	if d.wal == nil {
+		return nil
+	}
+	err := d.wal.Close()
+	d.wal = nil
+	return err
+}
+
+// UseDisks gives every node a disk in dir/<node> under policy, starting
+// with a snapshot of the store it holds
+func (s *System) UseDisks(dir string, policy SyncPolicy) error {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	for _, id := range sortedKeys(s.Nodes) {
+		node := s.Nodes[id]
+		disk, err := OpenNodeDisk(filepath.Join(dir, id), policy)
+		if err != nil {
+			return err
+		}
+		node.Lock.Lock()
+		err = disk.Snapshot(node.Store)
+		node.Store.Disk = disk
+		node.Lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CloseDisks closes the disks of every node
+func (s *System) CloseDisks() error {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	var firstErr error
+	for _, id := range sortedKeys(s.Nodes) {
+		node := s.Nodes[id]
+		node.Lock.Lock()
+		if disk := node.Store.Disk; disk != nil {
+			if err := disk.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		node.Lock.Unlock()
+	}
+	return firstErr
+}
+
+// snapshotDisks snapshots the store of every running node with a disk
+func (s *System) snapshotDisks() error {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	for _, id := range sortedKeys(s.Nodes) {
+		node := s.Nodes[id]
+		if s.Fenced[id] != nil {
+			continue
+		}
+		node.Lock.Lock()
+		var err error
+		if disk := node.Store.Disk; disk != nil {
+			err = disk.Snapshot(node.Store)
+		}
+		node.Lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// crashDisk wipes the memory of a node with a disk, keeping only what the
+// disk persisted
+func (n *Node) crashDisk() error {
+	n.Lock.Lock()
+	defer n.Lock.Unlock()
+	disk := n.Store.Disk
+	if disk == nil {
+		return nil
+	}
+	n.Store = NewStore()
+	n.Store.Disk = disk
+	return disk.crash()
+}
+
+// recoverDisk rebuilds the store of a restarted node with a disk
+func (n *Node) recoverDisk() error {
+	n.Lock.Lock()
+	defer n.Lock.Unlock()
+	disk := n.Store.Disk
+	if disk == nil {
+		return nil
+	}
+	store, err := disk.Recover()
+	if err != nil {
+		return err
+	}
+	n.Store = store
+	return nil
+}
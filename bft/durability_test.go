@@ -0,0 +1,120 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDurabilityAcrossCrashes tests that every write acknowledged through crashes, restarts and a partition stays on f+1 replicas
+func TestDurabilityAcrossCrashes(t *testing.T) {
+	system := newGossipSystem(t, nil)
+	oracle := NewDurabilityOracle()
+	schedule := Schedule{
+		{At: 2, Kind: FaultCrash, Nodes: []string{"B"}, Duration: 3},
+		{At: 6, Kind: FaultCrash, Nodes: []string{"C"}, Duration: 3},
+		{At: 10, Kind: FaultCrash, Nodes: []string{"B", "C", "D"}, Duration: 2},
+		{At: 13, Kind: FaultPartition, Nodes: []string{"D"}, Duration: 2},
+	}
+	report, err := RunDurability(system, oracle, schedule, 16)
+	if err != nil {
+		t.Fatalf("Expected no acknowledged commit to be lost, got %v", err)
+	}
+	if report.Acked != 14 || report.Refused != 2 || report.Required != 2 {
+		t.Errorf("Expected the two rounds without a quorum to refuse writes, got %s", report)
+	}
+	for _, commit := range oracle.Acked {
+		if holders := oracle.Holders(system, commit.Entry); len(holders) < 3 {
+			t.Errorf("Expected index %d on a quorum, held by %v", commit.Entry.Index, holders)
+		}
+	}
+}
+
+// TestDurabilityOnDisks tests that nodes restarting from disks synced per
+// commit keep every acknowledged write, and that disks left to the operating
+// system's cache lose them when a quorum crashes together
+func TestDurabilityOnDisks(t *testing.T) {
+	schedule := Schedule{
+		{At: 2, Kind: FaultCrash, Nodes: []string{"B"}, Duration: 3},
+		{At: 10, Kind: FaultCrash, Nodes: []string{"B", "C", "D"}, Duration: 2},
+	}
+	for _, mode := range []SyncMode{SyncPerCommit, SyncOSCached} {
+		system := newGossipSystem(t, nil)
+		if err := system.UseDisks(t.TempDir(), SyncPolicy{Mode: mode}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := RunDurability(system, NewDurabilityOracle(), schedule, 14)
+		system.CloseDisks()
+		if lost := errors.Is(err, ErrCommitLost); lost != (mode == SyncOSCached) {
+			t.Errorf("%v: expected commits lost %v, got %v", mode, mode == SyncOSCached, err)
+		}
+	}
+}
+
+// TestNodeDiskRecover tests that a restarted node rebuilds its store from
+// the last snapshot and the entries logged after it
+func TestNodeDiskRecover(t *testing.T) {
+	disk, err := OpenNodeDisk(t.TempDir(), SyncPolicy{Mode: SyncPerCommit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	store := NewStore()
+	store.Disk = disk
+	store.Apply(Entry{Index: 1, Key: "x", Value: "1"})
+	if err := disk.Snapshot(store); err != nil {
+		t.Fatal(err)
+	}
+	store.Apply(Entry{Index: 2, Key: "y", Value: "2"})
+	store.ApplyNamespace(Entry{Index: 1, Key: "ledger/a", Value: "3"})
+	if err := disk.crash(); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := disk.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered.CommitIndex != 2 || recovered.Entries["x"].Value != "1" || recovered.Entries["y"].Value != "2" || recovered.Namespaces["ledger"] != 1 {
+		t.Errorf("Expected x, y and ledger/a recovered, got %+v", recovered)
+	}
+	recovered.Apply(Entry{Index: 3, Key: "z", Value: "4"})
+	if err := disk.Err(); err != nil {
+		t.Errorf("Expected the recovered store to keep logging, got %v", err)
+	}
+}
+
+// TestDurabilityOracleCatchesLoss tests that the oracle flags an acknowledged entry that replicas dropped and refuses foreign proofs
+func TestDurabilityOracleCatchesLoss(t *testing.T) {
+	system := newGossipSystem(t, nil)
+	oracle := NewDurabilityOracle()
+	if _, err := RunDurability(system, oracle, nil, 3); err != nil {
+		t.Fatal(err)
+	}
+	lostEntry := oracle.Acked[1].Entry
+	for _, id := range []string{"B", "C", "D"} {
+		delete(system.Nodes[id].Store.Entries, lostEntry.Key)
+	}
+	lost, err := oracle.Check(system)
+	if !errors.Is(err, ErrCommitLost) || len(lost) != 1 || lost[0].Entry != lostEntry {
+		t.Errorf("Expected index %d to be reported lost, got %v", lostEntry.Index, err)
+	}
+
+	req := &ClientRequest{Client: "c", RequestID: 1, Payload: payload(OpWrite, "x", "1")}
+	proof := oracle.Acked[0].Proof
+	if err := oracle.Acknowledge(system, req, Entry{Index: proof.Index, Key: "x", Value: "1"}, proof, 0); !errors.Is(err, ErrReplayedProof) {
+		t.Errorf("Expected a proof for another request to be refused, got %v", err)
+	}
+}
+
+// TestWriteNeedsQuorum tests that a leader cut off from its quorum acknowledges nothing
+func TestWriteNeedsQuorum(t *testing.T) {
+	system := newGossipSystem(t, nil)
+	system.SetPartition("B", true)
+	system.SetPartition("C", true)
+	if _, err := system.SubmitWrite("", "A", "x", "1"); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Expected ErrNoQuorum, got %v", err)
+	}
+	if _, exists := system.Nodes["A"].Store.Entries["x"]; exists {
+		t.Error("Expected the refused write not to be applied")
+	}
+}
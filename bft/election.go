@@ -0,0 +1,363 @@
+package bft
+
+import (
+	"sort"
+	"time"
+)
+
+// Leader election with an optional pre-vote phase.
+//
+// Time advances in ticks. Every tick the leader heartbeats all nodes it can
+// reach. A follower that has not heard from a leader for Timeout ticks
+// starts an election by moving to the next view and asking its peers to
+// join; once a quorum is in the same view, that view's leader (chosen
+// round-robin by view number) takes over.
+//
+// Without pre-vote a partitioned node keeps timing out and raising its view
+// while nobody can hear it. When the partition heals, its high view reaches
+// the healthy leader, which must step down, and the cluster goes through a
+// needless election. With pre-vote a node first asks whether its peers would
+// support an election at all; peers that still hear from a leader refuse, so
+// the isolated node never raises its view and rejoins quietly.
+//
+// Leader stickiness damps flapping under transient faults. Within
+// StickyWindow ticks after the previous leader was last heard, followers do
+// not replace it while it is unreachable, and any election they hold picks a
+// view led by the previous leader. A leader that recovers quickly therefore
+// keeps its role, trading a few leaderless ticks for fewer leader changes.
+
+// DefaultTickDuration is the wall-clock length of a tick for rate metrics
+const DefaultTickDuration = 100 * time.Millisecond
+
+// ElectionConfig tunes leader election
+type ElectionConfig struct {
+	Timeout      int           // Ticks without a heartbeat before a follower starts an election
+	PreVote      bool          // Probe peers before starting an election
+	StickyWindow int           // Extra ticks to wait for the previous leader to recover
+	FlapWindow   int           // Leader changes closer together than this count as flaps
+	TickDuration time.Duration // Wall-clock length of a tick, DefaultTickDuration if zero
+}
+
+// LeaderChange records one change of leader
+type LeaderChange struct {
+	Tick int
+	From string
+	To   string
+}
+
+// ElectionStats summarizes leadership behavior over a run
+type ElectionStats struct {
+	Ticks           int
+	Elections       int // Successful elections, including re-electing the same node
+	LeaderChanges   int // Elections that installed a different node
+	Flaps           int // Leader changes within FlapWindow ticks of the previous one
+	LeaderlessTicks int
+	PreVotesDenied  int
+	StickyWaits     int // Elections postponed to let the previous leader recover
+	Changes         []LeaderChange
+	TickDuration    time.Duration
+}
+
+// Election runs leader election over a system
+type Election struct {
+	System        *System
+	Config        ElectionConfig
+	Stats         ElectionStats
+	views         map[string]int64
+	lastHeard     map[string]int
+	ids           []string
+	tick          int
+	lastLeader    string
+	leaderHeardAt int // Last tick the leader reached another node
+	phases        map[string]Phase
+}
+
+// NewElection creates an election driver. All nodes start in view 0 and
+// treat the system's current leader as live.
+func NewElection(system *System, config ElectionConfig) *Election {
+	e := &Election{
+		System:    system,
+		Config:    config,
+		views:     make(map[string]int64),
+		lastHeard: make(map[string]int),
+		phases:    make(map[string]Phase),
+	}
+	system.Lock.RLock()
+	for id := range system.Nodes {
+		e.ids = append(e.ids, id)
+		e.views[id] = 0
+		e.phases[id] = ElectionFSM.Initial
+	}
+	system.Lock.RUnlock()
+	sort.Strings(e.ids)
+	e.lastLeader = system.GetLeader()
+	if e.lastLeader != "" {
+		e.step(e.lastLeader, "elected")
+	}
+	e.Stats.TickDuration = config.TickDuration
+	if e.Stats.TickDuration == 0 {
+		e.Stats.TickDuration = DefaultTickDuration
+	}
+	return e
+}
+
+// View returns the view a node is currently in
+func (e *Election) View(nodeID string) int64 {
+	return e.views[nodeID]
+}
+
+// Phase returns the election phase a node is in
+func (e *Election) Phase(nodeID string) Phase {
+	return e.phases[nodeID]
+}
+
+// step moves a node along the election state machine
+func (e *Election) step(nodeID, on string) {
+	e.phases[nodeID] = ElectionFSM.MustNext(e.phases[nodeID], on)
+}
+
+// LeaderForView returns the round-robin leader of a view
+func (e *Election) LeaderForView(view int64) string {
+	return e.ids[int(view%int64(len(e.ids)))]
+}
+
+// quorum is the number of nodes needed to establish a view
+func (e *Election) quorum() int {
+	return len(e.ids)/2 + 1
+}
+
+// connected reports whether two nodes can currently exchange messages
+func (e *Election) connected(a, b string) bool {
+	if e.System.IsFenced(a) || e.System.IsFenced(b) {
+		return false
+	}
+	return a == b || (!e.System.IsPartitioned(a) && !e.System.IsPartitioned(b))
+}
+
+// Tick advances the election by one tick
+func (e *Election) Tick() {
+	e.tick++
+	e.Stats.Ticks++
+
+	leader := e.System.GetLeader()
+	if leader != "" {
+		e.heartbeat(leader)
+	}
+	for _, id := range e.ids {
+		if id == e.System.GetLeader() {
+			continue
+		}
+		if e.tick-e.lastHeard[id] >= e.Config.Timeout {
+			e.campaign(id)
+		}
+	}
+	if e.System.GetLeader() == "" {
+		e.Stats.LeaderlessTicks++
+	}
+}
+
+// heartbeat sends the leader's heartbeat to every reachable node. A node in
+// a higher view rejects it, forcing the leader to step down.
+func (e *Election) heartbeat(leader string) {
+	leaderView := e.views[leader]
+	for _, id := range e.ids {
+		if !e.connected(leader, id) {
+			continue
+		}
+		if e.views[id] > leaderView {
+			e.views[leader] = e.views[id]
+			e.System.SetLeader("")
+			e.step(leader, "higher-view")
+			e.lastHeard[leader] = e.tick
+			return
+		}
+		e.views[id] = leaderView
+		e.lastHeard[id] = e.tick
+		if id != leader {
+			e.leaderHeardAt = e.tick
+		}
+	}
+}
+
+// sticky reports whether a candidate should defer to the previous leader
+func (e *Election) sticky(candidate string) bool {
+	return e.Config.StickyWindow > 0 && e.lastLeader != "" && e.lastLeader != candidate &&
+		e.tick-e.leaderHeardAt < e.Config.Timeout+e.Config.StickyWindow
+}
+
+// nextViewLedBy returns the first view >= from whose leader is nodeID
+func (e *Election) nextViewLedBy(nodeID string, from int64) int64 {
+	for view := from; view < from+int64(len(e.ids)); view++ {
+		if e.LeaderForView(view) == nodeID {
+			return view
+		}
+	}
+	return from
+}
+
+// install makes nodeID the leader and records the change
+func (e *Election) install(nodeID string) {
+	e.Stats.Elections++
+	if nodeID != e.lastLeader {
+		e.Stats.LeaderChanges++
+		changes := e.Stats.Changes
+		if len(changes) > 0 && e.tick-changes[len(changes)-1].Tick <= e.Config.FlapWindow {
+			e.Stats.Flaps++
+		}
+		e.Stats.Changes = append(changes, LeaderChange{Tick: e.tick, From: e.lastLeader, To: nodeID})
+	}
+	e.lastLeader = nodeID
+	e.leaderHeardAt = e.tick
+	e.System.SetLeader(nodeID)
+	for _, id := range e.ids {
+		if id != nodeID && e.phases[id] == PhaseLeader {
+			e.step(id, "higher-view")
+		}
+	}
+	e.step(nodeID, "elected")
+}
+
+// campaign runs one election attempt by a timed-out node
+func (e *Election) campaign(candidate string) {
+	e.lastHeard[candidate] = e.tick
+
+	// Start above the highest view the candidate can see
+	next := e.views[candidate] + 1
+	for _, id := range e.ids {
+		if e.connected(candidate, id) && e.views[id] >= next {
+			next = e.views[id] + 1
+		}
+	}
+
+	if e.sticky(candidate) {
+		if !e.connected(candidate, e.lastLeader) {
+			e.Stats.StickyWaits++
+			e.step(candidate, "sticky-wait")
+			return
+		}
+		next = e.nextViewLedBy(e.lastLeader, next)
+	}
+
+	if e.Config.PreVote {
+		e.step(candidate, "timeout-prevote")
+		if !e.preVote(candidate, next) {
+			e.Stats.PreVotesDenied++
+			e.step(candidate, "prevote-denied")
+			return
+		}
+		e.step(candidate, "prevote-granted")
+	} else {
+		e.step(candidate, "timeout")
+	}
+
+	joined := 0
+	for _, id := range e.ids {
+		if e.connected(candidate, id) {
+			e.views[id] = next
+			e.lastHeard[id] = e.tick
+			joined++
+		}
+	}
+
+	newLeader := e.LeaderForView(next)
+	if joined >= e.quorum() && e.connected(candidate, newLeader) {
+		if newLeader != candidate {
+			e.step(candidate, "view-established")
+		}
+		e.install(newLeader)
+		return
+	}
+	e.step(candidate, "election-failed")
+	if leader := e.System.GetLeader(); leader != "" && e.connected(candidate, leader) {
+		// The old leader saw the higher view and can no longer lead
+		e.System.SetLeader("")
+		e.step(leader, "higher-view")
+	}
+}
+
+// preVote asks reachable peers whether they would join view. Peers that
+// heard from a leader within the timeout, or are already past view, refuse.
+func (e *Election) preVote(candidate string, view int64) bool {
+	granted := 0
+	for _, id := range e.ids {
+		if !e.connected(candidate, id) {
+			continue
+		}
+		if id == candidate || (e.tick-e.lastHeard[id] >= e.Config.Timeout && e.views[id] < view) {
+			granted++
+		}
+	}
+	return granted >= e.quorum()
+}
+
+// RunRejoinScenario reproduces the disruptive-rejoin problem: in a five-node
+// cluster led by A, node E is partitioned for isolatedTicks and then healed.
+// The returned stats count the leader changes E's return caused.
+func RunRejoinScenario(config ElectionConfig, isolatedTicks int) (*ElectionStats, error) {
+	system := NewSystem()
+	for _, id := range []string{"A", "B", "C", "D", "E"} {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			return nil, err
+		}
+		system.AddNode(node)
+	}
+	system.SetLeader("A")
+	election := NewElection(system, config)
+
+	system.SetPartition("E", true)
+	for i := 0; i < isolatedTicks; i++ {
+		election.Tick()
+	}
+	system.SetPartition("E", false)
+	for i := 0; i < 2*config.Timeout; i++ {
+		election.Tick()
+	}
+	return &election.Stats, nil
+}
+
+// ChangesPerHour returns the leader change rate in wall-clock terms
+func (s *ElectionStats) ChangesPerHour() float64 {
+	elapsed := time.Duration(s.Ticks) * s.TickDuration
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.LeaderChanges) / elapsed.Hours()
+}
+
+// Results returns the leadership metrics for the results exporter
+func (s *ElectionStats) Results() map[string]float64 {
+	return map[string]float64{
+		"elections":               float64(s.Elections),
+		"leader_changes":          float64(s.LeaderChanges),
+		"leader_changes_per_hour": s.ChangesPerHour(),
+		"leader_flaps":            float64(s.Flaps),
+		"leaderless_ticks":        float64(s.LeaderlessTicks),
+	}
+}
+
+// RunTransientLeaderFaults partitions whoever leads a five-node cluster for
+// outageTicks every period ticks, blips times, and returns the stats
+func RunTransientLeaderFaults(config ElectionConfig, blips, period, outageTicks int) (*ElectionStats, error) {
+	system := NewSystem()
+	for _, id := range []string{"A", "B", "C", "D", "E"} {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			return nil, err
+		}
+		system.AddNode(node)
+	}
+	system.SetLeader("A")
+	election := NewElection(system, config)
+
+	for blip := 0; blip < blips; blip++ {
+		victim := system.GetLeader()
+		for tick := 0; tick < period; tick++ {
+			if victim != "" {
+				system.SetPartition(victim, tick < outageTicks)
+			}
+			election.Tick()
+		}
+	}
+	return &election.Stats, nil
+}
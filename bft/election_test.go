@@ -0,0 +1,106 @@
+package bft
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRejoinWithoutPreVoteDisruptsLeader reproduces the disruption pre-vote
+// prevents. Which node the forced election installs depends on how far E's
+// view ran ahead modulo the cluster size, and how long the cluster is
+// leaderless on where E's return falls within a timeout, so the test asserts
+// only that the return forces an election, for several isolation lengths.
+func TestRejoinWithoutPreVoteDisruptsLeader(t *testing.T) {
+	for isolated := 6; isolated <= 15; isolated++ {
+		stats, err := RunRejoinScenario(ElectionConfig{Timeout: 3}, isolated)
+		if err != nil {
+			t.Fatalf("Scenario failed: %v", err)
+		}
+		if stats.Elections == 0 {
+			t.Errorf("Isolated %d ticks: expected a rejoining node with a high view to force an election, got %+v", isolated, stats)
+		}
+	}
+}
+
+// TestRejoinWithPreVoteKeepsLeader tests that pre-vote stops the isolated node from disrupting the leader
+func TestRejoinWithPreVoteKeepsLeader(t *testing.T) {
+	for isolated := 6; isolated <= 15; isolated++ {
+		stats, err := RunRejoinScenario(ElectionConfig{Timeout: 3, PreVote: true}, isolated)
+		if err != nil {
+			t.Fatalf("Scenario failed: %v", err)
+		}
+		if stats.LeaderChanges != 0 || stats.Elections != 0 || stats.LeaderlessTicks != 0 {
+			t.Errorf("Isolated %d ticks: expected no leadership disruption with pre-vote, got %+v", isolated, stats)
+		}
+		if stats.PreVotesDenied == 0 {
+			t.Errorf("Isolated %d ticks: expected the isolated node's pre-votes to be denied", isolated)
+		}
+	}
+}
+
+// TestPreVoteStillElectsAfterLeaderFailure tests that pre-vote does not block a needed election
+func TestPreVoteStillElectsAfterLeaderFailure(t *testing.T) {
+	system := newTestSystem(t, nodeIDs(5))
+	system.SetLeader("A")
+	election := NewElection(system, ElectionConfig{Timeout: 3, PreVote: true})
+
+	election.Tick()
+	system.SetPartition("A", true)
+	for i := 0; i < 10; i++ {
+		election.Tick()
+	}
+
+	leader := system.GetLeader()
+	if leader == "" || leader == "A" {
+		t.Fatalf("Expected a new leader after A was partitioned, got %q", leader)
+	}
+	if election.LeaderForView(election.View(leader)) != leader {
+		t.Errorf("Expected leader %s to be the round-robin leader of its view", leader)
+	}
+}
+
+// TestLeaderStickinessDampsFlapping tests that a quickly recovering leader keeps its role
+func TestLeaderStickinessDampsFlapping(t *testing.T) {
+	base := ElectionConfig{Timeout: 3, PreVote: true, FlapWindow: 20}
+	flapping, err := RunTransientLeaderFaults(base, 5, 10, 4)
+	if err != nil {
+		t.Fatalf("Scenario failed: %v", err)
+	}
+	if flapping.LeaderChanges != 5 || flapping.Flaps == 0 {
+		t.Errorf("Expected every blip to move leadership, got %+v", flapping)
+	}
+
+	sticky := base
+	sticky.StickyWindow = 3
+	damped, err := RunTransientLeaderFaults(sticky, 5, 10, 4)
+	if err != nil {
+		t.Fatalf("Scenario failed: %v", err)
+	}
+	if damped.LeaderChanges != 0 || damped.Flaps != 0 {
+		t.Errorf("Expected stickiness to keep the leader through transient faults, got %+v", damped)
+	}
+	if damped.StickyWaits == 0 {
+		t.Errorf("Expected followers to wait for the previous leader")
+	}
+
+	// A leader that stays away longer than the window is still replaced
+	replaced, err := RunTransientLeaderFaults(sticky, 1, 20, 15)
+	if err != nil {
+		t.Fatalf("Scenario failed: %v", err)
+	}
+	if replaced.LeaderChanges != 1 {
+		t.Errorf("Expected a long outage to replace the leader, got %+v", replaced)
+	}
+}
+
+// TestElectionStatsResults tests the exported leadership metrics
+func TestElectionStatsResults(t *testing.T) {
+	stats := &ElectionStats{Ticks: 36000, TickDuration: 100 * time.Millisecond, LeaderChanges: 2, Flaps: 1}
+	results := stats.Results()
+	if results["leader_changes_per_hour"] != 2 {
+		t.Errorf("Expected 2 changes per hour, got %v", results["leader_changes_per_hour"])
+	}
+	if results["leader_flaps"] != 1 {
+		t.Errorf("Expected 1 flap, got %v", results["leader_flaps"])
+	}
+}
@@ -0,0 +1,402 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Consensus engines per namespace.
+//
+// A system commits writes through its leader: the leader signs, gathers a
+// heartbeat quorum and replicates, see SubmitWrite. A namespace can order
+// its writes with another consensus engine instead, while sharing
+// everything else with the rest of the system: the nodes and their
+// membership, the simulated network with its latencies and partitions, the
+// scheduler and the faults injected into them. Two namespaces on different
+// engines therefore see the very same fault schedule, which makes their
+// latencies and availability directly comparable. Engines are registered by
+// name like faults, with RegisterEngine; leader, pbft, raft and hotstuff are
+// built in. A namespace switches engines with UseEngine at any point of a
+// run, and the writes that follow are ordered by the new one. Batches and
+// degraded writes always go through the leader.
+//
+// An engine numbers the entries of its namespace itself, so they are kept
+// out of the leader's index space: nodes apply them with
+// Store.ApplyNamespace, which tracks a commit index per namespace and
+// leaves the one staleness, read indexes and the leader's next write go by
+// alone. An engine taking over a namespace continues from the highest index
+// the namespace reached on any node.
+
+var (
+	ErrUnknownEngine    = errors.New("unknown consensus engine")
+	ErrEngineRegistered = errors.New("consensus engine already registered")
+)
+
+// Built-in consensus engines
+const (
+	EngineLeader   = "leader"   // Signed by the leader after a heartbeat quorum, the default
+	EnginePBFT     = "pbft"     // Three-phase PBFT among the voters, see pbft.go
+	EngineRaft     = "raft"     // Raft among the voters, see raft.go
+	EngineHotStuff = "hotstuff" // Chained HotStuff among the voters, see hotstuff.go
+)
+
+// ConsensusEngine orders the writes of the namespaces assigned to it on the
+// system it was built for
+type ConsensusEngine interface {
+	Name() string
+	// Write commits key=value for a client in clientRegion that contacted
+	// nodeID and applies it on the nodes. The caller holds no system lock.
+	Write(clientRegion, nodeID, key, value string) (*WriteResult, error)
+}
+
+// EngineFactory builds an engine for a system
+type EngineFactory func(system *System) ConsensusEngine
+
+var (
+	engineLock      sync.RWMutex
+	engineFactories = map[string]EngineFactory{}
+)
+
+// RegisterEngine makes a consensus engine available to namespaces
+func RegisterEngine(name string, factory EngineFactory) error {
+	engineLock.Lock()
+	defer engineLock.Unlock()
+	if _, exists := engineFactories[name]; exists {
+		return fmt.Errorf("%w: %s", ErrEngineRegistered, name)
+	}
+	engineFactories[name] = factory
+	return nil
+}
+
+// EngineNames returns the registered engines in sorted order
+func EngineNames() []string {
+	engineLock.RLock()
+	defer engineLock.RUnlock()
+	return sortedKeys(engineFactories)
+}
+
+// NewEngine builds the named engine for system
+func NewEngine(name string, system *System) (ConsensusEngine, error) {
+	engineLock.RLock()
+	factory, exists := engineFactories[name]
+	engineLock.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEngine, name)
+	}
+	return factory(system), nil
+}
+
+func init() {
+	RegisterEngine(EngineLeader, func(system *System) ConsensusEngine { return leaderEngine{system} })
+	RegisterEngine(EnginePBFT, func(system *System) ConsensusEngine { return &pbftEngine{system: system} })
+	RegisterEngine(EngineRaft, func(system *System) ConsensusEngine { return &raftEngine{system: system} })
+	RegisterEngine(EngineHotStuff, func(system *System) ConsensusEngine { return &hotstuffEngine{system: system} })
+}
+
+// UseEngine orders the writes of a namespace with the named engine from now
+// on. The leader engine is the default and needs no entry.
+func (s *System) UseEngine(namespace, name string) error {
+	engine, err := NewEngine(name, s)
+	if err != nil {
+		return err
+	}
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if name == EngineLeader {
+		delete(s.Engines, namespace)
+		return nil
+	}
+	if s.Engines == nil {
+		s.Engines = make(map[string]ConsensusEngine)
+	}
+	s.Engines[namespace] = engine
+	return nil
+}
+
+// EngineFor returns the name of the engine ordering a key's writes
+func (s *System) EngineFor(key string) string {
+	if engine := s.engine(key); engine != nil {
+		return engine.Name()
+	}
+	return EngineLeader
+}
+
+// engine returns the engine assigned to a key's namespace, nil for the
+// leader
+func (s *System) engine(key string) ConsensusEngine {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	return s.Engines[Namespace(key)]
+}
+
+// leaderEngine commits through the system's leader
+type leaderEngine struct {
+	system *System
+}
+
+func (e leaderEngine) Name() string {
+	return EngineLeader
+}
+
+func (e leaderEngine) Write(clientRegion, nodeID, key, value string) (*WriteResult, error) {
+	return e.system.leaderWrite(clientRegion, nodeID, key, value)
+}
+
+// pbftEngine orders writes with PBFT among the voters of its first write.
+// Its replicas apply the entries they execute to their node's store, and its
+// view changes leave the system's leader alone.
+type pbftEngine struct {
+	system   *System
+	pbft     *PBFT
+	base     int64 // Namespace index its sequence numbers continue from
+	proposed int64 // Writes proposed, which keeps identical writes apart
+	Lock     sync.Mutex
+}
+
+func (e *pbftEngine) Name() string {
+	return EnginePBFT
+}
+
+func (e *pbftEngine) Write(clientRegion, nodeID, key, value string) (*WriteResult, error) {
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+	s := e.system
+	if e.pbft == nil {
+		pbft, err := NewPBFT(s, -1)
+		if err != nil {
+			return nil, err
+		}
+		pbft.Detached = true
+		e.base = s.namespaceIndex(Namespace(key))
+		for _, replica := range pbft.Replicas {
+			replica.Execute = applyEntry(replica.Node, e.base)
+		}
+		e.pbft = pbft
+	}
+
+	contact, clientLatency, err := s.engineContact(clientRegion, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	e.proposed++
+	payload, err := s.enginePayload(e.proposed, key, value)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := e.pbft.Submit(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.pbft.Run(); err != nil {
+		return nil, err
+	}
+	outcome := e.pbft.Outcome(digest)
+	if !outcome.Committed {
+		return nil, fmt.Errorf("%w: %s executed by %v only", ErrNoQuorum, key, outcome.Executed)
+	}
+
+	primary := e.pbft.Primary().Node
+	index := e.base + int64(outcome.Seq)
+	timing := NewOpTiming(fmt.Sprintf("w%d", index), "client@"+clientRegion)
+	timing.Stamp(contact.ID, "received", clientLatency)
+	timing.Stamp(primary.ID, "committed", outcome.Latency)
+	timing.Stamp(timing.Client, "replied", clientLatency)
+	return &WriteResult{
+		Index:         index,
+		Leader:        primary.ID,
+		Forwarded:     contact.ID != primary.ID,
+		ClientLatency: 2 * clientLatency,
+		Timing:        timing,
+		Total:         timing.Total(),
+	}, nil
+}
+
+// engineContact returns the node a client in clientRegion contacted and its
+// latency to the client, if it can take the write
+func (s *System) engineContact(clientRegion, nodeID string) (*Node, time.Duration, error) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	contact, exists := s.Nodes[nodeID]
+	if !exists {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnknownNode, nodeID)
+	}
+	if !s.reachable(contact) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNodeUnreachable, nodeID)
+	}
+	return contact, s.regionLatency(clientRegion, contact.Region), nil
+}
+
+// enginePayload returns the sealed entry an engine orders for its nth write
+// of key=value, the index keeping identical writes apart
+func (s *System) enginePayload(n int64, key, value string) ([]byte, error) {
+	entry, err := s.Payloads.seal(Entry{Index: n, Key: key, Value: value})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(entry)
+}
+
+// raftEngine orders writes with Raft among the voters of its first write.
+// Its nodes apply the entries they commit to their node's store.
+type raftEngine struct {
+	system   *System
+	raft     *Raft
+	base     int64 // Namespace index its log indexes continue from
+	proposed int64 // Writes proposed, which keeps identical writes apart
+	Lock     sync.Mutex
+}
+
+func (e *raftEngine) Name() string {
+	return EngineRaft
+}
+
+func (e *raftEngine) Write(clientRegion, nodeID, key, value string) (*WriteResult, error) {
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+	s := e.system
+	if e.raft == nil {
+		raft, err := NewRaft(s)
+		if err != nil {
+			return nil, err
+		}
+		e.base = s.namespaceIndex(Namespace(key))
+		for _, node := range raft.Nodes {
+			node.Execute = applyEntry(node.Node, e.base)
+		}
+		e.raft = raft
+	}
+
+	contact, clientLatency, err := s.engineContact(clientRegion, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	e.proposed++
+	payload, err := s.enginePayload(e.proposed, key, value)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := e.raft.Submit(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.raft.Run(); err != nil {
+		return nil, err
+	}
+	outcome := e.raft.Outcome(digest)
+	if !outcome.Committed {
+		return nil, fmt.Errorf("%w: %s applied nowhere", ErrNoQuorum, key)
+	}
+
+	leader := e.raft.Leader
+	index := e.base + int64(outcome.Index)
+	timing := NewOpTiming(fmt.Sprintf("w%d", index), "client@"+clientRegion)
+	timing.Stamp(contact.ID, "received", clientLatency)
+	timing.Stamp(leader, "committed", outcome.Latency)
+	timing.Stamp(timing.Client, "replied", clientLatency)
+	return &WriteResult{
+		Index:         index,
+		Leader:        leader,
+		Forwarded:     contact.ID != leader,
+		ClientLatency: 2 * clientLatency,
+		Timing:        timing,
+		Total:         timing.Total(),
+	}, nil
+}
+
+// hotstuffEngine orders writes with HotStuff among the voters of its first
+// write. Its replicas apply the entries they execute to their node's store.
+type hotstuffEngine struct {
+	system   *System
+	hotstuff *HotStuff
+	base     int64 // Namespace index its sequence numbers continue from
+	proposed int64 // Writes proposed, which keeps identical writes apart
+	Lock     sync.Mutex
+}
+
+func (e *hotstuffEngine) Name() string {
+	return EngineHotStuff
+}
+
+func (e *hotstuffEngine) Write(clientRegion, nodeID, key, value string) (*WriteResult, error) {
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+	s := e.system
+	if e.hotstuff == nil {
+		hotstuff, err := NewHotStuff(s, -1)
+		if err != nil {
+			return nil, err
+		}
+		e.base = s.namespaceIndex(Namespace(key))
+		for _, replica := range hotstuff.Replicas {
+			replica.Execute = applyEntry(replica.Node, e.base)
+		}
+		e.hotstuff = hotstuff
+	}
+
+	contact, clientLatency, err := s.engineContact(clientRegion, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	e.proposed++
+	payload, err := s.enginePayload(e.proposed, key, value)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := e.hotstuff.Submit(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.hotstuff.Run(); err != nil {
+		return nil, err
+	}
+	outcome := e.hotstuff.Outcome(digest)
+	if !outcome.Committed {
+		return nil, fmt.Errorf("%w: %s executed by %v only", ErrNoQuorum, key, outcome.Executed)
+	}
+
+	index := e.base + int64(outcome.Seq)
+	timing := NewOpTiming(fmt.Sprintf("w%d", index), "client@"+clientRegion)
+	timing.Stamp(contact.ID, "received", clientLatency)
+	timing.Stamp(outcome.Leader, "committed", outcome.Latency)
+	timing.Stamp(timing.Client, "replied", clientLatency)
+	return &WriteResult{
+		Index:         index,
+		Leader:        outcome.Leader,
+		Forwarded:     contact.ID != outcome.Leader,
+		ClientLatency: 2 * clientLatency,
+		Timing:        timing,
+		Total:         timing.Total(),
+	}, nil
+}
+
+// namespaceIndex returns the highest index a namespace reached on any node
+func (s *System) namespaceIndex(namespace string) int64 {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	var index int64
+	for _, node := range s.Nodes {
+		node.Lock.RLock()
+		index = max(index, node.Store.Namespaces[namespace])
+		node.Lock.RUnlock()
+	}
+	return index
+}
+
+// applyEntry returns an Execute hook applying committed entries to node's
+// store in their namespace's index space, at base plus their sequence
+// number. Other payloads are skipped.
+func applyEntry(node *Node, base int64) func(seq uint64, payload []byte) {
+	return func(seq uint64, payload []byte) {
+		var entry Entry
+		if json.Unmarshal(payload, &entry) != nil || entry.Key == "" {
+			return
+		}
+		entry.Index = base + int64(seq)
+		node.Lock.Lock()
+		defer node.Lock.Unlock()
+		node.Store.ApplyNamespace(entry)
+	}
+}
@@ -0,0 +1,121 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestEnginePerNamespace tests that two namespaces commit through different engines under the same crash
+func TestEnginePerNamespace(t *testing.T) {
+	system := newGeoSystem(t)
+	system.UseScheduler(NewScheduler(1))
+	if err := system.UseEngine("ledger", "raft-ish"); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("Expected an unknown engine to be refused, got %v", err)
+	}
+	if err := system.UseEngine("ledger", EnginePBFT); err != nil {
+		t.Fatal(err)
+	}
+	if system.EngineFor("ledger/a") != EnginePBFT || system.EngineFor("x") != EngineLeader {
+		t.Errorf("Expected ledger on PBFT and the rest on the leader")
+	}
+
+	result, err := system.SubmitWrite("us-east", "B", "ledger/a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Leader != "A" || !result.Forwarded || result.Total <= result.ClientLatency {
+		t.Errorf("Expected the PBFT primary A to order the write from B, got %+v", result)
+	}
+	for id, node := range system.Nodes {
+		if node.Store.Entries["ledger/a"].Value != "1" {
+			t.Errorf("Expected %s to execute ledger/a", id)
+		}
+	}
+
+	// Crash the leader, which is also the PBFT primary
+	if err := system.ApplyFault(FaultStep{Kind: FaultCrash, Nodes: []string{"A"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := system.SubmitWrite("us-east", "B", "x", "2"); err == nil {
+		t.Error("Expected the leader engine to fail without its leader")
+	}
+	result, err = system.SubmitWrite("us-east", "B", "ledger/b", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Leader == "A" || system.GetLeader() != "A" {
+		t.Errorf("Expected PBFT to change its primary alone, got %s with system leader %s", result.Leader, system.GetLeader())
+	}
+
+	// Swap the namespace back to the leader
+	clone := system.Clone()
+	if clone.EngineFor("ledger/a") != EnginePBFT {
+		t.Errorf("Expected the clone to keep the namespace's engine")
+	}
+	if err := system.UseEngine("ledger", EngineLeader); err != nil || system.EngineFor("ledger/a") != EngineLeader {
+		t.Errorf("Expected ledger back on the leader, got %v", err)
+	}
+}
+
+// TestRegisterEngine tests that engine names are unique and listed
+func TestRegisterEngine(t *testing.T) {
+	if err := RegisterEngine(EnginePBFT, nil); !errors.Is(err, ErrEngineRegistered) {
+		t.Errorf("Expected duplicate registration to fail, got %v", err)
+	}
+	names := EngineNames()
+	if len(names) < 2 || !containsID(names, EngineLeader) || !containsID(names, EnginePBFT) {
+		t.Errorf("Expected the built-in engines, got %v", names)
+	}
+}
+
+// TestScenarioEngines tests that a scenario assigns engines to namespaces
+func TestScenarioEngines(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Engines = map[string]string{"ledger": "paxos"}
+	if err := scenario.Validate(); !errors.Is(err, ErrInvalidScenario) {
+		t.Errorf("Expected an unknown engine to invalidate the scenario, got %v", err)
+	}
+	scenario.Engines["ledger"] = EnginePBFT
+	system := NewSystem()
+	if err := scenario.Build(system, 1); err != nil {
+		t.Fatal(err)
+	}
+	if system.EngineFor("ledger/a") != EnginePBFT {
+		t.Errorf("Expected ledger on PBFT")
+	}
+}
+
+// TestEngineIndexSpace tests that a namespace's engine numbers its entries
+// apart from the leader, leaving the commit index to the leader's writes,
+// and that an engine taking the namespace over continues its numbering
+func TestEngineIndexSpace(t *testing.T) {
+	system := newGeoSystem(t)
+	system.UseScheduler(NewScheduler(1))
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := system.UseEngine("ledger", EngineRaft); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"ledger/a", "ledger/b"} {
+		if _, err := system.SubmitWrite("us-east", "A", key, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id, node := range system.Nodes {
+		if node.Store.CommitIndex != 1 || node.Store.Namespaces["ledger"] != 2 || node.Store.Entries["ledger/b"].Index != 2 {
+			t.Errorf("Expected %s at commit index 1 with ledger at 2, got %d and %v", id, node.Store.CommitIndex, node.Store.Namespaces)
+		}
+	}
+	result, err := system.SubmitWrite("us-east", "A", "y", "1")
+	if err != nil || result.Index != 2 {
+		t.Fatalf("Expected the leader's next write at index 2, got %+v, %v", result, err)
+	}
+
+	if err := system.UseEngine("ledger", EnginePBFT); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := system.SubmitWrite("us-east", "A", "ledger/c", "1"); err != nil || result.Index != 3 {
+		t.Errorf("Expected PBFT to continue the ledger at index 3, got %+v, %v", result, err)
+	}
+}
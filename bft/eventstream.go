@@ -0,0 +1,341 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Live event streaming.
+//
+// A system with an EventStream publishes every trace event to it as it
+// happens, stamped with the view the system is in. Consumers subscribe
+// with an EventFilter, by node, event type, view range and least severity,
+// and filtering happens before events are queued, so a consumer watching
+// one node of a large simulation is never sent the rest. The stream's own
+// filter, set by the operator through the admin API or the dashboard,
+// applies to every subscriber on top of its own. The stream remembers its
+// most recent events, so a subscriber joining late, or after a filter
+// change, starts with the ones it would have seen. A subscriber that falls
+// behind loses events, counted, rather than stalling the simulation. Like
+// the logger, the stream is not copied into clones.
+
+var ErrInvalidFilter = errors.New("invalid event filter")
+
+// DefaultEventStream is attached to new systems; nil streams nothing
+var DefaultEventStream *EventStream
+
+const (
+	// DefaultSubscriberBuffer is how many events a subscriber may fall behind
+	DefaultSubscriberBuffer = 256
+	// DefaultEventBacklog is how many recent events a stream remembers
+	DefaultEventBacklog = 1024
+)
+
+// EventFilter selects trace events. The zero value selects every event.
+type EventFilter struct {
+	Nodes    []string    `json:"nodes,omitempty"`    // Events at or from these nodes
+	Types    []EventType `json:"types,omitempty"`    // Events of these types
+	MinView  *int64      `json:"min_view,omitempty"` // First view, no bound if nil
+	MaxView  *int64      `json:"max_view,omitempty"` // Last view, no bound if nil
+	Severity *slog.Level `json:"severity,omitempty"` // Least severity, as the event would be logged at
+}
+
+// Match reports whether the filter selects an event
+func (f *EventFilter) Match(event TraceEvent) bool {
+	if len(f.Nodes) > 0 && !containsString(f.Nodes, event.Node) && !containsString(f.Nodes, event.Peer) {
+		return false
+	}
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			found = found || t == event.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.MinView != nil && event.View < *f.MinView || f.MaxView != nil && event.View > *f.MaxView {
+		return false
+	}
+	return f.Severity == nil || traceLevel(event.Type) >= *f.Severity
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseEventFilter reads a filter from query parameters: nodes and types as
+// comma-separated lists, min_view and max_view, and severity as debug,
+// info, warn or error
+func ParseEventFilter(query url.Values) (EventFilter, error) {
+	var f EventFilter
+	if nodes := query.Get("nodes"); nodes != "" {
+		f.Nodes = strings.Split(nodes, ",")
+	}
+	if types := query.Get("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			f.Types = append(f.Types, EventType(t))
+		}
+	}
+	for name, view := range map[string]**int64{"min_view": &f.MinView, "max_view": &f.MaxView} {
+		if value := query.Get(name); value != "" {
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return f, fmt.Errorf("%w: %s must be an integer", ErrInvalidFilter, name)
+			}
+			*view = &v
+		}
+	}
+	if severity := query.Get("severity"); severity != "" {
+		level, err := ParseLogLevel(severity)
+		if err != nil {
+			return f, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+		}
+		f.Severity = &level
+	}
+	return f, nil
+}
+
+// EventStream fans trace events out to subscribers
+type EventStream struct {
+	Buffer      int // Events a new subscriber may fall behind, DefaultSubscriberBuffer if zero
+	Backlog     int // Recent events replayed to new subscribers
+	Lock        sync.Mutex
+	filter      EventFilter
+	subscribers map[*Subscription]bool
+	recent      []TraceEvent
+}
+
+// NewEventStream creates a stream without subscribers or filter
+func NewEventStream() *EventStream {
+	return &EventStream{Backlog: DefaultEventBacklog, subscribers: make(map[*Subscription]bool)}
+}
+
+// Subscription receives the events of a stream its filter selects
+type Subscription struct {
+	Events  <-chan TraceEvent
+	Filter  EventFilter
+	stream  *EventStream
+	events  chan TraceEvent
+	dropped uint64
+}
+
+// Filter returns the filter applied to every subscriber
+func (s *EventStream) Filter() EventFilter {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	return s.filter
+}
+
+// SetFilter sets the filter applied to every subscriber
+func (s *EventStream) SetFilter(f EventFilter) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.filter = f
+}
+
+// Subscribe starts delivering the events both the stream's filter and f
+// select, beginning with the recent ones
+func (s *EventStream) Subscribe(f EventFilter) *Subscription {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	buffer := s.Buffer
+	if buffer <= 0 {
+		buffer = DefaultSubscriberBuffer
+	}
+	events := make(chan TraceEvent, buffer)
+	sub := &Subscription{Events: events, Filter: f, stream: s, events: events}
+	if s.subscribers == nil {
+		s.subscribers = make(map[*Subscription]bool)
+	}
+	s.subscribers[sub] = true
+	for _, event := range s.recent {
+		s.deliver(sub, event)
+	}
+	return sub
+}
+
+// Dropped returns the events lost because the subscriber fell behind
+func (sub *Subscription) Dropped() uint64 {
+	sub.stream.Lock.Lock()
+	defer sub.stream.Lock.Unlock()
+	return sub.dropped
+}
+
+// Close stops the subscription and closes its channel
+func (sub *Subscription) Close() {
+	s := sub.stream
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.subscribers[sub] {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// publish queues an event for every subscriber selecting it. A nil stream
+// publishes nothing.
+func (s *EventStream) publish(event TraceEvent) {
+	if s == nil {
+		return
+	}
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.Backlog > 0 {
+		if len(s.recent) >= s.Backlog {
+			s.recent = append(s.recent[:0], s.recent[len(s.recent)-s.Backlog+1:]...)
+		}
+		s.recent = append(s.recent, event)
+	}
+	for sub := range s.subscribers {
+		s.deliver(sub, event)
+	}
+}
+
+// deliver queues an event for a subscriber if both filters select it. The
+// caller must hold s.Lock.
+func (s *EventStream) deliver(sub *Subscription, event TraceEvent) {
+	if !s.filter.Match(event) || !sub.Filter.Match(event) {
+		return
+	}
+	select {
+	case sub.events <- event:
+	default:
+		sub.dropped++
+	}
+}
+
+// Handler serves the stream. GET /events streams the selected events as
+// server-sent events, filtered further by the query parameters of
+// ParseEventFilter; GET /filter returns the stream's filter and POST
+// /filter replaces it with the one in the body; GET /dashboard serves a
+// page showing the stream with a form for the filter.
+func (s *EventStream) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		filter, err := ParseEventFilter(req.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		sub := s.Subscribe(filter)
+		defer sub.Close()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case event := <-sub.Events:
+				data, _ := json.Marshal(event)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				flusher.Flush()
+			}
+		}
+	})
+	mux.HandleFunc("/filter", func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, s.Filter())
+		case http.MethodPost:
+			var filter EventFilter
+			if err := json.NewDecoder(req.Body).Decode(&filter); err != nil {
+				http.Error(w, fmt.Sprintf("%v: %v", ErrInvalidFilter, err), http.StatusBadRequest)
+				return
+			}
+			s.SetFilter(filter)
+			writeJSON(w, http.StatusOK, filter)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/dashboard", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, dashboardPage)
+	})
+	return mux
+}
+
+// dashboardPage shows the event stream and edits the stream's filter
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>wahello events</title>
+<style>
+body { font-family: monospace; margin: 1em; }
+form input { width: 8em; }
+#events { list-style: none; padding: 0; }
+.warning, .reject, .detection { color: #b60; }
+.violation, .fenced { color: #c00; }
+</style>
+</head>
+<body>
+<form id="filter">
+nodes <input name="nodes" placeholder="A,B">
+types <input name="types" placeholder="send,apply">
+views <input name="min_view" placeholder="from"> - <input name="max_view" placeholder="to">
+severity <select name="severity"><option value="">any</option><option>debug</option><option>info</option><option>warn</option><option>error</option></select>
+<button>Apply</button> <span id="status"></span>
+</form>
+<ul id="events"></ul>
+<script>
+const form = document.getElementById("filter");
+const list = (s) => s ? s.split(",").map((v) => v.trim()).filter((v) => v) : undefined;
+const view = (s) => s === "" ? undefined : Number(s);
+fetch("filter").then((r) => r.json()).then((f) => {
+  form.nodes.value = (f.nodes || []).join(",");
+  form.types.value = (f.types || []).join(",");
+  form.min_view.value = f.min_view ?? "";
+  form.max_view.value = f.max_view ?? "";
+  form.severity.value = (f.severity || "").toLowerCase();
+});
+form.addEventListener("submit", (e) => {
+  e.preventDefault();
+  const filter = {
+    nodes: list(form.nodes.value),
+    types: list(form.types.value),
+    min_view: view(form.min_view.value),
+    max_view: view(form.max_view.value),
+    severity: form.severity.value || undefined,
+  };
+  fetch("filter", { method: "POST", body: JSON.stringify(filter) })
+    .then((r) => r.ok ? "applied" : r.text())
+    .then((s) => { document.getElementById("status").textContent = s; });
+});
+const events = document.getElementById("events");
+new EventSource("events").onmessage = (m) => {
+  const e = JSON.parse(m.data);
+  const item = document.createElement("li");
+  item.className = e.type;
+  item.textContent = [e.seq, "view " + (e.view || 0), e.type, e.node, e.peer || "", e.detail || ""].join(" ");
+  events.prepend(item);
+  while (events.children.length > 500) events.lastChild.remove();
+};
+</script>
+</body>
+</html>
+`
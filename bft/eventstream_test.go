@@ -0,0 +1,158 @@
+package bft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestEventFilterMatch tests each dimension of a filter
+func TestEventFilterMatch(t *testing.T) {
+	one, two := int64(1), int64(2)
+	warn := slog.LevelWarn
+	send := TraceEvent{Type: EventSend, Node: "A", Peer: "B", View: 1}
+	detection := TraceEvent{Type: EventDetection, Node: "C", Peer: "A", View: 3}
+	tests := []struct {
+		name     string
+		filter   EventFilter
+		expected []bool // Whether send and detection match
+	}{
+		{"everything", EventFilter{}, []bool{true, true}},
+		{"node as peer", EventFilter{Nodes: []string{"B"}}, []bool{true, false}},
+		{"node either side", EventFilter{Nodes: []string{"A"}}, []bool{true, true}},
+		{"types", EventFilter{Types: []EventType{EventApply, EventDetection}}, []bool{false, true}},
+		{"view range", EventFilter{MinView: &one, MaxView: &two}, []bool{true, false}},
+		{"open view range", EventFilter{MinView: &two}, []bool{false, true}},
+		{"severity", EventFilter{Severity: &warn}, []bool{false, true}},
+	}
+	for _, test := range tests {
+		got := []bool{test.filter.Match(send), test.filter.Match(detection)}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+// TestParseEventFilter tests that query parameters become a filter and bad values are rejected
+func TestParseEventFilter(t *testing.T) {
+	query, _ := url.ParseQuery("nodes=A,B&types=send,apply&min_view=2&max_view=4&severity=warn")
+	f, err := ParseEventFilter(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f.Nodes, []string{"A", "B"}) || !reflect.DeepEqual(f.Types, []EventType{EventSend, EventApply}) ||
+		*f.MinView != 2 || *f.MaxView != 4 || *f.Severity != slog.LevelWarn {
+		t.Errorf("Unexpected filter %+v", f)
+	}
+	for _, bad := range []string{"min_view=x", "max_view=1.5", "severity=loud"} {
+		query, _ := url.ParseQuery(bad)
+		if _, err := ParseEventFilter(query); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%s: expected ErrInvalidFilter, got %v", bad, err)
+		}
+	}
+}
+
+// TestEventStreamFilters tests that subscribers only receive events both filters select, stamped with the view
+func TestEventStreamFilters(t *testing.T) {
+	system := newNamedSystem(t)
+	system.Events = NewEventStream()
+	warn := slog.LevelWarn
+	system.Events.SetFilter(EventFilter{Severity: &warn})
+	sub := system.Events.Subscribe(EventFilter{Nodes: []string{"B"}})
+	defer sub.Close()
+
+	system.View = 5
+	system.trace(TraceEvent{Type: EventReject, Node: "B", Peer: "A"})
+	system.trace(TraceEvent{Type: EventApply, Node: "B", Peer: "A"})
+	system.trace(TraceEvent{Type: EventDetection, Node: "C", Peer: "D"})
+	system.trace(TraceEvent{Type: EventDetection, Node: "A", Peer: "B"})
+	var got []EventType
+	for len(sub.Events) > 0 {
+		event := <-sub.Events
+		if event.View != 5 {
+			t.Errorf("Expected events stamped with view 5, got %d", event.View)
+		}
+		got = append(got, event.Type)
+	}
+	if expected := []EventType{EventReject, EventDetection}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+// TestEventStreamBacklogAndDrops tests that late subscribers get recent events and slow ones lose the rest
+func TestEventStreamBacklogAndDrops(t *testing.T) {
+	stream := NewEventStream()
+	stream.Backlog, stream.Buffer = 3, 2
+	for i := 0; i < 5; i++ {
+		stream.publish(TraceEvent{Seq: uint64(i), Type: EventSend})
+	}
+	sub := stream.Subscribe(EventFilter{})
+	defer sub.Close()
+	if first := <-sub.Events; first.Seq != 2 {
+		t.Errorf("Expected the backlog to start at event 2, got %d", first.Seq)
+	}
+	if sub.Dropped() != 1 {
+		t.Errorf("Expected one backlog event dropped for lack of room, got %d", sub.Dropped())
+	}
+	var nilStream *EventStream
+	nilStream.publish(TraceEvent{Type: EventSend})
+}
+
+// TestEventStreamHandler tests the filter admin API and the filtered event stream
+func TestEventStreamHandler(t *testing.T) {
+	stream := NewEventStream()
+	server := httptest.NewServer(stream.Handler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/filter", "application/json", strings.NewReader(`{"types":["send","detection"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !reflect.DeepEqual(stream.Filter().Types, []EventType{EventSend, EventDetection}) {
+		t.Fatalf("Expected the filter to be set, got %d and %+v", resp.StatusCode, stream.Filter())
+	}
+	resp, _ = http.Post(server.URL+"/filter", "application/json", strings.NewReader(`{"severity":"loud"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a bad severity to be rejected, got %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(server.URL + "/events?min_view=x")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a bad view to be rejected, got %d", resp.StatusCode)
+	}
+
+	stream.publish(TraceEvent{Seq: 1, Type: EventApply, Node: "A"})
+	stream.publish(TraceEvent{Seq: 2, Type: EventSend, Node: "B"})
+	stream.publish(TraceEvent{Seq: 3, Type: EventSend, Node: "A"})
+	resp, err = http.Get(server.URL + "/events?nodes=A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected server-sent events, got %q", resp.Header.Get("Content-Type"))
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event TraceEvent
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil || event.Seq != 3 {
+		t.Errorf("Expected event 3 first, got %q", line)
+	}
+
+	resp, _ = http.Get(server.URL + "/dashboard")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("Expected the dashboard page, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
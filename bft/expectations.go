@@ -0,0 +1,217 @@
+package bft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Expected outcomes.
+//
+// A scenario can come with a spec of what a run of it must show: which of
+// the client writes commit and which abort, how many times leadership may
+// change, how many safety violations are tolerated, which report verdicts
+// pass and the range each headline result must fall in. The spec sits next
+// to its scenario as <scenario>.expect.yaml, or .json, in the same format
+// as scenarios, and the runner diffs the run report against it, see
+// RunReport.Expect. Every expectation the run misses is reported as an
+// ExpectationMismatch with what was expected and what happened, so a
+// regression in a bundled scenario names the outcome that changed.
+
+var (
+	ErrInvalidExpectations = errors.New("invalid expectations")
+	ErrExpectationsUnmet   = errors.New("run did not meet its expectations")
+)
+
+// Expectations are the outcomes a run of a scenario must show. Absent
+// fields are not checked.
+type Expectations struct {
+	Writes              map[string]string      `json:"writes,omitempty"` // Write, W1 to W3, to committed or aborted
+	MaxLeaderChanges    *int                   `json:"max_leader_changes,omitempty"`
+	MaxSafetyViolations *int                   `json:"max_safety_violations,omitempty"`
+	Verdicts            map[string]string      `json:"verdicts,omitempty"` // Check to pass or fail
+	Results             map[string]ResultRange `json:"results,omitempty"`
+}
+
+// ResultRange bounds a result, inclusively, on the sides that are set
+type ResultRange struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// String renders the range like "≥ 1", "≤ 2" or "1 to 2"
+func (r ResultRange) String() string {
+	switch {
+	case r.Min != nil && r.Max != nil && *r.Min == *r.Max:
+		return formatResult(*r.Min)
+	case r.Min != nil && r.Max != nil:
+		return formatResult(*r.Min) + " to " + formatResult(*r.Max)
+	case r.Min != nil:
+		return "≥ " + formatResult(*r.Min)
+	}
+	return "≤ " + formatResult(*r.Max)
+}
+
+// contains reports whether value is within the range
+func (r ResultRange) contains(value float64) bool {
+	return (r.Min == nil || value >= *r.Min) && (r.Max == nil || value <= *r.Max)
+}
+
+// formatResult renders a result without a trailing fraction
+func formatResult(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// ExpectationMismatch is an expectation a run missed
+type ExpectationMismatch struct {
+	Expectation string `json:"expectation"` // e.g. "write W2" or "result raft_healed_executed"
+	Expected    string `json:"expected"`
+	Actual      string `json:"actual"`
+}
+
+func (m ExpectationMismatch) String() string {
+	return fmt.Sprintf("%s: expected %s, got %s", m.Expectation, m.Expected, m.Actual)
+}
+
+// LoadExpectations reads and validates an expectations file, YAML if it
+// ends in .yaml or .yml and JSON otherwise. Unknown fields are refused, so a
+// misspelt expectation cannot go unchecked.
+func LoadExpectations(path string) (*Expectations, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// Go through JSON so both formats share the field names
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", path, ErrInvalidExpectations, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", path, ErrInvalidExpectations, err)
+		}
+	}
+	e := &Expectations{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(e); err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", path, ErrInvalidExpectations, err)
+	}
+	if err := e.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+// ExpectationsFor loads the expectations next to a scenario file, the
+// scenario's name with .expect before its extension. A scenario without
+// them has nil expectations.
+func ExpectationsFor(scenarioPath string) (*Expectations, error) {
+	ext := filepath.Ext(scenarioPath)
+	path := strings.TrimSuffix(scenarioPath, ext) + ".expect" + ext
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return LoadExpectations(path)
+}
+
+// Validate checks the expectations and reports the first problem
+func (e *Expectations) Validate() error {
+	for _, write := range sortedKeys(e.Writes) {
+		if outcome := e.Writes[write]; outcome != WriteCommitted && outcome != WriteAborted {
+			return fmt.Errorf("%w: write %s expected %q, want %q or %q", ErrInvalidExpectations, write, outcome, WriteCommitted, WriteAborted)
+		}
+	}
+	if e.MaxLeaderChanges != nil && *e.MaxLeaderChanges < 0 || e.MaxSafetyViolations != nil && *e.MaxSafetyViolations < 0 {
+		return fmt.Errorf("%w: negative maximum", ErrInvalidExpectations)
+	}
+	for _, check := range sortedKeys(e.Verdicts) {
+		if verdict := e.Verdicts[check]; verdict != "pass" && verdict != "fail" {
+			return fmt.Errorf("%w: verdict %s expected %q, want \"pass\" or \"fail\"", ErrInvalidExpectations, check, verdict)
+		}
+	}
+	for _, result := range sortedKeys(e.Results) {
+		r := e.Results[result]
+		if r.Min == nil && r.Max == nil || r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return fmt.Errorf("%w: result %s has an empty or no range", ErrInvalidExpectations, result)
+		}
+	}
+	return nil
+}
+
+// Diff returns the expectations a run report misses, writes first, then
+// leader changes, safety violations, verdicts and results, each in name
+// order
+func (e *Expectations) Diff(r *RunReport) []ExpectationMismatch {
+	var mismatches []ExpectationMismatch
+	miss := func(expectation, expected, actual string) {
+		mismatches = append(mismatches, ExpectationMismatch{Expectation: expectation, Expected: expected, Actual: actual})
+	}
+	for _, write := range sortedKeys(e.Writes) {
+		actual, exists := r.Writes[write]
+		if !exists {
+			actual = "not submitted"
+		}
+		if actual != e.Writes[write] {
+			miss("write "+write, e.Writes[write], actual)
+		}
+	}
+	if e.MaxLeaderChanges != nil && r.LeaderChanges > *e.MaxLeaderChanges {
+		miss("leader changes", fmt.Sprintf("≤ %d", *e.MaxLeaderChanges), strconv.Itoa(r.LeaderChanges))
+	}
+	if e.MaxSafetyViolations != nil && len(r.SafetyViolations) > *e.MaxSafetyViolations {
+		miss("safety violations", fmt.Sprintf("≤ %d", *e.MaxSafetyViolations), fmt.Sprintf("%d: %s", len(r.SafetyViolations), strings.Join(r.SafetyViolations, "; ")))
+	}
+	verdicts := make(map[string]string)
+	for _, verdict := range r.Verdicts {
+		verdicts[verdict.Check] = "fail"
+		if verdict.Passed {
+			verdicts[verdict.Check] = "pass"
+		}
+	}
+	for _, check := range sortedKeys(e.Verdicts) {
+		actual, exists := verdicts[check]
+		if !exists {
+			actual = "no such check"
+		}
+		if actual != e.Verdicts[check] {
+			miss("verdict "+check, e.Verdicts[check], actual)
+		}
+	}
+	for _, result := range sortedKeys(e.Results) {
+		value, exists := r.Results[result]
+		if !exists {
+			// A run that never reached the result cannot meet its range
+			miss("result "+result, e.Results[result].String(), "missing")
+			continue
+		}
+		if !e.Results[result].contains(value) {
+			miss("result "+result, e.Results[result].String(), formatResult(value))
+		}
+	}
+	return mismatches
+}
+
+// Expect diffs the report against the expectations and keeps the
+// mismatches in the report. The error lists them, wrapping
+// ErrExpectationsUnmet, if there are any.
+func (r *RunReport) Expect(e *Expectations) error {
+	r.Expected = true
+	r.Mismatches = e.Diff(r)
+	if len(r.Mismatches) == 0 {
+		return nil
+	}
+	missed := make([]string, len(r.Mismatches))
+	for i, mismatch := range r.Mismatches {
+		missed[i] = mismatch.String()
+	}
+	return fmt.Errorf("%w: %s", ErrExpectationsUnmet, strings.Join(missed, "; "))
+}
@@ -0,0 +1,107 @@
+package bft
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestBundledScenariosMeetExpectations tests that a run of every bundled
+// scenario shows the outcomes its spec declares
+func TestBundledScenariosMeetExpectations(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	paths, _ := filepath.Glob("../docs/scenarios/*.yaml")
+	for _, path := range paths {
+		if strings.HasSuffix(path, ".expect.yaml") {
+			continue
+		}
+		scenario, err := LoadScenario(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectations, err := ExpectationsFor(path)
+		if err != nil || expectations == nil {
+			t.Fatalf("Expected expectations next to %s, got %v", path, err)
+		}
+		report := SimulatePartitionReport(5, scenario, nil, nil, nil, nil)
+		if err := report.Expect(expectations); err != nil {
+			t.Errorf("%s: %v", scenario.Name, err)
+		}
+	}
+}
+
+// TestExpectationsDiff tests that every missed expectation is reported with
+// what was expected and what happened, in order, and nothing else
+func TestExpectationsDiff(t *testing.T) {
+	one, three, seven := 1, 3.0, 7.0
+	expectations := &Expectations{
+		Writes:              map[string]string{"W1": WriteCommitted, "W2": WriteAborted, "W3": WriteCommitted},
+		MaxLeaderChanges:    &one,
+		MaxSafetyViolations: &one,
+		Verdicts:            map[string]string{"quorum healed": "pass", "linearizability": "pass", "agreement raft": "pass"},
+		Results:             map[string]ResultRange{"raft_healed_executed": {Min: &seven}, "pbft_partitioned_executed": {Min: &three, Max: &three}},
+	}
+	report := &RunReport{
+		Writes:           map[string]string{"W1": WriteCommitted, "W2": WriteCommitted},
+		LeaderChanges:    2,
+		SafetyViolations: []string{"[x] stale read"},
+		Verdicts:         []ReportVerdict{{Check: "quorum healed", Passed: true}, {Check: "linearizability"}},
+		Results:          map[string]float64{"raft_healed_executed": 7},
+	}
+	err := report.Expect(expectations)
+	if !errors.Is(err, ErrExpectationsUnmet) {
+		t.Fatalf("Expected unmet expectations, got %v", err)
+	}
+	expected := []ExpectationMismatch{
+		{Expectation: "write W2", Expected: WriteAborted, Actual: WriteCommitted},
+		{Expectation: "write W3", Expected: WriteCommitted, Actual: "not submitted"},
+		{Expectation: "leader changes", Expected: "≤ 1", Actual: "2"},
+		{Expectation: "verdict agreement raft", Expected: "pass", Actual: "no such check"},
+		{Expectation: "verdict linearizability", Expected: "pass", Actual: "fail"},
+		{Expectation: "result pbft_partitioned_executed", Expected: "3", Actual: "missing"},
+	}
+	if !reflect.DeepEqual(report.Mismatches, expected) {
+		t.Errorf("Expected mismatches %v, got %v", expected, report.Mismatches)
+	}
+	if markdown := report.Markdown(); !strings.Contains(markdown, "## Expectations") || !strings.Contains(markdown, "| leader changes | ≤ 1 | 2 |") {
+		t.Errorf("Expected the mismatches in the Markdown report, got\n%s", markdown)
+	}
+
+	report.Writes["W2"], report.Writes["W3"] = WriteAborted, WriteCommitted
+	report.LeaderChanges = 1
+	expectations.Verdicts = map[string]string{"linearizability": "fail"}
+	expectations.Results = nil
+	if err := report.Expect(expectations); err != nil || len(report.Mismatches) != 0 {
+		t.Errorf("Expected every expectation met, got %v", err)
+	}
+}
+
+// TestLoadExpectationsInvalid tests that outcomes and ranges that cannot be
+// met are refused when the spec is loaded
+func TestLoadExpectationsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, spec := range map[string]string{
+		"outcome.yaml": "writes: {W1: done}\n",
+		"verdict.yaml": "verdicts: {linearizability: maybe}\n",
+		"range.json":   `{"results": {"raft_healed_executed": {"min": 7, "max": 5}}}`,
+		"empty.yaml":   "results: {raft_healed_executed: {}}\n",
+		"maximum.yaml": "max_leader_changes: -1\n",
+		"unknown.yaml": "max_leader_change: 1\n",
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(spec), 0o644)
+		if _, err := LoadExpectations(path); !errors.Is(err, ErrInvalidExpectations) {
+			t.Errorf("%s: expected invalid expectations, got %v", name, err)
+		}
+	}
+	if expectations, err := ExpectationsFor(filepath.Join(dir, "none.yaml")); expectations != nil || err != nil {
+		t.Errorf("Expected no expectations for a scenario without a spec, got %+v, %v", expectations, err)
+	}
+}
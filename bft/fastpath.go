@@ -0,0 +1,141 @@
+package bft
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Latency model of an optimistic fast-path commit.
+//
+// The standard path commits an entry once 2f+1 replicas have prepared it and
+// 2f+1 replicas have then sent matching commits: two quorum round trips. An
+// optimistic fast path would commit as soon as all n replicas answered the
+// pre-prepare with matching prepares within FastWindow, skipping the commit
+// round, and leave the rest to the standard path running alongside. This
+// file models only the latency of the two paths, from the delays of each
+// replica's messages; PBFTReplica does not take the fast path. Running it
+// safely needs more than the commit rule: a fast commit leaves most replicas
+// without a prepared certificate, so the view change would also have to
+// carry accepted pre-prepares and re-propose a digest f+1 of them vouch for.
+// In failure-free periods the model shows the commit round saved; with a
+// slow or silent replica the fast path never triggers and latency is
+// unchanged.
+
+// CommitPathModel describes the commit paths of a cluster of N replicas
+// tolerating F faults
+type CommitPathModel struct {
+	N          int
+	F          int
+	FastPath   bool
+	FastWindow time.Duration
+}
+
+// CommitEstimate is when one modeled round commits, and on which path
+type CommitEstimate struct {
+	Committed bool
+	FastPath  bool
+	Latency   time.Duration
+}
+
+// NoResponse marks a replica that never answered in a round
+const NoResponse = time.Duration(-1)
+
+// kthResponse returns the k-th earliest response time, or false if fewer
+// than k replicas responded
+func kthResponse(delays []time.Duration, k int) (time.Duration, bool) {
+	responded := make([]time.Duration, 0, len(delays))
+	for _, delay := range delays {
+		if delay != NoResponse {
+			responded = append(responded, delay)
+		}
+	}
+	if k <= 0 || len(responded) < k {
+		return 0, false
+	}
+	sort.Slice(responded, func(i, j int) bool { return responded[i] < responded[j] })
+	return responded[k-1], true
+}
+
+// Estimate computes when an entry would commit given the time each
+// replica's prepare reaches the leader and the additional time each
+// replica's commit takes to arrive
+func (c CommitPathModel) Estimate(prepareDelays, commitDelays []time.Duration) CommitEstimate {
+	quorum := 2*c.F + 1
+	var outcome CommitEstimate
+
+	prepared, ok := kthResponse(prepareDelays, quorum)
+	if ok {
+		if commit, ok := kthResponse(commitDelays, quorum); ok {
+			outcome = CommitEstimate{Committed: true, Latency: prepared + commit}
+		}
+	}
+
+	if c.FastPath {
+		if all, ok := kthResponse(prepareDelays, c.N); ok && all <= c.FastWindow {
+			if !outcome.Committed || all < outcome.Latency {
+				outcome = CommitEstimate{Committed: true, FastPath: true, Latency: all}
+			}
+		}
+	}
+	return outcome
+}
+
+// LatencyModel samples one-way message delays
+type LatencyModel struct {
+	Base   time.Duration
+	Jitter time.Duration // Uniform extra delay in [0, Jitter)
+	Silent int           // Number of replicas that never respond
+}
+
+// sample returns per-replica delays for one round
+func (m LatencyModel) sample(rng *rand.Rand, n int) []time.Duration {
+	delays := make([]time.Duration, n)
+	for i := range delays {
+		if i < m.Silent {
+			delays[i] = NoResponse
+			continue
+		}
+		delays[i] = m.Base
+		if m.Jitter > 0 {
+			delays[i] += time.Duration(rng.Int63n(int64(m.Jitter)))
+		}
+	}
+	return delays
+}
+
+// CommitBenchResult summarizes modeled commit latency over many rounds
+type CommitBenchResult struct {
+	Rounds      int
+	Committed   int
+	FastCommits int
+	MeanLatency time.Duration
+	P99Latency  time.Duration
+}
+
+// BenchCommitLatency estimates rounds commit rounds with delays drawn from
+// model
+func BenchCommitLatency(config CommitPathModel, model LatencyModel, rounds int, seed int64) CommitBenchResult {
+	rng := rand.New(rand.NewSource(seed))
+	result := CommitBenchResult{Rounds: rounds}
+	var latencies []time.Duration
+	var total time.Duration
+	for i := 0; i < rounds; i++ {
+		outcome := config.Estimate(model.sample(rng, config.N), model.sample(rng, config.N))
+		if !outcome.Committed {
+			continue
+		}
+		result.Committed++
+		if outcome.FastPath {
+			result.FastCommits++
+		}
+		latencies = append(latencies, outcome.Latency)
+		total += outcome.Latency
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		result.MeanLatency = total / time.Duration(len(latencies))
+		result.P99Latency = latencies[(len(latencies)*99)/100]
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package bft
+
+import (
+	"testing"
+	"time"
+)
+
+func ms(values ...int) []time.Duration {
+	delays := make([]time.Duration, len(values))
+	for i, v := range values {
+		if v < 0 {
+			delays[i] = NoResponse
+		} else {
+			delays[i] = time.Duration(v) * time.Millisecond
+		}
+	}
+	return delays
+}
+
+// TestCommitPaths tests fast-path and standard-path commit estimates
+func TestCommitPaths(t *testing.T) {
+	fast := CommitPathModel{N: 4, F: 1, FastPath: true, FastWindow: 50 * time.Millisecond}
+	standard := fast
+	standard.FastPath = false
+
+	tests := []struct {
+		name     string
+		config   CommitPathModel
+		prepares []time.Duration
+		commits  []time.Duration
+		fastPath bool
+		latency  time.Duration
+	}{
+		{"standard path", standard, ms(10, 20, 30, 40), ms(10, 20, 30, 40), false, 60 * time.Millisecond},
+		{"all prepares in window", fast, ms(10, 20, 30, 40), ms(10, 20, 30, 40), true, 40 * time.Millisecond},
+		{"silent replica falls back", fast, ms(10, 20, 30, -1), ms(10, 20, 30, -1), false, 60 * time.Millisecond},
+		{"slow replica outside window", fast, ms(10, 20, 30, 90), ms(10, 20, 30, 90), false, 60 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome := tt.config.Estimate(tt.prepares, tt.commits)
+			if !outcome.Committed || outcome.FastPath != tt.fastPath || outcome.Latency != tt.latency {
+				t.Errorf("Expected fast=%t latency=%v, got %+v", tt.fastPath, tt.latency, outcome)
+			}
+		})
+	}
+
+	if outcome := fast.Estimate(ms(10, 20, -1, -1), ms(10, 20, -1, -1)); outcome.Committed {
+		t.Errorf("Expected no commit without a quorum, got %+v", outcome)
+	}
+}
+
+// TestFastPathImprovesFailureFreeLatency tests the latency gain in failure-free periods
+func TestFastPathImprovesFailureFreeLatency(t *testing.T) {
+	model := LatencyModel{Base: 20 * time.Millisecond, Jitter: 10 * time.Millisecond}
+	standard := BenchCommitLatency(CommitPathModel{N: 4, F: 1}, model, 1000, 1)
+	fast := BenchCommitLatency(CommitPathModel{N: 4, F: 1, FastPath: true, FastWindow: 40 * time.Millisecond}, model, 1000, 1)
+
+	if fast.FastCommits != fast.Committed {
+		t.Errorf("Expected every failure-free round to take the fast path, got %d of %d", fast.FastCommits, fast.Committed)
+	}
+	if fast.MeanLatency >= standard.MeanLatency {
+		t.Errorf("Expected fast path to cut mean latency, got %v vs %v", fast.MeanLatency, standard.MeanLatency)
+	}
+
+	model.Silent = 1
+	degraded := BenchCommitLatency(CommitPathModel{N: 4, F: 1, FastPath: true, FastWindow: 40 * time.Millisecond}, model, 1000, 1)
+	if degraded.FastCommits != 0 || degraded.Committed != 1000 {
+		t.Errorf("Expected a silent replica to force the standard path, got %+v", degraded)
+	}
+}
+
+// benchmarkCommitPath reports simulated commit latency as a custom metric
+func benchmarkCommitPath(b *testing.B, config CommitPathModel) {
+	model := LatencyModel{Base: 20 * time.Millisecond, Jitter: 10 * time.Millisecond}
+	var result CommitBenchResult
+	for i := 0; i < b.N; i++ {
+		result = BenchCommitLatency(config, model, 100, int64(i))
+	}
+	b.ReportMetric(float64(result.MeanLatency.Microseconds())/1000, "sim-ms/commit")
+	b.ReportMetric(float64(result.P99Latency.Microseconds())/1000, "sim-p99-ms")
+}
+
+func BenchmarkCommitStandardPath(b *testing.B) {
+	benchmarkCommitPath(b, CommitPathModel{N: 4, F: 1})
+}
+
+func BenchmarkCommitFastPath(b *testing.B) {
+	benchmarkCommitPath(b, CommitPathModel{N: 4, F: 1, FastPath: true, FastWindow: 40 * time.Millisecond})
+}
@@ -0,0 +1,181 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Pluggable faults.
+//
+// Every fault kind a schedule can name is backed by a Fault built from the
+// step's nodes by a registered factory. The built-in kinds are registered
+// here; downstream code registers its own (a frozen clock, a full disk)
+// with RegisterFault and schedules them exactly like the built-ins. A step
+// with a Duration is reverted that many rounds after it was applied.
+
+var (
+	ErrUnknownFault    = errors.New("unknown fault kind")
+	ErrFaultRegistered = errors.New("fault kind already registered")
+)
+
+// Fault is an injectable failure. Apply and Revert receive the round number.
+type Fault interface {
+	Apply(system *System, round int) error
+	Revert(system *System, round int) error
+}
+
+// FaultFactory builds the fault a step injects on its nodes
+type FaultFactory func(nodes []string) Fault
+
+var (
+	faultLock      sync.RWMutex
+	faultFactories = map[FaultKind]FaultFactory{}
+)
+
+// RegisterFault makes a fault kind available to schedules
+func RegisterFault(kind FaultKind, factory FaultFactory) error {
+	faultLock.Lock()
+	defer faultLock.Unlock()
+	if _, exists := faultFactories[kind]; exists {
+		return fmt.Errorf("%w: %s", ErrFaultRegistered, kind)
+	}
+	faultFactories[kind] = factory
+	return nil
+}
+
+// FaultKinds returns the registered fault kinds in sorted order
+func FaultKinds() []FaultKind {
+	faultLock.RLock()
+	defer faultLock.RUnlock()
+	kinds := make([]FaultKind, 0, len(faultFactories))
+	for kind := range faultFactories {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	return kinds
+}
+
+// NewFault builds the fault for a step
+func NewFault(step FaultStep) (Fault, error) {
+	faultLock.RLock()
+	factory, exists := faultFactories[step.Kind]
+	faultLock.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFault, step.Kind)
+	}
+	return factory(step.Nodes), nil
+}
+
+func init() {
+	RegisterFault(FaultPartition, func(nodes []string) Fault { return partitionFault{nodes, true} })
+	RegisterFault(FaultHeal, func(nodes []string) Fault { return partitionFault{nodes, false} })
+	RegisterFault(FaultByzantine, func(nodes []string) Fault { return byzantineFault(nodes) })
+	RegisterFault(FaultCrash, func(nodes []string) Fault { return crashFault(nodes) })
+	RegisterFault(FaultCertExpiry, func(nodes []string) Fault { return certExpiryFault(nodes) })
+}
+
+// lookupNodes resolves node IDs, failing on the first unknown one
+func (s *System) lookupNodes(ids []string) ([]*Node, error) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	nodes := make([]*Node, len(ids))
+	for i, id := range ids {
+		node, exists := s.Nodes[id]
+		if !exists {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownNode, id)
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// partitionFault isolates nodes, or reconnects them when isolate is false
+type partitionFault struct {
+	nodes   []string
+	isolate bool
+}
+
+func (f partitionFault) set(system *System, isolate bool) error {
+	if _, err := system.lookupNodes(f.nodes); err != nil {
+		return err
+	}
+	for _, id := range f.nodes {
+		system.SetPartition(id, isolate)
+	}
+	return nil
+}
+
+func (f partitionFault) Apply(system *System, round int) error {
+	return f.set(system, f.isolate)
+}
+
+func (f partitionFault) Revert(system *System, round int) error {
+	return f.set(system, !f.isolate)
+}
+
+// byzantineFault turns nodes Byzantine
+type byzantineFault []string
+
+func (f byzantineFault) set(system *System, byzantine bool) error {
+	nodes, err := system.lookupNodes(f)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		node.Lock.Lock()
+		node.IsByzantine = byzantine
+		node.Lock.Unlock()
+	}
+	return nil
+}
+
+func (f byzantineFault) Apply(system *System, round int) error {
+	return f.set(system, true)
+}
+
+func (f byzantineFault) Revert(system *System, round int) error {
+	return f.set(system, false)
+}
+
+// crashFault crash-stops nodes by fencing them; reverting restarts them. A
+// node with a disk loses what it had not persisted and restarts from the
+// disk, see NodeDisk.
+type crashFault []string
+
+func (f crashFault) Apply(system *System, round int) error {
+	nodes, err := system.lookupNodes(f)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if !system.IsFenced(node.ID) {
+			system.fence(&NodeFailure{Node: node.ID, Handler: "injected crash", Panic: "crash fault", State: dumpState(node), At: system.now()})
+			if err := node.crashDisk(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f crashFault) Revert(system *System, round int) error {
+	nodes, err := system.lookupNodes(f)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if system.IsFenced(node.ID) {
+			if err := node.recoverDisk(); err != nil {
+				return err
+			}
+		}
+	}
+	system.Lock.Lock()
+	defer system.Lock.Unlock()
+	for _, id := range f {
+		delete(system.Fenced, id)
+	}
+	return nil
+}
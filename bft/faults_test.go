@@ -0,0 +1,109 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// clockFreezeFault is a downstream fault that stops a node's clock
+type clockFreezeFault []string
+
+func (f clockFreezeFault) Apply(system *System, round int) error {
+	nodes, err := system.lookupNodes(f)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		node.Clock = func() int64 { return 0 }
+	}
+	return nil
+}
+
+func (f clockFreezeFault) Revert(system *System, round int) error {
+	nodes, err := system.lookupNodes(f)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		node.Clock = nil
+	}
+	return nil
+}
+
+// unregisterFault removes a fault kind a test registered
+func unregisterFault(kind FaultKind) {
+	faultLock.Lock()
+	defer faultLock.Unlock()
+	delete(faultFactories, kind)
+}
+
+// TestCustomFaultInSchedule tests registering and scheduling a custom fault
+func TestCustomFaultInSchedule(t *testing.T) {
+	const kind FaultKind = "clock-freeze"
+	if err := RegisterFault(kind, func(nodes []string) Fault { return clockFreezeFault(nodes) }); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unregisterFault(kind) })
+	if err := RegisterFault(kind, func(nodes []string) Fault { return clockFreezeFault(nodes) }); !errors.Is(err, ErrFaultRegistered) {
+		t.Errorf("Expected duplicate registration to fail, got %v", err)
+	}
+
+	run := newChaosRun()
+	run.Invariant = func(system *System) error {
+		for _, id := range []string{"B", "C"} {
+			if system.Nodes["A"].VectorClock.GetTimestamp(id) == 0 {
+				return fmt.Errorf("clock of %s is frozen", id)
+			}
+		}
+		return nil
+	}
+	err := run.Run(Schedule{
+		{At: 1, Kind: FaultPartition, Nodes: []string{"D"}},
+		{At: 2, Kind: kind, Nodes: []string{"C"}},
+	})
+	var violation *InvariantViolation
+	if !errors.As(err, &violation) || violation.Round != 2 {
+		t.Errorf("Expected the custom fault to trip the invariant in round 2, got %v", err)
+	}
+}
+
+// TestFaultDurationReverts tests that faults with a duration are reverted
+func TestFaultDurationReverts(t *testing.T) {
+	run := newChaosRun()
+	run.Rounds = 3
+	if err := run.Run(Schedule{{At: 0, Kind: FaultPartition, Nodes: []string{"A"}, Duration: 1}}); err == nil {
+		t.Errorf("Expected partitioned leader to violate the invariant")
+	}
+
+	var leaderPartitioned []bool
+	run.Invariant = func(system *System) error {
+		leaderPartitioned = append(leaderPartitioned, system.IsPartitioned("A"))
+		return nil
+	}
+	if err := run.Run(Schedule{{At: 0, Kind: FaultPartition, Nodes: []string{"A"}, Duration: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(leaderPartitioned) != "[true true false]" {
+		t.Errorf("Expected partition to last two rounds, got %v", leaderPartitioned)
+	}
+}
+
+// TestUnknownFaultKind tests that unregistered kinds are rejected
+func TestUnknownFaultKind(t *testing.T) {
+	system := NewSystem()
+	if err := system.ApplyFault(FaultStep{Kind: "meteor"}); !errors.Is(err, ErrUnknownFault) {
+		t.Errorf("Expected ErrUnknownFault, got %v", err)
+	}
+	for _, kind := range []FaultKind{FaultByzantine, FaultCrash, FaultHeal, FaultPartition} {
+		found := false
+		for _, registered := range FaultKinds() {
+			if registered == kind {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected built-in fault %s to be registered", kind)
+		}
+	}
+}
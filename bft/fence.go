@@ -0,0 +1,137 @@
+package bft
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// Panic recovery and self-fencing.
+//
+// A bug in one node's message handler must not take down the whole
+// simulation. Handlers run under a guard that recovers a panic and fences
+// the node instead: it stops receiving messages, voting and replicating, as
+// if it had crashed, while the rest of the cluster carries on. The guard
+// captures the panic value, the stack and a dump of the node's state, raises
+// an alert, and records the failure so analysis treats it as a crash fault.
+
+// NodeState is a snapshot of a node taken when it was fenced
+type NodeState struct {
+	ID          string
+	VectorClock map[string]int64
+	CommitIndex int64
+	Entries     int
+	IsByzantine bool
+}
+
+// NodeFailure describes a handler panic that fenced a node
+type NodeFailure struct {
+	Node    string
+	Handler string
+	Panic   interface{}
+	Stack   string
+	State   NodeState
+	At      time.Time
+}
+
+func (f *NodeFailure) Error() string {
+	return fmt.Sprintf("node %s fenced after panic in %s: %v", f.Node, f.Handler, f.Panic)
+}
+
+// dumpState snapshots a node without relying on its state being intact
+func dumpState(node *Node) (state NodeState) {
+	state.ID = node.ID
+	defer func() {
+		// A node whose state is corrupt enough to panic may not dump fully
+		recover()
+	}()
+	node.Lock.RLock()
+	defer node.Lock.RUnlock()
+	state.IsByzantine = node.IsByzantine
+	if node.VectorClock != nil {
+		state.VectorClock = node.VectorClock.Timestamps()
+	}
+	if node.Store != nil {
+		state.CommitIndex = node.Store.CommitIndex
+		state.Entries = len(node.Store.Entries)
+	}
+	return state
+}
+
+// guard runs a message handler for node, fencing the node if it panics.
+// It returns the failure, or nil if the handler completed.
+func (s *System) guard(node *Node, handler string, fn func()) (failure *NodeFailure) {
+	defer func() {
+		if r := recover(); r != nil {
+			failure = &NodeFailure{
+				Node:    node.ID,
+				Handler: handler,
+				Panic:   r,
+				Stack:   string(debug.Stack()),
+				State:   dumpState(node),
+				At:      s.now(),
+			}
+			s.fence(failure)
+			s.alert(failure)
+		}
+	}()
+	fn()
+	return nil
+}
+
+// fence stops a node from taking part in the protocol
+func (s *System) fence(failure *NodeFailure) {
+	s.Lock.Lock()
+	if s.Fenced == nil {
+		s.Fenced = make(map[string]*NodeFailure)
+	}
+	s.Fenced[failure.Node] = failure
+	s.Lock.Unlock()
+	s.trace(TraceEvent{Type: EventFenced, Node: failure.Node, Detail: failure.Error()})
+}
+
+// alert reports a failure through the alert hook
+func (s *System) alert(failure *NodeFailure) {
+	s.Lock.RLock()
+	hook := s.OnFailure
+	s.Lock.RUnlock()
+	if hook != nil {
+		hook(failure)
+		return
+	}
+	Output.Printf("ALERT: %v\n", failure)
+}
+
+// IsFenced reports whether a node has been fenced
+func (s *System) IsFenced(nodeID string) bool {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	return s.Fenced[nodeID] != nil
+}
+
+// Failures returns the recorded node failures ordered by node ID
+func (s *System) Failures() []*NodeFailure {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	failures := make([]*NodeFailure, 0, len(s.Fenced))
+	for _, failure := range s.Fenced {
+		failures = append(failures, failure)
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Node < failures[j].Node })
+	return failures
+}
+
+// CrashFaults expresses the fenced nodes as a crash fault injected at round,
+// so fault analysis sees them like any injected crash
+func (s *System) CrashFaults(round int) Schedule {
+	failures := s.Failures()
+	if len(failures) == 0 {
+		return nil
+	}
+	step := FaultStep{At: round, Kind: FaultCrash}
+	for _, failure := range failures {
+		step.Nodes = append(step.Nodes, failure.Node)
+	}
+	return Schedule{step}
+}
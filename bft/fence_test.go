@@ -0,0 +1,85 @@
+package bft
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestHandlerPanicFencesNode tests that a panicking handler fences only its node
+func TestHandlerPanicFencesNode(t *testing.T) {
+	system, err := newChaosRun().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	system.Trace = NewTrace()
+	var alerts []*NodeFailure
+	system.OnFailure = func(failure *NodeFailure) { alerts = append(alerts, failure) }
+
+	// Corrupt B so its clock handler dereferences nil
+	system.Nodes["B"].VectorClock = nil
+
+	sender := system.Nodes["A"]
+	update := sender.GetClockUpdate()
+	sender.PropagateClockUpdate(update, system)
+
+	if !system.IsFenced("B") || len(alerts) != 1 {
+		t.Fatalf("Expected B to be fenced with one alert, got %d alerts", len(alerts))
+	}
+	failure := alerts[0]
+	if failure.Node != "B" || failure.Handler != "VerifyAndApplyClockUpdate" || !strings.Contains(failure.Stack, "VerifyAndApplyClockUpdate") {
+		t.Errorf("Expected failure to name B's handler and carry a stack, got %v", failure)
+	}
+	for _, id := range []string{"C", "D", "E"} {
+		if system.Nodes[id].VectorClock.GetTimestamp("A") != update.Timestamp {
+			t.Errorf("Expected %s to apply the update despite B's panic", id)
+		}
+	}
+
+	// Fenced nodes no longer receive messages or vote
+	sender.PropagateClockUpdate(sender.GetClockUpdate(), system)
+	if len(alerts) != 1 {
+		t.Errorf("Expected fenced node to receive no more messages, got %d alerts", len(alerts))
+	}
+	election := NewElection(system, ElectionConfig{Timeout: 2})
+	if election.connected("A", "B") {
+		t.Errorf("Expected fenced node to be disconnected from elections")
+	}
+
+	fenced := 0
+	for _, event := range system.Trace.Snapshot() {
+		if event.Type == EventFenced {
+			fenced++
+		}
+	}
+	if fenced != 1 {
+		t.Errorf("Expected one fenced trace event, got %d", fenced)
+	}
+}
+
+// TestFencingSurfacesAsCrashFault tests that fenced nodes are reported as crash faults
+func TestFencingSurfacesAsCrashFault(t *testing.T) {
+	system, err := newChaosRun().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	system.OnFailure = func(*NodeFailure) {}
+	system.Nodes["C"].VectorClock = nil
+	system.Nodes["A"].PropagateClockUpdate(system.Nodes["A"].GetClockUpdate(), system)
+
+	faults := system.CrashFaults(4)
+	if len(faults) != 1 || faults[0].Kind != FaultCrash || faults[0].At != 4 || faults[0].Nodes[0] != "C" {
+		t.Fatalf("Expected a crash fault for C at round 4, got %v", faults)
+	}
+
+	// Replaying the crash fault fences the same node in a fresh system
+	replay, err := newChaosRun().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replay.ApplyFault(faults[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !replay.IsFenced("C") {
+		t.Errorf("Expected injected crash to fence C")
+	}
+}
@@ -0,0 +1,388 @@
+package bft
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Write forwarding and region-affinity reads.
+//
+// Clients may submit writes to any node. A follower forwards the write to the
+// current leader, which assigns it the next index and replicates it to every
+// reachable node. The client sees one request, but the reported latency
+// includes the hidden forwarding hop so the cost of talking to a remote leader
+// is visible.
+//
+// Reads are served by the leader by default. With RegionAffinity enabled they
+// are served by a replica in the client's region instead, which is faster but
+// may lag behind the leader; such reads carry an explicit staleness label.
+
+// Default latencies used when no region latency has been configured
+const (
+	LocalLatency              = 1 * time.Millisecond
+	DefaultCrossRegionLatency = 100 * time.Millisecond
+)
+
+var (
+	ErrUnknownNode       = errors.New("unknown node")
+	ErrNoLeader          = errors.New("no leader elected")
+	ErrNodeUnreachable   = errors.New("node unreachable")
+	ErrLeaderUnreachable = errors.New("leader unreachable from node")
+	ErrNoRegionReplica   = errors.New("no replica in region")
+)
+
+// Entry is a single committed key/value write, signed by the leader
+type Entry struct {
+	Index     int64
+	Key       string
+	Value     string
+	Signature string
+	Sealed    bool `json:",omitempty"` // Value is a sealed payload, see PayloadPolicy
+}
+
+// Store holds the key/value state replicated to a node
+type Store struct {
+	Entries     map[string]Entry
+	CommitIndex int64
+	// Namespaces holds the commit index of each namespace a consensus
+	// engine orders, which numbers its entries apart from the leader's
+	Namespaces map[string]int64
+	Disk       *NodeDisk // Persists applied entries when set, see UseDisks
+}
+
+// WriteResult describes how a write was routed and what it cost the client
+type WriteResult struct {
+	Index     int64
+	Leader    string
+	Forwarded bool
+	// ClientLatency is the round trip between the client and the contacted node
+	ClientLatency time.Duration
+	// ForwardLatency is the round trip between the contacted node and the leader
+	ForwardLatency time.Duration
+	// Total is the end-to-end latency, broken down by component in Timing
+	Total  time.Duration
+	Timing *OpTiming
+}
+
+// ReadResult describes a read and how stale the served value may be
+type ReadResult struct {
+	Key      string
+	Value    string
+	Index    int64
+	ServedBy string
+	Latency  time.Duration
+	// Staleness is the number of committed entries the serving node is behind the leader
+	Staleness int64
+	Label     string
+	// ReadIndex is the commit index a linearizable read was served at
+	ReadIndex int64
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{
+		Entries: make(map[string]Entry),
+	}
+}
+
+// Apply applies a committed entry to the store. A no-op entry, one with
+// no key, only advances the commit index.
+func (st *Store) Apply(entry Entry) {
+	if entry.Key != "" {
+		st.Entries[entry.Key] = entry
+	}
+	if entry.Index > st.CommitIndex {
+		st.CommitIndex = entry.Index
+	}
+	if st.Disk != nil {
+		st.Disk.log(entry, false)
+	}
+}
+
+// ApplyNamespace applies an entry committed by the consensus engine of
+// its key's namespace. The entry's index counts in the namespace's own
+// index space, so the commit index is left alone.
+func (st *Store) ApplyNamespace(entry Entry) {
+	st.Entries[entry.Key] = entry
+	if st.Namespaces == nil {
+		st.Namespaces = make(map[string]int64)
+	}
+	if namespace := Namespace(entry.Key); entry.Index > st.Namespaces[namespace] {
+		st.Namespaces[namespace] = entry.Index
+	}
+	if st.Disk != nil {
+		st.Disk.log(entry, true)
+	}
+}
+
+// SetRegionLatency sets the one-way latency between two regions
+func (s *System) SetRegionLatency(a, b string, latency time.Duration) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.Latencies[[2]string{a, b}] = latency
+	s.Latencies[[2]string{b, a}] = latency
+}
+
+// RegionLatency returns the one-way latency between two regions
+func (s *System) RegionLatency(a, b string) time.Duration {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	return s.regionLatency(a, b)
+}
+
+func (s *System) regionLatency(a, b string) time.Duration {
+	if latency, ok := s.Latencies[[2]string{a, b}]; ok {
+		return latency
+	}
+	if a == b {
+		return LocalLatency
+	}
+	return DefaultCrossRegionLatency
+}
+
+// reachable reports whether a node can currently take part in replication.
+// The caller must hold s.Lock.
+func (s *System) reachable(node *Node) bool {
+	return !node.IsIsolated && !s.Partition[node.ID] && s.Fenced[node.ID] == nil
+}
+
+// SubmitWrite submits a write from a client in clientRegion to nodeID. If the
+// node is a follower the write is forwarded to the leader, unless the key's
+// namespace is ordered by another consensus engine, see UseEngine.
+func (s *System) SubmitWrite(clientRegion, nodeID, key, value string) (result *WriteResult, err error) {
+	op := s.recordInvoke(clientRegion, OpWrite, key, value)
+	defer func() {
+		if err != nil {
+			s.recordComplete(op, "", 0, false)
+		} else {
+			s.recordComplete(op, "", result.Index, true)
+		}
+	}()
+	if engine := s.engine(key); engine != nil {
+		return engine.Write(clientRegion, nodeID, key, value)
+	}
+	if result, err = s.leaderWrite(clientRegion, nodeID, key, value); err == nil {
+		s.trace(TraceEvent{Type: EventCommit, Node: result.Leader, Peer: nodeID, Detail: fmt.Sprintf("%s at index %d", key, result.Index)})
+	}
+	return result, err
+}
+
+// leaderWrite commits a write through the leader
+func (s *System) leaderWrite(clientRegion, nodeID, key, value string) (result *WriteResult, err error) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	contact, leader, err := s.route(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	result = &WriteResult{
+		Leader:        leader.ID,
+		Forwarded:     contact.ID != leader.ID,
+		ClientLatency: 2 * s.regionLatency(clientRegion, contact.Region),
+	}
+	if result.Forwarded {
+		result.ForwardLatency = 2 * s.regionLatency(contact.Region, leader.Region)
+	}
+
+	s.commitLock.Lock()
+	defer s.commitLock.Unlock()
+	leader.Lock.RLock()
+	entry := Entry{Index: leader.Store.CommitIndex + 1, Key: key, Value: value}
+	leader.Lock.RUnlock()
+	result.Index = entry.Index
+	if entry, err = s.Payloads.seal(entry); err != nil {
+		return nil, err
+	}
+
+	timing := NewOpTiming(fmt.Sprintf("w%d", entry.Index), "client@"+clientRegion)
+	err = s.commit(timing, clientRegion, contact, leader, entryDigest(entry), []Entry{entry})
+	if err != nil {
+		return nil, err
+	}
+	result.Timing = timing
+	result.Total = timing.Total()
+	s.Metrics.observeCommit("leader", result.Total)
+	return result, nil
+}
+
+// route resolves the node a client contacts and the leader it forwards to.
+// Failures past the contact carry its routing hint. The caller must hold s.Lock.
+func (s *System) route(nodeID string) (contact, leader *Node, err error) {
+	contact, exists := s.Nodes[nodeID]
+	if !exists {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownNode, nodeID)
+	}
+	if !s.reachable(contact) {
+		return nil, nil, s.hinted(contact, fmt.Errorf("%w: %s", ErrNodeUnreachable, nodeID))
+	}
+	leader, exists = s.Nodes[s.Leader]
+	if !exists {
+		return nil, nil, s.hinted(contact, ErrNoLeader)
+	}
+	if !s.reachable(leader) {
+		return nil, nil, s.hinted(contact, fmt.Errorf("%w: %s cannot reach %s", ErrLeaderUnreachable, nodeID, leader.ID))
+	}
+	return contact, leader, nil
+}
+
+// commit walks a request through its hops, stamping each stage on timing:
+// the leader signs digest, gathers a quorum, and the entries are replicated
+// to every reachable node, the leader included. All entries share the one
+// signature. A leader that cannot reach a quorum commits nothing and fails
+// with ErrNoQuorum. The caller must hold s.Lock, and s.commitLock from
+// picking the entries' index on unless s.Lock is held exclusively.
+func (s *System) commit(timing *OpTiming, clientRegion string, contact, leader *Node, digest []byte, entries []Entry) error {
+	clientLatency := s.regionLatency(clientRegion, contact.Region)
+	forwardLatency := s.regionLatency(contact.Region, leader.Region)
+	forwarded := contact.ID != leader.ID
+
+	timing.Stamp(contact.ID, "received", clientLatency)
+	if forwarded {
+		timing.Stamp(leader.ID, "forwarded", forwardLatency)
+		s.capture(newPacket(contact, leader, "forward", entriesSize(entries), forwardLatency))
+	}
+	roundTrip, err := s.heartbeatQuorum(leader)
+	s.Hooks.notifyQuorum(s.View, leader.ID, err)
+	if err != nil {
+		return err
+	}
+	timing.Stamp(leader.ID, "dequeued", s.QueueDelay)
+	signStart := time.Now()
+	signature, err := crypto.Sign(leader.PrivateKey, digest)
+	if err != nil {
+		return err
+	}
+	signCost := time.Since(signStart)
+	if s.Scheduler != nil {
+		// Measured costs differ between runs, modeled ones do not
+		timing.ClientSent = s.Scheduler.Time()
+		signCost = SimulatedSignCost
+	}
+	timing.Stamp(leader.ID, "signed", signCost)
+	timing.Stamp(leader.ID, "committed", roundTrip)
+	if forwarded {
+		timing.Stamp(contact.ID, "replied", forwardLatency)
+	}
+	timing.Stamp(timing.Client, "replied", clientLatency)
+
+	for i := range entries {
+		entries[i].Signature = signature
+	}
+	for _, id := range sortedKeys(s.Nodes) {
+		node := s.Nodes[id]
+		if !s.reachable(node) {
+			continue
+		}
+		if node != leader {
+			s.capture(newPacket(leader, node, "append", entriesSize(entries), s.regionLatency(leader.Region, node.Region)))
+		}
+		node.Lock.Lock()
+		for _, entry := range entries {
+			node.Store.Apply(entry)
+		}
+		var diskErr error
+		if node.Store.Disk != nil {
+			diskErr = node.Store.Disk.Err()
+		}
+		node.Lock.Unlock()
+		if diskErr != nil {
+			return fmt.Errorf("%s failed to persist: %w", node.ID, diskErr)
+		}
+	}
+	return nil
+}
+
+// Read reads a key on behalf of a client in clientRegion. Without region
+// affinity the leader serves the read; with it a replica in the client's
+// region does and the result is labelled with its staleness.
+func (s *System) Read(clientRegion, key string) (result *ReadResult, err error) {
+	op := s.recordInvoke(clientRegion, OpRead, key, "")
+	defer func() {
+		if err != nil {
+			s.recordComplete(op, "", 0, false)
+		} else {
+			s.recordComplete(op, result.Value, result.Index, true)
+		}
+	}()
+
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	leader, exists := s.Nodes[s.Leader]
+	if !exists {
+		return nil, ErrNoLeader
+	}
+
+	server := leader
+	if s.RegionAffinity {
+		server = s.regionReplica(clientRegion)
+		if server == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNoRegionReplica, clientRegion)
+		}
+	} else if !s.reachable(leader) {
+		return nil, fmt.Errorf("%w: %s", ErrNodeUnreachable, leader.ID)
+	}
+
+	leader.Lock.RLock()
+	leaderIndex := leader.Store.CommitIndex
+	leader.Lock.RUnlock()
+
+	server.Lock.RLock()
+	entry := server.Store.Entries[key]
+	serverIndex := server.Store.CommitIndex
+	value, err := server.plaintext(entry)
+	server.Lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result = &ReadResult{
+		Key:       key,
+		Value:     value,
+		Index:     entry.Index,
+		ServedBy:  server.ID,
+		Latency:   2 * s.regionLatency(clientRegion, server.Region),
+		Staleness: leaderIndex - serverIndex,
+	}
+	if result.Staleness < 0 {
+		result.Staleness = 0
+	}
+	result.Label = stalenessLabel(result.Staleness)
+	return result, nil
+}
+
+// regionReplica picks the lowest-ID node in a region. Isolated replicas are
+// still allowed to answer, which is exactly where staleness comes from.
+// The caller must hold s.Lock.
+func (s *System) regionReplica(region string) *Node {
+	ids := make([]string, 0, len(s.Nodes))
+	for id, node := range s.Nodes {
+		if node.Region == region {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	return s.Nodes[ids[0]]
+}
+
+func stalenessLabel(staleness int64) string {
+	if staleness == 0 {
+		return "fresh"
+	}
+	return fmt.Sprintf("stale by %d entries", staleness)
+}
+
+// entryDigest returns the digest signed for an entry
+func entryDigest(entry Entry) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s", entry.Index, entry.Key, entry.Value)))
+	return sum[:]
+}
@@ -0,0 +1,97 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newGeoSystem builds a three-region system with leader A in us-east
+func newGeoSystem(t *testing.T) *System {
+	regions := map[string]string{"A": "us-east", "B": "us-east", "D": "eu-west", "G": "ap-south"}
+	system := newTestSystem(t, []string{"A", "B", "D", "G"}, func(node *Node) { node.Region = regions[node.ID] })
+	system.SetLeader("A")
+	system.SetRegionLatency("us-east", "ap-south", 110*time.Millisecond)
+	return system
+}
+
+// TestFollowerWriteForwarding tests that follower writes reach the leader and report the extra hop
+func TestFollowerWriteForwarding(t *testing.T) {
+	system := newGeoSystem(t)
+
+	direct, err := system.SubmitWrite("us-east", "A", "x", "1")
+	if err != nil {
+		t.Fatalf("Direct write failed: %v", err)
+	}
+	if direct.Forwarded || direct.ForwardLatency != 0 {
+		t.Errorf("Expected write to the leader not to be forwarded, got %+v", direct)
+	}
+
+	forwarded, err := system.SubmitWrite("ap-south", "G", "x", "2")
+	if err != nil {
+		t.Fatalf("Forwarded write failed: %v", err)
+	}
+	if !forwarded.Forwarded || forwarded.Leader != "A" {
+		t.Errorf("Expected write via G to be forwarded to A, got %+v", forwarded)
+	}
+	if forwarded.ForwardLatency != 220*time.Millisecond {
+		t.Errorf("Expected forward round trip of 220ms, got %v", forwarded.ForwardLatency)
+	}
+	breakdown := forwarded.Timing.Breakdown()
+	if breakdown[ComponentNetwork] != forwarded.ClientLatency+forwarded.ForwardLatency {
+		t.Errorf("Expected network latency to include both hops, got %v", breakdown[ComponentNetwork])
+	}
+	if forwarded.Total != forwarded.Timing.Total() {
+		t.Errorf("Expected total latency to match the timing, got %+v", forwarded)
+	}
+	if forwarded.Index != direct.Index+1 {
+		t.Errorf("Expected forwarded write to take the next index, got %d", forwarded.Index)
+	}
+}
+
+// TestWriteToIsolatedNodeRejected tests that isolated nodes cannot forward writes
+func TestWriteToIsolatedNodeRejected(t *testing.T) {
+	system := newGeoSystem(t)
+	system.SetPartition("D", true)
+
+	_, err := system.SubmitWrite("eu-west", "D", "x", "1")
+	if !errors.Is(err, ErrNodeUnreachable) {
+		t.Errorf("Expected ErrNodeUnreachable, got %v", err)
+	}
+}
+
+// TestRegionAffinityStaleRead tests that local reads are labelled with their staleness
+func TestRegionAffinityStaleRead(t *testing.T) {
+	system := newGeoSystem(t)
+
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	system.SetPartition("D", true)
+	if _, err := system.SubmitWrite("us-east", "A", "x", "2"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	fromLeader, err := system.Read("eu-west", "x")
+	if err != nil {
+		t.Fatalf("Leader read failed: %v", err)
+	}
+	if fromLeader.Value != "2" || fromLeader.Label != "fresh" {
+		t.Errorf("Expected fresh value 2 from leader, got %+v", fromLeader)
+	}
+
+	system.RegionAffinity = true
+	local, err := system.Read("eu-west", "x")
+	if err != nil {
+		t.Fatalf("Local read failed: %v", err)
+	}
+	if local.ServedBy != "D" || local.Value != "1" {
+		t.Errorf("Expected stale value 1 from D, got %+v", local)
+	}
+	if local.Staleness != 1 || local.Label != "stale by 1 entries" {
+		t.Errorf("Expected staleness of 1 entry, got %+v", local)
+	}
+	if local.Latency >= fromLeader.Latency {
+		t.Errorf("Expected local read to be faster than leader read")
+	}
+}
@@ -0,0 +1,139 @@
+package bft
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Consensus state machines as data.
+//
+// The phases a node moves through are driven by transition tables rather
+// than scattered assignments: code asks the table for the next phase, and a
+// transition the table does not define is a bug that panics. The same tables
+// render to Graphviz DOT, so the diagrams in docs/ always show exactly the
+// behavior that is implemented. Regenerate them with `go generate`.
+
+//go:generate go run ../cmd/wahello fsm -o ../docs/election_fsm.dot
+
+// Phase is a node's phase in a consensus state machine
+type Phase string
+
+// Transition moves from one phase to another on an event
+type Transition struct {
+	From Phase
+	On   string
+	To   Phase
+}
+
+// FSM is a named transition table
+type FSM struct {
+	Name        string
+	Initial     Phase
+	Transitions []Transition
+}
+
+// Next returns the phase reached from from on event, and whether the table
+// defines that transition
+func (f *FSM) Next(from Phase, on string) (Phase, bool) {
+	for _, t := range f.Transitions {
+		if t.From == from && t.On == on {
+			return t.To, true
+		}
+	}
+	return from, false
+}
+
+// MustNext is Next for transitions the caller relies on the table defining
+func (f *FSM) MustNext(from Phase, on string) Phase {
+	to, ok := f.Next(from, on)
+	if !ok {
+		panic(fmt.Sprintf("%s state machine: no transition from %s on %s", f.Name, from, on))
+	}
+	return to
+}
+
+// Phases returns every phase in the table in sorted order
+func (f *FSM) Phases() []Phase {
+	seen := map[Phase]bool{f.Initial: true}
+	for _, t := range f.Transitions {
+		seen[t.From] = true
+		seen[t.To] = true
+	}
+	phases := make([]Phase, 0, len(seen))
+	for phase := range seen {
+		phases = append(phases, phase)
+	}
+	sort.Slice(phases, func(i, j int) bool { return phases[i] < phases[j] })
+	return phases
+}
+
+// DOT renders the state machine as a Graphviz digraph
+func (f *FSM) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", f.Name)
+	fmt.Fprintf(&b, "\trankdir=LR;\n")
+	fmt.Fprintf(&b, "\tnode [shape=ellipse];\n")
+	fmt.Fprintf(&b, "\t__start [shape=point];\n")
+	fmt.Fprintf(&b, "\t__start -> %q;\n", f.Initial)
+	for _, phase := range f.Phases() {
+		fmt.Fprintf(&b, "\t%q;\n", phase)
+	}
+	for _, t := range f.Transitions {
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q];\n", t.From, t.To, t.On)
+	}
+	fmt.Fprintf(&b, "}\n")
+	return b.String()
+}
+
+// Election phases
+const (
+	PhaseFollower     Phase = "follower"
+	PhasePreCandidate Phase = "pre-candidate"
+	PhaseCandidate    Phase = "candidate"
+	PhaseLeader       Phase = "leader"
+)
+
+// ElectionFSM is the table Election drives each node's phase through
+var ElectionFSM = &FSM{
+	Name:    "election",
+	Initial: PhaseFollower,
+	Transitions: []Transition{
+		{PhaseFollower, "timeout", PhaseCandidate},
+		{PhaseFollower, "timeout-prevote", PhasePreCandidate},
+		{PhaseFollower, "sticky-wait", PhaseFollower},
+		{PhaseFollower, "elected", PhaseLeader},
+		{PhasePreCandidate, "prevote-denied", PhaseFollower},
+		{PhasePreCandidate, "prevote-granted", PhaseCandidate},
+		{PhaseCandidate, "elected", PhaseLeader},
+		{PhaseCandidate, "view-established", PhaseFollower},
+		{PhaseCandidate, "election-failed", PhaseFollower},
+		{PhaseLeader, "higher-view", PhaseFollower},
+		{PhaseLeader, "elected", PhaseLeader},
+	},
+}
+
+// StateMachines are the tables rendered by `wahello fsm`
+var StateMachines = []*FSM{ElectionFSM}
+
+// FSMCommand implements `wahello fsm [-o file]`, writing the DOT diagrams
+func FSMCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("fsm", flag.ContinueOnError)
+	output := flags.String("o", "", "write the diagrams to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("// Code generated by `wahello fsm`; DO NOT EDIT.\n")
+	for _, machine := range StateMachines {
+		b.WriteString(machine.DOT())
+	}
+	if *output == "" {
+		_, err := io.WriteString(stdout, b.String())
+		return err
+	}
+	return os.WriteFile(*output, []byte(b.String()), 0o644)
+}
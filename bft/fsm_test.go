@@ -0,0 +1,71 @@
+package bft
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestFSMDocsUpToDate tests that the checked-in diagrams match the tables
+func TestFSMDocsUpToDate(t *testing.T) {
+	want, err := os.ReadFile("../docs/election_fsm.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := FSMCommand(nil, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("Expected docs/election_fsm.dot to match the code; run go generate")
+	}
+}
+
+// TestFSMNext tests table lookups and undefined transitions
+func TestFSMNext(t *testing.T) {
+	if to, ok := ElectionFSM.Next(PhasePreCandidate, "prevote-granted"); !ok || to != PhaseCandidate {
+		t.Errorf("Expected pre-candidate to become candidate, got %s", to)
+	}
+	if _, ok := ElectionFSM.Next(PhaseFollower, "prevote-granted"); ok {
+		t.Errorf("Expected no transition for a follower on prevote-granted")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected MustNext to panic on an undefined transition")
+		}
+	}()
+	ElectionFSM.MustNext(PhaseLeader, "timeout")
+}
+
+// TestElectionPhases tests that elections move nodes through the table
+func TestElectionPhases(t *testing.T) {
+	system, err := newChaosRun().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	election := NewElection(system, ElectionConfig{Timeout: 2, PreVote: true})
+	if election.Phase("A") != PhaseLeader || election.Phase("B") != PhaseFollower {
+		t.Fatalf("Expected A to start as leader and B as follower")
+	}
+
+	system.SetPartition("A", true)
+	for i := 0; i < 6 && system.GetLeader() == "A"; i++ {
+		election.Tick()
+	}
+	for i := 0; i < 6 && system.GetLeader() == ""; i++ {
+		election.Tick()
+	}
+	leader := system.GetLeader()
+	if leader == "" || leader == "A" {
+		t.Fatalf("Expected a new leader, got %q", leader)
+	}
+	leaders := 0
+	for _, id := range []string{"A", "B", "C", "D", "E"} {
+		if election.Phase(id) == PhaseLeader {
+			leaders++
+		}
+	}
+	if election.Phase(leader) != PhaseLeader || leaders != 1 {
+		t.Errorf("Expected only %s in the leader phase, got %d leaders", leader, leaders)
+	}
+}
@@ -0,0 +1,176 @@
+package bft
+
+import "sync"
+
+// Adaptive gossip.
+//
+// Without adaptation every reachable node gossips a fresh clock update to
+// every neighbor each round, however little has changed. With an
+// AdaptiveGossip each direction of a link has its own interval, in rounds.
+// When a link is due the sender measures how far the receiver's clock lags
+// its own: the receiver's entry for the sender against the sender's
+// current timestamp, the part of the two clock digests an update can
+// close. A link without lag has converged and is skipped, its interval
+// doubling up to MaxInterval. A link lagging by at most Tolerance gets the
+// update at its current pace. A link lagging further, or whose receiver
+// never heard of the sender, gets the update and drops back to
+// MinInterval. A receiver that is out of reach is not measured; its link
+// is due the round it comes back and starts over at MinInterval, since
+// both sides moved on while the partition lasted.
+
+const (
+	DefaultMinGossipInterval = 1
+	DefaultMaxGossipInterval = 8
+)
+
+// GossipStats count what adaptive gossip did
+type GossipStats struct {
+	Rounds   int
+	Sent     int // Updates sent over links
+	Skipped  int // Links not due or converged in a round
+	Backoffs int // Intervals doubled on converged links
+	Speedups int // Intervals reset on links found far behind or healed
+}
+
+// AdaptiveGossip paces gossip on every link by how far behind it is
+type AdaptiveGossip struct {
+	MinInterval int   // Rounds between updates on a lagging link
+	MaxInterval int   // Rounds between checks of a converged link
+	Tolerance   int64 // Lag, in timestamp units, caught up at the current pace
+	Stats       GossipStats
+	Lock        sync.Mutex
+	round       int
+	links       map[[2]string]*gossipLink
+}
+
+// gossipLink is the pace of one direction of a link
+type gossipLink struct {
+	interval int
+	due      int  // Round of the next check
+	cut      bool // Whether the receiver was out of reach when last due
+}
+
+// NewAdaptiveGossip creates adaptive gossip with the default intervals
+// tolerating a lag of one timestamp unit
+func NewAdaptiveGossip() *AdaptiveGossip {
+	return &AdaptiveGossip{
+		MinInterval: DefaultMinGossipInterval,
+		MaxInterval: DefaultMaxGossipInterval,
+		Tolerance:   1,
+		links:       make(map[[2]string]*gossipLink),
+	}
+}
+
+// clone returns adaptive gossip at the same pace on every link
+func (g *AdaptiveGossip) clone() *AdaptiveGossip {
+	if g == nil {
+		return nil
+	}
+	g.Lock.Lock()
+	defer g.Lock.Unlock()
+	clone := &AdaptiveGossip{MinInterval: g.MinInterval, MaxInterval: g.MaxInterval, Tolerance: g.Tolerance,
+		Stats: g.Stats, round: g.round, links: make(map[[2]string]*gossipLink, len(g.links))}
+	for direction, link := range g.links {
+		copied := *link
+		clone.links[direction] = &copied
+	}
+	return clone
+}
+
+// Interval returns the current interval of the link from one node to
+// another
+func (g *AdaptiveGossip) Interval(from, to string) int {
+	g.Lock.Lock()
+	defer g.Lock.Unlock()
+	return g.link(from, to).interval
+}
+
+// link returns the pace of a link direction, due now if new. The caller
+// must hold g.Lock.
+func (g *AdaptiveGossip) link(from, to string) *gossipLink {
+	if g.links == nil {
+		g.links = make(map[[2]string]*gossipLink)
+	}
+	link := g.links[[2]string{from, to}]
+	if link == nil {
+		link = &gossipLink{interval: max(g.MinInterval, 1), due: g.round}
+		g.links[[2]string{from, to}] = link
+	}
+	return link
+}
+
+// ClockLag returns how far behind the clock of one node the entry another
+// node keeps for it is, and whether it keeps one at all
+func (s *System) ClockLag(from, to string) (int64, bool) {
+	s.Lock.RLock()
+	sender, receiver := s.Nodes[from], s.Nodes[to]
+	s.Lock.RUnlock()
+	if sender == nil || receiver == nil {
+		return 0, false
+	}
+	sender.Lock.RLock()
+	now := sender.wallClock()
+	sender.Lock.RUnlock()
+	receiver.Lock.RLock()
+	seen, known := receiver.VectorClock.Timestamps()[from]
+	receiver.Lock.RUnlock()
+	return now - seen, known
+}
+
+// due measures the links of a node that are due this round, adapts their
+// intervals, and returns the neighbors to send an update to
+func (g *AdaptiveGossip) due(s *System, node *Node) map[string]bool {
+	node.Lock.RLock()
+	neighbors := append([]string(nil), node.Neighbors...)
+	node.Lock.RUnlock()
+
+	g.Lock.Lock()
+	defer g.Lock.Unlock()
+	targets := make(map[string]bool)
+	for _, id := range neighbors {
+		link := g.link(node.ID, id)
+		if s.IsPartitioned(id) || s.IsFenced(id) || s.IsSevered(node.ID, id) {
+			link.cut, link.due = true, g.round
+			continue
+		}
+		if g.round < link.due {
+			g.Stats.Skipped++
+			continue
+		}
+		lag, known := s.ClockLag(node.ID, id)
+		switch {
+		case !link.cut && known && lag <= 0:
+			if link.interval < g.MaxInterval {
+				link.interval = min(2*link.interval, g.MaxInterval)
+				g.Stats.Backoffs++
+			}
+			g.Stats.Skipped++
+		case !link.cut && known && lag <= g.Tolerance:
+			targets[id] = true
+			g.Stats.Sent++
+		default:
+			// Far behind, or back after a partition: catch up at full pace
+			if link.interval > max(g.MinInterval, 1) {
+				link.interval = max(g.MinInterval, 1)
+				g.Stats.Speedups++
+			}
+			link.cut = false
+			targets[id] = true
+			g.Stats.Sent++
+		}
+		link.due = g.round + link.interval
+	}
+	return targets
+}
+
+// endRound moves on to the next round. Without adaptive gossip it does
+// nothing.
+func (g *AdaptiveGossip) endRound() {
+	if g == nil {
+		return
+	}
+	g.Lock.Lock()
+	defer g.Lock.Unlock()
+	g.round++
+	g.Stats.Rounds++
+}
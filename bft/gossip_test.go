@@ -0,0 +1,75 @@
+package bft
+
+import "testing"
+
+// newGossipSystem creates a fully connected four-node cluster on a scheduler
+func newGossipSystem(t *testing.T, gossip *AdaptiveGossip) *System {
+	system := newWorkloadSystem(t, 1)
+	connectAll(system)
+	system.Metrics = NewMetrics()
+	system.Gossip = gossip
+	return system
+}
+
+// TestAdaptiveGossipBacksOff tests that converged links back off to the longest interval and send less than fixed gossip
+func TestAdaptiveGossipBacksOff(t *testing.T) {
+	fixed, adaptive := newGossipSystem(t, nil), newGossipSystem(t, NewAdaptiveGossip())
+	for _, system := range []*System{fixed, adaptive} {
+		NewSimulation(system).Advance(20)
+	}
+	if interval := adaptive.Gossip.Interval("A", "B"); interval != DefaultMaxGossipInterval {
+		t.Errorf("Expected a converged link to back off to %d rounds, got %d", DefaultMaxGossipInterval, interval)
+	}
+	sentFixed := fixed.Metrics.Count(metricSent.name, "clock-update")
+	sentAdaptive := adaptive.Metrics.Count(metricSent.name, "clock-update")
+	if sentAdaptive*4 > sentFixed {
+		t.Errorf("Expected adaptive gossip to send under a quarter of %.0f updates, sent %.0f", sentFixed, sentAdaptive)
+	}
+	if stats := adaptive.Gossip.Stats; stats.Rounds != 20 || stats.Sent != int(sentAdaptive) || stats.Backoffs == 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if lag, known := adaptive.ClockLag("A", "B"); !known || lag != 0 {
+		t.Errorf("Expected B to be caught up with A, lag %d known %v", lag, known)
+	}
+}
+
+// TestAdaptiveGossipSpeedsUpAfterHeal tests that links to a partitioned node are caught up at full pace once it heals
+func TestAdaptiveGossipSpeedsUpAfterHeal(t *testing.T) {
+	system := newGossipSystem(t, NewAdaptiveGossip())
+	sim := NewSimulation(system)
+	sim.Advance(10)
+	if err := system.CreatePartition([]string{"D"}); err != nil {
+		t.Fatal(err)
+	}
+	sim.Advance(3)
+	if interval := system.Gossip.Interval("A", "D"); interval != DefaultMaxGossipInterval {
+		t.Errorf("Expected the cut link to keep its interval while partitioned, got %d", interval)
+	}
+	system.HealPartition()
+	sim.Advance(1)
+	if interval := system.Gossip.Interval("A", "D"); interval != DefaultMinGossipInterval {
+		t.Errorf("Expected the healed link to speed up to %d round, got %d", DefaultMinGossipInterval, interval)
+	}
+	if system.Gossip.Stats.Speedups == 0 {
+		t.Errorf("Expected speedups after healing, got %+v", system.Gossip.Stats)
+	}
+}
+
+// TestAdaptiveGossipClone tests that a clone paces its links independently
+func TestAdaptiveGossipClone(t *testing.T) {
+	system := newGossipSystem(t, NewAdaptiveGossip())
+	NewSimulation(system).Advance(10)
+	clone := system.Clone()
+	if clone.Gossip == system.Gossip || clone.Gossip.Interval("A", "B") != system.Gossip.Interval("A", "B") {
+		t.Fatal("Expected a copy of the gossip pace")
+	}
+	clone.Gossip.links[[2]string{"A", "B"}].interval = 1
+	if system.Gossip.Interval("A", "B") == 1 {
+		t.Error("Expected the original's links to be unaffected by the clone")
+	}
+	var none *AdaptiveGossip
+	none.endRound()
+	if none.clone() != nil {
+		t.Error("Expected no gossip to clone to none")
+	}
+}
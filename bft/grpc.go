@@ -0,0 +1,175 @@
+package bft
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gRPC transport.
+//
+// Cluster nodes call each other over gRPC, with the service in
+// docs/cluster.proto. Rather than pulling in grpc-go and generated stubs,
+// this speaks the wire protocol directly on net/http: a unary call is an
+// HTTP/2 POST to /<package>.<Service>/<Method> over cleartext (h2c), whose
+// body is one length-prefixed message in the protobuf encoding the message
+// codecs already produce, and whose outcome is the grpc-status trailer.
+// Compression, streaming and deadlines are not supported; any gRPC client
+// calling the methods here unary and uncompressed is understood.
+
+var ErrGRPC = errors.New("gRPC call failed")
+
+const (
+	// grpcContentType is the content type of gRPC requests and responses
+	grpcContentType = "application/grpc"
+	// grpcMaxMessage bounds a received message, as gRPC's default does
+	grpcMaxMessage = 4 << 20
+
+	// gRPC status codes
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcInternal        = 13
+	grpcUnimplemented   = 12
+
+	// grpcPropagateClockUpdate is the method nodes send clock updates with
+	grpcPropagateClockUpdate = "/wahello.Clock/PropagateClockUpdate"
+)
+
+// grpcError is a non-OK gRPC status
+type grpcError struct {
+	Code    int
+	Message string
+}
+
+func (e *grpcError) Error() string {
+	return fmt.Sprintf("grpc-status %d: %s", e.Code, e.Message)
+}
+
+// writeGRPCFrame writes data as one uncompressed length-prefixed message
+func writeGRPCFrame(w io.Writer, data []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(data)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readGRPCFrame reads one length-prefixed message
+func readGRPCFrame(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed messages are not supported"}
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > grpcMaxMessage {
+		return nil, &grpcError{grpcInvalidArgument, fmt.Sprintf("message of %d bytes exceeds %d", length, grpcMaxMessage)}
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// grpcUnary serves a unary method taking a request newRequest allocates and
+// returning an empty message once handle accepts it
+func grpcUnary[M encoding.BinaryUnmarshaler](newRequest func() M, handle func(M) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), grpcContentType) {
+			http.Error(w, "gRPC needs HTTP/2 and "+grpcContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", grpcContentType)
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		err := func() error {
+			data, err := readGRPCFrame(r.Body)
+			if err != nil {
+				return err
+			}
+			request := newRequest()
+			if err := request.UnmarshalBinary(data); err != nil {
+				return &grpcError{grpcInvalidArgument, err.Error()}
+			}
+			return handle(request)
+		}()
+		if err != nil {
+			status, ok := err.(*grpcError)
+			if !ok {
+				status = &grpcError{grpcInternal, err.Error()}
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Grpc-Status", strconv.Itoa(status.Code))
+			w.Header().Set("Grpc-Message", status.Message)
+			return
+		}
+		writeGRPCFrame(w, nil)
+		w.Header().Set("Grpc-Status", strconv.Itoa(grpcOK))
+	}
+}
+
+// newGRPCClient returns a client calling over cleartext HTTP/2, giving up
+// on a call after timeout
+func newGRPCClient(timeout time.Duration) *http.Client {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Timeout: timeout, Transport: &http.Transport{Protocols: protocols}}
+}
+
+// grpcProtocols are what a node's server speaks: HTTP/1 for the launcher's
+// status requests and cleartext HTTP/2 for gRPC
+func grpcProtocols() *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return protocols
+}
+
+// grpcCall makes a unary call of method on the server at addr, discarding
+// its empty reply
+func grpcCall(client *http.Client, addr, method string, request encoding.BinaryMarshaler) error {
+	data, err := request.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	writeGRPCFrame(&body, data)
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+method, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", grpcContentType)
+	req.Header.Set("TE", "trailers")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrGRPC, method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s: %s", ErrGRPC, method, resp.Status)
+	}
+	// Trailers arrive after the body
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrGRPC, method, err)
+	}
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != strconv.Itoa(grpcOK) {
+		message := resp.Trailer.Get("Grpc-Message")
+		return fmt.Errorf("%w: %s: grpc-status %s: %s", ErrGRPC, method, status, message)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package bft
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// serveGRPC serves handler for method on a loopback port until the test ends
+func serveGRPC(t *testing.T, method string, handler http.HandlerFunc) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+method, handler)
+	server := &http.Server{Handler: mux, Protocols: grpcProtocols()}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+// TestGRPCCall tests that a unary call carries its message and status
+func TestGRPCCall(t *testing.T) {
+	received := make(chan *ClockUpdate, 1)
+	addr := serveGRPC(t, grpcPropagateClockUpdate, grpcUnary(func() *ClockUpdate { return new(ClockUpdate) }, func(update *ClockUpdate) error {
+		if update.NodeID == "Z" {
+			return &grpcError{grpcInvalidArgument, "unknown node"}
+		}
+		received <- update
+		return nil
+	}))
+	client := newGRPCClient(time.Second)
+
+	sent := &ClockUpdate{NodeID: "A", Timestamp: 7, Signature: "sig", Seq: 3, Nonce: "n"}
+	if err := grpcCall(client, addr, grpcPropagateClockUpdate, sent); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; *got != *sent {
+		t.Errorf("Expected %+v, got %+v", sent, got)
+	}
+	if err := grpcCall(client, addr, grpcPropagateClockUpdate, &ClockUpdate{NodeID: "Z"}); !errors.Is(err, ErrGRPC) {
+		t.Errorf("Expected a rejected update to fail the call, got %v", err)
+	}
+	if err := grpcCall(client, addr, "/wahello.Clock/Missing", sent); !errors.Is(err, ErrGRPC) {
+		t.Errorf("Expected an unknown method to fail the call, got %v", err)
+	}
+
+	resp, err := http.Post("http://"+addr+grpcPropagateClockUpdate, grpcContentType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected HTTP/1 to be refused, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,169 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Peer handshake.
+//
+// When two nodes first talk they exchange their capabilities and agree on a
+// clock type, codec, compression and signature scheme: for each, the first
+// preference of the node with the lower ID that the other also supports.
+// Both sides negotiate on their own, so they must pick by the same rule to
+// reach the same agreement whichever of them connected. A pair with nothing
+// in common on any of them, or speaking different protocol versions, is
+// refused on connection with an error naming what did not match, rather than
+// failing later when a message cannot be decoded or a signature cannot be
+// checked.
+
+// ProtocolVersion is the version of the wire protocol nodes speak
+const ProtocolVersion = 1
+
+var ErrIncompatiblePeer = errors.New("incompatible peer")
+
+// Capabilities lists what a node supports, most preferred first
+type Capabilities struct {
+	ProtocolVersion  int
+	ClockTypes       []string
+	Codecs           []string
+	Compression      []string
+	SignatureSchemes []string
+}
+
+// DefaultCapabilities returns what nodes support unless configured otherwise
+func DefaultCapabilities() *Capabilities {
+	return &Capabilities{
+		ProtocolVersion:  ProtocolVersion,
+		ClockTypes:       []string{"vector"},
+		Codecs:           []string{"json"},
+		Compression:      []string{"none"},
+		SignatureSchemes: []string{string(crypto.SchemeECDSA)},
+	}
+}
+
+// Agreement is the set of choices two peers settled on
+type Agreement struct {
+	ClockType       string
+	Codec           string
+	Compression     string
+	SignatureScheme string
+}
+
+// IncompatibilityError explains why a handshake failed
+type IncompatibilityError struct {
+	Local  string
+	Remote string
+	Field  string
+	Ours   []string
+	Theirs []string
+}
+
+func (e *IncompatibilityError) Error() string {
+	return fmt.Sprintf("%v: %s and %s share no %s (%s offers [%s], %s offers [%s])",
+		ErrIncompatiblePeer, e.Local, e.Remote, e.Field,
+		e.Local, strings.Join(e.Ours, " "), e.Remote, strings.Join(e.Theirs, " "))
+}
+
+func (e *IncompatibilityError) Unwrap() error {
+	return ErrIncompatiblePeer
+}
+
+// choose returns the first of ours that theirs also offers
+func choose(ours, theirs []string) (string, bool) {
+	for _, option := range ours {
+		for _, other := range theirs {
+			if option == other {
+				return option, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Negotiate agrees on the settings local should use with remote, following
+// the preferences of the peer with the lower ID, so remote negotiating with
+// local agrees on the same
+func Negotiate(localID string, local *Capabilities, remoteID string, remote *Capabilities) (*Agreement, error) {
+	if local.ProtocolVersion != remote.ProtocolVersion {
+		return nil, &IncompatibilityError{
+			Local: localID, Remote: remoteID, Field: "protocol version",
+			Ours:   []string{fmt.Sprint(local.ProtocolVersion)},
+			Theirs: []string{fmt.Sprint(remote.ProtocolVersion)},
+		}
+	}
+	agreement := &Agreement{}
+	fields := []struct {
+		name   string
+		ours   []string
+		theirs []string
+		chosen *string
+	}{
+		{"clock type", local.ClockTypes, remote.ClockTypes, &agreement.ClockType},
+		{"codec", local.Codecs, remote.Codecs, &agreement.Codec},
+		{"compression", local.Compression, remote.Compression, &agreement.Compression},
+		{"signature scheme", local.SignatureSchemes, remote.SignatureSchemes, &agreement.SignatureScheme},
+	}
+	for _, field := range fields {
+		option, ok := choose(field.ours, field.theirs)
+		if remoteID < localID {
+			option, ok = choose(field.theirs, field.ours)
+		}
+		if !ok {
+			return nil, &IncompatibilityError{
+				Local: localID, Remote: remoteID, Field: field.name,
+				Ours: field.ours, Theirs: field.theirs,
+			}
+		}
+		*field.chosen = option
+	}
+	return agreement, nil
+}
+
+// capabilities returns what a node supports, by default signing with the
+// scheme of its key only
+func (n *Node) capabilities() *Capabilities {
+	if n.Capabilities != nil {
+		return n.Capabilities
+	}
+	capabilities := DefaultCapabilities()
+	if scheme := crypto.SchemeOf(n.PublicKey); scheme != "" {
+		capabilities.SignatureSchemes = []string{string(scheme)}
+	}
+	return capabilities
+}
+
+// handshakeResult is the cached outcome of a handshake between two nodes
+type handshakeResult struct {
+	agreement *Agreement
+	err       error
+}
+
+// Handshake connects from to to, negotiating on first contact and reusing
+// the outcome afterwards. Capabilities are configuration, set before nodes
+// start talking, so they are read without the nodes' locks.
+func (s *System) Handshake(from, to *Node) (*Agreement, error) {
+	key := [2]string{from.ID, to.ID}
+	s.Lock.RLock()
+	result, done := s.handshakes[key]
+	s.Lock.RUnlock()
+	if done {
+		return result.agreement, result.err
+	}
+
+	agreement, err := Negotiate(from.ID, from.capabilities(), to.ID, to.capabilities())
+
+	s.Lock.Lock()
+	if s.handshakes == nil {
+		s.handshakes = make(map[[2]string]handshakeResult)
+	}
+	s.handshakes[key] = handshakeResult{agreement, err}
+	s.Lock.Unlock()
+	if err != nil {
+		s.trace(TraceEvent{Type: EventReject, Node: from.ID, Peer: to.ID, Detail: err.Error()})
+	}
+	return agreement, err
+}
@@ -0,0 +1,95 @@
+package bft
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestNegotiate tests that two peers settle on the preferences of the one
+// with the lower ID among the options they share, whichever side negotiates
+func TestNegotiate(t *testing.T) {
+	local := DefaultCapabilities()
+	local.Codecs = []string{"protobuf", "json"}
+	local.Compression = []string{"zstd", "none"}
+
+	remote := DefaultCapabilities()
+	remote.Codecs = []string{"json", "protobuf"}
+
+	agreement, err := Negotiate("A", local, "B", remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agreement.Codec != "protobuf" || agreement.Compression != "none" || agreement.ClockType != "vector" {
+		t.Errorf("Expected A's preferences among shared options, got %+v", agreement)
+	}
+	reverse, err := Negotiate("B", remote, "A", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *reverse != *agreement {
+		t.Errorf("Expected B to agree on %+v with A, got %+v", agreement, reverse)
+	}
+}
+
+// TestNegotiateRefusesIncompatiblePeers tests diagnostic handshake errors
+func TestNegotiateRefusesIncompatiblePeers(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Capabilities)
+		field  string
+	}{
+		{"version", func(c *Capabilities) { c.ProtocolVersion = 2 }, "protocol version"},
+		{"clock", func(c *Capabilities) { c.ClockTypes = []string{"hybrid-logical"} }, "clock type"},
+		{"signature", func(c *Capabilities) { c.SignatureSchemes = []string{"ed25519"} }, "signature scheme"},
+	}
+	for _, tt := range tests {
+		remote := DefaultCapabilities()
+		tt.modify(remote)
+		_, err := Negotiate("A", DefaultCapabilities(), "F", remote)
+		var incompatible *IncompatibilityError
+		if !errors.As(err, &incompatible) || !errors.Is(err, ErrIncompatiblePeer) {
+			t.Errorf("%s: Expected IncompatibilityError, got %v", tt.name, err)
+			continue
+		}
+		if incompatible.Field != tt.field || !strings.Contains(err.Error(), "F offers") {
+			t.Errorf("%s: Expected diagnostic naming %s, got %v", tt.name, tt.field, err)
+		}
+	}
+}
+
+// TestIncompatiblePeerIsRefused tests that propagation skips refused peers
+func TestIncompatiblePeerIsRefused(t *testing.T) {
+	system, err := newChaosRun().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	system.Trace = NewTrace()
+	caps := DefaultCapabilities()
+	caps.ClockTypes = []string{"hybrid-logical"}
+	system.Nodes["E"].Capabilities = caps
+
+	sender := system.Nodes["A"]
+	update := sender.GetClockUpdate()
+	sender.PropagateClockUpdate(update, system)
+
+	if system.Nodes["E"].VectorClock.GetTimestamp("A") != 0 {
+		t.Errorf("Expected incompatible peer not to receive the update")
+	}
+	if system.Nodes["B"].VectorClock.GetTimestamp("A") != update.Timestamp {
+		t.Errorf("Expected compatible peer to receive the update")
+	}
+	if _, err := system.Handshake(sender, system.Nodes["E"]); !errors.Is(err, ErrIncompatiblePeer) {
+		t.Errorf("Expected cached handshake failure, got %v", err)
+	}
+
+	rejects := 0
+	for _, event := range system.Trace.Snapshot() {
+		if event.Type == EventReject && event.Peer == "E" {
+			rejects++
+		}
+	}
+	if rejects != 1 {
+		t.Errorf("Expected the refusal to be traced once, got %d", rejects)
+	}
+}
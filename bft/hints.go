@@ -0,0 +1,200 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Partition-aware routing hints.
+//
+// When a replica cannot route a request to the leader it says why: its
+// error carries the leader and view it last knew and the peers it can still
+// reach. A client on the far side of a partition learns from a single reply
+// that the leader is out of reach, and instead of retrying a request that
+// cannot succeed it fails fast, or, for reads where it accepts staleness,
+// falls back to the replica it can talk to.
+
+var ErrPartitioned = errors.New("leader unreachable from client's partition")
+
+// RoutingHint is a replica's view of where requests should go
+type RoutingHint struct {
+	From      string   // Replica that produced the hint
+	Leader    string   // Leader the replica knows, empty if none
+	View      int64    // View the leader was set in
+	Reachable []string // Peers the replica can exchange messages with, itself included
+}
+
+// LeaderReachable reports whether the hinting replica can reach the leader
+func (h *RoutingHint) LeaderReachable() bool {
+	for _, id := range h.Reachable {
+		if id == h.Leader {
+			return true
+		}
+	}
+	return false
+}
+
+// RoutingError is a routing failure annotated with the replica's hint
+type RoutingError struct {
+	Err  error
+	Hint *RoutingHint
+}
+
+func (e *RoutingError) Error() string {
+	return fmt.Sprintf("%v (leader %q in view %d, %s reaches %v)", e.Err, e.Hint.Leader, e.Hint.View, e.Hint.From, e.Hint.Reachable)
+}
+
+func (e *RoutingError) Unwrap() error {
+	return e.Err
+}
+
+// HintFrom extracts the routing hint from an error, if it has one
+func HintFrom(err error) (*RoutingHint, bool) {
+	var routing *RoutingError
+	if errors.As(err, &routing) {
+		return routing.Hint, true
+	}
+	return nil, false
+}
+
+// hinted wraps err with contact's routing hint. An isolated contact reaches
+// only itself. The caller must hold s.Lock.
+func (s *System) hinted(contact *Node, err error) error {
+	hint := &RoutingHint{From: contact.ID, Leader: s.Leader, View: s.View}
+	if !s.reachable(contact) {
+		hint.Reachable = []string{contact.ID}
+	} else {
+		for _, id := range sortedKeys(s.Nodes) {
+			if s.reachable(s.Nodes[id]) {
+				hint.Reachable = append(hint.Reachable, id)
+			}
+		}
+	}
+	return &RoutingError{Err: err, Hint: hint}
+}
+
+// LocalRead serves a read from nodeID's own store without contacting the
+// leader, labelled with how far it lags
+func (s *System) LocalRead(clientRegion, nodeID, key string) (result *ReadResult, err error) {
+	op := s.recordInvoke(clientRegion, OpRead, key, "")
+	defer func() {
+		if err != nil {
+			s.recordComplete(op, "", 0, false)
+		} else {
+			s.recordComplete(op, result.Value, result.Index, true)
+		}
+	}()
+
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	node, exists := s.Nodes[nodeID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, nodeID)
+	}
+
+	node.Lock.RLock()
+	entry := node.Store.Entries[key]
+	index := node.Store.CommitIndex
+	value, err := node.plaintext(entry)
+	node.Lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result = &ReadResult{
+		Key:      key,
+		Value:    value,
+		Index:    entry.Index,
+		ServedBy: node.ID,
+		Latency:  2 * s.regionLatency(clientRegion, node.Region),
+	}
+	if leader, exists := s.Nodes[s.Leader]; exists {
+		leader.Lock.RLock()
+		result.Staleness = leader.Store.CommitIndex - index
+		leader.Lock.RUnlock()
+	}
+	if result.Staleness < 0 {
+		result.Staleness = 0
+	}
+	result.Label = stalenessLabel(result.Staleness)
+	return result, nil
+}
+
+// RoutingStats counts what a client did with the hints it received
+type RoutingStats struct {
+	Attempts   int
+	FailedFast int
+	StaleReads int
+}
+
+// RoutingClient sends requests to one contact replica. Without hints it
+// retries failed requests up to MaxAttempts times; with UseHints it stops
+// as soon as a hint shows the leader is out of reach.
+type RoutingClient struct {
+	System      *System
+	Region      string
+	Contact     string
+	UseHints    bool
+	AllowStale  bool // Fall back to the contact's local state for reads
+	MaxAttempts int
+	Hint        *RoutingHint // Latest hint received
+	Stats       RoutingStats
+}
+
+// Write submits a write through the contact
+func (c *RoutingClient) Write(key, value string) (*WriteResult, error) {
+	var err error
+	for attempt := 0; attempt < c.attempts(); attempt++ {
+		c.Stats.Attempts++
+		var result *WriteResult
+		if result, err = c.System.SubmitWrite(c.Region, c.Contact, key, value); err == nil {
+			return result, nil
+		}
+		if c.partitioned(err) {
+			c.Stats.FailedFast++
+			return nil, fmt.Errorf("%w: %w", ErrPartitioned, err)
+		}
+	}
+	return nil, err
+}
+
+// Read reads key linearizably through the contact, falling back to a stale
+// local read when the leader is out of reach and AllowStale is set
+func (c *RoutingClient) Read(key string) (*ReadResult, error) {
+	var err error
+	for attempt := 0; attempt < c.attempts(); attempt++ {
+		c.Stats.Attempts++
+		var result *ReadResult
+		if result, err = c.System.ReadIndex(c.Region, c.Contact, key); err == nil {
+			return result, nil
+		}
+		if !c.partitioned(err) {
+			continue
+		}
+		if c.AllowStale {
+			c.Stats.StaleReads++
+			return c.System.LocalRead(c.Region, c.Contact, key)
+		}
+		c.Stats.FailedFast++
+		return nil, fmt.Errorf("%w: %w", ErrPartitioned, err)
+	}
+	return nil, err
+}
+
+// partitioned records err's hint and reports whether it rules out reaching
+// the leader
+func (c *RoutingClient) partitioned(err error) bool {
+	hint, ok := HintFrom(err)
+	if !ok || !c.UseHints {
+		return false
+	}
+	c.Hint = hint
+	return !hint.LeaderReachable()
+}
+
+func (c *RoutingClient) attempts() int {
+	if c.MaxAttempts < 1 {
+		return 1
+	}
+	return c.MaxAttempts
+}
@@ -0,0 +1,78 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestRoutingHintOnPartition tests that a partitioned replica's error names the leader it cannot reach
+func TestRoutingHintOnPartition(t *testing.T) {
+	system := newGeoSystem(t)
+	system.SetPartition("D", true)
+
+	_, err := system.SubmitWrite("eu-west", "D", "x", "1")
+	if !errors.Is(err, ErrNodeUnreachable) {
+		t.Fatalf("Expected ErrNodeUnreachable, got %v", err)
+	}
+	hint, ok := HintFrom(err)
+	if !ok {
+		t.Fatalf("Expected a routing hint in %v", err)
+	}
+	if hint.Leader != "A" || hint.View != 1 || len(hint.Reachable) != 1 || hint.Reachable[0] != "D" {
+		t.Errorf("Expected D to report leader A in view 1 and reach only itself, got %+v", hint)
+	}
+	if hint.LeaderReachable() {
+		t.Errorf("Expected the leader to be unreachable from D")
+	}
+}
+
+// TestHintedClientFailsFast tests that a client stops retrying once a hint shows the leader is out of reach
+func TestHintedClientFailsFast(t *testing.T) {
+	system := newGeoSystem(t)
+	system.SetPartition("D", true)
+
+	blind := &RoutingClient{System: system, Region: "eu-west", Contact: "D", MaxAttempts: 3}
+	if _, err := blind.Write("x", "1"); err == nil || errors.Is(err, ErrPartitioned) {
+		t.Errorf("Expected a plain routing failure without hints, got %v", err)
+	}
+	if blind.Stats.Attempts != 3 {
+		t.Errorf("Expected the client without hints to use all 3 attempts, got %d", blind.Stats.Attempts)
+	}
+
+	hinted := &RoutingClient{System: system, Region: "eu-west", Contact: "D", MaxAttempts: 3, UseHints: true}
+	if _, err := hinted.Write("x", "1"); !errors.Is(err, ErrPartitioned) {
+		t.Errorf("Expected ErrPartitioned, got %v", err)
+	}
+	if hinted.Stats.Attempts != 1 || hinted.Stats.FailedFast != 1 {
+		t.Errorf("Expected one attempt that failed fast, got %+v", hinted.Stats)
+	}
+}
+
+// TestHintedClientStaleFallback tests that reads fall back to the local replica when allowed
+func TestHintedClientStaleFallback(t *testing.T) {
+	system := newGeoSystem(t)
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	system.SetPartition("D", true)
+	if _, err := system.SubmitWrite("us-east", "A", "x", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	strict := &RoutingClient{System: system, Region: "eu-west", Contact: "D", UseHints: true}
+	if _, err := strict.Read("x"); !errors.Is(err, ErrPartitioned) {
+		t.Errorf("Expected a strict read to fail fast, got %v", err)
+	}
+
+	stale := &RoutingClient{System: system, Region: "eu-west", Contact: "D", UseHints: true, AllowStale: true}
+	read, err := stale.Read("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Value != "1" || read.ServedBy != "D" || read.Staleness != 1 || read.Label != "stale by 1 entries" {
+		t.Errorf("Expected the stale value 1 from D one entry behind, got %+v", read)
+	}
+	if stale.Stats.StaleReads != 1 {
+		t.Errorf("Expected one stale read, got %+v", stale.Stats)
+	}
+}
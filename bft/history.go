@@ -0,0 +1,128 @@
+package bft
+
+import (
+	"sync"
+	"time"
+)
+
+// OpKind is the kind of a recorded client operation
+type OpKind string
+
+const (
+	OpRead  OpKind = "read"
+	OpWrite OpKind = "write"
+	OpClock OpKind = "clock" // A clock update ordered on its own, see Operation
+)
+
+// HistoryOp is one client operation recorded from invocation to completion.
+// Version is the index of the entry written, or of the entry observed by a read.
+// Called and Returned order the invocation and completion among all recorded
+// events, from 1, so operations recorded at the same virtual instant keep the
+// order the clients saw them in; they are 0 when unknown.
+type HistoryOp struct {
+	ID       int
+	Client   string
+	Txn      string // Operations sharing a Txn belong to the same transaction
+	Kind     OpKind
+	Key      string
+	Value    string
+	Version  int64
+	Invoke   time.Duration
+	Complete time.Duration
+	OK       bool
+	Called   int
+	Returned int
+}
+
+// History records client operations in invocation order
+type History struct {
+	Ops    []HistoryOp
+	Now    func() time.Duration // Time source, defaults to time since creation
+	Lock   sync.Mutex
+	start  time.Time
+	events int // Invocations and completions recorded
+}
+
+// NewHistory creates an empty history
+func NewHistory() *History {
+	h := &History{start: time.Now()}
+	h.Now = func() time.Duration { return time.Since(h.start) }
+	return h
+}
+
+// Invoke records the start of an operation and returns its ID
+func (h *History) Invoke(client, txn string, kind OpKind, key, value string) int {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	op := HistoryOp{
+		ID:     len(h.Ops),
+		Client: client,
+		Txn:    txn,
+		Kind:   kind,
+		Key:    key,
+		Value:  value,
+		Invoke: h.Now(),
+		Called: h.next(),
+	}
+	h.Ops = append(h.Ops, op)
+	return op.ID
+}
+
+// Complete records the outcome of a previously invoked operation
+func (h *History) Complete(id int, value string, version int64, ok bool) {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	op := &h.Ops[id]
+	op.Complete = h.Now()
+	op.Returned = h.next()
+	op.OK = ok
+	op.Version = version
+	if op.Kind == OpRead {
+		op.Value = value
+	}
+}
+
+// next returns the position of the next recorded event. The caller must
+// hold h.Lock.
+func (h *History) next() int {
+	h.events++
+	return h.events
+}
+
+// Snapshot returns a copy of the recorded operations
+func (h *History) Snapshot() []HistoryOp {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	ops := make([]HistoryOp, len(h.Ops))
+	copy(ops, h.Ops)
+	return ops
+}
+
+// Clone returns an independent copy of the history sharing its time source
+func (h *History) Clone() *History {
+	ops := h.Snapshot()
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	return &History{Ops: ops, Now: h.Now, start: h.start, events: h.events}
+}
+
+// recordInvoke starts recording a client operation if the system keeps a history
+func (s *System) recordInvoke(clientRegion string, kind OpKind, key, value string) int {
+	return s.recordInvokeTxn(clientRegion, "", kind, key, value)
+}
+
+// recordInvokeTxn starts recording an operation that is part of transaction txn
+func (s *System) recordInvokeTxn(clientRegion, txn string, kind OpKind, key, value string) int {
+	if s.History == nil {
+		return -1
+	}
+	return s.History.Invoke("client@"+clientRegion, txn, kind, key, value)
+}
+
+// recordComplete finishes recording an operation started with recordInvoke
+func (s *System) recordComplete(id int, value string, version int64, ok bool) {
+	if s.History == nil || id < 0 {
+		return
+	}
+	s.History.Complete(id, value, version, ok)
+}
@@ -0,0 +1,366 @@
+package bft
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// SQLite history store.
+//
+// Operation histories, traces and PBFT executions can be persisted into a
+// SQLite database so that questions about a run are answered with ad-hoc
+// SQL rather than a custom parser. Every saved run gets a row in runs, and
+// its rows in the other tables carry the run's id:
+//
+//	runs     id, name, seed, recorded (RFC 3339)
+//	ops      run, id, client, txn, kind ("read" or "write"), key, value,
+//	         version, invoke_ns, complete_ns (NULL while pending), ok
+//	events   run, seq, at_ns, type, node, peer, origin, timestamp, detail;
+//	         origin and timestamp come from the clock update, if any
+//	commits  run, replica, view, seq, digest, leader, size; leader is the
+//	         primary of the view the entry was pre-prepared in
+//
+// Times are offsets in nanoseconds from the start of the run. Commits per
+// view of the entries F led, for example:
+//
+//	SELECT view, COUNT(*) FROM commits WHERE leader = 'F' GROUP BY view
+//
+// The store is a plain SQLite file, so the sqlite3 shell works on it too.
+// The driver needs cgo; builds without it, or with the purego tag, leave
+// the store out and OpenHistoryDB fails with ErrHistoryUnavailable.
+
+var (
+	ErrHistoryQuery       = errors.New("history query failed")
+	ErrHistoryUnavailable = errors.New("history store needs cgo and no purego tag")
+)
+
+// historySchema creates the tables described above
+const historySchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id       INTEGER PRIMARY KEY,
+	name     TEXT NOT NULL,
+	seed     INTEGER NOT NULL,
+	recorded TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS ops (
+	run         INTEGER NOT NULL REFERENCES runs(id),
+	id          INTEGER NOT NULL,
+	client      TEXT NOT NULL,
+	txn         TEXT NOT NULL,
+	kind        TEXT NOT NULL,
+	key         TEXT NOT NULL,
+	value       TEXT NOT NULL,
+	version     INTEGER NOT NULL,
+	invoke_ns   INTEGER NOT NULL,
+	complete_ns INTEGER,
+	ok          INTEGER NOT NULL,
+	PRIMARY KEY (run, id)
+);
+CREATE TABLE IF NOT EXISTS events (
+	run       INTEGER NOT NULL REFERENCES runs(id),
+	seq       INTEGER NOT NULL,
+	at_ns     INTEGER NOT NULL,
+	type      TEXT NOT NULL,
+	node      TEXT NOT NULL,
+	peer      TEXT NOT NULL,
+	origin    TEXT,
+	timestamp INTEGER,
+	detail    TEXT NOT NULL,
+	PRIMARY KEY (run, seq)
+);
+CREATE TABLE IF NOT EXISTS commits (
+	run     INTEGER NOT NULL REFERENCES runs(id),
+	replica TEXT NOT NULL,
+	view    INTEGER NOT NULL,
+	seq     INTEGER NOT NULL,
+	digest  TEXT NOT NULL,
+	leader  TEXT NOT NULL,
+	size    INTEGER NOT NULL,
+	PRIMARY KEY (run, replica, seq)
+);
+CREATE INDEX IF NOT EXISTS commits_leader ON commits (leader, view);
+`
+
+// HistoryDB is a SQLite database of recorded runs
+type HistoryDB struct {
+	DB *sql.DB
+}
+
+// OpenHistoryDB opens the database at path, creating it and its tables if
+// needed
+func OpenHistoryDB(path string) (*HistoryDB, error) {
+	if sqliteDriver == "" {
+		return nil, ErrHistoryUnavailable
+	}
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema in %s: %w", path, err)
+	}
+	return &HistoryDB{DB: db}, nil
+}
+
+// Close closes the database
+func (h *HistoryDB) Close() error {
+	return h.DB.Close()
+}
+
+// HistoryRun saves the records of one run in a single transaction
+type HistoryRun struct {
+	ID int64
+	tx *sql.Tx
+}
+
+// Record saves a run's history, trace and PBFT executions, whichever are
+// not nil, under name and returns the run's id
+func (h *HistoryDB) Record(name string, seed int64, history *History, trace *Trace, pbft *PBFT) (int64, error) {
+	run, err := h.Begin(name, seed)
+	if err != nil {
+		return 0, err
+	}
+	if err := run.save(history, trace, pbft); err != nil {
+		run.tx.Rollback()
+		return 0, err
+	}
+	return run.ID, run.tx.Commit()
+}
+
+// Begin adds a run and returns it for its records to be saved
+func (h *HistoryDB) Begin(name string, seed int64) (*HistoryRun, error) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(`INSERT INTO runs (name, seed, recorded) VALUES (?, ?, ?)`,
+		name, seed, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &HistoryRun{ID: id, tx: tx}, nil
+}
+
+// save inserts whichever of the records are not nil
+func (r *HistoryRun) save(history *History, trace *Trace, pbft *PBFT) error {
+	if history != nil {
+		if err := r.SaveOps(history.Snapshot()); err != nil {
+			return err
+		}
+	}
+	if trace != nil {
+		if err := r.SaveEvents(trace.Snapshot()); err != nil {
+			return err
+		}
+	}
+	if pbft != nil {
+		return r.SaveCommits(pbft)
+	}
+	return nil
+}
+
+// SaveOps inserts client operations
+func (r *HistoryRun) SaveOps(ops []HistoryOp) error {
+	stmt, err := r.tx.Prepare(`INSERT INTO ops VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, op := range ops {
+		var complete *int64
+		if op.Complete != 0 {
+			ns := op.Complete.Nanoseconds()
+			complete = &ns
+		}
+		if _, err := stmt.Exec(r.ID, op.ID, op.Client, op.Txn, string(op.Kind), op.Key, op.Value,
+			op.Version, op.Invoke.Nanoseconds(), complete, op.OK); err != nil {
+			return fmt.Errorf("op %d: %w", op.ID, err)
+		}
+	}
+	return nil
+}
+
+// SaveEvents inserts trace events
+func (r *HistoryRun) SaveEvents(events []TraceEvent) error {
+	stmt, err := r.tx.Prepare(`INSERT INTO events VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, event := range events {
+		var origin, timestamp interface{}
+		if event.Update != nil {
+			origin, timestamp = event.Update.NodeID, event.Update.Timestamp
+		}
+		if _, err := stmt.Exec(r.ID, event.Seq, event.At.Nanoseconds(), string(event.Type),
+			event.Node, event.Peer, origin, timestamp, event.Detail); err != nil {
+			return fmt.Errorf("event %d: %w", event.Seq, err)
+		}
+	}
+	return nil
+}
+
+// SaveCommits inserts the entries every replica executed
+func (r *HistoryRun) SaveCommits(pbft *PBFT) error {
+	stmt, err := r.tx.Prepare(`INSERT INTO commits VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, id := range sortedKeys(pbft.Replicas) {
+		replica := pbft.Replicas[id]
+		replica.Lock.Lock()
+		executed := append([]PBFTExecution(nil), replica.Executed...)
+		replica.Lock.Unlock()
+		for _, execution := range executed {
+			if _, err := stmt.Exec(r.ID, id, execution.View, execution.Seq, execution.Digest,
+				replica.PrimaryForView(execution.View), len(execution.Payload)); err != nil {
+				return fmt.Errorf("%s seq %d: %w", id, execution.Seq, err)
+			}
+		}
+	}
+	return nil
+}
+
+// MigrateEvents rewrites the events of every run recorded when nodes were
+// known by name to their IDs, given the ID of every name, and returns the
+// number of values it changed
+func (h *HistoryDB) MigrateEvents(ids map[string]string) (int64, error) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var changed int64
+	for _, name := range sortedKeys(ids) {
+		if ids[name] == name {
+			continue
+		}
+		for _, column := range []string{"node", "peer", "origin"} {
+			result, err := tx.Exec(fmt.Sprintf(`UPDATE events SET %s = ? WHERE %s = ?`, column, column), ids[name], name)
+			if err != nil {
+				return 0, fmt.Errorf("%w: %v", ErrHistoryQuery, err)
+			}
+			n, _ := result.RowsAffected()
+			changed += n
+		}
+	}
+	return changed, tx.Commit()
+}
+
+// Commit finishes saving the run
+func (r *HistoryRun) Commit() error {
+	return r.tx.Commit()
+}
+
+// Rollback discards the run
+func (r *HistoryRun) Rollback() error {
+	return r.tx.Rollback()
+}
+
+// HistoryRows is the result of a query, every value rendered as text
+type HistoryRows struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"` // NULL is rendered as ""
+}
+
+// Query runs an SQL query against the store
+func (h *HistoryDB) Query(query string, args ...interface{}) (*HistoryRows, error) {
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHistoryQuery, err)
+	}
+	defer rows.Close()
+	result := &HistoryRows{}
+	if result.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+	values := make([]sql.NullString, len(result.Columns))
+	scan := make([]interface{}, len(values))
+	for i := range values {
+		scan[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(scan...); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrHistoryQuery, err)
+		}
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = value.String
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHistoryQuery, err)
+	}
+	return result, nil
+}
+
+// HistoryCommand runs an SQL query against a history store
+func HistoryCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	path := flags.String("db", "", "SQLite history store to query")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	schema := flags.Bool("schema", false, "print the schema instead of running a query")
+	migrate := flags.String("migrate", "", "JSON file mapping node names to IDs, to migrate the recorded events to instead of running a query")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *schema {
+		fmt.Fprint(stdout, strings.TrimPrefix(historySchema, "\n"))
+		return nil
+	}
+	if *path == "" || *migrate == "" && flags.NArg() != 1 || *migrate != "" && flags.NArg() != 0 {
+		return errors.New("usage: wahello history -db file [-json] 'SELECT ...' | -schema | -migrate ids.json")
+	}
+
+	db, err := OpenHistoryDB(*path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if *migrate != "" {
+		data, err := os.ReadFile(*migrate)
+		if err != nil {
+			return err
+		}
+		var ids map[string]string
+		if err := json.Unmarshal(data, &ids); err != nil {
+			return fmt.Errorf("%s: %w", *migrate, err)
+		}
+		changed, err := db.MigrateEvents(ids)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "Migrated %d event values to node IDs\n", changed)
+		return err
+	}
+	result, err := db.Query(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return json.NewEncoder(stdout).Encode(result)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(result.Columns, "\t")))
+	for _, row := range result.Rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
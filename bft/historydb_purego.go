@@ -0,0 +1,7 @@
+//go:build !cgo || purego
+
+package bft
+
+// sqliteDriver is empty in pure-Go builds: the SQLite driver is C, so
+// without cgo, or with the purego tag, there is no history store
+const sqliteDriver = ""
@@ -0,0 +1,8 @@
+//go:build cgo && !purego
+
+package bft
+
+import _ "github.com/mattn/go-sqlite3"
+
+// sqliteDriver is the database/sql driver behind HistoryDB
+const sqliteDriver = "sqlite3"
@@ -0,0 +1,154 @@
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openHistoryDB opens a history store in a temporary directory
+func openHistoryDB(t *testing.T) (*HistoryDB, string) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	db, err := OpenHistoryDB(path)
+	if errors.Is(err, ErrHistoryUnavailable) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+// TestHistoryDBCommitsPerView tests that PBFT executions can be grouped by view and leader in SQL
+func TestHistoryDBCommitsPerView(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.Submit([]byte("op-1"))
+	pbft.Run()
+	pbft.KillPrimary()
+	pbft.Submit([]byte("op-2"))
+	pbft.Run()
+
+	db, _ := openHistoryDB(t)
+	run, err := db.Record("view-change", 7, nil, nil, pbft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := db.Query(`SELECT view, COUNT(*) FROM commits WHERE run = ? AND leader = ? GROUP BY view`, run, "B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Rows, [][]string{{"1", "3"}}) {
+		t.Errorf("Expected B to lead three executions in view 1, got %v", result.Rows)
+	}
+	result, _ = db.Query(`SELECT name, seed FROM runs`)
+	if !reflect.DeepEqual(result.Rows, [][]string{{"view-change", "7"}}) {
+		t.Errorf("Expected the run to be recorded with its seed, got %v", result.Rows)
+	}
+}
+
+// TestHistoryDBOpsAndEvents tests that client operations and trace events keep their fields
+func TestHistoryDBOpsAndEvents(t *testing.T) {
+	now := time.Duration(0)
+	history := NewHistory()
+	history.Now = func() time.Duration { return now }
+	write := history.Invoke("client@us-east", "", OpWrite, "x", "1")
+	now = 3 * time.Millisecond
+	history.Complete(write, "", 1, true)
+	history.Invoke("client@eu-west", "", OpRead, "x", "")
+
+	trace := NewTrace()
+	trace.Record(TraceEvent{Type: EventApply, Node: "B", Peer: "A", Update: &ClockUpdate{NodeID: "A", Timestamp: 42}})
+	trace.Record(TraceEvent{Type: EventWarning, Detail: "slow"})
+
+	db, _ := openHistoryDB(t)
+	if _, err := db.Record("clients", 1, history, trace, nil); err != nil {
+		t.Fatal(err)
+	}
+	ops, _ := db.Query(`SELECT client, kind, version, complete_ns, ok FROM ops ORDER BY id`)
+	expected := [][]string{{"client@us-east", "write", "1", "3000000", "1"}, {"client@eu-west", "read", "0", "", "0"}}
+	if !reflect.DeepEqual(ops.Rows, expected) {
+		t.Errorf("Expected ops %v, got %v", expected, ops.Rows)
+	}
+	events, _ := db.Query(`SELECT type, node, origin, timestamp, detail FROM events ORDER BY seq`)
+	expected = [][]string{{"apply", "B", "A", "42", ""}, {"warning", "", "", "", "slow"}}
+	if !reflect.DeepEqual(events.Rows, expected) {
+		t.Errorf("Expected events %v, got %v", expected, events.Rows)
+	}
+	if _, err := db.Query(`SELECT nothing FROM nowhere`); !errors.Is(err, ErrHistoryQuery) {
+		t.Errorf("Expected a bad query to fail, got %v", err)
+	}
+}
+
+// TestHistoryDBMigrateEvents tests that events recorded by node name are rewritten to node IDs
+func TestHistoryDBMigrateEvents(t *testing.T) {
+	trace := NewTrace()
+	trace.Record(TraceEvent{Type: EventApply, Node: "B", Peer: "A", Update: &ClockUpdate{NodeID: "A", Timestamp: 42}})
+	trace.Record(TraceEvent{Type: EventSend, Node: "C", Peer: "B"})
+
+	db, _ := openHistoryDB(t)
+	if _, err := db.Record("legacy", 1, nil, trace, nil); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := db.MigrateEvents(map[string]string{"A": "uid-a", "B": "uid-b", "C": "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 4 {
+		t.Errorf("Expected 4 values changed, got %d", changed)
+	}
+	events, _ := db.Query(`SELECT node, peer, origin FROM events ORDER BY seq`)
+	expected := [][]string{{"uid-b", "uid-a", "uid-a"}, {"C", "uid-b", ""}}
+	if !reflect.DeepEqual(events.Rows, expected) {
+		t.Errorf("Expected events %v, got %v", expected, events.Rows)
+	}
+}
+
+// TestHistoryCommand tests that the history command prints query results as a table and as JSON
+func TestHistoryCommand(t *testing.T) {
+	db, path := openHistoryDB(t)
+	db.Record("empty", 3, nil, nil, nil)
+
+	var out bytes.Buffer
+	if err := HistoryCommand([]string{"-db", path, "SELECT name, seed FROM runs"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Fields(out.String()); !reflect.DeepEqual(lines, []string{"NAME", "SEED", "empty", "3"}) {
+		t.Errorf("Expected a table of the run, got:\n%s", out.String())
+	}
+	out.Reset()
+	if err := HistoryCommand([]string{"-db", path, "-json", "SELECT seed FROM runs"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != `{"columns":["seed"],"rows":[["3"]]}`+"\n" {
+		t.Errorf("Expected the run as JSON, got %s", out.String())
+	}
+	if err := HistoryCommand([]string{"SELECT 1"}, &out); err == nil {
+		t.Errorf("Expected a query without a store to be rejected")
+	}
+}
+
+// TestSimulatePartitionHistory tests that the partition simulation saves its client history and PBFT runs
+func TestSimulatePartitionHistory(t *testing.T) {
+	db, _ := openHistoryDB(t)
+	SimulatePartition(5, nil, nil, nil, db, nil)
+	result, err := db.Query(`SELECT r.name, COUNT(c.seq) FROM runs r LEFT JOIN commits c ON c.run = r.id GROUP BY r.id ORDER BY r.id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, row := range result.Rows {
+		names = append(names, row[0])
+	}
+	expected := []string{"partition/clients", "partition/pbft-partitioned", "partition/pbft-healed", "partition/pbft-view-change"}
+	if !reflect.DeepEqual(names, expected) || result.Rows[0][1] != "0" || result.Rows[3][1] == "0" {
+		t.Errorf("Expected the client run and three PBFT runs, got %v", result.Rows)
+	}
+	if ops, _ := db.Query(`SELECT COUNT(*) FROM ops WHERE kind = 'write'`); ops.Rows[0][0] == "0" {
+		t.Errorf("Expected the client writes to be saved")
+	}
+}
@@ -0,0 +1,807 @@
+package bft
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// HotStuff consensus.
+//
+// HotStuff orders client payloads among 3f+1 voters like PBFT, with linear
+// communication: the leader of a view broadcasts a PROPOSAL and every
+// replica sends its signed VOTE to the leader of the next view only, which
+// gathers 2f+1 of them into a quorum certificate and justifies its own
+// proposal with it. A view therefore costs O(n) messages, where PBFT's
+// all-to-all prepares and commits cost O(n²) per entry. Leaders rotate with
+// every view, in ID order, starting with the first voter in view 1.
+//
+// Proposals are chained: each block extends the block its certificate
+// certifies, and certifying a block advances the phases of its ancestors
+// at the same time. When a block's certificate reaches a replica, the
+// replica locks on the parent of the certified block and, if the three
+// were proposed in consecutive views, commits the grandparent, executing it
+// and every ancestor not yet executed. A certificate formed after a skipped
+// view only locks: the block it skipped over may have been certified by a
+// quorum that has since moved on, so committing needs a fresh direct chain,
+// and with it four consecutive views with live leaders. A replica
+// votes once per view, for a block that extends its locked block or whose
+// certificate is newer than the lock. A leader without requests keeps
+// proposing empty blocks while the chain holds payloads not yet committed.
+//
+// Clients send requests to every replica. A replica holding a request
+// starts a view timer, and if it executed nothing new when the timer
+// expires it moves on to the next view and sends the leader of that view a
+// NEW-VIEW with its highest certificate. A leader that gathers 2f+1 of them
+// proposes on the highest certificate among them. Like PBFT's, timeouts
+// double while nothing is executed, and replicas give up after trying every
+// replica as leader. A Byzantine leader proposes a forged payload to every
+// other replica and a Byzantine replica votes for forged digests, so
+// neither gathers a certificate.
+
+// hotstuffGenesis is the digest of the block every chain starts from
+const hotstuffGenesis = "genesis"
+
+// HotStuffProposal is a leader's block for its view
+type HotStuffProposal struct {
+	View      int64
+	Parent    string // Digest of the certified block it extends
+	Digest    string // Of the block, see blockDigest
+	Payload   []byte // Nil for an empty block
+	Justify   []byte // JSON-encoded QuorumCert of the parent
+	Leader    string
+	Signature string
+}
+
+// HotStuffVote is a replica's vote for a block, sent to the next leader
+type HotStuffVote struct {
+	View      int64
+	Digest    string
+	Replica   string
+	Signature string
+}
+
+// HotStuffNewView hands the leader of a view a replica's highest
+// certificate after the replica gave up on the view before
+type HotStuffNewView struct {
+	View      int64
+	Justify   []byte // JSON-encoded QuorumCert
+	Replica   string
+	Signature string
+}
+
+// QuorumCert is the signed votes of 2f+1 replicas for a block
+type QuorumCert struct {
+	View       int64             `json:"view"`
+	Digest     string            `json:"digest"`
+	Signatures map[string]string `json:"signatures"` // Replica to its vote's signature
+}
+
+// hotstuffBlock is a block a replica knows of
+type hotstuffBlock struct {
+	view    int64
+	parent  string
+	payload []byte
+	justify *QuorumCert // Nil for the genesis block
+}
+
+// blockDigest returns the digest identifying a block
+func blockDigest(view int64, parent string, payload []byte, justify *QuorumCert) string {
+	payloadDigest := ""
+	if payload != nil {
+		payloadDigest = PayloadDigest(payload)
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("block:%d:%s:%s:%d", view, parent, payloadDigest, justify.View)))
+	return hex.EncodeToString(hash[:])
+}
+
+// HotStuffExecution is a payload a replica executed
+type HotStuffExecution struct {
+	Seq     uint64 // Position among the payloads the replica executed
+	View    int64  // View the payload's block was proposed in
+	Digest  string // Of the payload
+	Payload []byte
+}
+
+// hotstuffTimer is a replica's view timer
+type hotstuffTimer struct {
+	View     int64  // View the replica was in
+	Executed int    // Payloads executed when the timer started
+	Stalled  int    // Timeouts since the last execution, doubles the timeout
+	id       uint64 // Tells the running timer from those it replaced
+}
+
+// HotStuffReplica is one voter's HotStuff state
+type HotStuffReplica struct {
+	Node     *Node
+	View     int64 // View the replica is in
+	F        int
+	Replicas []string // Voters in ID order
+	Executed []HotStuffExecution
+	// Synced is the latest view the replica led after gathering NEW-VIEWs
+	Synced int64
+	// Execute applies a committed payload, in execution order, when set
+	Execute func(seq uint64, payload []byte)
+	// Metrics counts the lookups of the node's certificate cache when set
+	Metrics  *Metrics
+	Lock     sync.Mutex
+	keys     map[string]crypto.PublicKey
+	blocks   map[string]*hotstuffBlock
+	highQC   *QuorumCert // Highest certificate known
+	lockedQC *QuorumCert // Certificate of the locked block
+	voted    int64       // Latest view voted in
+	ready    int64       // Latest view the replica may propose in as leader
+	proposed int64       // Latest view it proposed in
+	executed map[string]bool
+	votes    map[int64]map[string]string // View to each voter's signature, first vote only
+	digests  map[int64]map[string]string // View to each voter's digest
+	newViews map[int64]map[string]bool
+	outbox   []consensusSend
+	timers   []hotstuffTimer
+	pending  [][]byte        // Requests not yet executed, in arrival order
+	done     map[string]bool // Digests of executed requests
+	armed    bool            // A view timer is running
+	timer    uint64          // ID of the running timer
+}
+
+// NewHotStuffReplica creates the replica for node among the given voters,
+// in view 1
+func NewHotStuffReplica(node *Node, voters []*Node, f int) *HotStuffReplica {
+	genesis := &QuorumCert{Digest: hotstuffGenesis}
+	r := &HotStuffReplica{
+		Node:     node,
+		View:     1,
+		F:        f,
+		keys:     make(map[string]crypto.PublicKey),
+		blocks:   map[string]*hotstuffBlock{hotstuffGenesis: {}},
+		highQC:   genesis,
+		lockedQC: genesis,
+		ready:    1,
+		executed: map[string]bool{hotstuffGenesis: true},
+		votes:    make(map[int64]map[string]string),
+		digests:  make(map[int64]map[string]string),
+		newViews: make(map[int64]map[string]bool),
+		done:     make(map[string]bool),
+	}
+	for _, voter := range voters {
+		r.Replicas = append(r.Replicas, voter.ID)
+		r.keys[voter.ID] = voter.PublicKey
+	}
+	sort.Strings(r.Replicas)
+	return r
+}
+
+// LeaderForView returns the round-robin leader of a view
+func (r *HotStuffReplica) LeaderForView(view int64) string {
+	return r.Replicas[int((view-1)%int64(len(r.Replicas)))]
+}
+
+func (r *HotStuffReplica) node() *Node     { return r.Node }
+func (r *HotStuffReplica) group() []string { return r.Replicas }
+
+// quorum is the number of votes that certify a block
+func (r *HotStuffReplica) quorum() int {
+	return 2*r.F + 1
+}
+
+// sign signs a HotStuff message with the replica's key
+func (r *HotStuffReplica) sign(phase string, view int64, digest string) string {
+	signature, err := crypto.Sign(r.Node.PrivateKey, phaseDigest(phase, view, 0, digest, r.Node.ID))
+	if err != nil {
+		return ""
+	}
+	return signature
+}
+
+// verify checks a replica's signature of a HotStuff message
+func (r *HotStuffReplica) verify(phase string, view int64, digest, replica, signature string) bool {
+	key, exists := r.keys[replica]
+	return exists && r.Node.verifySignature(r.Metrics, key, phaseDigest(phase, view, 0, digest, replica), signature)
+}
+
+// verifyQC checks that a certificate carries 2f+1 valid votes, or is the
+// genesis certificate
+func (r *HotStuffReplica) verifyQC(qc *QuorumCert) error {
+	if qc.View == 0 && qc.Digest == hotstuffGenesis {
+		return nil
+	}
+	valid := 0
+	for _, replica := range sortedKeys(qc.Signatures) {
+		if r.verify("hs-vote", qc.View, qc.Digest, replica, qc.Signatures[replica]) {
+			valid++
+		}
+	}
+	if valid < r.quorum() {
+		return fmt.Errorf("%w: certificate for view %d has %d valid votes, needs %d", ErrRejectedMessage, qc.View, valid, r.quorum())
+	}
+	return nil
+}
+
+// chain returns the blocks from digest back to the last executed one, that
+// one excluded, newest first
+func (r *HotStuffReplica) chain(digest string) []*hotstuffBlock {
+	var blocks []*hotstuffBlock
+	for !r.executed[digest] {
+		block := r.blocks[digest]
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+		digest = block.parent
+	}
+	return blocks
+}
+
+// uncommitted reports whether the chain ending at digest holds payloads not
+// executed yet
+func (r *HotStuffReplica) uncommitted(digest string) bool {
+	return slices.ContainsFunc(r.chain(digest), func(block *hotstuffBlock) bool { return block.payload != nil })
+}
+
+// extends reports whether the block with the given digest descends from
+// the block a certificate certifies
+func (r *HotStuffReplica) extends(digest string, qc *QuorumCert) bool {
+	for digest != qc.Digest {
+		block := r.blocks[digest]
+		if block == nil || block.view <= qc.View {
+			return false
+		}
+		digest = block.parent
+	}
+	return true
+}
+
+// Request records a client request, which the leader proposes once it may
+// and which starts the replica's view timer
+func (r *HotStuffReplica) Request(payload []byte) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	digest := PayloadDigest(payload)
+	if r.done[digest] {
+		return
+	}
+	for _, request := range r.pending {
+		if PayloadDigest(request) == digest {
+			return
+		}
+	}
+	r.pending = append(r.pending, payload)
+	r.propose()
+	r.arm(0)
+}
+
+// propose proposes a block on the highest certificate if the replica leads
+// its view, may propose in it and has something to propose: the first
+// request not already in the chain, or an empty block to commit those that
+// are
+func (r *HotStuffReplica) propose() {
+	if r.LeaderForView(r.View) != r.Node.ID || r.ready != r.View || r.proposed >= r.View {
+		return
+	}
+	proposed := make(map[string]bool)
+	for _, block := range r.chain(r.highQC.Digest) {
+		if block.payload != nil {
+			proposed[PayloadDigest(block.payload)] = true
+		}
+	}
+	var payload []byte
+	for _, request := range r.pending {
+		if !proposed[PayloadDigest(request)] {
+			payload = request
+			break
+		}
+	}
+	if payload == nil && len(proposed) == 0 {
+		return
+	}
+	r.proposed = r.View
+
+	justify, err := json.Marshal(r.highQC)
+	if err != nil {
+		return
+	}
+	block := &hotstuffBlock{view: r.View, parent: r.highQC.Digest, payload: payload, justify: r.highQC}
+	proposal := r.proposal(block, justify)
+	if !r.Node.IsByzantine || payload == nil {
+		r.outbox = append(r.outbox, consensusSend{Msg: proposal})
+	} else {
+		// Equivocate: every other replica gets a different payload
+		forged := &hotstuffBlock{view: r.View, parent: r.highQC.Digest, payload: append([]byte("forged:"), payload...), justify: r.highQC}
+		for i, id := range r.Replicas {
+			if id == r.Node.ID {
+				continue
+			}
+			if i%2 == 0 {
+				r.outbox = append(r.outbox, consensusSend{To: id, Msg: r.proposal(forged, justify)})
+			} else {
+				r.outbox = append(r.outbox, consensusSend{To: id, Msg: proposal})
+			}
+		}
+	}
+	r.accept(proposal.Digest, block)
+}
+
+// proposal builds the signed proposal of a block
+func (r *HotStuffReplica) proposal(block *hotstuffBlock, justify []byte) *HotStuffProposal {
+	digest := blockDigest(block.view, block.parent, block.payload, block.justify)
+	return &HotStuffProposal{
+		View:      block.view,
+		Parent:    block.parent,
+		Digest:    digest,
+		Payload:   block.payload,
+		Justify:   justify,
+		Leader:    r.Node.ID,
+		Signature: r.sign("hs-proposal", block.view, digest),
+	}
+}
+
+// accept stores a valid block, advances the chain it justifies and votes
+// for it if it is safe
+func (r *HotStuffReplica) accept(digest string, block *hotstuffBlock) {
+	r.blocks[digest] = block
+	r.advance(block)
+	safe := r.extends(digest, r.lockedQC) || block.justify.View > r.lockedQC.View
+	if block.view <= r.voted || !safe {
+		return
+	}
+	r.voted = block.view
+	if r.View <= block.view {
+		r.View = block.view + 1
+	}
+	if r.Node.IsByzantine {
+		digest = PayloadDigest([]byte("forged:" + digest))
+	}
+	vote := &HotStuffVote{View: block.view, Digest: digest, Replica: r.Node.ID, Signature: r.sign("hs-vote", block.view, digest)}
+	if next := r.LeaderForView(block.view + 1); next != r.Node.ID {
+		r.outbox = append(r.outbox, consensusSend{To: next, Msg: vote})
+	} else {
+		r.handleVote(r.Node.ID, vote)
+	}
+}
+
+// advance applies the certificate a block carries: it becomes the highest
+// certificate if it is newer, the parent of the certified block is locked,
+// and its grandparent committed if the three are a direct chain, proposed
+// in consecutive views
+func (r *HotStuffReplica) advance(block *hotstuffBlock) {
+	qc2 := block.justify
+	if qc2.View > r.highQC.View {
+		r.highQC = qc2
+	}
+	b2 := r.blocks[qc2.Digest]
+	if b2 == nil || b2.justify == nil {
+		return
+	}
+	qc1 := b2.justify
+	if qc1.View > r.lockedQC.View {
+		r.lockedQC = qc1
+	}
+	b1 := r.blocks[qc1.Digest]
+	if b1 == nil || b1.justify == nil {
+		return
+	}
+	if b2.view == b1.view+1 && b1.view == b1.justify.View+1 {
+		r.commit(b1.justify.Digest)
+	}
+}
+
+// commit executes the block with the given digest and its ancestors not
+// executed yet, oldest first
+func (r *HotStuffReplica) commit(digest string) {
+	blocks := r.chain(digest)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		r.executed[blockDigest(block.view, block.parent, block.payload, block.justify)] = true
+		if block.payload == nil {
+			continue
+		}
+		payloadDigest := PayloadDigest(block.payload)
+		if r.done[payloadDigest] {
+			// A request proposed again after its first block was orphaned
+			continue
+		}
+		r.done[payloadDigest] = true
+		r.pending = slices.DeleteFunc(r.pending, func(request []byte) bool { return PayloadDigest(request) == payloadDigest })
+		seq := uint64(len(r.Executed) + 1)
+		r.Executed = append(r.Executed, HotStuffExecution{Seq: seq, View: block.view, Digest: payloadDigest, Payload: block.payload})
+		if r.Execute != nil {
+			r.Execute(seq, block.payload)
+		}
+	}
+}
+
+// Deliver handles a HotStuff message from another replica
+func (r *HotStuffReplica) Deliver(from string, m Message) error {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	switch m := m.(type) {
+	case *HotStuffProposal:
+		return r.handleProposal(from, m)
+	case *HotStuffVote:
+		return r.handleVote(from, m)
+	case *HotStuffNewView:
+		return r.handleNewView(from, m)
+	}
+	return fmt.Errorf("%w: %v", ErrUnknownMessage, m.MessageType())
+}
+
+func (r *HotStuffReplica) handleProposal(from string, m *HotStuffProposal) error {
+	if from != m.Leader || m.Leader != r.LeaderForView(m.View) {
+		return fmt.Errorf("%w: proposal for view %d from %s", ErrRejectedMessage, m.View, from)
+	}
+	if m.View < r.View-1 || m.View <= r.voted {
+		return fmt.Errorf("%w: proposal for view %d in view %d", ErrRejectedMessage, m.View, r.View)
+	}
+	if !r.verify("hs-proposal", m.View, m.Digest, m.Leader, m.Signature) {
+		return fmt.Errorf("%w: proposal from %s for view %d", ErrConsensusSignature, m.Leader, m.View)
+	}
+	var justify QuorumCert
+	if err := json.Unmarshal(m.Justify, &justify); err != nil {
+		return fmt.Errorf("%w: certificate from %s: %v", ErrRejectedMessage, m.Leader, err)
+	}
+	if err := r.verifyQC(&justify); err != nil {
+		return err
+	}
+	if m.Parent != justify.Digest || justify.View >= m.View || blockDigest(m.View, m.Parent, m.Payload, &justify) != m.Digest {
+		return fmt.Errorf("%w: malformed block from %s for view %d", ErrRejectedMessage, m.Leader, m.View)
+	}
+	r.accept(m.Digest, &hotstuffBlock{view: m.View, parent: m.Parent, payload: m.Payload, justify: &justify})
+	r.propose()
+	return nil
+}
+
+func (r *HotStuffReplica) handleVote(from string, m *HotStuffVote) error {
+	if from != m.Replica || r.LeaderForView(m.View+1) != r.Node.ID {
+		return fmt.Errorf("%w: vote for view %d from %s", ErrRejectedMessage, m.View, from)
+	}
+	if !r.verify("hs-vote", m.View, m.Digest, m.Replica, m.Signature) {
+		return fmt.Errorf("%w: vote from %s for view %d", ErrConsensusSignature, m.Replica, m.View)
+	}
+	if r.votes[m.View] == nil {
+		r.votes[m.View] = make(map[string]string)
+		r.digests[m.View] = make(map[string]string)
+	}
+	if _, voted := r.votes[m.View][m.Replica]; voted {
+		return nil
+	}
+	r.votes[m.View][m.Replica], r.digests[m.View][m.Replica] = m.Signature, m.Digest
+	if r.highQC.View >= m.View || matching(r.digests[m.View], m.Digest) < r.quorum() {
+		return nil
+	}
+	qc := &QuorumCert{View: m.View, Digest: m.Digest, Signatures: make(map[string]string)}
+	for replica, digest := range r.digests[m.View] {
+		if digest == m.Digest {
+			qc.Signatures[replica] = r.votes[m.View][replica]
+		}
+	}
+	r.highQC = qc
+	if r.View <= m.View+1 {
+		r.View, r.ready = m.View+1, m.View+1
+		r.propose()
+	}
+	return nil
+}
+
+func (r *HotStuffReplica) handleNewView(from string, m *HotStuffNewView) error {
+	if from != m.Replica || r.LeaderForView(m.View) != r.Node.ID {
+		return fmt.Errorf("%w: new view %d from %s", ErrRejectedMessage, m.View, from)
+	}
+	var justify QuorumCert
+	if err := json.Unmarshal(m.Justify, &justify); err != nil {
+		return fmt.Errorf("%w: certificate from %s: %v", ErrRejectedMessage, m.Replica, err)
+	}
+	if !r.verify("hs-new-view", m.View, justify.Digest, m.Replica, m.Signature) {
+		return fmt.Errorf("%w: new view from %s for view %d", ErrConsensusSignature, m.Replica, m.View)
+	}
+	if err := r.verifyQC(&justify); err != nil {
+		return err
+	}
+	if justify.View > r.highQC.View {
+		r.highQC = &justify
+	}
+	if r.newViews[m.View] == nil {
+		r.newViews[m.View] = make(map[string]bool)
+	}
+	r.newViews[m.View][m.Replica] = true
+	if len(r.newViews[m.View]) < r.quorum() || r.ready >= m.View || r.View > m.View {
+		return nil
+	}
+	r.View, r.ready, r.Synced = m.View, m.View, m.View
+	r.propose()
+	return nil
+}
+
+// arm starts the replica's view timer unless one is running
+func (r *HotStuffReplica) arm(stalled int) {
+	if r.armed {
+		return
+	}
+	r.timer++
+	r.armed = true
+	r.timers = append(r.timers, hotstuffTimer{View: r.View, Executed: len(r.Executed), Stalled: stalled, id: r.timer})
+}
+
+// Timeout handles an expired view timer: a replica that executed nothing
+// since it started moves on to the next view and hands its leader its
+// highest certificate
+func (r *HotStuffReplica) Timeout(timer hotstuffTimer) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	if !r.armed || timer.id != r.timer {
+		return
+	}
+	r.armed = false
+	if len(r.pending) == 0 && !r.uncommitted(r.highQC.Digest) {
+		return
+	}
+	stalled := timer.Stalled + 1
+	if len(r.Executed) > timer.Executed {
+		stalled = 0
+	} else if stalled > len(r.Replicas) {
+		return
+	} else {
+		r.View++
+		justify, err := json.Marshal(r.highQC)
+		if err != nil {
+			return
+		}
+		newView := &HotStuffNewView{View: r.View, Justify: justify, Replica: r.Node.ID, Signature: r.sign("hs-new-view", r.View, r.highQC.Digest)}
+		if leader := r.LeaderForView(r.View); leader != r.Node.ID {
+			r.outbox = append(r.outbox, consensusSend{To: leader, Msg: newView})
+		} else {
+			r.handleNewView(r.Node.ID, newView)
+		}
+	}
+	r.arm(stalled)
+}
+
+// drain returns and clears the messages waiting to be sent and the view
+// timers waiting to be started
+func (r *HotStuffReplica) drain() ([]consensusSend, []hotstuffTimer) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	sends, timers := r.outbox, r.timers
+	r.outbox, r.timers = nil, nil
+	return sends, timers
+}
+
+// HotStuffStats counts the HotStuff traffic of a run
+type HotStuffStats struct {
+	MessageStats
+	ViewChanges int // Views led after gathering NEW-VIEWs
+}
+
+// HotStuffOutcome is what happened to a submitted payload
+type HotStuffOutcome struct {
+	Seq      uint64 // Where the payload was first executed, 0 if nowhere yet
+	View     int64  // View its block was proposed in
+	Leader   string // Who proposed the block
+	Digest   string
+	Executed []string // Replicas that executed the payload, in ID order
+	// Committed is set once f+1 replicas executed the payload, enough
+	// matching replies for a client to accept the result
+	Committed bool
+	Latency   time.Duration // From submission until the (f+1)th execution
+}
+
+// hotstuffRequest tracks a submitted payload
+type hotstuffRequest struct {
+	submitted time.Duration
+	seq       uint64
+	view      int64
+	executed  map[string]time.Duration
+}
+
+// HotStuff runs a HotStuff replica on every voter of a system, with a
+// driver carrying their messages over its simulated network. It leaves the
+// system's leader alone.
+type HotStuff struct {
+	driver[*HotStuffReplica, hotstuffTimer]
+	F        int
+	Replicas map[string]*HotStuffReplica
+	Synced   int64 // Latest view a replica led after gathering NEW-VIEWs
+	// ViewTimeout is how long a replica waits for a request to execute
+	// before it moves on to the next view, DefaultViewTimeout if zero
+	ViewTimeout time.Duration
+	// OnViewChange is called when a replica first leads a view after
+	// gathering NEW-VIEWs
+	OnViewChange func(view int64, leader string)
+	Stats        HotStuffStats
+	requests     map[string]*hotstuffRequest
+}
+
+// NewHotStuff creates replicas for the system's voters, all in view 1. A
+// negative f uses the system's fault tolerance.
+func NewHotStuff(system *System, f int) (*HotStuff, error) {
+	system.Lock.RLock()
+	voters := system.voters()
+	if f < 0 {
+		f = system.faultThreshold(len(voters))
+	}
+	system.Lock.RUnlock()
+
+	if len(voters) == 0 || len(voters) < 3*f+1 {
+		return nil, fmt.Errorf("%w: %d voters, f=%d needs %d", ErrTooFewReplicas, len(voters), f, 3*f+1)
+	}
+	h := &HotStuff{
+		F:        f,
+		Replicas: make(map[string]*HotStuffReplica),
+		requests: make(map[string]*hotstuffRequest),
+	}
+	h.driver = newDriver[*HotStuffReplica, hotstuffTimer](system, "hotstuff", h.Replicas, &h.Stats.MessageStats)
+	h.kind = hotstuffName
+	h.timer = func(replica *HotStuffReplica, timer hotstuffTimer) (time.Duration, string) {
+		return h.viewTimeout(timer.Stalled), fmt.Sprintf("view timer of %s in view %d", replica.Node.ID, timer.View)
+	}
+	h.settle = func(replica *HotStuffReplica) {
+		h.synced(replica)
+		h.executed(replica)
+	}
+	h.outstanding = func() bool {
+		for digest := range h.requests {
+			if !h.Outcome(digest).Committed {
+				return true
+			}
+		}
+		return false
+	}
+	h.status = func(replica *HotStuffReplica) string {
+		replica.Lock.Lock()
+		defer replica.Lock.Unlock()
+		return fmt.Sprintf("HotStuff replica %s: view %d, certified view %d, locked view %d, %d executed, %d requests pending",
+			replica.Node.ID, replica.View, replica.highQC.View, replica.lockedQC.View, len(replica.Executed), len(replica.pending))
+	}
+	for _, voter := range voters {
+		h.Replicas[voter.ID] = NewHotStuffReplica(voter, voters, f)
+		h.Replicas[voter.ID].Metrics = system.Metrics
+	}
+	return h, nil
+}
+
+// Submit sends payload to every reachable replica for ordering and returns
+// its digest, which identifies the request. Call Run to carry the protocol
+// messages.
+func (h *HotStuff) Submit(payload []byte) (string, error) {
+	digest := PayloadDigest(payload)
+	if _, exists := h.requests[digest]; exists {
+		return "", fmt.Errorf("%w: request %s already submitted", ErrRejectedMessage, digest)
+	}
+	h.requests[digest] = &hotstuffRequest{submitted: h.Scheduler.Now, executed: make(map[string]time.Duration)}
+	h.submit(payload)
+	return digest, nil
+}
+
+// SubmitOperation orders op, which Execute applies once it commits
+func (h *HotStuff) SubmitOperation(op *Operation) (string, error) {
+	frame, err := EncodeFrame(op)
+	if err != nil {
+		return "", err
+	}
+	return h.Submit(frame)
+}
+
+// synced counts a view a replica led after gathering NEW-VIEWs
+func (h *HotStuff) synced(replica *HotStuffReplica) {
+	replica.Lock.Lock()
+	view := replica.Synced
+	replica.Lock.Unlock()
+	if view <= h.Synced {
+		return
+	}
+	h.Synced = view
+	h.Stats.ViewChanges++
+	h.System.Metrics.add(metricViewChanges, "", 1)
+	h.System.trace(TraceEvent{Type: EventViewChange, Node: replica.Node.ID, Detail: fmt.Sprintf("hotstuff view %d", view)})
+	h.System.NodeLogger(replica.Node.ID).Info("view synced", "hotstuff_view", view)
+	if h.OnViewChange != nil {
+		h.OnViewChange(view, replica.Node.ID)
+	}
+}
+
+// executed records when a replica executed submitted payloads
+func (h *HotStuff) executed(replica *HotStuffReplica) {
+	var commits []TraceEvent
+	defer func() {
+		for _, event := range commits {
+			h.System.trace(event)
+		}
+	}()
+	replica.Lock.Lock()
+	defer replica.Lock.Unlock()
+	for _, execution := range replica.Executed {
+		request := h.requests[execution.Digest]
+		if request == nil {
+			continue
+		}
+		if _, done := request.executed[replica.Node.ID]; done {
+			continue
+		}
+		request.executed[replica.Node.ID] = h.Scheduler.Now
+		h.Scheduler.Progress()
+		logger := h.System.NodeLogger(replica.Node.ID)
+		logger.Debug("executed", "seq", execution.Seq, "digest", execution.Digest)
+		if request.seq == 0 {
+			request.seq, request.view = execution.Seq, execution.View
+		}
+		// The (f+1)th execution commits the payload
+		if len(request.executed) == h.F+1 {
+			h.System.Metrics.observeCommit("hotstuff", h.Scheduler.Now-request.submitted)
+			logger.Info("committed", "seq", execution.Seq, "digest", execution.Digest, "latency", h.Scheduler.Now-request.submitted)
+			commits = append(commits, TraceEvent{Type: EventCommit, Node: replica.Node.ID, Detail: fmt.Sprintf("hotstuff seq %d", execution.Seq)})
+		}
+	}
+}
+
+// viewTimeout is how long a timer runs after the given number of timeouts
+// without progress
+func (h *HotStuff) viewTimeout(stalled int) time.Duration {
+	timeout := h.ViewTimeout
+	if timeout == 0 {
+		timeout = DefaultViewTimeout
+	}
+	return timeout << stalled
+}
+
+// hotstuffName is the capture kind of a HotStuff message
+func hotstuffName(m Message) string {
+	switch m.(type) {
+	case *HotStuffProposal:
+		return "hs-proposal"
+	case *HotStuffVote:
+		return "hs-vote"
+	case *HotStuffNewView:
+		return "hs-new-view"
+	}
+	return m.MessageType().String()
+}
+
+// Outcome reports what happened to the request with the given digest
+func (h *HotStuff) Outcome(digest string) HotStuffOutcome {
+	outcome := HotStuffOutcome{Digest: digest}
+	request := h.requests[digest]
+	if request == nil {
+		return outcome
+	}
+	outcome.Seq, outcome.View = request.seq, request.view
+	if request.view > 0 {
+		outcome.Leader = h.Replicas[sortedKeys(h.Replicas)[0]].LeaderForView(request.view)
+	}
+	outcome.Executed = sortedKeys(request.executed)
+	times := make([]time.Duration, 0, len(request.executed))
+	for _, at := range request.executed {
+		times = append(times, at)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	if len(times) >= h.F+1 {
+		outcome.Committed = true
+		outcome.Latency = times[h.F] - request.submitted
+	}
+	return outcome
+}
+
+// Conflicts returns the positions, in order, at which replicas executed
+// different payloads
+func (h *HotStuff) Conflicts() []uint64 {
+	executed := make(map[uint64]string)
+	conflicting := make(map[uint64]bool)
+	for _, id := range sortedKeys(h.Replicas) {
+		replica := h.Replicas[id]
+		replica.Lock.Lock()
+		for _, execution := range replica.Executed {
+			if digest, exists := executed[execution.Seq]; exists && digest != execution.Digest {
+				conflicting[execution.Seq] = true
+			}
+			executed[execution.Seq] = execution.Digest
+		}
+		replica.Lock.Unlock()
+	}
+	return sortedIndexes(conflicting)
+}
@@ -0,0 +1,200 @@
+package bft
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newHotStuff creates HotStuff on nodes A-D, with the given nodes Byzantine
+func newHotStuff(t *testing.T, byzantine ...string) *HotStuff {
+	t.Helper()
+	hotstuff, err := NewHotStuff(newPBFT(t, byzantine...).System, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hotstuff
+}
+
+// TestHotStuffCommitsOnEveryReplica tests that a request proposed by the
+// leader of view 1 commits once three views certified its block, and that
+// every replica executes it first
+func TestHotStuffCommitsOnEveryReplica(t *testing.T) {
+	hotstuff := newHotStuff(t)
+	digest, err := hotstuff.Submit([]byte("w1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hotstuff.Submit([]byte("w1")); err == nil {
+		t.Error("Expected a resubmitted request to be refused")
+	}
+	if err := hotstuff.Run(); err != nil {
+		t.Fatal(err)
+	}
+	outcome := hotstuff.Outcome(digest)
+	if !outcome.Committed || outcome.Seq != 1 || outcome.View != 1 || outcome.Leader != "A" || len(outcome.Executed) != 4 {
+		t.Fatalf("Expected w1 proposed by A in view 1 and executed by every replica, got %+v", outcome)
+	}
+	for id, replica := range hotstuff.Replicas {
+		if replica.lockedQC.View < 2 || replica.View < 4 {
+			t.Errorf("Expected %s to lock on view 2 or later and move past view 3, got lock %d in view %d", id, replica.lockedQC.View, replica.View)
+		}
+	}
+	if conflicts := hotstuff.Conflicts(); len(conflicts) != 0 || hotstuff.Stats.ViewChanges != 0 {
+		t.Errorf("Expected no conflicts or view changes, got %v and %d", conflicts, hotstuff.Stats.ViewChanges)
+	}
+	if hotstuff.Scheduler.Pending() != 0 {
+		t.Errorf("Expected the run to end once w1 committed, got %d events", hotstuff.Scheduler.Pending())
+	}
+}
+
+// TestHotStuffLinearMessages tests that HotStuff orders the same requests
+// with fewer messages than PBFT, every view costing a broadcast and one vote
+// per replica, and that the metrics count both protocols' messages
+func TestHotStuffLinearMessages(t *testing.T) {
+	hotstuff := newHotStuff(t)
+	hotstuff.System.Metrics = NewMetrics()
+	pbft := newPBFT(t)
+	pbft.System.Metrics = hotstuff.System.Metrics
+	for i := 1; i <= 4; i++ {
+		payload := []byte(fmt.Sprintf("w%d", i))
+		if _, err := hotstuff.Submit(payload); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pbft.Submit(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := hotstuff.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pbft.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	views := hotstuff.Replicas["A"].proposed
+	for _, replica := range hotstuff.Replicas {
+		views = max(views, replica.proposed)
+	}
+	if len(hotstuff.Replicas["A"].Executed) != 4 || hotstuff.Stats.Sent != int(views)*2*3 {
+		t.Errorf("Expected 4 executions with 6 messages in each of %d views, got %d and %d messages", views, len(hotstuff.Replicas["A"].Executed), hotstuff.Stats.Sent)
+	}
+	if hotstuff.Stats.Sent >= pbft.Stats.Sent {
+		t.Errorf("Expected HotStuff to send fewer messages than PBFT, got %d and %d", hotstuff.Stats.Sent, pbft.Stats.Sent)
+	}
+	metrics := hotstuff.System.Metrics
+	if sent := metrics.Count(metricConsensus.name, "hotstuff"); sent != float64(hotstuff.Stats.Sent) {
+		t.Errorf("Expected %d HotStuff messages counted, got %v", hotstuff.Stats.Sent, sent)
+	}
+	if sent := metrics.Count(metricConsensus.name, "pbft"); sent != float64(pbft.Stats.Sent) {
+		t.Errorf("Expected %d PBFT messages counted, got %v", pbft.Stats.Sent, sent)
+	}
+}
+
+// TestHotStuffCrashedLeaderSkipped tests that the replicas move on to the
+// next view with their highest certificate when the leader collecting their
+// votes crashed, and commit once four consecutive views have live leaders.
+// Among four voters every fourth leader is the crashed one, so it takes
+// seven.
+func TestHotStuffCrashedLeaderSkipped(t *testing.T) {
+	hotstuff, err := NewHotStuff(newTestSystem(t, nodeIDs(7), fixedClock(42)), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var synced []string
+	hotstuff.OnViewChange = func(view int64, leader string) { synced = append(synced, fmt.Sprintf("%s@%d", leader, view)) }
+	if err := hotstuff.System.ApplyFault(FaultStep{Kind: FaultCrash, Nodes: []string{"B"}}); err != nil {
+		t.Fatal(err)
+	}
+	digest, _ := hotstuff.Submit([]byte("w1"))
+	if err := hotstuff.Run(); err != nil {
+		t.Fatal(err)
+	}
+	outcome := hotstuff.Outcome(digest)
+	if !outcome.Committed || outcome.View != 3 || len(outcome.Executed) != 6 || containsID(outcome.Executed, "B") {
+		t.Fatalf("Expected the six survivors to execute w1 proposed in view 3, got %+v", outcome)
+	}
+	if hotstuff.Stats.ViewChanges == 0 || len(synced) == 0 || synced[0] != "C@3" {
+		t.Errorf("Expected C to lead view 3 after NEW-VIEWs, got %v", synced)
+	}
+}
+
+// TestHotStuffSkippedViewCommitsNothing tests that a chain of certificates
+// with a view skipped in between locks without committing, and that the
+// skipped-over block commits with the first direct chain after it
+func TestHotStuffSkippedViewCommitsNothing(t *testing.T) {
+	hotstuff := newHotStuff(t)
+	replica := hotstuff.Replicas["A"]
+	replica.Lock.Lock()
+	defer replica.Lock.Unlock()
+	qc := &QuorumCert{Digest: hotstuffGenesis}
+	extend := func(view int64, payload []byte) *hotstuffBlock {
+		block := &hotstuffBlock{view: view, parent: qc.Digest, payload: payload, justify: qc}
+		digest := blockDigest(view, qc.Digest, payload, qc)
+		replica.blocks[digest] = block
+		replica.advance(block)
+		qc = &QuorumCert{View: view, Digest: digest}
+		return block
+	}
+
+	// Certified in view 1, then extended in views 3 and 4 after view 2 failed
+	extend(1, []byte("w1"))
+	extend(3, nil)
+	extend(4, nil)
+	extend(5, nil)
+	if len(replica.Executed) != 0 {
+		t.Fatalf("Expected no commit across the skipped view, got %+v", replica.Executed)
+	}
+	if replica.lockedQC.View != 3 {
+		t.Errorf("Expected a lock on view 3, got %d", replica.lockedQC.View)
+	}
+	extend(6, nil)
+	if len(replica.Executed) != 1 || string(replica.Executed[0].Payload) != "w1" {
+		t.Errorf("Expected w1 to commit with the direct chain of views 3 to 5, got %+v", replica.Executed)
+	}
+}
+
+// TestHotStuffByzantineLeaderCertifiesNothing tests that an equivocating
+// leader gathers no certificate, and that the next honest leaders commit the
+// genuine request everywhere
+func TestHotStuffByzantineLeaderCertifiesNothing(t *testing.T) {
+	hotstuff := newHotStuff(t, "A")
+	digest, _ := hotstuff.Submit([]byte("w1"))
+	if err := hotstuff.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if conflicts := hotstuff.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+	outcome := hotstuff.Outcome(digest)
+	if !outcome.Committed || outcome.Leader == "A" {
+		t.Fatalf("Expected w1 to commit in a view led by an honest replica, got %+v", outcome)
+	}
+	for _, id := range []string{"B", "C", "D"} {
+		executed := hotstuff.Replicas[id].Executed
+		if len(executed) != 1 || string(executed[0].Payload) != "w1" {
+			t.Errorf("Expected %s to execute w1 only, got %+v", id, executed)
+		}
+	}
+}
+
+// TestHotStuffEngine tests that a namespace ordered by HotStuff commits
+// through it on every voter
+func TestHotStuffEngine(t *testing.T) {
+	system := newGeoSystem(t)
+	system.UseScheduler(NewScheduler(1))
+	if err := system.UseEngine("ledger", EngineHotStuff); err != nil {
+		t.Fatal(err)
+	}
+	result, err := system.SubmitWrite("eu-west", "D", "ledger/a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Index != 1 || !result.Forwarded {
+		t.Errorf("Expected the write from D to commit at 1 through another leader, got %+v", result)
+	}
+	for _, id := range []string{"A", "B", "D", "G"} {
+		if value := system.Nodes[id].Store.Entries["ledger/a"].Value; value != "1" {
+			t.Errorf("Expected %s to apply ledger/a=1, got %q", id, value)
+		}
+	}
+}
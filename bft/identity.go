@@ -0,0 +1,165 @@
+package bft
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Node identities.
+//
+// A node's ID is its identity: vector clocks are keyed by it and clock
+// update signatures cover it, so it never changes. Its Name is what people
+// read, "A" or "us-east-1a", and may change at any time, as may the region
+// it is homed in. Nodes made by NewNode use their name as ID, as the
+// scenarios always have; NewNamedNode gives a node a random UUID as ID
+// under a display name, so renaming it or moving it to another region
+// leaves the causal history that refers to it intact.
+//
+// Traces recorded before nodes had UUIDs refer to them by name.
+// MigrateTrace and HistoryDB.MigrateEvents rewrite such traces to the IDs,
+// given the name of every node and its ID, as System.Identities returns.
+// Signatures quoted in migrated events were made over the names, so they
+// are kept as recorded rather than checked again.
+
+var ErrNameTaken = errors.New("node name already taken")
+
+// NewUID returns a random version 4 UUID
+func NewUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// NewNamedNode creates a node with a random UUID as ID, shown as name
+func NewNamedNode(name string, isByzantine bool, isIsolated bool) (*Node, error) {
+	uid, err := NewUID()
+	if err != nil {
+		return nil, err
+	}
+	node, err := NewNode(uid, isByzantine, isIsolated)
+	if err != nil {
+		return nil, err
+	}
+	node.Name = name
+	return node, nil
+}
+
+// DisplayName returns the node's name, its ID if it has none
+func (n *Node) DisplayName() string {
+	n.Lock.RLock()
+	defer n.Lock.RUnlock()
+	if n.Name != "" {
+		return n.Name
+	}
+	return n.ID
+}
+
+// nodeByName returns the node shown as name, or with name as ID. The
+// caller must hold s.Lock.
+func (s *System) nodeByName(name string) *Node {
+	if node, exists := s.Nodes[name]; exists && node.Name == "" {
+		return node
+	}
+	for _, id := range sortedKeys(s.Nodes) {
+		if node := s.Nodes[id]; node.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// NodeByName returns the node shown as name
+func (s *System) NodeByName(name string) (*Node, bool) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	node := s.nodeByName(name)
+	return node, node != nil
+}
+
+// RenameNode shows the node with the given ID as name from now on. Its
+// clocks, signatures and history are unaffected.
+func (s *System) RenameNode(id, name string) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	node, exists := s.Nodes[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownNode, id)
+	}
+	if other := s.nodeByName(name); other != nil && other != node {
+		return fmt.Errorf("%w: %s is %s", ErrNameTaken, name, other.ID)
+	}
+	node.Lock.Lock()
+	defer node.Lock.Unlock()
+	node.Name = name
+	return nil
+}
+
+// RehomeNode moves the node with the given ID to region. Its messages take
+// the new region's latencies from now on; its identity is unaffected.
+func (s *System) RehomeNode(id, region string) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	node, exists := s.Nodes[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownNode, id)
+	}
+	node.Lock.Lock()
+	defer node.Lock.Unlock()
+	node.Region = region
+	return nil
+}
+
+// Identities returns the ID of every node by its display name
+func (s *System) Identities() map[string]string {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	ids := make(map[string]string, len(s.Nodes))
+	for id, node := range s.Nodes {
+		if node.Name != "" {
+			ids[node.Name] = id
+		} else {
+			ids[id] = id
+		}
+	}
+	return ids
+}
+
+// MigrateTrace returns a copy of events with the nodes, peers and update
+// senders found in ids, a map from name to ID, replaced by their IDs, and
+// the names it did not find in sorted order
+func MigrateTrace(events []TraceEvent, ids map[string]string) ([]TraceEvent, []string) {
+	missing := make(map[string]bool)
+	migrate := func(name string) string {
+		if name == "" {
+			return name
+		}
+		if id, exists := ids[name]; exists {
+			return id
+		}
+		missing[name] = true
+		return name
+	}
+	migrated := make([]TraceEvent, len(events))
+	for i, event := range events {
+		event.Node = migrate(event.Node)
+		event.Peer = migrate(event.Peer)
+		if event.Update != nil {
+			update := *event.Update
+			update.NodeID = migrate(update.NodeID)
+			event.Update = &update
+		}
+		migrated[i] = event
+	}
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return migrated, names
+}
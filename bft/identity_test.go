@@ -0,0 +1,123 @@
+package bft
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// TestNewUID tests that node IDs are distinct version 4 UUIDs
+func TestNewUID(t *testing.T) {
+	format := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, err := NewUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewUID()
+	if !format.MatchString(a) || a == b {
+		t.Errorf("Expected two distinct UUIDs, got %s and %s", a, b)
+	}
+}
+
+// newNamedSystem creates nodes with UUIDs shown as the given names, all in one region
+func newNamedSystem(t *testing.T, names ...string) *System {
+	system := NewSystem()
+	for _, name := range names {
+		node, err := NewNamedNode(name, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.Region = "us-east-1"
+		system.AddNode(node)
+	}
+	return system
+}
+
+// TestRenameKeepsCausalHistory tests that an update signed before a rename and delivered after it lands on the same clock entry
+func TestRenameKeepsCausalHistory(t *testing.T) {
+	system := newNamedSystem(t, "A", "B")
+	a, _ := system.NodeByName("A")
+	b, _ := system.NodeByName("B")
+	first := a.GetClockUpdate()
+	if !b.VerifyAndApplyClockUpdate(first) {
+		t.Fatal("Expected B to apply A's first update")
+	}
+
+	// A is renamed and moved while its second update is in flight
+	second := a.GetClockUpdate()
+	second.Timestamp = first.Timestamp + 1
+	if signature, err := SignClockUpdate(a.PrivateKey, second); err == nil {
+		second.Signature = signature
+	}
+	if err := system.RenameNode(a.ID, "A-prime"); err != nil {
+		t.Fatal(err)
+	}
+	if err := system.RehomeNode(a.ID, "eu-west-1"); err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyClockUpdate(a.PublicKey, second) || !b.VerifyAndApplyClockUpdate(second) {
+		t.Fatal("Expected the in-flight update to verify and apply after the rename")
+	}
+	if got := b.VectorClock.Timestamps(); !reflect.DeepEqual(got, map[string]int64{a.ID: second.Timestamp}) {
+		t.Errorf("Expected a single entry under A's ID, got %v", got)
+	}
+	if a.DisplayName() != "A-prime" || a.Region != "eu-west-1" {
+		t.Errorf("Expected A-prime in eu-west-1, got %s in %s", a.DisplayName(), a.Region)
+	}
+	if node, found := system.NodeByName("A-prime"); !found || node != a {
+		t.Error("Expected to find A by its new name")
+	}
+	if _, found := system.NodeByName("A"); found {
+		t.Error("Expected the old name to be free")
+	}
+}
+
+// TestRenameErrors tests that names stay unique and nodes must exist
+func TestRenameErrors(t *testing.T) {
+	system := newNamedSystem(t, "A", "B")
+	a, _ := system.NodeByName("A")
+	if err := system.RenameNode(a.ID, "B"); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("Expected ErrNameTaken, got %v", err)
+	}
+	if err := system.RenameNode(a.ID, "A"); err != nil {
+		t.Errorf("Expected a node to keep its own name, got %v", err)
+	}
+	if err := system.RenameNode("nobody", "C"); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("Expected ErrUnknownNode, got %v", err)
+	}
+	if err := system.RehomeNode("nobody", "us-west-2"); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("Expected ErrUnknownNode, got %v", err)
+	}
+}
+
+// TestMigrateTrace tests that a trace recorded by name is rewritten to node IDs
+func TestMigrateTrace(t *testing.T) {
+	system := newNamedSystem(t, "A", "B")
+	legacy, err := NewNode("C", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	system.AddNode(legacy)
+	ids := system.Identities()
+	if ids["C"] != "C" || len(ids) != 3 {
+		t.Fatalf("Expected A, B and C with C its own ID, got %v", ids)
+	}
+
+	events := []TraceEvent{
+		{Seq: 0, Type: EventSend, Node: "A", Peer: "B", Update: &ClockUpdate{NodeID: "A", Timestamp: 5}},
+		{Seq: 1, Type: EventApply, Node: "B", Peer: "A", Update: &ClockUpdate{NodeID: "A", Timestamp: 5}},
+		{Seq: 2, Type: EventReceive, Node: "C", Peer: "D"},
+		{Seq: 3, Type: EventViolation, Detail: "no node"},
+	}
+	migrated, missing := MigrateTrace(events, ids)
+	if migrated[0].Node != ids["A"] || migrated[0].Peer != ids["B"] || migrated[1].Update.NodeID != ids["A"] {
+		t.Errorf("Expected A and B replaced by their IDs, got %+v and %+v", migrated[0], migrated[1])
+	}
+	if migrated[2].Node != "C" || migrated[3].Node != "" || !reflect.DeepEqual(missing, []string{"D"}) {
+		t.Errorf("Expected C kept, no node left empty and D reported missing, got %+v, %+v and %v", migrated[2], migrated[3], missing)
+	}
+	if events[0].Node != "A" || events[1].Update.NodeID != "A" {
+		t.Error("Expected the original trace to be left alone")
+	}
+}
@@ -0,0 +1,115 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Public key registry.
+//
+// A receiver cannot trust the key an update arrives with, so every system
+// keeps a KeyRegistry mapping node IDs to their public keys. A node's key is
+// registered when the node joins, through AddNode or AdmitNode, re-registered
+// when the node itself changes keys, and dropped when it is removed. Nodes
+// in a system look the sender's key up in the registry before verifying an
+// update's signature, and reject updates from identities the registry does
+// not know, unsigned ones, and ones that do not verify under the registered
+// key. A node outside any system has no registry to consult and applies
+// updates without verifying them, as before.
+
+var ErrUnknownIdentity = errors.New("unknown identity")
+
+// KeyRegistry maps node IDs to their public keys
+type KeyRegistry struct {
+	keys map[string]crypto.PublicKey
+	Lock sync.RWMutex
+}
+
+// NewKeyRegistry creates an empty registry
+func NewKeyRegistry() *KeyRegistry {
+	return &KeyRegistry{keys: make(map[string]crypto.PublicKey)}
+}
+
+// Register binds id to key, replacing any key it had
+func (r *KeyRegistry) Register(id string, key crypto.PublicKey) error {
+	if crypto.SchemeOf(key) == "" {
+		return fmt.Errorf("node %s: %w: %T", id, crypto.ErrUnsupportedKey, key)
+	}
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	r.keys[id] = key
+	return nil
+}
+
+// Remove drops id's key
+func (r *KeyRegistry) Remove(id string) {
+	if r == nil {
+		return
+	}
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	delete(r.keys, id)
+}
+
+// Lookup returns id's registered key
+func (r *KeyRegistry) Lookup(id string) (crypto.PublicKey, error) {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+	key, exists := r.keys[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownIdentity, id)
+	}
+	return key, nil
+}
+
+// IDs returns the registered node IDs in order
+func (r *KeyRegistry) IDs() []string {
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+	return sortedKeys(r.keys)
+}
+
+// clone returns a copy sharing the keys, which are immutable
+func (r *KeyRegistry) clone() *KeyRegistry {
+	if r == nil {
+		return nil
+	}
+	r.Lock.RLock()
+	defer r.Lock.RUnlock()
+	clone := NewKeyRegistry()
+	for id, key := range r.keys {
+		clone.keys[id] = key
+	}
+	return clone
+}
+
+// register adds the node's key to the system's registry and has the node
+// verify updates against it
+func (s *System) register(node *Node) {
+	if s.Keys == nil {
+		return
+	}
+	node.Lock.Lock()
+	defer node.Lock.Unlock()
+	node.Registry = s.Keys
+	s.Keys.Register(node.ID, node.PublicKey)
+}
+
+// verifySender checks an update's signature against the key registered for
+// its sender. The caller must hold n.Lock.
+func (n *Node) verifySender(update *ClockUpdate) error {
+	if n.Registry == nil {
+		return nil
+	}
+	key, err := n.Registry.Lookup(update.NodeID)
+	if err != nil {
+		return err
+	}
+	if update.Signature == "" || !VerifyClockUpdate(key, update) {
+		return fmt.Errorf("%w: update from %s", crypto.ErrSignatureInvalid, update.NodeID)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// TestRegistryRejectsUnknownAndForged tests that updates verify only under the sender's registered key
+func TestRegistryRejectsUnknownAndForged(t *testing.T) {
+	system := newSchemeSystem(t, crypto.SchemeECDSA)
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	if ids := system.Keys.IDs(); len(ids) != 4 {
+		t.Fatalf("Expected every node registered, got %v", ids)
+	}
+
+	// An outsider signing with its own key under a member's ID
+	outsider, err := NewNode("A", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.VerifyAndApplyClockUpdate(outsider.GetClockUpdate()) {
+		t.Error("Expected an update signed with an unregistered key to be rejected")
+	}
+	stranger, err := NewNode("Z", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.VerifyAndApplyClockUpdate(stranger.GetClockUpdate()) {
+		t.Error("Expected an update from an unknown identity to be rejected")
+	}
+	unsigned := a.GetClockUpdate()
+	unsigned.Signature = ""
+	if b.VerifyAndApplyClockUpdate(unsigned) {
+		t.Error("Expected an unsigned update to be rejected")
+	}
+	if !b.VerifyAndApplyClockUpdate(a.GetClockUpdate()) {
+		t.Error("Expected A's signed update to apply")
+	}
+}
+
+// TestRegistryFollowsKeyChanges tests that a node changing keys re-registers and a removed node is forgotten
+func TestRegistryFollowsKeyChanges(t *testing.T) {
+	system := newSchemeSystem(t, crypto.SchemeECDSA)
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	if err := a.UseSignatureScheme(crypto.SchemeEd25519); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := system.Keys.Lookup("A"); crypto.SchemeOf(key) != crypto.SchemeEd25519 {
+		t.Errorf("Expected A's new key registered, got %T", key)
+	}
+	if !b.VerifyAndApplyClockUpdate(a.GetClockUpdate()) {
+		t.Error("Expected A's update under its new key to apply")
+	}
+
+	clone := system.Clone()
+	if _, err := system.RemoveNode("D"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := system.Keys.Lookup("D"); !errors.Is(err, ErrUnknownIdentity) {
+		t.Errorf("Expected D to be forgotten, got %v", err)
+	}
+	if _, err := clone.Keys.Lookup("D"); err != nil {
+		t.Errorf("Expected the clone to keep its own registry, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Key persistence.
+//
+// A node's identity is its signing key pair, generated afresh by NewNode.
+// SaveKeys writes it to a directory so that a restarted node, or one in
+// another process, can take it back with LoadNodeKeys and UseKeys: the
+// private key as PKCS #8 PEM in <id>.key, readable only by its owner, and
+// the public key next to it in <id>.pem, the file ExportKeys writes and
+// LoadKeys reads, which can be handed to peers and auditors out of band.
+
+var ErrKeyMismatch = errors.New("public key does not match private key")
+
+// privateKeyFileExt is the extension of saved private key files
+const privateKeyFileExt = ".key"
+
+// NodeKeys is a node's signing key pair
+type NodeKeys struct {
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+// SaveKeys writes the node's key pair to dir as <id>.key and <id>.pem
+func (n *Node) SaveKeys(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	n.Lock.RLock()
+	private, err := crypto.MarshalPrivateKey(n.PrivateKey)
+	if err != nil {
+		n.Lock.RUnlock()
+		return fmt.Errorf("node %s: %w", n.ID, err)
+	}
+	public, err := crypto.MarshalPublicKey(n.PublicKey)
+	n.Lock.RUnlock()
+	if err != nil {
+		return fmt.Errorf("node %s: %w", n.ID, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, n.ID+privateKeyFileExt), private, 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, n.ID+keyFileExt), public, 0o644)
+}
+
+// LoadNodeKeys reads the key pairs saved to dir by node ID. A public key
+// saved next to a private key must match it.
+func LoadNodeKeys(dir string) (map[string]*NodeKeys, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+privateKeyFileExt))
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*NodeKeys, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, publicKey, err := crypto.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		id := strings.TrimSuffix(filepath.Base(path), privateKeyFileExt)
+		data, err = os.ReadFile(filepath.Join(dir, id+keyFileExt))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			saved, err := crypto.ParsePublicKey(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", id+keyFileExt, err)
+			}
+			if crypto.EncodePublicKey(saved) != crypto.EncodePublicKey(publicKey) {
+				return nil, fmt.Errorf("%w: node %s", ErrKeyMismatch, id)
+			}
+		}
+		keys[id] = &NodeKeys{PrivateKey: privateKey, PublicKey: publicKey}
+	}
+	return keys, nil
+}
+
+// GenerateKeys creates a key pair for each of ids with the given scheme,
+// ECDSA if empty, saving each pair to dir/keys/<id> and all public keys to
+// dir/public, the layout a cluster's nodes load their identities from
+func GenerateKeys(dir string, ids []string, scheme crypto.SignatureScheme) error {
+	identities := NewSystem()
+	for _, id := range ids {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			return err
+		}
+		if scheme != "" {
+			if err := node.UseSignatureScheme(scheme); err != nil {
+				return fmt.Errorf("node %s: %w", id, err)
+			}
+		}
+		if err := node.SaveKeys(filepath.Join(dir, "keys", id)); err != nil {
+			return err
+		}
+		identities.AddNode(node)
+	}
+	return identities.ExportKeys(filepath.Join(dir, "public"))
+}
+
+// UseKeys replaces the node's key pair with a loaded one
+func (n *Node) UseKeys(keys *NodeKeys) {
+	n.Lock.Lock()
+	defer n.Lock.Unlock()
+	n.PrivateKey, n.PublicKey = keys.PrivateKey, keys.PublicKey
+	if n.Registry != nil {
+		n.Registry.Register(n.ID, keys.PublicKey)
+	}
+}
@@ -0,0 +1,57 @@
+package bft
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// TestNodeKeysSurviveRestart tests that a node restarted with its saved keys signs updates its peers still accept
+func TestNodeKeysSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	system := newSchemeSystem(t, crypto.SchemeEd25519)
+	a := system.Nodes["A"]
+	if err := a.SaveKeys(dir); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "A.key")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the private key to be readable by its owner only, got %v, %v", info, err)
+	}
+
+	keys, err := LoadNodeKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := NewNode("A", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.UseKeys(keys["A"])
+	update := restarted.GetClockUpdate()
+	if !VerifyClockUpdate(a.PublicKey, update) {
+		t.Error("Expected the restarted node's update to verify under its old key")
+	}
+	public, err := LoadKeys(dir)
+	if err != nil || crypto.EncodePublicKey(public["A"]) != crypto.EncodePublicKey(a.PublicKey) {
+		t.Errorf("Expected the public key to be distributable, got %v", err)
+	}
+}
+
+// TestLoadNodeKeysMismatch tests that a public key file not matching the private key is refused
+func TestLoadNodeKeysMismatch(t *testing.T) {
+	dir := t.TempDir()
+	system := newSchemeSystem(t, crypto.SchemeECDSA)
+	system.Nodes["A"].SaveKeys(dir)
+	system.Nodes["B"].SaveKeys(dir)
+	os.Rename(filepath.Join(dir, "B.pem"), filepath.Join(dir, "A.pem"))
+	if _, err := LoadNodeKeys(dir); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("Expected ErrKeyMismatch, got %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "A.key"), []byte("not a key"), 0o600)
+	if _, err := LoadNodeKeys(dir); !errors.Is(err, crypto.ErrKeyEncoding) {
+		t.Errorf("Expected ErrKeyEncoding, got %v", err)
+	}
+}
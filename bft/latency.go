@@ -0,0 +1,128 @@
+package bft
+
+import (
+	"sort"
+	"time"
+)
+
+// End-to-end latency attribution.
+//
+// A client stamps each request when it sends it, and every hop appends a
+// stamp when it finishes a stage. The time between consecutive stamps is
+// charged to the component named by the later stamp's stage, so the sum of
+// the components is exactly the latency the client observed.
+
+// LatencyComponent is a category of time spent on an operation
+type LatencyComponent string
+
+const (
+	ComponentNetwork   LatencyComponent = "network"
+	ComponentQueueing  LatencyComponent = "queueing"
+	ComponentCrypto    LatencyComponent = "crypto"
+	ComponentConsensus LatencyComponent = "consensus"
+)
+
+// Hop stages and the component the time leading up to them is charged to
+var stageComponents = map[string]LatencyComponent{
+	"received":  ComponentNetwork,
+	"forwarded": ComponentNetwork,
+	"replied":   ComponentNetwork,
+	"dequeued":  ComponentQueueing,
+	"signed":    ComponentCrypto,
+	"verified":  ComponentCrypto,
+	"committed": ComponentConsensus,
+}
+
+// HopStamp marks the end of a stage at a node, relative to the client's send time
+type HopStamp struct {
+	Node  string
+	Stage string
+	At    time.Duration
+}
+
+// OpTiming carries the client send stamp and per-hop stamps of one operation
+type OpTiming struct {
+	RequestID  string
+	Client     string
+	ClientSent time.Time
+	Hops       []HopStamp
+}
+
+// NewOpTiming starts timing a request at the client
+func NewOpTiming(requestID, client string) *OpTiming {
+	return &OpTiming{
+		RequestID:  requestID,
+		Client:     client,
+		ClientSent: time.Now(),
+	}
+}
+
+// Stamp records that node finished stage after spending elapsed in it
+func (t *OpTiming) Stamp(node, stage string, elapsed time.Duration) {
+	t.Hops = append(t.Hops, HopStamp{Node: node, Stage: stage, At: t.Total() + elapsed})
+}
+
+// Total returns the time from the client's send to the last stamp
+func (t *OpTiming) Total() time.Duration {
+	if len(t.Hops) == 0 {
+		return 0
+	}
+	return t.Hops[len(t.Hops)-1].At
+}
+
+// Breakdown splits the total latency into components
+func (t *OpTiming) Breakdown() map[LatencyComponent]time.Duration {
+	breakdown := make(map[LatencyComponent]time.Duration)
+	var previous time.Duration
+	for _, hop := range t.Hops {
+		breakdown[stageComponents[hop.Stage]] += hop.At - previous
+		previous = hop.At
+	}
+	return breakdown
+}
+
+// LatencyResults summarizes the breakdowns of many operations for the
+// results exporter as mean milliseconds per component
+func LatencyResults(timings []*OpTiming) map[string]float64 {
+	results := make(map[string]float64)
+	if len(timings) == 0 {
+		return results
+	}
+	totals := make(map[LatencyComponent]time.Duration)
+	var total time.Duration
+	for _, timing := range timings {
+		for component, d := range timing.Breakdown() {
+			totals[component] += d
+		}
+		total += timing.Total()
+	}
+	n := float64(len(timings))
+	for component, d := range totals {
+		results["latency_"+string(component)+"_ms"] = float64(d.Microseconds()) / 1000 / n
+	}
+	results["latency_total_ms"] = float64(total.Microseconds()) / 1000 / n
+	return results
+}
+
+// quorumRoundTrip returns the round trip from leader to the 2f+1-th nearest
+// reachable voter, the time the consensus phase needs to gather a quorum.
+// The caller must hold s.Lock.
+func (s *System) quorumRoundTrip(leader *Node) time.Duration {
+	voters := s.voters()
+	f := s.faultThreshold(len(voters))
+	var latencies []time.Duration
+	for _, node := range voters {
+		if s.reachable(node) {
+			latencies = append(latencies, s.regionLatency(leader.Region, node.Region))
+		}
+	}
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	quorum := 2*f + 1
+	if quorum > len(latencies) {
+		quorum = len(latencies)
+	}
+	return 2 * latencies[quorum-1]
+}
@@ -0,0 +1,63 @@
+package bft
+
+import (
+	"testing"
+	"time"
+)
+
+// TestOpTimingBreakdown tests that hop stamps are charged to the right components
+func TestOpTimingBreakdown(t *testing.T) {
+	timing := NewOpTiming("w1", "client")
+	timing.Stamp("G", "received", 5*time.Millisecond)
+	timing.Stamp("A", "forwarded", 100*time.Millisecond)
+	timing.Stamp("A", "dequeued", 3*time.Millisecond)
+	timing.Stamp("A", "signed", 1*time.Millisecond)
+	timing.Stamp("A", "committed", 40*time.Millisecond)
+	timing.Stamp("G", "replied", 100*time.Millisecond)
+	timing.Stamp("client", "replied", 5*time.Millisecond)
+
+	breakdown := timing.Breakdown()
+	expected := map[LatencyComponent]time.Duration{
+		ComponentNetwork:   210 * time.Millisecond,
+		ComponentQueueing:  3 * time.Millisecond,
+		ComponentCrypto:    1 * time.Millisecond,
+		ComponentConsensus: 40 * time.Millisecond,
+	}
+	var sum time.Duration
+	for component, d := range expected {
+		if breakdown[component] != d {
+			t.Errorf("Expected %s = %v, got %v", component, d, breakdown[component])
+		}
+		sum += breakdown[component]
+	}
+	if sum != timing.Total() || timing.Total() != 254*time.Millisecond {
+		t.Errorf("Expected components to add up to total 254ms, got %v of %v", sum, timing.Total())
+	}
+}
+
+// TestWriteLatencyAttribution tests the breakdown produced by the write path
+func TestWriteLatencyAttribution(t *testing.T) {
+	system := newGeoSystem(t)
+	system.QueueDelay = 7 * time.Millisecond
+
+	result, err := system.SubmitWrite("ap-south", "G", "x", "1")
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	breakdown := result.Timing.Breakdown()
+	if breakdown[ComponentQueueing] != 7*time.Millisecond {
+		t.Errorf("Expected queueing of 7ms, got %v", breakdown[ComponentQueueing])
+	}
+	if breakdown[ComponentCrypto] <= 0 {
+		t.Errorf("Expected signing time to be attributed to crypto")
+	}
+	// Four nodes tolerate f=1, so a quorum of three: A, B (us-east) and D (eu-west)
+	if breakdown[ComponentConsensus] != 2*DefaultCrossRegionLatency {
+		t.Errorf("Expected consensus round trip to eu-west, got %v", breakdown[ComponentConsensus])
+	}
+
+	results := LatencyResults([]*OpTiming{result.Timing})
+	if results["latency_queueing_ms"] != 7 {
+		t.Errorf("Expected exported queueing of 7ms, got %v", results["latency_queueing_ms"])
+	}
+}
@@ -0,0 +1,221 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Leader leases.
+//
+// Confirming leadership with a quorum on every read costs a round trip. A
+// lease removes it: every successful heartbeat round also grants the leader
+// a lease, and the followers that acknowledged it promise not to elect
+// another leader until Duration has passed on their clocks. While the lease
+// holds, no other leader can exist, so the leader answers reads from its own
+// store.
+//
+// The leader measures the lease on its own clock, which may run slow, so it
+// only trusts the lease for Duration*(1-MaxDrift). When a heartbeat round
+// fails the leader assumes it is partitioned and drops the lease at once;
+// when the lease runs out it falls back to quorum-confirmed ReadIndex reads,
+// which a partitioned leader cannot complete.
+
+var ErrLeaseActive = errors.New("previous leader's lease has not expired")
+
+// LeaseConfig bounds leader leases
+type LeaseConfig struct {
+	Duration time.Duration
+	MaxDrift float64 // Largest relative clock drift between nodes the lease tolerates
+}
+
+// LeaseStats counts how reads were served
+type LeaseStats struct {
+	LocalReads    int
+	QuorumReads   int
+	Renewals      int
+	RenewFailures int
+}
+
+// LeasedReads serves linearizable reads, locally while the leader holds a lease
+type LeasedReads struct {
+	System *System
+	Config LeaseConfig
+	Now    func() time.Duration // Real time
+	Drift  map[string]float64   // Fraction by which a node's clock runs slow
+	Stats  LeaseStats
+
+	leaseStart    map[string]time.Duration // Per lease holder, on its own clock
+	promisedUntil time.Duration            // Real time before which followers will not elect
+}
+
+// NewLeasedReads creates a lease manager for system's current leader
+func NewLeasedReads(system *System, config LeaseConfig, now func() time.Duration) *LeasedReads {
+	return &LeasedReads{
+		System:     system,
+		Config:     config,
+		Now:        now,
+		Drift:      make(map[string]float64),
+		leaseStart: make(map[string]time.Duration),
+	}
+}
+
+// local returns the time on a node's clock
+func (l *LeasedReads) local(nodeID string) time.Duration {
+	return time.Duration(float64(l.Now()) * (1 - l.Drift[nodeID]))
+}
+
+// Valid reports whether nodeID believes it holds a lease it may still trust.
+// Each holder judges only by its own clock, so a deposed leader may still
+// believe in its lease.
+func (l *LeasedReads) Valid(nodeID string) bool {
+	start, held := l.leaseStart[nodeID]
+	trusted := time.Duration(float64(l.Config.Duration) * (1 - l.Config.MaxDrift))
+	return held && l.local(nodeID)-start < trusted
+}
+
+// Heartbeat has the leader confirm a quorum and renew its lease. A failed
+// round is taken as a partition and drops the lease.
+func (l *LeasedReads) Heartbeat() error {
+	leaderID := l.System.GetLeader()
+	l.System.Lock.RLock()
+	leader, exists := l.System.Nodes[leaderID]
+	var err error
+	if !exists {
+		err = ErrNoLeader
+	} else {
+		_, err = l.System.heartbeatQuorum(leader)
+	}
+	l.System.Lock.RUnlock()
+
+	if err != nil {
+		l.Stats.RenewFailures++
+		delete(l.leaseStart, leaderID)
+		return err
+	}
+	l.Stats.Renewals++
+	l.leaseStart[leaderID] = l.local(leaderID)
+	l.promisedUntil = l.Now() + l.Config.Duration
+	return nil
+}
+
+// Read reads key at nodeID on behalf of a client in clientRegion that can
+// reach only that node. The node answers locally under a valid lease and
+// otherwise must be the leader and confirm a quorum.
+func (l *LeasedReads) Read(clientRegion, nodeID, key string) (result *ReadResult, err error) {
+	op := l.System.recordInvoke(clientRegion, OpRead, key, "")
+	defer func() {
+		if err != nil {
+			l.System.recordComplete(op, "", 0, false)
+		} else {
+			l.System.recordComplete(op, result.Value, result.Index, true)
+		}
+	}()
+
+	l.System.Lock.RLock()
+	node, exists := l.System.Nodes[nodeID]
+	l.System.Lock.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, nodeID)
+	}
+
+	if !l.Valid(nodeID) {
+		if l.System.GetLeader() != nodeID {
+			return nil, fmt.Errorf("%w: %s is not the leader", ErrNoLeader, nodeID)
+		}
+		if err := l.Heartbeat(); err != nil {
+			return nil, err
+		}
+		l.Stats.QuorumReads++
+	} else {
+		l.Stats.LocalReads++
+	}
+
+	node.Lock.RLock()
+	entry := node.Store.Entries[key]
+	readIndex := node.Store.CommitIndex
+	value, err := node.plaintext(entry)
+	node.Lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return &ReadResult{
+		Key:       key,
+		Value:     value,
+		Index:     entry.Index,
+		ServedBy:  nodeID,
+		Label:     stalenessLabel(0),
+		ReadIndex: readIndex,
+	}, nil
+}
+
+// Elect installs nodeID as leader once the previous lease has run out
+func (l *LeasedReads) Elect(nodeID string) error {
+	if now := l.Now(); now < l.promisedUntil {
+		return fmt.Errorf("%w: %v remaining", ErrLeaseActive, l.promisedUntil-now)
+	}
+	l.System.SetLeader(nodeID)
+	return nil
+}
+
+// LeaseScenarioResult is the outcome of RunLeaseScenario
+type LeaseScenarioResult struct {
+	Report    *AnomalyReport
+	Stats     LeaseStats
+	ElectedAt time.Duration
+}
+
+// RunLeaseScenario partitions leader A of a four-node cluster right after a
+// write, while a client keeps reading x from A and the others elect B and
+// overwrite x. A's clock runs slow by drift. With heartbeats the leader
+// renews every tick and notices the partition; without them it relies on
+// lease expiry alone. The anomaly report shows whether any read was stale.
+func RunLeaseScenario(config LeaseConfig, drift float64, heartbeats bool) (*LeaseScenarioResult, error) {
+	system := NewSystem()
+	for _, id := range []string{"A", "B", "C", "D"} {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			return nil, err
+		}
+		system.AddNode(node)
+	}
+	system.SetLeader("A")
+
+	const tick = 5 * time.Millisecond
+	var now, step time.Duration
+	system.History = NewHistory()
+	system.History.Now = func() time.Duration {
+		step += time.Microsecond
+		return now + step
+	}
+	leases := NewLeasedReads(system, config, func() time.Duration { return now })
+	leases.Drift["A"] = drift
+
+	if err := leases.Heartbeat(); err != nil {
+		return nil, err
+	}
+	if _, err := system.SubmitWrite("", "A", "x", "1"); err != nil {
+		return nil, err
+	}
+	system.SetPartition("A", true)
+
+	result := &LeaseScenarioResult{}
+	for now = tick; now <= 4*config.Duration; now += tick {
+		step = 0
+		if heartbeats && system.GetLeader() == "A" {
+			leases.Heartbeat()
+		}
+		if system.GetLeader() == "A" && leases.Elect("B") == nil {
+			result.ElectedAt = now
+			leases.Heartbeat()
+			if _, err := system.SubmitWrite("", "B", "x", "2"); err != nil {
+				return nil, err
+			}
+		}
+		leases.Read("", "A", "x")
+		leases.Read("", "B", "x")
+	}
+	result.Report = DetectAnomalies("lease", system.History)
+	result.Stats = leases.Stats
+	return result, nil
+}
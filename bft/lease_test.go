@@ -0,0 +1,69 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestLeaseNeverServesStaleReads tests lease safety across clock drift within the bound
+func TestLeaseNeverServesStaleReads(t *testing.T) {
+	config := LeaseConfig{Duration: 100 * time.Millisecond, MaxDrift: 0.1}
+	for _, heartbeats := range []bool{true, false} {
+		for _, drift := range []float64{0, 0.05, 0.1} {
+			result, err := RunLeaseScenario(config, drift, heartbeats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stale := result.Report.Counts()[StaleRead]; stale != 0 {
+				t.Errorf("heartbeats=%t drift=%g: Expected no stale reads, got %d:\n%s", heartbeats, drift, stale, result.Report)
+			}
+			if result.ElectedAt < config.Duration {
+				t.Errorf("Expected B to wait for A's lease, elected at %v", result.ElectedAt)
+			}
+			if result.Stats.LocalReads == 0 {
+				t.Errorf("Expected reads to be served locally under the lease")
+			}
+		}
+	}
+}
+
+// TestLeaseDriftBeyondBoundIsUnsafe tests that the scenario detects stale reads
+// when a leader's clock drifts more than the lease allows for
+func TestLeaseDriftBeyondBoundIsUnsafe(t *testing.T) {
+	config := LeaseConfig{Duration: 100 * time.Millisecond, MaxDrift: 0}
+	result, err := RunLeaseScenario(config, 0.3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Report.Counts()[StaleRead] == 0 {
+		t.Errorf("Expected stale reads when drift exceeds the bound")
+	}
+}
+
+// TestLeaseFallsBackToQuorum tests reads after the lease runs out
+func TestLeaseFallsBackToQuorum(t *testing.T) {
+	system := newGeoSystem(t)
+	var now time.Duration
+	leases := NewLeasedReads(system, LeaseConfig{Duration: 50 * time.Millisecond}, func() time.Duration { return now })
+	if err := leases.Heartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leases.Read("us-east", "A", "x"); err != nil || leases.Stats.LocalReads != 1 {
+		t.Fatalf("Expected a local read under the lease, got %v", err)
+	}
+
+	now = 60 * time.Millisecond
+	if _, err := leases.Read("us-east", "A", "x"); err != nil || leases.Stats.QuorumReads != 1 {
+		t.Errorf("Expected a quorum read after expiry, got %v", err)
+	}
+
+	now = 200 * time.Millisecond
+	system.SetPartition("A", true)
+	if _, err := leases.Read("us-east", "A", "x"); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Expected a partitioned leader to refuse reads, got %v", err)
+	}
+	if err := leases.Elect("B"); err != nil {
+		t.Errorf("Expected election to proceed once the lease ran out, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package bft
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Linearizability checking.
+//
+// The anomaly detectors look for known bad patterns; the checker asks the
+// stronger question of whether any order of a history's operations explains
+// every result while respecting real time: an operation that returned
+// before another was invoked must come first. Each key is a register,
+// written by writes and empty until then, and is checked on its own, as
+// linearizability composes. The search is Wing and Gong's, memoized on the
+// set of operations placed and the register's value as in Lowe's and
+// Knossos' checkers, so histories of hundreds of operations per key stay
+// cheap.
+//
+// Successful operations must be placed. A failed write may or may not have
+// taken effect, so it may be placed anywhere after its invocation or left
+// out; a failed read tells nothing and is ignored. Operations recorded at
+// the same virtual instant are ordered by their recorded positions, since
+// a simulation runs its clients one after the other.
+
+// LinearizabilitySearchLimit bounds the states explored per key before the
+// checker gives up
+var LinearizabilitySearchLimit = 1 << 20
+
+// LinearizabilityVerdict is the outcome of checking a history
+type LinearizabilityVerdict string
+
+const (
+	Linearizable           LinearizabilityVerdict = "linearizable"
+	NotLinearizable        LinearizabilityVerdict = "NOT linearizable"
+	LinearizabilityUnknown LinearizabilityVerdict = "unknown" // The search gave up
+)
+
+// LinearizabilityViolation is a key whose operations no order explains
+type LinearizabilityViolation struct {
+	Key         string
+	Ops         []int // The order found that explains the most successful operations
+	Stuck       []int // The operations none of which can come next
+	Description string
+}
+
+// LinearizabilityReport is the result of checking one scenario's history
+type LinearizabilityReport struct {
+	Scenario   string
+	Verdict    LinearizabilityVerdict
+	Ops        int      // Operations checked
+	Keys       int      // Registers checked
+	States     int      // Search states explored
+	GaveUp     []string // Keys whose search hit LinearizabilitySearchLimit
+	Violations []LinearizabilityViolation
+}
+
+// CheckLinearizability checks whether a recorded history is linearizable
+func CheckLinearizability(scenario string, history *History) *LinearizabilityReport {
+	report := &LinearizabilityReport{Scenario: scenario, Verdict: Linearizable}
+	byKey := make(map[string][]HistoryOp)
+	for _, op := range history.Snapshot() {
+		if op.Kind == OpRead && !op.OK {
+			continue
+		}
+		byKey[op.Key] = append(byKey[op.Key], op)
+		report.Ops++
+	}
+	for _, key := range sortedKeys(byKey) {
+		report.Keys++
+		search := newRegisterSearch(byKey[key])
+		ok := search.run("", search.required)
+		report.States += search.states
+		switch {
+		case ok:
+		case search.gaveUp:
+			report.GaveUp = append(report.GaveUp, key)
+		default:
+			report.Violations = append(report.Violations, search.violation(key))
+		}
+	}
+	if len(report.Violations) > 0 {
+		report.Verdict = NotLinearizable
+	} else if len(report.GaveUp) > 0 {
+		report.Verdict = LinearizabilityUnknown
+	}
+	return report
+}
+
+// String renders the report for terminal output
+func (r *LinearizabilityReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Linearizability: %s (%d operations on %d keys, %d states searched)\n", r.Verdict, r.Ops, r.Keys, r.States)
+	for _, v := range r.Violations {
+		fmt.Fprintf(&b, "  [%s] %s\n", v.Key, v.Description)
+	}
+	for _, key := range r.GaveUp {
+		fmt.Fprintf(&b, "  [%s] search gave up after %d states\n", key, LinearizabilitySearchLimit)
+	}
+	return b.String()
+}
+
+// precedes reports whether a returned before b was invoked
+func precedes(a, b HistoryOp) bool {
+	if !a.OK {
+		return false // It may never have returned
+	}
+	if a.Complete != b.Invoke {
+		return a.Complete < b.Invoke
+	}
+	return a.Returned > 0 && b.Called > 0 && a.Returned < b.Called
+}
+
+// registerSearch looks for an order of the operations on one register
+type registerSearch struct {
+	ops      []HistoryOp
+	required int    // Successful operations, which must all be placed
+	placed   []byte // Bit set of the operations placed so far
+	order    []int
+	visited  map[string]bool
+	states   int
+	gaveUp   bool
+	best     []int  // The order placing the most successful operations
+	placedOK int    // Successful operations in best
+	value    string // The register's value after best
+	stuck    []int
+}
+
+func newRegisterSearch(ops []HistoryOp) *registerSearch {
+	search := &registerSearch{ops: ops, placed: make([]byte, (len(ops)+7)/8), visited: make(map[string]bool)}
+	for _, op := range ops {
+		if op.OK {
+			search.required++
+		}
+	}
+	return search
+}
+
+func (r *registerSearch) isPlaced(i int) bool {
+	return r.placed[i/8]&(1<<(i%8)) != 0
+}
+
+func (r *registerSearch) flip(i int) {
+	r.placed[i/8] ^= 1 << (i % 8)
+}
+
+// minimal reports whether operation i may come next: no successful
+// operation left to place returned before it was invoked
+func (r *registerSearch) minimal(i int) bool {
+	for j, op := range r.ops {
+		if j != i && !r.isPlaced(j) && precedes(op, r.ops[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// run places the remaining operations after a prefix leaving the register
+// at value, and reports whether it could place every successful one
+func (r *registerSearch) run(value string, left int) bool {
+	if left == 0 {
+		return true
+	}
+	state := string(r.placed) + "\x00" + value
+	if r.visited[state] {
+		return false
+	}
+	r.visited[state] = true
+	if r.states++; r.states > LinearizabilitySearchLimit {
+		r.gaveUp = true
+		return false
+	}
+	for i, op := range r.ops {
+		if r.isPlaced(i) || !r.minimal(i) {
+			continue
+		}
+		next := value
+		if op.Kind == OpWrite {
+			next = op.Value
+		} else if op.Value != value {
+			continue
+		}
+		r.flip(i)
+		r.order = append(r.order, i)
+		remaining := left
+		if op.OK {
+			remaining--
+		}
+		found := r.run(next, remaining)
+		r.flip(i)
+		r.order = r.order[:len(r.order)-1]
+		if found {
+			return true
+		}
+		if r.gaveUp {
+			return false
+		}
+	}
+	if placedOK := r.required - left; r.best == nil || placedOK > r.placedOK || placedOK == r.placedOK && len(r.order) < len(r.best) {
+		r.best, r.placedOK = append([]int{}, r.order...), placedOK
+		r.value = value
+		r.stuck = r.blocked(value)
+	}
+	return false
+}
+
+// blocked returns the successful operations that could come next but for
+// the register's value, or if none, all that could come next
+func (r *registerSearch) blocked(value string) []int {
+	var next, blocked []int
+	for i, op := range r.ops {
+		if !op.OK || r.isPlaced(i) || !r.minimal(i) {
+			continue
+		}
+		next = append(next, i)
+		if op.Kind == OpRead && op.Value != value {
+			blocked = append(blocked, i)
+		}
+	}
+	if len(blocked) > 0 {
+		return blocked
+	}
+	return next
+}
+
+// violation describes the best order found and what blocked it
+func (r *registerSearch) violation(key string) LinearizabilityViolation {
+	v := LinearizabilityViolation{Key: key}
+	for _, i := range r.best {
+		v.Ops = append(v.Ops, r.ops[i].ID)
+	}
+	var blocked []string
+	for _, i := range r.stuck {
+		op := r.ops[i]
+		v.Stuck = append(v.Stuck, op.ID)
+		if op.Kind == OpRead {
+			blocked = append(blocked, fmt.Sprintf("read %d returning %q", op.ID, op.Value))
+		} else {
+			blocked = append(blocked, fmt.Sprintf("write %d of %q", op.ID, op.Value))
+		}
+	}
+	v.Description = fmt.Sprintf("after ops %v %s holds %q, and no order lets %s come next",
+		v.Ops, key, r.value, strings.Join(blocked, " or "))
+	return v
+}
@@ -0,0 +1,143 @@
+package bft
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// registerOp builds a register operation for checker tests
+func registerOp(id int, kind OpKind, value string, invoke, complete time.Duration, ok bool) HistoryOp {
+	return HistoryOp{ID: id, Kind: kind, Key: "x", Value: value, Invoke: invoke, Complete: complete, OK: ok}
+}
+
+// TestCheckLinearizability tests the checker against histories with known verdicts
+func TestCheckLinearizability(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     []HistoryOp
+		verdict LinearizabilityVerdict
+		stuck   []int
+	}{
+		{
+			name: "read after write",
+			ops: []HistoryOp{
+				registerOp(0, OpWrite, "1", 0, 1, true),
+				registerOp(1, OpRead, "1", 2, 3, true),
+			},
+			verdict: Linearizable,
+		},
+		{
+			name: "stale read",
+			ops: []HistoryOp{
+				registerOp(0, OpWrite, "1", 0, 1, true),
+				registerOp(1, OpRead, "", 2, 3, true),
+			},
+			verdict: NotLinearizable,
+			stuck:   []int{1},
+		},
+		{
+			name: "concurrent read of the old value",
+			ops: []HistoryOp{
+				registerOp(0, OpWrite, "1", 0, 5, true),
+				registerOp(1, OpRead, "", 1, 2, true),
+			},
+			verdict: Linearizable,
+		},
+		{
+			name: "reads disagree on the order",
+			ops: []HistoryOp{
+				registerOp(0, OpWrite, "1", 0, 10, true),
+				registerOp(1, OpRead, "1", 1, 2, true),
+				registerOp(2, OpRead, "", 3, 4, true),
+			},
+			verdict: NotLinearizable,
+			stuck:   []int{2},
+		},
+		{
+			name: "failed write may have taken effect",
+			ops: []HistoryOp{
+				registerOp(0, OpWrite, "1", 0, 1, true),
+				registerOp(1, OpWrite, "2", 2, 3, false),
+				registerOp(2, OpRead, "2", 4, 5, true),
+				registerOp(3, OpRead, "2", 6, 7, true),
+			},
+			verdict: Linearizable,
+		},
+		{
+			name: "failed read tells nothing",
+			ops: []HistoryOp{
+				registerOp(0, OpWrite, "1", 0, 1, true),
+				registerOp(1, OpRead, "", 2, 3, false),
+			},
+			verdict: Linearizable,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history := NewHistory()
+			history.Ops = test.ops
+			report := CheckLinearizability(test.name, history)
+			if report.Verdict != test.verdict {
+				t.Fatalf("Expected %s, got %s", test.verdict, report)
+			}
+			if test.stuck != nil && !reflect.DeepEqual(report.Violations[0].Stuck, test.stuck) {
+				t.Errorf("Expected ops %v to be stuck, got %s", test.stuck, report)
+			}
+		})
+	}
+}
+
+// TestCheckLinearizabilityOrdersSameInstant tests that operations recorded at the same virtual instant keep their recorded order
+func TestCheckLinearizabilityOrdersSameInstant(t *testing.T) {
+	history := NewHistory()
+	history.Now = func() time.Duration { return 0 }
+	write := history.Invoke("client@us-east", "", OpWrite, "x", "1")
+	history.Complete(write, "", 1, true)
+	read := history.Invoke("client@eu-west", "", OpRead, "x", "")
+	history.Complete(read, "", 0, true)
+	if report := CheckLinearizability("same-instant", history); report.Verdict != NotLinearizable {
+		t.Errorf("Expected the read to follow the write, got %s", report)
+	}
+
+	// Without recorded positions the two are concurrent
+	ops := history.Snapshot()
+	for i := range ops {
+		ops[i].Called, ops[i].Returned = 0, 0
+	}
+	history.Ops = ops
+	if report := CheckLinearizability("same-instant", history); report.Verdict != Linearizable {
+		t.Errorf("Expected concurrent operations to linearize, got %s", report)
+	}
+}
+
+// TestCheckLinearizabilityGivesUp tests that a search past the limit is inconclusive
+func TestCheckLinearizabilityGivesUp(t *testing.T) {
+	saved := LinearizabilitySearchLimit
+	LinearizabilitySearchLimit = 1
+	defer func() { LinearizabilitySearchLimit = saved }()
+
+	history := NewHistory()
+	history.Ops = []HistoryOp{
+		registerOp(0, OpWrite, "1", 0, 10, true),
+		registerOp(1, OpWrite, "2", 0, 10, true),
+		registerOp(2, OpRead, "1", 11, 12, true),
+	}
+	report := CheckLinearizability("limit", history)
+	if report.Verdict != LinearizabilityUnknown || !reflect.DeepEqual(report.GaveUp, []string{"x"}) {
+		t.Errorf("Expected the search of x to give up, got %s", report)
+	}
+}
+
+// TestSimulatePartitionLinearizability tests that the partition simulation reports the stale local read as a violation
+func TestSimulatePartitionLinearizability(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	results := SimulatePartition(1, nil, nil, nil, nil, nil)
+	if results["linearizable"] != 0 || results["linearizability_violations"] != 1 {
+		t.Errorf("Expected one violation, got linearizable=%v violations=%v", results["linearizable"], results["linearizability_violations"])
+	}
+}
@@ -0,0 +1,139 @@
+package bft
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Asymmetric links.
+//
+// Neighbors says who a node sends clock updates to, so a link listed on one
+// side only already carries updates in one direction. A LinkProfile shapes
+// a single direction further: it can be down, so the receiver hears nothing
+// from the sender while still being heard itself, lose a share of the
+// updates sent over it, or take a different latency than the regions of
+// its ends suggest. On top of its latency a direction can add jitter,
+// drawn from a uniform, half-normal or exponential distribution, and cap
+// its bandwidth, so a message takes its size over the bandwidth to
+// serialize after the ones sent over the link before it. Clock updates and
+// PBFT messages both travel this way. Losses and jitter are drawn from the
+// scheduler's random source so that a run stays reproducible by its seed;
+// without a scheduler only a link that drops everything loses messages and
+// none jitter.
+
+// JitterDistribution is how a link's random extra delay is spread
+type JitterDistribution string
+
+const (
+	JitterUniform     JitterDistribution = "uniform"     // In [0, Jitter)
+	JitterNormal      JitterDistribution = "normal"      // Half-normal with scale Jitter
+	JitterExponential JitterDistribution = "exponential" // Exponential with mean Jitter
+)
+
+// validJitter reports whether a distribution is known, uniform if empty
+func validJitter(dist JitterDistribution) error {
+	switch dist {
+	case "", JitterUniform, JitterNormal, JitterExponential:
+		return nil
+	}
+	return fmt.Errorf("unknown jitter distribution %q", dist)
+}
+
+// LinkProfile shapes one direction of a link
+type LinkProfile struct {
+	Down       bool               // Carries nothing
+	Drop       float64            // Share of messages lost, 0 to 1
+	Latency    time.Duration      // One-way latency, the region latency if zero
+	Jitter     time.Duration      // Scale of the random extra delay, none if zero
+	JitterDist JitterDistribution // Uniform if empty
+	Bandwidth  int64              // Bytes per second, unlimited if zero
+}
+
+// SetLinkProfile shapes the direction of the link from one node to another
+func (s *System) SetLinkProfile(from, to string, profile LinkProfile) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.LinkProfiles == nil {
+		s.LinkProfiles = make(map[[2]string]LinkProfile)
+	}
+	s.LinkProfiles[[2]string{from, to}] = profile
+}
+
+// LinkProfile returns the shape of the direction from one node to another,
+// the zero profile unless one was set
+func (s *System) LinkProfile(from, to string) LinkProfile {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	return s.LinkProfiles[[2]string{from, to}]
+}
+
+// linkDown reports whether either direction of a link is down. The caller
+// must hold s.Lock.
+func (s *System) linkDown(link Link) bool {
+	return s.LinkProfiles[[2]string{link[0], link[1]}].Down || s.LinkProfiles[[2]string{link[1], link[0]}].Down
+}
+
+// sendOver decides whether a message of size bytes sent from one node to
+// another gets through and returns its latency
+func (s *System) sendOver(from, to *Node, size int) (time.Duration, bool) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	return s.transit(from, to, size)
+}
+
+// transit decides whether a message of size bytes sent from one node to
+// another gets through and returns its latency: the link's or the regions'
+// latency, plus jitter, plus the wait for the link and the time to
+// serialize the message under a bandwidth cap. The caller must hold
+// s.Lock, for reading at least.
+func (s *System) transit(from, to *Node, size int) (time.Duration, bool) {
+	profile := s.LinkProfiles[[2]string{from.ID, to.ID}]
+	if profile.Down || profile.Drop >= 1 {
+		return 0, false
+	}
+	if profile.Drop > 0 && s.Scheduler != nil && s.Scheduler.Rand.Float64() < profile.Drop {
+		return 0, false
+	}
+	latency := profile.Latency
+	if latency <= 0 {
+		latency = s.regionLatency(from.Region, to.Region)
+	}
+	if profile.Jitter > 0 && s.Scheduler != nil {
+		latency += profile.jitter(s.Scheduler)
+	}
+	if profile.Bandwidth > 0 {
+		latency += s.serialize([2]string{from.ID, to.ID}, size, profile.Bandwidth)
+	}
+	return latency, true
+}
+
+// jitter draws the random extra delay of a message over the link
+func (p LinkProfile) jitter(sched *Scheduler) time.Duration {
+	switch p.JitterDist {
+	case JitterNormal:
+		return time.Duration(math.Abs(sched.Rand.NormFloat64()) * float64(p.Jitter))
+	case JitterExponential:
+		return time.Duration(sched.Rand.ExpFloat64() * float64(p.Jitter))
+	}
+	return time.Duration(sched.Rand.Int63n(int64(p.Jitter)))
+}
+
+// serialize queues a message of size bytes on a link direction capped at
+// bandwidth bytes per second and returns how long it takes until the
+// message is on the wire. Without a scheduler messages never queue.
+func (s *System) serialize(direction [2]string, size int, bandwidth int64) time.Duration {
+	wire := time.Duration(int64(size) * int64(time.Second) / bandwidth)
+	if s.Scheduler == nil {
+		return wire
+	}
+	s.linkLock.Lock()
+	defer s.linkLock.Unlock()
+	if s.linkBusy == nil {
+		s.linkBusy = make(map[[2]string]time.Duration)
+	}
+	now := s.Scheduler.Now
+	done := max(now, s.linkBusy[direction]) + wire
+	s.linkBusy[direction] = done
+	return done - now
+}
@@ -0,0 +1,188 @@
+package bft
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestLinkDirectionDown tests that a node behind a link that is down one way still receives but is not heard
+func TestLinkDirectionDown(t *testing.T) {
+	system := newGeoSystem(t)
+	system.Nodes["A"].Neighbors = []string{"D"}
+	system.Nodes["D"].Neighbors = []string{"A"}
+	system.SetLinkProfile("D", "A", LinkProfile{Down: true})
+
+	a, d := system.Nodes["A"], system.Nodes["D"]
+	a.PropagateClockUpdate(a.GetClockUpdate(), system)
+	d.PropagateClockUpdate(d.GetClockUpdate(), system)
+	if d.VectorClock.GetTimestamp("A") == 0 {
+		t.Errorf("Expected D to receive from A")
+	}
+	if a.VectorClock.GetTimestamp("D") != 0 {
+		t.Errorf("Expected A not to hear from D")
+	}
+	if geometry := AnalyzeQuorums(system, 1); len(geometry.Cut) != 1 || geometry.Cut[0] != NewLink("A", "D") {
+		t.Errorf("Expected the half-down link A-D to count as cut, got %v", geometry.Cut)
+	}
+}
+
+// TestLinkProfileDropAndLatency tests per-direction losses and latencies under the scheduler
+func TestLinkProfileDropAndLatency(t *testing.T) {
+	system := newGeoSystem(t)
+	system.Nodes["A"].Neighbors = []string{"B", "G"}
+	system.Nodes["B"].Neighbors = []string{"A"}
+	system.SetLinkProfile("A", "B", LinkProfile{Latency: 30 * time.Millisecond})
+	system.SetLinkProfile("A", "G", LinkProfile{Drop: 1})
+	scheduler := NewScheduler(1)
+	system.UseScheduler(scheduler)
+
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	a.PropagateClockUpdate(a.GetClockUpdate(), system)
+	b.PropagateClockUpdate(b.GetClockUpdate(), system)
+	if scheduler.Pending() != 2 {
+		t.Fatalf("Expected only the updates between A and B in flight, %d pending", scheduler.Pending())
+	}
+	scheduler.RunUntil(LocalLatency)
+	if a.VectorClock.GetTimestamp("B") == 0 || b.VectorClock.GetTimestamp("A") != 0 {
+		t.Errorf("Expected B to A at the region latency and A to B still in flight")
+	}
+	scheduler.Run()
+	if scheduler.Now != 30*time.Millisecond || b.VectorClock.GetTimestamp("A") == 0 {
+		t.Errorf("Expected A's update to reach B after 30ms, now %v", scheduler.Now)
+	}
+	if system.Nodes["G"].VectorClock.Len() != 0 {
+		t.Errorf("Expected the link to G to drop everything")
+	}
+}
+
+// TestScenarioLinkDirections tests that scenario links shape each direction and reject bad settings
+func TestScenarioLinkDirections(t *testing.T) {
+	scenario, err := ParseScenario([]byte(`{
+		"leader": "A",
+		"nodes": [{"id": "A", "region": "r1"}, {"id": "B", "region": "r2"}],
+		"links": [{"from": "A", "to": "B", "forward": {"latency_ms": 15}, "reverse": {"down": true, "drop": 0.5}}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := NewSystem()
+	if err := scenario.Build(system, 1); err != nil {
+		t.Fatal(err)
+	}
+	if profile := system.LinkProfile("A", "B"); profile != (LinkProfile{Latency: 15 * time.Millisecond}) {
+		t.Errorf("Expected A to B to take 15ms, got %+v", profile)
+	}
+	if profile := system.LinkProfile("B", "A"); profile != (LinkProfile{Down: true, Drop: 0.5}) {
+		t.Errorf("Expected B to A to be down, got %+v", profile)
+	}
+
+	for _, links := range []string{
+		`[{"from": "A", "to": "B", "one_way": true, "reverse": {"down": true}}]`,
+		`[{"from": "A", "to": "B", "forward": {"drop": 1.5}}]`,
+		`[{"from": "A", "to": "B", "reverse": {"latency_ms": -1}}]`,
+		`[{"from": "A", "to": "B", "forward": {"bandwidth": -1}}]`,
+		`[{"from": "A", "to": "B", "forward": {"jitter_ms": 5, "jitter": "pareto"}}]`,
+	} {
+		_, err := ParseScenario([]byte(`{"leader": "A", "nodes": [{"id": "A"}, {"id": "B"}], "links": ` + links + `}`))
+		if !errors.Is(err, ErrInvalidScenario) {
+			t.Errorf("Expected %s to be rejected, got %v", links, err)
+		}
+	}
+}
+
+// TestLinkProfileJitter tests that each jitter distribution delays within its shape and is reproducible by the seed
+func TestLinkProfileJitter(t *testing.T) {
+	system := newGeoSystem(t)
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	for _, dist := range []JitterDistribution{"", JitterUniform, JitterNormal, JitterExponential} {
+		system.SetLinkProfile("A", "B", LinkProfile{Latency: 10 * time.Millisecond, Jitter: 4 * time.Millisecond, JitterDist: dist})
+		draw := func() []time.Duration {
+			system.UseScheduler(NewScheduler(7))
+			var delays []time.Duration
+			for i := 0; i < 200; i++ {
+				latency, delivered := system.sendOver(a, b, 100)
+				if !delivered || latency < 10*time.Millisecond {
+					t.Fatalf("%s: expected at least the base latency, got %v", dist, latency)
+				}
+				delays = append(delays, latency-10*time.Millisecond)
+			}
+			return delays
+		}
+		delays := draw()
+		var total, longest time.Duration
+		for _, delay := range delays {
+			total += delay
+			longest = max(longest, delay)
+		}
+		mean := total / time.Duration(len(delays))
+		if mean < time.Millisecond || mean > 6*time.Millisecond {
+			t.Errorf("%s: expected a mean jitter of a few milliseconds, got %v", dist, mean)
+		}
+		if (dist == "" || dist == JitterUniform) && longest >= 4*time.Millisecond {
+			t.Errorf("%s: expected uniform jitter under 4ms, got %v", dist, longest)
+		}
+		if again := draw(); !reflect.DeepEqual(delays, again) {
+			t.Errorf("%s: expected the seed to reproduce the jitter", dist)
+		}
+	}
+}
+
+// TestLinkProfileBandwidth tests that a capped link serializes messages one after another
+func TestLinkProfileBandwidth(t *testing.T) {
+	system := newGeoSystem(t)
+	system.SetLinkProfile("A", "B", LinkProfile{Latency: 10 * time.Millisecond, Bandwidth: 1000})
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	if latency, _ := system.sendOver(a, b, 500); latency != 510*time.Millisecond {
+		t.Errorf("Expected 500 bytes at 1000 B/s to add 500ms without a scheduler, got %v", latency)
+	}
+	system.UseScheduler(NewScheduler(1))
+	for i, expected := range []time.Duration{510 * time.Millisecond, 1010 * time.Millisecond} {
+		if latency, _ := system.sendOver(a, b, 500); latency != expected {
+			t.Errorf("Message %d: expected %v, got %v", i, expected, latency)
+		}
+	}
+	if latency, _ := system.sendOver(b, a, 500); latency != LocalLatency {
+		t.Errorf("Expected the reverse direction to be uncapped, got %v", latency)
+	}
+	system.Scheduler.RunUntil(2 * time.Second)
+	if latency, _ := system.sendOver(a, b, 500); latency != 510*time.Millisecond {
+		t.Errorf("Expected the link to be free again, got %v", latency)
+	}
+}
+
+// TestLinkProfileShapesPBFT tests that consensus messages honor link profiles too
+func TestLinkProfileShapesPBFT(t *testing.T) {
+	system := newGeoSystem(t)
+	for _, peer := range []string{"B", "D", "G"} {
+		system.SetLinkProfile("A", peer, LinkProfile{Down: true})
+	}
+	pbft, err := NewPBFT(system, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pbft.Submit([]byte("x=1")); err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+	if pbft.Stats.Dropped == 0 {
+		t.Errorf("Expected the primary's messages over down links to be dropped, got %+v", pbft.Stats)
+	}
+}
+
+// TestLoadWANScenario tests that the sample WAN scenario shapes its cross-region links
+func TestLoadWANScenario(t *testing.T) {
+	scenario, err := LoadScenario("../docs/scenarios/wan.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := NewSystem()
+	if err := scenario.Build(system, 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := LinkProfile{Drop: 0.02, Jitter: 20 * time.Millisecond, JitterDist: JitterExponential, Bandwidth: 65536}
+	if profile := system.LinkProfile("A", "E"); profile != expected {
+		t.Errorf("Expected %+v from A to E, got %+v", expected, profile)
+	}
+}
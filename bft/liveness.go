@@ -0,0 +1,224 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Time-bounded liveness.
+//
+// Safety must hold at all times, but progress is only promised after the
+// global stabilization time (GST), once the network heals and messages
+// arrive in bounded time. The liveness checker runs an election and a
+// client from GST onward and asserts two deadlines: within Election a
+// leader must be installed that reaches a quorum, and within Commit every
+// client write still pending from before GST must be committed at every
+// honest reachable node. The measured recovery times are reported whether
+// or not the deadlines hold.
+
+var ErrLivenessViolated = errors.New("liveness bound exceeded")
+
+// LivenessBounds are the deadlines after GST
+type LivenessBounds struct {
+	Election time.Duration // T: until a leader reaching a quorum is installed
+	Commit   time.Duration // T': until all pending writes are committed
+}
+
+// pendingWrite is a client write that has not committed yet
+type pendingWrite struct {
+	key, value string
+	committed  bool
+}
+
+// LivenessChecker drives an election and a retrying client and measures
+// recovery after GST
+type LivenessChecker struct {
+	Election *Election
+	Bounds   LivenessBounds
+	Region   string // Client region
+	writes   []*pendingWrite
+}
+
+// Submit issues a client write. If it cannot commit now it stays pending
+// and is retried every tick.
+func (c *LivenessChecker) Submit(key, value string) {
+	write := &pendingWrite{key: key, value: value}
+	c.writes = append(c.writes, write)
+	c.retry(write)
+}
+
+// Tick advances the election by one tick and retries pending writes
+func (c *LivenessChecker) Tick() {
+	c.Election.Tick()
+	for _, write := range c.writes {
+		if !write.committed {
+			c.retry(write)
+		}
+	}
+}
+
+// retry submits a write through the first node that accepts it, once a
+// leader with a quorum can commit it
+func (c *LivenessChecker) retry(write *pendingWrite) {
+	if !c.leaderHasQuorum() {
+		return
+	}
+	s := c.Election.System
+	s.Lock.RLock()
+	ids := sortedKeys(s.Nodes)
+	s.Lock.RUnlock()
+	for _, id := range ids {
+		if _, err := s.SubmitWrite(c.Region, id, write.key, write.value); err == nil {
+			write.committed = true
+			return
+		}
+	}
+}
+
+// leaderHasQuorum reports whether a leader is installed that reaches a quorum
+func (c *LivenessChecker) leaderHasQuorum() bool {
+	s := c.Election.System
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	leader, exists := s.Nodes[s.Leader]
+	if !exists {
+		return false
+	}
+	_, err := s.heartbeatQuorum(leader)
+	return err == nil
+}
+
+// Pending returns the number of writes not yet committed
+func (c *LivenessChecker) Pending() int {
+	pending := 0
+	for _, write := range c.writes {
+		if !write.committed {
+			pending++
+		}
+	}
+	return pending
+}
+
+// committedEverywhere reports whether every write is in the store of every
+// honest reachable node
+func (c *LivenessChecker) committedEverywhere() bool {
+	s := c.Election.System
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	for _, write := range c.writes {
+		if !write.committed {
+			return false
+		}
+	}
+	for _, node := range s.Nodes {
+		if !s.reachable(node) || node.IsByzantine {
+			continue
+		}
+		node.Lock.RLock()
+		for _, write := range c.writes {
+			if node.Store.Entries[write.key].Value != write.value {
+				node.Lock.RUnlock()
+				return false
+			}
+		}
+		node.Lock.RUnlock()
+	}
+	return true
+}
+
+// LivenessReport is the measured recovery after GST
+type LivenessReport struct {
+	Bounds         LivenessBounds
+	Writes         int
+	ElectedAfter   time.Duration // Negative if no leader was installed
+	CommittedAfter time.Duration // Negative if writes were still pending
+	Violations     []string
+}
+
+// Err returns ErrLivenessViolated if a deadline was missed
+func (r *LivenessReport) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrLivenessViolated, strings.Join(r.Violations, "; "))
+}
+
+// Results returns the recovery times for the results exporter
+func (r *LivenessReport) Results() map[string]float64 {
+	return map[string]float64{
+		"liveness_election_ms": float64(r.ElectedAfter.Milliseconds()),
+		"liveness_commit_ms":   float64(r.CommittedAfter.Milliseconds()),
+		"liveness_violations":  float64(len(r.Violations)),
+	}
+}
+
+// AfterGST declares GST now and ticks until a leader is installed and all
+// writes are committed everywhere, or until maxTicks have passed
+func (c *LivenessChecker) AfterGST(maxTicks int) *LivenessReport {
+	tick := c.Election.Stats.TickDuration
+	report := &LivenessReport{Bounds: c.Bounds, Writes: len(c.writes), ElectedAfter: -1, CommittedAfter: -1}
+	for ticks := 0; ticks <= maxTicks; ticks++ {
+		if ticks > 0 {
+			c.Tick()
+		}
+		elapsed := time.Duration(ticks) * tick
+		if report.ElectedAfter < 0 && c.leaderHasQuorum() {
+			report.ElectedAfter = elapsed
+		}
+		if report.CommittedAfter < 0 && c.committedEverywhere() {
+			report.CommittedAfter = elapsed
+		}
+		if report.ElectedAfter >= 0 && report.CommittedAfter >= 0 {
+			break
+		}
+	}
+
+	switch {
+	case report.ElectedAfter < 0:
+		report.Violations = append(report.Violations, fmt.Sprintf("no leader within %d ticks", maxTicks))
+	case report.ElectedAfter > c.Bounds.Election:
+		report.Violations = append(report.Violations, fmt.Sprintf("leader after %v, bound %v", report.ElectedAfter, c.Bounds.Election))
+	}
+	switch {
+	case report.CommittedAfter < 0:
+		report.Violations = append(report.Violations, fmt.Sprintf("%d writes pending after %d ticks", c.Pending(), maxTicks))
+	case report.CommittedAfter > c.Bounds.Commit:
+		report.Violations = append(report.Violations, fmt.Sprintf("writes committed after %v, bound %v", report.CommittedAfter, c.Bounds.Commit))
+	}
+	return report
+}
+
+// RunLivenessScenario cuts off the leader of a five-node cluster for good
+// and isolates the other nodes from each other for asyncTicks while a
+// client submits writes, then heals the survivors' network at GST and
+// checks the bounds
+func RunLivenessScenario(config ElectionConfig, bounds LivenessBounds, asyncTicks, writes int) (*LivenessReport, error) {
+	system := NewSystem()
+	ids := []string{"A", "B", "C", "D", "E"}
+	for _, id := range ids {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			return nil, err
+		}
+		system.AddNode(node)
+	}
+	system.SetLeader("A")
+	checker := &LivenessChecker{Election: NewElection(system, config), Bounds: bounds}
+
+	for _, id := range ids {
+		system.SetPartition(id, true)
+	}
+	for tick := 0; tick < asyncTicks; tick++ {
+		if tick < writes {
+			checker.Submit(fmt.Sprintf("k%d", tick), fmt.Sprint(tick))
+		}
+		checker.Tick()
+	}
+	for _, id := range ids[1:] {
+		system.SetPartition(id, false)
+	}
+	maxTicks := int((bounds.Election + bounds.Commit) / checker.Election.Stats.TickDuration)
+	return checker.AfterGST(2*maxTicks + config.Timeout), nil
+}
@@ -0,0 +1,56 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestLivenessWithinBounds tests that a new leader is elected and pending writes commit after GST
+func TestLivenessWithinBounds(t *testing.T) {
+	bounds := LivenessBounds{Election: time.Second, Commit: 2 * time.Second}
+	for _, preVote := range []bool{false, true} {
+		report, err := RunLivenessScenario(ElectionConfig{Timeout: 3, PreVote: preVote}, bounds, 10, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := report.Err(); err != nil {
+			t.Errorf("Expected recovery within bounds with pre-vote %t, got %v", preVote, err)
+		}
+		if report.Writes != 3 || report.ElectedAfter <= 0 || report.CommittedAfter < report.ElectedAfter {
+			t.Errorf("Expected an election after GST followed by the commits, got %+v", report)
+		}
+		if report.Results()["liveness_election_ms"] != float64(report.ElectedAfter.Milliseconds()) {
+			t.Errorf("Expected the election time in the results, got %v", report.Results())
+		}
+	}
+}
+
+// TestLivenessBoundExceeded tests that missed deadlines are reported as violations
+func TestLivenessBoundExceeded(t *testing.T) {
+	bounds := LivenessBounds{Election: 50 * time.Millisecond, Commit: 50 * time.Millisecond}
+	report, err := RunLivenessScenario(ElectionConfig{Timeout: 3}, bounds, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(report.Err(), ErrLivenessViolated) || len(report.Violations) != 2 {
+		t.Errorf("Expected both bounds to be violated, got %v", report.Violations)
+	}
+}
+
+// TestLivenessNoQuorum tests that writes stay pending while no quorum can form
+func TestLivenessNoQuorum(t *testing.T) {
+	system, err := newChaosRun().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := &LivenessChecker{Election: NewElection(system, ElectionConfig{Timeout: 2}), Bounds: LivenessBounds{Election: time.Second, Commit: time.Second}}
+	for _, id := range []string{"C", "D", "E"} {
+		system.SetPartition(id, true)
+	}
+	checker.Submit("x", "1")
+	report := checker.AfterGST(20)
+	if checker.Pending() != 1 || report.ElectedAfter >= 0 || report.CommittedAfter >= 0 || len(report.Violations) != 2 {
+		t.Errorf("Expected no leader and a pending write, got %+v", report)
+	}
+}
@@ -0,0 +1,111 @@
+package bft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Structured logging.
+//
+// The report on Output is written for people; logs are written for tools.
+// A system with a Logger logs what happens to its nodes through log/slog:
+// every trace event, security event, fenced node and PBFT view change and
+// execution. Records come from the logger of the node concerned, which
+// tags them with the node's ID, name and region, the view the system is in
+// and, under a scheduler, the virtual time. Routine traffic logs at debug
+// level, progress at info, rejections and detections at warn, violations
+// and fencing at error. Like packet capture, the logger is not copied into
+// clones.
+
+var ErrUnknownLogFormat = errors.New("unknown log format")
+
+// LogFormat is how a logger writes its records
+type LogFormat string
+
+const (
+	LogText LogFormat = "text" // key=value pairs
+	LogJSON LogFormat = "json" // A JSON object per line
+)
+
+// DefaultLogger is attached to new systems; nil logs nothing
+var DefaultLogger *slog.Logger
+
+// NewLogger creates a logger writing records at level or above to w
+func NewLogger(w io.Writer, level slog.Level, format LogFormat) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case LogText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case LogJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownLogFormat, format)
+}
+
+// ParseLogLevel parses debug, info, warn or error, optionally with an
+// offset such as warn+2
+func ParseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// NodeLogger returns the logger of a node, tagged with its ID, name, region
+// and the current view, or the system's own for an empty ID. Without a Logger
+// it discards everything.
+func (s *System) NodeLogger(id string) *slog.Logger {
+	s.Lock.RLock()
+	logger, view := s.Logger, s.View
+	var name, region string
+	if node := s.Nodes[id]; node != nil {
+		name, region = node.Name, node.Region
+	}
+	s.Lock.RUnlock()
+	if logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	var attrs []any
+	if id != "" {
+		attrs = append(attrs, "node", id, "region", region)
+	}
+	if name != "" {
+		attrs = append(attrs, "name", name)
+	}
+	attrs = append(attrs, "view", view)
+	if s.Scheduler != nil {
+		attrs = append(attrs, "at", s.Scheduler.Now)
+	}
+	return logger.With(attrs...)
+}
+
+// traceLevel is the level a trace event logs at
+func traceLevel(t EventType) slog.Level {
+	switch t {
+	case EventViolation, EventFenced:
+		return slog.LevelError
+	case EventReject, EventDetection, EventWarning:
+		return slog.LevelWarn
+	}
+	return slog.LevelDebug
+}
+
+// logTrace logs a trace event from its node's logger
+func (s *System) logTrace(event TraceEvent) {
+	if s.Logger == nil || !s.Logger.Enabled(context.Background(), traceLevel(event.Type)) {
+		return
+	}
+	var attrs []any
+	if event.Peer != "" {
+		attrs = append(attrs, "peer", event.Peer)
+	}
+	if event.Update != nil {
+		attrs = append(attrs, slog.Group("update", "node", event.Update.NodeID, "timestamp", event.Update.Timestamp, "seq", event.Update.Seq))
+	}
+	if event.Detail != "" {
+		attrs = append(attrs, "detail", event.Detail)
+	}
+	s.NodeLogger(event.Node).Log(context.Background(), traceLevel(event.Type), string(event.Type), attrs...)
+}
@@ -0,0 +1,92 @@
+package bft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// decodeLogs parses JSON log lines
+func decodeLogs(t *testing.T, data []byte) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected a JSON record per line, got %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// TestNodeLoggerTags tests that trace events are logged with the node's ID, region and view
+func TestNodeLoggerTags(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, slog.LevelWarn, LogJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := NewSystem()
+	system.Logger = logger
+	node, err := NewNode("A", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Region = "eu-west"
+	system.AddNode(node)
+	system.SetLeader("A")
+
+	system.trace(TraceEvent{Type: EventSend, Node: "A", Peer: "B"})
+	system.trace(TraceEvent{Type: EventReject, Node: "A", Peer: "B", Detail: "stale", Update: &ClockUpdate{NodeID: "B", Seq: 3}})
+	records := decodeLogs(t, buf.Bytes())
+	if len(records) != 1 {
+		t.Fatalf("Expected only the rejection at warn level, got %v", records)
+	}
+	record := records[0]
+	if record["level"] != "WARN" || record["msg"] != "reject" || record["node"] != "A" || record["region"] != "eu-west" ||
+		record["view"] != float64(1) || record["peer"] != "B" || record["detail"] != "stale" {
+		t.Errorf("Expected a tagged rejection, got %v", record)
+	}
+	if update, _ := record["update"].(map[string]any); update["node"] != "B" || update["seq"] != float64(3) {
+		t.Errorf("Expected the update as a group, got %v", record["update"])
+	}
+}
+
+// TestLoggingOptional tests that systems log nothing without a logger and take DefaultLogger when created
+func TestLoggingOptional(t *testing.T) {
+	system := NewSystem()
+	system.trace(TraceEvent{Type: EventFenced, Node: "A"})
+	system.NodeLogger("A").Error("discarded")
+
+	var buf bytes.Buffer
+	saved := DefaultLogger
+	DefaultLogger, _ = NewLogger(&buf, slog.LevelInfo, LogText)
+	defer func() { DefaultLogger = saved }()
+	system = NewSystem()
+	if system.Clone().Logger != nil {
+		t.Error("Expected clones not to log")
+	}
+	system.trace(TraceEvent{Type: EventFenced, Node: "A", Detail: "panic"})
+	if out := buf.String(); !strings.Contains(out, "level=ERROR msg=fenced node=A") || !strings.Contains(out, "detail=panic") {
+		t.Errorf("Expected the fencing in text format, got %q", out)
+	}
+}
+
+// TestLoggerOptions tests parsing levels and rejecting unknown formats
+func TestLoggerOptions(t *testing.T) {
+	if level, err := ParseLogLevel("warn"); err != nil || level != slog.LevelWarn {
+		t.Errorf("Expected warn, got %v %v", level, err)
+	}
+	if _, err := ParseLogLevel("loud"); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+	if _, err := NewLogger(&bytes.Buffer{}, slog.LevelInfo, "xml"); !errors.Is(err, ErrUnknownLogFormat) {
+		t.Errorf("Expected ErrUnknownLogFormat, got %v", err)
+	}
+}
@@ -0,0 +1,359 @@
+package bft
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// SWIM-style membership.
+//
+// Each node keeps its own member list instead of reading the System map.
+// Every protocol period a node pings one random member. If no ack arrives it
+// asks IndirectProbes other members to ping the target on its behalf, and
+// only if none of them gets through marks the target suspect. A suspect
+// member that does not refute within SuspectTimeout periods is confirmed
+// dead. Membership changes ride on pings and acks: each update is piggybacked
+// on up to Retransmits outgoing messages, so news spreads epidemically
+// without extra traffic. A node that hears it is suspected or dead refutes
+// by raising its incarnation number, which overrides older rumors.
+//
+// Membership only exchanges updates through Outgoing and Receive, so the
+// same state machine works over the simulated network here or a real
+// transport. Probes travel over each node's peer connections (see
+// peers.go): a probe to a peer whose connection is backing off fails
+// without being sent.
+
+// MemberState is a member's liveness as seen by one node
+type MemberState int
+
+const (
+	MemberAlive MemberState = iota
+	MemberSuspect
+	MemberDead
+)
+
+func (s MemberState) String() string {
+	switch s {
+	case MemberAlive:
+		return "alive"
+	case MemberSuspect:
+		return "suspect"
+	default:
+		return "dead"
+	}
+}
+
+// MemberUpdate is a rumor about one member
+type MemberUpdate struct {
+	ID          string
+	State       MemberState
+	Incarnation uint64
+}
+
+// overrides reports whether u supersedes what is known as current
+func (u MemberUpdate) overrides(current MemberUpdate) bool {
+	if u.Incarnation != current.Incarnation {
+		return u.Incarnation > current.Incarnation
+	}
+	return u.State > current.State
+}
+
+// MembershipConfig tunes failure detection and dissemination
+type MembershipConfig struct {
+	IndirectProbes int           // Members asked to ping a target that missed its ack
+	SuspectTimeout int           // Periods a suspect has to refute before it is confirmed dead
+	Retransmits    int           // Messages each update is piggybacked on
+	Interval       time.Duration // Length of a protocol period
+}
+
+// DefaultMembershipConfig returns settings suited to small clusters
+func DefaultMembershipConfig() MembershipConfig {
+	return MembershipConfig{IndirectProbes: 2, SuspectTimeout: 3, Retransmits: 6, Interval: 200 * time.Millisecond}
+}
+
+// pendingUpdate is an update waiting to be piggybacked
+type pendingUpdate struct {
+	update MemberUpdate
+	sends  int
+}
+
+// Membership is one node's view of the cluster
+type Membership struct {
+	Self        string
+	Config      MembershipConfig
+	members     map[string]MemberUpdate
+	suspectedAt map[string]int
+	pending     []*pendingUpdate
+}
+
+// NewMembership creates a view that knows only itself and the seed nodes
+func NewMembership(self string, config MembershipConfig, seeds ...string) *Membership {
+	m := &Membership{
+		Self:        self,
+		Config:      config,
+		members:     make(map[string]MemberUpdate),
+		suspectedAt: make(map[string]int),
+	}
+	m.apply(MemberUpdate{ID: self, State: MemberAlive}, 0)
+	for _, seed := range seeds {
+		if seed != self {
+			m.members[seed] = MemberUpdate{ID: seed, State: MemberAlive}
+		}
+	}
+	return m
+}
+
+// apply records an update and queues it for dissemination
+func (m *Membership) apply(update MemberUpdate, period int) {
+	m.members[update.ID] = update
+	if update.State == MemberSuspect {
+		m.suspectedAt[update.ID] = period
+	} else {
+		delete(m.suspectedAt, update.ID)
+	}
+	for _, p := range m.pending {
+		if p.update.ID == update.ID {
+			p.update, p.sends = update, 0
+			return
+		}
+	}
+	m.pending = append(m.pending, &pendingUpdate{update: update})
+}
+
+// Receive merges updates piggybacked on a message
+func (m *Membership) Receive(updates []MemberUpdate, period int) {
+	for _, update := range updates {
+		if update.ID == m.Self {
+			self := m.members[m.Self]
+			if update.State != MemberAlive && update.Incarnation >= self.Incarnation {
+				// Refute the rumor with a newer incarnation
+				m.apply(MemberUpdate{ID: m.Self, State: MemberAlive, Incarnation: update.Incarnation + 1}, period)
+			}
+			continue
+		}
+		current, known := m.members[update.ID]
+		if !known || update.overrides(current) {
+			m.apply(update, period)
+		}
+	}
+}
+
+// Outgoing returns the updates to piggyback on the next message
+func (m *Membership) Outgoing() []MemberUpdate {
+	updates := make([]MemberUpdate, 0, len(m.pending))
+	kept := m.pending[:0]
+	for _, p := range m.pending {
+		updates = append(updates, p.update)
+		p.sends++
+		if p.sends < m.Config.Retransmits {
+			kept = append(kept, p)
+		}
+	}
+	m.pending = kept
+	return updates
+}
+
+// Reply returns the updates to piggyback on an ack to from. A sender the
+// node has never heard of is joining and gets the full member list; a sender
+// the node believes suspect or dead is told so, giving it a chance to refute.
+func (m *Membership) Reply(from string) []MemberUpdate {
+	updates := m.Outgoing()
+	current, known := m.members[from]
+	switch {
+	case !known:
+		updates = append(updates, m.Members()...)
+	case current.State != MemberAlive:
+		updates = append(updates, current)
+	}
+	return updates
+}
+
+// Suspect marks a member that missed its probe as suspect, reporting
+// whether it was alive until now
+func (m *Membership) Suspect(id string, period int) bool {
+	current, known := m.members[id]
+	if !known || current.State != MemberAlive {
+		return false
+	}
+	m.apply(MemberUpdate{ID: id, State: MemberSuspect, Incarnation: current.Incarnation}, period)
+	return true
+}
+
+// ExpireSuspects confirms suspects whose timeout has passed as dead and
+// returns them
+func (m *Membership) ExpireSuspects(period int) []string {
+	var dead []string
+	for _, id := range sortedKeys(m.suspectedAt) {
+		if period-m.suspectedAt[id] >= m.Config.SuspectTimeout {
+			m.apply(MemberUpdate{ID: id, State: MemberDead, Incarnation: m.members[id].Incarnation}, period)
+			dead = append(dead, id)
+		}
+	}
+	return dead
+}
+
+// State returns what this node believes about a member
+func (m *Membership) State(id string) (MemberState, bool) {
+	update, known := m.members[id]
+	return update.State, known
+}
+
+// Members returns the known members in ID order
+func (m *Membership) Members() []MemberUpdate {
+	members := make([]MemberUpdate, 0, len(m.members))
+	for _, id := range sortedKeys(m.members) {
+		members = append(members, m.members[id])
+	}
+	return members
+}
+
+// probeTargets returns the members this node may ping, in ID order
+func (m *Membership) probeTargets() []string {
+	var targets []string
+	for _, member := range m.Members() {
+		if member.ID != m.Self && member.State != MemberDead {
+			targets = append(targets, member.ID)
+		}
+	}
+	return targets
+}
+
+// SWIM runs the membership protocol for every node of a system over the
+// simulated network
+type SWIM struct {
+	System *System
+	Views  map[string]*Membership
+	Period int
+	ids    []string
+	rng    *rand.Rand
+}
+
+// NewSWIM gives every node a view that knows only the first node as a seed
+func NewSWIM(system *System, config MembershipConfig, seed int64) *SWIM {
+	w := &SWIM{
+		System: system,
+		Views:  make(map[string]*Membership),
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+	system.Lock.RLock()
+	w.ids = sortedKeys(system.Nodes)
+	system.Lock.RUnlock()
+	for _, id := range w.ids {
+		w.Views[id] = NewMembership(id, config, w.ids[0])
+	}
+	return w
+}
+
+// up reports whether a node can send and receive messages
+func (w *SWIM) up(id string) bool {
+	return !w.System.IsPartitioned(id) && !w.System.IsFenced(id)
+}
+
+// exchange delivers a ping from one node and its ack, reporting success
+func (w *SWIM) exchange(from, to string) bool {
+	if !w.up(from) {
+		return false
+	}
+	w.System.Lock.RLock()
+	source, target := w.System.Nodes[from], w.System.Nodes[to]
+	rtt := 2 * w.System.regionLatency(source.Region, target.Region)
+	w.System.Lock.RUnlock()
+	now := time.Duration(w.Period) * w.Views[from].Config.Interval
+	if !source.dialable(to, now) {
+		return false
+	}
+	if !w.up(to) {
+		w.capture(from, to, "swim-ping", nil, true)
+		source.peerFailed(to, now)
+		return false
+	}
+	reply := w.Views[to].Reply(from)
+	outgoing := w.Views[from].Outgoing()
+	w.capture(from, to, "swim-ping", outgoing, false)
+	w.capture(to, from, "swim-ack", reply, false)
+	w.Views[to].Receive(outgoing, w.Period)
+	w.Views[from].Receive(reply, w.Period)
+	source.peerSucceeded(to, rtt, now)
+	target.peerSucceeded(from, rtt, now)
+	return true
+}
+
+// capture records a probe message and its piggybacked updates
+func (w *SWIM) capture(from, to, kind string, updates []MemberUpdate, dropped bool) {
+	if w.System.Capture == nil {
+		return
+	}
+	w.System.Lock.RLock()
+	source, target := w.System.Nodes[from], w.System.Nodes[to]
+	latency := w.System.regionLatency(source.Region, target.Region)
+	w.System.Lock.RUnlock()
+	packet := newPacket(source, target, kind, len(kind)+memberUpdatesSize(updates), latency)
+	packet.Dropped = dropped
+	w.System.capture(packet)
+}
+
+// Tick runs one protocol period at every reachable node
+func (w *SWIM) Tick() {
+	w.Period++
+	for _, id := range w.ids {
+		if !w.up(id) {
+			continue
+		}
+		view := w.Views[id]
+		for _, dead := range view.ExpireSuspects(w.Period) {
+			w.System.audit(AuditMembership, id, dead, fmt.Sprintf("confirmed dead in period %d", w.Period))
+		}
+		targets := view.probeTargets()
+		if len(targets) == 0 {
+			continue
+		}
+		target := targets[w.rng.Intn(len(targets))]
+		if w.exchange(id, target) {
+			continue
+		}
+		if !w.probeIndirectly(view, target) && view.Suspect(target, w.Period) {
+			w.System.audit(AuditMembership, id, target, fmt.Sprintf("suspected in period %d", w.Period))
+		}
+	}
+}
+
+// probeIndirectly asks other members to ping target on view's behalf
+func (w *SWIM) probeIndirectly(view *Membership, target string) bool {
+	var helpers []string
+	for _, id := range view.probeTargets() {
+		if id != target {
+			helpers = append(helpers, id)
+		}
+	}
+	w.rng.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	if len(helpers) > view.Config.IndirectProbes {
+		helpers = helpers[:view.Config.IndirectProbes]
+	}
+	for _, helper := range helpers {
+		if w.exchange(view.Self, helper) && w.exchange(helper, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Agreed reports whether every reachable node sees the reachable nodes as
+// alive and has confirmed the unreachable ones dead
+func (w *SWIM) Agreed() bool {
+	for _, id := range w.ids {
+		if !w.up(id) {
+			continue
+		}
+		for _, other := range w.ids {
+			state, known := w.Views[id].State(other)
+			if w.up(other) && (!known || state != MemberAlive) {
+				return false
+			}
+			if !w.up(other) && known && state != MemberDead {
+				return false
+			}
+		}
+	}
+	return true
+}
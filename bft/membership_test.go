@@ -0,0 +1,77 @@
+package bft
+
+import (
+	"testing"
+)
+
+// newSWIMCluster builds a SWIM driver over n nodes named A, B, C, ...
+func newSWIMCluster(t *testing.T, n int, seed int64) *SWIM {
+	t.Helper()
+	return NewSWIM(newTestSystem(t, nodeIDs(n)), DefaultMembershipConfig(), seed)
+}
+
+// runUntilAgreed ticks until all reachable views agree, returning the periods taken
+func runUntilAgreed(swim *SWIM, limit int) int {
+	for i := 1; i <= limit; i++ {
+		swim.Tick()
+		if swim.Agreed() {
+			return i
+		}
+	}
+	return -1
+}
+
+// TestSWIMDisseminatesMembership tests that nodes learn the full list from a seed
+func TestSWIMDisseminatesMembership(t *testing.T) {
+	swim := newSWIMCluster(t, 7, 1)
+	if periods := runUntilAgreed(swim, 50); periods < 0 {
+		t.Fatalf("Expected membership to converge, views: %v", swim.Views["G"].Members())
+	}
+}
+
+// TestSWIMDetectsFailure tests suspicion and confirmation of a partitioned node
+func TestSWIMDetectsFailure(t *testing.T) {
+	swim := newSWIMCluster(t, 7, 2)
+	runUntilAgreed(swim, 50)
+
+	swim.System.SetPartition("E", true)
+	if periods := runUntilAgreed(swim, 100); periods < 0 {
+		t.Fatalf("Expected E to be confirmed dead everywhere")
+	}
+	for _, id := range []string{"A", "B", "C", "D", "F", "G"} {
+		if state, _ := swim.Views[id].State("E"); state != MemberDead {
+			t.Errorf("Expected %s to see E as dead, got %v", id, state)
+		}
+	}
+}
+
+// TestSWIMRefutesSuspicion tests that a live node overrides a rumor about itself
+func TestSWIMRefutesSuspicion(t *testing.T) {
+	view := NewMembership("B", DefaultMembershipConfig())
+	view.Receive([]MemberUpdate{{ID: "B", State: MemberSuspect, Incarnation: 0}}, 1)
+
+	members := view.Members()
+	if len(members) != 1 || members[0].State != MemberAlive || members[0].Incarnation != 1 {
+		t.Fatalf("Expected B to refute with incarnation 1, got %v", members)
+	}
+
+	other := NewMembership("A", DefaultMembershipConfig())
+	other.Receive([]MemberUpdate{{ID: "B", State: MemberSuspect, Incarnation: 0}}, 1)
+	other.Receive(view.Outgoing(), 2)
+	if state, _ := other.State("B"); state != MemberAlive {
+		t.Errorf("Expected the refutation to override the suspicion, got %v", state)
+	}
+}
+
+// TestSWIMRejoin tests that a healed node is readmitted after refuting its death
+func TestSWIMRejoin(t *testing.T) {
+	swim := newSWIMCluster(t, 5, 3)
+	runUntilAgreed(swim, 50)
+	swim.System.SetPartition("C", true)
+	runUntilAgreed(swim, 100)
+
+	swim.System.SetPartition("C", false)
+	if periods := runUntilAgreed(swim, 100); periods < 0 {
+		t.Fatalf("Expected C to rejoin, A sees %v", swim.Views["A"].Members())
+	}
+}
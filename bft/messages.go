@@ -0,0 +1,175 @@
+package bft
+
+//go:generate go run ../tools/msggen -in messages.def -out messages_gen.go -proto ../docs/messages.proto
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Generated message codecs.
+//
+// The messages nodes exchange are defined once in messages.def and msggen
+// generates their codecs and handler dispatch into messages_gen.go, along
+// with docs/messages.proto. The binary encoding is the protobuf wire format,
+// so a protobuf client built from the .proto reads the same bytes, and the
+// JSON encoding uses the definition's field names, which match the existing
+// wire schemas. Unknown fields are skipped on decode, so a field added to a
+// message does not break older readers. This file holds the hand-written
+// runtime the generated code builds on.
+
+var (
+	ErrUnknownMessage   = errors.New("unknown message type")
+	ErrMalformedMessage = errors.New("malformed message")
+)
+
+// MessageType identifies a message on the wire
+type MessageType uint8
+
+// Message is a message with generated codecs
+type Message interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	MessageType() MessageType
+	EncodeJSON() ([]byte, error)
+	DecodeJSON(data []byte) error
+}
+
+// Protobuf wire types
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireBytes  = 2
+	wireI32    = 5
+)
+
+// EncodeFrame encodes m prefixed with its type ID
+func EncodeFrame(m Message) ([]byte, error) {
+	body, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(m.MessageType())}, body...), nil
+}
+
+// DecodeFrame decodes a frame written by EncodeFrame
+func DecodeFrame(data []byte) (Message, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty frame", ErrMalformedMessage)
+	}
+	m, err := NewMessage(MessageType(data[0]))
+	if err != nil {
+		return nil, err
+	}
+	if err := m.UnmarshalBinary(data[1:]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// appendVarintField appends a varint field, omitting the zero value
+func appendVarintField(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytesField appends a length-delimited field, omitting empty values
+func appendBytesField(b []byte, num int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return appendRepeatedField(b, num, v)
+}
+
+// appendRepeatedField appends one element of a repeated length-delimited
+// field, empty or not
+func appendRepeatedField(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// wireReader reads protobuf wire format fields
+type wireReader struct {
+	data []byte
+}
+
+func (r *wireReader) done() bool {
+	return len(r.data) == 0
+}
+
+// uvarint reads a raw varint
+func (r *wireReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errors.New("bad varint")
+	}
+	r.data = r.data[n:]
+	return v, nil
+}
+
+// tag reads a field number and wire type
+func (r *wireReader) tag() (int, int, error) {
+	v, err := r.uvarint()
+	if err != nil {
+		return 0, 0, err
+	}
+	if v>>3 == 0 {
+		return 0, 0, errors.New("field number 0")
+	}
+	return int(v >> 3), int(v & 7), nil
+}
+
+// varint reads a varint field value
+func (r *wireReader) varint(wireType int) (uint64, error) {
+	if wireType != wireVarint {
+		return 0, fmt.Errorf("wire type %d, want varint", wireType)
+	}
+	return r.uvarint()
+}
+
+// bytes reads a length-delimited field value into a new slice
+func (r *wireReader) bytes(wireType int) ([]byte, error) {
+	if wireType != wireBytes {
+		return nil, fmt.Errorf("wire type %d, want length-delimited", wireType)
+	}
+	n, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.data)) {
+		return nil, errors.New("truncated field")
+	}
+	v := append([]byte(nil), r.data[:n]...)
+	r.data = r.data[n:]
+	return v, nil
+}
+
+// skip discards a field value of any wire type
+func (r *wireReader) skip(wireType int) error {
+	var size uint64
+	switch wireType {
+	case wireVarint:
+		_, err := r.uvarint()
+		return err
+	case wireBytes:
+		_, err := r.bytes(wireType)
+		return err
+	case wireI64:
+		size = 8
+	case wireI32:
+		size = 4
+	default:
+		return fmt.Errorf("unsupported wire type %d", wireType)
+	}
+	if size > uint64(len(r.data)) {
+		return errors.New("truncated field")
+	}
+	r.data = r.data[size:]
+	return nil
+}
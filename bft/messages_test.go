@@ -0,0 +1,266 @@
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// sampleMessages returns one populated message of every generated type
+func sampleMessages() []Message {
+	return []Message{
+		&ClockUpdate{NodeID: "A", Timestamp: 42, Seq: 7, Nonce: "9f1c07ae", Signature: "3045022100ab"},
+		&MemberUpdate{ID: "B", State: MemberSuspect, Incarnation: 3},
+		&Entry{Index: 7, Key: "x", Value: "1", Signature: "sig"},
+		&SignedReply{Replica: "C", RequestID: "r1", Key: "x", Value: "1", Index: 7, Signature: "sig"},
+		&RoutingHint{From: "D", Leader: "A", View: 2, Reachable: []string{"D", "E"}},
+		&PrePrepare{View: 1, Seq: 9, Digest: "ab12", Payload: []byte("payload"), Replica: "B", Signature: "sig"},
+		&Prepare{View: 1, Seq: 9, Digest: "ab12", Replica: "C", Signature: "sig"},
+		&Commit{View: 1, Seq: 9, Digest: "ab12", Replica: "D", Signature: "sig"},
+		&FaultChange{Epoch: 2, F: 1},
+		&ViewChangeRequest{View: 2, Replica: "C", Prepared: []byte("[]"), Signature: "sig"},
+		&NewViewAnnouncement{View: 2, Leader: "C", Proof: []byte("{}"), Signature: "sig"},
+		&ConfigChange{Version: 3, Key: "batch_size", Value: "128"},
+		&Operation{Client: "c1", RequestID: 4, Kind: OpWrite, Payload: []byte(`{"kind":"write","key":"x","value":"1"}`),
+			Clock: &ClockUpdate{NodeID: "A", Timestamp: 42, Seq: 7, Nonce: "9f1c07ae", Signature: "sig"}},
+		&RequestVote{Term: 3, Candidate: "B", LastIndex: 9, LastTerm: 2},
+		&VoteReply{Term: 3, Voter: "C", Granted: true},
+		&AppendEntries{Term: 3, Leader: "B", PrevIndex: 9, PrevTerm: 2, Entries: []byte(`[{"term":3}]`), Commit: 8},
+		&AppendReply{Term: 3, Follower: "C", Success: true, Match: 10},
+		&HotStuffProposal{View: 5, Parent: "ab12", Digest: "cd34", Payload: []byte("w1"), Justify: []byte(`{"view":4}`), Leader: "A", Signature: "sig"},
+		&HotStuffVote{View: 5, Digest: "cd34", Replica: "C", Signature: "sig"},
+		&HotStuffNewView{View: 6, Justify: []byte(`{"view":4}`), Replica: "C", Signature: "sig"},
+	}
+}
+
+// TestMessageBinaryRoundTrip tests that every message survives a frame round trip
+func TestMessageBinaryRoundTrip(t *testing.T) {
+	for _, m := range append(sampleMessages(), &ClockUpdate{}, &ClockUpdate{Timestamp: -1}) {
+		frame, err := EncodeFrame(m)
+		if err != nil {
+			t.Fatalf("Expected %v to encode, got %v", m.MessageType(), err)
+		}
+		decoded, err := DecodeFrame(frame)
+		if err != nil {
+			t.Fatalf("Expected %v to decode, got %v", m.MessageType(), err)
+		}
+		if !reflect.DeepEqual(decoded, m) {
+			t.Errorf("Expected %+v, got %+v", m, decoded)
+		}
+	}
+}
+
+// TestMessageJSONRoundTrip tests that every message survives a JSON round trip
+func TestMessageJSONRoundTrip(t *testing.T) {
+	for _, m := range sampleMessages() {
+		data, err := m.EncodeJSON()
+		if err != nil {
+			t.Fatalf("Expected %v to encode, got %v", m.MessageType(), err)
+		}
+		decoded, _ := NewMessage(m.MessageType())
+		if err := decoded.DecodeJSON(data); err != nil {
+			t.Fatalf("Expected %s to decode, got %v", data, err)
+		}
+		if !reflect.DeepEqual(decoded, m) {
+			t.Errorf("Expected %+v, got %+v", m, decoded)
+		}
+	}
+}
+
+// TestGeneratedJSONMatchesWireSchemas tests that generated JSON is readable by the v1 schema decoders
+func TestGeneratedJSONMatchesWireSchemas(t *testing.T) {
+	clock := &ClockUpdate{NodeID: "A", Timestamp: 42, Signature: "sig"}
+	data, _ := clock.EncodeJSON()
+	decoded, err := clockUpdateSchema(1).Decode(data)
+	if err != nil || decoded != *clock {
+		t.Errorf("Expected clock-update v1 to read %s, got %+v, %v", data, decoded, err)
+	}
+
+	member := &MemberUpdate{ID: "B", State: MemberDead, Incarnation: 5}
+	data, _ = member.EncodeJSON()
+	decoded, err = memberUpdateSchema(1).Decode(data)
+	if err != nil || decoded != *member {
+		t.Errorf("Expected member-update v1 to read %s, got %+v, %v", data, decoded, err)
+	}
+}
+
+// TestUnknownFieldsSkipped tests that a field added by a newer writer does not break decoding
+func TestUnknownFieldsSkipped(t *testing.T) {
+	hint := &RoutingHint{From: "D", Leader: "A", View: 2}
+	body, _ := hint.MarshalBinary()
+	body = appendVarintField(body, 9, 300)
+	body = appendBytesField(body, 10, []byte("future"))
+
+	var decoded RoutingHint
+	if err := decoded.UnmarshalBinary(body); err != nil {
+		t.Fatalf("Expected unknown fields to be skipped, got %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, hint) {
+		t.Errorf("Expected %+v, got %+v", hint, decoded)
+	}
+}
+
+// TestMalformedFramesRejected tests that unknown types and truncated bodies fail to decode
+func TestMalformedFramesRejected(t *testing.T) {
+	if _, err := DecodeFrame([]byte{200}); !errors.Is(err, ErrUnknownMessage) {
+		t.Errorf("Expected ErrUnknownMessage, got %v", err)
+	}
+	frame, _ := EncodeFrame(&Entry{Key: "x", Value: "1"})
+	if _, err := DecodeFrame(frame[:len(frame)-1]); !errors.Is(err, ErrMalformedMessage) {
+		t.Errorf("Expected ErrMalformedMessage for a truncated frame, got %v", err)
+	}
+	if _, err := DecodeFrame(nil); !errors.Is(err, ErrMalformedMessage) {
+		t.Errorf("Expected ErrMalformedMessage for an empty frame, got %v", err)
+	}
+}
+
+// recordingHandler records which handler method was called
+type recordingHandler struct {
+	calls []string
+}
+
+func (h *recordingHandler) HandleClockUpdate(from string, m *ClockUpdate) error {
+	h.calls = append(h.calls, "clock:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleMemberUpdate(from string, m *MemberUpdate) error {
+	h.calls = append(h.calls, "member:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleEntry(from string, m *Entry) error {
+	h.calls = append(h.calls, "entry:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleSignedReply(from string, m *SignedReply) error {
+	h.calls = append(h.calls, "reply:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleRoutingHint(from string, m *RoutingHint) error {
+	h.calls = append(h.calls, "hint:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandlePrePrepare(from string, m *PrePrepare) error {
+	h.calls = append(h.calls, "pre-prepare:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandlePrepare(from string, m *Prepare) error {
+	h.calls = append(h.calls, "prepare:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleCommit(from string, m *Commit) error {
+	h.calls = append(h.calls, "commit:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleFaultChange(from string, m *FaultChange) error {
+	h.calls = append(h.calls, "faults:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleViewChangeRequest(from string, m *ViewChangeRequest) error {
+	h.calls = append(h.calls, "view-change:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleNewViewAnnouncement(from string, m *NewViewAnnouncement) error {
+	h.calls = append(h.calls, "new-view:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleConfigChange(from string, m *ConfigChange) error {
+	h.calls = append(h.calls, "config:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleOperation(from string, m *Operation) error {
+	h.calls = append(h.calls, "operation:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleRequestVote(from string, m *RequestVote) error {
+	h.calls = append(h.calls, "request-vote:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleVoteReply(from string, m *VoteReply) error {
+	h.calls = append(h.calls, "vote:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleAppendEntries(from string, m *AppendEntries) error {
+	h.calls = append(h.calls, "append-entries:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleAppendReply(from string, m *AppendReply) error {
+	h.calls = append(h.calls, "append-reply:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleHotStuffProposal(from string, m *HotStuffProposal) error {
+	h.calls = append(h.calls, "hs-proposal:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleHotStuffVote(from string, m *HotStuffVote) error {
+	h.calls = append(h.calls, "hs-vote:"+from)
+	return nil
+}
+
+func (h *recordingHandler) HandleHotStuffNewView(from string, m *HotStuffNewView) error {
+	h.calls = append(h.calls, "hs-new-view:"+from)
+	return nil
+}
+
+// TestDispatchMessage tests that decoded frames reach the handler for their type
+func TestDispatchMessage(t *testing.T) {
+	handler := &recordingHandler{}
+	for _, m := range sampleMessages() {
+		frame, _ := EncodeFrame(m)
+		decoded, _ := DecodeFrame(frame)
+		if err := DispatchMessage(handler, "N1", decoded); err != nil {
+			t.Fatalf("Expected dispatch to succeed, got %v", err)
+		}
+	}
+	expected := []string{"clock:N1", "member:N1", "entry:N1", "reply:N1", "hint:N1", "pre-prepare:N1", "prepare:N1", "commit:N1", "faults:N1", "view-change:N1", "new-view:N1", "config:N1", "operation:N1",
+		"request-vote:N1", "vote:N1", "append-entries:N1", "append-reply:N1",
+		"hs-proposal:N1", "hs-vote:N1", "hs-new-view:N1"}
+	if !reflect.DeepEqual(handler.calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, handler.calls)
+	}
+}
+
+// TestGeneratedCodeUpToDate tests that messages_gen.go matches messages.def
+func TestGeneratedCodeUpToDate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the generator")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go tool not available")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "messages_gen.go")
+	proto := filepath.Join(dir, "messages.proto")
+	cmd := exec.Command("go", "run", "../tools/msggen", "-in", "messages.def", "-out", out, "-proto", proto)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Expected msggen to run, got %v: %s", err, output)
+	}
+	for generated, committed := range map[string]string{out: "messages_gen.go", proto: "../docs/messages.proto"} {
+		want, _ := os.ReadFile(generated)
+		got, _ := os.ReadFile(committed)
+		if !bytes.Equal(got, want) {
+			t.Errorf("Expected %s to be up to date, run make generate", committed)
+		}
+	}
+}
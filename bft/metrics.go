@@ -0,0 +1,200 @@
+package bft
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prometheus metrics.
+//
+// A Metrics registry attached to a System counts what a run does as it
+// happens, so a long simulation can be scraped and graphed while it runs
+// rather than read from its report at the end. The registry is written in
+// the Prometheus text exposition format by hand, like the audit export
+// writes syslog, to keep the simulator free of client libraries:
+//
+//	wahello_messages_sent_total{kind}             messages put on the network
+//	wahello_messages_dropped_total{kind}          messages lost on the way
+//	wahello_bytes_sent_total{kind}                encoded bytes put on the network
+//	wahello_verification_failures_total{reason}   bad signatures, refused updates
+//	wahello_commit_latency_seconds{path}          histogram, leader, pbft, raft or hotstuff
+//	wahello_view_changes_total                    PBFT and HotStuff views installed
+//	wahello_consensus_messages_total{protocol}    messages a consensus protocol sent
+//	wahello_byzantine_detections_total{node}      misbehavior caught, by culprit
+//	wahello_cert_cache_hits_total{kind}           verifications skipped by a cache
+//	wahello_cert_cache_misses_total{kind}         verifications run
+//	wahello_cert_cache_evictions_total{kind}      digests a full cache forgot
+//
+// Like packet capture, the registry stays with the original system when it
+// is cloned; a hypothetical future does not count unless the caller hands
+// the registry on, as the partition simulation does for its PBFT runs.
+
+// CommitLatencyBuckets are the upper bounds of the commit latency histogram
+var CommitLatencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// metricFamily describes one metric
+type metricFamily struct {
+	name  string
+	help  string
+	label string // Name of the metric's label, none if empty
+}
+
+var (
+	metricSent           = metricFamily{"wahello_messages_sent_total", "Messages put on the network.", "kind"}
+	metricDropped        = metricFamily{"wahello_messages_dropped_total", "Messages lost on the way.", "kind"}
+	metricBytes          = metricFamily{"wahello_bytes_sent_total", "Encoded bytes put on the network.", "kind"}
+	metricVerification   = metricFamily{"wahello_verification_failures_total", "Signatures or updates that failed verification.", "reason"}
+	metricViewChanges    = metricFamily{"wahello_view_changes_total", "PBFT and HotStuff views installed after a view failed.", ""}
+	metricDetections     = metricFamily{"wahello_byzantine_detections_total", "Byzantine behavior detected, by culprit.", "node"}
+	metricCacheHits      = metricFamily{"wahello_cert_cache_hits_total", "Verifications a certificate cache skipped.", "kind"}
+	metricCacheMisses    = metricFamily{"wahello_cert_cache_misses_total", "Verifications a certificate cache had to run.", "kind"}
+	metricCacheEvictions = metricFamily{"wahello_cert_cache_evictions_total", "Digests evicted from full certificate caches.", "kind"}
+	metricConsensus      = metricFamily{"wahello_consensus_messages_total", "Consensus messages put on the network, by protocol.", "protocol"}
+	metricCommitLatency  = metricFamily{"wahello_commit_latency_seconds", "Time from submission until a write committed.", "path"}
+)
+
+// metricCounters are written in this order
+var metricCounters = []metricFamily{metricSent, metricDropped, metricBytes, metricVerification, metricViewChanges, metricDetections,
+	metricCacheHits, metricCacheMisses, metricCacheEvictions, metricConsensus}
+
+// histogram is one labelled series of the commit latency histogram
+type histogram struct {
+	counts []uint64 // Observations at or below each bucket bound
+	count  uint64
+	sum    time.Duration
+}
+
+// Metrics is a registry of counters and histograms
+type Metrics struct {
+	Lock       sync.Mutex
+	counters   map[string]map[string]float64 // Metric name to label value to count
+	histograms map[string]*histogram         // Commit path to histogram
+}
+
+// NewMetrics creates an empty registry
+func NewMetrics() *Metrics {
+	return &Metrics{counters: make(map[string]map[string]float64), histograms: make(map[string]*histogram)}
+}
+
+// add adds delta to the series of family with the given label value
+func (m *Metrics) add(family metricFamily, label string, delta float64) {
+	if m == nil {
+		return
+	}
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	values, exists := m.counters[family.name]
+	if !exists {
+		values = make(map[string]float64)
+		m.counters[family.name] = values
+	}
+	values[label] += delta
+}
+
+// observeCommit records a commit latency on path
+func (m *Metrics) observeCommit(path string, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	h, exists := m.histograms[path]
+	if !exists {
+		h = &histogram{counts: make([]uint64, len(CommitLatencyBuckets))}
+		m.histograms[path] = h
+	}
+	for i, bound := range CommitLatencyBuckets {
+		if latency <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += latency
+}
+
+// Count returns the value of a counter series, label empty for a metric
+// without labels
+func (m *Metrics) Count(name, label string) float64 {
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	return m.counters[name][label]
+}
+
+// Total returns the sum of a counter's series
+func (m *Metrics) Total(name string) float64 {
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	total := 0.0
+	for _, value := range m.counters[name] {
+		total += value
+	}
+	return total
+}
+
+// Commits returns the number of commits observed on path
+func (m *Metrics) Commits(path string) uint64 {
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	if h := m.histograms[path]; h != nil {
+		return h.count
+	}
+	return 0
+}
+
+// series renders a series name with its label, if any
+func series(name, label, value string) string {
+	if label == "" {
+		return name
+	}
+	return fmt.Sprintf("%s{%s=%q}", name, label, value)
+}
+
+// Write writes the registry in the Prometheus text exposition format
+func (m *Metrics) Write(w io.Writer) error {
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	var b strings.Builder
+	for _, family := range metricCounters {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", family.name, family.help, family.name)
+		values := m.counters[family.name]
+		if family.label == "" {
+			fmt.Fprintf(&b, "%s %g\n", family.name, values[""])
+			continue
+		}
+		for _, label := range sortedKeys(values) {
+			fmt.Fprintf(&b, "%s %g\n", series(family.name, family.label, label), values[label])
+		}
+	}
+
+	family := metricCommitLatency
+	fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s histogram\n", family.name, family.help, family.name)
+	for _, path := range sortedKeys(m.histograms) {
+		h := m.histograms[path]
+		for i, bound := range CommitLatencyBuckets {
+			fmt.Fprintf(&b, "%s_bucket{%s=%q,le=\"%g\"} %d\n", family.name, family.label, path, bound.Seconds(), h.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s=%q,le=\"+Inf\"} %d\n", family.name, family.label, path, h.count)
+		fmt.Fprintf(&b, "%s %g\n", series(family.name+"_sum", family.label, path), h.sum.Seconds())
+		fmt.Fprintf(&b, "%s %d\n", series(family.name+"_count", family.label, path), h.count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler serves the registry at /metrics
+func (m *Metrics) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.Write(w)
+	})
+	return mux
+}
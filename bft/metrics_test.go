@@ -0,0 +1,87 @@
+package bft
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMetricsSimulation tests that a run of the partition simulation is counted
+func TestMetricsSimulation(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	metrics := NewMetrics()
+	SimulatePartition(5, nil, nil, nil, nil, metrics)
+	if metrics.Count(metricSent.name, "forward") == 0 || metrics.Count(metricSent.name, "prepare") == 0 {
+		t.Error("Expected forwarded writes and PBFT prepares to be counted as sent")
+	}
+	if metrics.Count(metricViewChanges.name, "") == 0 {
+		t.Error("Expected the PBFT view change to be counted")
+	}
+	if metrics.Commits("leader") == 0 || metrics.Commits("pbft") == 0 {
+		t.Errorf("Expected commits on both paths, got %d leader and %d pbft", metrics.Commits("leader"), metrics.Commits("pbft"))
+	}
+}
+
+// TestMetricsExposition tests the text format of counters and histograms
+func TestMetricsExposition(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.add(metricSent, "prepare", 2)
+	metrics.add(metricDetections, "E", 1)
+	metrics.observeCommit("leader", 30*time.Millisecond)
+	metrics.observeCommit("leader", 3*time.Second)
+
+	var b strings.Builder
+	if err := metrics.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE wahello_messages_sent_total counter",
+		`wahello_messages_sent_total{kind="prepare"} 2`,
+		`wahello_byzantine_detections_total{node="E"} 1`,
+		"wahello_view_changes_total 0",
+		"# TYPE wahello_commit_latency_seconds histogram",
+		`wahello_commit_latency_seconds_bucket{path="leader",le="0.025"} 0`,
+		`wahello_commit_latency_seconds_bucket{path="leader",le="0.05"} 1`,
+		`wahello_commit_latency_seconds_bucket{path="leader",le="5"} 2`,
+		`wahello_commit_latency_seconds_bucket{path="leader",le="+Inf"} 2`,
+		`wahello_commit_latency_seconds_sum{path="leader"} 3.03`,
+		`wahello_commit_latency_seconds_count{path="leader"} 2`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("Expected line %q in\n%s", line, b.String())
+		}
+	}
+}
+
+// TestMetricsHandler tests that the registry is served at /metrics
+func TestMetricsHandler(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.add(metricVerification, "signature", 1)
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected plain text, got %q", resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), `wahello_verification_failures_total{reason="signature"} 1`) {
+		t.Errorf("Expected the signature failure to be served, got\n%s", body)
+	}
+}
+
+// TestMetricsNil tests that a system without a registry counts nothing
+func TestMetricsNil(t *testing.T) {
+	var metrics *Metrics
+	metrics.add(metricSent, "prepare", 1)
+	metrics.observeCommit("leader", time.Millisecond)
+}
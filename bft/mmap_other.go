@@ -0,0 +1,17 @@
+//go:build !unix
+
+package bft
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the whole file into memory on platforms without mmap
+func mapFile(file *os.File) ([]byte, func() error, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
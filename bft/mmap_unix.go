@@ -0,0 +1,24 @@
+//go:build unix
+
+package bft
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps a file read-only into memory. Empty files map to nil.
+func mapFile(file *os.File) ([]byte, func() error, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() == 0 {
+		return nil, func() error { return nil }, nil
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
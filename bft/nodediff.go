@@ -0,0 +1,298 @@
+package bft
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fernandokarnagi/wahello/bft/clock"
+)
+
+// Node state diffs.
+//
+// DiffNodes compares two replicas the way an operator would when they
+// disagree: their vector clocks, their logs by index and the key-value
+// state the logs were applied to. The store keeps the latest entry of each
+// key, so the log is what survives of it: those entries by index, up to the
+// commit index. The first index at which the logs differ, or which only one
+// node committed, is where the replicas diverged. The clock entries that
+// differ name the updates one of them missed, and the traced events between
+// the two nodes, or carrying one of those updates, show how it came to that.
+
+// NodeDiffEvents is the most causal events a diff quotes
+const NodeDiffEvents = 20
+
+// ClockDelta is a clock entry on which two nodes disagree
+type ClockDelta struct {
+	Node string `json:"node"`
+	A    int64  `json:"a"`
+	B    int64  `json:"b"`
+}
+
+// LogDelta is a log index at which two nodes hold different entries. A nil
+// side has no entry at that index.
+type LogDelta struct {
+	Index int64  `json:"index"`
+	A     *Entry `json:"a,omitempty"`
+	B     *Entry `json:"b,omitempty"`
+}
+
+// StateDelta is a key with different values, empty where a node lacks it
+type StateDelta struct {
+	Key string `json:"key"`
+	A   string `json:"a"`
+	B   string `json:"b"`
+}
+
+// NodeDiff is the difference between the states of nodes A and B
+type NodeDiff struct {
+	A        string              `json:"a"`
+	B        string              `json:"b"`
+	Ordering clock.ClockOrdering `json:"ordering"` // How A's clock relates to B's, own entries aside
+	CommitA  int64               `json:"commit_a"`
+	CommitB  int64               `json:"commit_b"`
+	// FirstDivergence is the first log index the nodes disagree on, 0 if none
+	FirstDivergence int64        `json:"first_divergence"`
+	Clock           []ClockDelta `json:"clock,omitempty"`
+	Log             []LogDelta   `json:"log,omitempty"`
+	State           []StateDelta `json:"state,omitempty"`
+	Causal          []TraceEvent `json:"causal,omitempty"` // Oldest first
+}
+
+// Equal reports whether the nodes hold the same state
+func (d *NodeDiff) Equal() bool {
+	return len(d.Clock) == 0 && len(d.Log) == 0 && len(d.State) == 0 && d.CommitA == d.CommitB
+}
+
+// nodeSnapshot is the part of a node's state a diff compares
+type nodeSnapshot struct {
+	clock   map[string]int64
+	commit  int64
+	entries map[string]Entry
+}
+
+func snapshotNode(node *Node) nodeSnapshot {
+	node.Lock.RLock()
+	defer node.Lock.RUnlock()
+	snapshot := nodeSnapshot{
+		clock:   node.VectorClock.Timestamps(),
+		commit:  node.Store.CommitIndex,
+		entries: make(map[string]Entry, len(node.Store.Entries)),
+	}
+	for key, entry := range node.Store.Entries {
+		snapshot.entries[key] = entry
+	}
+	return snapshot
+}
+
+// DiffNodes compares the states of two nodes of the system
+func DiffNodes(system *System, a, b string) (*NodeDiff, error) {
+	nodes, err := system.lookupNodes([]string{a, b})
+	if err != nil {
+		return nil, err
+	}
+	first, second := snapshotNode(nodes[0]), snapshotNode(nodes[1])
+	diff := &NodeDiff{A: a, B: b, CommitA: first.commit, CommitB: second.commit}
+
+	// Nodes do not track their own clock entry, so only third parties compare
+	clockA, clockB := first.clock, second.clock
+	ids := make(map[string]bool)
+	for id := range clockA {
+		ids[id] = true
+	}
+	for id := range clockB {
+		ids[id] = true
+	}
+	delete(ids, a)
+	delete(ids, b)
+	var less, greater bool
+	for _, id := range sortedKeys(ids) {
+		if clockA[id] != clockB[id] {
+			diff.Clock = append(diff.Clock, ClockDelta{Node: id, A: clockA[id], B: clockB[id]})
+			less = less || clockA[id] < clockB[id]
+			greater = greater || clockA[id] > clockB[id]
+		}
+	}
+	switch {
+	case less && greater:
+		diff.Ordering = clock.ClockConcurrent
+	case less:
+		diff.Ordering = clock.ClockBefore
+	case greater:
+		diff.Ordering = clock.ClockAfter
+	}
+
+	logA, logB := entriesByIndex(first.entries), entriesByIndex(second.entries)
+	indexes := make(map[int64]bool)
+	for index := range logA {
+		indexes[index] = true
+	}
+	for index := range logB {
+		indexes[index] = true
+	}
+	for _, index := range sortedIndexes(indexes) {
+		entryA, entryB := logA[index], logB[index]
+		if entryA != nil && entryB != nil && entryA.Key == entryB.Key && entryA.Value == entryB.Value {
+			continue
+		}
+		diff.Log = append(diff.Log, LogDelta{Index: index, A: entryA, B: entryB})
+	}
+	if len(diff.Log) > 0 {
+		diff.FirstDivergence = diff.Log[0].Index
+	}
+	if lower := min(first.commit, second.commit); first.commit != second.commit && (diff.FirstDivergence == 0 || lower+1 < diff.FirstDivergence) {
+		diff.FirstDivergence = lower + 1
+	}
+
+	keys := make(map[string]bool)
+	for key := range first.entries {
+		keys[key] = true
+	}
+	for key := range second.entries {
+		keys[key] = true
+	}
+	for _, key := range sortedKeys(keys) {
+		if valueA, valueB := first.entries[key].Value, second.entries[key].Value; valueA != valueB {
+			diff.State = append(diff.State, StateDelta{Key: key, A: valueA, B: valueB})
+		}
+	}
+
+	diff.Causal = causalEvents(system, diff)
+	return diff, nil
+}
+
+// entriesByIndex lays out a store's entries as its log
+func entriesByIndex(entries map[string]Entry) map[int64]*Entry {
+	log := make(map[int64]*Entry, len(entries))
+	for _, entry := range entries {
+		log[entry.Index] = &entry
+	}
+	return log
+}
+
+// sortedIndexes returns the log indexes in ascending order
+func sortedIndexes[I int64 | uint64](indexes map[I]bool) []I {
+	sorted := make([]I, 0, len(indexes))
+	for index := range indexes {
+		sorted = append(sorted, index)
+	}
+	slices.Sort(sorted)
+	return sorted
+}
+
+// causalEvents returns the latest traced events exchanged between the two
+// nodes or carrying an update for a clock entry they disagree on
+func causalEvents(system *System, diff *NodeDiff) []TraceEvent {
+	if system.Trace == nil {
+		return nil
+	}
+	missed := make(map[string]bool)
+	for _, delta := range diff.Clock {
+		missed[delta.Node] = true
+	}
+	involved := func(id string) bool { return id == diff.A || id == diff.B }
+
+	var events []TraceEvent
+	for _, event := range system.Trace.Snapshot() {
+		if !involved(event.Node) {
+			continue
+		}
+		if involved(event.Peer) || event.Update != nil && missed[event.Update.NodeID] {
+			events = append(events, event)
+		}
+	}
+	if len(events) > NodeDiffEvents {
+		events = events[len(events)-NodeDiffEvents:]
+	}
+	return events
+}
+
+// String renders the diff for a terminal, marking the first divergence
+func (d *NodeDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s vs %s: clocks %s, commit index %d vs %d\n", d.A, d.B, d.Ordering, d.CommitA, d.CommitB)
+	if d.Equal() {
+		b.WriteString("No differences\n")
+		return b.String()
+	}
+	if d.FirstDivergence > 0 {
+		fmt.Fprintf(&b, "First divergence at index %d\n", d.FirstDivergence)
+	}
+
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	if len(d.Clock) > 0 {
+		fmt.Fprintf(w, "\nCLOCK\t%s\t%s\n", d.A, d.B)
+		for _, delta := range d.Clock {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", delta.Node, delta.A, delta.B)
+		}
+	}
+	if len(d.Log) > 0 {
+		fmt.Fprintf(w, "\n\tINDEX\t%s\t%s\n", d.A, d.B)
+		for _, delta := range d.Log {
+			marker := ""
+			if delta.Index == d.FirstDivergence {
+				marker = ">"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", marker, delta.Index, describeEntry(delta.A), describeEntry(delta.B))
+		}
+	}
+	if len(d.State) > 0 {
+		fmt.Fprintf(w, "\nKEY\t%s\t%s\n", d.A, d.B)
+		for _, delta := range d.State {
+			fmt.Fprintf(w, "%s\t%q\t%q\n", delta.Key, delta.A, delta.B)
+		}
+	}
+	w.Flush()
+
+	if len(d.Causal) > 0 {
+		fmt.Fprintf(&b, "\nCausal events:\n")
+		for i := range d.Causal {
+			fmt.Fprintf(&b, "  %s\n", describeEvent(&d.Causal[i]))
+		}
+	}
+	return b.String()
+}
+
+// describeEntry renders one side of a log delta
+func describeEntry(entry *Entry) string {
+	if entry == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s=%q", entry.Key, entry.Value)
+}
+
+// DiffCommand implements `wahello diff [-seed n] [-json] nodeA nodeB`. The
+// nodes are taken from the end of the seeded chaos scenario.
+func DiffCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	seed := flags.Int64("seed", 1, "seed of the chaos scenario to compare the nodes of")
+	asJSON := flags.Bool("json", false, "print the diff as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: diff [-seed n] [-json] nodeA nodeB")
+	}
+	system, err := SeededChaosSystem(*seed)
+	if err != nil {
+		return err
+	}
+	diff, err := DiffNodes(system, flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	}
+	_, err = io.WriteString(stdout, diff.String())
+	return err
+}
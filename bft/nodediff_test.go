@@ -0,0 +1,105 @@
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newDiffSystem creates voters A-G that all neighbor each other, with G
+// partitioned after the first write and the first round of clock updates
+func newDiffSystem(t *testing.T) *System {
+	system := newFaultSystem(t)
+	system.Trace = NewTrace()
+	ids := sortedKeys(system.Nodes)
+	for _, id := range ids {
+		countingClock(system.Nodes[id])
+	}
+	connectAll(system)
+	if _, err := system.SubmitWrite("", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	system.propagateRound(ids)
+	system.SetPartition("G", true)
+	if _, err := system.SubmitWrite("", "A", "y", "2"); err != nil {
+		t.Fatal(err)
+	}
+	system.propagateRound(ids)
+	return system
+}
+
+// TestDiffNodes tests that a lagging replica's clock, log and state differences are all reported
+func TestDiffNodes(t *testing.T) {
+	system := newDiffSystem(t)
+	diff, err := DiffNodes(system, "B", "G")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Equal() || diff.CommitA != 2 || diff.CommitB != 1 || diff.FirstDivergence != 2 {
+		t.Errorf("Expected G to diverge at index 2, got %+v", diff)
+	}
+	if diff.Ordering.String() != "after" {
+		t.Errorf("Expected B's clock to be ahead of G's, got %s", diff.Ordering)
+	}
+	if len(diff.Clock) != 5 || diff.Clock[0] != (ClockDelta{Node: "A", A: 2, B: 1}) {
+		t.Errorf("Expected G to miss the second update of A and the other four, got %+v", diff.Clock)
+	}
+	if len(diff.Log) != 1 || diff.Log[0].Index != 2 || diff.Log[0].A.Key != "y" || diff.Log[0].B != nil {
+		t.Errorf("Expected only B to hold y at index 2, got %+v", diff.Log)
+	}
+	if !reflect.DeepEqual(diff.State, []StateDelta{{Key: "y", A: "2"}}) {
+		t.Errorf("Expected y to be missing on G, got %+v", diff.State)
+	}
+	if len(diff.Causal) == 0 || len(diff.Causal) > NodeDiffEvents {
+		t.Fatalf("Expected up to %d causal events, got %d", NodeDiffEvents, len(diff.Causal))
+	}
+	for _, event := range diff.Causal {
+		if event.Node != "B" && event.Node != "G" {
+			t.Errorf("Expected only events on B or G, got %+v", event)
+		}
+	}
+
+	if diff, _ := DiffNodes(system, "B", "C"); !diff.Equal() || diff.FirstDivergence != 0 {
+		t.Errorf("Expected B and C to match, got %+v", diff)
+	}
+	if _, err := DiffNodes(system, "B", "Z"); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("Expected ErrUnknownNode, got %v", err)
+	}
+}
+
+// TestDiffNodesConflictingEntry tests that a conflicting entry is the first divergence
+func TestDiffNodesConflictingEntry(t *testing.T) {
+	system := newDiffSystem(t)
+	g := system.Nodes["G"]
+	g.Store.Entries["x"] = Entry{Index: 1, Key: "x", Value: "9"}
+
+	diff, err := DiffNodes(system, "B", "G")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.FirstDivergence != 1 || len(diff.Log) != 2 || diff.Log[0].B.Value != "9" {
+		t.Errorf("Expected the conflicting x at index 1 first, got %+v", diff.Log)
+	}
+	rendered := diff.String()
+	for _, line := range []string{"First divergence at index 1", `>  1      x="1"  x="9"`, `2      y="2"  -`, "Causal events:"} {
+		if !strings.Contains(rendered, line) {
+			t.Errorf("Expected the rendering to contain %q:\n%s", line, rendered)
+		}
+	}
+}
+
+// TestDiffCommand tests the diff subcommand on the seeded chaos scenario
+func TestDiffCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := DiffCommand([]string{"-seed", "2", "A", "E"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "A vs E: clocks after") {
+		t.Errorf("Expected E to lag behind A, got:\n%s", out.String())
+	}
+	if err := DiffCommand([]string{"A"}, &out); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("Expected a usage error, got %v", err)
+	}
+}
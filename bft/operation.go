@@ -0,0 +1,128 @@
+package bft
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Client operations.
+//
+// An Operation is what a client asks of the replicated state and the unit
+// consensus orders: PBFT proposes it, commits it and has every replica
+// apply it. It names its client and the client's request ID, so a retry is
+// recognized by the replicas' session tables, says what it does and carries
+// its payload, a RequestPayload for reads and writes. The signed clock
+// update of the node that accepted the operation rides along as metadata
+// and advances the replicas' vector clocks when the operation is applied;
+// an operation of kind clock is such an update with nothing else to do.
+// This is what lets W1 and W2 be ordered as the writes x=W1 and x=W2 they
+// are, rather than as the timestamps of the nodes they reached.
+
+// Operation is a client request as consensus orders it
+type Operation struct {
+	Client    string
+	RequestID uint64
+	Kind      OpKind
+	Payload   []byte       // Encoded RequestPayload of reads and writes
+	Clock     *ClockUpdate // Of the node that accepted the operation, if any
+}
+
+// NewWriteOperation returns client's write of value to key with the given
+// request ID, stamped with clock
+func NewWriteOperation(client string, requestID uint64, key, value string, clock *ClockUpdate) *Operation {
+	payload, _ := json.Marshal(RequestPayload{Kind: OpWrite, Key: key, Value: value}) // Strings always encode
+	return &Operation{Client: client, RequestID: requestID, Kind: OpWrite, Payload: payload, Clock: clock}
+}
+
+// ClockOperation returns an operation carrying nothing but update, on
+// behalf of the node that signed it
+func ClockOperation(update *ClockUpdate) *Operation {
+	return &Operation{Client: update.NodeID, RequestID: update.Seq, Kind: OpClock, Clock: update}
+}
+
+// Request returns the operation as a client request for admission, see
+// SessionTable
+func (op *Operation) Request() *ClientRequest {
+	return &ClientRequest{Client: op.Client, RequestID: op.RequestID, Payload: op.Payload}
+}
+
+// Decode returns the read or write the operation carries
+func (op *Operation) Decode() (*RequestPayload, error) {
+	payload, err := DecodePayload(op.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Kind != op.Kind {
+		return nil, fmt.Errorf("%w: %s operation carries a %s", ErrMalformedRequest, op.Kind, payload.Kind)
+	}
+	return payload, nil
+}
+
+// String renders an operation, e.g. "client-1#1 write x=W1 @A:42"
+func (op *Operation) String() string {
+	s := fmt.Sprintf("%s#%d %s", op.Client, op.RequestID, op.Kind)
+	if payload, err := op.Decode(); err == nil {
+		s += " " + payload.Key
+		if payload.Kind == OpWrite {
+			s += "=" + payload.Value
+		}
+	}
+	if op.Clock != nil {
+		s += fmt.Sprintf(" @%s:%d", op.Clock.NodeID, op.Clock.Timestamp)
+	}
+	return s
+}
+
+// SubmitOperation orders op, which replicas apply once it commits
+func (p *PBFT) SubmitOperation(op *Operation) (string, error) {
+	frame, err := EncodeFrame(op)
+	if err != nil {
+		return "", err
+	}
+	return p.Submit(frame)
+}
+
+// applyOperation applies a committed operation frame at seq to the node: a
+// write to its store, at seq, and the clock metadata to its vector clock.
+// Bare clock update frames count as clock operations. Other payloads,
+// operations the node's session table does not accept and clock metadata
+// with a bad signature are skipped, the same way on every honest replica.
+func (r *PBFTReplica) applyOperation(seq uint64, payload []byte) {
+	m, err := DecodeFrame(payload)
+	if err != nil {
+		return
+	}
+	var op *Operation
+	switch m := m.(type) {
+	case *Operation:
+		op = m
+	case *ClockUpdate:
+		op = ClockOperation(m)
+	default:
+		return
+	}
+	var request *RequestPayload
+	if op.Kind != OpClock {
+		if request, err = op.Decode(); err != nil {
+			return
+		}
+	}
+	if update := op.Clock; update != nil {
+		key, exists := r.keys[update.NodeID]
+		if !exists || !r.Node.verifySignature(r.Metrics, key, clockUpdateDigest(update), update.Signature) {
+			return
+		}
+	}
+
+	r.Node.Lock.Lock()
+	defer r.Node.Lock.Unlock()
+	if request != nil && r.Node.Sessions != nil && r.Node.Sessions.Admit(op.Request(), nil).Verdict != VerdictAccepted {
+		return
+	}
+	if op.Clock != nil {
+		r.Node.VectorClock.Update(op.Clock.NodeID, op.Clock.Timestamp)
+	}
+	if request != nil && request.Kind == OpWrite {
+		r.Node.Store.Apply(Entry{Index: int64(seq), Key: request.Key, Value: request.Value})
+	}
+}
@@ -0,0 +1,77 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestPBFTAppliesWriteOperations tests that a committed write reaches every
+// replica's store at its sequence number along with its clock metadata, and
+// that reusing its request ID for another value is ordered but not applied
+func TestPBFTAppliesWriteOperations(t *testing.T) {
+	pbft := newPBFT(t)
+	w1 := NewWriteOperation("client", 1, "x", "W1", pbft.System.Nodes["A"].GetClockUpdate())
+	digest, err := pbft.SubmitOperation(w1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pbft.SubmitOperation(NewWriteOperation("client", 1, "x", "forged", nil)); err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+
+	outcome := pbft.Outcome(digest)
+	if !outcome.Committed || outcome.Seq != 1 {
+		t.Fatalf("Expected W1 to commit at seq 1, got %+v", outcome)
+	}
+	for _, id := range []string{"A", "B", "C", "D"} {
+		node := pbft.System.Nodes[id]
+		if x := node.Store.Entries["x"]; x.Value != "W1" || x.Index != 1 || node.Store.CommitIndex != 1 {
+			t.Errorf("Expected %s to hold x=W1 at index 1 only, got %+v at commit index %d", id, x, node.Store.CommitIndex)
+		}
+		if ts := node.VectorClock.Timestamps()["A"]; ts != 42 {
+			t.Errorf("Expected %s to apply A=42 with W1, got %d", id, ts)
+		}
+	}
+}
+
+// TestPBFTSkipsOperationWithForgedClock tests that an operation whose clock
+// metadata does not verify is skipped as a whole
+func TestPBFTSkipsOperationWithForgedClock(t *testing.T) {
+	pbft := newPBFT(t)
+	update := pbft.System.Nodes["A"].GetClockUpdate()
+	update.Timestamp++
+	digest, err := pbft.SubmitOperation(NewWriteOperation("client", 1, "x", "W1", update))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+	if !pbft.Outcome(digest).Committed {
+		t.Fatal("Expected the operation to be ordered")
+	}
+	for _, id := range []string{"A", "B", "C", "D"} {
+		node := pbft.System.Nodes[id]
+		if _, exists := node.Store.Entries["x"]; exists || node.VectorClock.Timestamps()["A"] != 0 {
+			t.Errorf("Expected %s to skip the operation, got %+v and clock %v", id, node.Store.Entries, node.VectorClock.Timestamps())
+		}
+	}
+}
+
+// TestOperationDecode tests that an operation's payload must match its kind
+func TestOperationDecode(t *testing.T) {
+	op := NewWriteOperation("client", 3, "x", "1", &ClockUpdate{NodeID: "A", Timestamp: 42})
+	payload, err := op.Decode()
+	if err != nil || payload.Key != "x" || payload.Value != "1" {
+		t.Fatalf("Expected write x=1, got %+v, %v", payload, err)
+	}
+	if s := op.String(); s != "client#3 write x=1 @A:42" {
+		t.Errorf("Unexpected rendering %q", s)
+	}
+	op.Kind = OpRead
+	if _, err := op.Decode(); !errors.Is(err, ErrMalformedRequest) {
+		t.Errorf("Expected a read carrying a write to be malformed, got %v", err)
+	}
+	if _, err := ClockOperation(&ClockUpdate{NodeID: "A", Seq: 2}).Decode(); !errors.Is(err, ErrMalformedRequest) {
+		t.Errorf("Expected a clock operation to carry no request, got %v", err)
+	}
+}
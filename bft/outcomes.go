@@ -0,0 +1,177 @@
+package bft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Request outcomes.
+//
+// A client whose write times out, because the reply was lost in a
+// partition or took longer than it would wait, cannot tell whether the
+// write committed, and retrying it blindly may apply it twice. The system
+// therefore keeps the outcome of every client request in its OutcomeStore,
+// recorded the moment it is decided: committed, with the leader's commit
+// proof binding the request to its index, or failed. A store opened on a
+// file appends every outcome to it as a JSON line and reads them back when
+// it is opened again, so outcomes outlive a restart. A client polls the
+// status of one of its requests with Client.Status, which reports a commit
+// only after checking its proof against the request and the leader's key,
+// or subscribes to be told once the request is decided. Like the event
+// stream, the store is not copied into clones.
+
+var (
+	ErrUnknownRequest = errors.New("unknown request")
+	ErrNoOutcomes     = errors.New("system keeps no request outcomes")
+)
+
+// RequestState is how far a client request got
+type RequestState string
+
+const (
+	RequestPending   RequestState = "pending"   // Invoked and not decided yet
+	RequestCommitted RequestState = "committed" // Committed, with a commit proof
+	RequestFailed    RequestState = "failed"    // Not committed on any attempt
+)
+
+// RequestStatus is the outcome of a client request
+type RequestStatus struct {
+	Client    string       `json:"client"`
+	RequestID uint64       `json:"request_id"`
+	State     RequestState `json:"state"`
+	Key       string       `json:"key,omitempty"`
+	Index     int64        `json:"index,omitempty"` // Of the committed entry
+	Proof     *CommitProof `json:"proof,omitempty"`
+	Error     string       `json:"error,omitempty"` // Why the last attempt failed
+}
+
+// Decided reports whether the request committed or failed for good
+func (s RequestStatus) Decided() bool {
+	return s.State == RequestCommitted || s.State == RequestFailed
+}
+
+// OutcomeStore keeps the status of client requests
+type OutcomeStore struct {
+	Lock     sync.Mutex
+	statuses map[string]map[uint64]RequestStatus
+	watchers map[string]map[uint64][]chan RequestStatus
+	file     *os.File // Appended to when set
+}
+
+// NewOutcomeStore creates an empty store kept in memory
+func NewOutcomeStore() *OutcomeStore {
+	return &OutcomeStore{
+		statuses: make(map[string]map[uint64]RequestStatus),
+		watchers: make(map[string]map[uint64][]chan RequestStatus),
+	}
+}
+
+// OpenOutcomeStore opens the store kept in the file at path, creating it if
+// needed, with the outcomes recorded in it before
+func OpenOutcomeStore(path string) (*OutcomeStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	o := NewOutcomeStore()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var status RequestStatus
+		if err := json.Unmarshal(scanner.Bytes(), &status); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		o.set(status)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	o.file = file
+	return o, nil
+}
+
+// set stores a status. The caller must hold o.Lock.
+func (o *OutcomeStore) set(status RequestStatus) {
+	if o.statuses[status.Client] == nil {
+		o.statuses[status.Client] = make(map[uint64]RequestStatus)
+	}
+	o.statuses[status.Client][status.RequestID] = status
+}
+
+// Record stores a request's status, appending it to the store's file if
+// it has one, and notifies the request's subscribers once it is decided. A
+// decided request keeps its outcome. A nil store records nothing.
+func (o *OutcomeStore) Record(status RequestStatus) error {
+	if o == nil {
+		return nil
+	}
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+	if previous, exists := o.statuses[status.Client][status.RequestID]; exists && previous.Decided() {
+		return nil
+	}
+	if o.file != nil {
+		data, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		if _, err := o.file.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	o.set(status)
+	if status.Decided() {
+		for _, watcher := range o.watchers[status.Client][status.RequestID] {
+			watcher <- status
+			close(watcher)
+		}
+		delete(o.watchers[status.Client], status.RequestID)
+	}
+	return nil
+}
+
+// Status returns the status of a client's request
+func (o *OutcomeStore) Status(client string, requestID uint64) (RequestStatus, error) {
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+	status, exists := o.statuses[client][requestID]
+	if !exists {
+		return status, fmt.Errorf("%w: %s#%d", ErrUnknownRequest, client, requestID)
+	}
+	return status, nil
+}
+
+// Subscribe returns a channel that receives a client's request's status
+// once it is decided, right away if it already is, and is then closed
+func (o *OutcomeStore) Subscribe(client string, requestID uint64) <-chan RequestStatus {
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+	watcher := make(chan RequestStatus, 1)
+	if status, exists := o.statuses[client][requestID]; exists && status.Decided() {
+		watcher <- status
+		close(watcher)
+		return watcher
+	}
+	if o.watchers[client] == nil {
+		o.watchers[client] = make(map[uint64][]chan RequestStatus)
+	}
+	o.watchers[client][requestID] = append(o.watchers[client][requestID], watcher)
+	return watcher
+}
+
+// Close closes the store's file, if any
+func (o *OutcomeStore) Close() error {
+	o.Lock.Lock()
+	defer o.Lock.Unlock()
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
@@ -0,0 +1,108 @@
+package bft
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestOutcomeStoreSubscribe tests that subscribers hear of a request once it
+// is decided, right away if it already is, and that its outcome then stays
+func TestOutcomeStoreSubscribe(t *testing.T) {
+	outcomes := NewOutcomeStore()
+	if _, err := outcomes.Status("alice", 1); !errors.Is(err, ErrUnknownRequest) {
+		t.Fatalf("Expected an unknown request, got %v", err)
+	}
+	outcomes.Record(RequestStatus{Client: "alice", RequestID: 1, State: RequestPending, Key: "x"})
+	early := outcomes.Subscribe("alice", 1)
+	select {
+	case status := <-early:
+		t.Fatalf("Expected no outcome of a pending request, got %+v", status)
+	default:
+	}
+
+	outcomes.Record(RequestStatus{Client: "alice", RequestID: 1, State: RequestCommitted, Key: "x", Index: 3})
+	outcomes.Record(RequestStatus{Client: "alice", RequestID: 1, State: RequestFailed, Key: "x"})
+	if status := <-early; status.State != RequestCommitted || status.Index != 3 {
+		t.Errorf("Expected the subscriber to hear of the commit at 3, got %+v", status)
+	}
+	if _, open := <-early; open {
+		t.Error("Expected the subscription to be closed after its outcome")
+	}
+	if status := <-outcomes.Subscribe("alice", 1); status.State != RequestCommitted {
+		t.Errorf("Expected a late subscriber to hear of the commit right away, got %+v", status)
+	}
+}
+
+// TestOutcomeStoreReopens tests that a store kept in a file has the outcomes
+// recorded before it was closed when opened again
+func TestOutcomeStoreReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outcomes.jsonl")
+	outcomes, err := OpenOutcomeStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outcomes.Record(RequestStatus{Client: "alice", RequestID: 1, State: RequestPending, Key: "x"})
+	outcomes.Record(RequestStatus{Client: "alice", RequestID: 1, State: RequestFailed, Key: "x", Error: "no leader"})
+	outcomes.Record(RequestStatus{Client: "bob", RequestID: 1, State: RequestPending, Key: "y"})
+	if err := outcomes.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenOutcomeStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if status, err := reopened.Status("alice", 1); err != nil || status.State != RequestFailed || status.Error != "no leader" {
+		t.Errorf("Expected alice#1 to have failed, got %+v, %v", status, err)
+	}
+	if status, err := reopened.Status("bob", 1); err != nil || status.State != RequestPending {
+		t.Errorf("Expected bob#1 to be pending, got %+v, %v", status, err)
+	}
+}
+
+// TestTimedOutWriteLearnsCommit tests that a client giving up on its writes
+// before their replies arrive learns that they committed, with a proof, and
+// that a tampered proof is not taken for a commit
+func TestTimedOutWriteLearnsCommit(t *testing.T) {
+	system := newWorkloadSystem(t, 1)
+	system.Outcomes = NewOutcomeStore()
+	client := &Client{Name: "carol", Region: "eu-west", Rate: 20, Keys: []string{"x"}, Timeout: time.Millisecond}
+	workload := NewWorkload(system, time.Second, client)
+	if err := workload.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if client.Stats.Writes == 0 || client.Stats.TimedOut != client.Stats.Writes {
+		t.Fatalf("Expected every write to time out, got %+v", client.Stats)
+	}
+	for _, op := range workload.History.Snapshot() {
+		if op.OK {
+			t.Fatalf("Expected no write to complete, got %+v", op)
+		}
+	}
+
+	for id := uint64(1); id <= uint64(client.Stats.Writes); id++ {
+		status, err := client.Status(id)
+		if err != nil || status.State != RequestCommitted || status.Proof == nil || status.Index == 0 {
+			t.Fatalf("Expected write %d to have committed with a proof, got %+v, %v", id, status, err)
+		}
+		updates, err := client.Subscribe(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pushed := <-updates; pushed.Index != status.Index {
+			t.Errorf("Expected write %d to be pushed at index %d, got %+v", id, status.Index, pushed)
+		}
+	}
+
+	status, _ := client.Status(1)
+	status.Proof.Signature = status.Proof.Signature[:len(status.Proof.Signature)-2] + "00"
+	if _, err := client.Status(1); !errors.Is(err, ErrInvalidCommitProof) {
+		t.Errorf("Expected a tampered proof to be rejected, got %v", err)
+	}
+	if _, err := client.Status(uint64(client.Stats.Writes) + 1); !errors.Is(err, ErrUnknownRequest) {
+		t.Errorf("Expected a request never issued to be unknown, got %v", err)
+	}
+}
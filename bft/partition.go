@@ -0,0 +1,172 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Partition lifecycle.
+//
+// The Partition map cuts single nodes off from everyone. CreatePartition
+// instead splits the cluster into groups: every link between nodes of
+// different groups is severed, while the links inside a group keep working,
+// so each side goes on exchanging clock updates among itself and the clocks
+// on either side drift apart. Nodes no group lists form one more group
+// together. HealPartition restores the severed links and runs a
+// reconciliation pass: the honest reachable nodes merge their clocks entry
+// by entry, keeping the highest timestamp of each, so that afterwards they
+// all agree. Byzantine nodes take no part, their clocks cannot be trusted.
+
+var ErrInvalidPartition = errors.New("invalid partition")
+
+// CreatePartition severs every link between nodes of different groups,
+// replacing any partition created before
+func (s *System) CreatePartition(groups ...[]string) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	if len(groups) == 0 {
+		return fmt.Errorf("%w: no groups", ErrInvalidPartition)
+	}
+	groupOf := make(map[string]int)
+	for i, group := range groups {
+		for _, id := range group {
+			if _, exists := s.Nodes[id]; !exists {
+				return fmt.Errorf("%w: unknown node %q", ErrInvalidPartition, id)
+			}
+			if _, listed := groupOf[id]; listed {
+				return fmt.Errorf("%w: node %s in more than one group", ErrInvalidPartition, id)
+			}
+			groupOf[id] = i
+		}
+	}
+	for id := range s.Nodes {
+		if _, listed := groupOf[id]; !listed {
+			groupOf[id] = len(groups)
+		}
+	}
+
+	s.Severed = make(map[Link]bool)
+	ids := sortedKeys(s.Nodes)
+	for i, a := range ids {
+		for _, b := range ids[i+1:] {
+			if groupOf[a] != groupOf[b] {
+				s.Severed[NewLink(a, b)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// HealPartition restores the links CreatePartition severed and reconciles
+// the clocks that diverged meanwhile
+func (s *System) HealPartition() *Reconciliation {
+	s.Lock.Lock()
+	healed := len(s.Severed)
+	s.Severed = nil
+	view := s.View
+	s.Lock.Unlock()
+	if healed > 0 {
+		s.Hooks.Fire(HookEvent{Kind: HookHeal, View: view, Detail: fmt.Sprintf("%d severed links restored", healed)})
+	}
+	return s.Reconcile()
+}
+
+// IsSevered reports whether the link between a and b is severed
+func (s *System) IsSevered(a, b string) bool {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	return s.Severed[NewLink(a, b)]
+}
+
+// Reconciliation reports a reconciliation pass
+type Reconciliation struct {
+	Nodes     []string         // Nodes that merged their clocks
+	Divergent [][2]string      // Pairs of nodes whose clocks were concurrent about third nodes
+	Raised    map[string]int   // Entries each node raised
+	Merged    map[string]int64 // The clock every node ends with
+}
+
+// Reconcile merges the clocks of the honest reachable nodes, raising every
+// entry to the highest timestamp any of them holds
+func (s *System) Reconcile() *Reconciliation {
+	s.Lock.RLock()
+	var nodes []*Node
+	for _, id := range sortedKeys(s.Nodes) {
+		if node := s.Nodes[id]; s.reachable(node) && !node.IsByzantine {
+			nodes = append(nodes, node)
+		}
+	}
+	s.Lock.RUnlock()
+
+	r := &Reconciliation{Raised: make(map[string]int), Merged: make(map[string]int64)}
+	clocks := make([]map[string]int64, len(nodes))
+	for i, node := range nodes {
+		node.Lock.RLock()
+		clocks[i] = node.VectorClock.Timestamps()
+		node.Lock.RUnlock()
+		r.Nodes = append(r.Nodes, node.ID)
+		for id, ts := range clocks[i] {
+			r.Merged[id] = max(r.Merged[id], ts)
+		}
+	}
+	for i := range nodes {
+		for j := i + 1; j < len(nodes); j++ {
+			if concurrent(clocks[i], clocks[j], nodes[i].ID, nodes[j].ID) {
+				r.Divergent = append(r.Divergent, [2]string{nodes[i].ID, nodes[j].ID})
+			}
+		}
+	}
+
+	for i, node := range nodes {
+		node.Lock.Lock()
+		for _, id := range sortedKeys(r.Merged) {
+			if ts := r.Merged[id]; clocks[i][id] < ts {
+				node.VectorClock.Update(id, ts)
+				r.Raised[node.ID]++
+			}
+		}
+		node.Lock.Unlock()
+	}
+	return r
+}
+
+// concurrent reports whether each clock has an entry above the other's. The
+// entries of the clocks' own nodes are skipped: a node does not record its
+// own timestamps, so only disagreement about third nodes counts.
+func concurrent(a, b map[string]int64, aID, bID string) bool {
+	var less, greater bool
+	for id, ts := range a {
+		if id == aID || id == bID {
+			continue
+		}
+		if ts > b[id] {
+			greater = true
+		} else if ts < b[id] {
+			less = true
+		}
+	}
+	for id, ts := range b {
+		if _, exists := a[id]; !exists && ts > 0 && id != aID && id != bID {
+			less = true
+		}
+	}
+	return less && greater
+}
+
+// String renders the reconciliation as a report
+func (r *Reconciliation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Reconciled %d nodes, %d divergent pairs\n", len(r.Nodes), len(r.Divergent))
+	for _, pair := range r.Divergent {
+		fmt.Fprintf(&b, "  %s and %s were concurrent\n", pair[0], pair[1])
+	}
+	for _, id := range r.Nodes {
+		if r.Raised[id] > 0 {
+			fmt.Fprintf(&b, "  %s raised %d entries\n", id, r.Raised[id])
+		}
+	}
+	fmt.Fprintf(&b, "Merged clock: %v\n", r.Merged)
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCreatePartitionSeversLinks tests that updates cross no link between groups until the partition heals
+func TestCreatePartitionSeversLinks(t *testing.T) {
+	system := newGeoSystem(t)
+	for _, node := range system.Nodes {
+		for _, peer := range sortedKeys(system.Nodes) {
+			if peer != node.ID {
+				node.Neighbors = append(node.Neighbors, peer)
+			}
+		}
+	}
+	if err := system.CreatePartition([]string{"A", "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if !system.IsSevered("B", "D") || system.IsSevered("A", "B") || system.IsSevered("D", "G") {
+		t.Errorf("Expected only the links between {A,B} and {D,G} severed, got %v", system.Severed)
+	}
+
+	a := system.Nodes["A"]
+	a.PropagateClockUpdate(a.GetClockUpdate(), system)
+	if system.Nodes["B"].VectorClock.GetTimestamp("A") == 0 {
+		t.Errorf("Expected B to receive A's update within its group")
+	}
+	if system.Nodes["D"].VectorClock.GetTimestamp("A") != 0 {
+		t.Errorf("Expected D not to receive A's update across the partition")
+	}
+	if geometry := AnalyzeQuorums(system, 1); len(geometry.Formable) != 0 {
+		t.Errorf("Expected no quorum of 3 across a 2-2 split, got %v", geometry.Formable)
+	}
+
+	system.HealPartition()
+	if system.IsSevered("B", "D") {
+		t.Errorf("Expected healing to restore the links")
+	}
+}
+
+// TestCreatePartitionRejectsBadGroups tests that unknown and repeated nodes are rejected
+func TestCreatePartitionRejectsBadGroups(t *testing.T) {
+	system := newGeoSystem(t)
+	for _, groups := range [][][]string{
+		nil,
+		{{"A", "Z"}},
+		{{"A", "B"}, {"B", "D"}},
+	} {
+		if err := system.CreatePartition(groups...); !errors.Is(err, ErrInvalidPartition) {
+			t.Errorf("Expected ErrInvalidPartition for %v, got %v", groups, err)
+		}
+	}
+}
+
+// TestHealPartitionReconciles tests that clocks which diverged during a split agree after healing
+func TestHealPartitionReconciles(t *testing.T) {
+	system := newGeoSystem(t)
+	system.Nodes["A"].VectorClock.Update("G", 5)
+	system.Nodes["D"].VectorClock.Update("B", 7)
+	system.Nodes["G"].IsByzantine = true
+	system.Nodes["G"].VectorClock.Update("A", 99)
+
+	r := system.HealPartition()
+	if len(r.Divergent) != 1 || r.Divergent[0] != [2]string{"A", "D"} {
+		t.Errorf("Expected A and D to have diverged, got %v", r.Divergent)
+	}
+	for _, id := range []string{"A", "B", "D"} {
+		clock := system.Nodes[id].VectorClock
+		if clock.GetTimestamp("G") != 5 || clock.GetTimestamp("B") != 7 {
+			t.Errorf("Expected %s to hold G=5 and B=7, got %v", id, clock.Timestamps())
+		}
+		if clock.GetTimestamp("A") != 0 {
+			t.Errorf("Expected the Byzantine clock of G not to be merged into %s", id)
+		}
+	}
+	if r.Raised["B"] != 2 || r.Raised["A"] != 1 {
+		t.Errorf("Expected B to raise 2 entries and A 1, got %v", r.Raised)
+	}
+}
@@ -0,0 +1,963 @@
+package bft
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// PBFT three-phase consensus.
+//
+// Every voter runs a PBFTReplica. The primary of view v is the (v mod n)th
+// voter in ID order. It assigns the next sequence number to a client payload
+// and broadcasts a PRE-PREPARE. A backup accepts the pre-prepare if it comes
+// from the primary of its current view, the sequence number is inside the
+// window above the last executed entry, and no other digest was accepted for
+// that view and sequence number; it then broadcasts a PREPARE. An entry is
+// prepared once 2f+1 replicas vouch for its digest, the primary through its
+// pre-prepare and 2f backups through prepares, and the replica broadcasts a
+// COMMIT. With 2f+1 matching commits the entry is committed and is executed
+// as soon as every lower sequence number has been. Executing a clock update
+// applies it to the replica's vector clock, so clocks only move through
+// updates the replicas agreed on.
+//
+// Messages are signed by their sender and checked by the receiver. PBFT
+// carries them over the system's simulated network as encoded frames, with
+// region latencies and losses on unreachable links, and reports when each
+// replica executed each entry. A Byzantine backup votes for a forged digest,
+// which honest replicas never count; a Byzantine primary sends conflicting
+// pre-prepares, so no digest gathers a quorum; attacks.go adds a flooding
+// strategy and bounds what a Byzantine replica can send. Clients send
+// requests to every replica, and backups that wait too long for one to
+// execute replace the primary; see pbft_view.go.
+//
+// A committed FaultChange entry starts a new epoch with a different f one
+// window after its sequence number; see reconfig.go. A committed
+// ConfigChange entry sets a tunable on every replica; see configstore.go.
+
+// PBFTWindow is how far past the last executed entry a sequence number may go
+const PBFTWindow = 128
+
+// DefaultCheckpointInterval is how many entries PBFT executes between stable
+// checkpoints
+const DefaultCheckpointInterval = PBFTWindow
+
+var (
+	ErrNotPrimary            = errors.New("replica is not the primary")
+	ErrTooFewReplicas        = errors.New("too few replicas to tolerate f faults")
+	ErrRejectedMessage       = errors.New("consensus message rejected")
+	ErrConflictingPrePrepare = errors.New("conflicting pre-prepare")
+	ErrConsensusSignature    = errors.New("invalid consensus message signature")
+
+	errExecuted   = errors.New("entry already executed")
+	errFutureView = errors.New("message for a view not yet installed")
+)
+
+// PrePrepare is the primary's assignment of a sequence number to a payload
+type PrePrepare struct {
+	View      int64
+	Seq       uint64
+	Digest    string
+	Payload   []byte
+	Replica   string // The primary
+	Signature string
+}
+
+// Prepare is a backup's vote for a pre-prepared digest
+type Prepare struct {
+	View      int64
+	Seq       uint64
+	Digest    string
+	Replica   string
+	Signature string
+}
+
+// Commit is a replica's vote to commit a prepared digest
+type Commit struct {
+	View      int64
+	Seq       uint64
+	Digest    string
+	Replica   string
+	Signature string
+}
+
+// phaseDigest returns what a replica signs for a consensus message
+func phaseDigest(phase string, view int64, seq uint64, digest, replica string) []byte {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d:%s:%s", phase, view, seq, digest, replica)))
+	return hash[:]
+}
+
+// PBFTExecution is an entry a replica executed
+type PBFTExecution struct {
+	Seq     uint64
+	View    int64 // View the entry was pre-prepared in
+	Digest  string
+	Payload []byte
+}
+
+// pbftSlot is a replica's log entry for one sequence number
+type pbftSlot struct {
+	prePrepare *PrePrepare
+	prepares   map[string]string // Backup to the digest it prepared, first vote only
+	signatures map[string]string // Backup to the signature on its prepare
+	commits    map[string]string // Replica to the digest it committed, first vote only
+	prepared   bool
+	committed  bool
+}
+
+// PBFTEpoch is the fault tolerance from sequence number Start on
+type PBFTEpoch struct {
+	Epoch int64
+	Start uint64
+	F     int
+}
+
+// PBFTReplica is one voter's consensus state
+type PBFTReplica struct {
+	Node         *Node
+	View         int64
+	Epochs       []PBFTEpoch // In order of Start, the first one starting at 1
+	Window       uint64      // Sequence numbers accepted past the last executed one, PBFTWindow if zero
+	Replicas     []string    // Voters in ID order
+	LastExecuted uint64
+	Executed     []PBFTExecution
+	Summaries    []*LogSummary // Compacted ranges of Executed, oldest first, see Compact
+	Attack       PBFTAttack    // What the replica does if its node is Byzantine, AttackEquivocate if empty
+	Config       *ConfigStore  // Tunables set by committed ConfigChange entries
+	// Handlers replace the built-in handlers of some message types, for
+	// A/B experiments; see abtest.go
+	Handlers map[MessageType]PBFTHandler
+	// Execute applies a committed payload, in sequence order. Operations
+	// are applied to the node if nil, see applyOperation.
+	Execute func(seq uint64, payload []byte)
+	// Metrics counts the lookups of the node's certificate cache when set
+	Metrics *Metrics
+	Lock    sync.Mutex
+	keys    map[string]crypto.PublicKey
+	nextSeq uint64
+	slots   map[uint64]*pbftSlot
+	certs   map[uint64]PreparedCert // Latest prepared certificate per sequence number
+	outbox  []consensusSend
+	pending [][]byte        // Requests not yet executed, in arrival order
+	done    map[string]bool // Digests of executed requests
+	// assigned holds the digests with a sequence number in the current view
+	assigned    map[string]bool
+	changing    bool // Waiting for the NEW-VIEW of View
+	stalled     int  // View changes since the last execution
+	armed       bool // A view timer is running
+	timers      []pbftTimer
+	viewChanges map[int64]map[string]*ViewChange
+	early       []pbftEarly                // Messages for a view not yet installed
+	proofs      map[uint64]*InclusionProof // Of compacted entries by sequence number
+}
+
+// NewPBFTReplica creates the replica for node among the given voters
+func NewPBFTReplica(node *Node, voters []*Node, f int) *PBFTReplica {
+	r := &PBFTReplica{
+		Node:   node,
+		Epochs: []PBFTEpoch{{Start: 1, F: f}},
+		Config: NewConfigStore(),
+		keys:   make(map[string]crypto.PublicKey),
+		slots:  make(map[uint64]*pbftSlot),
+		certs:  make(map[uint64]PreparedCert),
+		done:   make(map[string]bool),
+
+		assigned:    make(map[string]bool),
+		viewChanges: make(map[int64]map[string]*ViewChange),
+	}
+	for _, voter := range voters {
+		r.Replicas = append(r.Replicas, voter.ID)
+		r.keys[voter.ID] = voter.PublicKey
+	}
+	sort.Strings(r.Replicas)
+	return r
+}
+
+func (r *PBFTReplica) node() *Node     { return r.Node }
+func (r *PBFTReplica) group() []string { return r.Replicas }
+
+// PrimaryForView returns the round-robin primary of a view
+func (r *PBFTReplica) PrimaryForView(view int64) string {
+	return r.Replicas[int(view%int64(len(r.Replicas)))]
+}
+
+// FaultsAt returns the f that governs the entry at seq
+func (r *PBFTReplica) FaultsAt(seq uint64) int {
+	f := r.Epochs[0].F
+	for _, epoch := range r.Epochs {
+		if epoch.Start <= seq {
+			f = epoch.F
+		}
+	}
+	return f
+}
+
+// quorum is the number of matching votes that prepares or commits the entry
+// at seq
+func (r *PBFTReplica) quorum(seq uint64) int {
+	return 2*r.FaultsAt(seq) + 1
+}
+
+// window returns how many sequence numbers past the last executed one are
+// accepted
+func (r *PBFTReplica) window() uint64 {
+	if r.Window == 0 {
+		return PBFTWindow
+	}
+	return r.Window
+}
+
+// slot returns the log entry for seq, creating it if needed
+func (r *PBFTReplica) slot(seq uint64) *pbftSlot {
+	slot, exists := r.slots[seq]
+	if !exists {
+		slot = &pbftSlot{prepares: make(map[string]string), signatures: make(map[string]string), commits: make(map[string]string)}
+		r.slots[seq] = slot
+	}
+	return slot
+}
+
+// sign signs a consensus message with the replica's key
+func (r *PBFTReplica) sign(phase string, view int64, seq uint64, digest string) string {
+	signature, err := crypto.Sign(r.Node.PrivateKey, phaseDigest(phase, view, seq, digest, r.Node.ID))
+	if err != nil {
+		return ""
+	}
+	return signature
+}
+
+// vote returns the digest the replica votes for, forged if it is Byzantine
+func (r *PBFTReplica) vote(digest string) string {
+	if r.follows(AttackForgeVotes) {
+		return PayloadDigest([]byte("forged:" + digest))
+	}
+	return digest
+}
+
+// Propose assigns the next sequence number to payload and pre-prepares it.
+// Only the primary of the current view may propose.
+func (r *PBFTReplica) Propose(payload []byte) (uint64, error) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	return r.propose(payload)
+}
+
+func (r *PBFTReplica) propose(payload []byte) (uint64, error) {
+	if primary := r.PrimaryForView(r.View); primary != r.Node.ID {
+		return 0, fmt.Errorf("%w: %s, primary of view %d is %s", ErrNotPrimary, r.Node.ID, r.View, primary)
+	}
+	if r.changing {
+		return 0, fmt.Errorf("%w: %s is changing to view %d", ErrNotPrimary, r.Node.ID, r.View)
+	}
+	if r.nextSeq < r.LastExecuted {
+		r.nextSeq = r.LastExecuted
+	}
+	if r.nextSeq >= r.LastExecuted+r.window() {
+		return 0, fmt.Errorf("%w: window of %d entries is full", ErrRejectedMessage, r.window())
+	}
+	r.nextSeq++
+	seq := r.nextSeq
+	r.assigned[PayloadDigest(payload)] = true
+
+	pp := r.prePrepare(seq, payload)
+	r.slot(seq).prePrepare = pp
+	if !r.follows(AttackEquivocate) {
+		r.outbox = append(r.outbox, consensusSend{Msg: pp})
+	} else {
+		// Equivocate: every other backup gets a different payload
+		for i, id := range r.Replicas {
+			if id == r.Node.ID {
+				continue
+			}
+			if i%2 == 0 {
+				r.outbox = append(r.outbox, consensusSend{To: id, Msg: r.prePrepare(seq, append([]byte("forged:"), payload...))})
+			} else {
+				r.outbox = append(r.outbox, consensusSend{To: id, Msg: pp})
+			}
+		}
+	}
+	r.advance(seq)
+	return seq, nil
+}
+
+// prePrepare builds a signed pre-prepare for payload at seq
+func (r *PBFTReplica) prePrepare(seq uint64, payload []byte) *PrePrepare {
+	digest := PayloadDigest(payload)
+	return &PrePrepare{
+		View:      r.View,
+		Seq:       seq,
+		Digest:    digest,
+		Payload:   payload,
+		Replica:   r.Node.ID,
+		Signature: r.sign("pre-prepare", r.View, seq, digest),
+	}
+}
+
+// Request records a client request. The primary proposes it; a backup starts
+// its view timer, which replaces the primary if the request is not executed
+// in time.
+func (r *PBFTReplica) Request(payload []byte) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	digest := PayloadDigest(payload)
+	if r.done[digest] {
+		return
+	}
+	for _, request := range r.pending {
+		if PayloadDigest(request) == digest {
+			return
+		}
+	}
+	r.pending = append(r.pending, payload)
+	if r.PrimaryForView(r.View) == r.Node.ID && !r.changing {
+		r.propose(payload)
+		return
+	}
+	r.arm()
+}
+
+// Deliver handles a consensus message from another replica
+func (r *PBFTReplica) Deliver(from string, m Message) error {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	return r.deliver(from, m)
+}
+
+func (r *PBFTReplica) deliver(from string, m Message) error {
+	var err error
+	if handler := r.Handlers[m.MessageType()]; handler != nil {
+		return r.handled(from, m, handler(r, from, m))
+	}
+	switch m := m.(type) {
+	case *PrePrepare:
+		err = r.handlePrePrepare(from, m)
+	case *Prepare:
+		err = r.handlePrepare(from, m)
+	case *Commit:
+		err = r.handleCommit(from, m)
+	case *ViewChangeRequest:
+		err = r.handleViewChange(from, m)
+	case *NewViewAnnouncement:
+		err = r.handleNewView(from, m)
+	default:
+		return fmt.Errorf("%w: %v", ErrUnknownMessage, m.MessageType())
+	}
+	return r.handled(from, m, err)
+}
+
+// handled turns the error a handler returned for m into the error of its
+// delivery
+func (r *PBFTReplica) handled(from string, m Message, err error) error {
+	switch err {
+	case errExecuted:
+		// Votes still arriving for an entry this replica already executed
+		return nil
+	case errFutureView:
+		// Backups of the new view may vote before the NEW-VIEW reaches us
+		return r.hold(from, m)
+	}
+	return err
+}
+
+// hold keeps a signed message of a view not yet installed until the view
+// is. Only the view the replica is in or moving to and the one after are
+// held, at most two per sequence number in the window from each sender and
+// view, so that no sender can make the replica buffer without bound.
+func (r *PBFTReplica) hold(from string, m Message) error {
+	var view int64
+	switch m := m.(type) {
+	case *PrePrepare:
+		view = m.View
+	case *Prepare:
+		view = m.View
+	case *Commit:
+		view = m.View
+	}
+	if view > r.View+1 {
+		return fmt.Errorf("%w: %s for view %d in view %d", ErrRejectedMessage, phaseName(m), view, r.View)
+	}
+	held := 0
+	for _, early := range r.early {
+		if early.From == from && early.View == view {
+			held++
+		}
+	}
+	if held >= 2*int(r.window()) {
+		return fmt.Errorf("%w: %d messages from %s held for view %d", ErrRejectedMessage, held, from, view)
+	}
+	r.early = append(r.early, pbftEarly{From: from, View: view, Msg: m})
+	return nil
+}
+
+// check validates the fields every consensus message shares
+func (r *PBFTReplica) check(phase, from, replica string, view int64, seq uint64, digest, signature string) error {
+	if from != replica {
+		return fmt.Errorf("%w: %s sent by %s", ErrRejectedMessage, phase, from)
+	}
+	key, exists := r.keys[replica]
+	if !exists {
+		return fmt.Errorf("%w: %s from non-replica %s", ErrRejectedMessage, phase, replica)
+	}
+	if view < r.View {
+		return fmt.Errorf("%w: %s for view %d in view %d", ErrRejectedMessage, phase, view, r.View)
+	}
+	if seq <= r.LastExecuted {
+		return errExecuted
+	}
+	if seq > r.LastExecuted+r.window() {
+		return fmt.Errorf("%w: %s seq %d outside window above %d", ErrRejectedMessage, phase, seq, r.LastExecuted)
+	}
+	// Checked before a message of a later view is held, so only its
+	// sender can have it held
+	if !r.Node.verifySignature(r.Metrics, key, phaseDigest(phase, view, seq, digest, replica), signature) {
+		return fmt.Errorf("%w: %s from %s at seq %d", ErrConsensusSignature, phase, replica, seq)
+	}
+	if view > r.View || r.changing {
+		return errFutureView
+	}
+	return nil
+}
+
+func (r *PBFTReplica) handlePrePrepare(from string, m *PrePrepare) error {
+	if err := r.check("pre-prepare", from, m.Replica, m.View, m.Seq, m.Digest, m.Signature); err != nil {
+		return err
+	}
+	if primary := r.PrimaryForView(m.View); m.Replica != primary {
+		return fmt.Errorf("%w: pre-prepare from %s, primary is %s", ErrRejectedMessage, m.Replica, primary)
+	}
+	if PayloadDigest(m.Payload) != m.Digest {
+		return fmt.Errorf("%w: pre-prepare digest mismatch at seq %d", ErrRejectedMessage, m.Seq)
+	}
+	slot := r.slot(m.Seq)
+	if slot.prePrepare != nil {
+		if slot.prePrepare.Digest != m.Digest {
+			return fmt.Errorf("%w: %s sent two digests for seq %d", ErrConflictingPrePrepare, m.Replica, m.Seq)
+		}
+		return nil
+	}
+	r.accept(m)
+	return nil
+}
+
+// accept logs a pre-prepare of the current view and prepares it
+func (r *PBFTReplica) accept(pp *PrePrepare) {
+	slot := r.slot(pp.Seq)
+	slot.prePrepare = pp
+	r.assigned[pp.Digest] = true
+	if pp.Replica != r.Node.ID {
+		prepare := &Prepare{View: pp.View, Seq: pp.Seq, Digest: r.vote(pp.Digest), Replica: r.Node.ID}
+		prepare.Signature = r.sign("prepare", prepare.View, prepare.Seq, prepare.Digest)
+		slot.prepares[r.Node.ID] = prepare.Digest
+		slot.signatures[r.Node.ID] = prepare.Signature
+		r.outbox = append(r.outbox, consensusSend{Msg: prepare})
+	}
+	r.advance(pp.Seq)
+}
+
+func (r *PBFTReplica) handlePrepare(from string, m *Prepare) error {
+	if err := r.check("prepare", from, m.Replica, m.View, m.Seq, m.Digest, m.Signature); err != nil {
+		return err
+	}
+	if m.Replica == r.PrimaryForView(m.View) {
+		return fmt.Errorf("%w: prepare from primary %s", ErrRejectedMessage, m.Replica)
+	}
+	slot := r.slot(m.Seq)
+	if _, voted := slot.prepares[m.Replica]; !voted {
+		slot.prepares[m.Replica] = m.Digest
+		slot.signatures[m.Replica] = m.Signature
+	}
+	r.advance(m.Seq)
+	return nil
+}
+
+func (r *PBFTReplica) handleCommit(from string, m *Commit) error {
+	if err := r.check("commit", from, m.Replica, m.View, m.Seq, m.Digest, m.Signature); err != nil {
+		return err
+	}
+	slot := r.slot(m.Seq)
+	if _, voted := slot.commits[m.Replica]; !voted {
+		slot.commits[m.Replica] = m.Digest
+	}
+	r.advance(m.Seq)
+	return nil
+}
+
+// matching counts the votes for digest
+func matching(votes map[string]string, digest string) int {
+	count := 0
+	for _, vote := range votes {
+		if vote == digest {
+			count++
+		}
+	}
+	return count
+}
+
+// advance moves the entry at seq through the prepared and committed states
+// and executes whatever has become executable
+func (r *PBFTReplica) advance(seq uint64) {
+	slot := r.slots[seq]
+	if slot == nil || slot.prePrepare == nil {
+		return
+	}
+	digest := slot.prePrepare.Digest
+	if !slot.prepared && 1+matching(slot.prepares, digest) >= r.quorum(seq) {
+		slot.prepared = true
+		r.certify(seq, slot)
+		commit := &Commit{View: r.View, Seq: seq, Digest: r.vote(digest), Replica: r.Node.ID}
+		commit.Signature = r.sign("commit", commit.View, commit.Seq, commit.Digest)
+		slot.commits[r.Node.ID] = commit.Digest
+		r.outbox = append(r.outbox, consensusSend{Msg: commit})
+	}
+	if slot.prepared && !slot.committed && matching(slot.commits, digest) >= r.quorum(seq) {
+		slot.committed = true
+	}
+	for {
+		next := r.slots[r.LastExecuted+1]
+		if next == nil || !next.committed {
+			return
+		}
+		r.LastExecuted++
+		r.stalled = 0
+		pp := next.prePrepare
+		if pp.Payload == nil || r.done[pp.Digest] {
+			// A null proposal from a view change, or a request that a
+			// view change ordered twice
+			continue
+		}
+		r.done[pp.Digest] = true
+		r.pending = slices.DeleteFunc(r.pending, func(request []byte) bool { return PayloadDigest(request) == pp.Digest })
+		r.Executed = append(r.Executed, PBFTExecution{Seq: pp.Seq, View: pp.View, Digest: pp.Digest, Payload: pp.Payload})
+		if r.reconfigure(pp.Seq, pp.Payload) || r.configure(pp.Payload) {
+			continue
+		}
+		if r.Execute != nil {
+			r.Execute(pp.Seq, pp.Payload)
+		} else {
+			r.applyOperation(pp.Seq, pp.Payload)
+		}
+	}
+}
+
+// reconfigure schedules the epoch of a committed fault change and reports
+// whether payload was one. A change that the replicas cannot tolerate or
+// that does not follow the latest epoch is skipped by every replica alike.
+func (r *PBFTReplica) reconfigure(seq uint64, payload []byte) bool {
+	m, err := DecodeFrame(payload)
+	if err != nil {
+		return false
+	}
+	change, ok := m.(*FaultChange)
+	if !ok {
+		return false
+	}
+	latest := r.Epochs[len(r.Epochs)-1]
+	if change.Epoch != latest.Epoch+1 || checkFaults(len(r.Replicas), change.F) != nil {
+		return true
+	}
+	r.Epochs = append(r.Epochs, PBFTEpoch{Epoch: change.Epoch, Start: seq + r.window(), F: change.F})
+	return true
+}
+
+// certify keeps the certificate of an entry that just prepared. It outlives
+// the slot, which a view change discards.
+func (r *PBFTReplica) certify(seq uint64, slot *pbftSlot) {
+	pp := slot.prePrepare
+	prepares, signatures := []string{pp.Replica}, []string{pp.Signature}
+	for _, replica := range sortedKeys(slot.prepares) {
+		if slot.prepares[replica] == pp.Digest {
+			prepares = append(prepares, replica)
+			signatures = append(signatures, slot.signatures[replica])
+		}
+	}
+	r.certs[seq] = PreparedCert{View: pp.View, Seq: seq, Digest: pp.Digest, Payload: pp.Payload, Prepares: prepares, Signatures: signatures}
+}
+
+// PreparedCerts returns the certificates for the entries the replica has
+// prepared, in sequence order
+func (r *PBFTReplica) PreparedCerts() []PreparedCert {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	return r.preparedCerts()
+}
+
+func (r *PBFTReplica) preparedCerts() []PreparedCert {
+	certs := make([]PreparedCert, 0, len(r.certs))
+	for _, cert := range r.certs {
+		certs = append(certs, cert)
+	}
+	sort.Slice(certs, func(i, j int) bool { return certs[i].Seq < certs[j].Seq })
+	return certs
+}
+
+// drain returns and clears the messages waiting to be sent and the view
+// timers waiting to be started
+func (r *PBFTReplica) drain() ([]consensusSend, []pbftTimer) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	sends, timers := r.outbox, r.timers
+	r.outbox, r.timers = nil, nil
+	return sends, timers
+}
+
+// PBFTStats counts the consensus traffic of a run
+type PBFTStats struct {
+	MessageStats
+	Throttled   int // Messages of Byzantine replicas their budget did not cover
+	ViewChanges int // Views installed after view 0
+}
+
+// PBFTOutcome is what happened to a submitted payload
+type PBFTOutcome struct {
+	Seq      uint64 // Where the entry was executed, 0 if nowhere yet
+	View     int64  // View of the first execution
+	Digest   string
+	Executed []string // Replicas that executed the entry, in ID order
+	// Committed is set once f+1 replicas executed the entry, enough matching
+	// replies for a client to accept the result
+	Committed bool
+	Latency   time.Duration // From submission until the (f+1)th execution
+}
+
+// pbftRequest tracks a submitted payload
+type pbftRequest struct {
+	digest    string
+	submitted time.Duration
+	seq       uint64
+	view      int64
+	executed  map[string]time.Duration
+}
+
+// PBFT runs a PBFT replica on every voter of a system, with a driver
+// carrying their messages over its simulated network
+type PBFT struct {
+	driver[*PBFTReplica, pbftTimer]
+	F        int // Tolerated faults in epoch 0
+	Replicas map[string]*PBFTReplica
+	View     int64 // Latest view a replica installed
+	// ViewTimeout is how long a backup waits for a request to execute
+	// before it asks for the next view, DefaultViewTimeout if zero. It
+	// doubles with every view change that brings no progress.
+	ViewTimeout time.Duration
+	// OnViewChange is called when the first replica installs a view, after
+	// the system's leader was set to its primary
+	OnViewChange func(view int64, primary string)
+	// Detached leaves the system's leader alone when a view is installed,
+	// for a PBFT ordering one namespace of a system, see engines.go
+	Detached bool
+	// Budget bounds what each Byzantine replica sends; see attacks.go
+	Budget ByzantineBudget
+	// VerifyCost is how long a replica spends checking a message. Messages
+	// that arrive while it is busy wait their turn; zero checks instantly.
+	VerifyCost time.Duration
+	// CheckpointInterval is how many entries a quorum executes between the
+	// compactions that serve as stable checkpoints, so that certificates
+	// and slots do not pile up; DefaultCheckpointInterval if zero
+	CheckpointInterval uint64
+	Stats              PBFTStats
+	checkpoints        []*LogSummary // Taken so far, for replicas that catch up later
+	requests           map[string]*pbftRequest
+	busy               map[string]time.Duration // When each replica is done checking its queue
+	meters             map[string]*budgetMeter
+}
+
+// NewPBFT creates replicas for the system's voters, all in view 0. A
+// negative f uses the system's fault tolerance.
+func NewPBFT(system *System, f int) (*PBFT, error) {
+	system.Lock.RLock()
+	voters := system.voters()
+	if f < 0 {
+		f = system.faultThreshold(len(voters))
+	}
+	system.Lock.RUnlock()
+
+	if len(voters) == 0 || len(voters) < 3*f+1 {
+		return nil, fmt.Errorf("%w: %d voters, f=%d needs %d", ErrTooFewReplicas, len(voters), f, 3*f+1)
+	}
+	p := &PBFT{
+		F:        f,
+		Replicas: make(map[string]*PBFTReplica),
+		requests: make(map[string]*pbftRequest),
+		busy:     make(map[string]time.Duration),
+		meters:   make(map[string]*budgetMeter),
+	}
+	p.driver = newDriver[*PBFTReplica, pbftTimer](system, "pbft", p.Replicas, &p.Stats.MessageStats)
+	p.kind = phaseName
+	p.timer = func(replica *PBFTReplica, timer pbftTimer) (time.Duration, string) {
+		return p.viewTimeout(timer.Stalled), fmt.Sprintf("view timer of %s in view %d", replica.Node.ID, timer.View)
+	}
+	p.settle = func(replica *PBFTReplica) {
+		p.installed(replica)
+		p.executed(replica)
+		p.checkpoint()
+	}
+	p.driver.affords = p.affords
+	p.driver.arrive = p.arrive
+	p.outstanding = func() bool {
+		for digest := range p.requests {
+			if !p.Outcome(digest).Committed {
+				return true
+			}
+		}
+		return false
+	}
+	p.status = func(replica *PBFTReplica) string {
+		replica.Lock.Lock()
+		defer replica.Lock.Unlock()
+		state := "installed"
+		if replica.changing {
+			state = "changing"
+		}
+		return fmt.Sprintf("Replica %s: view %d %s, executed up to %d, %d requests pending, %d timers",
+			replica.Node.ID, replica.View, state, replica.LastExecuted, len(replica.pending), len(replica.timers))
+	}
+	for _, voter := range voters {
+		p.Replicas[voter.ID] = NewPBFTReplica(voter, voters, f)
+		p.Replicas[voter.ID].Metrics = system.Metrics
+	}
+	return p, nil
+}
+
+// Primary returns the primary of the latest view
+func (p *PBFT) Primary() *PBFTReplica {
+	ids := sortedKeys(p.Replicas)
+	return p.Replicas[p.Replicas[ids[0]].PrimaryForView(p.View)]
+}
+
+// Submit sends payload to every reachable replica for ordering and returns
+// its digest, which identifies the request. Call Run to carry the protocol
+// messages.
+func (p *PBFT) Submit(payload []byte) (string, error) {
+	digest := PayloadDigest(payload)
+	if _, exists := p.requests[digest]; exists {
+		return "", fmt.Errorf("%w: request %s already submitted", ErrRejectedMessage, digest)
+	}
+	p.requests[digest] = &pbftRequest{
+		digest:    digest,
+		submitted: p.Scheduler.Now,
+		executed:  make(map[string]time.Duration),
+	}
+	p.submit(payload)
+	return digest, nil
+}
+
+// SubmitClockUpdate orders a clock update as a clock operation, which
+// replicas apply to their vector clocks once it commits
+func (p *PBFT) SubmitClockUpdate(update *ClockUpdate) (string, error) {
+	return p.SubmitOperation(ClockOperation(update))
+}
+
+// SubmitFaultChange orders a configuration entry setting f, which takes
+// effect one window after its sequence number
+func (p *PBFT) SubmitFaultChange(f int) (string, error) {
+	primary := p.Primary()
+	primary.Lock.Lock()
+	err := checkFaults(len(primary.Replicas), f)
+	epoch := primary.Epochs[len(primary.Epochs)-1].Epoch + 1
+	primary.Lock.Unlock()
+	if err != nil {
+		return "", err
+	}
+	frame, err := EncodeFrame(&FaultChange{Epoch: epoch, F: f})
+	if err != nil {
+		return "", err
+	}
+	return p.Submit(frame)
+}
+
+// After schedules hook at d past the current simulated time, so a test or a
+// simulation can inject faults while the protocol runs
+func (p *PBFT) After(d time.Duration, hook func()) {
+	p.Scheduler.After(d, hook)
+}
+
+// KillPrimary crash-stops the primary of the latest view and returns its ID.
+// Its messages in flight are lost; the backups replace it once their view
+// timers expire.
+func (p *PBFT) KillPrimary() (string, error) {
+	primary := p.Primary().Node.ID
+	return primary, p.System.ApplyFault(FaultStep{Kind: FaultCrash, Nodes: []string{primary}})
+}
+
+// arrive queues a frame that reached its receiver behind the ones the
+// receiver is still checking
+func (p *PBFT) arrive(from, to string, frame []byte) {
+	if p.VerifyCost == 0 {
+		p.deliver(from, to, frame)
+		return
+	}
+	done := max(p.Scheduler.Now, p.busy[to]) + p.VerifyCost
+	p.busy[to] = done
+	if frame == nil {
+		// Junk only costs the receiver its check
+		p.Stats.Rejected++
+		return
+	}
+	p.Scheduler.schedule(done, from+"->"+to+" awaiting verification", true, func() { p.deliver(from, to, frame) })
+}
+
+// checkpoint compacts the logs through the last multiple of the checkpoint
+// interval that a quorum of replicas executed. Replicas that were behind
+// compact with the checkpoints they missed once they computed the same
+// summaries.
+func (p *PBFT) checkpoint() {
+	interval := p.CheckpointInterval
+	if interval == 0 {
+		interval = DefaultCheckpointInterval
+	}
+	var stable uint64
+	if n := len(p.checkpoints); n > 0 {
+		stable = p.checkpoints[n-1].To
+	}
+	var executed []uint64
+	for _, id := range sortedKeys(p.Replicas) {
+		replica := p.Replicas[id]
+		p.executed(replica) // Before compaction drops the executions
+		replica.Lock.Lock()
+		replica.catchUp(p.checkpoints)
+		executed = append(executed, replica.LastExecuted)
+		replica.Lock.Unlock()
+	}
+	sort.Slice(executed, func(i, j int) bool { return executed[i] > executed[j] })
+	quorum := p.Primary().quorum(stable + interval)
+	if quorum > len(executed) {
+		return
+	}
+	through := executed[quorum-1] / interval * interval
+	if through <= stable {
+		return
+	}
+	if summary, err := p.Compact(through); err == nil {
+		p.checkpoints = append(p.checkpoints, summary)
+	}
+}
+
+// installed promotes the primary of a view the replica installed first
+func (p *PBFT) installed(replica *PBFTReplica) {
+	replica.Lock.Lock()
+	view, changing := replica.View, replica.changing
+	primary := replica.PrimaryForView(view)
+	replica.Lock.Unlock()
+	if changing || view <= p.View {
+		return
+	}
+	p.View = view
+	p.Stats.ViewChanges++
+	p.System.Metrics.add(metricViewChanges, "", 1)
+	p.System.trace(TraceEvent{Type: EventViewChange, Node: primary, Peer: replica.Node.ID, Detail: fmt.Sprintf("pbft view %d", view)})
+	if !p.Detached {
+		p.System.SetLeader(primary)
+	}
+	p.System.NodeLogger(replica.Node.ID).Info("view installed", "pbft_view", view, "primary", primary)
+	if p.OnViewChange != nil {
+		p.OnViewChange(view, primary)
+	}
+}
+
+// executed records when a replica executed submitted entries
+func (p *PBFT) executed(replica *PBFTReplica) {
+	var commits []TraceEvent
+	defer func() {
+		for _, event := range commits {
+			p.System.trace(event)
+		}
+	}()
+	replica.Lock.Lock()
+	defer replica.Lock.Unlock()
+	for _, execution := range replica.Executed {
+		request := p.requests[execution.Digest]
+		if request == nil {
+			continue
+		}
+		if _, done := request.executed[replica.Node.ID]; !done {
+			request.executed[replica.Node.ID] = p.Scheduler.Now
+			p.Scheduler.Progress()
+			logger := p.System.NodeLogger(replica.Node.ID)
+			logger.Debug("executed", "seq", execution.Seq, "digest", execution.Digest)
+			// The (f+1)th execution commits the entry
+			if len(request.executed) == replica.FaultsAt(execution.Seq)+1 {
+				p.System.Metrics.observeCommit("pbft", p.Scheduler.Now-request.submitted)
+				logger.Info("committed", "seq", execution.Seq, "digest", execution.Digest, "latency", p.Scheduler.Now-request.submitted)
+				commits = append(commits, TraceEvent{Type: EventCommit, Node: replica.Node.ID, Detail: fmt.Sprintf("pbft seq %d", execution.Seq)})
+			}
+		}
+		if request.seq == 0 {
+			request.seq, request.view = execution.Seq, replica.View
+		}
+	}
+}
+
+// viewTimeout is how long a timer runs after the given number of view
+// changes without progress
+func (p *PBFT) viewTimeout(stalled int) time.Duration {
+	timeout := p.ViewTimeout
+	if timeout == 0 {
+		timeout = DefaultViewTimeout
+	}
+	return timeout << stalled
+}
+
+// phaseName is the capture kind of a consensus message
+func phaseName(m Message) string {
+	switch m.(type) {
+	case *PrePrepare:
+		return "pre-prepare"
+	case *Prepare:
+		return "prepare"
+	case *Commit:
+		return "commit"
+	case *ViewChangeRequest:
+		return "view-change"
+	case *NewViewAnnouncement:
+		return "new-view"
+	}
+	return m.MessageType().String()
+}
+
+// Outcome reports what happened to the request with the given digest
+func (p *PBFT) Outcome(digest string) PBFTOutcome {
+	outcome := PBFTOutcome{Digest: digest}
+	request := p.requests[digest]
+	if request == nil {
+		return outcome
+	}
+	outcome.Seq, outcome.View = request.seq, request.view
+	outcome.Executed = sortedKeys(request.executed)
+	times := make([]time.Duration, 0, len(request.executed))
+	for _, at := range request.executed {
+		times = append(times, at)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	f := p.Primary().FaultsAt(request.seq)
+	if len(times) >= f+1 {
+		outcome.Committed = true
+		outcome.Latency = times[f] - request.submitted
+	}
+	return outcome
+}
+
+// Conflicts returns the sequence numbers, in order, at which replicas
+// executed different payloads
+func (p *PBFT) Conflicts() []uint64 {
+	executed := make(map[uint64]string)
+	conflicting := make(map[uint64]bool)
+	for _, id := range sortedKeys(p.Replicas) {
+		replica := p.Replicas[id]
+		replica.Lock.Lock()
+		for _, execution := range replica.Executed {
+			if digest, exists := executed[execution.Seq]; exists && digest != execution.Digest {
+				conflicting[execution.Seq] = true
+			}
+			executed[execution.Seq] = execution.Digest
+		}
+		replica.Lock.Unlock()
+	}
+	return sortedIndexes(conflicting)
+}
@@ -0,0 +1,261 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// newPBFT creates voters A-D, the given ones Byzantine, and their replicas
+func newPBFT(t *testing.T, byzantine ...string) *PBFT {
+	system := newTestSystem(t, nodeIDs(4), fixedClock(42), func(node *Node) {
+		node.IsByzantine = slices.Contains(byzantine, node.ID)
+	})
+	pbft, err := NewPBFT(system, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pbft
+}
+
+// TestPBFTCommitsClockUpdate tests that a clock update reaches the clocks only through the three phases
+func TestPBFTCommitsClockUpdate(t *testing.T) {
+	pbft := newPBFT(t)
+	if pbft.F != 1 || pbft.Primary().Node.ID != "A" {
+		t.Fatalf("Expected f=1 with A as primary of view 0, got f=%d primary %s", pbft.F, pbft.Primary().Node.ID)
+	}
+	update := pbft.System.Nodes["A"].GetClockUpdate()
+	digest, err := pbft.SubmitClockUpdate(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := pbft.System.Nodes["B"].VectorClock.Timestamps()["A"]; ts != 0 {
+		t.Errorf("Expected no clock change before consensus, got %d", ts)
+	}
+
+	pbft.Run()
+	outcome := pbft.Outcome(digest)
+	if !outcome.Committed || outcome.Seq != 1 || !reflect.DeepEqual(outcome.Executed, []string{"A", "B", "C", "D"}) {
+		t.Errorf("Expected every replica to execute seq 1, got %+v", outcome)
+	}
+	if outcome.Latency != 3*LocalLatency {
+		t.Errorf("Expected pre-prepare, prepare and commit to take %v, got %v", 3*LocalLatency, outcome.Latency)
+	}
+	for _, id := range []string{"A", "B", "C", "D"} {
+		if ts := pbft.System.Nodes[id].VectorClock.Timestamps()["A"]; ts != 42 {
+			t.Errorf("Expected %s to apply A=42, got %d", id, ts)
+		}
+	}
+}
+
+// TestPBFTExecutesInSequenceOrder tests that every replica executes the same payloads in the same order
+func TestPBFTExecutesInSequenceOrder(t *testing.T) {
+	pbft := newPBFT(t)
+	var digests []string
+	for i := 1; i <= 3; i++ {
+		digest, err := pbft.Submit([]byte(fmt.Sprintf("op-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, digest)
+	}
+	if _, err := pbft.Submit([]byte("op-1")); !errors.Is(err, ErrRejectedMessage) {
+		t.Errorf("Expected a resubmitted payload to be rejected, got %v", err)
+	}
+	pbft.Run()
+	for i, digest := range digests {
+		if seq := pbft.Outcome(digest).Seq; seq != uint64(i+1) {
+			t.Errorf("Expected op-%d at seq %d, got %d", i+1, i+1, seq)
+		}
+	}
+
+	reference := pbft.Replicas["A"].Executed
+	if len(reference) != 3 || string(reference[2].Payload) != "op-3" {
+		t.Fatalf("Expected A to execute op-1..op-3, got %+v", reference)
+	}
+	for id, replica := range pbft.Replicas {
+		if !reflect.DeepEqual(replica.Executed, reference) {
+			t.Errorf("Expected %s to execute %+v, got %+v", id, reference, replica.Executed)
+		}
+		if replica.LastExecuted != 3 {
+			t.Errorf("Expected %s to have executed up to 3, got %d", id, replica.LastExecuted)
+		}
+	}
+	if pbft.Stats.Rejected != 0 || pbft.Stats.Dropped != 0 || pbft.Stats.ViewChanges != 0 {
+		t.Errorf("Expected no rejected or dropped messages and no view change, got %+v", pbft.Stats)
+	}
+}
+
+// TestPBFTByzantineBackup tests that a forged vote is not counted and one more fault stalls commits
+func TestPBFTByzantineBackup(t *testing.T) {
+	pbft := newPBFT(t, "D")
+	digest, _ := pbft.Submit([]byte("op-1"))
+	pbft.Run()
+	if outcome := pbft.Outcome(digest); !outcome.Committed || len(outcome.Executed) != 4 {
+		t.Errorf("Expected A, B and C to commit despite D's forged votes, got %+v", outcome)
+	}
+
+	pbft.System.SetPartition("C", true)
+	digest, _ = pbft.Submit([]byte("op-2"))
+	pbft.Run()
+	if outcome := pbft.Outcome(digest); outcome.Committed || len(outcome.Executed) != 0 {
+		t.Errorf("Expected no commit with C partitioned and D Byzantine, got %+v", outcome)
+	}
+	if pbft.Stats.ViewChanges == 0 {
+		t.Errorf("Expected the backups to try other primaries")
+	}
+	if pbft.Stats.Dropped == 0 {
+		t.Errorf("Expected messages to C to be dropped")
+	}
+}
+
+// TestPBFTByzantinePrimary tests that conflicting pre-prepares stall the view until the backups replace the primary
+func TestPBFTByzantinePrimary(t *testing.T) {
+	pbft := newPBFT(t, "A")
+	digest, _ := pbft.Submit([]byte("op-1"))
+	pbft.Run()
+	for _, id := range []string{"B", "C", "D"} {
+		executed := pbft.Replicas[id].Executed
+		if len(executed) != 1 || string(executed[0].Payload) != "op-1" {
+			t.Errorf("Expected %s to execute only the genuine payload, got %+v", id, executed)
+		}
+	}
+	outcome := pbft.Outcome(digest)
+	if !outcome.Committed || outcome.View != 1 || outcome.Latency < DefaultViewTimeout {
+		t.Errorf("Expected op-1 to commit in view 1 after the view timer, got %+v", outcome)
+	}
+	if pbft.Primary().Node.ID != "B" || pbft.System.GetLeader() != "B" {
+		t.Errorf("Expected B to lead view 1, got %s", pbft.Primary().Node.ID)
+	}
+}
+
+// TestPBFTRejectsInvalidMessages tests the checks a replica applies before counting a message
+func TestPBFTRejectsInvalidMessages(t *testing.T) {
+	pbft := newPBFT(t)
+	a, b := pbft.Replicas["A"], pbft.Replicas["B"]
+	if _, err := b.Propose([]byte("op")); !errors.Is(err, ErrNotPrimary) {
+		t.Errorf("Expected ErrNotPrimary from a backup, got %v", err)
+	}
+
+	prepare := &Prepare{View: 0, Seq: 1, Digest: PayloadDigest([]byte("op")), Replica: "C"}
+	prepare.Signature = pbft.Replicas["C"].sign("prepare", prepare.View, prepare.Seq, prepare.Digest)
+	if err := a.Deliver("C", prepare); err != nil {
+		t.Errorf("Expected a valid prepare to be accepted, got %v", err)
+	}
+	if err := a.Deliver("D", prepare); !errors.Is(err, ErrRejectedMessage) {
+		t.Errorf("Expected a relayed prepare to be rejected, got %v", err)
+	}
+
+	forged := *prepare
+	forged.Digest = PayloadDigest([]byte("other"))
+	if err := a.Deliver("C", &forged); !errors.Is(err, ErrConsensusSignature) {
+		t.Errorf("Expected ErrConsensusSignature for an altered prepare, got %v", err)
+	}
+
+	future := *prepare
+	future.View = 1
+	future.Signature = pbft.Replicas["C"].sign("prepare", future.View, future.Seq, future.Digest)
+	if err := a.Deliver("C", &future); err != nil || len(a.early) != 1 {
+		t.Errorf("Expected a prepare for a later view to be held, got %v", err)
+	}
+	far := *prepare
+	far.Seq = PBFTWindow + 1
+	if err := a.Deliver("C", &far); !errors.Is(err, ErrRejectedMessage) {
+		t.Errorf("Expected a prepare outside the window to be rejected, got %v", err)
+	}
+
+	pp := b.prePrepare(1, []byte("op"))
+	if err := pbft.Replicas["C"].Deliver("B", pp); !errors.Is(err, ErrRejectedMessage) {
+		t.Errorf("Expected a pre-prepare from a backup to be rejected, got %v", err)
+	}
+	if err := b.Deliver("A", &Entry{Key: "x"}); !errors.Is(err, ErrUnknownMessage) {
+		t.Errorf("Expected ErrUnknownMessage for a non-consensus message, got %v", err)
+	}
+}
+
+// TestPBFTConflictingPrePrepare tests that a second digest for a slot is reported as equivocation
+func TestPBFTConflictingPrePrepare(t *testing.T) {
+	pbft := newPBFT(t)
+	a, b := pbft.Replicas["A"], pbft.Replicas["B"]
+	if err := b.Deliver("A", a.prePrepare(1, []byte("op-1"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Deliver("A", a.prePrepare(1, []byte("op-1"))); err != nil {
+		t.Errorf("Expected a duplicate pre-prepare to be ignored, got %v", err)
+	}
+	if err := b.Deliver("A", a.prePrepare(1, []byte("op-2"))); !errors.Is(err, ErrConflictingPrePrepare) {
+		t.Errorf("Expected ErrConflictingPrePrepare, got %v", err)
+	}
+}
+
+// TestPBFTPreparedCerts tests that prepared entries yield certificates the view change accepts
+func TestPBFTPreparedCerts(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.Submit([]byte("op-1"))
+	pbft.Run()
+
+	var changes []ViewChange
+	for _, id := range []string{"A", "B", "C"} {
+		certs := pbft.Replicas[id].PreparedCerts()
+		if len(certs) != 1 || certs[0].Valid(pbft.F, pbft.Replicas[id].keys) != nil {
+			t.Fatalf("Expected %s to hold one valid certificate, got %+v", id, certs)
+		}
+		changes = append(changes, ViewChange{View: 1, Replica: id, Prepared: certs})
+	}
+	nv, err := BuildNewView(1, "B", changes, pbft.F, pbft.Replicas["B"].keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nv.Proposals) != 1 || string(nv.Proposals[0].Payload) != "op-1" {
+		t.Errorf("Expected op-1 to be re-proposed, got %+v", nv.Proposals)
+	}
+}
+
+// TestNewPBFTTooFewReplicas tests that f is checked against the number of voters
+func TestNewPBFTTooFewReplicas(t *testing.T) {
+	pbft := newPBFT(t)
+	if _, err := NewPBFT(pbft.System, 2); !errors.Is(err, ErrTooFewReplicas) {
+		t.Errorf("Expected ErrTooFewReplicas for f=2 with 4 voters, got %v", err)
+	}
+}
+
+// TestPBFTFaultChangeAtEpochBoundary tests that every replica switches f at the same sequence number
+func TestPBFTFaultChangeAtEpochBoundary(t *testing.T) {
+	pbft, err := NewPBFT(newFaultSystem(t), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, replica := range pbft.Replicas {
+		replica.Window = 4
+	}
+	if _, err := pbft.SubmitFaultChange(3); !errors.Is(err, ErrInvalidFaultConfig) {
+		t.Errorf("Expected ErrInvalidFaultConfig for f=3 with 7 replicas, got %v", err)
+	}
+	if _, err := pbft.SubmitFaultChange(2); err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+	expected := []PBFTEpoch{{Start: 1, F: 1}, {Epoch: 1, Start: 5, F: 2}}
+	for id, replica := range pbft.Replicas {
+		if !reflect.DeepEqual(replica.Epochs, expected) {
+			t.Errorf("Expected %s to schedule %+v, got %+v", id, expected, replica.Epochs)
+		}
+	}
+
+	// With three replicas down, entries before the boundary still commit under f=1
+	for _, id := range []string{"E", "F", "G"} {
+		pbft.System.SetPartition(id, true)
+	}
+	for seq := uint64(2); seq <= 5; seq++ {
+		digest, err := pbft.Submit([]byte(fmt.Sprintf("op-%d", seq)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pbft.Run()
+		if outcome := pbft.Outcome(digest); outcome.Committed != (seq < 5) {
+			t.Errorf("Expected seq %d committed=%t, got %+v", seq, seq < 5, outcome)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package bft
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PBFT view changes.
+//
+// A client sends its request to every replica. A backup that holds a request
+// starts a view timer; if the timer expires before the replica executed
+// anything new, the backup stops accepting messages of its view and
+// broadcasts a signed VIEW-CHANGE for the next view with the certificates of
+// every entry it prepared. A replica that sees f+1 replicas ask for later
+// views joins the lowest of them, since at least one of those replicas is
+// honest. The primary of the new view, again round-robin by view number,
+// collects 2f+1 view changes and broadcasts a NEW-VIEW carrying them together
+// with the proposals built from them (see viewchange.go). Every replica
+// checks the signatures and rebuilds the proposals before installing the
+// view, then prepares the proposals as pre-prepares of the new primary, who
+// signs each of them for the new view so that the certificates they prepare
+// into hold up in the view change after. The new primary finally proposes
+// the requests no proposal covers.
+//
+// If the NEW-VIEW does not arrive in time either, the replica moves on to the
+// view after. Each view change without an execution in between doubles the
+// timeout, and a replica gives up after trying every replica as primary, so
+// a run with too many faults ends instead of changing views forever.
+
+// DefaultViewTimeout is how long a backup waits for a request to execute
+const DefaultViewTimeout = time.Second
+
+// ViewChangeRequest is the wire form of a ViewChange
+type ViewChangeRequest struct {
+	View       int64
+	Replica    string
+	Prepared   []byte // JSON-encoded prepared certificates
+	Signature  string
+	Checkpoint []byte // JSON-encoded LogSummary, empty without one
+}
+
+// NewViewAnnouncement is the wire form of a NewView, signed by its leader
+type NewViewAnnouncement struct {
+	View      int64
+	Leader    string
+	Proof     []byte // JSON-encoded NewView
+	Signature string
+}
+
+// pbftTimer is a replica's view timer
+type pbftTimer struct {
+	View     int64  // View the replica was in or moving to
+	Executed uint64 // LastExecuted when the timer started
+	Stalled  int    // View changes since the last execution, doubles the timeout
+}
+
+// pbftEarly is a message held until its view is installed
+type pbftEarly struct {
+	From string
+	View int64
+	Msg  Message
+}
+
+// viewFaults is the f that view changes are checked against
+func (r *PBFTReplica) viewFaults() int {
+	return r.FaultsAt(r.LastExecuted + 1)
+}
+
+// arm starts the view timer unless it runs already or the replica gave up
+func (r *PBFTReplica) arm() {
+	if r.armed || r.stalled >= len(r.Replicas) {
+		return
+	}
+	r.armed = true
+	r.timers = append(r.timers, pbftTimer{View: r.View, Executed: r.LastExecuted, Stalled: r.stalled})
+}
+
+// Timeout handles an expired view timer
+func (r *PBFTReplica) Timeout(t pbftTimer) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	r.armed = false
+	switch {
+	case r.changing && t.View == r.View:
+		// The NEW-VIEW never came
+		r.startViewChange(r.View + 1)
+	case r.changing:
+		r.arm()
+	case len(r.pending) == 0:
+	case t.View != r.View || t.Executed != r.LastExecuted:
+		// Progress since the timer started, give the rest more time
+		r.arm()
+	default:
+		r.startViewChange(r.View + 1)
+	}
+}
+
+// startViewChange leaves the current view and asks for view
+func (r *PBFTReplica) startViewChange(view int64) {
+	r.View = view
+	r.changing = true
+	r.stalled++
+
+	certs := r.preparedCerts()
+	prepared, err := json.Marshal(certs)
+	if err != nil {
+		return
+	}
+	change := &ViewChange{View: view, Replica: r.Node.ID, Prepared: certs}
+	var checkpoint []byte
+	if n := len(r.Summaries); n > 0 {
+		change.Checkpoint = r.Summaries[n-1]
+		if checkpoint, err = json.Marshal(change.Checkpoint); err != nil {
+			return
+		}
+	}
+	change.Signature = r.sign("view-change", view, change.stable(), PayloadDigest(prepared))
+	r.record(change)
+	r.outbox = append(r.outbox, consensusSend{Msg: &ViewChangeRequest{
+		View:       view,
+		Replica:    r.Node.ID,
+		Prepared:   prepared,
+		Signature:  change.Signature,
+		Checkpoint: checkpoint,
+	}})
+	r.arm()
+	r.tryNewView()
+}
+
+// record keeps a valid view change
+func (r *PBFTReplica) record(change *ViewChange) {
+	changes, exists := r.viewChanges[change.View]
+	if !exists {
+		changes = make(map[string]*ViewChange)
+		r.viewChanges[change.View] = changes
+	}
+	changes[change.Replica] = change
+}
+
+// verifyViewChange checks a view change's signature
+func (r *PBFTReplica) verifyViewChange(change *ViewChange) error {
+	key, exists := r.keys[change.Replica]
+	if !exists {
+		return fmt.Errorf("%w: view change from non-replica %s", ErrRejectedMessage, change.Replica)
+	}
+	prepared, err := json.Marshal(change.Prepared)
+	if err != nil {
+		return err
+	}
+	if !r.Node.verifySignature(r.Metrics, key, phaseDigest("view-change", change.View, change.stable(), PayloadDigest(prepared), change.Replica), change.Signature) {
+		return fmt.Errorf("%w: view change from %s for view %d", ErrConsensusSignature, change.Replica, change.View)
+	}
+	return nil
+}
+
+// stale reports whether a view-change message is for a view the replica
+// already installed
+func (r *PBFTReplica) stale(view int64) bool {
+	return view < r.View || view == r.View && !r.changing
+}
+
+func (r *PBFTReplica) handleViewChange(from string, m *ViewChangeRequest) error {
+	if from != m.Replica {
+		return fmt.Errorf("%w: view change sent by %s", ErrRejectedMessage, from)
+	}
+	change := &ViewChange{View: m.View, Replica: m.Replica, Signature: m.Signature}
+	if err := json.Unmarshal(m.Prepared, &change.Prepared); err != nil {
+		return fmt.Errorf("%w: view change from %s: %v", ErrRejectedMessage, m.Replica, err)
+	}
+	if len(m.Checkpoint) > 0 {
+		if err := json.Unmarshal(m.Checkpoint, &change.Checkpoint); err != nil {
+			return fmt.Errorf("%w: view change from %s: %v", ErrRejectedMessage, m.Replica, err)
+		}
+	}
+	if err := r.verifyViewChange(change); err != nil {
+		return err
+	}
+	if r.stale(m.View) {
+		return nil
+	}
+	// Invalid certificates stay in the signed change but are ignored when
+	// the proposals are built, see reproposals
+	r.record(change)
+	r.join()
+	r.tryNewView()
+	return nil
+}
+
+// join moves to the lowest later view that f+1 replicas asked for
+func (r *PBFTReplica) join() {
+	var lowest int64
+	replicas := make(map[string]bool)
+	for view, changes := range r.viewChanges {
+		if view <= r.View {
+			continue
+		}
+		if lowest == 0 || view < lowest {
+			lowest = view
+		}
+		for replica := range changes {
+			replicas[replica] = true
+		}
+	}
+	if len(replicas) >= r.viewFaults()+1 {
+		r.startViewChange(lowest)
+	}
+}
+
+// tryNewView announces and installs the view the replica is moving to once
+// it is that view's primary and holds 2f+1 view changes for it
+func (r *PBFTReplica) tryNewView() {
+	if !r.changing || r.PrimaryForView(r.View) != r.Node.ID {
+		return
+	}
+	changes := r.viewChanges[r.View]
+	selected := make([]ViewChange, 0, len(changes))
+	for _, replica := range sortedKeys(changes) {
+		selected = append(selected, *changes[replica])
+	}
+	nv, err := BuildNewView(r.View, r.Node.ID, selected, r.viewFaults(), r.keys)
+	if err != nil {
+		return
+	}
+	for i := range nv.Proposals {
+		proposal := &nv.Proposals[i]
+		proposal.Signature = r.sign("pre-prepare", nv.View, proposal.Seq, proposal.Digest)
+	}
+	proof, err := json.Marshal(nv)
+	if err != nil {
+		return
+	}
+	r.outbox = append(r.outbox, consensusSend{Msg: &NewViewAnnouncement{
+		View:      nv.View,
+		Leader:    nv.Leader,
+		Proof:     proof,
+		Signature: r.sign("new-view", nv.View, 0, PayloadDigest(proof)),
+	}})
+	r.install(nv)
+}
+
+func (r *PBFTReplica) handleNewView(from string, m *NewViewAnnouncement) error {
+	if primary := r.PrimaryForView(m.View); from != m.Leader || m.Leader != primary {
+		return fmt.Errorf("%w: new-view for view %d from %s, primary is %s", ErrRejectedMessage, m.View, from, primary)
+	}
+	if !r.Node.verifySignature(r.Metrics, r.keys[m.Leader], phaseDigest("new-view", m.View, 0, PayloadDigest(m.Proof), m.Leader), m.Signature) {
+		return fmt.Errorf("%w: new-view from %s for view %d", ErrConsensusSignature, m.Leader, m.View)
+	}
+	if r.stale(m.View) {
+		return nil
+	}
+	var nv NewView
+	if err := json.Unmarshal(m.Proof, &nv); err != nil {
+		return fmt.Errorf("%w: new-view from %s: %v", ErrRejectedMessage, m.Leader, err)
+	}
+	if nv.View != m.View || nv.Leader != m.Leader {
+		return fmt.Errorf("%w: new-view proof is for view %d by %s", ErrRejectedMessage, nv.View, nv.Leader)
+	}
+	for i := range nv.ViewChanges {
+		if err := r.verifyViewChange(&nv.ViewChanges[i]); err != nil {
+			return err
+		}
+	}
+	if err := nv.Verify(r.viewFaults(), r.keys); err != nil {
+		return fmt.Errorf("%w: %v", ErrRejectedMessage, err)
+	}
+	for _, proposal := range nv.Proposals {
+		if PayloadDigest(proposal.Payload) != proposal.Digest {
+			return fmt.Errorf("%w: new-view from %s re-proposes a payload that does not match its digest at seq %d", ErrRejectedMessage, m.Leader, proposal.Seq)
+		}
+		if !r.Node.verifySignature(r.Metrics, r.keys[m.Leader], phaseDigest("pre-prepare", m.View, proposal.Seq, proposal.Digest, m.Leader), proposal.Signature) {
+			return fmt.Errorf("%w: new-view from %s re-proposes seq %d unsigned", ErrConsensusSignature, m.Leader, proposal.Seq)
+		}
+	}
+	r.install(&nv)
+	return nil
+}
+
+// install enters the new view: the log above the last executed entry is
+// replaced by the proposals, the messages held for the view are replayed
+// and the primary proposes the pending requests no proposal covers
+func (r *PBFTReplica) install(nv *NewView) {
+	r.View = nv.View
+	r.changing = false
+	for view := range r.viewChanges {
+		if view <= nv.View {
+			delete(r.viewChanges, view)
+		}
+	}
+	for seq := range r.slots {
+		if seq > r.LastExecuted {
+			delete(r.slots, seq)
+		}
+	}
+	r.assigned = make(map[string]bool)
+	r.nextSeq = max(r.LastExecuted, nv.Stable)
+	for _, proposal := range nv.Proposals {
+		if proposal.Seq <= r.LastExecuted {
+			continue
+		}
+		r.nextSeq = max(r.nextSeq, proposal.Seq)
+		r.accept(&PrePrepare{View: nv.View, Seq: proposal.Seq, Digest: proposal.Digest, Payload: proposal.Payload, Replica: nv.Leader, Signature: proposal.Signature})
+	}
+
+	early := r.early
+	r.early = nil
+	for _, held := range early {
+		r.deliver(held.From, held.Msg)
+	}
+
+	if r.PrimaryForView(r.View) != r.Node.ID {
+		if len(r.pending) > 0 {
+			r.arm()
+		}
+		return
+	}
+	for _, request := range r.pending {
+		if !r.assigned[PayloadDigest(request)] {
+			r.propose(request)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// TestPBFTKillPrimaryRecovers tests that the backups replace a crashed primary and keep ordering requests
+func TestPBFTKillPrimaryRecovers(t *testing.T) {
+	pbft := newPBFT(t)
+	var installed []string
+	pbft.OnViewChange = func(view int64, primary string) {
+		installed = append(installed, primary)
+	}
+	pbft.Submit([]byte("op-1"))
+	pbft.Run()
+
+	killed, err := pbft.KillPrimary()
+	if err != nil || killed != "A" {
+		t.Fatalf("Expected to kill A, got %s (%v)", killed, err)
+	}
+	digest, _ := pbft.Submit([]byte("op-2"))
+	pbft.Run()
+
+	outcome := pbft.Outcome(digest)
+	if !outcome.Committed || outcome.Seq != 2 || outcome.View != 1 || !reflect.DeepEqual(outcome.Executed, []string{"B", "C", "D"}) {
+		t.Errorf("Expected B, C and D to execute op-2 at seq 2 in view 1, got %+v", outcome)
+	}
+	if !reflect.DeepEqual(installed, []string{"B"}) || pbft.System.GetLeader() != "B" || pbft.Stats.ViewChanges != 1 {
+		t.Errorf("Expected one view change to B, got %v with leader %s", installed, pbft.System.GetLeader())
+	}
+	if outcome.Latency < DefaultViewTimeout || outcome.Latency > 2*DefaultViewTimeout {
+		t.Errorf("Expected recovery within two view timeouts, got %v", outcome.Latency)
+	}
+	reference := pbft.Replicas["B"].Executed
+	for _, id := range []string{"C", "D"} {
+		if !reflect.DeepEqual(pbft.Replicas[id].Executed, reference) {
+			t.Errorf("Expected %s to execute %+v, got %+v", id, reference, pbft.Replicas[id].Executed)
+		}
+	}
+}
+
+// TestPBFTKillPrimaryMidRequest tests that an entry pre-prepared before the primary died still executes at its sequence number
+func TestPBFTKillPrimaryMidRequest(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.Submit([]byte("op-1"))
+	// Kill A once its pre-prepare is out but before the prepares reach it
+	pbft.After(LocalLatency, func() { pbft.KillPrimary() })
+	pbft.Run()
+
+	for _, id := range []string{"B", "C", "D"} {
+		executed := pbft.Replicas[id].Executed
+		if len(executed) != 1 || executed[0].Seq != 1 || string(executed[0].Payload) != "op-1" {
+			t.Errorf("Expected %s to execute op-1 at seq 1, got %+v", id, executed)
+		}
+	}
+	if pbft.Stats.Dropped == 0 {
+		t.Errorf("Expected messages to the killed primary to be dropped")
+	}
+}
+
+// TestPBFTViewChangeGivesUp tests that replicas stop changing views when too many replicas are down
+func TestPBFTViewChangeGivesUp(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.System.SetPartition("A", true)
+	pbft.System.SetPartition("B", true)
+	digest, _ := pbft.Submit([]byte("op-1"))
+	pbft.Run()
+
+	if outcome := pbft.Outcome(digest); outcome.Committed {
+		t.Errorf("Expected no commit with two of four replicas down, got %+v", outcome)
+	}
+	for _, id := range []string{"C", "D"} {
+		replica := pbft.Replicas[id]
+		if replica.stalled != len(replica.Replicas) || !replica.changing {
+			t.Errorf("Expected %s to give up after %d view changes, got %d", id, len(replica.Replicas), replica.stalled)
+		}
+	}
+}
+
+// TestPBFTJoinsViewChange tests that f+1 view changes pull a replica into the later view
+func TestPBFTJoinsViewChange(t *testing.T) {
+	pbft := newPBFT(t)
+	b := pbft.Replicas["B"]
+	for _, id := range []string{"C", "D"} {
+		replica := pbft.Replicas[id]
+		replica.Lock.Lock()
+		replica.startViewChange(2)
+		replica.Lock.Unlock()
+		sends, _ := replica.drain()
+		if err := b.Deliver(id, sends[0].Msg); err != nil {
+			t.Fatal(err)
+		}
+		if joined := b.changing; joined != (id == "D") {
+			t.Errorf("Expected B to join only after f+1 view changes, joined=%t after %s", joined, id)
+		}
+	}
+	if b.View != 2 {
+		t.Errorf("Expected B to move to view 2, got %d", b.View)
+	}
+}
+
+// TestPBFTRejectsForgedNewView tests that a new view must come from its primary and carry signed view changes
+func TestPBFTRejectsForgedNewView(t *testing.T) {
+	pbft := newPBFT(t)
+	b, c := pbft.Replicas["B"], pbft.Replicas["C"]
+	changes := []ViewChange{
+		{View: 1, Replica: "A", Prepared: []PreparedCert{}},
+		{View: 1, Replica: "B", Prepared: []PreparedCert{}},
+		{View: 1, Replica: "D", Prepared: []PreparedCert{}},
+	}
+	nv, err := BuildNewView(1, "B", changes, pbft.F, b.keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, _ := json.Marshal(nv)
+	announce := &NewViewAnnouncement{View: 1, Leader: "B", Proof: proof, Signature: b.sign("new-view", 1, 0, PayloadDigest(proof))}
+	if err := c.Deliver("B", announce); !errors.Is(err, ErrConsensusSignature) {
+		t.Errorf("Expected unsigned view changes to be rejected, got %v", err)
+	}
+
+	relayed := *announce
+	relayed.Leader = "D"
+	if err := c.Deliver("D", &relayed); !errors.Is(err, ErrRejectedMessage) {
+		t.Errorf("Expected a new view from a non-primary to be rejected, got %v", err)
+	}
+	if c.View != 0 || c.changing {
+		t.Errorf("Expected C to stay in view 0, got view %d", c.View)
+	}
+}
+
+// routePBFT delivers the replicas' outgoing messages among the live ones
+// until none are left, dropping those drop matches
+func routePBFT(t *testing.T, pbft *PBFT, live []string, drop func(Message) bool) {
+	for {
+		quiet := true
+		for _, id := range live {
+			sends, _ := pbft.Replicas[id].drain()
+			for _, out := range sends {
+				quiet = false
+				if drop != nil && drop(out.Msg) {
+					continue
+				}
+				targets := live
+				if out.To != "" {
+					targets = []string{out.To}
+				}
+				for _, to := range targets {
+					if to == id || !slices.Contains(live, to) {
+						continue
+					}
+					if err := pbft.Replicas[to].Deliver(id, out.Msg); err != nil {
+						t.Errorf("Delivering %s from %s to %s: %v", phaseName(out.Msg), id, to, err)
+					}
+				}
+			}
+		}
+		if quiet {
+			return
+		}
+	}
+}
+
+// TestPBFTConsecutiveViewChangesKeepPreparedEntry tests that an entry
+// prepared but not committed survives two view changes in a row, so the
+// certificates prepared in the first new view hold up in the second
+func TestPBFTConsecutiveViewChangesKeepPreparedEntry(t *testing.T) {
+	pbft := newPBFT(t)
+	dropCommits := func(m Message) bool {
+		_, commit := m.(*Commit)
+		return commit
+	}
+	pbft.Replicas["A"].Request([]byte("op-1"))
+	routePBFT(t, pbft, []string{"A", "B", "C", "D"}, dropCommits)
+
+	// A is gone; B, C and D change views twice, committing op-1 only in the
+	// second new view
+	live := []string{"B", "C", "D"}
+	for view := int64(1); view <= 2; view++ {
+		drop := dropCommits
+		if view == 2 {
+			drop = nil
+		}
+		for _, id := range live {
+			replica := pbft.Replicas[id]
+			replica.Lock.Lock()
+			replica.startViewChange(view)
+			replica.Lock.Unlock()
+		}
+		routePBFT(t, pbft, live, drop)
+		for _, id := range live {
+			replica := pbft.Replicas[id]
+			if replica.View != view || replica.changing {
+				t.Fatalf("Expected %s to install view %d, got view %d changing=%t", id, view, replica.View, replica.changing)
+			}
+			certs := replica.PreparedCerts()
+			if len(certs) != 1 || certs[0].View != view || certs[0].Valid(pbft.F, replica.keys) != nil {
+				t.Fatalf("Expected %s to hold a valid view %d certificate for op-1, got %+v", id, view, certs)
+			}
+		}
+	}
+
+	for _, id := range live {
+		executed := pbft.Replicas[id].Executed
+		if len(executed) != 1 || executed[0].Seq != 1 || string(executed[0].Payload) != "op-1" {
+			t.Errorf("Expected %s to execute op-1 at seq 1, got %+v", id, executed)
+		}
+	}
+}
+
+// TestPBFTViewChangeKeepsChangeWithInvalidCertificate tests that a bad
+// certificate does not cost the view change its vote
+func TestPBFTViewChangeKeepsChangeWithInvalidCertificate(t *testing.T) {
+	pbft := newPBFT(t)
+	b, c := pbft.Replicas["B"], pbft.Replicas["C"]
+	// certFor signs with keys the replicas do not know
+	prepared, _ := json.Marshal([]PreparedCert{certFor(0, 1, "X", "A", "B", "C")})
+	change := &ViewChangeRequest{View: 1, Replica: "C", Prepared: prepared, Signature: c.sign("view-change", 1, 0, PayloadDigest(prepared))}
+	if err := b.Deliver("C", change); err != nil {
+		t.Fatalf("Expected the view change to be accepted, got %v", err)
+	}
+	if _, recorded := b.viewChanges[1]["C"]; !recorded {
+		t.Errorf("Expected B to count C's view change")
+	}
+}
+
+// TestPBFTRejectsNewViewWithSwappedPayload tests that a Byzantine primary
+// cannot keep a prepared digest but execute another payload under it
+func TestPBFTRejectsNewViewWithSwappedPayload(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.Replicas["A"].Request([]byte("op-1"))
+	routePBFT(t, pbft, nodeIDs(4), func(m Message) bool {
+		_, commit := m.(*Commit)
+		return commit
+	})
+
+	live := []string{"B", "C", "D"}
+	for _, id := range live {
+		replica := pbft.Replicas[id]
+		replica.Lock.Lock()
+		replica.startViewChange(1)
+		replica.Lock.Unlock()
+	}
+	var announce *NewViewAnnouncement
+	routePBFT(t, pbft, live, func(m Message) bool {
+		if nv, ok := m.(*NewViewAnnouncement); ok {
+			announce = nv
+			return true
+		}
+		return false
+	})
+	if announce == nil {
+		t.Fatal("Expected B to announce view 1")
+	}
+
+	// B swaps the payload behind op-1's digest and re-signs the proof
+	var nv NewView
+	if err := json.Unmarshal(announce.Proof, &nv); err != nil {
+		t.Fatal(err)
+	}
+	nv.Proposals[0].Payload = []byte("evil")
+	proof, _ := json.Marshal(nv)
+	b, c := pbft.Replicas["B"], pbft.Replicas["C"]
+	forged := &NewViewAnnouncement{View: 1, Leader: "B", Proof: proof, Signature: b.sign("new-view", 1, 0, PayloadDigest(proof))}
+	if err := c.Deliver("B", forged); !errors.Is(err, ErrRejectedMessage) {
+		t.Errorf("Expected a payload-swapped new view to be rejected, got %v", err)
+	}
+	if !c.changing {
+		t.Errorf("Expected C not to install the forged view")
+	}
+	if err := c.Deliver("B", announce); err != nil || c.changing {
+		t.Errorf("Expected C to install B's genuine new view, got %v", err)
+	}
+}
+
+// TestPBFTBoundsEarlyMessages tests that messages of later views are held
+// only when signed by their sender, for the next view and up to a limit
+func TestPBFTBoundsEarlyMessages(t *testing.T) {
+	pbft := newPBFT(t)
+	b, c, d := pbft.Replicas["B"], pbft.Replicas["C"], pbft.Replicas["D"]
+	prepare := func(signer *PBFTReplica, view int64, seq uint64, digest string) *Prepare {
+		return &Prepare{View: view, Seq: seq, Digest: digest, Replica: "C", Signature: signer.sign("prepare", view, seq, digest)}
+	}
+
+	if err := b.Deliver("C", prepare(d, 1, 1, "x")); !errors.Is(err, ErrConsensusSignature) {
+		t.Errorf("Expected a forged future prepare to be refused, got %v", err)
+	}
+	if err := b.Deliver("C", prepare(c, 5, 1, "x")); !errors.Is(err, ErrRejectedMessage) {
+		t.Errorf("Expected a prepare five views ahead to be refused, got %v", err)
+	}
+	limit := 2 * PBFTWindow
+	rejected := 0
+	for i := 0; i < limit+10; i++ {
+		seq := uint64(i%PBFTWindow + 1)
+		if err := b.Deliver("C", prepare(c, 1, seq, fmt.Sprintf("digest-%d", i))); err != nil {
+			rejected++
+		}
+	}
+	if len(b.early) != limit || rejected != 10 {
+		t.Errorf("Expected %d held prepares and 10 refused, got %d held and %d refused", limit, len(b.early), rejected)
+	}
+}
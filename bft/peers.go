@@ -0,0 +1,151 @@
+package bft
+
+import (
+	"fmt"
+	"time"
+)
+
+// Per-peer connection health.
+//
+// Every node tracks its connection to each peer it talks to: the smoothed
+// round-trip time, when it last heard from the peer, and how many messages
+// failed. A failed message drops the connection into backoff, and until the
+// retry time passes further messages fail fast without touching the
+// network; each failed reconnection doubles the delay up to Max. Any
+// message that gets through, in either direction, restores the connection.
+// The SWIM failure detector sends its probes over these connections, so a
+// peer in backoff fails its direct probe at once and goes straight to
+// indirect probing.
+//
+// The tracking runs on the simulated network; the deployment's transports
+// are not part of this tree (only their traces are, see replay.go).
+
+// ConnState is the state of a node's connection to a peer
+type ConnState int
+
+const (
+	ConnIdle      ConnState = iota // Never used
+	ConnConnected                  // Last message got through
+	ConnBackoff                    // Last message failed, waiting to reconnect
+)
+
+func (c ConnState) String() string {
+	switch c {
+	case ConnConnected:
+		return "connected"
+	case ConnBackoff:
+		return "backoff"
+	default:
+		return "idle"
+	}
+}
+
+// ReconnectPolicy is the backoff between reconnection attempts
+type ReconnectPolicy struct {
+	Initial time.Duration // Delay after the first failure
+	Max     time.Duration // Cap on the doubling delay
+}
+
+// DefaultReconnectPolicy returns the backoff used when a node sets none
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{Initial: 100 * time.Millisecond, Max: 10 * time.Second}
+}
+
+// delay returns the backoff after the given number of consecutive failures
+func (p ReconnectPolicy) delay(failures int) time.Duration {
+	delay := p.Initial
+	for i := 1; i < failures && delay < p.Max; i++ {
+		delay *= 2
+	}
+	if delay > p.Max {
+		delay = p.Max
+	}
+	return delay
+}
+
+// PeerHealth is a node's view of its connection to one peer. Times are
+// simulated time since the start of the run.
+type PeerHealth struct {
+	Peer              string
+	State             ConnState
+	RTT               time.Duration // Smoothed round-trip time
+	LastSeen          time.Duration // When a message from the peer last arrived
+	Errors            int           // Failed messages
+	ConsecutiveErrors int           // Failed messages since the last success
+	Reconnects        int           // Times the connection recovered from backoff
+	RetryAt           time.Duration // When a connection in backoff may be retried
+}
+
+func (h PeerHealth) String() string {
+	return fmt.Sprintf("%s: %s rtt=%v last_seen=%v errors=%d reconnects=%d",
+		h.Peer, h.State, h.RTT, h.LastSeen, h.Errors, h.Reconnects)
+}
+
+// PeerHealth returns the node's connections in peer order
+func (n *Node) PeerHealth() []PeerHealth {
+	n.Lock.RLock()
+	defer n.Lock.RUnlock()
+	health := make([]PeerHealth, 0, len(n.peers))
+	for _, peer := range sortedKeys(n.peers) {
+		health = append(health, *n.peers[peer])
+	}
+	return health
+}
+
+// peer returns the connection to peer, creating it idle. The caller must
+// hold n.Lock.
+func (n *Node) peer(peer string) *PeerHealth {
+	if n.peers == nil {
+		n.peers = make(map[string]*PeerHealth)
+	}
+	health, exists := n.peers[peer]
+	if !exists {
+		health = &PeerHealth{Peer: peer}
+		n.peers[peer] = health
+	}
+	return health
+}
+
+// dialable reports whether a message to peer may be sent at now, false
+// while the connection is backing off
+func (n *Node) dialable(peer string, now time.Duration) bool {
+	n.Lock.RLock()
+	defer n.Lock.RUnlock()
+	health, exists := n.peers[peer]
+	return !exists || health.State != ConnBackoff || now >= health.RetryAt
+}
+
+// peerSucceeded records a message exchanged with peer
+func (n *Node) peerSucceeded(peer string, rtt, now time.Duration) {
+	n.Lock.Lock()
+	defer n.Lock.Unlock()
+	health := n.peer(peer)
+	if health.State == ConnBackoff {
+		health.Reconnects++
+	}
+	if health.RTT == 0 {
+		health.RTT = rtt
+	} else {
+		// The TCP smoothing factor of 1/8
+		health.RTT += (rtt - health.RTT) / 8
+	}
+	health.State = ConnConnected
+	health.LastSeen = now
+	health.ConsecutiveErrors = 0
+	health.RetryAt = 0
+}
+
+// peerFailed records a message to peer that was lost and backs off
+func (n *Node) peerFailed(peer string, now time.Duration) {
+	n.Lock.Lock()
+	defer n.Lock.Unlock()
+	health := n.peer(peer)
+	health.Errors++
+	health.ConsecutiveErrors++
+	health.State = ConnBackoff
+	policy := n.Reconnect
+	if policy == (ReconnectPolicy{}) {
+		policy = DefaultReconnectPolicy()
+	}
+	health.RetryAt = now + policy.delay(health.ConsecutiveErrors)
+}
@@ -0,0 +1,94 @@
+package bft
+
+import (
+	"testing"
+	"time"
+)
+
+// TestReconnectBackoff tests that the reconnection delay doubles up to the cap
+func TestReconnectBackoff(t *testing.T) {
+	policy := ReconnectPolicy{Initial: 100 * time.Millisecond, Max: time.Second}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, delay := range expected {
+		if got := policy.delay(i + 1); got != delay {
+			t.Errorf("Expected a delay of %v after %d failures, got %v", delay, i+1, got)
+		}
+	}
+}
+
+// TestPeerHealthTracking tests that failures back off, fail fast until the
+// retry time, and that a success reconnects
+func TestPeerHealthTracking(t *testing.T) {
+	node, _ := NewNode("A", false, false)
+	node.peerSucceeded("B", 80*time.Millisecond, time.Second)
+	node.peerSucceeded("B", 160*time.Millisecond, 2*time.Second)
+	health := node.PeerHealth()
+	if len(health) != 1 || health[0].State != ConnConnected || health[0].RTT != 90*time.Millisecond || health[0].LastSeen != 2*time.Second {
+		t.Fatalf("Expected a connected peer with a smoothed RTT of 90ms, got %+v", health)
+	}
+
+	node.peerFailed("B", 3*time.Second)
+	node.peerFailed("B", 3*time.Second+100*time.Millisecond)
+	if node.dialable("B", 3*time.Second+250*time.Millisecond) {
+		t.Error("Expected messages to fail fast while backing off")
+	}
+	if !node.dialable("B", 3*time.Second+300*time.Millisecond) {
+		t.Error("Expected a reconnection attempt once the 200ms backoff passed")
+	}
+	if health := node.PeerHealth()[0]; health.State != ConnBackoff || health.Errors != 2 || health.ConsecutiveErrors != 2 {
+		t.Errorf("Expected a peer in backoff with 2 errors, got %+v", health)
+	}
+
+	node.peerSucceeded("B", 80*time.Millisecond, 4*time.Second)
+	if health := node.PeerHealth()[0]; health.State != ConnConnected || health.Reconnects != 1 || health.ConsecutiveErrors != 0 || health.Errors != 2 {
+		t.Errorf("Expected one reconnect keeping the error count, got %+v", health)
+	}
+}
+
+// TestPeerHealthSWIM tests that probes feed peer health and that a backed
+// off connection recovers after the partition heals
+func TestPeerHealthSWIM(t *testing.T) {
+	swim := newSWIMCluster(t, 5, 1)
+	for _, node := range swim.System.Nodes {
+		node.Region = "us-east"
+	}
+	swim.System.Nodes["E"].Region = "eu-west"
+	swim.System.SetRegionLatency("us-east", "eu-west", 40*time.Millisecond)
+	if runUntilAgreed(swim, 50) < 0 {
+		t.Fatal("Expected the views to agree")
+	}
+	for _, health := range swim.System.Nodes["E"].PeerHealth() {
+		if health.State != ConnConnected || health.RTT != 80*time.Millisecond {
+			t.Errorf("Expected E connected to %s with an 80ms RTT, got %+v", health.Peer, health)
+		}
+	}
+	swim.System.SetPartition("E", true)
+	for i := 0; i < 10; i++ {
+		swim.Tick()
+	}
+
+	var failures int
+	for _, id := range []string{"A", "B", "C", "D"} {
+		for _, health := range swim.System.Nodes[id].PeerHealth() {
+			if health.Peer == "E" {
+				failures += health.Errors
+				if health.Errors > 0 && health.State != ConnBackoff {
+					t.Errorf("Expected %s's connection to E to back off, got %+v", id, health)
+				}
+			}
+		}
+	}
+	if failures == 0 {
+		t.Fatal("Expected probes to E to fail")
+	}
+
+	swim.System.SetPartition("E", false)
+	for i := 0; i < 20; i++ {
+		swim.Tick()
+	}
+	for _, health := range swim.System.Nodes["E"].PeerHealth() {
+		if health.State != ConnConnected {
+			t.Errorf("Expected E to be reconnected to %s, got %+v", health.Peer, health)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package bft
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Browser playground.
+//
+// The playground runs the partition simulation without a file system or a
+// terminal, compiled to WebAssembly (see cmd/playground). A run takes a
+// seed and a scenario as JSON and returns, again as JSON, the report the
+// command line would print, the headline results and the scenario's
+// topology for drawing: every node with its region and faults, and every
+// link with whether it starts cut. Only one run may be in progress at a
+// time, since the report is captured by redirecting Output.
+
+// PlaygroundRequest is one run of the playground
+type PlaygroundRequest struct {
+	Seed     int64           `json:"seed"`
+	Scenario json.RawMessage `json:"scenario,omitempty"` // DefaultScenario if empty
+}
+
+// PlaygroundNode is a node of the drawn topology
+type PlaygroundNode struct {
+	ID        string `json:"id"`
+	Region    string `json:"region"`
+	Byzantine bool   `json:"byzantine,omitempty"`
+	Isolated  bool   `json:"isolated,omitempty"` // Isolated or partitioned from the start
+}
+
+// PlaygroundLink is a link of the drawn topology
+type PlaygroundLink struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	OneWay bool   `json:"one_way,omitempty"`
+	Cut    bool   `json:"cut,omitempty"`
+}
+
+// PlaygroundResult is what a playground run reports
+type PlaygroundResult struct {
+	Scenario string             `json:"scenario"`
+	Seed     int64              `json:"seed"`
+	Output   string             `json:"output"`
+	Results  map[string]float64 `json:"results"`
+	Nodes    []PlaygroundNode   `json:"nodes"`
+	Links    []PlaygroundLink   `json:"links"`
+}
+
+// RunPlayground runs the partition simulation for a playground request
+func RunPlayground(req PlaygroundRequest) (*PlaygroundResult, error) {
+	scenario := DefaultScenario()
+	if len(req.Scenario) > 0 {
+		var err error
+		if scenario, err = ParseScenario(req.Scenario); err != nil {
+			return nil, err
+		}
+	}
+
+	// Build a copy of the cluster to read the topology the run starts from
+	system := NewSystem()
+	if err := scenario.Build(system, req.Seed); err != nil {
+		return nil, err
+	}
+	geometry := AnalyzeQuorums(system, -1)
+	cut := make(map[Link]bool)
+	for _, link := range geometry.Cut {
+		cut[link] = true
+	}
+	result := &PlaygroundResult{Scenario: scenario.Name, Seed: req.Seed}
+	for _, spec := range scenario.Nodes {
+		result.Nodes = append(result.Nodes, PlaygroundNode{
+			ID:        spec.ID,
+			Region:    spec.Region,
+			Byzantine: spec.Byzantine,
+			Isolated:  system.Nodes[spec.ID].IsIsolated || system.IsPartitioned(spec.ID),
+		})
+	}
+	for _, link := range scenario.Links {
+		result.Links = append(result.Links, PlaygroundLink{
+			From:   link.From,
+			To:     link.To,
+			OneWay: link.OneWay,
+			Cut:    cut[NewLink(link.From, link.To)],
+		})
+	}
+
+	var report bytes.Buffer
+	saved := Output
+	Output = NewRenderer(&report, false)
+	defer func() { Output = saved }()
+	result.Results = SimulatePartition(req.Seed, scenario, nil, nil, nil, nil)
+	result.Output = report.String()
+	return result, nil
+}
+
+// PlaygroundJSON runs a JSON-encoded PlaygroundRequest and returns the
+// JSON-encoded PlaygroundResult
+func PlaygroundJSON(request string) (string, error) {
+	var req PlaygroundRequest
+	if err := json.Unmarshal([]byte(request), &req); err != nil {
+		return "", fmt.Errorf("playground request: %w", err)
+	}
+	result, err := RunPlayground(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,47 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestPlaygroundJSON tests that a playground run reports the topology, the results and the captured report
+func TestPlaygroundJSON(t *testing.T) {
+	saved := Output
+	reply, err := PlaygroundJSON(`{"seed": 3}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result PlaygroundResult
+	if err := json.Unmarshal([]byte(reply), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Scenario != "partition" || len(result.Nodes) != 7 || len(result.Links) != 8 {
+		t.Errorf("Expected the default scenario's 7 nodes and 8 links, got %s with %d and %d", result.Scenario, len(result.Nodes), len(result.Links))
+	}
+	cut := map[string]bool{}
+	for _, link := range result.Links {
+		cut[link.From+link.To] = link.Cut
+	}
+	if !cut["DE"] || cut["AB"] {
+		t.Errorf("Expected D-E to start cut and A-B up, got %v", cut)
+	}
+	if !strings.Contains(result.Output, "Simulating Network Partition") || result.Results["writes_committed"] == 0 {
+		t.Errorf("Expected the report and results of the run, got %d bytes and %v", len(result.Output), result.Results)
+	}
+	if Output != saved || strings.Contains(result.Output, "\033[") {
+		t.Errorf("Expected a plain report and Output restored")
+	}
+}
+
+// TestPlaygroundRejectsBadScenario tests that an invalid scenario fails before anything runs
+func TestPlaygroundRejectsBadScenario(t *testing.T) {
+	if _, err := PlaygroundJSON(`{"scenario": {"leader": "Z", "nodes": [{"id": "A"}]}}`); !errors.Is(err, ErrInvalidScenario) {
+		t.Errorf("Expected ErrInvalidScenario, got %v", err)
+	}
+	if _, err := PlaygroundJSON(`not json`); err == nil {
+		t.Errorf("Expected a malformed request to fail")
+	}
+}
@@ -0,0 +1,368 @@
+package bft
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Post-mortem reports for failed chaos runs.
+//
+// A chaos run fails when it violates a hard invariant or loses liveness,
+// meaning a soft expectation is still missed in its last round. The run then
+// writes up what happened: the timeline of injected and reverted faults with
+// the warnings leading up to the failure, the first round in which replica
+// states diverged, the traced messages of the nodes involved, and a ranked
+// list of suspected root causes. The causes come from heuristics over the
+// faults active at the failure: an unreachable leader, more faulty nodes
+// than f, a lost quorum, partitions, Byzantine nodes and crashes, and a
+// protocol bug when replicas diverged without a fault to explain it. They
+// say where to look first, not what went wrong.
+
+// PostMortemMessages caps the messages quoted in a post-mortem
+const PostMortemMessages = 20
+
+// PostMortemKind says how a run failed
+type PostMortemKind string
+
+const (
+	PostMortemViolation PostMortemKind = "invariant violation"
+	PostMortemLiveness  PostMortemKind = "liveness loss"
+)
+
+// TimelineEntry is one event of a failed run
+type TimelineEntry struct {
+	Round int
+	Event string
+}
+
+// Divergence is the first replica state the nodes disagreed on
+type Divergence struct {
+	Round    int
+	Key      string            // "clock/<node>" or "store/<key>"
+	Values   map[string]string // Value per node, empty where missing
+	Minority []string          // Nodes that do not hold the most common value
+}
+
+// SuspectedCause is a heuristic explanation of a failure
+type SuspectedCause struct {
+	Cause    string
+	Evidence string
+}
+
+// PostMortem documents a failed chaos run
+type PostMortem struct {
+	Kind       PostMortemKind
+	Round      int    // Round the failure began
+	Failure    string // The violation or the missed expectations
+	Schedule   Schedule
+	Timeline   []TimelineEntry
+	Divergence *Divergence // Nil if replica states never diverged
+	Messages   []TraceEvent
+	Causes     []SuspectedCause // Most likely first
+}
+
+// replicaState flattens a node's replicated state into comparable keys: the
+// timestamp it holds for every other node and its store entries
+func replicaState(node *Node) map[string]string {
+	node.Lock.RLock()
+	defer node.Lock.RUnlock()
+	state := make(map[string]string)
+	for id, ts := range node.VectorClock.Timestamps() {
+		if id != node.ID {
+			state["clock/"+id] = strconv.FormatInt(ts, 10)
+		}
+	}
+	for key, entry := range node.Store.Entries {
+		state["store/"+key] = fmt.Sprintf("%s@%d", entry.Value, entry.Index)
+	}
+	return state
+}
+
+// findDivergence returns the first state key, in sorted order, on which the
+// nodes disagree, or nil. A node's own clock entry is not compared.
+func findDivergence(system *System, round int) *Divergence {
+	system.Lock.RLock()
+	ids := sortedKeys(system.Nodes)
+	states := make(map[string]map[string]string, len(ids))
+	keys := make(map[string]bool)
+	for _, id := range ids {
+		states[id] = replicaState(system.Nodes[id])
+		for key := range states[id] {
+			keys[key] = true
+		}
+	}
+	system.Lock.RUnlock()
+
+	for _, key := range sortedKeys(keys) {
+		values := make(map[string]string)
+		counts := make(map[string]int)
+		for _, id := range ids {
+			if key == "clock/"+id {
+				continue
+			}
+			values[id] = states[id][key]
+			counts[values[id]]++
+		}
+		if len(counts) < 2 {
+			continue
+		}
+		var majority string
+		for _, value := range sortedKeys(counts) {
+			if counts[value] > counts[majority] {
+				majority = value
+			}
+		}
+		divergence := &Divergence{Round: round, Key: key, Values: values}
+		for _, id := range sortedKeys(values) {
+			if values[id] != majority {
+				divergence.Minority = append(divergence.Minority, id)
+			}
+		}
+		return divergence
+	}
+	return nil
+}
+
+// postMortemRecorder gathers what a post-mortem needs while a run progresses
+type postMortemRecorder struct {
+	roundStart []uint64 // Trace sequence number at the start of each round
+	divergence *Divergence
+}
+
+// startRound marks where the round's trace events begin
+func (p *postMortemRecorder) startRound(system *System) {
+	p.roundStart = append(p.roundStart, system.Trace.Recorded())
+}
+
+// endRound looks for the first divergence once the round is over
+func (p *postMortemRecorder) endRound(system *System, round int) {
+	if p.divergence == nil {
+		p.divergence = findDivergence(system, round)
+	}
+}
+
+// write builds the post-mortem of a failed run
+func (p *postMortemRecorder) write(system *System, schedule Schedule, report *ChaosReport, kind PostMortemKind, round int, failure string) *PostMortem {
+	pm := &PostMortem{
+		Kind:       kind,
+		Round:      round,
+		Failure:    failure,
+		Schedule:   schedule,
+		Divergence: p.divergence,
+	}
+
+	for _, step := range schedule {
+		if step.At <= report.Rounds-1 {
+			pm.Timeline = append(pm.Timeline, TimelineEntry{Round: step.At, Event: fmt.Sprintf("inject %s %v", step.Kind, step.Nodes)})
+		}
+		if revert := step.At + step.Duration; step.Duration > 0 && revert <= report.Rounds-1 {
+			pm.Timeline = append(pm.Timeline, TimelineEntry{Round: revert, Event: fmt.Sprintf("revert %s %v", step.Kind, step.Nodes)})
+		}
+	}
+	if pm.Divergence != nil {
+		pm.Timeline = append(pm.Timeline, TimelineEntry{Round: pm.Divergence.Round, Event: fmt.Sprintf("replicas %v diverge on %s", pm.Divergence.Minority, pm.Divergence.Key)})
+	}
+	for _, warning := range report.Warnings {
+		pm.Timeline = append(pm.Timeline, TimelineEntry{Round: warning.Round, Event: fmt.Sprintf("warning %s: %v", warning.Assertion, warning.Err)})
+	}
+	if kind == PostMortemViolation {
+		pm.Timeline = append(pm.Timeline, TimelineEntry{Round: round, Event: "violation " + failure})
+	}
+	sort.SliceStable(pm.Timeline, func(i, j int) bool { return pm.Timeline[i].Round < pm.Timeline[j].Round })
+
+	faulty := faultyNodes(system)
+	involved := make(map[string]bool)
+	from := round
+	if pm.Divergence != nil {
+		from = pm.Divergence.Round
+		for _, id := range pm.Divergence.Minority {
+			involved[id] = true
+		}
+	} else {
+		for id := range faulty {
+			involved[id] = true
+		}
+	}
+	if from < len(p.roundStart) {
+		for _, event := range system.Trace.Snapshot() {
+			if event.Seq < p.roundStart[from] || len(pm.Messages) == PostMortemMessages {
+				continue
+			}
+			if len(involved) == 0 || involved[event.Node] || involved[event.Peer] {
+				pm.Messages = append(pm.Messages, event)
+			}
+		}
+	}
+
+	pm.Causes = diagnose(system, schedule, round, faulty, pm.Divergence)
+	return pm
+}
+
+// faultyNodes returns the kind of fault each partitioned, Byzantine or
+// fenced node currently has
+func faultyNodes(system *System) map[string]FaultKind {
+	system.Lock.RLock()
+	defer system.Lock.RUnlock()
+	faulty := make(map[string]FaultKind)
+	for id, node := range system.Nodes {
+		switch {
+		case system.Fenced[id] != nil:
+			faulty[id] = FaultCrash
+		case node.IsIsolated || system.Partition[id]:
+			faulty[id] = FaultPartition
+		case node.IsByzantine:
+			faulty[id] = FaultByzantine
+		}
+	}
+	return faulty
+}
+
+// injectedBy lists the steps up to round that injected kind on any of nodes
+func injectedBy(schedule Schedule, round int, kind FaultKind, nodes []string) string {
+	var steps []string
+	for _, step := range schedule {
+		if step.At > round || step.Kind != kind {
+			continue
+		}
+		for _, id := range step.Nodes {
+			if slices.Contains(nodes, id) {
+				steps = append(steps, step.String())
+				break
+			}
+		}
+	}
+	if len(steps) == 0 {
+		return "not injected by the schedule"
+	}
+	return strings.Join(steps, ", ")
+}
+
+// diagnose ranks the suspected root causes of a failure
+func diagnose(system *System, schedule Schedule, round int, faulty map[string]FaultKind, divergence *Divergence) []SuspectedCause {
+	var causes []SuspectedCause
+	byKind := make(map[FaultKind][]string)
+	for _, id := range sortedKeys(faulty) {
+		byKind[faulty[id]] = append(byKind[faulty[id]], id)
+	}
+
+	leader := system.GetLeader()
+	if kind, down := faulty[leader]; down && kind != FaultByzantine {
+		causes = append(causes, SuspectedCause{
+			Cause:    fmt.Sprintf("leader %s is unreachable", leader),
+			Evidence: injectedBy(schedule, round, kind, []string{leader}),
+		})
+	}
+	health := system.QuorumHealth()
+	if len(faulty) > health.F {
+		causes = append(causes, SuspectedCause{
+			Cause:    fmt.Sprintf("%d faulty nodes exceed f=%d", len(faulty), health.F),
+			Evidence: fmt.Sprintf("faulty: %v", sortedKeys(faulty)),
+		})
+	}
+	if health.Lost() {
+		causes = append(causes, SuspectedCause{
+			Cause:    "quorum lost",
+			Evidence: fmt.Sprintf("%d of %d voters reachable, need %d", health.Reachable, len(health.Voters), health.Quorum),
+		})
+	}
+	for _, kind := range []FaultKind{FaultPartition, FaultByzantine, FaultCrash} {
+		if nodes := byKind[kind]; len(nodes) > 0 {
+			causes = append(causes, SuspectedCause{
+				Cause:    fmt.Sprintf("%s fault on %v", kind, nodes),
+				Evidence: injectedBy(schedule, round, kind, nodes),
+			})
+		}
+	}
+	if divergence != nil {
+		var unexplained []string
+		for _, id := range divergence.Minority {
+			if _, down := faulty[id]; !down {
+				unexplained = append(unexplained, id)
+			}
+		}
+		if len(unexplained) > 0 {
+			causes = append(causes, SuspectedCause{
+				Cause:    fmt.Sprintf("replicas %v diverged without an active fault, suspect a protocol bug", unexplained),
+				Evidence: fmt.Sprintf("first divergence on %s in round %d", divergence.Key, divergence.Round),
+			})
+		}
+	}
+	if len(causes) == 0 {
+		causes = append(causes, SuspectedCause{Cause: "no fault is active, suspect a protocol bug", Evidence: "the schedule leaves every node healthy"})
+	}
+	return causes
+}
+
+// formatEvent renders a traced message on one line
+func formatEvent(event TraceEvent) string {
+	s := fmt.Sprintf("#%d %s %s", event.Seq, event.Type, event.Node)
+	if event.Peer != "" {
+		s += " <-> " + event.Peer
+	}
+	if event.Update != nil {
+		s += fmt.Sprintf(" %s=%d", event.Update.NodeID, event.Update.Timestamp)
+	}
+	if event.Detail != "" {
+		s += " " + event.Detail
+	}
+	return s
+}
+
+// Markdown renders the post-mortem as a Markdown document
+func (pm *PostMortem) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Post-mortem: %s in round %d\n\n", pm.Kind, pm.Round)
+	fmt.Fprintf(&b, "**Failure:** %s\n\n", pm.Failure)
+	fmt.Fprintf(&b, "**Schedule:** %v\n\n", pm.Schedule)
+
+	b.WriteString("## Timeline\n\n| Round | Event |\n|---|---|\n")
+	for _, entry := range pm.Timeline {
+		fmt.Fprintf(&b, "| %d | %s |\n", entry.Round, entry.Event)
+	}
+
+	b.WriteString("\n## First divergence\n\n")
+	if d := pm.Divergence; d != nil {
+		fmt.Fprintf(&b, "Round %d, `%s`, minority %v:\n\n", d.Round, d.Key, d.Minority)
+		for _, id := range sortedKeys(d.Values) {
+			value := d.Values[id]
+			if value == "" {
+				value = "(missing)"
+			}
+			fmt.Fprintf(&b, "- %s: %s\n", id, value)
+		}
+	} else {
+		b.WriteString("Replica states never diverged.\n")
+	}
+
+	b.WriteString("\n## Involved messages\n\n")
+	if len(pm.Messages) == 0 {
+		b.WriteString("No traced messages.\n")
+	}
+	for _, event := range pm.Messages {
+		fmt.Fprintf(&b, "- %s\n", formatEvent(event))
+	}
+
+	b.WriteString("\n## Suspected root causes\n\n")
+	for i, cause := range pm.Causes {
+		fmt.Fprintf(&b, "%d. %s (%s)\n", i+1, cause.Cause, cause.Evidence)
+	}
+	return b.String()
+}
+
+// WriteFile writes the post-mortem into dir, named after the failure round
+// and the schedule, and returns its path
+func (pm *PostMortem) WriteFile(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprint(pm.Schedule)))
+	path := filepath.Join(dir, fmt.Sprintf("postmortem-round%d-%s.md", pm.Round, hex.EncodeToString(sum[:4])))
+	return path, os.WriteFile(path, []byte(pm.Markdown()), 0o644)
+}
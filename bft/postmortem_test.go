@@ -0,0 +1,170 @@
+package bft
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newLogicalChaosRun is newChaosRun with logical clocks, so divergence is
+// visible within a second
+func newLogicalChaosRun() *ChaosRun {
+	run := newChaosRun()
+	build := run.Build
+	run.Build = func() (*System, error) {
+		system, err := build()
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range system.Nodes {
+			var clock int64
+			node.Clock = func() int64 {
+				clock++
+				return clock
+			}
+		}
+		return system, nil
+	}
+	return run
+}
+
+// TestPostMortemViolation tests the post-mortem of an invariant violation
+func TestPostMortemViolation(t *testing.T) {
+	run := newLogicalChaosRun()
+	schedule := Schedule{
+		{At: 1, Kind: FaultByzantine, Nodes: []string{"E"}, Duration: 1},
+		{At: 3, Kind: FaultPartition, Nodes: []string{"A"}},
+	}
+	report, err := run.RunReport(schedule)
+	var violation *InvariantViolation
+	if !errors.As(err, &violation) {
+		t.Fatalf("Expected a violation, got %v", err)
+	}
+	pm := report.PostMortem
+	if pm == nil || pm.Kind != PostMortemViolation || pm.Round != 3 || !strings.Contains(pm.Failure, "leader A is partitioned") {
+		t.Fatalf("Expected a violation post-mortem for round 3, got %+v", pm)
+	}
+
+	events := make([]string, len(pm.Timeline))
+	for i, entry := range pm.Timeline {
+		events[i] = entry.Event
+	}
+	expected := []string{
+		"inject byzantine [E]",
+		"replicas [E] diverge on clock/A",
+		"revert byzantine [E]",
+		"inject partition [A]",
+		"violation invariant: leader A is partitioned",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected timeline %v, got %v", expected, events)
+	}
+
+	d := pm.Divergence
+	if d == nil || d.Round != 1 || !reflect.DeepEqual(d.Minority, []string{"E"}) || d.Values["E"] != "1" || d.Values["B"] != "2" {
+		t.Errorf("Expected E to fall behind on A's clock in round 1, got %+v", d)
+	}
+	if len(pm.Messages) == 0 || len(pm.Messages) > PostMortemMessages {
+		t.Fatalf("Expected up to %d involved messages, got %d", PostMortemMessages, len(pm.Messages))
+	}
+	for _, event := range pm.Messages {
+		if event.Node != "E" && event.Peer != "E" {
+			t.Errorf("Expected only messages involving E, got %+v", event)
+		}
+	}
+	if pm.Messages[0].Type != EventSend && pm.Messages[0].Type != EventReject {
+		t.Errorf("Expected the quoted messages to start with E's traffic, got %+v", pm.Messages[0])
+	}
+
+	if len(pm.Causes) == 0 || pm.Causes[0].Cause != "leader A is unreachable" || pm.Causes[0].Evidence != "@3 partition [A]" {
+		t.Errorf("Expected the unreachable leader to be the first suspect, got %+v", pm.Causes)
+	}
+}
+
+// TestPostMortemLivenessLoss tests that a run ending without a quorum gets a post-mortem
+func TestPostMortemLivenessLoss(t *testing.T) {
+	run := newLogicalChaosRun()
+	run.Invariant = nil
+	run.Assertions = []Assertion{Soft("quorum-available", QuorumAvailable)}
+
+	report, err := run.RunReport(Schedule{{At: 2, Kind: FaultPartition, Nodes: []string{"B", "C", "D"}, Duration: 2}})
+	if err != nil || report.PostMortem != nil {
+		t.Errorf("Expected a recovered run to need no post-mortem, got %v (%v)", report.PostMortem, err)
+	}
+
+	report, err = run.RunReport(Schedule{
+		{At: 1, Kind: FaultPartition, Nodes: []string{"B"}, Duration: 1},
+		{At: 3, Kind: FaultPartition, Nodes: []string{"B", "C", "D"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected liveness loss not to fail the run, got %v", err)
+	}
+	pm := report.PostMortem
+	if pm == nil || pm.Kind != PostMortemLiveness || pm.Round != 3 || !strings.HasPrefix(pm.Failure, "quorum-available:") {
+		t.Fatalf("Expected a liveness post-mortem since round 3, got %+v", pm)
+	}
+	causes := make([]string, len(pm.Causes))
+	for i, cause := range pm.Causes {
+		causes[i] = cause.Cause
+	}
+	expected := []string{"3 faulty nodes exceed f=1", "quorum lost", "partition fault on [B C D]"}
+	if !reflect.DeepEqual(causes, expected) {
+		t.Errorf("Expected causes %v, got %v", expected, causes)
+	}
+	if evidence := pm.Causes[2].Evidence; evidence != "@1 partition [B] for 1, @3 partition [B C D]" {
+		t.Errorf("Expected both partition steps as evidence, got %q", evidence)
+	}
+}
+
+// TestDiagnoseUnexplainedDivergence tests that divergence on healthy replicas points at the protocol
+func TestDiagnoseUnexplainedDivergence(t *testing.T) {
+	system, err := newChaosRun().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	causes := diagnose(system, nil, 2, faultyNodes(system), &Divergence{Round: 1, Key: "store/x", Minority: []string{"C"}})
+	if len(causes) != 1 || !strings.Contains(causes[0].Cause, "suspect a protocol bug") {
+		t.Errorf("Expected a protocol bug to be suspected, got %+v", causes)
+	}
+	causes = diagnose(system, nil, 2, faultyNodes(system), nil)
+	if len(causes) != 1 || causes[0].Cause != "no fault is active, suspect a protocol bug" {
+		t.Errorf("Expected the fallback cause, got %+v", causes)
+	}
+}
+
+// TestPostMortemWrittenToDir tests that failed runs write a Markdown post-mortem and shrinking does not
+func TestPostMortemWrittenToDir(t *testing.T) {
+	run := newLogicalChaosRun()
+	run.PostMortemDir = t.TempDir()
+	schedule := Schedule{{At: 3, Kind: FaultPartition, Nodes: []string{"A"}}}
+
+	report, err := run.RunReport(schedule)
+	if err == nil || report.PostMortemPath == "" {
+		t.Fatalf("Expected a violation with a written post-mortem, got %v", err)
+	}
+	data, err := os.ReadFile(report.PostMortemPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range []string{
+		"# Post-mortem: invariant violation in round 3",
+		"## Timeline",
+		"| 3 | inject partition [A] |",
+		"## First divergence",
+		"## Involved messages",
+		"## Suspected root causes\n\n1. leader A is unreachable (@3 partition [A])",
+	} {
+		if !strings.Contains(string(data), section) {
+			t.Errorf("Expected the document to contain %q:\n%s", section, data)
+		}
+	}
+
+	if _, err := run.Shrink(schedule); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(run.PostMortemDir); len(entries) != 1 {
+		t.Errorf("Expected shrinking to write no post-mortems, got %d files", len(entries))
+	}
+}
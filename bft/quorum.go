@@ -0,0 +1,418 @@
+package bft
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Quorum geometry analysis.
+//
+// The links of the topology are the Neighbors edges between nodes, or a full
+// mesh when no node lists neighbors. A link is up when neither end is
+// isolated, no partition severed it and neither direction is down; fenced
+// nodes cannot take part at all. Messages are relayed
+// along up links, so a quorum of 2f+1 nodes is formable when all of its
+// members lie in one connected component. Whether one is, and how many,
+// follows from the sizes of the components alone; there are far too many
+// quorums in a large cluster to list, so only a sample of the formable and
+// the blocked ones is kept. When no quorum is formable the
+// analyzer searches the down links for the smallest set whose restoration
+// joins enough live nodes into one component, which is what an operator
+// needs to fix first during an incident.
+
+// Link is an undirected link, with endpoints in sorted order
+type Link [2]string
+
+// NewLink returns the link between a and b
+func NewLink(a, b string) Link {
+	if b < a {
+		a, b = b, a
+	}
+	return Link{a, b}
+}
+
+func (l Link) String() string {
+	return l[0] + "-" + l[1]
+}
+
+// quorumSample is how many formable and how many blocked quorums an
+// analysis lists
+const quorumSample = 10
+
+// BlockedQuorum is a quorum that cannot currently form and why
+type BlockedQuorum struct {
+	Members []string
+	Reason  string
+}
+
+// QuorumGeometry describes which quorums a system can currently form
+type QuorumGeometry struct {
+	F          int
+	Size       int             // Quorum size 2f+1
+	Nodes      []string        // All nodes in sorted order
+	Fenced     []string        // Nodes that cannot take part
+	Links      []Link          // Configured links
+	Cut        []Link          // Configured links that are down
+	Components [][]string      // Connected components of live nodes
+	Formable   [][]string      // Sample of the formable quorums, see quorumSample
+	Blocked    []BlockedQuorum // Sample of the blocked quorums
+	// FormableCount and BlockedCount count all quorums, up to math.MaxInt
+	FormableCount int
+	BlockedCount  int
+	Restore       []Link // Fewest down links that re-enable a quorum, empty if one is formable
+	Restorable    bool   // Whether restoring links alone can re-enable a quorum
+}
+
+// AnalyzeQuorums inspects the system's topology for quorums of 2f+1 nodes.
+// A negative f uses the configured f, or else the largest f the cluster
+// tolerates.
+func AnalyzeQuorums(s *System, f int) *QuorumGeometry {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	g := &QuorumGeometry{F: f, Nodes: sortedKeys(s.Nodes)}
+	if g.F < 0 {
+		g.F = s.faultThreshold(len(g.Nodes))
+	}
+	g.Size = 2*g.F + 1
+
+	isolated := make(map[string]bool)
+	fenced := make(map[string]bool)
+	for _, id := range g.Nodes {
+		node := s.Nodes[id]
+		isolated[id] = node.IsIsolated || s.Partition[id]
+		if s.Fenced[id] != nil {
+			fenced[id] = true
+			g.Fenced = append(g.Fenced, id)
+		}
+	}
+
+	g.Links = configuredLinks(s, g.Nodes)
+	var up []Link
+	for _, link := range g.Links {
+		if isolated[link[0]] || isolated[link[1]] || s.Severed[link] || s.linkDown(link) {
+			g.Cut = append(g.Cut, link)
+		} else {
+			up = append(up, link)
+		}
+	}
+
+	components := newUnionFind(g.Nodes)
+	for _, link := range up {
+		components.union(link[0], link[1])
+	}
+	componentOf := make(map[string]string)
+	members := make(map[string][]string)
+	for _, id := range g.Nodes {
+		if fenced[id] {
+			continue
+		}
+		root := components.find(id)
+		componentOf[id] = root
+		members[root] = append(members[root], id)
+	}
+	for _, root := range sortedKeys(members) {
+		g.Components = append(g.Components, members[root])
+	}
+	sort.Slice(g.Components, func(i, j int) bool { return g.Components[i][0] < g.Components[j][0] })
+
+	formable := new(big.Int)
+	for _, component := range g.Components {
+		formable.Add(formable, new(big.Int).Binomial(int64(len(component)), int64(g.Size)))
+		if len(component) >= g.Size {
+			combinations(component, g.Size, func(quorum []string) bool {
+				g.Formable = append(g.Formable, append([]string(nil), quorum...))
+				return len(g.Formable) < quorumSample
+			})
+		}
+	}
+	if len(g.Formable) > quorumSample {
+		g.Formable = g.Formable[:quorumSample]
+	}
+	blocked := new(big.Int).Binomial(int64(len(g.Nodes)), int64(g.Size))
+	blocked.Sub(blocked, formable)
+	g.FormableCount, g.BlockedCount = saturatingInt(formable), saturatingInt(blocked)
+	g.Blocked = sampleBlocked(g, fenced, componentOf)
+
+	if g.FormableCount > 0 {
+		g.Restorable = true
+		return g
+	}
+	g.Restore, g.Restorable = restoreLinks(g, fenced, componentOf, members)
+	return g
+}
+
+// saturatingInt returns n as an int, or math.MaxInt if it does not fit
+func saturatingInt(n *big.Int) int {
+	if !n.IsInt64() || n.Int64() > math.MaxInt {
+		return math.MaxInt
+	}
+	return int(n.Int64())
+}
+
+// sampleBlocked returns up to quorumSample blocked quorums: those with a
+// fenced node first, then those with one member in a component and the
+// rest in others
+func sampleBlocked(g *QuorumGeometry, fenced map[string]bool, componentOf map[string]string) []BlockedQuorum {
+	var sample []BlockedQuorum
+	seen := make(map[string]bool)
+	add := func(members []string) bool {
+		quorum := append([]string(nil), members...)
+		sort.Strings(quorum)
+		if key := strings.Join(quorum, ","); !seen[key] {
+			seen[key] = true
+			var down []string
+			split := make(map[string]bool)
+			for _, id := range quorum {
+				if fenced[id] {
+					down = append(down, id)
+				} else {
+					split[componentOf[id]] = true
+				}
+			}
+			reason := fmt.Sprintf("split across %d components", len(split))
+			if len(down) > 0 {
+				reason = "fenced " + strings.Join(down, ",")
+			}
+			sample = append(sample, BlockedQuorum{quorum, reason})
+		}
+		return len(sample) < quorumSample
+	}
+	if g.Size > len(g.Nodes) {
+		return nil
+	}
+	for _, id := range g.Fenced {
+		var others []string
+		for _, other := range g.Nodes {
+			if other != id {
+				others = append(others, other)
+			}
+		}
+		more := true
+		combinations(others, g.Size-1, func(rest []string) bool {
+			more = add(append([]string{id}, rest...))
+			return more
+		})
+		if !more {
+			return sample
+		}
+	}
+	for _, component := range g.Components {
+		inside := make(map[string]bool)
+		for _, id := range component {
+			inside[id] = true
+		}
+		var outside []string
+		for _, id := range g.Nodes {
+			if !inside[id] && !fenced[id] {
+				outside = append(outside, id)
+			}
+		}
+		for _, id := range component {
+			if len(outside) < g.Size-1 {
+				break
+			}
+			more := true
+			combinations(outside, g.Size-1, func(rest []string) bool {
+				more = add(append([]string{id}, rest...))
+				return more
+			})
+			if !more {
+				return sample
+			}
+		}
+	}
+	return sample
+}
+
+// configuredLinks returns the Neighbors edges, or a full mesh if there are none.
+// The caller must hold s.Lock.
+func configuredLinks(s *System, ids []string) []Link {
+	seen := make(map[Link]bool)
+	var links []Link
+	for _, id := range ids {
+		for _, neighbor := range s.Nodes[id].Neighbors {
+			link := NewLink(id, neighbor)
+			if _, exists := s.Nodes[neighbor]; exists && neighbor != id && !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+	if len(links) == 0 {
+		for i, a := range ids {
+			for _, b := range ids[i+1:] {
+				links = append(links, NewLink(a, b))
+			}
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].String() < links[j].String() })
+	return links
+}
+
+// restoreLinks finds the fewest cut links that join a quorum of live nodes
+// into one component, trying candidate sets in increasing size
+func restoreLinks(g *QuorumGeometry, fenced map[string]bool, componentOf map[string]string, members map[string][]string) ([]Link, bool) {
+	var candidates []Link
+	for _, link := range g.Cut {
+		if fenced[link[0]] || fenced[link[1]] || componentOf[link[0]] == componentOf[link[1]] {
+			continue
+		}
+		candidates = append(candidates, link)
+	}
+	roots := sortedKeys(members)
+	for k := 1; k <= len(candidates) && k < len(roots); k++ {
+		var found []Link
+		combinations(candidates, k, func(links []Link) bool {
+			merged := newUnionFind(roots)
+			for _, link := range links {
+				merged.union(componentOf[link[0]], componentOf[link[1]])
+			}
+			sizes := make(map[string]int)
+			for _, root := range roots {
+				sizes[merged.find(root)] += len(members[root])
+				if sizes[merged.find(root)] >= g.Size {
+					found = append([]Link(nil), links...)
+					return false
+				}
+			}
+			return true
+		})
+		if found != nil {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+// String renders the analysis as a report
+func (g *QuorumGeometry) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Quorum size %d (n=%d, f=%d)\n", g.Size, len(g.Nodes), g.F)
+	for i, component := range g.Components {
+		fmt.Fprintf(&b, "Component %d: %s\n", i+1, strings.Join(component, ","))
+	}
+	if len(g.Fenced) > 0 {
+		fmt.Fprintf(&b, "Fenced: %s\n", strings.Join(g.Fenced, ","))
+	}
+	fmt.Fprintf(&b, "Formable quorums: %d of %d\n", g.FormableCount, g.FormableCount+g.BlockedCount)
+	for _, quorum := range g.Formable {
+		fmt.Fprintf(&b, "  %s\n", strings.Join(quorum, ","))
+	}
+	if more := g.FormableCount - len(g.Formable); more > 0 {
+		fmt.Fprintf(&b, "  and %d more\n", more)
+	}
+	switch {
+	case g.FormableCount > 0:
+		fmt.Fprintf(&b, "Progress possible\n")
+	case g.Restorable:
+		fmt.Fprintf(&b, "Restore links to re-enable progress: %s\n", joinLinks(g.Restore))
+	default:
+		fmt.Fprintf(&b, "No set of links re-enables progress\n")
+	}
+	return b.String()
+}
+
+// DOT renders the topology as a Graphviz graph: up links solid, cut links
+// dashed, links to restore bold, fenced nodes filled
+func (g *QuorumGeometry) DOT() string {
+	restore := make(map[Link]bool)
+	for _, link := range g.Restore {
+		restore[link] = true
+	}
+	cut := make(map[Link]bool)
+	for _, link := range g.Cut {
+		cut[link] = true
+	}
+	fenced := make(map[string]bool)
+	for _, id := range g.Fenced {
+		fenced[id] = true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "graph \"quorums\" {\n")
+	fmt.Fprintf(&b, "\tlabel=%q;\n", fmt.Sprintf("quorum size %d, %d formable", g.Size, g.FormableCount))
+	for _, id := range g.Nodes {
+		if fenced[id] {
+			fmt.Fprintf(&b, "\t%q [style=filled, fillcolor=gray];\n", id)
+		} else {
+			fmt.Fprintf(&b, "\t%q;\n", id)
+		}
+	}
+	for _, link := range g.Links {
+		switch {
+		case restore[link]:
+			fmt.Fprintf(&b, "\t%q -- %q [style=bold, color=green];\n", link[0], link[1])
+		case cut[link]:
+			fmt.Fprintf(&b, "\t%q -- %q [style=dashed, color=red];\n", link[0], link[1])
+		default:
+			fmt.Fprintf(&b, "\t%q -- %q;\n", link[0], link[1])
+		}
+	}
+	fmt.Fprintf(&b, "}\n")
+	return b.String()
+}
+
+// joinLinks formats links as a comma-separated list
+func joinLinks(links []Link) string {
+	names := make([]string, len(links))
+	for i, link := range links {
+		names[i] = link.String()
+	}
+	return strings.Join(names, ",")
+}
+
+// combinations calls fn with every k-element subset of items in order,
+// until fn returns false. The slice passed to fn is reused between calls.
+func combinations[T any](items []T, k int, fn func([]T) bool) {
+	subset := make([]T, 0, k)
+	var walk func(start int) bool
+	walk = func(start int) bool {
+		if len(subset) == k {
+			return fn(subset)
+		}
+		for i := start; i <= len(items)-(k-len(subset)); i++ {
+			subset = append(subset, items[i])
+			more := walk(i + 1)
+			subset = subset[:len(subset)-1]
+			if !more {
+				return false
+			}
+		}
+		return true
+	}
+	walk(0)
+}
+
+// unionFind tracks connected components over string keys
+type unionFind map[string]string
+
+func newUnionFind(keys []string) unionFind {
+	u := make(unionFind, len(keys))
+	for _, key := range keys {
+		u[key] = key
+	}
+	return u
+}
+
+func (u unionFind) find(key string) string {
+	for u[key] != key {
+		u[key] = u[u[key]]
+		key = u[key]
+	}
+	return key
+}
+
+func (u unionFind) union(a, b string) {
+	ra, rb := u.find(a), u.find(b)
+	if ra == rb {
+		return
+	}
+	if rb < ra {
+		ra, rb = rb, ra
+	}
+	u[rb] = ra
+}
@@ -0,0 +1,96 @@
+package bft
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// newQuorumSystem creates nodes A-G connected by the given neighbor lists
+func newQuorumSystem(t *testing.T, neighbors map[string][]string) *System {
+	return newTestSystem(t, nodeIDs(7), func(node *Node) { node.Neighbors = neighbors[node.ID] })
+}
+
+// TestQuorumsFormableInFullMesh tests that every quorum forms without faults
+func TestQuorumsFormableInFullMesh(t *testing.T) {
+	geometry := AnalyzeQuorums(newQuorumSystem(t, nil), -1)
+	if geometry.F != 2 || geometry.Size != 5 {
+		t.Errorf("Expected f=2 and quorum size 5, got %d and %d", geometry.F, geometry.Size)
+	}
+	if geometry.FormableCount != 21 || geometry.BlockedCount != 0 || len(geometry.Blocked) != 0 || len(geometry.Restore) != 0 {
+		t.Errorf("Expected all 21 quorums formable, got %d formable and %d blocked", geometry.FormableCount, geometry.BlockedCount)
+	}
+	if len(geometry.Formable) != quorumSample || !strings.Contains(geometry.String(), "and 11 more") {
+		t.Errorf("Expected a sample of %d formable quorums, got %d:\n%s", quorumSample, len(geometry.Formable), geometry)
+	}
+}
+
+// TestQuorumsLargeCluster tests that a cluster with millions of quorums is
+// analyzed from its components without listing them
+func TestQuorumsLargeCluster(t *testing.T) {
+	ids := make([]string, 28)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("N%02d", i)
+	}
+	system := newTestSystem(t, ids)
+	for i := 0; i < 9; i++ {
+		system.SetPartition(fmt.Sprintf("N%02d", i), true)
+	}
+
+	geometry := AnalyzeQuorums(system, -1)
+	// C(28, 19) quorums, of which the C(19, 19) among the 19 connected nodes form
+	if geometry.Size != 19 || geometry.FormableCount != 1 || geometry.BlockedCount != 6906899 {
+		t.Errorf("Expected 1 of 6906900 quorums of 19 formable, got %d and %d of %d", geometry.FormableCount, geometry.BlockedCount, geometry.Size)
+	}
+	if len(geometry.Formable) != 1 || len(geometry.Blocked) != quorumSample {
+		t.Errorf("Expected the formable quorum and a sample of blocked ones, got %d and %d", len(geometry.Formable), len(geometry.Blocked))
+	}
+	for _, quorum := range geometry.Blocked {
+		if len(quorum.Members) != geometry.Size || !strings.HasPrefix(quorum.Reason, "split across") {
+			t.Errorf("Expected a split quorum of %d, got %+v", geometry.Size, quorum)
+		}
+	}
+}
+
+// TestQuorumRestoreMinimalLinks tests that the fewest links joining a quorum are suggested
+func TestQuorumRestoreMinimalLinks(t *testing.T) {
+	system := newQuorumSystem(t, map[string][]string{
+		"A": {"B", "C", "D"},
+		"B": {"C", "D"},
+		"C": {"D"},
+		"D": {"E"},
+		"F": {"G"},
+	})
+	system.SetPartition("D", true)
+	system.SetPartition("E", true)
+
+	geometry := AnalyzeQuorums(system, 2)
+	if len(geometry.Components) != 4 {
+		t.Errorf("Expected 4 components, got %v", geometry.Components)
+	}
+	if len(geometry.Formable) != 0 {
+		t.Errorf("Expected no formable quorum, got %v", geometry.Formable)
+	}
+	if !geometry.Restorable || joinLinks(geometry.Restore) != "A-D,D-E" {
+		t.Errorf("Expected to restore A-D and D-E, got %v", geometry.Restore)
+	}
+	if !strings.Contains(geometry.DOT(), `"A" -- "D" [style=bold, color=green]`) {
+		t.Errorf("Expected the DOT graph to highlight links to restore:\n%s", geometry.DOT())
+	}
+}
+
+// TestQuorumBlockedByFencedNodes tests that fenced nodes block quorums links cannot fix
+func TestQuorumBlockedByFencedNodes(t *testing.T) {
+	system := newQuorumSystem(t, nil)
+	for _, id := range []string{"E", "F", "G"} {
+		system.fence(&NodeFailure{Node: id, Handler: "test"})
+	}
+
+	geometry := AnalyzeQuorums(system, 2)
+	if len(geometry.Formable) != 0 || geometry.Restorable {
+		t.Errorf("Expected no quorum with three fenced nodes, got %v", geometry.Formable)
+	}
+	if !strings.Contains(geometry.String(), "No set of links re-enables progress") {
+		t.Errorf("Expected the report to say links cannot help:\n%s", geometry)
+	}
+}
@@ -0,0 +1,734 @@
+package bft
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Raft consensus.
+//
+// Raft orders the same client payloads as PBFT, over the same simulated
+// network, so a scenario can be run under both and their outcomes compared.
+// Every voter runs a RaftNode. The voters start in term 1 with the first of
+// them in ID order as leader, the way PBFT starts in view 0. The leader
+// appends a payload to its log and sends every follower the entries it is
+// missing in an APPEND-ENTRIES; a follower whose log holds the entry before
+// them appends them, dropping any conflicting suffix, and acknowledges its
+// match index. An entry of the leader's term is committed once a majority
+// holds it, and nodes apply committed entries in log order.
+//
+// Clients send requests to every node, like PBFT's. A follower holding a
+// request starts an election timer, randomized to keep candidates apart; if
+// it expires before the node applied anything new, the follower becomes a
+// candidate for the next term and asks for votes. Nodes grant one vote per
+// term, to candidates whose log is at least as up to date as their own, and
+// a candidate with a majority becomes leader and appends a null entry to
+// commit what earlier terms left behind. Timeouts double while nothing gets
+// applied, and nodes give up after as many tries as there are voters, so a
+// minority ends its run instead of retrying forever.
+//
+// Raft tolerates crashes, not lies: messages are not signed and a node takes
+// its leader's word. A Byzantine leader sends every other follower forged
+// payloads, and a Byzantine follower grants every vote and acknowledges
+// entries it could not store. Conflicts lists where nodes applied different
+// payloads at the same index as a result.
+
+// Default Raft timeouts
+const (
+	DefaultElectionTimeout = time.Second            // Up to twice as long once randomized
+	DefaultRaftHeartbeat   = 300 * time.Millisecond // Between retransmissions of missing entries
+)
+
+// RaftRole is what a Raft node does in its term
+type RaftRole string
+
+const (
+	RaftFollower  RaftRole = "follower"
+	RaftCandidate RaftRole = "candidate"
+	RaftLeader    RaftRole = "leader"
+)
+
+// RequestVote is a candidate's request for votes
+type RequestVote struct {
+	Term      int64
+	Candidate string
+	LastIndex uint64 // Of the candidate's log
+	LastTerm  int64  // Of the last entry of the candidate's log
+}
+
+// VoteReply grants or refuses a vote
+type VoteReply struct {
+	Term    int64
+	Voter   string
+	Granted bool
+}
+
+// AppendEntries carries a leader's entries following PrevIndex
+type AppendEntries struct {
+	Term      int64
+	Leader    string
+	PrevIndex uint64
+	PrevTerm  int64
+	Entries   []byte // JSON-encoded RaftEntry list
+	Commit    uint64 // Leader's commit index
+}
+
+// AppendReply acknowledges an APPEND-ENTRIES. A follower that had to refuse
+// the entries reports its commit index as Match, which its log shares with
+// the leader's.
+type AppendReply struct {
+	Term     int64
+	Follower string
+	Success  bool
+	Match    uint64 // Highest index known to match the leader's log
+}
+
+// RaftEntry is an entry of a Raft log
+type RaftEntry struct {
+	Term    int64  `json:"term"`
+	Payload []byte `json:"payload"` // Nil for a new leader's null entry
+}
+
+// RaftApplication is an entry a node applied
+type RaftApplication struct {
+	Index   uint64
+	Term    int64
+	Digest  string
+	Payload []byte
+}
+
+// raftTimer is a node's election or heartbeat timer
+type raftTimer struct {
+	Heartbeat bool   // Retransmits the leader's entries, else starts an election
+	Term      int64  // Term the node was in
+	Progress  uint64 // LastApplied, or the leader's CommitIndex, when it started
+	Stalled   int    // Timeouts since the last progress, doubles elections
+	id        uint64 // Tells the running timer from those it replaced
+}
+
+// RaftNode is one voter's Raft state
+type RaftNode struct {
+	Node        *Node
+	Term        int64
+	VotedFor    string
+	Role        RaftRole
+	Leader      string      // Leader of Term, if known
+	Log         []RaftEntry // The entry at index i is Log[i-1]
+	CommitIndex uint64
+	LastApplied uint64
+	Applied     []RaftApplication
+	Peers       []string // Voters in ID order, the node included
+	// Execute applies a committed payload, in log order, when set
+	Execute    func(index uint64, payload []byte)
+	Lock       sync.Mutex
+	votes      map[string]bool
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	outbox     []consensusSend
+	timers     []raftTimer
+	pending    [][]byte        // Requests not yet applied, in arrival order
+	done       map[string]bool // Digests of applied requests
+	armed      bool            // A timer is running
+	timer      uint64          // ID of the running timer
+}
+
+// NewRaftNode creates the node for node among the given voters, in term 1
+// under leader
+func NewRaftNode(node *Node, voters []*Node, leader string) *RaftNode {
+	r := &RaftNode{
+		Node:       node,
+		Term:       1,
+		Role:       RaftFollower,
+		Leader:     leader,
+		votes:      make(map[string]bool),
+		nextIndex:  make(map[string]uint64),
+		matchIndex: make(map[string]uint64),
+		done:       make(map[string]bool),
+	}
+	for _, voter := range voters {
+		r.Peers = append(r.Peers, voter.ID)
+		r.nextIndex[voter.ID] = 1
+	}
+	sort.Strings(r.Peers)
+	if leader == node.ID {
+		r.Role = RaftLeader
+	}
+	return r
+}
+
+func (r *RaftNode) node() *Node     { return r.Node }
+func (r *RaftNode) group() []string { return r.Peers }
+
+// quorum is the majority of the voters
+func (r *RaftNode) quorum() int {
+	return len(r.Peers)/2 + 1
+}
+
+// lastIndex is the index of the last entry of the node's log
+func (r *RaftNode) lastIndex() uint64 {
+	return uint64(len(r.Log))
+}
+
+// termAt returns the term of the entry at index, 0 before the first one
+func (r *RaftNode) termAt(index uint64) int64 {
+	if index == 0 || index > r.lastIndex() {
+		return 0
+	}
+	return r.Log[index-1].Term
+}
+
+// Request records a client request. The leader appends it; any other node
+// starts its election timer, which replaces the leader if the request is
+// not applied in time.
+func (r *RaftNode) Request(payload []byte) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	digest := PayloadDigest(payload)
+	if r.done[digest] {
+		return
+	}
+	for _, request := range r.pending {
+		if PayloadDigest(request) == digest {
+			return
+		}
+	}
+	r.pending = append(r.pending, payload)
+	if r.Role == RaftLeader {
+		r.appendRequest(payload)
+		return
+	}
+	r.arm(false)
+}
+
+// appendRequest adds payload to the leader's log and sends it to the followers
+func (r *RaftNode) appendRequest(payload []byte) {
+	r.Log = append(r.Log, RaftEntry{Term: r.Term, Payload: payload})
+	r.matchIndex[r.Node.ID] = r.lastIndex()
+	r.replicate(false)
+	r.arm(true)
+}
+
+// replicate sends every follower the entries it is missing, or only those
+// followers that lag behind the leader's log if lagging is set
+func (r *RaftNode) replicate(lagging bool) {
+	for _, peer := range r.Peers {
+		if peer == r.Node.ID || lagging && r.matchIndex[peer] >= r.lastIndex() {
+			continue
+		}
+		r.outbox = append(r.outbox, consensusSend{To: peer, Msg: r.appendFor(peer)})
+	}
+}
+
+// appendFor builds the APPEND-ENTRIES for a follower, with forged payloads
+// for every other follower if the leader is Byzantine
+func (r *RaftNode) appendFor(peer string) *AppendEntries {
+	prev := min(r.nextIndex[peer]-1, r.lastIndex())
+	entries := slices.Clone(r.Log[prev:])
+	if r.Node.IsByzantine && slices.Index(r.Peers, peer)%2 == 0 {
+		for i, entry := range entries {
+			if entry.Payload != nil {
+				entries[i].Payload = append([]byte("forged:"), entry.Payload...)
+			}
+		}
+	}
+	data, _ := json.Marshal(entries) // Entries always encode
+	return &AppendEntries{Term: r.Term, Leader: r.Node.ID, PrevIndex: prev, PrevTerm: r.termAt(prev), Entries: data, Commit: r.CommitIndex}
+}
+
+// arm starts the node's election timer, or its heartbeat timer, unless one
+// is running
+func (r *RaftNode) arm(heartbeat bool) {
+	if r.armed {
+		return
+	}
+	progress := r.LastApplied
+	if heartbeat {
+		progress = r.CommitIndex
+	}
+	r.start(raftTimer{Heartbeat: heartbeat, Term: r.Term, Progress: progress})
+}
+
+// start starts timer in place of the running one
+func (r *RaftNode) start(timer raftTimer) {
+	r.timer++
+	timer.id = r.timer
+	r.armed = true
+	r.timers = append(r.timers, timer)
+}
+
+// Timeout handles an expired timer: a follower or candidate that applied
+// nothing since it started stands for the next term, a leader sends the
+// entries its followers are still missing
+func (r *RaftNode) Timeout(timer raftTimer) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	if !r.armed || timer.id != r.timer {
+		return
+	}
+	r.armed = false
+	if timer.Heartbeat {
+		if r.Role != RaftLeader || r.Term != timer.Term || r.CommitIndex == r.lastIndex() {
+			return
+		}
+		stalled := timer.Stalled + 1
+		if r.CommitIndex > timer.Progress {
+			stalled = 0
+		}
+		if stalled > len(r.Peers) {
+			return
+		}
+		r.replicate(true)
+		r.start(raftTimer{Heartbeat: true, Term: r.Term, Progress: r.CommitIndex, Stalled: stalled})
+		return
+	}
+	if r.Role == RaftLeader || len(r.pending) == 0 {
+		return
+	}
+	stalled := timer.Stalled + 1
+	if r.LastApplied > timer.Progress {
+		stalled = 0
+	} else if stalled > len(r.Peers) {
+		return
+	} else {
+		r.campaign()
+	}
+	r.start(raftTimer{Term: r.Term, Progress: r.LastApplied, Stalled: stalled})
+}
+
+// campaign makes the node a candidate for the next term
+func (r *RaftNode) campaign() {
+	r.Term++
+	r.Role, r.Leader, r.VotedFor = RaftCandidate, "", r.Node.ID
+	r.votes = map[string]bool{r.Node.ID: true}
+	r.outbox = append(r.outbox, consensusSend{Msg: &RequestVote{Term: r.Term, Candidate: r.Node.ID, LastIndex: r.lastIndex(), LastTerm: r.termAt(r.lastIndex())}})
+}
+
+// Deliver handles a Raft message from another node
+func (r *RaftNode) Deliver(from string, m Message) error {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+
+	var term int64
+	var sender string
+	switch m := m.(type) {
+	case *RequestVote:
+		term, sender = m.Term, m.Candidate
+	case *VoteReply:
+		term, sender = m.Term, m.Voter
+	case *AppendEntries:
+		term, sender = m.Term, m.Leader
+	case *AppendReply:
+		term, sender = m.Term, m.Follower
+	default:
+		return fmt.Errorf("%w: %v", ErrUnknownMessage, m.MessageType())
+	}
+	if sender != from || !slices.Contains(r.Peers, from) {
+		return fmt.Errorf("%w: %s from %s", ErrRejectedMessage, raftName(m), from)
+	}
+	if term > r.Term {
+		r.Term, r.Role, r.Leader, r.VotedFor = term, RaftFollower, "", ""
+	}
+
+	switch m := m.(type) {
+	case *RequestVote:
+		r.handleRequestVote(m)
+	case *VoteReply:
+		r.handleVoteReply(m)
+	case *AppendEntries:
+		return r.handleAppendEntries(m)
+	case *AppendReply:
+		r.handleAppendReply(m)
+	}
+	return nil
+}
+
+func (r *RaftNode) handleRequestVote(m *RequestVote) {
+	upToDate := m.LastTerm > r.termAt(r.lastIndex()) || m.LastTerm == r.termAt(r.lastIndex()) && m.LastIndex >= r.lastIndex()
+	granted := m.Term == r.Term && (r.VotedFor == "" || r.VotedFor == m.Candidate) && upToDate
+	if r.Node.IsByzantine {
+		granted = m.Term == r.Term
+	}
+	if granted {
+		r.VotedFor = m.Candidate
+	}
+	r.outbox = append(r.outbox, consensusSend{To: m.Candidate, Msg: &VoteReply{Term: r.Term, Voter: r.Node.ID, Granted: granted}})
+}
+
+func (r *RaftNode) handleVoteReply(m *VoteReply) {
+	if r.Role != RaftCandidate || m.Term != r.Term || !m.Granted {
+		return
+	}
+	r.votes[m.Voter] = true
+	if len(r.votes) < r.quorum() {
+		return
+	}
+	r.Role, r.Leader = RaftLeader, r.Node.ID
+	for _, peer := range r.Peers {
+		r.nextIndex[peer], r.matchIndex[peer] = r.lastIndex()+1, 0
+	}
+	// The null entry commits the entries of earlier terms along with it
+	r.Log = append(r.Log, RaftEntry{Term: r.Term})
+	logged := make(map[string]bool)
+	for _, entry := range r.Log {
+		if entry.Payload != nil {
+			logged[PayloadDigest(entry.Payload)] = true
+		}
+	}
+	for _, request := range r.pending {
+		if !logged[PayloadDigest(request)] {
+			r.Log = append(r.Log, RaftEntry{Term: r.Term, Payload: request})
+		}
+	}
+	r.matchIndex[r.Node.ID] = r.lastIndex()
+	r.armed = false
+	r.replicate(false)
+	r.arm(true)
+}
+
+func (r *RaftNode) handleAppendEntries(m *AppendEntries) error {
+	if r.Role == RaftLeader && m.Term == r.Term {
+		// Only double votes elect two leaders, which ignore each other
+		return fmt.Errorf("%w: %s and %s both lead term %d", ErrRejectedMessage, r.Node.ID, m.Leader, m.Term)
+	}
+	reply := &AppendReply{Term: r.Term, Follower: r.Node.ID, Match: r.CommitIndex}
+	defer func() { r.outbox = append(r.outbox, consensusSend{To: m.Leader, Msg: reply}) }()
+	if m.Term < r.Term {
+		return nil
+	}
+	r.Role, r.Leader = RaftFollower, m.Leader
+	var entries []RaftEntry
+	if err := json.Unmarshal(m.Entries, &entries); err != nil {
+		return fmt.Errorf("%w: entries from %s: %v", ErrRejectedMessage, m.Leader, err)
+	}
+	if m.PrevIndex > r.lastIndex() || r.termAt(m.PrevIndex) != m.PrevTerm {
+		if r.Node.IsByzantine {
+			// Acknowledge entries that could not be stored
+			reply.Success, reply.Match = true, m.PrevIndex+uint64(len(entries))
+		}
+		return nil
+	}
+	for i, entry := range entries {
+		index := m.PrevIndex + uint64(i) + 1
+		if index <= r.lastIndex() && r.termAt(index) != entry.Term {
+			r.Log = r.Log[:index-1]
+		}
+		if index > r.lastIndex() {
+			r.Log = append(r.Log, entry)
+		}
+	}
+	reply.Success, reply.Match = true, m.PrevIndex+uint64(len(entries))
+	if commit := min(m.Commit, reply.Match); commit > r.CommitIndex {
+		r.CommitIndex = commit
+		r.apply()
+	}
+	return nil
+}
+
+func (r *RaftNode) handleAppendReply(m *AppendReply) {
+	if r.Role != RaftLeader || m.Term != r.Term {
+		return
+	}
+	if !m.Success {
+		r.nextIndex[m.Follower] = m.Match + 1
+		r.outbox = append(r.outbox, consensusSend{To: m.Follower, Msg: r.appendFor(m.Follower)})
+		return
+	}
+	if m.Match > r.matchIndex[m.Follower] {
+		r.matchIndex[m.Follower] = m.Match
+	}
+	r.nextIndex[m.Follower] = r.matchIndex[m.Follower] + 1
+	for index := r.lastIndex(); index > r.CommitIndex; index-- {
+		if r.termAt(index) != r.Term {
+			break
+		}
+		count := 0
+		for _, match := range r.matchIndex {
+			if match >= index {
+				count++
+			}
+		}
+		if count >= r.quorum() {
+			r.CommitIndex = index
+			r.apply()
+			// Tell the followers what committed
+			for _, peer := range r.Peers {
+				if peer != r.Node.ID {
+					r.outbox = append(r.outbox, consensusSend{To: peer, Msg: r.appendFor(peer)})
+				}
+			}
+			return
+		}
+	}
+}
+
+// apply applies the committed entries the node has not applied yet
+func (r *RaftNode) apply() {
+	for r.LastApplied < r.CommitIndex {
+		r.LastApplied++
+		entry := r.Log[r.LastApplied-1]
+		if entry.Payload == nil {
+			continue
+		}
+		digest := PayloadDigest(entry.Payload)
+		if r.done[digest] {
+			continue
+		}
+		r.done[digest] = true
+		r.pending = slices.DeleteFunc(r.pending, func(request []byte) bool { return PayloadDigest(request) == digest })
+		r.Applied = append(r.Applied, RaftApplication{Index: r.LastApplied, Term: entry.Term, Digest: digest, Payload: entry.Payload})
+		if r.Execute != nil {
+			r.Execute(r.LastApplied, entry.Payload)
+		}
+	}
+}
+
+// drain returns and clears the messages waiting to be sent and the timers
+// waiting to be started
+func (r *RaftNode) drain() ([]consensusSend, []raftTimer) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	sends, timers := r.outbox, r.timers
+	r.outbox, r.timers = nil, nil
+	return sends, timers
+}
+
+// RaftStats counts the Raft traffic of a run
+type RaftStats struct {
+	MessageStats
+	Elections int // Leaders elected after the first
+}
+
+// RaftOutcome is what happened to a submitted payload
+type RaftOutcome struct {
+	Index   uint64 // Where the entry was first applied, 0 if nowhere yet
+	Term    int64  // Term of the entry
+	Digest  string
+	Applied []string // Nodes that applied the entry, in ID order
+	// Committed is set once a node applied the entry: nodes only apply
+	// committed entries, and a Raft client takes the leader's reply
+	Committed bool
+	Latency   time.Duration // From submission until the first application
+}
+
+// raftRequest tracks a submitted payload
+type raftRequest struct {
+	submitted time.Duration
+	index     uint64
+	term      int64
+	applied   map[string]time.Duration
+}
+
+// Raft runs a Raft node on every voter of a system, with a driver carrying
+// their messages over its simulated network. It leaves the system's leader
+// alone.
+type Raft struct {
+	driver[*RaftNode, raftTimer]
+	Nodes  map[string]*RaftNode
+	Term   int64  // Latest term a leader was elected in
+	Leader string // Elected in Term
+	// ElectionTimeout is the least a follower waits for a request to be
+	// applied before it stands for election, DefaultElectionTimeout if zero
+	ElectionTimeout time.Duration
+	// Heartbeat is how often a leader sends entries its followers are
+	// missing, DefaultRaftHeartbeat if zero
+	Heartbeat time.Duration
+	// OnElection is called when a leader is elected for a later term
+	OnElection func(term int64, leader string)
+	Stats      RaftStats
+	requests   map[string]*raftRequest
+}
+
+// NewRaft creates nodes for the system's voters, all in term 1 under the
+// first voter in ID order
+func NewRaft(system *System) (*Raft, error) {
+	system.Lock.RLock()
+	voters := system.voters()
+	system.Lock.RUnlock()
+	if len(voters) == 0 {
+		return nil, fmt.Errorf("%w: no voters", ErrTooFewReplicas)
+	}
+	r := &Raft{
+		Nodes:    make(map[string]*RaftNode),
+		Term:     1,
+		requests: make(map[string]*raftRequest),
+	}
+	r.driver = newDriver[*RaftNode, raftTimer](system, "raft", r.Nodes, &r.Stats.MessageStats)
+	r.kind = raftName
+	r.timer = func(node *RaftNode, timer raftTimer) (time.Duration, string) {
+		if timer.Heartbeat {
+			return r.timeout(timer), fmt.Sprintf("heartbeat of %s in term %d", node.Node.ID, timer.Term)
+		}
+		return r.timeout(timer), fmt.Sprintf("election timer of %s in term %d", node.Node.ID, timer.Term)
+	}
+	r.settle = func(node *RaftNode) {
+		r.elected(node)
+		r.applied(node)
+	}
+	r.outstanding = func() bool {
+		for digest := range r.requests {
+			if !r.Outcome(digest).Committed {
+				return true
+			}
+		}
+		return false
+	}
+	r.status = func(node *RaftNode) string {
+		node.Lock.Lock()
+		defer node.Lock.Unlock()
+		return fmt.Sprintf("Raft node %s: %s of term %d, %d entries, committed up to %d, %d requests pending",
+			node.Node.ID, node.Role, node.Term, len(node.Log), node.CommitIndex, len(node.pending))
+	}
+	r.Leader = voters[0].ID
+	for _, voter := range voters {
+		r.Nodes[voter.ID] = NewRaftNode(voter, voters, r.Leader)
+	}
+	return r, nil
+}
+
+// Submit sends payload to every reachable node for ordering and returns its
+// digest, which identifies the request. Call Run to carry the protocol
+// messages.
+func (r *Raft) Submit(payload []byte) (string, error) {
+	digest := PayloadDigest(payload)
+	if _, exists := r.requests[digest]; exists {
+		return "", fmt.Errorf("%w: request %s already submitted", ErrRejectedMessage, digest)
+	}
+	r.requests[digest] = &raftRequest{submitted: r.Scheduler.Now, applied: make(map[string]time.Duration)}
+	r.submit(payload)
+	return digest, nil
+}
+
+// SubmitOperation orders op, which Execute applies once it commits
+func (r *Raft) SubmitOperation(op *Operation) (string, error) {
+	frame, err := EncodeFrame(op)
+	if err != nil {
+		return "", err
+	}
+	return r.Submit(frame)
+}
+
+// elected notes a leader elected for a later term than the latest
+func (r *Raft) elected(node *RaftNode) {
+	node.Lock.Lock()
+	term, leads := node.Term, node.Role == RaftLeader
+	node.Lock.Unlock()
+	if !leads || term <= r.Term {
+		return
+	}
+	r.Term, r.Leader = term, node.Node.ID
+	r.Stats.Elections++
+	r.System.Metrics.add(metricViewChanges, "", 1)
+	r.System.trace(TraceEvent{Type: EventViewChange, Node: node.Node.ID, Detail: fmt.Sprintf("raft term %d", term)})
+	r.System.NodeLogger(node.Node.ID).Info("elected", "raft_term", term)
+	if r.OnElection != nil {
+		r.OnElection(term, node.Node.ID)
+	}
+}
+
+// applied records when a node applied submitted entries
+func (r *Raft) applied(node *RaftNode) {
+	var commits []TraceEvent
+	defer func() {
+		for _, event := range commits {
+			r.System.trace(event)
+		}
+	}()
+	node.Lock.Lock()
+	defer node.Lock.Unlock()
+	for _, application := range node.Applied {
+		request := r.requests[application.Digest]
+		if request == nil {
+			continue
+		}
+		if _, done := request.applied[node.Node.ID]; done {
+			continue
+		}
+		request.applied[node.Node.ID] = r.Scheduler.Now
+		r.Scheduler.Progress()
+		logger := r.System.NodeLogger(node.Node.ID)
+		logger.Debug("applied", "index", application.Index, "digest", application.Digest)
+		if len(request.applied) == 1 {
+			request.index, request.term = application.Index, application.Term
+			r.System.Metrics.observeCommit("raft", r.Scheduler.Now-request.submitted)
+			logger.Info("committed", "index", application.Index, "digest", application.Digest, "latency", r.Scheduler.Now-request.submitted)
+			commits = append(commits, TraceEvent{Type: EventCommit, Node: node.Node.ID, Detail: fmt.Sprintf("raft index %d", application.Index)})
+		}
+	}
+}
+
+// timeout is how long a timer runs
+func (r *Raft) timeout(timer raftTimer) time.Duration {
+	if timer.Heartbeat {
+		if r.Heartbeat == 0 {
+			return DefaultRaftHeartbeat
+		}
+		return r.Heartbeat
+	}
+	timeout := r.ElectionTimeout
+	if timeout == 0 {
+		timeout = DefaultElectionTimeout
+	}
+	timeout += time.Duration(r.Scheduler.Rand.Int63n(int64(timeout)))
+	return timeout << timer.Stalled
+}
+
+// raftName is the capture kind of a Raft message
+func raftName(m Message) string {
+	switch m.(type) {
+	case *RequestVote:
+		return "request-vote"
+	case *VoteReply:
+		return "vote"
+	case *AppendEntries:
+		return "append-entries"
+	case *AppendReply:
+		return "append-reply"
+	}
+	return m.MessageType().String()
+}
+
+// Outcome reports what happened to the request with the given digest
+func (r *Raft) Outcome(digest string) RaftOutcome {
+	outcome := RaftOutcome{Digest: digest}
+	request := r.requests[digest]
+	if request == nil {
+		return outcome
+	}
+	outcome.Index, outcome.Term = request.index, request.term
+	outcome.Applied = sortedKeys(request.applied)
+	if len(request.applied) > 0 {
+		first := time.Duration(-1)
+		for _, at := range request.applied {
+			if first < 0 || at < first {
+				first = at
+			}
+		}
+		outcome.Committed = true
+		outcome.Latency = first - request.submitted
+	}
+	return outcome
+}
+
+// Conflicts returns the indexes, in order, at which nodes applied different
+// payloads, which Raft only allows with a Byzantine node among them
+func (r *Raft) Conflicts() []uint64 {
+	applied := make(map[uint64]string)
+	conflicting := make(map[uint64]bool)
+	for _, id := range sortedKeys(r.Nodes) {
+		node := r.Nodes[id]
+		node.Lock.Lock()
+		for _, application := range node.Applied {
+			if digest, exists := applied[application.Index]; exists && digest != application.Digest {
+				conflicting[application.Index] = true
+			}
+			applied[application.Index] = application.Digest
+		}
+		node.Lock.Unlock()
+	}
+	return sortedIndexes(conflicting)
+}
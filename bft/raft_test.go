@@ -0,0 +1,142 @@
+package bft
+
+import (
+	"testing"
+)
+
+// newRaft creates Raft on nodes A-D, with the given nodes Byzantine
+func newRaft(t *testing.T, byzantine ...string) *Raft {
+	t.Helper()
+	raft, err := NewRaft(newPBFT(t, byzantine...).System)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raft
+}
+
+// TestRaftCommitsOnEveryNode tests that the first leader replicates and
+// commits a request that every node then applies at the same index
+func TestRaftCommitsOnEveryNode(t *testing.T) {
+	raft := newRaft(t)
+	if raft.Leader != "A" || raft.Term != 1 {
+		t.Fatalf("Expected A to lead term 1, got %s in term %d", raft.Leader, raft.Term)
+	}
+	digest, err := raft.Submit([]byte("w1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raft.Submit([]byte("w1")); err == nil {
+		t.Error("Expected a resubmitted request to be refused")
+	}
+	if err := raft.Run(); err != nil {
+		t.Fatal(err)
+	}
+	outcome := raft.Outcome(digest)
+	if !outcome.Committed || outcome.Index != 1 || outcome.Term != 1 || len(outcome.Applied) != 4 {
+		t.Fatalf("Expected w1 at index 1 applied by every node, got %+v", outcome)
+	}
+	for id, node := range raft.Nodes {
+		if node.CommitIndex != 1 || node.Role != RaftFollower && id != "A" {
+			t.Errorf("Expected %s to have committed index 1 as follower, got %d as %s", id, node.CommitIndex, node.Role)
+		}
+	}
+	if conflicts := raft.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+}
+
+// TestRaftElectsNewLeader tests that the followers elect a leader among
+// themselves once theirs crashed, which commits the next request after
+// those of the old one
+func TestRaftElectsNewLeader(t *testing.T) {
+	raft := newRaft(t)
+	var elected string
+	raft.OnElection = func(term int64, leader string) { elected = leader }
+	first, _ := raft.Submit([]byte("w1"))
+	if err := raft.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := raft.System.ApplyFault(FaultStep{Kind: FaultCrash, Nodes: []string{"A"}}); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := raft.Submit([]byte("w2"))
+	if err := raft.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	outcome := raft.Outcome(second)
+	if !outcome.Committed || outcome.Index <= raft.Outcome(first).Index || outcome.Term < 2 {
+		t.Fatalf("Expected w2 to commit after w1 in a later term, got %+v", outcome)
+	}
+	if raft.Leader == "A" || raft.Leader != elected || raft.Stats.Elections == 0 {
+		t.Errorf("Expected a new leader to be elected, got %s (elected %q) after %d elections", raft.Leader, elected, raft.Stats.Elections)
+	}
+	if len(outcome.Applied) != 3 || containsID(outcome.Applied, "A") {
+		t.Errorf("Expected the three survivors to apply w2, got %v", outcome.Applied)
+	}
+}
+
+// TestRaftMinorityGivesUp tests that a minority commits nothing and ends its
+// run once its nodes gave up standing for election
+func TestRaftMinorityGivesUp(t *testing.T) {
+	raft := newRaft(t)
+	raft.System.Partition["A"], raft.System.Partition["B"] = true, true
+	digest, _ := raft.Submit([]byte("w1"))
+	if err := raft.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if outcome := raft.Outcome(digest); outcome.Committed {
+		t.Errorf("Expected nothing to commit without a majority, got %+v", outcome)
+	}
+	if raft.Scheduler.Pending() != 0 || raft.Stats.Elections != 0 {
+		t.Errorf("Expected the run to end without a leader, got %d events and %d elections", raft.Scheduler.Pending(), raft.Stats.Elections)
+	}
+}
+
+// TestRaftByzantineLeaderDiverges tests that followers apply whatever a
+// Byzantine leader sends them, where PBFT commits nothing it cannot agree on
+func TestRaftByzantineLeaderDiverges(t *testing.T) {
+	raft := newRaft(t, "A")
+	raft.Submit([]byte("w1"))
+	if err := raft.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if conflicts := raft.Conflicts(); len(conflicts) != 1 || conflicts[0] != 1 {
+		t.Errorf("Expected the nodes to apply different payloads at index 1, got %v", conflicts)
+	}
+	// Every other follower, C among them, gets forged payloads
+	if applied := raft.Nodes["C"].Applied; len(applied) == 0 || string(applied[0].Payload) != "forged:w1" {
+		t.Errorf("Expected C to apply the forged w1 first, got %+v", applied)
+	}
+}
+
+// TestRaftEngine tests that a namespace ordered by Raft commits through it
+// while the system's leader is down
+func TestRaftEngine(t *testing.T) {
+	system := newGeoSystem(t)
+	system.UseScheduler(NewScheduler(1))
+	if err := system.UseEngine("ledger", EngineRaft); err != nil {
+		t.Fatal(err)
+	}
+	result, err := system.SubmitWrite("us-east", "B", "ledger/a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Leader != "A" || !result.Forwarded || result.Index != 1 {
+		t.Errorf("Expected the Raft leader A to commit the write from B at 1, got %+v", result)
+	}
+	if err := system.ApplyFault(FaultStep{Kind: FaultCrash, Nodes: []string{"A"}}); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = system.SubmitWrite("us-east", "B", "ledger/b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if result.Leader == "A" || system.GetLeader() != "A" {
+		t.Errorf("Expected Raft to elect its own leader, got %s with system leader %s", result.Leader, system.GetLeader())
+	}
+	for _, id := range []string{"B", "D", "G"} {
+		if value := system.Nodes[id].Store.Entries["ledger/b"].Value; value != "2" {
+			t.Errorf("Expected %s to apply ledger/b=2, got %q", id, value)
+		}
+	}
+}
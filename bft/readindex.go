@@ -0,0 +1,142 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Linearizable reads.
+//
+// A read served from the leader's store is only linearizable if the node is
+// still the leader: a deposed leader cut off from the cluster keeps serving
+// old values. The simple fix is to put every read through the log, which
+// costs a signed entry and a full commit per read. ReadIndex avoids that:
+// the leader notes its commit index, confirms it still leads by collecting
+// heartbeat acks from a quorum, and then serves the read from its store at
+// that index. No entry is appended and nothing is signed.
+
+var ErrNoQuorum = errors.New("leader cannot reach a quorum")
+
+// heartbeatQuorum confirms the leader's authority, returning the round trip
+// to the quorum. A leader cut off from the network only hears itself.
+// The caller must hold s.Lock.
+func (s *System) heartbeatQuorum(leader *Node) (time.Duration, error) {
+	voters := s.voters()
+	f := s.faultThreshold(len(voters))
+	reachable := 1
+	if s.reachable(leader) {
+		reachable = 0
+		for _, node := range voters {
+			if s.reachable(node) {
+				reachable++
+			}
+		}
+	}
+	if reachable < 2*f+1 {
+		return 0, fmt.Errorf("%w: %d of %d voters reachable, need %d", ErrNoQuorum, reachable, len(voters), 2*f+1)
+	}
+	return s.quorumRoundTrip(leader), nil
+}
+
+// ReadIndex serves a linearizable read of key for a client in clientRegion
+// that contacted nodeID, without appending to the log
+func (s *System) ReadIndex(clientRegion, nodeID, key string) (result *ReadResult, err error) {
+	op := s.recordInvoke(clientRegion, OpRead, key, "")
+	defer func() {
+		if err != nil {
+			s.recordComplete(op, "", 0, false)
+		} else {
+			s.recordComplete(op, result.Value, result.Index, true)
+		}
+	}()
+
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	contact, leader, err := s.route(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	leader.Lock.RLock()
+	readIndex := leader.Store.CommitIndex
+	leader.Lock.RUnlock()
+
+	confirm, err := s.heartbeatQuorum(leader)
+	if err != nil {
+		return nil, err
+	}
+
+	// The leader has applied everything up to readIndex, so its store answers
+	leader.Lock.RLock()
+	entry := leader.Store.Entries[key]
+	value, err := leader.plaintext(entry)
+	leader.Lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	latency := 2*s.regionLatency(clientRegion, contact.Region) + confirm
+	if contact.ID != leader.ID {
+		latency += 2 * s.regionLatency(contact.Region, leader.Region)
+	}
+	return &ReadResult{
+		Key:       key,
+		Value:     value,
+		Index:     entry.Index,
+		ServedBy:  leader.ID,
+		Latency:   latency,
+		Label:     stalenessLabel(0),
+		ReadIndex: readIndex,
+	}, nil
+}
+
+// LogRead serves a linearizable read by committing a no-op entry through the
+// log first, the costly alternative ReadIndex replaces
+func (s *System) LogRead(clientRegion, nodeID, key string) (result *ReadResult, err error) {
+	op := s.recordInvoke(clientRegion, OpRead, key, "")
+	defer func() {
+		if err != nil {
+			s.recordComplete(op, "", 0, false)
+		} else {
+			s.recordComplete(op, result.Value, result.Index, true)
+		}
+	}()
+
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	contact, leader, err := s.route(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.heartbeatQuorum(leader); err != nil {
+		return nil, err
+	}
+	s.commitLock.Lock()
+	defer s.commitLock.Unlock()
+	leader.Lock.RLock()
+	noop := Entry{Index: leader.Store.CommitIndex + 1}
+	leader.Lock.RUnlock()
+
+	timing := NewOpTiming(fmt.Sprintf("r%d", noop.Index), "client@"+clientRegion)
+	if err := s.commit(timing, clientRegion, contact, leader, entryDigest(noop), []Entry{noop}); err != nil {
+		return nil, err
+	}
+	leader.Lock.RLock()
+	entry := leader.Store.Entries[key]
+	value, err := leader.plaintext(entry)
+	leader.Lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return &ReadResult{
+		Key:       key,
+		Value:     value,
+		Index:     entry.Index,
+		ServedBy:  leader.ID,
+		Latency:   timing.Total(),
+		Label:     stalenessLabel(0),
+		ReadIndex: noop.Index,
+	}, nil
+}
@@ -0,0 +1,80 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestReadIndexDoesNotConsumeLog tests that ReadIndex reads leave the log untouched
+func TestReadIndexDoesNotConsumeLog(t *testing.T) {
+	system := newGeoSystem(t)
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := system.ReadIndex("ap-south", "G", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Value != "1" || read.ReadIndex != 1 || read.ServedBy != "A" {
+		t.Errorf("Expected x=1 from A at read index 1, got %+v", read)
+	}
+	if system.Nodes["A"].Store.CommitIndex != 1 {
+		t.Errorf("Expected ReadIndex not to append entries")
+	}
+
+	logged, err := system.LogRead("ap-south", "G", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logged.Value != "1" || logged.ReadIndex != 2 || system.Nodes["A"].Store.CommitIndex != 2 {
+		t.Errorf("Expected the log read to commit a no-op at index 2, got %+v", logged)
+	}
+	if logged.Latency < read.Latency {
+		t.Errorf("Expected the log read to cost at least as much as ReadIndex")
+	}
+}
+
+// TestReadIndexRequiresQuorum tests that a leader without a quorum refuses reads
+func TestReadIndexRequiresQuorum(t *testing.T) {
+	system := newGeoSystem(t)
+	system.SetPartition("B", true)
+	system.SetPartition("D", true)
+	if _, err := system.ReadIndex("us-east", "A", "x"); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Expected ErrNoQuorum, got %v", err)
+	}
+	if _, err := system.LogRead("us-east", "A", "x"); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Expected ErrNoQuorum from the log read, got %v", err)
+	}
+}
+
+// benchmarkReads measures a linearizable read path and the log entries it consumes
+func benchmarkReads(b *testing.B, read func(system *System) (*ReadResult, error)) {
+	system := newTestSystem(b, nodeIDs(4))
+	system.SetLeader("A")
+	if _, err := system.SubmitWrite("", "A", "x", "1"); err != nil {
+		b.Fatal(err)
+	}
+	start := system.Nodes["A"].Store.CommitIndex
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := read(system); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(system.Nodes["A"].Store.CommitIndex-start)/float64(b.N), "entries/op")
+}
+
+func BenchmarkReadIndex(b *testing.B) {
+	benchmarkReads(b, func(system *System) (*ReadResult, error) {
+		return system.ReadIndex("", "B", "x")
+	})
+}
+
+func BenchmarkLogRead(b *testing.B) {
+	benchmarkReads(b, func(system *System) (*ReadResult, error) {
+		return system.LogRead("", "B", "x")
+	})
+}
@@ -0,0 +1,88 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Online reconfiguration of the fault tolerance.
+//
+// By default the voters tolerate f = (n-1)/3 faults and every quorum is
+// 2f+1 of them. An operator can set f explicitly instead, to raise it once
+// nodes have been added or to lower it ahead of removing some. The change
+// is a configuration entry committed through the quorum of the current
+// configuration, and it opens a new epoch. Every quorum threshold switches
+// together at the epoch boundary. On the leader path the boundary is the
+// index after the entry: the new configuration is installed under the
+// system lock, so no operation sees a mix of old and new thresholds. In
+// PBFT the boundary is a window past the entry's sequence number, the
+// first sequence number the primary cannot have assigned before executing
+// the change, so every replica counts each entry against the same f.
+
+var ErrInvalidFaultConfig = errors.New("invalid fault tolerance")
+
+// FaultChange is a configuration entry setting the tolerated fault count
+type FaultChange struct {
+	Epoch int64
+	F     int
+}
+
+// FaultConfig is a fault tolerance installed by a FaultChange
+type FaultConfig struct {
+	Epoch int64 `json:"epoch"`
+	F     int   `json:"f"`
+	Index int64 `json:"index"` // First log index governed by the epoch
+}
+
+// checkFaults reports whether voters can tolerate f faults
+func checkFaults(voters, f int) error {
+	if f < 0 || voters < 3*f+1 {
+		return fmt.Errorf("%w: f=%d needs %d voters, have %d", ErrInvalidFaultConfig, f, 3*f+1, voters)
+	}
+	return nil
+}
+
+// faultThreshold returns the tolerated faults among voters, the configured
+// f if one was installed. The caller must hold s.Lock.
+func (s *System) faultThreshold(voters int) int {
+	if s.Faults != nil {
+		return s.Faults.F
+	}
+	return (voters - 1) / 3
+}
+
+// ReconfigureFaults commits a configuration entry setting f and installs
+// it at the next log index. The change needs a quorum of the current
+// configuration.
+func (s *System) ReconfigureFaults(f int) (*FaultConfig, error) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	if err := checkFaults(len(s.voters()), f); err != nil {
+		return nil, err
+	}
+	leader, exists := s.Nodes[s.Leader]
+	if !exists {
+		return nil, ErrNoLeader
+	}
+	if _, err := s.heartbeatQuorum(leader); err != nil {
+		return nil, err
+	}
+
+	var epoch int64 = 1
+	if s.Faults != nil {
+		epoch = s.Faults.Epoch + 1
+	}
+	leader.Lock.RLock()
+	entry := Entry{Index: leader.Store.CommitIndex + 1}
+	leader.Lock.RUnlock()
+
+	timing := NewOpTiming(fmt.Sprintf("faults-%d", epoch), leader.ID)
+	if err := s.commit(timing, leader.Region, leader, leader, entryDigest(entry), []Entry{entry}); err != nil {
+		return nil, err
+	}
+	s.Faults = &FaultConfig{Epoch: epoch, F: f, Index: entry.Index + 1}
+	s.audit(AuditMembership, leader.ID, "", fmt.Sprintf("fault tolerance set to f=%d from index %d (epoch %d)", f, s.Faults.Index, epoch))
+	config := *s.Faults
+	return &config, nil
+}
@@ -0,0 +1,105 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newFaultSystem creates seven voters A-G led by A
+func newFaultSystem(t *testing.T) *System {
+	system := newTestSystem(t, nodeIDs(7))
+	system.SetLeader("A")
+	return system
+}
+
+// TestReconfigureFaults tests that a committed change switches every quorum threshold at once
+func TestReconfigureFaults(t *testing.T) {
+	system := newFaultSystem(t)
+	if health := system.QuorumHealth(); health.F != 2 || health.Quorum != 5 || health.Epoch != 0 {
+		t.Fatalf("Expected the derived f=2 with quorum 5, got %+v", health)
+	}
+	system.SubmitWrite("", "A", "x", "1")
+
+	config, err := system.ReconfigureFaults(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Epoch != 1 || config.F != 1 || config.Index != 3 {
+		t.Errorf("Expected epoch 1 with f=1 from index 3, got %+v", config)
+	}
+	if commit := system.Nodes["B"].Store.CommitIndex; commit != 2 {
+		t.Errorf("Expected the configuration entry at index 2 on B, got %d", commit)
+	}
+	if health := system.QuorumHealth(); health.F != 1 || health.Quorum != 3 || health.Epoch != 1 {
+		t.Errorf("Expected f=1 with quorum 3 in epoch 1, got %+v", health)
+	}
+	if geometry := AnalyzeQuorums(system, -1); geometry.Size != 3 {
+		t.Errorf("Expected quorum geometry over 3 nodes, got %d", geometry.Size)
+	}
+
+	for _, id := range []string{"D", "E", "F", "G"} {
+		system.SetPartition(id, true)
+	}
+	if _, err := system.ReadIndex("", "A", "x"); err != nil {
+		t.Errorf("Expected 3 reachable voters to form a quorum with f=1, got %v", err)
+	}
+	if config, err = system.ReconfigureFaults(2); err != nil || config.Epoch != 2 {
+		t.Fatalf("Expected the current quorum to approve f=2 in epoch 2, got %+v (%v)", config, err)
+	}
+	if _, err := system.ReadIndex("", "A", "x"); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Expected ErrNoQuorum with f=2, got %v", err)
+	}
+}
+
+// TestReconfigureFaultsValidation tests that f must fit the voters and the change needs the current quorum
+func TestReconfigureFaultsValidation(t *testing.T) {
+	system := newFaultSystem(t)
+	for _, f := range []int{-1, 3} {
+		if _, err := system.ReconfigureFaults(f); !errors.Is(err, ErrInvalidFaultConfig) {
+			t.Errorf("Expected ErrInvalidFaultConfig for f=%d with 7 voters, got %v", f, err)
+		}
+	}
+	for _, id := range []string{"E", "F", "G"} {
+		system.SetPartition(id, true)
+	}
+	if _, err := system.ReconfigureFaults(1); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Expected lowering f without a quorum to fail, got %v", err)
+	}
+	if system.Faults != nil {
+		t.Errorf("Expected no configuration to be installed, got %+v", system.Faults)
+	}
+	if clone := system.Clone(); clone.Faults != nil {
+		t.Errorf("Expected the clone to derive f too, got %+v", clone.Faults)
+	}
+}
+
+// TestFaultsAdminAPI tests reconfiguring f through the operator API
+func TestFaultsAdminAPI(t *testing.T) {
+	system := newFaultSystem(t)
+	handler := system.StandbyAdminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/faults?f=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the change to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	var config FaultConfig
+	if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil || config.F != 1 || config.Epoch != 1 {
+		t.Errorf("Expected f=1 in epoch 1, got %s", rec.Body)
+	}
+	for _, target := range []string{"/faults?f=x", "/faults?f=3"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, got %d", target, rec.Code)
+		}
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/faults?f=1", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be refused, got %d", rec.Code)
+	}
+}
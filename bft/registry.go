@@ -0,0 +1,193 @@
+package bft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultRegistryDir is where runs are recorded unless configured otherwise
+const DefaultRegistryDir = ".wahello"
+
+// registryFile is the append-only file holding one RunRecord per line
+const registryFile = "runs.jsonl"
+
+// RunRecord describes one simulation or benchmark run
+type RunRecord struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Started     time.Time          `json:"started"`
+	Duration    time.Duration      `json:"duration"`
+	Seed        int64              `json:"seed"`
+	GitRevision string             `json:"git_revision"`
+	Tags        []string           `json:"tags,omitempty"`
+	Config      map[string]string  `json:"config,omitempty"`
+	Results     map[string]float64 `json:"results,omitempty"`
+}
+
+// RunRegistry persists run records in a directory
+type RunRegistry struct {
+	Dir  string
+	Lock sync.Mutex
+}
+
+// OpenRegistry opens the registry in dir, creating the directory if needed
+func OpenRegistry(dir string) (*RunRegistry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &RunRegistry{Dir: dir}, nil
+}
+
+// HasTag reports whether the record carries the tag
+func (r *RunRecord) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Add appends a record, assigning an ID if it has none
+func (reg *RunRegistry) Add(record *RunRecord) error {
+	reg.Lock.Lock()
+	defer reg.Lock.Unlock()
+
+	if record.ID == "" {
+		record.ID = fmt.Sprintf("%s-%d", record.Started.UTC().Format("20060102T150405"), record.Started.Nanosecond())
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(reg.Dir, registryFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// List returns the recorded runs carrying all of the given tags, oldest first
+func (reg *RunRegistry) List(tags ...string) ([]*RunRecord, error) {
+	reg.Lock.Lock()
+	defer reg.Lock.Unlock()
+
+	f, err := os.Open(filepath.Join(reg.Dir, registryFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []*RunRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var record RunRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", registryFile, line, err)
+		}
+		matches := true
+		for _, tag := range tags {
+			if !record.HasTag(tag) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			records = append(records, &record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Started.Before(records[j].Started)
+	})
+	return records, nil
+}
+
+// GitRevision returns the current git commit, or "unknown" outside a checkout
+func GitRevision() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// TagList collects repeated -tag flags
+type TagList []string
+
+func (t *TagList) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *TagList) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+// RunsCommand implements `wahello runs list [--tag t]... [--registry dir]`
+func RunsCommand(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "list" {
+		return errors.New("usage: wahello runs list [--tag tag]... [--registry dir]")
+	}
+	flags := flag.NewFlagSet("runs list", flag.ContinueOnError)
+	dir := flags.String("registry", DefaultRegistryDir, "run registry directory")
+	var tags TagList
+	flags.Var(&tags, "tag", "only list runs with this tag (repeatable)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	registry, err := OpenRegistry(*dir)
+	if err != nil {
+		return err
+	}
+	records, err := registry.List(tags...)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTARTED\tSEED\tREVISION\tTAGS\tRESULTS")
+	for _, record := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			record.ID, record.Name, record.Started.Format(time.RFC3339), record.Seed,
+			record.GitRevision, strings.Join(record.Tags, ","), formatResults(record.Results))
+	}
+	return w.Flush()
+}
+
+// formatResults renders results as sorted key=value pairs
+func formatResults(results map[string]float64) string {
+	keys := make([]string, 0, len(results))
+	for key := range results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s=%g", key, results[key])
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,75 @@
+package bft
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunRegistryListByTag tests persisting runs and filtering them by tag
+func TestRunRegistryListByTag(t *testing.T) {
+	dir := t.TempDir()
+	registry, err := OpenRegistry(dir)
+	if err != nil {
+		t.Fatalf("Failed to open registry: %v", err)
+	}
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	runs := []*RunRecord{
+		{Name: "partition", Started: start.Add(time.Minute), Seed: 2, Tags: []string{"partition", "byzantine"}},
+		{Name: "partition", Started: start, Seed: 1, Tags: []string{"partition"}, Results: map[string]float64{"anomalies": 1}},
+		{Name: "bench", Started: start.Add(2 * time.Minute), Seed: 3},
+	}
+	for _, run := range runs {
+		if err := registry.Add(run); err != nil {
+			t.Fatalf("Failed to add run: %v", err)
+		}
+		if run.ID == "" {
+			t.Errorf("Expected run to be assigned an ID")
+		}
+	}
+
+	// Reopen to make sure records were persisted
+	registry, err = OpenRegistry(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen registry: %v", err)
+	}
+	all, err := registry.List()
+	if err != nil || len(all) != 3 {
+		t.Fatalf("Expected 3 runs, got %d (%v)", len(all), err)
+	}
+	tagged, err := registry.List("partition")
+	if err != nil || len(tagged) != 2 {
+		t.Fatalf("Expected 2 partition runs, got %d (%v)", len(tagged), err)
+	}
+	if tagged[0].Seed != 1 || tagged[1].Seed != 2 {
+		t.Errorf("Expected runs ordered by start time, got seeds %d, %d", tagged[0].Seed, tagged[1].Seed)
+	}
+	if tagged[0].Results["anomalies"] != 1 {
+		t.Errorf("Expected results to round-trip, got %v", tagged[0].Results)
+	}
+	both, _ := registry.List("partition", "byzantine")
+	if len(both) != 1 {
+		t.Errorf("Expected 1 run with both tags, got %d", len(both))
+	}
+}
+
+// TestRunsListCommand tests the runs list subcommand output
+func TestRunsListCommand(t *testing.T) {
+	dir := t.TempDir()
+	registry, _ := OpenRegistry(dir)
+	registry.Add(&RunRecord{Name: "partition", Started: time.Now(), Seed: 42, Tags: []string{"partition"}})
+	registry.Add(&RunRecord{Name: "bench", Started: time.Now(), Seed: 7})
+
+	var out bytes.Buffer
+	if err := RunsCommand([]string{"list", "--registry", dir, "--tag", "partition"}, &out); err != nil {
+		t.Fatalf("runs list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "42") || strings.Contains(out.String(), "bench") {
+		t.Errorf("Unexpected runs list output:\n%s", out.String())
+	}
+	if err := RunsCommand(nil, &out); err == nil {
+		t.Errorf("Expected usage error without a subcommand")
+	}
+}
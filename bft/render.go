@@ -0,0 +1,194 @@
+package bft
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Terminal output.
+//
+// The simulation writes its report through a Renderer. In plain mode, for
+// logs and pipes, it writes text as given. With color on, for a terminal,
+// it gives every node ID its own color, highlights titles and section
+// headings and keeps a status line for work in progress, a PBFT run say,
+// that is redrawn as the run advances and replaced by the next line of
+// output. Tables align their columns in both modes.
+
+// ANSI escape sequences
+const (
+	ansiReset     = "\033[0m"
+	ansiBold      = "\033[1m"
+	ansiClearLine = "\r\033[K"
+)
+
+// nodeColors are assigned to node IDs in the order they are first shown
+var nodeColors = []string{"\033[31m", "\033[32m", "\033[33m", "\033[34m", "\033[35m", "\033[36m",
+	"\033[91m", "\033[92m", "\033[93m", "\033[94m", "\033[95m", "\033[96m"}
+
+// statusEvery is how many scheduler events pass between status redraws
+const statusEvery = 64
+
+// Renderer writes the simulation's report
+type Renderer struct {
+	W      io.Writer
+	Color  bool // Colors and live status lines
+	Lock   sync.Mutex
+	colors map[string]string
+	status bool // A status line is showing
+}
+
+// Output is where the simulation writes its report, plain to stdout unless
+// the command line says otherwise
+var Output = NewRenderer(os.Stdout, false)
+
+// NewRenderer creates a renderer writing to w
+func NewRenderer(w io.Writer, color bool) *Renderer {
+	return &Renderer{W: w, Color: color, colors: make(map[string]string)}
+}
+
+// IsTerminal reports whether w is a terminal that takes colors. NO_COLOR
+// and TERM=dumb turn colors off.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// write clears the status line, if one is showing, and writes s
+func (r *Renderer) write(s string) {
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	if r.status {
+		io.WriteString(r.W, ansiClearLine)
+		r.status = false
+	}
+	io.WriteString(r.W, s)
+}
+
+// Printf writes formatted text
+func (r *Renderer) Printf(format string, args ...interface{}) {
+	r.write(fmt.Sprintf(format, args...))
+}
+
+// Println writes its operands and a newline
+func (r *Renderer) Println(args ...interface{}) {
+	r.write(fmt.Sprintln(args...))
+}
+
+// Print writes its operands
+func (r *Renderer) Print(args ...interface{}) {
+	r.write(fmt.Sprint(args...))
+}
+
+// Title writes the heading of a report
+func (r *Renderer) Title(text string) {
+	r.write(r.paint(ansiBold, "=== "+text+" ===") + "\n")
+}
+
+// Section writes the heading of a part of a report
+func (r *Renderer) Section(text string) {
+	r.write(r.paint(ansiBold+"\033[4m", text) + ":\n")
+}
+
+// paint wraps s in an escape sequence when colors are on
+func (r *Renderer) paint(code, s string) string {
+	if !r.Color || code == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// Node returns a node ID in the node's color
+func (r *Renderer) Node(id string) string {
+	if !r.Color {
+		return id
+	}
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	color, ok := r.colors[id]
+	if !ok {
+		color = nodeColors[len(r.colors)%len(nodeColors)]
+		r.colors[id] = color
+	}
+	return color + id + ansiReset
+}
+
+// Nodes returns a list of node IDs formatted like %v, each in its color
+func (r *Renderer) Nodes(ids []string) string {
+	colored := make([]string, len(ids))
+	for i, id := range ids {
+		colored[i] = r.Node(id)
+	}
+	return "[" + strings.Join(colored, " ") + "]"
+}
+
+// Table writes rows under a header with their columns aligned
+func (r *Renderer) Table(header []string, rows [][]string) {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	var b strings.Builder
+	line := func(row []string, code string) {
+		for i, cell := range row {
+			if i < len(row)-1 {
+				cell += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+2)
+			}
+			b.WriteString(r.paint(code, cell))
+		}
+		b.WriteString("\n")
+	}
+	line(header, ansiBold)
+	for _, row := range rows {
+		line(row, "")
+	}
+	r.write(b.String())
+}
+
+// Status shows a line describing work in progress until the next output.
+// It does nothing in plain mode.
+func (r *Renderer) Status(format string, args ...interface{}) {
+	if !r.Color {
+		return
+	}
+	r.Lock.Lock()
+	defer r.Lock.Unlock()
+	io.WriteString(r.W, ansiClearLine+"\033[2m"+fmt.Sprintf(format, args...)+ansiReset)
+	r.status = true
+}
+
+// Track shows label with the virtual time and events run in the status
+// line while s runs events, until the returned function is called
+func (r *Renderer) Track(s *Scheduler, label string) func() {
+	if !r.Color || s == nil {
+		return func() {}
+	}
+	previous := s.OnStep
+	s.OnStep = func() {
+		if previous != nil {
+			previous()
+		}
+		if s.Executed%statusEvery == 0 {
+			r.Status("%s: %d events, %v virtual", label, s.Executed, s.Now)
+		}
+	}
+	r.Status("%s...", label)
+	return func() {
+		s.OnStep = previous
+		r.Lock.Lock()
+		defer r.Lock.Unlock()
+		if r.status {
+			io.WriteString(r.W, ansiClearLine)
+			r.status = false
+		}
+	}
+}
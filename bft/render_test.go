@@ -0,0 +1,66 @@
+package bft
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestRendererPlain tests that plain mode writes text without escape sequences or status lines
+func TestRendererPlain(t *testing.T) {
+	var out bytes.Buffer
+	r := NewRenderer(&out, false)
+	r.Title("Run")
+	r.Section("Phase")
+	r.Status("working")
+	r.Printf("%s executed by %v\n", r.Node("A"), r.Nodes([]string{"B", "C"}))
+	expected := "=== Run ===\nPhase:\nA executed by [B C]\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+	if IsTerminal(&out) {
+		t.Errorf("Expected a buffer not to be a terminal")
+	}
+}
+
+// TestRendererColors tests that every node keeps its own color
+func TestRendererColors(t *testing.T) {
+	r := NewRenderer(&bytes.Buffer{}, true)
+	a, b := r.Node("A"), r.Node("B")
+	if a == b || r.Node("A") != a || !strings.Contains(a, "A") || a == "A" {
+		t.Errorf("Expected distinct, stable colors, got %q and %q", a, b)
+	}
+	if nodes := r.Nodes([]string{"A", "B"}); nodes != "["+a+" "+b+"]" {
+		t.Errorf("Expected the colored IDs in brackets, got %q", nodes)
+	}
+}
+
+// TestRendererTable tests that columns are aligned on their widest cell
+func TestRendererTable(t *testing.T) {
+	var out bytes.Buffer
+	NewRenderer(&out, false).Table([]string{"Request", "Crypto"}, [][]string{{"w1", "50µs"}, {"write-2", "1ms"}})
+	expected := "Request  Crypto\nw1       50µs\nwrite-2  1ms\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+// TestRendererTrack tests that the status line follows a run and is cleared before the next output
+func TestRendererTrack(t *testing.T) {
+	var out bytes.Buffer
+	r := NewRenderer(&out, true)
+	s := NewScheduler(1)
+	for i := 0; i < statusEvery; i++ {
+		s.After(0, func() {})
+	}
+	stop := r.Track(s, "PBFT")
+	s.Run()
+	stop()
+	if s.OnStep != nil {
+		t.Errorf("Expected stopping to remove the progress hook")
+	}
+	r.Println("done")
+	if !strings.Contains(out.String(), "PBFT: 64 events") || !strings.HasSuffix(out.String(), ansiClearLine+"done\n") {
+		t.Errorf("Expected a status line cleared before the next output, got %q", out.String())
+	}
+}
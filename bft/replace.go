@@ -0,0 +1,360 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+)
+
+// Replacing a Byzantine node.
+//
+// Once f+1 honest nodes have caught a voter misbehaving, at least one
+// correct node vouches for the evidence and the voter can be removed. The
+// removal is a membership change committed through the current quorum,
+// after which the cluster tolerates one fault less until a replacement
+// joins. The replacement comes with fresh keys, and a certificate if the
+// system has an authority, joins through another membership change and
+// takes over the replicated state by state transfer: it accepts an entry
+// only if f+1 voters hold it identically, so no single replica, correct or
+// not, decides what it starts from. RunNodeReplacement plays the whole
+// sequence on a scenario and checks the cluster is back to full fault
+// tolerance.
+
+var (
+	ErrNodeExists   = errors.New("node already exists")
+	ErrRemoveLeader = errors.New("cannot remove the leader")
+	ErrNotDetected  = errors.New("node was not detected as Byzantine")
+)
+
+// MembershipChange records a voter joining or leaving
+type MembershipChange struct {
+	Node    string
+	Joined  bool
+	Index   int64         // Log index of the change
+	Latency time.Duration // Time to commit the change
+}
+
+// commitMembership commits a membership change entry through the current
+// quorum. The caller must hold s.Lock.
+func (s *System) commitMembership(id string, joined bool) (*MembershipChange, error) {
+	leader, exists := s.Nodes[s.Leader]
+	if !exists {
+		return nil, ErrNoLeader
+	}
+	leader.Lock.RLock()
+	change := Entry{Index: leader.Store.CommitIndex + 1}
+	leader.Lock.RUnlock()
+	timing := NewOpTiming(fmt.Sprintf("membership-%d", change.Index), leader.ID)
+	if err := s.commit(timing, leader.Region, leader, leader, entryDigest(change), []Entry{change}); err != nil {
+		return nil, err
+	}
+	return &MembershipChange{Node: id, Joined: joined, Index: change.Index, Latency: timing.Total()}, nil
+}
+
+// RemoveNode removes a voter from the cluster through the current quorum
+// and drops it from every node's neighbors
+func (s *System) RemoveNode(id string) (*MembershipChange, error) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if _, exists := s.Nodes[id]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, id)
+	}
+	if id == s.Leader {
+		return nil, fmt.Errorf("%w: %s", ErrRemoveLeader, id)
+	}
+	if s.Faults != nil {
+		if err := checkFaults(len(s.voters())-1, s.Faults.F); err != nil {
+			return nil, err
+		}
+	}
+	change, err := s.commitMembership(id, false)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.Nodes, id)
+	delete(s.Partition, id)
+	delete(s.Fenced, id)
+	s.Keys.Remove(id)
+	for _, node := range s.Nodes {
+		node.Lock.Lock()
+		node.Neighbors = removeID(node.Neighbors, id)
+		node.Lock.Unlock()
+	}
+	s.audit(AuditMembership, s.Leader, id, fmt.Sprintf("removed from the cluster at index %d", change.Index))
+	return change, nil
+}
+
+// removeID returns ids without id
+func removeID(ids []string, id string) []string {
+	kept := ids[:0]
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+	return kept
+}
+
+// AdmitNode adds a new voter through the current quorum and issues it a
+// certificate if the system has an authority. The node starts empty; see
+// TransferState.
+func (s *System) AdmitNode(node *Node) (*MembershipChange, error) {
+	s.Lock.Lock()
+	if _, exists := s.Nodes[node.ID]; exists {
+		s.Lock.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNodeExists, node.ID)
+	}
+	change, err := s.commitMembership(node.ID, true)
+	if err != nil {
+		s.Lock.Unlock()
+		return nil, err
+	}
+	if s.Scheduler != nil && node.Clock == nil {
+		node.Clock = s.Scheduler.Clock()
+	}
+	s.Nodes[node.ID] = node
+	s.register(node)
+	if err := s.grantPayloads(node); err != nil {
+		s.Lock.Unlock()
+		return change, err
+	}
+	s.audit(AuditMembership, s.Leader, node.ID, fmt.Sprintf("admitted to the cluster at index %d", change.Index))
+	s.Lock.Unlock()
+	if s.CA != nil {
+		if err := s.RenewCertificate(node.ID); err != nil {
+			return change, err
+		}
+	}
+	return change, nil
+}
+
+// TransferState brings a node's store up to the state f+1 reachable voters
+// agree on and returns the number of entries it took over
+func (s *System) TransferState(id string) (int, error) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	target, exists := s.Nodes[id]
+	if !exists {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownNode, id)
+	}
+	voters := s.voters()
+	f := s.faultThreshold(len(voters))
+	holders := make(map[Entry]int)
+	var commitIndexes []int64
+	for _, node := range voters {
+		if node == target || !s.reachable(node) {
+			continue
+		}
+		node.Lock.RLock()
+		for _, entry := range node.Store.Entries {
+			holders[entry]++
+		}
+		commitIndexes = append(commitIndexes, node.Store.CommitIndex)
+		node.Lock.RUnlock()
+	}
+	if len(commitIndexes) < f+1 {
+		return 0, fmt.Errorf("%w: %d voters to transfer state from, need %d", ErrNoQuorum, len(commitIndexes), f+1)
+	}
+	// The highest commit index f+1 voters have reached
+	sort.Slice(commitIndexes, func(i, j int) bool { return commitIndexes[i] > commitIndexes[j] })
+	commitIndex := commitIndexes[f]
+
+	var entries []Entry
+	for entry, count := range holders {
+		if count >= f+1 && entry.Index <= commitIndex {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Index < entries[j].Index })
+	target.Lock.Lock()
+	for _, entry := range entries {
+		target.Store.Apply(entry)
+	}
+	target.Store.Apply(Entry{Index: commitIndex})
+	target.Lock.Unlock()
+	return len(entries), nil
+}
+
+// Detectors returns the honest nodes that caught id misbehaving, from the
+// system's trace
+func (s *System) Detectors(id string) []string {
+	if s.Trace == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, event := range s.Trace.Snapshot() {
+		if event.Type == EventDetection && event.Peer == id {
+			seen[event.Node] = true
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// ReplacementScenario returns the bundled scenario for RunNodeReplacement:
+// seven voters over three regions, all connected, with F inflating its
+// timestamps. A copy is docs/scenarios/replace.yaml.
+func ReplacementScenario() *ScenarioSpec {
+	ids := []string{"A", "B", "C", "D", "E", "F", "G"}
+	spec := &ScenarioSpec{
+		Name:        "replace",
+		Description: []string{"Replacement: Byzantine F is removed and H joins in its place"},
+		Leader:      "A",
+		Latencies: []ScenarioLatency{
+			{From: "us-east", To: "eu-west", LatencyMs: 40},
+			{From: "us-east", To: "ap-south", LatencyMs: 110},
+			{From: "eu-west", To: "ap-south", LatencyMs: 70},
+		},
+	}
+	regions := map[string]string{"A": "us-east", "B": "us-east", "C": "us-east", "D": "eu-west", "E": "eu-west", "F": "ap-south", "G": "ap-south"}
+	for i, id := range ids {
+		node := ScenarioNode{ID: id, Region: regions[id]}
+		if id == "F" {
+			node.Byzantine, node.Strategy = true, "timestamp-inflation"
+		}
+		spec.Nodes = append(spec.Nodes, node)
+		for _, peer := range ids[i+1:] {
+			spec.Links = append(spec.Links, ScenarioLink{From: id, To: peer})
+		}
+	}
+	return spec
+}
+
+// ReplacementResult reports how a cluster replaced a Byzantine voter
+type ReplacementResult struct {
+	Suspect       string
+	Replacement   string
+	DetectedRound int
+	Detectors     []string
+	Removed       *MembershipChange
+	Admitted      *MembershipChange
+	Transferred   int           // Entries the replacement took over by state transfer
+	Before        *QuorumHealth // Before the suspect was detected
+	After         *QuorumHealth // At the end of the run
+	Byzantine     []string      // Voters still Byzantine at the end
+	Consistent    bool          // The replacement's store matches the leader's
+}
+
+// Restored reports whether the cluster is back to full fault tolerance:
+// as many voters and as high an f as before, none of them faulty or
+// Byzantine, and the replacement current
+func (r *ReplacementResult) Restored() bool {
+	return r.After != nil && len(r.After.Voters) == len(r.Before.Voters) && r.After.F == r.Before.F &&
+		len(r.After.Faulty) == 0 && len(r.Byzantine) == 0 && r.Consistent
+}
+
+func (r *ReplacementResult) String() string {
+	s := fmt.Sprintf("%s detected by %v in round %d, removed at index %d; %s admitted at index %d and took over %d entries",
+		r.Suspect, r.Detectors, r.DetectedRound, r.Removed.Index, r.Replacement, r.Admitted.Index, r.Transferred)
+	if r.Restored() {
+		return s + fmt.Sprintf("; back to %d voters tolerating f=%d", len(r.After.Voters), r.After.F)
+	}
+	return s + "; fault tolerance not restored"
+}
+
+// RunNodeReplacement builds scenario and runs it until f+1 honest nodes
+// have detected suspect, writing a key through the leader every round. It
+// then removes suspect, admits a fresh node named replacement in its
+// region and with its links, transfers state to it, and runs rounds more
+// rounds of writes before checking the cluster's fault tolerance.
+func RunNodeReplacement(scenario *ScenarioSpec, seed int64, suspect, replacement string, rounds int) (*ReplacementResult, error) {
+	system := NewSystem()
+	if err := scenario.Build(system, seed); err != nil {
+		return nil, err
+	}
+	system.Trace = NewTrace()
+	result := &ReplacementResult{Suspect: suspect, Replacement: replacement, Before: system.QuorumHealth()}
+	write := 0
+	round := func() error {
+		system.Lock.RLock()
+		ids := sortedKeys(system.Nodes)
+		leader := system.Leader
+		system.Lock.RUnlock()
+		system.propagateRound(ids)
+		write++
+		_, err := system.SubmitWrite("", leader, fmt.Sprintf("replace/%d", write%5), fmt.Sprint(write))
+		return err
+	}
+
+	result.DetectedRound = -1
+	for i := 0; i < rounds; i++ {
+		if err := round(); err != nil {
+			return nil, err
+		}
+		if detectors := system.Detectors(suspect); len(detectors) > result.Before.F {
+			result.DetectedRound, result.Detectors = i, detectors
+			break
+		}
+	}
+	if result.DetectedRound < 0 {
+		return result, fmt.Errorf("%w: %s in %d rounds", ErrNotDetected, suspect, rounds)
+	}
+
+	system.Lock.RLock()
+	removed, exists := system.Nodes[suspect]
+	system.Lock.RUnlock()
+	if !exists {
+		return result, fmt.Errorf("%w: %s", ErrUnknownNode, suspect)
+	}
+	var inbound []string
+	for _, id := range sortedKeys(system.Nodes) {
+		for _, neighbor := range system.Nodes[id].Neighbors {
+			if neighbor == suspect {
+				inbound = append(inbound, id)
+			}
+		}
+	}
+	var err error
+	if result.Removed, err = system.RemoveNode(suspect); err != nil {
+		return result, err
+	}
+
+	node, err := NewNode(replacement, false, false)
+	if err != nil {
+		return result, err
+	}
+	node.Region = removed.Region
+	node.Neighbors = removeID(append([]string(nil), removed.Neighbors...), suspect)
+	if scenario.Clock != "" {
+		node.UseClock(scenario.Clock)
+	}
+	if scenario.Signatures != "" {
+		if err := node.UseSignatureScheme(scenario.Signatures); err != nil {
+			return result, err
+		}
+	}
+	if result.Admitted, err = system.AdmitNode(node); err != nil {
+		return result, err
+	}
+	for _, id := range inbound {
+		peer := system.Nodes[id]
+		peer.Lock.Lock()
+		peer.Neighbors = append(peer.Neighbors, replacement)
+		peer.Lock.Unlock()
+	}
+	if result.Transferred, err = system.TransferState(replacement); err != nil {
+		return result, err
+	}
+
+	for i := 0; i < rounds; i++ {
+		if err := round(); err != nil {
+			return result, err
+		}
+	}
+	result.After = system.QuorumHealth()
+	system.Lock.RLock()
+	defer system.Lock.RUnlock()
+	for _, id := range result.After.Voters {
+		if system.Nodes[id].IsByzantine {
+			result.Byzantine = append(result.Byzantine, id)
+		}
+	}
+	leader := system.Nodes[system.Leader]
+	leader.Lock.RLock()
+	node.Lock.RLock()
+	result.Consistent = maps.Equal(node.Store.Entries, leader.Store.Entries) && node.Store.CommitIndex == leader.Store.CommitIndex
+	node.Lock.RUnlock()
+	leader.Lock.RUnlock()
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package bft
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// TestLoadReplacementScenario tests that the YAML copy of the replacement scenario matches the built-in one
+func TestLoadReplacementScenario(t *testing.T) {
+	scenario, err := LoadScenario("../docs/scenarios/replace.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scenario, ReplacementScenario()) {
+		t.Errorf("Expected the replacement scenario, got %+v", scenario)
+	}
+}
+
+// TestNodeReplacement tests that the cluster removes detected F, admits H and returns to full fault tolerance
+func TestNodeReplacement(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	result, err := RunNodeReplacement(ReplacementScenario(), 1, "F", "H", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Detectors) <= result.Before.F {
+		t.Errorf("Expected f+1 detectors, got %v", result.Detectors)
+	}
+	if result.Removed.Joined || !result.Admitted.Joined || result.Admitted.Index <= result.Removed.Index {
+		t.Errorf("Expected F to leave before H joins, got %+v and %+v", result.Removed, result.Admitted)
+	}
+	if !result.Restored() {
+		t.Errorf("Expected full fault tolerance, got %s", result)
+	}
+	if result.Transferred == 0 {
+		t.Error("Expected H to take over entries by state transfer")
+	}
+}
+
+// TestNodeReplacementUndetected tests that an honest suspect is never removed
+func TestNodeReplacementUndetected(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	result, err := RunNodeReplacement(ReplacementScenario(), 1, "G", "H", 3)
+	if !errors.Is(err, ErrNotDetected) || result.Removed != nil {
+		t.Errorf("Expected G not to be detected, got %v", err)
+	}
+}
+
+// TestRemoveAndAdmitNode tests membership changes and that the new node gets fresh keys and a certificate
+func TestRemoveAndAdmitNode(t *testing.T) {
+	system, _ := newCertifiedSystem(t)
+	if _, err := system.RemoveNode(system.Leader); !errors.Is(err, ErrRemoveLeader) {
+		t.Errorf("Expected the leader to be refused, got %v", err)
+	}
+	if _, err := system.RemoveNode("Z"); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("Expected an unknown node to be refused, got %v", err)
+	}
+	removed := system.Nodes["D"]
+	if _, err := system.RemoveNode("D"); err != nil {
+		t.Fatal(err)
+	}
+	for id, node := range system.Nodes {
+		for _, neighbor := range node.Neighbors {
+			if neighbor == "D" {
+				t.Errorf("Expected %s to drop D from its neighbors", id)
+			}
+		}
+	}
+
+	node, err := NewNode("H", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := system.AdmitNode(node); err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(node.PublicKey, removed.PublicKey) {
+		t.Error("Expected H to have fresh keys")
+	}
+	if node.Certificate == nil {
+		t.Error("Expected H to be issued a certificate")
+	}
+	if _, err := system.AdmitNode(node); !errors.Is(err, ErrNodeExists) {
+		t.Errorf("Expected a duplicate node to be refused, got %v", err)
+	}
+}
+
+// TestTransferStateNeedsAgreement tests that an entry only one replica holds is not transferred
+func TestTransferStateNeedsAgreement(t *testing.T) {
+	system := newGossipSystem(t, nil)
+	for _, id := range []string{"A", "B", "C", "D"} {
+		system.Nodes[id].Store.Apply(Entry{Index: 1, Key: "x", Value: "1"})
+	}
+	system.Nodes["B"].Store.Apply(Entry{Index: 2, Key: "y", Value: "forged"})
+	node, err := NewNode("H", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := system.AdmitNode(node); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := system.TransferState("H"); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := node.Store.Entries["y"]; exists {
+		t.Error("Expected an entry held by one replica not to be transferred")
+	}
+	if entry := node.Store.Entries["x"]; entry.Value != "1" {
+		t.Errorf("Expected x=1 to be transferred, got %+v", entry)
+	}
+}
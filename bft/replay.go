@@ -0,0 +1,173 @@
+package bft
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Replay of production traces.
+//
+// The distributed deployment logs every clock RPC it handles as one JSON
+// object per line (see DeploymentRecord). ImportDeploymentTrace converts such
+// a log into simulator TraceEvents, and a Replayer re-runs them against an
+// in-memory System one event at a time, optionally perturbing or dropping
+// events on the way so an incident can be explored offline. The updates were
+// signed with the deployment's keys, not the in-memory nodes', so they are
+// applied without checking their signatures.
+
+// DeploymentRecord is one line of a trace recorded by the gRPC deployment
+type DeploymentRecord struct {
+	Time      time.Time `json:"time"`
+	Node      string    `json:"node"`
+	Direction string    `json:"direction"` // "send" or "recv"
+	Method    string    `json:"method"`
+	Peer      string    `json:"peer"`
+	Update    *struct {
+		NodeID    string `json:"node_id"`
+		Timestamp int64  `json:"timestamp"`
+		Seq       uint64 `json:"seq"`
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature"`
+	} `json:"update"`
+}
+
+// clockMethodSuffix identifies the clock update RPC in deployment traces
+const clockMethodSuffix = "/PropagateClockUpdate"
+
+// ImportDeploymentTrace converts a deployment trace into simulator events.
+// Records for other RPC methods are skipped; times become offsets from the
+// first imported record.
+func ImportDeploymentTrace(r io.Reader) ([]TraceEvent, error) {
+	var events []TraceEvent
+	var start time.Time
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var record DeploymentRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !strings.HasSuffix(record.Method, clockMethodSuffix) {
+			continue
+		}
+		if record.Update == nil {
+			return nil, fmt.Errorf("line %d: clock update record without update", line)
+		}
+
+		var eventType EventType
+		switch record.Direction {
+		case "send":
+			eventType = EventSend
+		case "recv":
+			eventType = EventReceive
+		default:
+			return nil, fmt.Errorf("line %d: unknown direction %q", line, record.Direction)
+		}
+
+		if start.IsZero() {
+			start = record.Time
+		}
+		events = append(events, TraceEvent{
+			Seq:  uint64(len(events)),
+			At:   record.Time.Sub(start),
+			Type: eventType,
+			Node: record.Node,
+			Peer: record.Peer,
+			Update: &ClockUpdate{
+				NodeID:    record.Update.NodeID,
+				Timestamp: record.Update.Timestamp,
+				Seq:       record.Update.Seq,
+				Nonce:     record.Update.Nonce,
+				Signature: record.Update.Signature,
+			},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Replayer steps through imported events against a System. Receive events
+// carrying a clock update are applied to the receiving node; the outcome is
+// recorded in the system's trace if it has one. Other events, including the
+// receives consensus protocols trace with only a Detail, pass through.
+type Replayer struct {
+	System *System
+	Events []TraceEvent
+	// Perturb, if set, may modify an event before it is replayed or return
+	// false to drop it
+	Perturb func(event *TraceEvent) bool
+	next    int
+}
+
+// NewReplayer creates a replayer for the given events
+func NewReplayer(system *System, events []TraceEvent) *Replayer {
+	return &Replayer{
+		System: system,
+		Events: events,
+	}
+}
+
+// Done reports whether every event has been replayed
+func (rp *Replayer) Done() bool {
+	return rp.next >= len(rp.Events)
+}
+
+// Step replays the next event and returns it, or nil when the trace is
+// exhausted or the event was dropped by Perturb
+func (rp *Replayer) Step() (*TraceEvent, error) {
+	if rp.Done() {
+		return nil, nil
+	}
+	event := rp.Events[rp.next]
+	rp.next++
+	if event.Update != nil {
+		update := *event.Update
+		event.Update = &update
+	}
+	if rp.Perturb != nil && !rp.Perturb(&event) {
+		return nil, nil
+	}
+
+	rp.System.trace(event)
+	if event.Type != EventReceive || event.Update == nil {
+		return &event, nil
+	}
+
+	rp.System.Lock.RLock()
+	node, exists := rp.System.Nodes[event.Node]
+	rp.System.Lock.RUnlock()
+	if !exists {
+		return &event, fmt.Errorf("event %d: %w: %s", event.Seq, ErrUnknownNode, event.Node)
+	}
+	outcome := EventReject
+	node.Lock.Lock()
+	applied := node.applyClockUpdate(event.Update)
+	node.Lock.Unlock()
+	if applied {
+		outcome = EventApply
+	}
+	rp.System.trace(TraceEvent{At: event.At, Type: outcome, Node: event.Node, Peer: event.Peer, Update: event.Update})
+	return &event, nil
+}
+
+// Run replays all remaining events
+func (rp *Replayer) Run() error {
+	for !rp.Done() {
+		if _, err := rp.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
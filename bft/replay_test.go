@@ -0,0 +1,120 @@
+package bft
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const deploymentTrace = `
+{"time":"2024-05-01T10:00:00Z","node":"B","direction":"send","method":"/wahello.Clock/PropagateClockUpdate","peer":"A","update":{"node_id":"B","timestamp":100,"seq":1,"nonce":"9f1c","signature":""}}
+{"time":"2024-05-01T10:00:00.040Z","node":"A","direction":"recv","method":"/wahello.Clock/PropagateClockUpdate","peer":"B","update":{"node_id":"B","timestamp":100,"seq":1,"nonce":"9f1c","signature":""}}
+{"time":"2024-05-01T10:00:00.050Z","node":"A","direction":"recv","method":"/wahello.Admin/Health","peer":"B"}
+{"time":"2024-05-01T10:00:01Z","node":"A","direction":"recv","method":"/wahello.Clock/PropagateClockUpdate","peer":"B","update":{"node_id":"B","timestamp":105,"seq":2,"nonce":"07ae","signature":""}}
+`
+
+// newReplaySystem builds a system with nodes A and B
+func newReplaySystem(t *testing.T) *System {
+	system := newTestSystem(t, nodeIDs(2))
+	system.Trace = NewTrace()
+	return system
+}
+
+// TestImportDeploymentTrace tests conversion of deployment records into simulator events
+func TestImportDeploymentTrace(t *testing.T) {
+	events, err := ImportDeploymentTrace(strings.NewReader(deploymentTrace))
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 clock events, got %d", len(events))
+	}
+	if events[0].Type != EventSend || events[1].Type != EventReceive {
+		t.Errorf("Unexpected event types: %s, %s", events[0].Type, events[1].Type)
+	}
+	if events[1].At != 40*time.Millisecond || events[2].At != time.Second {
+		t.Errorf("Expected offsets from the first record, got %v and %v", events[1].At, events[2].At)
+	}
+	if events[2].Update.Timestamp != 105 || events[2].Update.Seq != 2 || events[2].Update.Nonce != "07ae" {
+		t.Errorf("Expected update timestamp 105 at seq 2, got %+v", events[2].Update)
+	}
+}
+
+// TestImportDeploymentTraceErrors tests that malformed traces are rejected with line numbers
+func TestImportDeploymentTraceErrors(t *testing.T) {
+	malformed := `{"time":"2024-05-01T10:00:00Z","node":"A","direction":"sideways","method":"/x/PropagateClockUpdate","update":{}}`
+	if _, err := ImportDeploymentTrace(strings.NewReader("not json")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected line-numbered parse error, got %v", err)
+	}
+	if _, err := ImportDeploymentTrace(strings.NewReader(malformed)); err == nil {
+		t.Errorf("Expected error for unknown direction")
+	}
+}
+
+// TestReplayAppliesAndPerturbs tests stepping through a trace with and without perturbation
+func TestReplayAppliesAndPerturbs(t *testing.T) {
+	events, err := ImportDeploymentTrace(strings.NewReader(deploymentTrace))
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	system := newReplaySystem(t)
+	replayer := NewReplayer(system, events)
+	if err := replayer.Run(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if ts := system.Nodes["A"].VectorClock.GetTimestamp("B"); ts != 105 {
+		t.Errorf("Expected A to have applied B@105, got %d", ts)
+	}
+
+	// Drop the last update to see the incident without it
+	system = newReplaySystem(t)
+	replayer = NewReplayer(system, events)
+	replayer.Perturb = func(event *TraceEvent) bool {
+		return event.Update.Timestamp != 105
+	}
+	if err := replayer.Run(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if ts := system.Nodes["A"].VectorClock.GetTimestamp("B"); ts != 100 {
+		t.Errorf("Expected A to stop at B@100 after dropping an event, got %d", ts)
+	}
+	if events[2].Update.Timestamp != 105 {
+		t.Errorf("Expected perturbation not to modify the imported events")
+	}
+
+	applied := 0
+	for _, event := range system.Trace.Snapshot() {
+		if event.Type == EventApply {
+			applied++
+		}
+	}
+	if applied != 1 {
+		t.Errorf("Expected one apply event in the trace, got %d", applied)
+	}
+}
+
+// TestReplayPassesThroughProtocolReceives tests that receive events without a clock update are replayed as-is
+func TestReplayPassesThroughProtocolReceives(t *testing.T) {
+	events := []TraceEvent{
+		{Seq: 1, Type: EventReceive, Node: "A", Peer: "B", Detail: "pbft prepare seq=1 view=0"},
+		{Seq: 2, Type: EventReceive, Node: "A", Peer: "B", Update: &ClockUpdate{NodeID: "B", Timestamp: 7, Seq: 1, Nonce: "ab"}},
+	}
+	system := newReplaySystem(t)
+	if err := NewReplayer(system, events).Run(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if ts := system.Nodes["A"].VectorClock.GetTimestamp("B"); ts != 7 {
+		t.Errorf("Expected A to apply B@7 after the protocol receive, got %d", ts)
+	}
+
+	outcomes := 0
+	for _, event := range system.Trace.Snapshot() {
+		if event.Type == EventApply || event.Type == EventReject {
+			outcomes++
+		}
+	}
+	if outcomes != 1 {
+		t.Errorf("Expected an outcome only for the clock update, got %d", outcomes)
+	}
+}
@@ -0,0 +1,217 @@
+package bft
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// Client-side reply voting.
+//
+// A client that trusts the replica it talks to can be lied to by a single
+// Byzantine node. A BFT client instead asks every replica, checks each
+// reply's signature against the replica's key, and accepts a result only
+// once f+1 distinct replicas have sent matching replies: at most f replicas
+// are faulty, so at least one of them is correct. Replies that disagree with
+// the accepted result, carry bad signatures or answer another request or
+// key, such as a replayed reply to an earlier read, are ignored. A validly
+// signed reply with a different value at the accepted result's index is
+// kept as evidence: a correct replica can lag behind a certified answer, or
+// be a write ahead of it, but never hold another value at the same index.
+// With an audit sink attached, bad signatures and evidence are exported.
+
+var ErrNoMatchingReplies = errors.New("not enough matching replies")
+
+// SignedReply is a replica's signed answer to a request
+type SignedReply struct {
+	Replica   string
+	RequestID string
+	Key       string
+	Value     string
+	Index     int64
+	Signature string
+	Arrival   time.Duration // When the reply reaches the client
+}
+
+// replyDigest is what a replica signs in a reply
+func replyDigest(reply *SignedReply) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("reply:%s:%s:%s:%s:%d",
+		reply.Replica, reply.RequestID, reply.Key, reply.Value, reply.Index)))
+	return sum[:]
+}
+
+// Reply answers a request for key from the node's store. A Byzantine node
+// answers with a fabricated value at the index it holds, signed with its
+// own key.
+func (n *Node) Reply(requestID, key string) (*SignedReply, error) {
+	n.Lock.RLock()
+	entry := n.Store.Entries[key]
+	byzantine := n.IsByzantine
+	n.Lock.RUnlock()
+
+	reply := &SignedReply{Replica: n.ID, RequestID: requestID, Key: key, Value: entry.Value, Index: entry.Index}
+	if byzantine {
+		reply.Value = "forged-" + entry.Value
+	}
+	signature, err := crypto.Sign(n.PrivateKey, replyDigest(reply))
+	if err != nil {
+		return nil, err
+	}
+	reply.Signature = signature
+	return reply, nil
+}
+
+// ReplyResult is a result accepted on f+1 matching replies
+type ReplyResult struct {
+	Value    string
+	Index    int64
+	Matching []string // Replicas whose replies formed the accepted result
+	Ignored  []string // Replicas whose replies were invalid or disagreed
+	Evidence []string // Replicas whose signed replies contradict the result
+	Latency  time.Duration
+}
+
+// BFTClient accepts results only on f+1 matching signed replies
+type BFTClient struct {
+	System *System
+	Region string
+	F      int
+}
+
+// Read reads key and votes on the replicas' replies
+func (c *BFTClient) Read(requestID, key string) (*ReplyResult, error) {
+	replies, err := c.collect(requestID, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.Accept(requestID, key, replies)
+}
+
+// Write submits a write through nodeID and accepts it once f+1 replicas
+// confirm the value at the committed index
+func (c *BFTClient) Write(requestID, nodeID, key, value string) (*ReplyResult, error) {
+	written, err := c.System.SubmitWrite(c.Region, nodeID, key, value)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := c.collect(requestID, key)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.Accept(requestID, key, replies)
+	if err != nil {
+		return nil, err
+	}
+	if result.Value != value || result.Index != written.Index {
+		return nil, fmt.Errorf("%w: replicas confirm %q at %d, wrote %q at %d",
+			ErrNoMatchingReplies, result.Value, result.Index, value, written.Index)
+	}
+	result.Latency += written.Total
+	return result, nil
+}
+
+// collect gathers a reply from every reachable replica, ordered by arrival
+func (c *BFTClient) collect(requestID, key string) ([]*SignedReply, error) {
+	c.System.Lock.RLock()
+	defer c.System.Lock.RUnlock()
+	var replies []*SignedReply
+	for _, id := range sortedKeys(c.System.Nodes) {
+		node := c.System.Nodes[id]
+		if !c.System.reachable(node) {
+			continue
+		}
+		reply, err := node.Reply(requestID, key)
+		if err != nil {
+			return nil, err
+		}
+		reply.Arrival = 2 * c.System.regionLatency(c.Region, node.Region)
+		replies = append(replies, reply)
+	}
+	sort.SliceStable(replies, func(i, j int) bool { return replies[i].Arrival < replies[j].Arrival })
+	return replies, nil
+}
+
+// Accept processes replies to the request for key in arrival order and
+// returns the first result matched by f+1 distinct replicas with valid
+// signatures
+func (c *BFTClient) Accept(requestID, key string, replies []*SignedReply) (*ReplyResult, error) {
+	answers := func(reply *SignedReply) bool {
+		return reply.RequestID == requestID && reply.Key == key && c.validSignature(reply)
+	}
+	type answer struct {
+		value string
+		index int64
+	}
+	votes := make(map[answer][]string)
+	voted := make(map[string]bool)
+	var rejected []string
+	for _, reply := range replies {
+		if voted[reply.Replica] || !answers(reply) {
+			rejected = append(rejected, reply.Replica)
+			continue
+		}
+		voted[reply.Replica] = true
+		a := answer{reply.Value, reply.Index}
+		votes[a] = append(votes[a], reply.Replica)
+		if len(votes[a]) < c.F+1 {
+			continue
+		}
+		result := &ReplyResult{Value: a.value, Index: a.index, Matching: votes[a], Latency: reply.Arrival}
+		for other, replicas := range votes {
+			if other != a {
+				result.Ignored = append(result.Ignored, replicas...)
+			}
+		}
+		result.Ignored = append(result.Ignored, rejected...)
+		sort.Strings(result.Ignored)
+		for _, other := range replies {
+			if other.Index == a.index && other.Value != a.value && answers(other) {
+				result.Evidence = append(result.Evidence, other.Replica)
+			}
+		}
+		c.audit(replies, result)
+		return result, nil
+	}
+	c.audit(replies, nil)
+	return nil, fmt.Errorf("%w: need %d, %d replies, %d distinct answers", ErrNoMatchingReplies, c.F+1, len(replies), len(votes))
+}
+
+// audit exports bad signatures among all replies, including those that
+// arrived after the result was accepted, and the result's evidence
+func (c *BFTClient) audit(replies []*SignedReply, accepted *ReplyResult) {
+	if c.System.Audit == nil {
+		return
+	}
+	for _, reply := range replies {
+		if !c.validSignature(reply) {
+			c.System.audit(AuditSignatureFailure, reply.Replica, "",
+				fmt.Sprintf("invalid signature on reply to %s for %q", reply.RequestID, reply.Key))
+		}
+	}
+	if accepted == nil {
+		return
+	}
+	evidence := make(map[string]bool)
+	for _, id := range accepted.Evidence {
+		evidence[id] = true
+	}
+	for _, reply := range replies {
+		if evidence[reply.Replica] {
+			c.System.audit(AuditEquivocation, reply.Replica, "",
+				fmt.Sprintf("signed %q at index %d for %q in reply to %s, %v certified %q at index %d",
+					reply.Value, reply.Index, reply.Key, reply.RequestID, accepted.Matching, accepted.Value, accepted.Index))
+		}
+	}
+}
+
+// validSignature checks a reply against the named replica's key
+func (c *BFTClient) validSignature(reply *SignedReply) bool {
+	c.System.Lock.RLock()
+	node, exists := c.System.Nodes[reply.Replica]
+	c.System.Lock.RUnlock()
+	return exists && crypto.Verify(node.PublicKey, replyDigest(reply), reply.Signature) == nil
+}
@@ -0,0 +1,125 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestBFTClientIgnoresByzantineReply tests that a wrong answer from one replica is outvoted
+func TestBFTClientIgnoresByzantineReply(t *testing.T) {
+	system := newGeoSystem(t)
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	system.Nodes["B"].IsByzantine = true
+
+	client := &BFTClient{System: system, Region: "us-east", F: 1}
+	result, err := client.Read("r1", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Value != "1" || result.Index != 1 {
+		t.Errorf("Expected x=1 at index 1, got %q at %d", result.Value, result.Index)
+	}
+	if len(result.Matching) != 2 || len(result.Ignored) != 1 || result.Ignored[0] != "B" {
+		t.Errorf("Expected two matching replies and B ignored, got %v and %v", result.Matching, result.Ignored)
+	}
+}
+
+// TestBFTClientWrite tests that a write is accepted once f+1 replicas confirm it
+func TestBFTClientWrite(t *testing.T) {
+	system := newGeoSystem(t)
+	system.Nodes["D"].IsByzantine = true
+
+	client := &BFTClient{System: system, Region: "eu-west", F: 1}
+	result, err := client.Write("w1", "D", "x", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Value != "1" || result.Index != 1 {
+		t.Errorf("Expected x=1 at index 1, got %q at %d", result.Value, result.Index)
+	}
+	for _, replica := range result.Matching {
+		if replica == "D" {
+			t.Errorf("Expected the Byzantine replica not to be counted")
+		}
+	}
+}
+
+// TestBFTClientRejectsForgedSignature tests that a reply signed with the wrong key does not count
+func TestBFTClientRejectsForgedSignature(t *testing.T) {
+	system := newGeoSystem(t)
+	client := &BFTClient{System: system, F: 1}
+
+	forged, err := system.Nodes["B"].Reply("r1", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.Value = "forged"
+	impostor, err := system.Nodes["D"].Reply("r1", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	impostor.Replica = "A"
+	impostor.Value = "forged"
+
+	if _, err := client.Accept("r1", "x", []*SignedReply{forged, impostor}); !errors.Is(err, ErrNoMatchingReplies) {
+		t.Errorf("Expected forged replies to be rejected, got %v", err)
+	}
+}
+
+// TestBFTClientRejectsOtherRequests tests that validly signed replies to
+// another request or key, such as replayed ones, do not count
+func TestBFTClientRejectsOtherRequests(t *testing.T) {
+	system := newGeoSystem(t)
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	client := &BFTClient{System: system, F: 1}
+	replayed, err := client.collect("r1", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Accept("r2", "x", replayed); !errors.Is(err, ErrNoMatchingReplies) {
+		t.Errorf("Expected replies to r1 not to answer r2, got %v", err)
+	}
+	if _, err := client.Accept("r1", "y", replayed); !errors.Is(err, ErrNoMatchingReplies) {
+		t.Errorf("Expected replies for x not to answer y, got %v", err)
+	}
+	result, err := client.Accept("r1", "x", replayed)
+	if err != nil || result.Value != "1" {
+		t.Errorf("Expected x=1 accepted for r1, got %+v, %v", result, err)
+	}
+}
+
+// TestBFTClientNeedsMatchingReplies tests that a single reply is not enough
+func TestBFTClientNeedsMatchingReplies(t *testing.T) {
+	system := newGeoSystem(t)
+	for _, id := range []string{"B", "D", "G"} {
+		system.SetPartition(id, true)
+	}
+	client := &BFTClient{System: system, Region: "us-east", F: 1}
+	if _, err := client.Read("r1", "x"); !errors.Is(err, ErrNoMatchingReplies) {
+		t.Errorf("Expected ErrNoMatchingReplies, got %v", err)
+	}
+}
+
+// TestBFTClientReplicaAheadIsNoEvidence tests that a replica already holding
+// the next write is ignored without being reported as contradicting the
+// result
+func TestBFTClientReplicaAheadIsNoEvidence(t *testing.T) {
+	system := newGeoSystem(t)
+	if _, err := system.SubmitWrite("us-east", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	system.Nodes["G"].Store.Entries["x"] = Entry{Index: 2, Key: "x", Value: "2"}
+
+	client := &BFTClient{System: system, Region: "us-east", F: 1}
+	result, err := client.Read("r1", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Value != "1" || result.Index != 1 || len(result.Evidence) != 0 {
+		t.Errorf("Expected x=1 at index 1 without evidence, got %+v", result)
+	}
+}
@@ -0,0 +1,340 @@
+package bft
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Run reports.
+//
+// The partition simulation ends with a RunReport: the traffic it caused,
+// the writes each commit path settled, the first replica state the nodes
+// disagree on, the safety violations the linearizability checker found,
+// how PBFT, Raft and HotStuff each ordered W1 with the partition in place
+// and healed, with the messages it took them, what every node ended up
+// holding, and a verdict per check with the risks the scenario poses. It
+// is what the narrative's Analysis section prints and what a run hands on
+// to tools, as JSON, or to people, as Markdown, see WriteFile. The headline
+// results are part of it, and so are the expectations the run missed once
+// it is diffed against its scenario's, see Expectations.
+
+// ReportVerdict is the outcome of one check of a run
+type ReportVerdict struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// NodeReport is what a node held at the end of a run
+type NodeReport struct {
+	ID          string `json:"id"`
+	Region      string `json:"region"`
+	Leader      bool   `json:"leader,omitempty"`
+	Byzantine   bool   `json:"byzantine,omitempty"`
+	Reachable   bool   `json:"reachable"`
+	Entries     int    `json:"entries"`      // Keys in its store
+	CommitIndex int64  `json:"commit_index"` // Highest index it applied
+	Heard       int    `json:"heard"`        // Other nodes whose clock it knows
+	Detections  int    `json:"detections"`   // Times it was caught misbehaving
+}
+
+// ProtocolReport is how a consensus protocol ordered W1 over the partitioned
+// or the healed network: whether it committed, which is liveness, where
+// nodes applied different payloads, which is safety, and how many messages
+// it took
+type ProtocolReport struct {
+	Protocol  string   `json:"protocol"`
+	Network   string   `json:"network"` // partitioned or healed
+	Committed bool     `json:"committed"`
+	Executed  []string `json:"executed"` // Nodes that applied W1
+	LatencyMs int64    `json:"latency_ms,omitempty"`
+	Conflicts []uint64 `json:"conflicts,omitempty"` // Indexes nodes applied different payloads at
+	Messages  int      `json:"messages"`            // Consensus messages put on the network
+}
+
+// Outcomes of the writes a run reports
+const (
+	WriteCommitted = "committed"
+	WriteAborted   = "aborted"
+)
+
+// RunReport is the structured outcome of a simulation run
+type RunReport struct {
+	Scenario         string                 `json:"scenario"`
+	Seed             int64                  `json:"seed"`
+	MessagesSent     int                    `json:"messages_sent"`
+	MessagesDropped  int                    `json:"messages_dropped"`
+	BytesOnWire      int64                  `json:"bytes_on_wire"`
+	Commits          map[string]uint64      `json:"commits"`        // By commit path, leader, pbft, raft or hotstuff
+	Writes           map[string]string      `json:"writes"`         // Outcome of each client write, W1 to W3
+	LeaderChanges    int                    `json:"leader_changes"` // Leaders and PBFT primaries replaced
+	Divergence       *Divergence            `json:"divergence,omitempty"`
+	SafetyViolations []string               `json:"safety_violations"`
+	Protocols        []ProtocolReport       `json:"protocols"`
+	Nodes            []NodeReport           `json:"nodes"`
+	Verdicts         []ReportVerdict        `json:"verdicts"`
+	Risks            []string               `json:"risks"` // Why the scenario threatens linearizability
+	Linearizability  *LinearizabilityReport `json:"linearizability,omitempty"`
+	Results          map[string]float64     `json:"results"`
+	Expected         bool                   `json:"expected,omitempty"` // Diffed against expectations, see Expect
+	Mismatches       []ExpectationMismatch  `json:"mismatches,omitempty"`
+	Trace            *Trace                 `json:"-"` // Events of the partitioned system, see WriteChromeTrace
+	counted          map[string]float64     // Traffic and commits in metrics before the run
+}
+
+// newRunReport starts the report of a run counted in metrics, which may
+// have counted others before, filling in its results as the run goes
+func newRunReport(scenario *ScenarioSpec, seed int64, metrics *Metrics, results map[string]float64) *RunReport {
+	r := &RunReport{Scenario: scenario.Name, Seed: seed, Commits: make(map[string]uint64), Writes: make(map[string]string), Results: results, Trace: NewTrace()}
+	r.counted = r.count(metrics)
+	return r
+}
+
+// count returns the traffic and commits metrics counted so far
+func (r *RunReport) count(metrics *Metrics) map[string]float64 {
+	return map[string]float64{
+		"messages_sent":    metrics.Total(metricSent.name),
+		"messages_dropped": metrics.Total(metricDropped.name),
+		"bytes_on_wire":    metrics.Total(metricBytes.name),
+		"leader":           float64(metrics.Commits("leader")),
+		"pbft":             float64(metrics.Commits("pbft")),
+		"raft":             float64(metrics.Commits("raft")),
+		"hotstuff":         float64(metrics.Commits("hotstuff")),
+	}
+}
+
+// observe records the traffic and commits of the run counted in metrics,
+// the traffic also as results, and the state of every node of system at
+// the end of the run
+func (r *RunReport) observe(system *System, metrics *Metrics) {
+	counted := r.count(metrics)
+	for _, result := range []string{"messages_sent", "messages_dropped", "bytes_on_wire"} {
+		r.Results[result] = counted[result] - r.counted[result]
+	}
+	r.MessagesSent = int(r.Results["messages_sent"])
+	r.MessagesDropped = int(r.Results["messages_dropped"])
+	r.BytesOnWire = int64(r.Results["bytes_on_wire"])
+	for _, path := range []string{"leader", "pbft", "raft", "hotstuff"} {
+		r.Commits[path] = uint64(counted[path] - r.counted[path])
+	}
+	r.Divergence = findDivergence(system, 0)
+	r.LeaderChanges = 0
+	for _, event := range r.Trace.Snapshot() {
+		// Appointing the first leader replaces no one
+		if event.Type == EventViewChange && (event.Peer != "" || event.Detail != "leader changed") {
+			r.LeaderChanges++
+		}
+	}
+
+	system.Lock.RLock()
+	defer system.Lock.RUnlock()
+	r.Nodes = r.Nodes[:0]
+	for _, id := range sortedKeys(system.Nodes) {
+		node := system.Nodes[id]
+		report := NodeReport{
+			ID:         id,
+			Region:     node.Region,
+			Leader:     id == system.Leader,
+			Byzantine:  node.IsByzantine,
+			Reachable:  system.reachable(node),
+			Detections: int(metrics.Count(metricDetections.name, id)),
+		}
+		node.Lock.RLock()
+		report.Entries, report.CommitIndex = len(node.Store.Entries), node.Store.CommitIndex
+		for peer, ts := range node.VectorClock.Timestamps() {
+			if peer != id && ts > 0 {
+				report.Heard++
+			}
+		}
+		node.Lock.RUnlock()
+		r.Nodes = append(r.Nodes, report)
+	}
+}
+
+// judge records the verdicts of the linearizability check and of the
+// quorum certificates of the partitioned and healed futures
+func (r *RunReport) judge(check *LinearizabilityReport) {
+	r.Linearizability = check
+	r.SafetyViolations = r.SafetyViolations[:0]
+	for _, v := range check.Violations {
+		r.SafetyViolations = append(r.SafetyViolations, fmt.Sprintf("[%s] %s", v.Key, v.Description))
+	}
+	r.Verdicts = append(r.Verdicts, ReportVerdict{
+		Check:  "linearizability",
+		Passed: check.Verdict == Linearizable,
+		Detail: fmt.Sprintf("%s, %d operations on %d keys", check.Verdict, check.Ops, check.Keys),
+	})
+	for _, future := range []string{"partitioned", "healed"} {
+		verdict := ReportVerdict{Check: "quorum " + future, Detail: "W1 not certified"}
+		if r.Results["quorum_"+future+"_certified"] > 0 {
+			verdict.Passed, verdict.Detail = true, "W1 certified and applied"
+		}
+		r.Verdicts = append(r.Verdicts, verdict)
+	}
+	var protocols []string
+	agreed := make(map[string]bool)
+	outcomes := make(map[string][]string)
+	for _, p := range r.Protocols {
+		if _, seen := agreed[p.Protocol]; !seen {
+			protocols = append(protocols, p.Protocol)
+			agreed[p.Protocol] = true
+		}
+		outcome := "committed"
+		if !p.Committed {
+			outcome = "not committed"
+		}
+		if len(p.Conflicts) > 0 {
+			agreed[p.Protocol] = false
+			outcome += fmt.Sprintf(", conflicting at %v", p.Conflicts)
+		}
+		outcomes[p.Protocol] = append(outcomes[p.Protocol], p.Network+" "+outcome)
+	}
+	for _, protocol := range protocols {
+		r.Verdicts = append(r.Verdicts, ReportVerdict{
+			Check:  "agreement " + protocol,
+			Passed: agreed[protocol],
+			Detail: "W1 " + strings.Join(outcomes[protocol], ", "),
+		})
+	}
+}
+
+// Linearizable reports whether the run's history was found linearizable
+func (r *RunReport) Linearizable() bool {
+	return r.Linearizability != nil && r.Linearizability.Verdict == Linearizable
+}
+
+// String renders the analysis for terminal output
+func (r *RunReport) String() string {
+	var b strings.Builder
+	if r.Linearizability != nil {
+		b.WriteString(r.Linearizability.String())
+	}
+	fmt.Fprintf(&b, "Traffic: %d messages sent, %d dropped, %d bytes\n", r.MessagesSent, r.MessagesDropped, r.BytesOnWire)
+	if r.Divergence != nil {
+		fmt.Fprintf(&b, "First divergence on %s, minority %v\n", r.Divergence.Key, r.Divergence.Minority)
+	}
+	if len(r.Risks) == 0 {
+		if r.Linearizable() {
+			b.WriteString("No partition or Byzantine node threatens it in this scenario\n")
+		}
+		return b.String()
+	}
+	if r.Linearizable() {
+		b.WriteString("This run held up, but it is not guaranteed in this scenario due to:\n")
+	} else {
+		b.WriteString("Reason: Network partition and Byzantine nodes can cause inconsistent views\n")
+		b.WriteString("The system cannot maintain linearizability due to:\n")
+	}
+	for i, risk := range r.Risks {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, risk)
+	}
+	return b.String()
+}
+
+// Markdown renders the report as a Markdown document
+func (r *RunReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Run report: %s, seed %d\n\n", r.Scenario, r.Seed)
+
+	b.WriteString("## Verdicts\n\n| Check | Verdict | Detail |\n|---|---|---|\n")
+	for _, verdict := range r.Verdicts {
+		outcome := "fail"
+		if verdict.Passed {
+			outcome = "pass"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", verdict.Check, outcome, verdict.Detail)
+	}
+
+	if r.Expected {
+		b.WriteString("\n## Expectations\n\n")
+		if len(r.Mismatches) == 0 {
+			b.WriteString("All met.\n")
+		} else {
+			b.WriteString("| Expectation | Expected | Actual |\n|---|---|---|\n")
+		}
+		for _, m := range r.Mismatches {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", m.Expectation, m.Expected, m.Actual)
+		}
+	}
+
+	b.WriteString("\n## Safety violations\n\n")
+	if len(r.SafetyViolations) == 0 {
+		b.WriteString("None found.\n")
+	}
+	for _, violation := range r.SafetyViolations {
+		fmt.Fprintf(&b, "- %s\n", violation)
+	}
+
+	b.WriteString("\n## Protocols\n\n| Protocol | Network | Committed | Executed by | Latency (ms) | Messages | Conflicts |\n|---|---|---|---|---|---|---|\n")
+	for _, p := range r.Protocols {
+		fmt.Fprintf(&b, "| %s | %s | %t | %s | %d | %d | %v |\n", p.Protocol, p.Network, p.Committed, strings.Join(p.Executed, " "), p.LatencyMs, p.Messages, p.Conflicts)
+	}
+
+	b.WriteString("\n## Risks\n\n")
+	if len(r.Risks) == 0 {
+		b.WriteString("No partition or Byzantine node threatens linearizability in this scenario.\n")
+	}
+	for i, risk := range r.Risks {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, risk)
+	}
+
+	b.WriteString("\n## Traffic and commits\n\n")
+	fmt.Fprintf(&b, "- Messages sent: %d\n- Messages dropped: %d\n- Bytes on the wire: %d\n", r.MessagesSent, r.MessagesDropped, r.BytesOnWire)
+	for _, path := range sortedKeys(r.Commits) {
+		fmt.Fprintf(&b, "- Commits via %s: %d\n", path, r.Commits[path])
+	}
+
+	b.WriteString("\n## Divergence\n\n")
+	if d := r.Divergence; d != nil {
+		fmt.Fprintf(&b, "First on `%s`, minority %v:\n\n", d.Key, d.Minority)
+		for _, id := range sortedKeys(d.Values) {
+			value := d.Values[id]
+			if value == "" {
+				value = "(missing)"
+			}
+			fmt.Fprintf(&b, "- %s: %s\n", id, value)
+		}
+	} else {
+		b.WriteString("Replica states agree.\n")
+	}
+
+	b.WriteString("\n## Nodes\n\n| Node | Region | Role | Reachable | Entries | Commit index | Heard from | Detections |\n|---|---|---|---|---|---|---|---|\n")
+	for _, node := range r.Nodes {
+		var roles []string
+		if node.Leader {
+			roles = append(roles, "leader")
+		}
+		if node.Byzantine {
+			roles = append(roles, "Byzantine")
+		}
+		role := strings.Join(roles, ", ")
+		if role == "" {
+			role = "follower"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %t | %d | %d | %d | %d |\n",
+			node.ID, node.Region, role, node.Reachable, node.Entries, node.CommitIndex, node.Heard, node.Detections)
+	}
+
+	b.WriteString("\n## Results\n\n| Result | Value |\n|---|---|\n")
+	for _, key := range sortedKeys(r.Results) {
+		fmt.Fprintf(&b, "| %s | %v |\n", key, r.Results[key])
+	}
+	return b.String()
+}
+
+// WriteFile writes the report to path, as JSON if it ends in .json and as
+// Markdown otherwise
+func (r *RunReport) WriteFile(path string) error {
+	data := []byte(r.Markdown())
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		var err error
+		if data, err = json.MarshalIndent(r, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+	return os.WriteFile(path, data, 0o644)
+}
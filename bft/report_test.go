@@ -0,0 +1,98 @@
+package bft
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunReport tests the report of the default partition scenario
+func TestRunReport(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	report := SimulatePartitionReport(5, nil, nil, nil, nil, nil)
+	if report.Scenario != "partition" || len(report.Nodes) != 7 || len(report.Risks) != 3 {
+		t.Fatalf("Expected 7 nodes and 3 risks of the partition scenario, got %d nodes and %v", len(report.Nodes), report.Risks)
+	}
+	if report.MessagesSent == 0 || float64(report.MessagesSent) != report.Results["messages_sent"] {
+		t.Errorf("Expected the traffic in the report and its results, got %d and %v", report.MessagesSent, report.Results["messages_sent"])
+	}
+	if report.Commits["leader"] == 0 || report.Commits["pbft"] == 0 || report.Commits["raft"] == 0 || report.Commits["hotstuff"] == 0 {
+		t.Errorf("Expected commits on every path, got %v", report.Commits)
+	}
+	if report.Writes["W1"] != WriteCommitted || report.Writes["W2"] != WriteAborted || report.LeaderChanges != 2 {
+		t.Errorf("Expected W1 committed, W2 aborted and the leader and PBFT primary replaced, got %v and %d changes", report.Writes, report.LeaderChanges)
+	}
+	if len(report.SafetyViolations) != int(report.Results["linearizability_violations"]) {
+		t.Errorf("Expected a safety violation per linearizability violation, got %v", report.SafetyViolations)
+	}
+	verdicts := make(map[string]bool)
+	for _, verdict := range report.Verdicts {
+		verdicts[verdict.Check] = verdict.Passed
+	}
+	if verdicts["quorum partitioned"] || !verdicts["quorum healed"] {
+		t.Errorf("Expected a quorum only once healed, got %v", report.Verdicts)
+	}
+	// The majority outside eu-west lets Raft commit where the BFT protocols cannot
+	committed := make(map[string]bool)
+	messages := make(map[string]int)
+	for _, protocol := range report.Protocols {
+		committed[protocol.Protocol+" "+protocol.Network] = protocol.Committed
+		messages[protocol.Protocol+" "+protocol.Network] = protocol.Messages
+	}
+	if len(report.Protocols) != 6 || committed["pbft partitioned"] || committed["hotstuff partitioned"] || !committed["raft partitioned"] ||
+		!committed["pbft healed"] || !committed["raft healed"] || !committed["hotstuff healed"] {
+		t.Errorf("Expected only Raft to commit in the partition, got %+v", report.Protocols)
+	}
+	if messages["hotstuff healed"] == 0 || messages["hotstuff healed"] >= messages["pbft healed"] {
+		t.Errorf("Expected HotStuff to commit with fewer messages than PBFT, got %v", messages)
+	}
+	if !verdicts["agreement pbft"] || !verdicts["agreement raft"] || !verdicts["agreement hotstuff"] {
+		t.Errorf("Expected every protocol to agree on what it applied, got %v", report.Verdicts)
+	}
+	for _, node := range report.Nodes {
+		if node.ID == "A" && !node.Leader || node.ID == "F" && !node.Byzantine || node.ID == "E" && node.Reachable {
+			t.Errorf("Unexpected state of %+v", node)
+		}
+	}
+	markdown := report.Markdown()
+	for _, heading := range []string{"# Run report: partition, seed 5", "## Verdicts", "## Safety violations", "## Protocols", "## Nodes", "| F | ap-south | Byzantine |"} {
+		if !strings.Contains(markdown, heading) {
+			t.Errorf("Expected %q in\n%s", heading, markdown)
+		}
+	}
+}
+
+// TestRunReportWriteFile tests that the extension picks JSON or Markdown
+func TestRunReportWriteFile(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	report := SimulatePartitionReport(5, nil, nil, nil, nil, nil)
+	dir := t.TempDir()
+	for _, name := range []string{"report.json", "report.md"} {
+		if err := report.WriteFile(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded RunReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Seed != 5 || len(decoded.Verdicts) != len(report.Verdicts) || decoded.Results["messages_sent"] != report.Results["messages_sent"] {
+		t.Errorf("Expected the report back from JSON, got %+v", decoded)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "report.md")); string(data) != report.Markdown() {
+		t.Errorf("Expected the Markdown report")
+	}
+}
@@ -0,0 +1,38 @@
+package bft
+
+import "time"
+
+// Resource usage.
+//
+// A run's results say what the protocol did; its resource usage says what
+// simulating it cost, so a change that slows the engine down or makes the
+// protocol chattier shows up next to the correctness results it kept. The
+// traffic, messages sent and dropped and their encoded bytes, comes from
+// the run's metrics and is part of every SimulatePartition result, exact
+// for a seed. CPU time and peak resident memory are read from the process
+// around the run by MeasureResources; they vary from one run to the next
+// and are only known where the platform reports them, on Unix.
+
+// ResourceUsage is what running something cost the process
+type ResourceUsage struct {
+	CPUTime time.Duration `json:"cpu_ns"`         // User and system time spent
+	PeakRSS int64         `json:"peak_rss_bytes"` // The process's high-water mark by the end
+}
+
+// MeasureResources runs fn and returns the CPU time it took and the peak
+// resident memory of the process after it. Like any process counter, the
+// CPU time includes whatever ran concurrently with fn.
+func MeasureResources(fn func()) ResourceUsage {
+	cpu, _ := processUsage()
+	fn()
+	after, peak := processUsage()
+	return ResourceUsage{CPUTime: after - cpu, PeakRSS: peak}
+}
+
+// Results returns the usage for the results exporter
+func (u ResourceUsage) Results() map[string]float64 {
+	return map[string]float64{
+		"cpu_seconds":    u.CPUTime.Seconds(),
+		"peak_rss_bytes": float64(u.PeakRSS),
+	}
+}
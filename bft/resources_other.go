@@ -0,0 +1,10 @@
+//go:build !unix
+
+package bft
+
+import "time"
+
+// processUsage reports nothing on platforms without getrusage
+func processUsage() (time.Duration, int64) {
+	return 0, 0
+}
@@ -0,0 +1,48 @@
+package bft
+
+import (
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestMeasureResources tests that a busy function is charged CPU time and the process a peak RSS
+func TestMeasureResources(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" || runtime.GOOS == "js" || runtime.GOOS == "wasip1" {
+		t.Skip("no getrusage")
+	}
+	usage := MeasureResources(func() {
+		for started := time.Now(); time.Since(started) < 50*time.Millisecond; {
+		}
+	})
+	if usage.CPUTime < 10*time.Millisecond || usage.PeakRSS < 1<<20 {
+		t.Errorf("Expected CPU time and at least a MiB of RSS, got %+v", usage)
+	}
+	results := usage.Results()
+	if results["cpu_seconds"] != usage.CPUTime.Seconds() || results["peak_rss_bytes"] != float64(usage.PeakRSS) {
+		t.Errorf("Expected the usage in the results, got %v", results)
+	}
+}
+
+// TestSimulationTraffic tests that a run's results count only its own traffic
+func TestSimulationTraffic(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	metrics := NewMetrics()
+	first := SimulatePartition(5, nil, nil, nil, nil, metrics)
+	if first["messages_sent"] == 0 || first["bytes_on_wire"] < first["messages_sent"] {
+		t.Errorf("Expected messages and their bytes counted, got %v sent and %v bytes", first["messages_sent"], first["bytes_on_wire"])
+	}
+	if first["messages_sent"] != metrics.Total(metricSent.name) || first["bytes_on_wire"] != metrics.Total(metricBytes.name) {
+		t.Errorf("Expected the results to match the registry")
+	}
+	second := SimulatePartition(5, nil, nil, nil, nil, metrics)
+	for _, key := range []string{"messages_sent", "messages_dropped", "bytes_on_wire"} {
+		if first[key] != second[key] {
+			t.Errorf("Expected the same %s for the same seed on a shared registry, got %v and %v", key, first[key], second[key])
+		}
+	}
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package bft
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processUsage returns the CPU time the process spent so far and its peak
+// resident memory in bytes, zero if the kernel does not say
+func processUsage() (time.Duration, int64) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, 0
+	}
+	cpu := time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	peak := int64(usage.Maxrss)
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		// Everywhere else Maxrss is in kilobytes
+		peak *= 1024
+	}
+	return cpu, peak
+}
@@ -0,0 +1,380 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft/clock"
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario files.
+//
+// A scenario declares the cluster SimulatePartition runs on: the nodes with
+// their regions and faults, the neighbor links clock updates travel over,
+// the one-way latency between regions and the nodes partitioned from the
+// start. Scenarios are JSON or YAML files with the same field names; YAML is
+// picked by the .yaml or .yml extension. A link is bidirectional unless it
+// is marked one-way, in which case only From sends to To. Each direction can
+// be shaped on its own, forward from From to To and reverse back, to be
+// down, drop a share of messages, take its own latency, add jitter or cap
+// its bandwidth, see LinkProfile.
+// A Byzantine node
+// follows the named strategy, see NewStrategy, or the legacy behavior of
+// sending unsigned updates if it names none. Every node tracks causality
+// with the scenario's kind of clock, vector clocks unless it picks hybrid
+// logical clocks, and signs with its signature scheme, ECDSA unless it
+// picks Ed25519. Each node reads its own physical clock, which can be
+// offset and drifting, see SimClock. A timeline scripts faults over time,
+// e.g. "at t=5s partition eu-west", see RunTimeline, and namespaces can be
+// ordered by other consensus engines than the leader, see UseEngine. The
+// scenario is validated in full before any node is created.
+
+var ErrInvalidScenario = errors.New("invalid scenario")
+
+// ScenarioSpec is a cluster topology with its faults
+type ScenarioSpec struct {
+	Name string `json:"name"`
+	// Description is printed under the node list when the scenario runs
+	Description []string               `json:"description,omitempty"`
+	Leader      string                 `json:"leader"`
+	Nodes       []ScenarioNode         `json:"nodes"`
+	Links       []ScenarioLink         `json:"links"`
+	Latencies   []ScenarioLatency      `json:"latencies,omitempty"`
+	Partitioned []string               `json:"partitioned,omitempty"` // Cut off from every other node
+	Clock       clock.ClockKind        `json:"clock,omitempty"`       // Kind of every node's clock, vector if empty
+	Signatures  crypto.SignatureScheme `json:"signatures,omitempty"`  // Scheme every node signs with, ECDSA if empty
+	Timeline    []string               `json:"timeline,omitempty"`    // Faults over time, see RunTimeline
+	Engines     map[string]string      `json:"engines,omitempty"`     // Namespace -> consensus engine, the leader if absent
+}
+
+// ScenarioNode is a node of a scenario
+type ScenarioNode struct {
+	ID        string `json:"id"`
+	Region    string `json:"region"`
+	Byzantine bool   `json:"byzantine,omitempty"`
+	Strategy  string `json:"strategy,omitempty"` // Byzantine nodes only
+	Isolated  bool   `json:"isolated,omitempty"` // Cannot take part in replication
+	// ClockOffsetMs and ClockDriftPPM skew the node's physical clock, see SimClock
+	ClockOffsetMs int     `json:"clock_offset_ms,omitempty"`
+	ClockDriftPPM float64 `json:"clock_drift_ppm,omitempty"`
+}
+
+// ScenarioLink is a neighbor link between two nodes
+type ScenarioLink struct {
+	From    string             `json:"from"`
+	To      string             `json:"to"`
+	OneWay  bool               `json:"one_way,omitempty"`
+	Forward *ScenarioDirection `json:"forward,omitempty"` // From to To
+	Reverse *ScenarioDirection `json:"reverse,omitempty"` // To to From, not on one-way links
+}
+
+// ScenarioDirection shapes one direction of a link
+type ScenarioDirection struct {
+	Down      bool               `json:"down,omitempty"`
+	Drop      float64            `json:"drop,omitempty"`       // Share of messages lost, 0 to 1
+	LatencyMs int                `json:"latency_ms,omitempty"` // The region latency if zero
+	JitterMs  int                `json:"jitter_ms,omitempty"`
+	Jitter    JitterDistribution `json:"jitter,omitempty"`    // Uniform if empty
+	Bandwidth int64              `json:"bandwidth,omitempty"` // Bytes per second, unlimited if zero
+}
+
+// profile returns the direction as a link profile
+func (d *ScenarioDirection) profile() LinkProfile {
+	return LinkProfile{Down: d.Down, Drop: d.Drop, Latency: time.Duration(d.LatencyMs) * time.Millisecond,
+		Jitter: time.Duration(d.JitterMs) * time.Millisecond, JitterDist: d.Jitter, Bandwidth: d.Bandwidth}
+}
+
+// validate checks the direction of the link from one node to another
+func (d *ScenarioDirection) validate(from, to string) error {
+	if d.Drop < 0 || d.Drop > 1 || d.LatencyMs < 0 || d.JitterMs < 0 || d.Bandwidth < 0 {
+		return fmt.Errorf("%w: link %s -> %s needs a drop rate between 0 and 1 and a latency, jitter and bandwidth of at least 0", ErrInvalidScenario, from, to)
+	}
+	if err := validJitter(d.Jitter); err != nil {
+		return fmt.Errorf("%w: link %s -> %s: %v", ErrInvalidScenario, from, to, err)
+	}
+	return nil
+}
+
+// ScenarioLatency is the one-way latency between two regions
+type ScenarioLatency struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	LatencyMs int    `json:"latency_ms"`
+}
+
+// DefaultScenario returns the partition scenario SimulatePartition runs
+// when no scenario file is given
+func DefaultScenario() *ScenarioSpec {
+	return &ScenarioSpec{
+		Name: "partition",
+		Description: []string{
+			"Partition: eu-west (D,E) isolated from us-east",
+			"Node D has unidirectional link: can receive from us-east but not send",
+			"Node E is fully isolated",
+		},
+		Leader: "A",
+		Nodes: []ScenarioNode{
+			{ID: "A", Region: "us-east"},
+			{ID: "B", Region: "us-east"},
+			{ID: "C", Region: "us-east"},
+			{ID: "D", Region: "eu-west", Isolated: true},
+			{ID: "E", Region: "eu-west", Isolated: true},
+			{ID: "F", Region: "ap-south", Byzantine: true, Strategy: "timestamp-inflation"},
+			{ID: "G", Region: "ap-south"},
+		},
+		Links: []ScenarioLink{
+			{From: "A", To: "B"},
+			{From: "A", To: "C"},
+			{From: "A", To: "D", OneWay: true},
+			{From: "B", To: "C"},
+			{From: "B", To: "D", OneWay: true},
+			{From: "C", To: "D", OneWay: true},
+			{From: "D", To: "E"},
+			{From: "F", To: "G"},
+		},
+		Latencies: []ScenarioLatency{
+			{From: "us-east", To: "eu-west", LatencyMs: 40},
+			{From: "us-east", To: "ap-south", LatencyMs: 110},
+			{From: "eu-west", To: "ap-south", LatencyMs: 70},
+		},
+	}
+}
+
+// LoadScenario reads and validates a scenario file. A scenario without a
+// name is named after its file.
+func LoadScenario(path string) (*ScenarioSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// Go through JSON so both formats share the field names
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", path, ErrInvalidScenario, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", path, ErrInvalidScenario, err)
+		}
+	}
+	sc, err := ParseScenario(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return sc, nil
+}
+
+// ParseScenario decodes and validates a JSON scenario
+func ParseScenario(data []byte) (*ScenarioSpec, error) {
+	sc := &ScenarioSpec{}
+	if err := json.Unmarshal(data, sc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidScenario, err)
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// Validate checks the scenario and reports the first problem
+func (sc *ScenarioSpec) Validate() error {
+	if len(sc.Nodes) == 0 {
+		return fmt.Errorf("%w: no nodes", ErrInvalidScenario)
+	}
+	known := make(map[string]bool)
+	for _, node := range sc.Nodes {
+		if node.ID == "" || known[node.ID] {
+			return fmt.Errorf("%w: missing or duplicate node ID %q", ErrInvalidScenario, node.ID)
+		}
+		known[node.ID] = true
+		if node.ClockDriftPPM <= -1e6 {
+			return fmt.Errorf("%w: node %s has a clock drift of %v ppm, which stops or reverses it", ErrInvalidScenario, node.ID, node.ClockDriftPPM)
+		}
+		if node.Strategy == "" {
+			continue
+		}
+		if !node.Byzantine {
+			return fmt.Errorf("%w: honest node %s has strategy %q", ErrInvalidScenario, node.ID, node.Strategy)
+		}
+		if _, err := NewStrategy(node.Strategy, 0); err != nil {
+			return fmt.Errorf("%w: node %s: %v", ErrInvalidScenario, node.ID, err)
+		}
+	}
+	if !known[sc.Leader] {
+		return fmt.Errorf("%w: unknown leader %q", ErrInvalidScenario, sc.Leader)
+	}
+	for _, link := range sc.Links {
+		if !known[link.From] || !known[link.To] || link.From == link.To {
+			return fmt.Errorf("%w: link %s -> %s must join two different nodes", ErrInvalidScenario, link.From, link.To)
+		}
+		if link.OneWay && link.Reverse != nil {
+			return fmt.Errorf("%w: one-way link %s -> %s has no reverse direction", ErrInvalidScenario, link.From, link.To)
+		}
+		if link.Forward != nil {
+			if err := link.Forward.validate(link.From, link.To); err != nil {
+				return err
+			}
+		}
+		if link.Reverse != nil {
+			if err := link.Reverse.validate(link.To, link.From); err != nil {
+				return err
+			}
+		}
+	}
+	for _, latency := range sc.Latencies {
+		if latency.LatencyMs < 0 {
+			return fmt.Errorf("%w: negative latency between %s and %s", ErrInvalidScenario, latency.From, latency.To)
+		}
+	}
+	for _, id := range sc.Partitioned {
+		if !known[id] {
+			return fmt.Errorf("%w: unknown partitioned node %q", ErrInvalidScenario, id)
+		}
+	}
+	if sc.Clock != "" {
+		if _, err := clock.ParseClockKind(string(sc.Clock)); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidScenario, err)
+		}
+	}
+	if _, err := crypto.ParseSignatureScheme(string(sc.Signatures)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidScenario, err)
+	}
+	if _, err := sc.TimelineEvents(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidScenario, err)
+	}
+	for namespace, engine := range sc.Engines {
+		if _, err := NewEngine(engine, nil); err != nil {
+			return fmt.Errorf("%w: namespace %q: %v", ErrInvalidScenario, namespace, err)
+		}
+	}
+	return nil
+}
+
+// Build adds the scenario's nodes to system, links them and applies its
+// latencies, partitions and leader. Strategies draw from seed.
+func (sc *ScenarioSpec) Build(system *System, seed int64) error {
+	if err := sc.Validate(); err != nil {
+		return err
+	}
+	nodes := make(map[string]*Node)
+	for _, spec := range sc.Nodes {
+		node, err := NewNode(spec.ID, spec.Byzantine, spec.Isolated)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", spec.ID, err)
+		}
+		if spec.Strategy != "" {
+			node.Strategy, _ = NewStrategy(spec.Strategy, seed)
+		}
+		if sc.Clock != "" {
+			node.UseClock(sc.Clock)
+		}
+		if sc.Signatures != "" {
+			if err := node.UseSignatureScheme(sc.Signatures); err != nil {
+				return fmt.Errorf("node %s: %w", spec.ID, err)
+			}
+		}
+		node.Region = spec.Region
+		nodes[spec.ID] = node
+	}
+	link := func(from, to string) {
+		for _, neighbor := range nodes[from].Neighbors {
+			if neighbor == to {
+				return
+			}
+		}
+		nodes[from].Neighbors = append(nodes[from].Neighbors, to)
+	}
+	for _, l := range sc.Links {
+		link(l.From, l.To)
+		if !l.OneWay {
+			link(l.To, l.From)
+		}
+	}
+	for _, spec := range sc.Nodes {
+		system.AddNode(nodes[spec.ID])
+		if spec.ClockOffsetMs != 0 || spec.ClockDriftPPM != 0 {
+			offset := time.Duration(spec.ClockOffsetMs) * time.Millisecond
+			if err := system.SetClockSkew(spec.ID, offset, spec.ClockDriftPPM/1e6); err != nil {
+				return err
+			}
+		}
+	}
+	for _, l := range sc.Links {
+		if l.Forward != nil {
+			system.SetLinkProfile(l.From, l.To, l.Forward.profile())
+		}
+		if l.Reverse != nil {
+			system.SetLinkProfile(l.To, l.From, l.Reverse.profile())
+		}
+	}
+	for _, latency := range sc.Latencies {
+		system.SetRegionLatency(latency.From, latency.To, time.Duration(latency.LatencyMs)*time.Millisecond)
+	}
+	for _, id := range sc.Partitioned {
+		system.SetPartition(id, true)
+	}
+	system.SetLeader(sc.Leader)
+	for _, namespace := range sortedKeys(sc.Engines) {
+		if err := system.UseEngine(namespace, sc.Engines[namespace]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Regions returns the scenario's nodes grouped by region, e.g.
+// "A,B (us-east), C (eu-west)", regions in order of first appearance
+func (sc *ScenarioSpec) Regions() string {
+	var regions []string
+	members := make(map[string][]string)
+	for _, node := range sc.Nodes {
+		if _, seen := members[node.Region]; !seen {
+			regions = append(regions, node.Region)
+		}
+		members[node.Region] = append(members[node.Region], node.ID)
+	}
+	groups := make([]string, len(regions))
+	for i, region := range regions {
+		groups[i] = fmt.Sprintf("%s (%s)", strings.Join(members[region], ","), region)
+	}
+	return strings.Join(groups, ", ")
+}
+
+// CutOff returns the nodes that start isolated or partitioned, in scenario
+// order
+func (sc *ScenarioSpec) CutOff() []string {
+	partitioned := make(map[string]bool)
+	for _, id := range sc.Partitioned {
+		partitioned[id] = true
+	}
+	var ids []string
+	for _, node := range sc.Nodes {
+		if node.Isolated || partitioned[node.ID] {
+			ids = append(ids, node.ID)
+		}
+	}
+	return ids
+}
+
+// Heal reconnects the scenario's cut-off nodes in system
+func (sc *ScenarioSpec) Heal(system *System) {
+	healed := sc.CutOff()
+	for _, id := range healed {
+		system.Nodes[id].IsIsolated = false
+		system.SetPartition(id, false)
+	}
+	if len(healed) > 0 {
+		system.Hooks.Fire(HookEvent{Kind: HookHeal, View: system.View, Detail: fmt.Sprintf("%v reconnected", healed)})
+	}
+}
@@ -0,0 +1,155 @@
+package bft
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fernandokarnagi/wahello/bft/clock"
+)
+
+// TestLoadScenarioYAML tests that the sample YAML file declares the built-in scenario
+func TestLoadScenarioYAML(t *testing.T) {
+	scenario, err := LoadScenario("../docs/scenarios/partition.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scenario, DefaultScenario()) {
+		t.Errorf("Expected the default scenario, got %+v", scenario)
+	}
+}
+
+// TestLoadScenarioJSON tests that a JSON scenario builds its links, latencies and partitions
+func TestLoadScenarioJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring.json")
+	os.WriteFile(path, []byte(`{
+		"leader": "A",
+		"nodes": [
+			{"id": "A", "region": "r1"},
+			{"id": "B", "region": "r1"},
+			{"id": "C", "region": "r2", "byzantine": true, "strategy": "replay"},
+			{"id": "D", "region": "r2"}
+		],
+		"links": [{"from": "A", "to": "B"}, {"from": "B", "to": "C", "one_way": true}, {"from": "C", "to": "D"}],
+		"latencies": [{"from": "r1", "to": "r2", "latency_ms": 25}],
+		"partitioned": ["D"]
+	}`), 0o644)
+	scenario, err := LoadScenario(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scenario.Name != "ring" || scenario.Regions() != "A,B (r1), C,D (r2)" {
+		t.Errorf("Expected the ring scenario over r1 and r2, got %q: %s", scenario.Name, scenario.Regions())
+	}
+
+	system := NewSystem()
+	if err := scenario.Build(system, 1); err != nil {
+		t.Fatal(err)
+	}
+	neighbors := map[string][]string{}
+	for id, node := range system.Nodes {
+		neighbors[id] = node.Neighbors
+	}
+	expected := map[string][]string{"A": {"B"}, "B": {"A", "C"}, "C": {"D"}, "D": {"C"}}
+	if !reflect.DeepEqual(neighbors, expected) {
+		t.Errorf("Expected neighbors %v, got %v", expected, neighbors)
+	}
+	if system.GetLeader() != "A" || !system.IsPartitioned("D") || system.RegionLatency("r2", "r1").Milliseconds() != 25 {
+		t.Errorf("Expected leader A, D partitioned and 25ms between regions")
+	}
+	if _, ok := system.Nodes["C"].Strategy.(*Replay); !ok {
+		t.Errorf("Expected C to replay, got %T", system.Nodes["C"].Strategy)
+	}
+
+	scenario.Heal(system)
+	if system.IsPartitioned("D") {
+		t.Errorf("Expected healing to reconnect D")
+	}
+}
+
+// TestScenarioValidation tests that inconsistent scenarios are rejected
+func TestScenarioValidation(t *testing.T) {
+	for _, data := range []string{
+		`{"leader": "A"}`,
+		`{"leader": "A", "nodes": [{"id": "A"}, {"id": "A"}]}`,
+		`{"leader": "B", "nodes": [{"id": "A"}]}`,
+		`{"leader": "A", "nodes": [{"id": "A"}], "links": [{"from": "A", "to": "Z"}]}`,
+		`{"leader": "A", "nodes": [{"id": "A", "strategy": "replay"}]}`,
+		`{"leader": "A", "nodes": [{"id": "A", "byzantine": true, "strategy": "silence"}]}`,
+		`{"leader": "A", "nodes": [{"id": "A"}], "partitioned": ["B"]}`,
+		`{"leader": "A", "nodes": [{"id": "A"}], "latencies": [{"from": "x", "to": "y", "latency_ms": -1}]}`,
+		`{"leader": 1}`,
+	} {
+		if _, err := ParseScenario([]byte(data)); !errors.Is(err, ErrInvalidScenario) {
+			t.Errorf("Expected %s to be invalid, got %v", data, err)
+		}
+	}
+}
+
+// TestSimulatePartitionScenario tests that the partition simulation runs on a scenario of any size
+func TestSimulatePartitionScenario(t *testing.T) {
+	scenario := &ScenarioSpec{
+		Name:   "small",
+		Leader: "A",
+		Nodes: []ScenarioNode{
+			{ID: "A", Region: "us-east"},
+			{ID: "B", Region: "us-east"},
+			{ID: "C", Region: "eu-west"},
+			{ID: "D", Region: "eu-west", Isolated: true},
+		},
+		Links: []ScenarioLink{{From: "A", To: "B"}, {From: "A", To: "C"}, {From: "C", To: "D"}},
+	}
+	results := SimulatePartition(1, scenario, nil, nil, nil, nil)
+	if results["writes_committed"] != 2 || results["writes_rejected"] != 1 {
+		t.Errorf("Expected W1 and W3 to commit and W2 on D to be rejected, got %v", results)
+	}
+	if results["pbft_healed_executed"] != 4 {
+		t.Errorf("Expected PBFT to run on all four nodes once healed, got %v", results)
+	}
+}
+
+// TestScenarioHLC tests that a scenario can give its nodes hybrid logical clocks
+func TestScenarioHLC(t *testing.T) {
+	scenario, err := ParseScenario([]byte(`{
+		"leader": "A",
+		"nodes": [{"id": "A"}, {"id": "B"}],
+		"links": [{"from": "A", "to": "B"}],
+		"clock": "hlc"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := NewSystem()
+	if err := scenario.Build(system, 1); err != nil {
+		t.Fatal(err)
+	}
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	if _, ok := b.VectorClock.(*clock.HLC); !ok {
+		t.Fatalf("Expected B to use an HLC, got %T", b.VectorClock)
+	}
+
+	// A's physical clock steps back after its first update
+	physical := int64(100)
+	a.Clock = func() int64 { return physical }
+	first := a.GetClockUpdate()
+	physical = 90
+	second := a.GetClockUpdate()
+	if first.Timestamp != 100 || second.Timestamp != 100 {
+		t.Errorf("Expected A's HLC to keep its timestamps at 100, got %d then %d", first.Timestamp, second.Timestamp)
+	}
+	a.PropagateClockUpdate(second, system)
+	if b.VectorClock.GetTimestamp("A") != 100 {
+		t.Errorf("Expected B to record A's timestamp, got %v", b.VectorClock.Timestamps())
+	}
+
+	clone := system.Clone()
+	if hlc, ok := clone.Nodes["A"].VectorClock.(*clock.HLC); !ok || hlc.Latest() != a.VectorClock.(*clock.HLC).Latest() {
+		t.Errorf("Expected the clone to copy A's HLC")
+	}
+
+	if _, err := ParseScenario([]byte(`{"leader": "A", "nodes": [{"id": "A"}], "clock": "lamport"}`)); !errors.Is(err, ErrInvalidScenario) {
+		t.Errorf("Expected an unknown clock kind to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package bft
+
+import (
+	"container/heap"
+	"math/rand"
+	"time"
+)
+
+// Discrete-event simulation.
+//
+// A Scheduler owns the simulated time of a run. Work is scheduled as events
+// at a virtual time, and Run pops them in order of time and then of
+// scheduling, sets Now and runs them, so a schedule always executes the same
+// way. A system with a scheduler attached takes every time and randomness
+// source from it: node clocks, trace, history and capture timestamps, the
+// cost of signing and network jitter, which the seeded RNG draws. Clock
+// update deliveries, PBFT messages and view timers, and scheduled faults
+// are all events. Nothing then depends on the wall clock, and a run is
+// reproduced exactly by its seed. ECDSA signatures stay randomized, which is
+// why trace comparisons ignore them. A Watchdog, see watchdog.go, stops a run that
+// no longer makes progress.
+
+// SimulationEpoch is the wall-clock time that virtual time zero stands for
+var SimulationEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SimulatedSignCost is what signing costs in virtual time
+const SimulatedSignCost = 50 * time.Microsecond
+
+// event is work scheduled at a virtual time
+type event struct {
+	at      time.Duration
+	order   uint64 // Scheduling order, breaks ties between equal times
+	label   string // What the event is, for diagnostics
+	message bool   // A message in flight rather than a timer
+	run     func()
+}
+
+// eventQueue orders events by time, then by scheduling order
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].order < q[j].order
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(event)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// Scheduler runs events in virtual time order
+type Scheduler struct {
+	Seed     int64
+	Now      time.Duration // Virtual time of the running or last event
+	Rand     *rand.Rand    // Seeded from Seed, the only randomness of a run
+	Jitter   time.Duration // Upper bound of the random delay added to messages
+	Executed uint64        // Events run so far
+	OnStep   func()        // Called after every event, to report progress say
+	Watchdog *Watchdog     // Fails the run when it stops making progress, see Watch
+	queue    eventQueue
+	order    uint64
+	progress time.Duration // Virtual time of the last progress
+	err      error         // Why the run stopped early
+}
+
+// NewScheduler creates a scheduler at virtual time zero
+func NewScheduler(seed int64) *Scheduler {
+	return &Scheduler{Seed: seed, Rand: rand.New(rand.NewSource(seed))}
+}
+
+// At schedules fn at virtual time at, or now if at has passed
+func (s *Scheduler) At(at time.Duration, fn func()) {
+	s.schedule(at, "", false, fn)
+}
+
+// schedule queues an event, described by label, at virtual time at or now
+// if at has passed
+func (s *Scheduler) schedule(at time.Duration, label string, message bool, fn func()) {
+	if at < s.Now {
+		at = s.Now
+	}
+	s.order++
+	heap.Push(&s.queue, event{at: at, order: s.order, label: label, message: message, run: fn})
+}
+
+// After schedules fn d past the current virtual time
+func (s *Scheduler) After(d time.Duration, fn func()) {
+	s.At(s.Now+d, fn)
+}
+
+// Timer schedules fn d past the current virtual time like After, described
+// by label in diagnostics
+func (s *Scheduler) Timer(d time.Duration, label string, fn func()) {
+	s.schedule(s.Now+d, label, false, fn)
+}
+
+// Deliver schedules the arrival of a message, described by label, sent now
+// over a link with the given latency, plus jitter, and returns the arrival
+// time
+func (s *Scheduler) Deliver(latency time.Duration, label string, fn func()) time.Duration {
+	if s.Jitter > 0 {
+		latency += time.Duration(s.Rand.Int63n(int64(s.Jitter)))
+	}
+	s.schedule(s.Now+latency, label, true, fn)
+	return s.Now + latency
+}
+
+// Pending returns the number of scheduled events
+func (s *Scheduler) Pending() int {
+	return s.queue.Len()
+}
+
+// Step runs the next event and reports whether there was one. A run the
+// watchdog finds stalled is abandoned: its events are dropped and nothing
+// runs until the next Watch.
+func (s *Scheduler) Step() bool {
+	if s.queue.Len() == 0 || s.err != nil {
+		return false
+	}
+	if w := s.Watchdog; w != nil && s.queue[0].at-s.progress > w.window() {
+		s.err = w.stall(s, StallLivelock)
+		s.queue = nil
+		return false
+	}
+	next := heap.Pop(&s.queue).(event)
+	s.Now = next.at
+	s.Executed++
+	next.run()
+	if s.OnStep != nil {
+		s.OnStep()
+	}
+	return true
+}
+
+// Run runs events, including those they schedule, until none are left or
+// the watchdog finds the run stalled, and returns the watchdog's report
+func (s *Scheduler) Run() error {
+	for s.Step() {
+	}
+	if w := s.Watchdog; s.err == nil && w != nil && w.Busy != nil && w.Busy() {
+		s.err = w.stall(s, StallDeadlock)
+	}
+	return s.err
+}
+
+// Progress tells the watchdog the run made progress now
+func (s *Scheduler) Progress() {
+	s.progress = s.Now
+}
+
+// Err returns why the watchdog stopped the run, or nil
+func (s *Scheduler) Err() error {
+	return s.err
+}
+
+// RunUntil runs the events up to virtual time t and then moves the clock to t
+func (s *Scheduler) RunUntil(t time.Duration) {
+	for s.queue.Len() > 0 && s.queue[0].at <= t {
+		s.Step()
+	}
+	if t > s.Now {
+		s.Now = t
+	}
+}
+
+// Time returns the wall-clock time the current virtual time stands for
+func (s *Scheduler) Time() time.Time {
+	return SimulationEpoch.Add(s.Now)
+}
+
+// Elapsed returns a time source reading the virtual time
+func (s *Scheduler) Elapsed() func() time.Duration {
+	return func() time.Duration { return s.Now }
+}
+
+// Clock returns a node timestamp source: Unix seconds of the virtual time
+func (s *Scheduler) Clock() func() int64 {
+	return func() int64 { return s.Time().Unix() }
+}
+
+// UseScheduler runs the system on sched: nodes without a clock of their own
+// and nodes added later read virtual time, and so do the trace, history and
+// packet capture attached now
+func (s *System) UseScheduler(sched *Scheduler) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.Scheduler = sched
+	for _, node := range s.Nodes {
+		if node.SimClock != nil {
+			// Skew and drift carry over to virtual time
+			node.SimClock = NewSimClock(sched.Time, node.SimClock.Offset, node.SimClock.Drift)
+			node.Clock = node.SimClock.Unix
+		}
+		if node.Clock == nil {
+			node.Clock = sched.Clock()
+		}
+	}
+	if s.Trace != nil {
+		s.Trace.Now = sched.Elapsed()
+	}
+	if s.History != nil {
+		s.History.Now = sched.Elapsed()
+	}
+	if s.Capture != nil {
+		s.Capture.Now = sched.Elapsed()
+	}
+}
+
+// now returns the wall-clock time, or the virtual one under a scheduler
+func (s *System) now() time.Time {
+	if s.Scheduler != nil {
+		return s.Scheduler.Time()
+	}
+	return time.Now()
+}
+
+// ScheduleFault schedules a fault step as events: it is injected step.At
+// periods from now and reverted step.Duration periods later, if at all.
+// Errors of either go to onError, if set.
+func (s *System) ScheduleFault(step FaultStep, period time.Duration, onError func(error)) {
+	report := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	start := s.Scheduler.Now
+	s.Scheduler.At(start+time.Duration(step.At)*period, func() { report(s.ApplyFault(step)) })
+	if step.Duration > 0 {
+		round := step.At + step.Duration
+		s.Scheduler.At(start+time.Duration(round)*period, func() { report(s.RevertFault(step, round)) })
+	}
+}
@@ -0,0 +1,141 @@
+package bft
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestSchedulerOrder tests that events run by time, then in scheduling order
+func TestSchedulerOrder(t *testing.T) {
+	scheduler := NewScheduler(1)
+	var order []string
+	record := func(name string) func() {
+		return func() { order = append(order, name+"@"+scheduler.Now.String()) }
+	}
+	scheduler.At(20*time.Millisecond, record("late"))
+	scheduler.At(10*time.Millisecond, record("first"))
+	scheduler.At(10*time.Millisecond, func() {
+		record("second")()
+		// The past is not reachable, so this runs right after
+		scheduler.At(0, record("past"))
+	})
+	scheduler.RunUntil(15 * time.Millisecond)
+
+	expected := []string{"first@10ms", "second@10ms", "past@10ms"}
+	if !reflect.DeepEqual(order, expected) || scheduler.Now != 15*time.Millisecond || scheduler.Pending() != 1 {
+		t.Errorf("Expected %v at 15ms with one event left, got %v at %v", expected, order, scheduler.Now)
+	}
+	scheduler.Run()
+	if len(order) != 4 || scheduler.Executed != 4 || scheduler.Time() != SimulationEpoch.Add(20*time.Millisecond) {
+		t.Errorf("Expected the late event to run at 20ms, got %v at %v", order, scheduler.Now)
+	}
+}
+
+// TestSchedulerJitter tests that jitter is bounded and drawn from the seed
+func TestSchedulerJitter(t *testing.T) {
+	arrivals := func(seed int64) []time.Duration {
+		scheduler := NewScheduler(seed)
+		scheduler.Jitter = 5 * time.Millisecond
+		var at []time.Duration
+		for i := 0; i < 10; i++ {
+			at = append(at, scheduler.Deliver(10*time.Millisecond, "ping", func() {}))
+		}
+		return at
+	}
+	first := arrivals(3)
+	if !reflect.DeepEqual(first, arrivals(3)) {
+		t.Errorf("Expected the same seed to draw the same arrivals")
+	}
+	if reflect.DeepEqual(first, arrivals(4)) {
+		t.Errorf("Expected another seed to draw other arrivals")
+	}
+	for _, at := range first {
+		if at < 10*time.Millisecond || at >= 15*time.Millisecond {
+			t.Errorf("Expected arrivals within the jitter, got %v", at)
+		}
+	}
+}
+
+// TestSchedulerPropagation tests that clock updates arrive after the link latency in virtual time
+func TestSchedulerPropagation(t *testing.T) {
+	system := newFaultSystem(t)
+	system.Trace = NewTrace()
+	system.Nodes["A"].Neighbors = []string{"B", "G"}
+	system.Nodes["G"].Region = "ap-south"
+	system.SetRegionLatency("", "ap-south", 100*time.Millisecond)
+	scheduler := NewScheduler(1)
+	system.UseScheduler(scheduler)
+
+	system.Nodes["A"].PropagateClockUpdate(system.Nodes["A"].GetClockUpdate(), system)
+	if system.Nodes["B"].VectorClock.Len() != 0 || scheduler.Pending() != 2 {
+		t.Fatalf("Expected both deliveries to be in flight, %d events pending", scheduler.Pending())
+	}
+	// G is partitioned while its update is in flight
+	scheduler.After(50*time.Millisecond, func() { system.SetPartition("G", true) })
+	scheduler.Run()
+
+	epoch := SimulationEpoch.Unix()
+	if got := system.Nodes["B"].VectorClock.Timestamps()["A"]; got != epoch {
+		t.Errorf("Expected B to hold A's virtual timestamp %d, got %d", epoch, got)
+	}
+	if system.Nodes["G"].VectorClock.Len() != 0 {
+		t.Errorf("Expected the update to G to be lost")
+	}
+	var applied []time.Duration
+	for _, event := range system.Trace.Snapshot() {
+		if event.Type == EventApply {
+			applied = append(applied, event.At)
+		}
+	}
+	if !reflect.DeepEqual(applied, []time.Duration{LocalLatency}) {
+		t.Errorf("Expected one apply after %v of virtual time, got %v", LocalLatency, applied)
+	}
+
+	node, _ := NewNode("H", false, false)
+	system.AddNode(node)
+	if node.GetClockUpdate().Timestamp != epoch {
+		t.Errorf("Expected a node added later to read virtual time")
+	}
+}
+
+// TestScheduleFault tests that a scheduled crash is injected and reverted at its virtual times
+func TestScheduleFault(t *testing.T) {
+	system := newFaultSystem(t)
+	scheduler := NewScheduler(1)
+	system.UseScheduler(scheduler)
+	system.ScheduleFault(FaultStep{At: 2, Kind: FaultCrash, Nodes: []string{"C"}, Duration: 3}, time.Second, func(err error) {
+		t.Errorf("Expected the fault to apply, got %v", err)
+	})
+
+	scheduler.RunUntil(time.Second)
+	if system.IsFenced("C") {
+		t.Errorf("Expected C to be up after 1s")
+	}
+	scheduler.RunUntil(2 * time.Second)
+	if !system.IsFenced("C") || !system.Fenced["C"].At.Equal(SimulationEpoch.Add(2*time.Second)) {
+		t.Errorf("Expected C to crash at 2s of virtual time, got %+v", system.Fenced["C"])
+	}
+	scheduler.Run()
+	if system.IsFenced("C") || scheduler.Now != 5*time.Second {
+		t.Errorf("Expected C to restart at 5s, now %v", scheduler.Now)
+	}
+
+	var failed error
+	system.ScheduleFault(FaultStep{Kind: FaultCrash, Nodes: []string{"Z"}}, time.Second, func(err error) { failed = err })
+	scheduler.Run()
+	if failed == nil {
+		t.Errorf("Expected a fault on an unknown node to be reported")
+	}
+}
+
+// TestSimulatePartitionReproducible tests that a seed reproduces the partition scenario
+func TestSimulatePartitionReproducible(t *testing.T) {
+	first := SimulatePartition(5, nil, nil, nil, nil, nil)
+	if len(first) == 0 || first["pbft_recovery_ms"] == 0 {
+		t.Fatalf("Expected the scenario to report its results, got %v", first)
+	}
+	if second := SimulatePartition(5, nil, nil, nil, nil, nil); !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected the same seed to reproduce %v, got %v", first, second)
+	}
+}
@@ -0,0 +1,341 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Wire schema versions and compatibility.
+//
+// During a rolling upgrade nodes one version apart exchange messages, so
+// every message's version N encoder must be readable by the N-1 and N+1
+// decoders and vice versa. Each version of a message's wire format is
+// registered as a WireSchema; the compatibility matrix encodes sample
+// messages with every version and decodes them with every version at most
+// one apart, and any mismatch or decode error fails the cell. A change that
+// would break a mixed-version cluster shows up in the matrix before it
+// ships.
+//
+// The discipline that keeps the matrix green is that readers learn a new
+// format one version before writers use it: member-update v2 decodes state
+// names but still writes numbers.
+
+var (
+	ErrSchemaRegistered = errors.New("schema version already registered")
+	ErrSchemaVersion    = errors.New("unsupported schema version")
+)
+
+// WireSchema is one version of a message's wire format
+type WireSchema struct {
+	Message string
+	Version int
+	Encode  func(msg interface{}) ([]byte, error)
+	Decode  func(data []byte) (interface{}, error)
+}
+
+var (
+	schemas       = map[string]map[int]WireSchema{}
+	schemaSamples = map[string][]interface{}{}
+)
+
+// RegisterSchema adds a message format version along with sample messages
+// used to check it
+func RegisterSchema(schema WireSchema, samples ...interface{}) error {
+	if schemas[schema.Message] == nil {
+		schemas[schema.Message] = make(map[int]WireSchema)
+	}
+	if _, exists := schemas[schema.Message][schema.Version]; exists {
+		return fmt.Errorf("%w: %s v%d", ErrSchemaRegistered, schema.Message, schema.Version)
+	}
+	schemas[schema.Message][schema.Version] = schema
+	schemaSamples[schema.Message] = append(schemaSamples[schema.Message], samples...)
+	return nil
+}
+
+// WireSchemas returns the registered schemas ordered by message and version
+func WireSchemas() []WireSchema {
+	var all []WireSchema
+	for _, message := range sortedKeys(schemas) {
+		for _, schema := range schemas[message] {
+			all = append(all, schema)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Message != all[j].Message {
+			return all[i].Message < all[j].Message
+		}
+		return all[i].Version < all[j].Version
+	})
+	return all
+}
+
+// SchemaSamples returns the sample messages registered for each message
+func SchemaSamples() map[string][]interface{} {
+	return schemaSamples
+}
+
+// CompatCell is the result of decoding one version's output with another
+type CompatCell struct {
+	Message string
+	Encoder int
+	Decoder int
+	Err     error
+}
+
+// CompatMatrix holds the cells for every version pair at most one apart
+type CompatMatrix struct {
+	Cells []CompatCell
+}
+
+// CheckCompatibility builds the matrix for the given schemas and samples
+func CheckCompatibility(all []WireSchema, samples map[string][]interface{}) *CompatMatrix {
+	byMessage := make(map[string][]WireSchema)
+	for _, schema := range all {
+		byMessage[schema.Message] = append(byMessage[schema.Message], schema)
+	}
+	matrix := &CompatMatrix{}
+	for _, message := range sortedKeys(byMessage) {
+		versions := byMessage[message]
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+		for _, encoder := range versions {
+			for _, decoder := range versions {
+				if diff := encoder.Version - decoder.Version; diff < -1 || diff > 1 {
+					continue
+				}
+				matrix.Cells = append(matrix.Cells, CompatCell{
+					Message: message,
+					Encoder: encoder.Version,
+					Decoder: decoder.Version,
+					Err:     roundTrip(encoder, decoder, samples[message]),
+				})
+			}
+		}
+	}
+	return matrix
+}
+
+// roundTrip encodes every sample with one schema and decodes it with another
+func roundTrip(encoder, decoder WireSchema, samples []interface{}) error {
+	for i, sample := range samples {
+		data, err := encoder.Encode(sample)
+		if err != nil {
+			return fmt.Errorf("sample %d: encode: %w", i, err)
+		}
+		decoded, err := decoder.Decode(data)
+		if err != nil {
+			return fmt.Errorf("sample %d: decode %s: %w", i, data, err)
+		}
+		if !reflect.DeepEqual(decoded, sample) {
+			return fmt.Errorf("sample %d: decoded %+v, want %+v", i, decoded, sample)
+		}
+	}
+	return nil
+}
+
+// Failures returns the cells that did not round-trip
+func (m *CompatMatrix) Failures() []CompatCell {
+	var failed []CompatCell
+	for _, cell := range m.Cells {
+		if cell.Err != nil {
+			failed = append(failed, cell)
+		}
+	}
+	return failed
+}
+
+// String renders a table per message with a row per encoder version and a
+// column per decoder version. Pairs more than one version apart show "-".
+func (m *CompatMatrix) String() string {
+	cells := make(map[string]map[[2]int]error)
+	versions := make(map[string]map[int]bool)
+	for _, cell := range m.Cells {
+		if cells[cell.Message] == nil {
+			cells[cell.Message] = make(map[[2]int]error)
+			versions[cell.Message] = make(map[int]bool)
+		}
+		cells[cell.Message][[2]int{cell.Encoder, cell.Decoder}] = cell.Err
+		versions[cell.Message][cell.Encoder] = true
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, message := range sortedKeys(cells) {
+		var ordered []int
+		for version := range versions[message] {
+			ordered = append(ordered, version)
+		}
+		sort.Ints(ordered)
+		header := []string{message}
+		for _, decoder := range ordered {
+			header = append(header, fmt.Sprintf("v%d", decoder))
+		}
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, encoder := range ordered {
+			row := []string{fmt.Sprintf("  v%d ->", encoder)}
+			for _, decoder := range ordered {
+				err, checked := cells[message][[2]int{encoder, decoder}]
+				switch {
+				case !checked:
+					row = append(row, "-")
+				case err != nil:
+					row = append(row, "FAIL")
+				default:
+					row = append(row, "ok")
+				}
+			}
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+	}
+	w.Flush()
+	for _, cell := range m.Failures() {
+		fmt.Fprintf(&b, "%s v%d -> v%d: %v\n", cell.Message, cell.Encoder, cell.Decoder, cell.Err)
+	}
+	return b.String()
+}
+
+// CompatCommand prints the compatibility matrix of the registered schemas
+// and fails if any cell does
+func CompatCommand(args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: compat")
+	}
+	matrix := CheckCompatibility(WireSchemas(), SchemaSamples())
+	fmt.Fprint(out, matrix)
+	if failed := matrix.Failures(); len(failed) > 0 {
+		return fmt.Errorf("%d incompatible version pairs", len(failed))
+	}
+	return nil
+}
+
+// clockUpdateWire is the wire form of a ClockUpdate. V is absent in v1.
+type clockUpdateWire struct {
+	V         int    `json:"v,omitempty"`
+	NodeID    string `json:"node"`
+	Timestamp int64  `json:"ts"`
+	Signature string `json:"sig"`
+}
+
+// memberUpdateWire is the wire form of a MemberUpdate. State is a number;
+// from v2 decoders also accept the state's name.
+type memberUpdateWire struct {
+	V           int             `json:"v,omitempty"`
+	ID          string          `json:"id"`
+	State       json.RawMessage `json:"state"`
+	Incarnation uint64          `json:"inc"`
+}
+
+// decodeMemberState parses a numeric state, or a named one if names is set
+func decodeMemberState(raw json.RawMessage, names bool) (MemberState, error) {
+	var n int
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return MemberState(n), nil
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil || !names {
+		return 0, fmt.Errorf("%w: state %s", ErrSchemaVersion, raw)
+	}
+	for _, state := range []MemberState{MemberAlive, MemberSuspect, MemberDead} {
+		if state.String() == name {
+			return state, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown member state %q", name)
+}
+
+// clockUpdateSchema returns clock-update at version; v2 adds the version field
+func clockUpdateSchema(version int) WireSchema {
+	return WireSchema{
+		Message: "clock-update",
+		Version: version,
+		Encode: func(msg interface{}) ([]byte, error) {
+			u := msg.(ClockUpdate)
+			wire := clockUpdateWire{NodeID: u.NodeID, Timestamp: u.Timestamp, Signature: u.Signature}
+			if version >= 2 {
+				wire.V = version
+			}
+			return json.Marshal(wire)
+		},
+		Decode: func(data []byte) (interface{}, error) {
+			var wire clockUpdateWire
+			if err := json.Unmarshal(data, &wire); err != nil {
+				return nil, err
+			}
+			if wire.V > version+1 {
+				return nil, fmt.Errorf("%w: v%d", ErrSchemaVersion, wire.V)
+			}
+			return ClockUpdate{NodeID: wire.NodeID, Timestamp: wire.Timestamp, Signature: wire.Signature}, nil
+		},
+	}
+}
+
+// memberUpdateSchema returns member-update at version; v2 decodes state names
+func memberUpdateSchema(version int) WireSchema {
+	return WireSchema{
+		Message: "member-update",
+		Version: version,
+		Encode: func(msg interface{}) ([]byte, error) {
+			u := msg.(MemberUpdate)
+			state, _ := json.Marshal(int(u.State))
+			wire := memberUpdateWire{ID: u.ID, State: state, Incarnation: u.Incarnation}
+			if version >= 2 {
+				wire.V = version
+			}
+			return json.Marshal(wire)
+		},
+		Decode: func(data []byte) (interface{}, error) {
+			var wire memberUpdateWire
+			if err := json.Unmarshal(data, &wire); err != nil {
+				return nil, err
+			}
+			state, err := decodeMemberState(wire.State, version >= 2)
+			if err != nil {
+				return nil, err
+			}
+			return MemberUpdate{ID: wire.ID, State: state, Incarnation: wire.Incarnation}, nil
+		},
+	}
+}
+
+// requestPayloadSchema is the client request payload, decoded strictly
+var requestPayloadSchema = WireSchema{
+	Message: "request-payload",
+	Version: 1,
+	Encode: func(msg interface{}) ([]byte, error) {
+		return json.Marshal(msg.(RequestPayload))
+	},
+	Decode: func(data []byte) (interface{}, error) {
+		payload, err := DecodePayload(data)
+		if err != nil {
+			return nil, err
+		}
+		return *payload, nil
+	},
+}
+
+func init() {
+	clockSamples := []interface{}{
+		ClockUpdate{NodeID: "A", Timestamp: 42, Signature: "3045022100ab"},
+		ClockUpdate{NodeID: "B"},
+	}
+	RegisterSchema(clockUpdateSchema(1), clockSamples...)
+	RegisterSchema(clockUpdateSchema(2))
+
+	memberSamples := []interface{}{
+		MemberUpdate{ID: "A", State: MemberAlive},
+		MemberUpdate{ID: "B", State: MemberSuspect, Incarnation: 3},
+		MemberUpdate{ID: "C", State: MemberDead, Incarnation: 7},
+	}
+	RegisterSchema(memberUpdateSchema(1), memberSamples...)
+	RegisterSchema(memberUpdateSchema(2))
+
+	RegisterSchema(requestPayloadSchema,
+		RequestPayload{Kind: OpWrite, Key: "x", Value: "1"},
+		RequestPayload{Kind: OpRead, Key: "x"},
+	)
+}
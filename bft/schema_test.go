@@ -0,0 +1,66 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestRegisteredSchemasCompatible tests that every registered version pair one apart round-trips
+func TestRegisteredSchemasCompatible(t *testing.T) {
+	matrix := CheckCompatibility(WireSchemas(), SchemaSamples())
+	if len(matrix.Cells) != 9 {
+		t.Errorf("Expected 9 cells for two two-version messages and one single-version message, got %d", len(matrix.Cells))
+	}
+	for _, cell := range matrix.Failures() {
+		t.Errorf("Expected %s v%d -> v%d to be compatible: %v", cell.Message, cell.Encoder, cell.Decoder, cell.Err)
+	}
+}
+
+// TestCompatibilityCatchesRenamedField tests that a wire change readers do not know about fails the matrix
+func TestCompatibilityCatchesRenamedField(t *testing.T) {
+	renamed := clockUpdateSchema(3)
+	renamed.Encode = func(msg interface{}) ([]byte, error) {
+		u := msg.(ClockUpdate)
+		return json.Marshal(map[string]interface{}{"v": 3, "node": u.NodeID, "timestamp": u.Timestamp, "sig": u.Signature})
+	}
+	renamed.Decode = func(data []byte) (interface{}, error) {
+		var wire struct {
+			NodeID    string `json:"node"`
+			Timestamp int64  `json:"timestamp"`
+			Signature string `json:"sig"`
+		}
+		err := json.Unmarshal(data, &wire)
+		return ClockUpdate{NodeID: wire.NodeID, Timestamp: wire.Timestamp, Signature: wire.Signature}, err
+	}
+	all := append(WireSchemas(), renamed)
+
+	matrix := CheckCompatibility(all, SchemaSamples())
+	failed := matrix.Failures()
+	if len(failed) != 2 || failed[0].Encoder != 2 || failed[0].Decoder != 3 || failed[1].Encoder != 3 || failed[1].Decoder != 2 {
+		t.Fatalf("Expected clock-update v2 -> v3 and v3 -> v2 to fail, got %v", failed)
+	}
+	if !strings.Contains(matrix.String(), "v3 ->          -   FAIL  ok") {
+		t.Errorf("Expected the report to mark the failing cell:\n%s", matrix)
+	}
+}
+
+// TestMemberStateNamesNeedOneVersionOfReaders tests that v3 writers may use state names v2 readers accept
+func TestMemberStateNamesNeedOneVersionOfReaders(t *testing.T) {
+	named := memberUpdateSchema(3)
+	named.Encode = func(msg interface{}) ([]byte, error) {
+		u := msg.(MemberUpdate)
+		state, _ := json.Marshal(u.State.String())
+		return json.Marshal(memberUpdateWire{V: 3, ID: u.ID, State: state, Incarnation: u.Incarnation})
+	}
+	matrix := CheckCompatibility(append(WireSchemas(), named), SchemaSamples())
+	if failed := matrix.Failures(); len(failed) != 0 {
+		t.Errorf("Expected v2 readers to accept v3 state names, got %v", failed)
+	}
+
+	data, _ := named.Encode(MemberUpdate{ID: "A", State: MemberSuspect})
+	if _, err := memberUpdateSchema(1).Decode(data); !errors.Is(err, ErrSchemaVersion) {
+		t.Errorf("Expected a v1 reader two versions behind to reject state names, got %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package bft
+
+import "os"
+
+// reloadSignals is empty on platforms without SIGHUP, such as wasm and
+// windows, where the config reloads only through the admin API
+var reloadSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package bft
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals make a ConfigReloader re-read its file
+var reloadSignals = []os.Signal{syscall.SIGHUP}
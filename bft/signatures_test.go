@@ -0,0 +1,101 @@
+package bft
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// newSchemeSystem creates a four-node cluster signing with one scheme
+func newSchemeSystem(tb testing.TB, scheme crypto.SignatureScheme) *System {
+	system := newTestSystem(tb, nodeIDs(4), inRegion("us-east"), func(node *Node) {
+		if err := node.UseSignatureScheme(scheme); err != nil {
+			tb.Fatal(err)
+		}
+	})
+	connectAll(system)
+	system.SetLeader("A")
+	return system
+}
+
+// TestScenarioEd25519 tests that a scenario can have its nodes sign with Ed25519 and that they still agree
+func TestScenarioEd25519(t *testing.T) {
+	scenario, err := ParseScenario([]byte(`{"leader": "A", "signatures": "ed25519", "nodes": [{"id": "A"}, {"id": "B"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := NewSystem()
+	if err := scenario.Build(system, 1); err != nil {
+		t.Fatal(err)
+	}
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	if scheme := crypto.SchemeOf(a.PublicKey); scheme != crypto.SchemeEd25519 {
+		t.Fatalf("Expected A to sign with Ed25519, got %q", scheme)
+	}
+	update := a.GetClockUpdate()
+	if !VerifyClockUpdate(a.PublicKey, update) {
+		t.Error("Expected A's update to verify")
+	}
+	system.receiveClockUpdate("A", b, update)
+	if b.VectorClock.GetTimestamp("A") != update.Timestamp {
+		t.Error("Expected B to apply A's Ed25519-signed update")
+	}
+	if _, err := ParseScenario([]byte(`{"leader": "A", "signatures": "rsa", "nodes": [{"id": "A"}]}`)); !errors.Is(err, ErrInvalidScenario) {
+		t.Errorf("Expected an unknown scheme to be rejected, got %v", err)
+	}
+}
+
+// TestMixedSchemesRefused tests that nodes signing with different schemes fail their handshake
+func TestMixedSchemesRefused(t *testing.T) {
+	system := newSchemeSystem(t, crypto.SchemeECDSA)
+	if err := system.Nodes["B"].UseSignatureScheme(crypto.SchemeEd25519); err != nil {
+		t.Fatal(err)
+	}
+	_, err := system.Handshake(system.Nodes["A"], system.Nodes["B"])
+	var incompatible *IncompatibilityError
+	if !errors.As(err, &incompatible) || incompatible.Field != "signature scheme" {
+		t.Errorf("Expected the signature scheme to be incompatible, got %v", err)
+	}
+	if _, err := system.Handshake(system.Nodes["A"], system.Nodes["C"]); err != nil {
+		t.Errorf("Expected nodes on one scheme to agree, got %v", err)
+	}
+}
+
+// TestPBFTEd25519 tests that replicas signing with Ed25519 commit requests
+func TestPBFTEd25519(t *testing.T) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	pbft, err := NewPBFT(newSchemeSystem(t, crypto.SchemeEd25519), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := pbft.Submit([]byte("x=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pbft.Run()
+	if outcome := pbft.Outcome(digest); !outcome.Committed || pbft.Stats.Rejected != 0 {
+		t.Errorf("Expected the request to commit, got %+v", pbft.Stats)
+	}
+}
+
+// benchmarkSchemeGossip measures rounds of signed all-to-all gossip, every
+// node signing one update and verifying one from each peer per round
+func benchmarkSchemeGossip(b *testing.B, scheme crypto.SignatureScheme) {
+	saved := Output
+	Output = NewRenderer(io.Discard, false)
+	defer func() { Output = saved }()
+
+	sim := NewSimulation(newSchemeSystem(b, scheme))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sim.Advance(1)
+	}
+}
+
+func BenchmarkGossipECDSA(b *testing.B)   { benchmarkSchemeGossip(b, crypto.SchemeECDSA) }
+func BenchmarkGossipEd25519(b *testing.B) { benchmarkSchemeGossip(b, crypto.SchemeEd25519) }
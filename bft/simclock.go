@@ -0,0 +1,109 @@
+package bft
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock skew and drift.
+//
+// Every node reads the same time by default, the host's or, under a
+// scheduler, the virtual one, so no two physical clocks ever disagree. A
+// SimClock gives a node a physical clock of its own: Offset ahead of the
+// reference time from the start, behind if negative, and gaining Drift of
+// every second of reference time that passes, losing if negative, so its
+// skew grows over a long run the way an undisciplined oscillator's does.
+// A node with a SimClock stamps its updates by it, its hybrid logical
+// clock reads it as physical time, and it judges the timestamps of updates
+// it receives against it. A node running fast therefore has its honest
+// updates refused as inflated once it is more than MaxClockSkew ahead of
+// its receivers, while one running slow refuses theirs; within that bound
+// an HLC carries the fast node's time to every node it reaches.
+
+// SimClock is a physical clock off the reference time by an offset and a
+// drift
+type SimClock struct {
+	Offset    time.Duration
+	Drift     float64          // Seconds gained per second of reference time, 1e-6 is one ppm
+	Reference func() time.Time // True time, the host's if nil
+	start     time.Time        // Reference time the drift accumulates from
+}
+
+// NewSimClock creates a clock reading reference with an offset and a drift
+// accumulating from now
+func NewSimClock(reference func() time.Time, offset time.Duration, drift float64) *SimClock {
+	c := &SimClock{Offset: offset, Drift: drift, Reference: reference}
+	c.start = c.reference()
+	return c
+}
+
+// reference reads the true time
+func (c *SimClock) reference() time.Time {
+	if c.Reference != nil {
+		return c.Reference()
+	}
+	return time.Now()
+}
+
+// Now returns the time the clock shows
+func (c *SimClock) Now() time.Time {
+	return c.reference().Add(c.Skew())
+}
+
+// Unix returns the time the clock shows in Unix seconds, a node timestamp
+// source
+func (c *SimClock) Unix() int64 {
+	return c.Now().Unix()
+}
+
+// Skew returns how far ahead of the reference time the clock is
+func (c *SimClock) Skew() time.Duration {
+	elapsed := c.reference().Sub(c.start)
+	return c.Offset + time.Duration(float64(elapsed)*c.Drift)
+}
+
+// SetClockSkew gives a node a physical clock offset from the system's time
+// and drifting from it from now on
+func (s *System) SetClockSkew(id string, offset time.Duration, drift float64) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	node := s.Nodes[id]
+	if node == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownNode, id)
+	}
+	var reference func() time.Time
+	if s.Scheduler != nil {
+		reference = s.Scheduler.Time
+	}
+	c := NewSimClock(reference, offset, drift)
+	node.Lock.Lock()
+	defer node.Lock.Unlock()
+	node.SimClock, node.Clock = c, c.Unix
+	return nil
+}
+
+// ClockSkew returns how far ahead of the system's time a node's physical
+// clock is, zero without a SimClock
+func (s *System) ClockSkew(id string) time.Duration {
+	s.Lock.RLock()
+	node := s.Nodes[id]
+	s.Lock.RUnlock()
+	if node == nil {
+		return 0
+	}
+	node.Lock.RLock()
+	defer node.Lock.RUnlock()
+	if node.SimClock == nil {
+		return 0
+	}
+	return node.SimClock.Skew()
+}
+
+// physicalNow returns the time by the node's physical clock, the system's
+// time without a SimClock. The caller must hold n.Lock.
+func (n *Node) physicalNow(s *System) time.Time {
+	if n.SimClock != nil {
+		return n.SimClock.Now()
+	}
+	return s.now()
+}
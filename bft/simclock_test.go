@@ -0,0 +1,98 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft/clock"
+)
+
+// TestSimClockOffsetAndDrift tests that skew starts at the offset and grows with the drift
+func TestSimClockOffsetAndDrift(t *testing.T) {
+	sched := NewScheduler(1)
+	c := NewSimClock(sched.Time, 2*time.Second, 1e-3)
+	if c.Skew() != 2*time.Second || c.Unix() != SimulationEpoch.Unix()+2 {
+		t.Errorf("Expected to start 2s ahead, skew %v at %d", c.Skew(), c.Unix())
+	}
+	sched.RunUntil(1000 * time.Second)
+	if c.Skew() != 3*time.Second {
+		t.Errorf("Expected 1000ppm to gain 1s over 1000s, skew %v", c.Skew())
+	}
+	slow := NewSimClock(sched.Time, 0, -0.5)
+	sched.RunUntil(1010 * time.Second)
+	if slow.Now() != sched.Time().Add(-5*time.Second) {
+		t.Errorf("Expected a clock at half speed to lose 5s over 10s, skew %v", slow.Skew())
+	}
+}
+
+// TestClockSkewRefusesHonestUpdates tests that receivers judge timestamps by their own physical clocks
+func TestClockSkewRefusesHonestUpdates(t *testing.T) {
+	system := newWorkloadSystem(t, 1)
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	if err := system.SetClockSkew("B", 2*MaxClockSkew*time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	update := b.GetClockUpdate()
+	system.receiveClockUpdate("B", a, update)
+	if a.VectorClock.GetTimestamp("B") != 0 {
+		t.Error("Expected A to refuse B's update as inflated")
+	}
+
+	// A running just as fast accepts it
+	if err := system.SetClockSkew("A", 2*MaxClockSkew*time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	system.receiveClockUpdate("B", a, update)
+	if a.VectorClock.GetTimestamp("B") != update.Timestamp {
+		t.Error("Expected A to accept B's update by its own fast clock")
+	}
+	if skew := system.ClockSkew("A"); skew != 2*MaxClockSkew*time.Second {
+		t.Errorf("Expected A's skew to be reported, got %v", skew)
+	}
+	if err := system.SetClockSkew("Z", 0, 0); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("Expected ErrUnknownNode, got %v", err)
+	}
+}
+
+// TestClockSkewCarriedByHLC tests that a hybrid logical clock takes in a fast peer's time
+func TestClockSkewCarriedByHLC(t *testing.T) {
+	system := newWorkloadSystem(t, 1)
+	a, b := system.Nodes["A"], system.Nodes["B"]
+	a.UseClock(clock.KindHLC)
+	if err := system.SetClockSkew("B", 3*time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	system.receiveClockUpdate("B", a, b.GetClockUpdate())
+	hlc := a.VectorClock.(*clock.HLC)
+	if ahead := hlc.Latest().Wall - a.wallClock(); ahead != 3 {
+		t.Errorf("Expected A's HLC to run 3s ahead of its physical clock, got %ds", ahead)
+	}
+}
+
+// TestScenarioClockSkew tests that scenario nodes get skewed clocks that carry over to a scheduler
+func TestScenarioClockSkew(t *testing.T) {
+	scenario, err := ParseScenario([]byte(`{
+		"leader": "A",
+		"nodes": [{"id": "A"}, {"id": "B", "clock_offset_ms": 1500, "clock_drift_ppm": 100}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := NewSystem()
+	if err := scenario.Build(system, 1); err != nil {
+		t.Fatal(err)
+	}
+	sched := NewScheduler(1)
+	system.UseScheduler(sched)
+	sched.RunUntil(10000 * time.Second)
+	if skew := system.ClockSkew("B"); skew != 2500*time.Millisecond {
+		t.Errorf("Expected 1.5s plus 100ppm of 10000s, got %v", skew)
+	}
+	if system.Nodes["B"].wallClock() != sched.Time().Add(2500*time.Millisecond).Unix() {
+		t.Error("Expected B to stamp by its skewed clock in virtual time")
+	}
+	if _, err := ParseScenario([]byte(`{"leader": "A", "nodes": [{"id": "A", "clock_drift_ppm": -1000000}]}`)); !errors.Is(err, ErrInvalidScenario) {
+		t.Errorf("Expected a stopped clock to be rejected, got %v", err)
+	}
+}
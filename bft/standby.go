@@ -0,0 +1,272 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Warm standby replicas.
+//
+// A standby receives every committed entry like any other replica but does
+// not vote: quorums are counted over voters only. When faults among the
+// voters reach f, one more fault would cost the cluster its quorum. An
+// operator, or automation watching QuorumHealth, then promotes a standby in
+// place of a faulty voter. The promotion is a reconfiguration committed
+// through the old configuration's quorum in a single round; the replaced
+// voter is demoted to standby and catches up as one if it recovers. Once the
+// quorum is gone it is too late, since nothing can commit the change.
+
+var (
+	ErrNotStandby = errors.New("node is not a standby")
+	ErrNotVoter   = errors.New("node is not a voter")
+)
+
+// voters returns the nodes that vote, in ID order. The caller must hold s.Lock.
+func (s *System) voters() []*Node {
+	voters := make([]*Node, 0, len(s.Nodes))
+	for _, id := range sortedKeys(s.Nodes) {
+		if node := s.Nodes[id]; !node.Standby {
+			voters = append(voters, node)
+		}
+	}
+	return voters
+}
+
+// QuorumHealth summarizes how close the voters are to losing their quorum
+type QuorumHealth struct {
+	Voters    []string `json:"voters"`
+	Standbys  []string `json:"standbys"`
+	Faulty    []string `json:"faulty"` // Voters that are unreachable or fenced
+	F         int      `json:"f"`
+	Epoch     int64    `json:"epoch"` // Fault tolerance epoch, 0 while f is derived
+	Quorum    int      `json:"quorum"`
+	Reachable int      `json:"reachable"`
+}
+
+// AtRisk reports whether one more fault would lose the quorum
+func (h *QuorumHealth) AtRisk() bool {
+	return h.Reachable <= h.Quorum
+}
+
+// Lost reports whether the voters no longer form a quorum
+func (h *QuorumHealth) Lost() bool {
+	return h.Reachable < h.Quorum
+}
+
+// QuorumHealth reports the state of the voting configuration
+func (s *System) QuorumHealth() *QuorumHealth {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+	health := &QuorumHealth{}
+	for _, id := range sortedKeys(s.Nodes) {
+		node := s.Nodes[id]
+		switch {
+		case node.Standby:
+			health.Standbys = append(health.Standbys, id)
+			continue
+		case s.reachable(node):
+			health.Reachable++
+		default:
+			health.Faulty = append(health.Faulty, id)
+		}
+		health.Voters = append(health.Voters, id)
+	}
+	health.F = s.faultThreshold(len(health.Voters))
+	if s.Faults != nil {
+		health.Epoch = s.Faults.Epoch
+	}
+	health.Quorum = 2*health.F + 1
+	return health
+}
+
+// Reconfiguration records a standby promotion
+type Reconfiguration struct {
+	Promoted string
+	Replaced string
+	Index    int64         // Log index of the configuration change
+	Latency  time.Duration // Time to commit the change
+}
+
+// PromoteStandby makes a standby a voter in place of replaced, which is
+// demoted to standby. The change commits through the current quorum.
+func (s *System) PromoteStandby(standbyID, replacedID string) (*Reconfiguration, error) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	standby, exists := s.Nodes[standbyID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, standbyID)
+	}
+	if !standby.Standby {
+		return nil, fmt.Errorf("%w: %s", ErrNotStandby, standbyID)
+	}
+	if !s.reachable(standby) {
+		return nil, fmt.Errorf("%w: %s", ErrNodeUnreachable, standbyID)
+	}
+	replaced, exists := s.Nodes[replacedID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, replacedID)
+	}
+	if replaced.Standby {
+		return nil, fmt.Errorf("%w: %s", ErrNotVoter, replacedID)
+	}
+	leader, exists := s.Nodes[s.Leader]
+	if !exists || replaced == leader {
+		return nil, ErrNoLeader
+	}
+	if _, err := s.heartbeatQuorum(leader); err != nil {
+		return nil, err
+	}
+
+	// A warm standby is normally current; close any gap before it votes
+	leader.Lock.RLock()
+	standby.Lock.Lock()
+	for _, entry := range leader.Store.Entries {
+		standby.Store.Apply(entry)
+	}
+	standby.Store.Apply(Entry{Index: leader.Store.CommitIndex})
+	standby.Lock.Unlock()
+	change := Entry{Index: leader.Store.CommitIndex + 1}
+	leader.Lock.RUnlock()
+
+	timing := NewOpTiming(fmt.Sprintf("reconfigure-%d", change.Index), leader.ID)
+	if err := s.commit(timing, leader.Region, leader, leader, entryDigest(change), []Entry{change}); err != nil {
+		return nil, err
+	}
+	standby.Standby = false
+	replaced.Standby = true
+	s.audit(AuditMembership, standbyID, replacedID, fmt.Sprintf("promoted to voter in place of %s at index %d", replacedID, change.Index))
+	return &Reconfiguration{Promoted: standbyID, Replaced: replacedID, Index: change.Index, Latency: timing.Total()}, nil
+}
+
+// StandbyAdminHandler serves the operator API: GET /quorum returns the
+// quorum health; POST /promote?standby=S&replace=V promotes S in place of V;
+// POST /faults?f=N sets the tolerated fault count.
+func (s *System) StandbyAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/quorum", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.QuorumHealth())
+	})
+	mux.HandleFunc("/promote", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := req.URL.Query()
+		reconfig, err := s.PromoteStandby(query.Get("standby"), query.Get("replace"))
+		switch {
+		case errors.Is(err, ErrNoQuorum) || errors.Is(err, ErrNoLeader):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			writeJSON(w, http.StatusOK, reconfig)
+		}
+	})
+	mux.HandleFunc("/faults", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		f, err := strconv.Atoi(req.URL.Query().Get("f"))
+		if err != nil {
+			http.Error(w, "f must be an integer", http.StatusBadRequest)
+			return
+		}
+		config, err := s.ReconfigureFaults(f)
+		switch {
+		case errors.Is(err, ErrNoQuorum) || errors.Is(err, ErrNoLeader):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			writeJSON(w, http.StatusOK, config)
+		}
+	})
+	return mux
+}
+
+// StandbyScenarioResult measures how a cluster rides out two voter failures
+type StandbyScenarioResult struct {
+	Rounds            int
+	UnavailableRounds int // Rounds in which a linearizable read failed for lack of quorum
+	RecoveryRounds    int // Rounds from the cluster becoming at risk to regaining a margin
+	Promotions        []*Reconfiguration
+}
+
+// RunStandbyScenario runs four voters, plus one standby if withStandby is
+// set, and crashes two voters a few rounds apart. The crashed voters come
+// back after repairAfter rounds. When the cluster is at risk and a standby
+// is available it is promoted in place of a faulty voter.
+func RunStandbyScenario(withStandby bool, rounds, repairAfter int) (*StandbyScenarioResult, error) {
+	system := NewSystem()
+	ids := []string{"A", "B", "C", "D"}
+	if withStandby {
+		ids = append(ids, "S")
+	}
+	for _, id := range ids {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			return nil, err
+		}
+		node.Standby = id == "S"
+		system.AddNode(node)
+	}
+	system.SetLeader("A")
+
+	crashes := map[int]string{2: "B", 4: "C"}
+	result := &StandbyScenarioResult{Rounds: rounds}
+	atRiskSince := -1
+	for round := 1; round <= rounds; round++ {
+		if id, ok := crashes[round]; ok {
+			system.SetPartition(id, true)
+		}
+		for crashed, id := range crashes {
+			if round == crashed+repairAfter {
+				system.SetPartition(id, false)
+			}
+		}
+
+		health := system.QuorumHealth()
+		if health.AtRisk() && atRiskSince < 0 {
+			atRiskSince = round
+		}
+		if health.AtRisk() && !health.Lost() && len(health.Standbys) > 0 && len(health.Faulty) > 0 {
+			sort.Strings(health.Faulty)
+			for _, standby := range health.Standbys {
+				if reconfig, err := system.PromoteStandby(standby, health.Faulty[0]); err == nil {
+					result.Promotions = append(result.Promotions, reconfig)
+					break
+				}
+			}
+			health = system.QuorumHealth()
+		}
+		if atRiskSince >= 0 && !health.AtRisk() {
+			result.RecoveryRounds += round - atRiskSince
+			atRiskSince = -1
+		}
+
+		// A write refused for want of a quorum is expected while the quorum
+		// is at risk; the read below counts the round as unavailable
+		if _, err := system.SubmitWrite("", "A", "round", fmt.Sprint(round)); err != nil && !errors.Is(err, ErrNoQuorum) {
+			return nil, err
+		}
+		if _, err := system.ReadIndex("", "A", "round"); errors.Is(err, ErrNoQuorum) {
+			result.UnavailableRounds++
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if atRiskSince >= 0 {
+		result.RecoveryRounds += rounds + 1 - atRiskSince
+	}
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package bft
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newStandbySystem creates voters A-D led by A and a standby S
+func newStandbySystem(t *testing.T) *System {
+	system := newTestSystem(t, append(nodeIDs(4), "S"), func(node *Node) { node.Standby = node.ID == "S" })
+	system.SetLeader("A")
+	return system
+}
+
+// TestStandbyReplicatesWithoutVoting tests that a standby receives writes but is not counted in quorums
+func TestStandbyReplicatesWithoutVoting(t *testing.T) {
+	system := newStandbySystem(t)
+	if _, err := system.SubmitWrite("", "A", "x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if system.Nodes["S"].Store.Entries["x"].Value != "1" {
+		t.Errorf("Expected the standby to replicate x=1")
+	}
+
+	health := system.QuorumHealth()
+	if len(health.Voters) != 4 || health.F != 1 || health.Quorum != 3 || health.AtRisk() {
+		t.Errorf("Expected 4 healthy voters with quorum 3, got %+v", health)
+	}
+	system.SetPartition("B", true)
+	system.SetPartition("C", true)
+	if _, err := system.ReadIndex("", "A", "x"); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Expected the standby not to make up the quorum, got %v", err)
+	}
+}
+
+// TestPromoteStandby tests that promotion restores the margin and is refused once the quorum is lost
+func TestPromoteStandby(t *testing.T) {
+	system := newStandbySystem(t)
+	system.SetPartition("B", true)
+	if !system.QuorumHealth().AtRisk() {
+		t.Fatalf("Expected one faulty voter of four to put the quorum at risk")
+	}
+
+	reconfig, err := system.PromoteStandby("S", "B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconfig.Index != 1 || reconfig.Latency == 0 {
+		t.Errorf("Expected the change committed at index 1 with a latency, got %+v", reconfig)
+	}
+	if health := system.QuorumHealth(); health.AtRisk() || health.Standbys[0] != "B" {
+		t.Errorf("Expected S to vote and B to be demoted, got %+v", health)
+	}
+	if _, err := system.PromoteStandby("C", "D"); !errors.Is(err, ErrNotStandby) {
+		t.Errorf("Expected ErrNotStandby, got %v", err)
+	}
+
+	system.SetPartition("C", true)
+	system.SetPartition("D", true)
+	system.SetPartition("B", false)
+	if _, err := system.PromoteStandby("B", "C"); !errors.Is(err, ErrNoQuorum) {
+		t.Errorf("Expected promotion to need the current quorum, got %v", err)
+	}
+}
+
+// TestStandbyAdminAPI tests promotion through the operator API
+func TestStandbyAdminAPI(t *testing.T) {
+	system := newStandbySystem(t)
+	system.SetPartition("C", true)
+	handler := system.StandbyAdminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/promote?standby=S&replace=C", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected promotion to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/promote?standby=X&replace=C", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown standby to be rejected, got %d", rec.Code)
+	}
+}
+
+// TestStandbyScenarioRecovery tests that a standby keeps the cluster available through two failures
+func TestStandbyScenarioRecovery(t *testing.T) {
+	without, err := RunStandbyScenario(false, 12, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with, err := RunStandbyScenario(true, 12, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if without.UnavailableRounds != 4 || with.UnavailableRounds != 0 {
+		t.Errorf("Expected 4 unavailable rounds without a standby and none with one, got %d and %d",
+			without.UnavailableRounds, with.UnavailableRounds)
+	}
+	if with.RecoveryRounds >= without.RecoveryRounds {
+		t.Errorf("Expected faster recovery with a standby, got %d vs %d rounds", with.RecoveryRounds, without.RecoveryRounds)
+	}
+	if len(with.Promotions) == 0 || with.Promotions[0].Promoted != "S" || with.Promotions[0].Replaced != "B" {
+		t.Errorf("Expected S to be promoted in place of B, got %+v", with.Promotions)
+	}
+}
@@ -0,0 +1,325 @@
+package bft
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scenario parameter sweeps.
+//
+// A sweep varies one or more scenario parameters across a grid and runs the
+// scenario once per point with the same seed, so every difference between
+// two rows comes from the parameters and not from chance. The outcomes are
+// written as one CSV row per point, ready for plotting trade-off curves.
+//
+// The swept scenario is an open-loop client writing to a 3f+1 node cluster
+// spread over three regions. Operations arrive at a fixed interval and are
+// sent in batches with one batch outstanding. Each message leg is lost with
+// the loss rate: if the request or reply is lost, or fewer than a quorum of
+// replicas acknowledge, the client times out and resends the batch. Larger
+// batches amortize round trips but make operations wait for the batch to
+// fill; more faults tolerated buy resilience to loss with a larger quorum.
+
+var ErrSweepParam = errors.New("invalid sweep parameter")
+
+// SweepDefaults are the swept parameters and their values when not varied
+var SweepDefaults = map[string]float64{
+	"loss":  0,
+	"f":     1,
+	"batch": 1,
+}
+
+// SweepParam is one parameter and the values it takes
+type SweepParam struct {
+	Name   string
+	Values []float64
+}
+
+// ParseSweepParam parses "name=v1,v2,..." or "name=start:end:step"
+func ParseSweepParam(spec string) (SweepParam, error) {
+	name, values, found := strings.Cut(spec, "=")
+	if _, known := SweepDefaults[name]; !found || !known {
+		return SweepParam{}, fmt.Errorf("%w: %q, want name=values with name one of %v", ErrSweepParam, spec, sortedKeys(SweepDefaults))
+	}
+	param := SweepParam{Name: name}
+	if parts := strings.Split(values, ":"); len(parts) == 3 {
+		var bounds [3]float64
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return SweepParam{}, fmt.Errorf("%w: %q: %v", ErrSweepParam, spec, err)
+			}
+			bounds[i] = v
+		}
+		if bounds[2] <= 0 || bounds[1] < bounds[0] {
+			return SweepParam{}, fmt.Errorf("%w: %q: empty range", ErrSweepParam, spec)
+		}
+		steps := int(math.Floor((bounds[1]-bounds[0])/bounds[2] + 1e-9))
+		for i := 0; i <= steps; i++ {
+			param.Values = append(param.Values, bounds[0]+float64(i)*bounds[2])
+		}
+		return param, nil
+	}
+	for _, part := range strings.Split(values, ",") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return SweepParam{}, fmt.Errorf("%w: %q: %v", ErrSweepParam, spec, err)
+		}
+		param.Values = append(param.Values, v)
+	}
+	return param, nil
+}
+
+// SweepPoint is one combination of parameter values
+type SweepPoint map[string]float64
+
+// SweepGrid returns every combination of the parameters' values, the last
+// parameter varying fastest. Parameters not swept keep their defaults.
+func SweepGrid(params []SweepParam) []SweepPoint {
+	points := []SweepPoint{{}}
+	for name, value := range SweepDefaults {
+		points[0][name] = value
+	}
+	for _, param := range params {
+		var next []SweepPoint
+		for _, point := range points {
+			for _, value := range param.Values {
+				p := make(SweepPoint, len(point))
+				for name, v := range point {
+					p[name] = v
+				}
+				p[param.Name] = value
+				next = append(next, p)
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// SweepWorkload is the client load each point runs
+type SweepWorkload struct {
+	Ops         int
+	Interval    time.Duration // Between operation arrivals
+	Timeout     time.Duration // Before a lost batch is resent
+	MaxAttempts int           // Per batch, after which the point fails
+}
+
+// DefaultSweepWorkload returns the workload used by the sweep command
+func DefaultSweepWorkload() SweepWorkload {
+	return SweepWorkload{Ops: 512, Interval: time.Millisecond, Timeout: 500 * time.Millisecond, MaxAttempts: 100}
+}
+
+// SweepOutcome is the result of running one point
+type SweepOutcome struct {
+	Point   SweepPoint
+	Results map[string]float64
+	Err     error
+}
+
+// RunSweepPoint runs the workload at a point with seed
+func RunSweepPoint(point SweepPoint, workload SweepWorkload, seed int64) (map[string]float64, error) {
+	f, batch, loss := int(point["f"]), int(point["batch"]), point["loss"]
+	if f < 0 || batch < 1 || loss < 0 || loss >= 1 {
+		return nil, fmt.Errorf("%w: f=%d batch=%d loss=%v", ErrSweepParam, f, batch, loss)
+	}
+
+	system := NewSystem()
+	regions := []string{"us-east", "eu-west", "ap-south"}
+	n := 3*f + 1
+	for i := 0; i < n; i++ {
+		node, err := NewNode(fmt.Sprintf("N%d", i+1), false, false)
+		if err != nil {
+			return nil, err
+		}
+		node.Region = regions[i%len(regions)]
+		node.Clock = func() int64 { return 0 }
+		system.AddNode(node)
+	}
+	system.SetLeader("N1")
+	system.SetRegionLatency("us-east", "eu-west", 40*time.Millisecond)
+	system.SetRegionLatency("us-east", "ap-south", 110*time.Millisecond)
+	system.SetRegionLatency("eu-west", "ap-south", 70*time.Millisecond)
+
+	rng := rand.New(rand.NewSource(seed))
+	delivered := func() bool { return rng.Float64() >= loss }
+	// attempt draws the fate of every leg of one batch's round
+	attempt := func() bool {
+		ok := delivered() && delivered()
+		acks := 1 // The leader's own
+		for i := 1; i < n; i++ {
+			if delivered() && delivered() {
+				acks++
+			}
+		}
+		return ok && acks >= 2*f+1
+	}
+
+	var now time.Duration
+	var attempts, requests int
+	latencies := make([]time.Duration, 0, workload.Ops)
+	for first := 0; first < workload.Ops; first += batch {
+		last := first + batch
+		if last > workload.Ops {
+			last = workload.Ops
+		}
+		start := time.Duration(last-1) * workload.Interval
+		if now > start {
+			start = now
+		}
+		for tries := 1; !attempt(); tries++ {
+			if tries >= workload.MaxAttempts {
+				return nil, fmt.Errorf("batch at op %d lost %d times", first, tries)
+			}
+			attempts++
+			start += workload.Timeout
+		}
+		attempts++
+		requests++
+
+		ops := make([]BatchOp, 0, last-first)
+		for i := first; i < last; i++ {
+			ops = append(ops, BatchOp{Kind: OpWrite, Key: fmt.Sprintf("k%d", i), Value: strconv.Itoa(i)})
+		}
+		result, err := system.SubmitBatch("us-east", "N1", ops)
+		if err != nil {
+			return nil, err
+		}
+		// Only simulated time counts; measured crypto and queueing time
+		// would make the point depend on the machine it runs on
+		breakdown := result.Timing.Breakdown()
+		now = start + breakdown[ComponentNetwork] + breakdown[ComponentConsensus]
+		for i := first; i < last; i++ {
+			latencies = append(latencies, now-time.Duration(i)*workload.Interval)
+		}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return map[string]float64{
+		"nodes":           float64(n),
+		"requests":        float64(requests),
+		"retries":         float64(attempts - requests),
+		"duration_ms":     ms(now),
+		"throughput_ops":  float64(len(latencies)) / now.Seconds(),
+		"latency_mean_ms": ms(total / time.Duration(len(latencies))),
+		"latency_p99_ms":  ms(latencies[(len(latencies)*99)/100]),
+	}, nil
+}
+
+// RunSweep runs every point of the grid with seed
+func RunSweep(params []SweepParam, workload SweepWorkload, seed int64) []SweepOutcome {
+	var outcomes []SweepOutcome
+	for _, point := range SweepGrid(params) {
+		results, err := RunSweepPoint(point, workload, seed)
+		outcomes = append(outcomes, SweepOutcome{Point: point, Results: results, Err: err})
+	}
+	return outcomes
+}
+
+// WriteSweepCSV writes one row per outcome: the parameters, then the
+// results in sorted order, then the error if the point failed
+func WriteSweepCSV(w io.Writer, outcomes []SweepOutcome) error {
+	columns := make(map[string]bool)
+	for _, outcome := range outcomes {
+		for name := range outcome.Results {
+			columns[name] = true
+		}
+	}
+	params := sortedKeys(SweepDefaults)
+	results := sortedKeys(columns)
+
+	out := csv.NewWriter(w)
+	out.Write(append(append(append([]string{}, params...), results...), "error"))
+	for _, outcome := range outcomes {
+		var row []string
+		for _, name := range params {
+			row = append(row, strconv.FormatFloat(outcome.Point[name], 'g', -1, 64))
+		}
+		for _, name := range results {
+			value, ok := outcome.Results[name]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+		if outcome.Err != nil {
+			row = append(row, outcome.Err.Error())
+		} else {
+			row = append(row, "")
+		}
+		out.Write(row)
+	}
+	out.Flush()
+	return out.Error()
+}
+
+type sweepParams []SweepParam
+
+func (p *sweepParams) String() string {
+	return fmt.Sprint(*p)
+}
+
+func (p *sweepParams) Set(value string) error {
+	param, err := ParseSweepParam(value)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, param)
+	return nil
+}
+
+// SweepCommand implements `wahello sweep [-param name=values]... [-o file]`
+func SweepCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	var params sweepParams
+	flags.Var(&params, "param", "parameter to vary, name=v1,v2 or name=start:end:step (repeatable)")
+	seed := flags.Int64("seed", 1, "seed shared by every point")
+	workload := DefaultSweepWorkload()
+	flags.IntVar(&workload.Ops, "ops", workload.Ops, "operations per point")
+	flags.DurationVar(&workload.Interval, "interval", workload.Interval, "time between operation arrivals")
+	output := flags.String("o", "", "file to write the CSV to instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if workload.Ops < 1 {
+		return fmt.Errorf("%w: -ops must be positive", ErrSweepParam)
+	}
+	if len(params) == 0 {
+		params = sweepParams{
+			{Name: "loss", Values: []float64{0, 0.05, 0.1, 0.15, 0.2}},
+			{Name: "f", Values: []float64{0, 1, 2, 3}},
+			{Name: "batch", Values: []float64{1, 4, 16, 64, 256}},
+		}
+	}
+
+	outcomes := RunSweep(params, workload, *seed)
+	if *output == "" {
+		return WriteSweepCSV(stdout, outcomes)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := WriteSweepCSV(f, outcomes); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Swept %d points to %s\n", len(outcomes), *output)
+	return nil
+}
@@ -0,0 +1,107 @@
+package bft
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSweepWorkload is a small workload that keeps sweeps fast
+func testSweepWorkload() SweepWorkload {
+	return SweepWorkload{Ops: 64, Interval: time.Millisecond, Timeout: 500 * time.Millisecond, MaxAttempts: 100}
+}
+
+// TestParseSweepParam tests value lists, ranges and unknown names
+func TestParseSweepParam(t *testing.T) {
+	param, err := ParseSweepParam("batch=1,16,256")
+	if err != nil || !reflect.DeepEqual(param.Values, []float64{1, 16, 256}) {
+		t.Errorf("Expected batch values [1 16 256], got %v, %v", param.Values, err)
+	}
+	param, err = ParseSweepParam("loss=0:0.2:0.05")
+	if err != nil || len(param.Values) != 5 || param.Values[4] != 0.2 {
+		t.Errorf("Expected five loss values ending at 0.2, got %v, %v", param.Values, err)
+	}
+	for _, spec := range []string{"jitter=1", "f", "f=0:3:0", "f=a,b"} {
+		if _, err := ParseSweepParam(spec); !errors.Is(err, ErrSweepParam) {
+			t.Errorf("Expected ErrSweepParam for %q, got %v", spec, err)
+		}
+	}
+}
+
+// TestSweepGrid tests that the grid covers every combination and defaults the rest
+func TestSweepGrid(t *testing.T) {
+	grid := SweepGrid([]SweepParam{
+		{Name: "f", Values: []float64{0, 1, 2, 3}},
+		{Name: "batch", Values: []float64{1, 16}},
+	})
+	if len(grid) != 8 {
+		t.Fatalf("Expected 8 points, got %d", len(grid))
+	}
+	if grid[1]["f"] != 0 || grid[1]["batch"] != 16 || grid[1]["loss"] != 0 {
+		t.Errorf("Expected the last parameter to vary fastest with loss defaulted, got %v", grid[1])
+	}
+}
+
+// TestSweepTradeOffs tests that the outcomes move the way the parameters should push them
+func TestSweepTradeOffs(t *testing.T) {
+	workload := testSweepWorkload()
+	run := func(f, batch, loss float64) map[string]float64 {
+		results, err := RunSweepPoint(SweepPoint{"f": f, "batch": batch, "loss": loss}, workload, 1)
+		if err != nil {
+			t.Fatalf("Expected f=%v batch=%v loss=%v to run, got %v", f, batch, loss, err)
+		}
+		return results
+	}
+
+	single, batched := run(1, 1, 0), run(1, 16, 0)
+	if batched["throughput_ops"] <= single["throughput_ops"] || batched["requests"] != 4 {
+		t.Errorf("Expected batching to raise throughput in 4 requests, got %v vs %v", batched, single)
+	}
+	if lossy := run(1, 1, 0.2); lossy["retries"] == 0 || lossy["duration_ms"] <= single["duration_ms"] {
+		t.Errorf("Expected loss to cause retries and slow the run, got %v", lossy)
+	}
+	if nodes := run(3, 1, 0)["nodes"]; nodes != 10 {
+		t.Errorf("Expected f=3 to run 10 nodes, got %v", nodes)
+	}
+}
+
+// TestSweepDeterministic tests that the same seed yields the same CSV
+func TestSweepDeterministic(t *testing.T) {
+	params := []SweepParam{
+		{Name: "loss", Values: []float64{0, 0.1}},
+		{Name: "batch", Values: []float64{1, 8}},
+	}
+	var first, second bytes.Buffer
+	if err := WriteSweepCSV(&first, RunSweep(params, testSweepWorkload(), 7)); err != nil {
+		t.Fatal(err)
+	}
+	WriteSweepCSV(&second, RunSweep(params, testSweepWorkload(), 7))
+	if first.String() != second.String() {
+		t.Errorf("Expected identical CSVs:\n%s\n%s", first.String(), second.String())
+	}
+
+	rows, err := csv.NewReader(&first).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got %v", err)
+	}
+	if len(rows) != 5 || strings.Join(rows[0][:3], ",") != "batch,f,loss" || rows[0][len(rows[0])-1] != "error" {
+		t.Errorf("Expected a header and 4 rows, got %v", rows)
+	}
+}
+
+// TestSweepRecordsFailedPoints tests that an invalid point becomes an error row instead of aborting
+func TestSweepRecordsFailedPoints(t *testing.T) {
+	outcomes := RunSweep([]SweepParam{{Name: "batch", Values: []float64{0, 4}}}, testSweepWorkload(), 1)
+	if !errors.Is(outcomes[0].Err, ErrSweepParam) || outcomes[1].Err != nil {
+		t.Fatalf("Expected only batch=0 to fail, got %v, %v", outcomes[0].Err, outcomes[1].Err)
+	}
+	var out bytes.Buffer
+	WriteSweepCSV(&out, outcomes)
+	if !strings.Contains(out.String(), "invalid sweep parameter") {
+		t.Errorf("Expected the error in the CSV, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,61 @@
+package bft
+
+import "testing"
+
+// nodeIDs returns the IDs A, B, C, ... of an n-node cluster
+func nodeIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = string(rune('A' + i))
+	}
+	return ids
+}
+
+// newTestSystem creates a system of fresh nodes with the given IDs. Each
+// option adjusts every node, in order, before it joins.
+func newTestSystem(tb testing.TB, ids []string, options ...func(*Node)) *System {
+	tb.Helper()
+	system := NewSystem()
+	for _, id := range ids {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			tb.Fatalf("Failed to create node %s: %v", id, err)
+		}
+		for _, option := range options {
+			option(node)
+		}
+		system.AddNode(node)
+	}
+	return system
+}
+
+// inRegion places nodes in region
+func inRegion(region string) func(*Node) {
+	return func(node *Node) { node.Region = region }
+}
+
+// fixedClock makes nodes read ts from their physical clock
+func fixedClock(ts int64) func(*Node) {
+	return func(node *Node) { node.Clock = func() int64 { return ts } }
+}
+
+// countingClock gives each node a physical clock that ticks once per read
+func countingClock(node *Node) {
+	var clock int64
+	node.Clock = func() int64 {
+		clock++
+		return clock
+	}
+}
+
+// connectAll makes every node of system a neighbor of every other
+func connectAll(system *System) {
+	for _, id := range sortedKeys(system.Nodes) {
+		node := system.Nodes[id]
+		for _, peer := range sortedKeys(system.Nodes) {
+			if peer != id {
+				node.Neighbors = append(node.Neighbors, peer)
+			}
+		}
+	}
+}
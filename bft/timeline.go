@@ -0,0 +1,228 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fault timelines.
+//
+// Beyond its static topology a scenario can script faults over time in its
+// timeline, one event per line:
+//
+//	at t=<time> <fault> <target>[,<target>...] [for <duration>]
+//
+// for instance "at t=5s partition eu-west", "at t=10s crash leader for 5s"
+// or "at t=15s heal partition". The fault is any registered kind, see
+// FaultKinds. A target is a node ID, a region standing for its nodes, or
+// one of the words leader, the leader when the event fires, partition, the
+// nodes partitioned when it fires, and all. An event with a duration is
+// reverted on the same nodes that long after it fired. Times are virtual:
+// RunTimeline plays the events on the system's scheduler between clock
+// propagation rounds, so a scenario run with the same seed injects the same
+// faults at the same points every time.
+
+var ErrInvalidTimeline = errors.New("invalid timeline event")
+
+// Targets standing for the nodes in a role when an event fires
+const (
+	TargetLeader    = "leader"
+	TargetPartition = "partition"
+	TargetAll       = "all"
+)
+
+// DefaultTimelinePeriod is how often RunTimeline propagates clock updates
+const DefaultTimelinePeriod = time.Second
+
+// TimelineEvent is a parsed line of a scenario timeline
+type TimelineEvent struct {
+	At       time.Duration
+	Kind     FaultKind
+	Targets  []string
+	Duration time.Duration // Until the fault is reverted, never if zero
+	Line     string
+}
+
+// ParseTimelineEvent parses a timeline line
+func ParseTimelineEvent(line string) (TimelineEvent, error) {
+	event := TimelineEvent{Line: strings.TrimSpace(line)}
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[0] != "at" || !strings.HasPrefix(fields[1], "t=") {
+		return event, fmt.Errorf("%w: %q is not \"at t=<time> <fault> <target>\"", ErrInvalidTimeline, event.Line)
+	}
+	at, err := time.ParseDuration(strings.TrimPrefix(fields[1], "t="))
+	if err != nil || at < 0 {
+		return event, fmt.Errorf("%w: bad time in %q", ErrInvalidTimeline, event.Line)
+	}
+	event.At, event.Kind = at, FaultKind(fields[2])
+	if _, err := NewFault(FaultStep{Kind: event.Kind}); err != nil {
+		return event, fmt.Errorf("%w: %v", ErrInvalidTimeline, err)
+	}
+	for _, target := range strings.Split(fields[3], ",") {
+		if target == "" {
+			return event, fmt.Errorf("%w: empty target in %q", ErrInvalidTimeline, event.Line)
+		}
+		event.Targets = append(event.Targets, target)
+	}
+	switch rest := fields[4:]; {
+	case len(rest) == 0:
+	case len(rest) == 2 && rest[0] == "for":
+		event.Duration, err = time.ParseDuration(rest[1])
+		if err != nil || event.Duration <= 0 {
+			return event, fmt.Errorf("%w: bad duration in %q", ErrInvalidTimeline, event.Line)
+		}
+	default:
+		return event, fmt.Errorf("%w: unexpected %q after the targets of %q", ErrInvalidTimeline, strings.Join(rest, " "), event.Line)
+	}
+	return event, nil
+}
+
+// TimelineEvents parses the scenario's timeline and checks every target
+// names a node, a region or a role. The events are ordered by time, lines
+// with the same time in timeline order.
+func (sc *ScenarioSpec) TimelineEvents() ([]TimelineEvent, error) {
+	known := map[string]bool{TargetLeader: true, TargetPartition: true, TargetAll: true}
+	for _, node := range sc.Nodes {
+		known[node.ID], known[node.Region] = true, true
+	}
+	events := make([]TimelineEvent, 0, len(sc.Timeline))
+	for _, line := range sc.Timeline {
+		event, err := ParseTimelineEvent(line)
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range event.Targets {
+			if !known[target] {
+				return nil, fmt.Errorf("%w: %q targets unknown node or region %q", ErrInvalidTimeline, event.Line, target)
+			}
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+	return events, nil
+}
+
+// nodes resolves the event's targets to node IDs in the system as it is
+// now, in order of first mention
+func (e TimelineEvent) nodes(system *System) ([]string, error) {
+	system.Lock.RLock()
+	defer system.Lock.RUnlock()
+	ids := sortedKeys(system.Nodes)
+	var nodes []string
+	add := func(id string) {
+		if !containsID(nodes, id) {
+			nodes = append(nodes, id)
+		}
+	}
+	for _, target := range e.Targets {
+		matched := false
+		for _, id := range ids {
+			node := system.Nodes[id]
+			switch target {
+			case TargetLeader:
+				matched = id == system.Leader
+			case TargetPartition:
+				matched = system.Partition[id]
+			case TargetAll:
+				matched = true
+			default:
+				matched = id == target || node.Region == target
+			}
+			if matched {
+				add(id)
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w: %q matches no node", ErrInvalidTimeline, e.Line)
+	}
+	return nodes, nil
+}
+
+// TimelineRecord is a timeline event, or its revert, as it played out
+type TimelineRecord struct {
+	At     time.Duration // Since the timeline started
+	Event  TimelineEvent
+	Nodes  []string
+	Revert bool
+	Err    error
+}
+
+// String renders a record, e.g. "t=10s crash leader [A]" or
+// "t=15s revert crash leader [A]"
+func (r TimelineRecord) String() string {
+	action := string(r.Event.Kind)
+	if r.Revert {
+		action = "revert " + action
+	}
+	s := fmt.Sprintf("t=%v %s %s %v", r.At, action, strings.Join(r.Event.Targets, ","), r.Nodes)
+	if r.Err != nil {
+		s += ": " + r.Err.Error()
+	}
+	return s
+}
+
+// RunTimeline plays the scenario's timeline on system, which must run on a
+// scheduler, from the current virtual time. Every period each reachable
+// node propagates a clock update, and the events due in between fire at
+// their exact virtual times, until the last event and revert played. It
+// returns what happened in order and the first fault that failed; a failed
+// event does not stop the run.
+func (sc *ScenarioSpec) RunTimeline(system *System, period time.Duration) ([]TimelineRecord, error) {
+	events, err := sc.TimelineEvents()
+	if err != nil {
+		return nil, err
+	}
+	sched := system.Scheduler
+	if sched == nil {
+		return nil, ErrNoScheduler
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	if period <= 0 {
+		period = DefaultTimelinePeriod
+	}
+	start := sched.Now
+	var records []TimelineRecord
+	var failed error
+	round := 0
+	record := func(r TimelineRecord) {
+		r.At = sched.Now - start
+		records = append(records, r)
+		if r.Err != nil && failed == nil {
+			failed = fmt.Errorf("%s: %w", r.Event.Line, r.Err)
+		}
+	}
+	var end time.Duration
+	for _, event := range events {
+		end = max(end, event.At+event.Duration)
+		sched.At(start+event.At, func() {
+			nodes, err := event.nodes(system)
+			if err == nil {
+				err = system.ApplyFault(FaultStep{At: round, Kind: event.Kind, Nodes: nodes})
+			}
+			record(TimelineRecord{Event: event, Nodes: nodes, Err: err})
+			if err != nil || event.Duration == 0 {
+				return
+			}
+			sched.After(event.Duration, func() {
+				err := system.RevertFault(FaultStep{Kind: event.Kind, Nodes: nodes}, round)
+				record(TimelineRecord{Event: event, Nodes: nodes, Revert: true, Err: err})
+			})
+		})
+	}
+	system.Lock.RLock()
+	ids := sortedKeys(system.Nodes)
+	system.Lock.RUnlock()
+	for ; sched.Now <= start+end; round++ {
+		next := sched.Now + period
+		sched.RunUntil(sched.Now)
+		system.propagateRound(ids)
+		sched.RunUntil(next)
+	}
+	return records, failed
+}
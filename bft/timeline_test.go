@@ -0,0 +1,95 @@
+package bft
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseTimelineEvent tests the timeline line syntax
+func TestParseTimelineEvent(t *testing.T) {
+	event, err := ParseTimelineEvent("at t=10s crash leader,D for 2.5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.At != 10*time.Second || event.Kind != FaultCrash || strings.Join(event.Targets, ",") != "leader,D" || event.Duration != 2500*time.Millisecond {
+		t.Errorf("Expected a 2.5s crash of the leader and D at 10s, got %+v", event)
+	}
+	for _, line := range []string{
+		"partition eu-west",
+		"at 5s partition eu-west",
+		"at t=-1s partition eu-west",
+		"at t=5s melt eu-west",
+		"at t=5s partition eu-west,",
+		"at t=5s partition eu-west for",
+		"at t=5s partition eu-west for 0s",
+		"at t=5s partition eu-west until 6s",
+	} {
+		if _, err := ParseTimelineEvent(line); !errors.Is(err, ErrInvalidTimeline) {
+			t.Errorf("Expected %q to be invalid, got %v", line, err)
+		}
+	}
+}
+
+// TestScenarioTimelineValidate tests that a timeline may only target known nodes and regions
+func TestScenarioTimelineValidate(t *testing.T) {
+	scenario := DefaultScenario()
+	scenario.Timeline = []string{"at t=1s partition mars"}
+	if err := scenario.Validate(); !errors.Is(err, ErrInvalidScenario) {
+		t.Errorf("Expected an unknown region to invalidate the scenario, got %v", err)
+	}
+	scenario.Timeline = []string{"at t=2s heal partition", "at t=1s partition eu-west,F"}
+	events, err := scenario.TimelineEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events[0].Kind != FaultPartition || events[1].Kind != FaultHeal {
+		t.Errorf("Expected the events in time order, got %+v", events)
+	}
+}
+
+// TestRunTimeline tests that the sample timeline injects and reverts its faults at their virtual times
+func TestRunTimeline(t *testing.T) {
+	scenario, err := LoadScenario("../docs/scenarios/timeline.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := NewSystem()
+	if _, err := scenario.RunTimeline(system, 0); !errors.Is(err, ErrNoScheduler) {
+		t.Errorf("Expected the timeline to need a scheduler, got %v", err)
+	}
+	scheduler := NewScheduler(1)
+	system.UseScheduler(scheduler)
+	if err := scenario.Build(system, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := scenario.RunTimeline(system, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var played []string
+	for _, record := range records {
+		played = append(played, record.String())
+	}
+	expected := []string{
+		"t=5s partition eu-west [D E]",
+		"t=10s crash leader [A]",
+		"t=15s heal partition [D E]",
+		"t=15s revert crash leader [A]",
+	}
+	if strings.Join(played, "; ") != strings.Join(expected, "; ") {
+		t.Errorf("Expected %v, got %v", expected, played)
+	}
+	if system.IsPartitioned("D") || system.IsPartitioned("E") || system.IsFenced("A") {
+		t.Errorf("Expected every fault reverted by the end")
+	}
+	if scheduler.Now < 15*time.Second {
+		t.Errorf("Expected the run to last past the last event, ended at %v", scheduler.Now)
+	}
+	// D heard from the leader before the partition
+	if system.Nodes["D"].VectorClock.GetTimestamp("A") == 0 {
+		t.Errorf("Expected D to hear from A before the partition")
+	}
+}
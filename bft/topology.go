@@ -0,0 +1,272 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Random topology generators.
+//
+// A generator builds a scenario of any size instead of the hand-built
+// seven-node cluster: the nodes, their regions and the neighbor links
+// between them, with the first node as leader. The built-in generators are
+//
+//	complete     every pair of nodes linked
+//	ring         every node linked to the Degree nodes on either side
+//	star         every node linked to the first one
+//	erdos-renyi  every pair linked with probability Density
+//	small-world  a ring whose links are each rewired to a random node with
+//	             probability Density (Watts-Strogatz)
+//	regional     Regions clusters, each fully meshed, whose first nodes are
+//	             joined by a full mesh of backbone links
+//
+// Random choices draw from Seed, so a generator reproduces its scenario.
+// Random graphs need not be connected; that is part of what they explore.
+// Downstream code registers more generators with RegisterTopology.
+
+var (
+	ErrUnknownTopology    = errors.New("unknown topology")
+	ErrTopologyRegistered = errors.New("topology already registered")
+	ErrInvalidTopology    = errors.New("invalid topology parameters")
+)
+
+// TopologyParams parameterize a generator
+type TopologyParams struct {
+	Nodes   int
+	Density float64 // Link probability, or rewiring probability for small-world
+	Degree  int     // Neighbors on either side in rings, 1 if zero
+	Regions int     // Clusters of the regional topology, 1 if zero
+	Seed    int64
+}
+
+// TopologyGenerator builds a scenario from its parameters
+type TopologyGenerator func(params TopologyParams) (*ScenarioSpec, error)
+
+var (
+	topologyLock       sync.RWMutex
+	topologyGenerators = map[string]TopologyGenerator{}
+)
+
+// RegisterTopology makes a generator available under name
+func RegisterTopology(name string, generator TopologyGenerator) error {
+	topologyLock.Lock()
+	defer topologyLock.Unlock()
+	if _, exists := topologyGenerators[name]; exists {
+		return fmt.Errorf("%w: %s", ErrTopologyRegistered, name)
+	}
+	topologyGenerators[name] = generator
+	return nil
+}
+
+// Topologies returns the registered generator names in sorted order
+func Topologies() []string {
+	topologyLock.RLock()
+	defer topologyLock.RUnlock()
+	return sortedKeys(topologyGenerators)
+}
+
+// GenerateTopology builds a scenario with the named generator and validates
+// it
+func GenerateTopology(name string, params TopologyParams) (*ScenarioSpec, error) {
+	topologyLock.RLock()
+	generator, exists := topologyGenerators[name]
+	topologyLock.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTopology, name)
+	}
+	if params.Nodes < 1 || params.Density < 0 || params.Density > 1 || params.Degree < 0 || params.Regions < 0 || params.Regions > params.Nodes {
+		return nil, fmt.Errorf("%w: %+v", ErrInvalidTopology, params)
+	}
+	if params.Degree == 0 {
+		params.Degree = 1
+	}
+	if params.Regions == 0 {
+		params.Regions = 1
+	}
+	sc, err := generator(params)
+	if err != nil {
+		return nil, err
+	}
+	if sc.Name == "" {
+		sc.Name = fmt.Sprintf("%s-%d", name, params.Nodes)
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func init() {
+	RegisterTopology("complete", completeTopology)
+	RegisterTopology("ring", ringTopology)
+	RegisterTopology("star", starTopology)
+	RegisterTopology("erdos-renyi", erdosRenyiTopology)
+	RegisterTopology("small-world", smallWorldTopology)
+	RegisterTopology("regional", regionalTopology)
+}
+
+// topologyNodes returns n nodes named N1, N2, ... with zero-padded numbers,
+// so they sort in order, spread over regions in contiguous blocks
+func topologyNodes(n, regions int) []ScenarioNode {
+	width := len(fmt.Sprint(n))
+	nodes := make([]ScenarioNode, n)
+	for i := range nodes {
+		nodes[i] = ScenarioNode{
+			ID:     fmt.Sprintf("N%0*d", width, i+1),
+			Region: fmt.Sprintf("region-%d", i*regions/n+1),
+		}
+	}
+	return nodes
+}
+
+// topologyScenario assembles a scenario from nodes and links between node
+// indexes, skipping self-links and duplicates
+func topologyScenario(nodes []ScenarioNode, links [][2]int) *ScenarioSpec {
+	sc := &ScenarioSpec{Leader: nodes[0].ID, Nodes: nodes}
+	seen := make(map[[2]int]bool)
+	for _, link := range links {
+		a, b := min(link[0], link[1]), max(link[0], link[1])
+		if a == b || seen[[2]int{a, b}] {
+			continue
+		}
+		seen[[2]int{a, b}] = true
+		sc.Links = append(sc.Links, ScenarioLink{From: nodes[a].ID, To: nodes[b].ID})
+	}
+	sort.Slice(sc.Links, func(i, j int) bool {
+		if sc.Links[i].From != sc.Links[j].From {
+			return sc.Links[i].From < sc.Links[j].From
+		}
+		return sc.Links[i].To < sc.Links[j].To
+	})
+	return sc
+}
+
+// ringLinks links every node to the degree nodes after it, wrapping around
+func ringLinks(n, degree int) [][2]int {
+	var links [][2]int
+	for i := 0; i < n; i++ {
+		for d := 1; d <= degree && d < n; d++ {
+			links = append(links, [2]int{i, (i + d) % n})
+		}
+	}
+	return links
+}
+
+func completeTopology(p TopologyParams) (*ScenarioSpec, error) {
+	var links [][2]int
+	for i := 0; i < p.Nodes; i++ {
+		for j := i + 1; j < p.Nodes; j++ {
+			links = append(links, [2]int{i, j})
+		}
+	}
+	return topologyScenario(topologyNodes(p.Nodes, p.Regions), links), nil
+}
+
+func ringTopology(p TopologyParams) (*ScenarioSpec, error) {
+	return topologyScenario(topologyNodes(p.Nodes, p.Regions), ringLinks(p.Nodes, p.Degree)), nil
+}
+
+func starTopology(p TopologyParams) (*ScenarioSpec, error) {
+	var links [][2]int
+	for i := 1; i < p.Nodes; i++ {
+		links = append(links, [2]int{0, i})
+	}
+	return topologyScenario(topologyNodes(p.Nodes, p.Regions), links), nil
+}
+
+func erdosRenyiTopology(p TopologyParams) (*ScenarioSpec, error) {
+	rng := rand.New(rand.NewSource(p.Seed))
+	var links [][2]int
+	for i := 0; i < p.Nodes; i++ {
+		for j := i + 1; j < p.Nodes; j++ {
+			if rng.Float64() < p.Density {
+				links = append(links, [2]int{i, j})
+			}
+		}
+	}
+	return topologyScenario(topologyNodes(p.Nodes, p.Regions), links), nil
+}
+
+func smallWorldTopology(p TopologyParams) (*ScenarioSpec, error) {
+	rng := rand.New(rand.NewSource(p.Seed))
+	links := ringLinks(p.Nodes, p.Degree)
+	linked := make(map[[2]int]bool)
+	for _, link := range links {
+		linked[[2]int{min(link[0], link[1]), max(link[0], link[1])}] = true
+	}
+	for i, link := range links {
+		if p.Nodes < 3 || rng.Float64() >= p.Density {
+			continue
+		}
+		// Rewire the far end to a node the near end is not linked to yet
+		to := rng.Intn(p.Nodes)
+		key := [2]int{min(link[0], to), max(link[0], to)}
+		if to == link[0] || linked[key] {
+			continue
+		}
+		delete(linked, [2]int{min(link[0], link[1]), max(link[0], link[1])})
+		linked[key] = true
+		links[i] = [2]int{link[0], to}
+	}
+	return topologyScenario(topologyNodes(p.Nodes, p.Regions), links), nil
+}
+
+func regionalTopology(p TopologyParams) (*ScenarioSpec, error) {
+	nodes := topologyNodes(p.Nodes, p.Regions)
+	var links [][2]int
+	var gateways []int
+	for i := range nodes {
+		if i == 0 || nodes[i].Region != nodes[i-1].Region {
+			gateways = append(gateways, i)
+		}
+		for j := i - 1; j >= 0 && nodes[j].Region == nodes[i].Region; j-- {
+			links = append(links, [2]int{j, i})
+		}
+	}
+	for i, a := range gateways {
+		for _, b := range gateways[i+1:] {
+			links = append(links, [2]int{a, b})
+		}
+	}
+	return topologyScenario(nodes, links), nil
+}
+
+// TopologyCommand implements `wahello topology [-kind name] [-n nodes]
+// [-density p] [-degree k] [-regions r] [-byzantine k] [-strategy name]
+// [-seed n]`, printing the scenario as JSON for -scenario
+func TopologyCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("topology", flag.ContinueOnError)
+	kind := flags.String("kind", "small-world", fmt.Sprintf("generator, one of %v", Topologies()))
+	var params TopologyParams
+	flags.IntVar(&params.Nodes, "n", 16, "number of nodes")
+	flags.Float64Var(&params.Density, "density", 0.2, "link or rewiring probability")
+	flags.IntVar(&params.Degree, "degree", 2, "neighbors on either side in rings")
+	flags.IntVar(&params.Regions, "regions", 1, "regions to spread the nodes over")
+	flags.Int64Var(&params.Seed, "seed", 1, "seed of the random choices")
+	byzantine := flags.Int("byzantine", 0, "number of Byzantine nodes, the last ones")
+	strategy := flags.String("strategy", "timestamp-inflation", fmt.Sprintf("strategy of the Byzantine nodes, one of %v", StrategyNames))
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	sc, err := GenerateTopology(*kind, params)
+	if err != nil {
+		return err
+	}
+	if *byzantine > 0 {
+		if err := sc.SetByzantine(*byzantine, *strategy); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, string(data))
+	return err
+}
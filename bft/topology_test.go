@@ -0,0 +1,113 @@
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// degrees counts the links of every node
+func degrees(sc *ScenarioSpec) map[string]int {
+	degree := make(map[string]int)
+	for _, link := range sc.Links {
+		degree[link.From]++
+		degree[link.To]++
+	}
+	return degree
+}
+
+// TestRegularTopologies tests the shape of the ring, star and regional topologies
+func TestRegularTopologies(t *testing.T) {
+	ring, err := GenerateTopology("ring", TopologyParams{Nodes: 10, Degree: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.Name != "ring-10" || ring.Leader != "N01" || len(ring.Links) != 20 {
+		t.Errorf("Expected ring-10 led by N01 with 20 links, got %s led by %s with %d", ring.Name, ring.Leader, len(ring.Links))
+	}
+	for id, degree := range degrees(ring) {
+		if degree != 4 {
+			t.Errorf("Expected every ring node to have 4 neighbors, %s has %d", id, degree)
+		}
+	}
+
+	star, err := GenerateTopology("star", TopologyParams{Nodes: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if degree := degrees(star); len(star.Links) != 4 || degree["N1"] != 4 {
+		t.Errorf("Expected 4 links all at N1, got %v", star.Links)
+	}
+
+	regional, err := GenerateTopology("regional", TopologyParams{Nodes: 7, Regions: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regional.Regions() != "N1,N2,N3 (region-1), N4,N5 (region-2), N6,N7 (region-3)" {
+		t.Errorf("Unexpected regions %s", regional.Regions())
+	}
+	// Meshes of 3, 1 and 1 links inside the regions, and a backbone of 3
+	if len(regional.Links) != 8 {
+		t.Errorf("Expected 8 links, got %v", regional.Links)
+	}
+}
+
+// TestRandomTopologies tests that random topologies follow their density and seed
+func TestRandomTopologies(t *testing.T) {
+	dense, err := GenerateTopology("erdos-renyi", TopologyParams{Nodes: 40, Density: 0.5, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pairs := 40 * 39 / 2; len(dense.Links) < pairs*4/10 || len(dense.Links) > pairs*6/10 {
+		t.Errorf("Expected about half of the %d pairs linked, got %d", pairs, len(dense.Links))
+	}
+	empty, _ := GenerateTopology("erdos-renyi", TopologyParams{Nodes: 40, Seed: 1})
+	if len(empty.Links) != 0 {
+		t.Errorf("Expected no links at density 0, got %d", len(empty.Links))
+	}
+
+	world := func(seed int64) *ScenarioSpec {
+		sc, err := GenerateTopology("small-world", TopologyParams{Nodes: 30, Degree: 2, Density: 0.3, Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sc
+	}
+	ring, _ := GenerateTopology("ring", TopologyParams{Nodes: 30, Degree: 2})
+	if first := world(1); !reflect.DeepEqual(first, world(1)) || reflect.DeepEqual(first.Links, ring.Links) {
+		t.Errorf("Expected the same seed to rewire the ring the same way")
+	} else if len(first.Links) != len(ring.Links) {
+		t.Errorf("Expected rewiring to keep the %d links, got %d", len(ring.Links), len(first.Links))
+	}
+}
+
+// TestTopologyErrors tests unknown generators, bad parameters and duplicate registration
+func TestTopologyErrors(t *testing.T) {
+	if _, err := GenerateTopology("hypercube", TopologyParams{Nodes: 8}); !errors.Is(err, ErrUnknownTopology) {
+		t.Errorf("Expected ErrUnknownTopology, got %v", err)
+	}
+	for _, params := range []TopologyParams{{}, {Nodes: 4, Density: 2}, {Nodes: 2, Regions: 3}} {
+		if _, err := GenerateTopology("ring", params); !errors.Is(err, ErrInvalidTopology) {
+			t.Errorf("Expected ErrInvalidTopology for %+v, got %v", params, err)
+		}
+	}
+	if err := RegisterTopology("ring", ringTopology); !errors.Is(err, ErrTopologyRegistered) {
+		t.Errorf("Expected ErrTopologyRegistered, got %v", err)
+	}
+}
+
+// TestTopologyCommand tests that the printed scenario loads back
+func TestTopologyCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := TopologyCommand([]string{"-kind", "regional", "-n", "9", "-regions", "3"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := ParseScenario(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.Build(NewSystem(), 1); err != nil || len(sc.Nodes) != 9 {
+		t.Errorf("Expected a 9-node scenario that builds, got %d nodes: %v", len(sc.Nodes), err)
+	}
+}
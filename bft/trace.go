@@ -0,0 +1,178 @@
+package bft
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of a trace event
+type EventType string
+
+const (
+	EventSend       EventType = "send"
+	EventReceive    EventType = "receive"
+	EventApply      EventType = "apply"
+	EventReject     EventType = "reject"
+	EventViolation  EventType = "violation"   // An invariant was violated
+	EventWarning    EventType = "warning"     // A soft expectation was missed
+	EventDetection  EventType = "detection"   // Byzantine behavior was detected
+	EventFenced     EventType = "fenced"      // A node was fenced after a panic
+	EventCommit     EventType = "commit"      // A write or consensus slot was committed
+	EventViewChange EventType = "view-change" // A new leader or primary took over
+)
+
+// TraceEvent is one step of a run in the simulator's event format
+type TraceEvent struct {
+	Seq    uint64        `json:"seq"`
+	At     time.Duration `json:"at"` // Offset from the start of the run
+	Type   EventType     `json:"type"`
+	View   int64         `json:"view,omitempty"` // System view when the event happened
+	Node   string        `json:"node"`
+	Peer   string        `json:"peer,omitempty"`
+	Update *ClockUpdate  `json:"update,omitempty"`
+	Detail string        `json:"detail,omitempty"`
+}
+
+// TraceConfig bounds the memory a trace may use. The zero value keeps every
+// event.
+//
+// With Tail > 0 the trace runs in ring mode: the first Head events are kept,
+// the most recent Tail events are kept in a ring buffer, and everything in
+// between is discarded as it ages out. Events after the head enter the ring
+// with probability SampleRate (1 when zero). Events for which AlwaysRetain
+// returns true bypass sampling and eviction entirely, so the anomalies worth
+// investigating survive even in very long runs.
+type TraceConfig struct {
+	Head         int
+	Tail         int
+	SampleRate   float64
+	Seed         int64
+	AlwaysRetain func(event TraceEvent) bool
+}
+
+// RetainAnomalies keeps invariant violations, Byzantine detections and fencing
+func RetainAnomalies(event TraceEvent) bool {
+	return event.Type == EventViolation || event.Type == EventDetection || event.Type == EventFenced
+}
+
+// Trace records the events of a run in order
+type Trace struct {
+	Config   TraceConfig
+	Now      func() time.Duration // Time source, defaults to time since creation
+	Dropped  uint64               // Events discarded by sampling or eviction
+	Lock     sync.Mutex
+	start    time.Time
+	next     uint64
+	head     []TraceEvent
+	ring     []TraceEvent
+	ringNext int
+	retained []TraceEvent
+	rng      *rand.Rand
+}
+
+// NewTrace creates a trace that keeps every event
+func NewTrace() *Trace {
+	return NewBoundedTrace(TraceConfig{})
+}
+
+// NewBoundedTrace creates a trace with the given retention settings
+func NewBoundedTrace(config TraceConfig) *Trace {
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		config.SampleRate = 1
+	}
+	tr := &Trace{
+		Config: config,
+		start:  time.Now(),
+		rng:    rand.New(rand.NewSource(config.Seed)),
+	}
+	tr.Now = func() time.Duration { return time.Since(tr.start) }
+	return tr
+}
+
+// Record appends an event, assigning its sequence number and, if unset, its time
+func (tr *Trace) Record(event TraceEvent) {
+	tr.Lock.Lock()
+	defer tr.Lock.Unlock()
+	event.Seq = tr.next
+	tr.next++
+	if event.At == 0 {
+		event.At = tr.Now()
+	}
+
+	if tr.Config.Tail <= 0 {
+		tr.head = append(tr.head, event)
+		return
+	}
+	if len(tr.head) < tr.Config.Head {
+		tr.head = append(tr.head, event)
+		return
+	}
+	if tr.Config.AlwaysRetain != nil && tr.Config.AlwaysRetain(event) {
+		tr.retained = append(tr.retained, event)
+		return
+	}
+	if tr.Config.SampleRate < 1 && tr.rng.Float64() >= tr.Config.SampleRate {
+		tr.Dropped++
+		return
+	}
+	if len(tr.ring) < tr.Config.Tail {
+		tr.ring = append(tr.ring, event)
+		return
+	}
+	tr.ring[tr.ringNext] = event
+	tr.ringNext = (tr.ringNext + 1) % tr.Config.Tail
+	tr.Dropped++
+}
+
+// Recorded returns the total number of events recorded, retained or not
+func (tr *Trace) Recorded() uint64 {
+	tr.Lock.Lock()
+	defer tr.Lock.Unlock()
+	return tr.next
+}
+
+// Snapshot returns a copy of the retained events in sequence order
+func (tr *Trace) Snapshot() []TraceEvent {
+	tr.Lock.Lock()
+	defer tr.Lock.Unlock()
+	events := make([]TraceEvent, 0, len(tr.head)+len(tr.retained)+len(tr.ring))
+	events = append(events, tr.head...)
+	events = append(events, tr.retained...)
+	events = append(events, tr.ring...)
+	sort.Slice(events, func(i, j int) bool { return events[i].Seq < events[j].Seq })
+	return events
+}
+
+// Clone returns an independent copy of the trace sharing its time source
+func (tr *Trace) Clone() *Trace {
+	tr.Lock.Lock()
+	defer tr.Lock.Unlock()
+	clone := &Trace{
+		Config:   tr.Config,
+		Now:      tr.Now,
+		Dropped:  tr.Dropped,
+		start:    tr.start,
+		next:     tr.next,
+		head:     append([]TraceEvent(nil), tr.head...),
+		ring:     append([]TraceEvent(nil), tr.ring...),
+		ringNext: tr.ringNext,
+		retained: append([]TraceEvent(nil), tr.retained...),
+		rng:      rand.New(rand.NewSource(tr.Config.Seed + int64(tr.next))),
+	}
+	return clone
+}
+
+// trace records an event if the system keeps a trace, logs it and streams
+// it. The caller must not hold s.Lock.
+func (s *System) trace(event TraceEvent) {
+	s.Lock.RLock()
+	event.View = s.View
+	s.Lock.RUnlock()
+	s.logTrace(event)
+	s.Events.publish(event)
+	if s.Trace != nil {
+		s.Trace.Record(event)
+	}
+}
@@ -0,0 +1,93 @@
+package bft
+
+import (
+	"testing"
+)
+
+// TestTraceKeepsEverythingByDefault tests the unbounded trace mode
+func TestTraceKeepsEverythingByDefault(t *testing.T) {
+	trace := NewTrace()
+	for i := 0; i < 1000; i++ {
+		trace.Record(TraceEvent{Type: EventSend, Node: "A"})
+	}
+	if events := trace.Snapshot(); len(events) != 1000 || trace.Dropped != 0 {
+		t.Errorf("Expected all 1000 events, got %d (dropped %d)", len(events), trace.Dropped)
+	}
+}
+
+// TestRingTraceRetention tests head/tail retention and always-retained anomalies
+func TestRingTraceRetention(t *testing.T) {
+	trace := NewBoundedTrace(TraceConfig{Head: 10, Tail: 20, AlwaysRetain: RetainAnomalies})
+	for i := 0; i < 10000; i++ {
+		event := TraceEvent{Type: EventSend, Node: "A"}
+		if i == 5000 {
+			event = TraceEvent{Type: EventViolation, Detail: "leader partitioned"}
+		}
+		trace.Record(event)
+	}
+
+	events := trace.Snapshot()
+	if len(events) != 31 {
+		t.Fatalf("Expected head + tail + 1 anomaly = 31 events, got %d", len(events))
+	}
+	if events[0].Seq != 0 || events[9].Seq != 9 {
+		t.Errorf("Expected the head to hold the first 10 events")
+	}
+	if events[10].Type != EventViolation || events[10].Seq != 5000 {
+		t.Errorf("Expected the violation to be retained in order, got %+v", events[10])
+	}
+	if events[11].Seq != 9980 || events[30].Seq != 9999 {
+		t.Errorf("Expected the tail to hold the last 20 events, got %d..%d", events[11].Seq, events[30].Seq)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Seq <= events[i-1].Seq {
+			t.Fatalf("Expected snapshot in sequence order")
+		}
+	}
+	if trace.Recorded() != 10000 || trace.Dropped != 10000-31 {
+		t.Errorf("Expected 10000 recorded and %d dropped, got %d and %d", 10000-31, trace.Recorded(), trace.Dropped)
+	}
+}
+
+// TestRingTraceSampling tests probabilistic sampling after the head
+func TestRingTraceSampling(t *testing.T) {
+	trace := NewBoundedTrace(TraceConfig{Tail: 100000, SampleRate: 0.1, Seed: 1, AlwaysRetain: RetainAnomalies})
+	for i := 0; i < 10000; i++ {
+		trace.Record(TraceEvent{Type: EventSend})
+	}
+	trace.Record(TraceEvent{Type: EventDetection, Node: "F"})
+
+	events := trace.Snapshot()
+	if len(events) < 800 || len(events) > 1200 {
+		t.Errorf("Expected roughly 10%% of events to be sampled, got %d", len(events))
+	}
+	if last := events[len(events)-1]; last.Type != EventDetection {
+		t.Errorf("Expected detection to bypass sampling, got %+v", last)
+	}
+}
+
+// TestChaosViolationIsTraced tests that invariant violations reach the trace
+func TestChaosViolationIsTraced(t *testing.T) {
+	run := newChaosRun()
+	var trace *Trace
+	build := run.Build
+	run.Build = func() (*System, error) {
+		system, err := build()
+		if err == nil {
+			trace = NewBoundedTrace(TraceConfig{Tail: 4, AlwaysRetain: RetainAnomalies})
+			system.Trace = trace
+		}
+		return system, err
+	}
+	run.Run(Schedule{{At: 2, Kind: FaultPartition, Nodes: []string{"A"}}})
+
+	found := false
+	for _, event := range trace.Snapshot() {
+		if event.Type == EventViolation {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the violation to be retained in the bounded trace")
+	}
+}
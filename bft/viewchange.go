@@ -0,0 +1,214 @@
+package bft
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// View-change payloads.
+//
+// An entry that is prepared (pre-prepared and matched by 2f+1 prepares) in
+// some view may already be committed at a replica. A new leader that simply
+// starts proposing fresh requests could assign a different value to that
+// sequence number and break safety. Instead, every replica's VIEW-CHANGE
+// carries the certificates for the entries it has prepared, and the NEW-VIEW
+// built from 2f+1 of them re-proposes, for every sequence number, the
+// prepared entry from the highest view. Sequence numbers below the maximum
+// with no certificate are filled with null proposals. A replica that
+// compacted its log (see compaction.go) carries the quorum-signed summary as
+// its checkpoint instead of the certificates it covers, and proposals start
+// above the highest valid checkpoint. Followers rebuild the
+// proposals from the included view changes, so a faulty leader cannot
+// silently drop a prepared entry. Certificates carry the signatures of the
+// pre-prepare and the prepares they are made of, checked against the
+// replicas' keys. A certificate that fails the check, or that is from the
+// view the change asks for or later, is ignored: a faulty replica can neither
+// make one up nor block the view change by sending one, and an honest
+// replica's certificates for a committed entry are enough to keep it.
+
+var (
+	ErrNotEnoughViewChanges = errors.New("not enough view-change messages")
+
+	ErrInvalidCertificate = errors.New("invalid prepared certificate")
+	ErrNewViewMismatch    = errors.New("new-view proposals do not match view changes")
+)
+
+// PreparedCert proves that an entry was prepared in a view
+type PreparedCert struct {
+	View     int64
+	Seq      uint64
+	Digest   string
+	Payload  []byte
+	Prepares []string // Replicas whose matching prepares form the certificate, the primary first
+	// Signatures of the replicas in Prepares, in order, over View, Seq and
+	// Digest: the primary's pre-prepare, then the backups' prepares
+	Signatures []string
+}
+
+// ViewChange is a replica's request to move to View, carrying its prepared entries
+type ViewChange struct {
+	View       int64
+	Replica    string
+	Prepared   []PreparedCert // Above Checkpoint
+	Checkpoint *LogSummary    // Latest summary the replica compacted through, nil if none
+	// Signature is the replica's over View, the checkpoint's last sequence
+	// number and the encoded Prepared
+	Signature string
+}
+
+// Proposal is an entry the new leader re-proposes. A null proposal has no
+// payload and only fills a sequence gap.
+type Proposal struct {
+	View    int64
+	Seq     uint64
+	Digest  string
+	Payload []byte
+	// Signature is the leader's pre-prepare signature over View, Seq and
+	// Digest, which certificates prepared in the new view carry
+	Signature string
+}
+
+// NewView installs a view together with the proof for its proposals
+type NewView struct {
+	View        int64
+	Leader      string
+	ViewChanges []ViewChange
+	Stable      uint64 // Highest valid checkpoint of the view changes, the proposals start above it
+	Proposals   []Proposal
+}
+
+// PayloadDigest returns the hex digest identifying a payload
+func PayloadDigest(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// stable returns the last sequence number of the change's checkpoint
+func (c *ViewChange) stable() uint64 {
+	if c.Checkpoint == nil {
+		return 0
+	}
+	return c.Checkpoint.To
+}
+
+// IsNull reports whether the proposal only fills a gap
+func (p Proposal) IsNull() bool {
+	return p.Payload == nil
+}
+
+// Valid checks the certificate against the fault threshold f and the
+// replicas' keys. Only distinct replicas with a valid signature count.
+func (c *PreparedCert) Valid(f int, keys map[string]crypto.PublicKey) error {
+	if PayloadDigest(c.Payload) != c.Digest {
+		return fmt.Errorf("%w: digest mismatch at seq %d", ErrInvalidCertificate, c.Seq)
+	}
+	if len(c.Signatures) != len(c.Prepares) {
+		return fmt.Errorf("%w: %d signatures for %d prepares at seq %d", ErrInvalidCertificate, len(c.Signatures), len(c.Prepares), c.Seq)
+	}
+	seen := make(map[string]bool)
+	for i, replica := range c.Prepares {
+		phase := "prepare"
+		if i == 0 {
+			phase = "pre-prepare"
+		}
+		key, exists := keys[replica]
+		if !exists || crypto.Verify(key, phaseDigest(phase, c.View, c.Seq, c.Digest, replica), c.Signatures[i]) != nil {
+			return fmt.Errorf("%w: bad %s signature from %s at seq %d", ErrInvalidCertificate, phase, replica, c.Seq)
+		}
+		seen[replica] = true
+	}
+	if len(seen) < 2*f+1 {
+		return fmt.Errorf("%w: %d prepares at seq %d, need %d", ErrInvalidCertificate, len(seen), c.Seq, 2*f+1)
+	}
+	return nil
+}
+
+// BuildNewView assembles the NEW-VIEW message for view from at least 2f+1
+// view changes, keeping only one message per replica. Certificates are
+// checked against the replicas' keys, and those that fail are left out.
+func BuildNewView(view int64, leader string, changes []ViewChange, f int, keys map[string]crypto.PublicKey) (*NewView, error) {
+	selected := make([]ViewChange, 0, len(changes))
+	seen := make(map[string]bool)
+	for _, change := range changes {
+		if change.View != view || seen[change.Replica] {
+			continue
+		}
+		seen[change.Replica] = true
+		selected = append(selected, change)
+	}
+	if len(selected) < 2*f+1 {
+		return nil, fmt.Errorf("%w: have %d, need %d", ErrNotEnoughViewChanges, len(selected), 2*f+1)
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Replica < selected[j].Replica })
+
+	var stable uint64
+	for _, change := range selected {
+		if change.stable() > stable && VerifySummary(change.Checkpoint, keys) == nil {
+			stable = change.stable()
+		}
+	}
+	return &NewView{
+		View:        view,
+		Leader:      leader,
+		ViewChanges: selected,
+		Stable:      stable,
+		Proposals:   reproposals(view, stable, selected, f, keys),
+	}, nil
+}
+
+// Verify checks that the proposals follow from the included view changes
+func (nv *NewView) Verify(f int, keys map[string]crypto.PublicKey) error {
+	rebuilt, err := BuildNewView(nv.View, nv.Leader, nv.ViewChanges, f, keys)
+	if err != nil {
+		return err
+	}
+	if rebuilt.Stable != nv.Stable || len(rebuilt.Proposals) != len(nv.Proposals) {
+		return ErrNewViewMismatch
+	}
+	for i, proposal := range rebuilt.Proposals {
+		other := nv.Proposals[i]
+		if proposal.Seq != other.Seq || proposal.Digest != other.Digest || proposal.View != other.View || !bytes.Equal(proposal.Payload, other.Payload) {
+			return fmt.Errorf("%w at seq %d", ErrNewViewMismatch, proposal.Seq)
+		}
+	}
+	return nil
+}
+
+// reproposals picks, for each sequence number above stable, the prepared
+// entry from the highest view and fills gaps with null proposals.
+// Certificates that are invalid or not from a view before the new one are
+// skipped.
+func reproposals(view int64, stable uint64, changes []ViewChange, f int, keys map[string]crypto.PublicKey) []Proposal {
+	best := make(map[uint64]PreparedCert)
+	maxSeq := stable
+	for _, change := range changes {
+		for _, cert := range change.Prepared {
+			if cert.Seq <= stable || cert.View >= view || cert.Valid(f, keys) != nil {
+				continue
+			}
+			if current, exists := best[cert.Seq]; !exists || cert.View > current.View {
+				best[cert.Seq] = cert
+			}
+			if cert.Seq > maxSeq {
+				maxSeq = cert.Seq
+			}
+		}
+	}
+
+	proposals := make([]Proposal, 0, maxSeq-stable)
+	for seq := stable + 1; seq <= maxSeq; seq++ {
+		cert, exists := best[seq]
+		if !exists {
+			proposals = append(proposals, Proposal{View: view, Seq: seq, Digest: PayloadDigest(nil)})
+			continue
+		}
+		proposals = append(proposals, Proposal{View: view, Seq: seq, Digest: cert.Digest, Payload: cert.Payload})
+	}
+	return proposals
+}
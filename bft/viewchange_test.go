@@ -0,0 +1,193 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fernandokarnagi/wahello/bft/crypto"
+)
+
+// certNodes sign the certificates built by certFor, and certKeys check them
+var certNodes, certKeys = func() (map[string]*Node, map[string]crypto.PublicKey) {
+	nodes, keys := make(map[string]*Node), make(map[string]crypto.PublicKey)
+	for _, id := range []string{"A", "B", "C", "D"} {
+		node, err := NewNode(id, false, false)
+		if err != nil {
+			panic(err)
+		}
+		nodes[id], keys[id] = node, node.PublicKey
+	}
+	return nodes, keys
+}()
+
+// certFor builds a prepared certificate for payload at seq in view, signed
+// by the first of prepares as primary and the others as backups
+func certFor(view int64, seq uint64, payload string, prepares ...string) PreparedCert {
+	cert := PreparedCert{
+		View:     view,
+		Seq:      seq,
+		Digest:   PayloadDigest([]byte(payload)),
+		Payload:  []byte(payload),
+		Prepares: prepares,
+	}
+	for i, replica := range prepares {
+		phase := "prepare"
+		if i == 0 {
+			phase = "pre-prepare"
+		}
+		signature, _ := crypto.Sign(certNodes[replica].PrivateKey, phaseDigest(phase, view, seq, cert.Digest, replica))
+		cert.Signatures = append(cert.Signatures, signature)
+	}
+	return cert
+}
+
+// divergentReplicas returns the replicas whose entry at seq differs from reference's
+func divergentReplicas(committed map[string]string, reference string) []string {
+	var divergent []string
+	for replica, digest := range committed {
+		if digest != committed[reference] {
+			divergent = append(divergent, replica)
+		}
+	}
+	return divergent
+}
+
+// TestViewChangePreservesCommittedEntry shows naive view change losing a committed entry
+func TestViewChangePreservesCommittedEntry(t *testing.T) {
+	const f = 1
+	// View 0: leader A's X was prepared at A, B and C, and committed at A only
+	committedX := PayloadDigest([]byte("X"))
+	prepared := certFor(0, 1, "X", "A", "B", "C")
+
+	// A is cut off; B, C and D move to view 1 led by B
+	changes := []ViewChange{
+		{View: 1, Replica: "B", Prepared: []PreparedCert{prepared}},
+		{View: 1, Replica: "C", Prepared: []PreparedCert{prepared}},
+		{View: 1, Replica: "D"},
+	}
+
+	// Naive view change: B ignores the certificates and assigns its next request Y to seq 1
+	naive := map[string]string{"A": committedX}
+	for _, replica := range []string{"B", "C", "D"} {
+		naive[replica] = PayloadDigest([]byte("Y"))
+	}
+	if len(divergentReplicas(naive, "A")) != 3 {
+		t.Fatalf("Expected naive view change to diverge from A's committed entry")
+	}
+
+	newView, err := BuildNewView(1, "B", changes, f, certKeys)
+	if err != nil {
+		t.Fatalf("BuildNewView failed: %v", err)
+	}
+	if err := newView.Verify(f, certKeys); err != nil {
+		t.Fatalf("Expected new view to verify, got %v", err)
+	}
+	if len(newView.Proposals) != 1 {
+		t.Fatalf("Expected one re-proposal, got %d", len(newView.Proposals))
+	}
+	safe := map[string]string{"A": committedX}
+	for _, replica := range []string{"B", "C", "D"} {
+		safe[replica] = newView.Proposals[0].Digest
+	}
+	if divergent := divergentReplicas(safe, "A"); len(divergent) != 0 {
+		t.Errorf("Replicas %v committed a different entry at seq 1: safety violated", divergent)
+	}
+}
+
+// TestNewViewPicksHighestViewAndFillsGaps tests certificate selection and null proposals
+func TestNewViewPicksHighestViewAndFillsGaps(t *testing.T) {
+	changes := []ViewChange{
+		{View: 3, Replica: "A", Prepared: []PreparedCert{certFor(1, 1, "old", "A", "B", "C"), certFor(1, 3, "Z", "A", "B", "D")}},
+		{View: 3, Replica: "B", Prepared: []PreparedCert{certFor(2, 1, "new", "B", "C", "D")}},
+		{View: 3, Replica: "C"},
+		{View: 3, Replica: "C"}, // Duplicates are ignored
+	}
+	newView, err := BuildNewView(3, "D", changes, 1, certKeys)
+	if err != nil {
+		t.Fatalf("BuildNewView failed: %v", err)
+	}
+	if len(newView.Proposals) != 3 {
+		t.Fatalf("Expected proposals for seq 1..3, got %d", len(newView.Proposals))
+	}
+	if string(newView.Proposals[0].Payload) != "new" {
+		t.Errorf("Expected seq 1 to carry the entry prepared in the higher view")
+	}
+	if !newView.Proposals[1].IsNull() {
+		t.Errorf("Expected seq 2 to be a null proposal")
+	}
+	if string(newView.Proposals[2].Payload) != "Z" || newView.Proposals[2].View != 3 {
+		t.Errorf("Expected seq 3 to be re-proposed in view 3, got %+v", newView.Proposals[2])
+	}
+}
+
+// TestNewViewRejectsBadInput tests quorum and tampering checks
+func TestNewViewRejectsBadInput(t *testing.T) {
+	if _, err := BuildNewView(1, "B", []ViewChange{{View: 1, Replica: "B"}, {View: 1, Replica: "C"}}, 1, certKeys); !errors.Is(err, ErrNotEnoughViewChanges) {
+		t.Errorf("Expected ErrNotEnoughViewChanges, got %v", err)
+	}
+
+	changes := []ViewChange{
+		{View: 1, Replica: "B", Prepared: []PreparedCert{certFor(0, 1, "X", "A", "B", "C")}},
+		{View: 1, Replica: "C"}, {View: 1, Replica: "D"},
+	}
+	newView, err := BuildNewView(1, "B", changes, 1, certKeys)
+	if err != nil {
+		t.Fatalf("BuildNewView failed: %v", err)
+	}
+	// A faulty leader replacing the prepared entry is caught by followers
+	newView.Proposals[0].Digest = PayloadDigest([]byte("Y"))
+	if err := newView.Verify(1, certKeys); !errors.Is(err, ErrNewViewMismatch) {
+		t.Errorf("Expected ErrNewViewMismatch, got %v", err)
+	}
+	// So is one keeping the digest but replacing the payload
+	newView.Proposals[0].Digest = PayloadDigest([]byte("X"))
+	newView.Proposals[0].Payload = []byte("Y")
+	if err := newView.Verify(1, certKeys); !errors.Is(err, ErrNewViewMismatch) {
+		t.Errorf("Expected a swapped payload to give ErrNewViewMismatch, got %v", err)
+	}
+}
+
+// TestNewViewIgnoresInvalidCertificates tests that bad certificates are
+// left out without blocking the view change or hiding valid ones
+func TestNewViewIgnoresInvalidCertificates(t *testing.T) {
+	weak := certFor(0, 1, "X", "A", "A", "B")
+	// Names alone do not make a certificate: C's signature is D's
+	forged := certFor(0, 2, "Y", "A", "B", "C")
+	forged.Signatures[2] = certFor(0, 2, "Y", "A", "B", "D").Signatures[2]
+	fromNewView := certFor(1, 3, "Z", "B", "C", "D")
+	if weak.Valid(1, certKeys) == nil || forged.Valid(1, certKeys) == nil {
+		t.Fatalf("Expected the weak and forged certificates to be invalid")
+	}
+
+	changes := []ViewChange{
+		{View: 1, Replica: "B", Prepared: []PreparedCert{weak, forged, fromNewView}},
+		{View: 1, Replica: "C", Prepared: []PreparedCert{certFor(0, 1, "X", "A", "B", "C")}},
+		{View: 1, Replica: "D"},
+	}
+	newView, err := BuildNewView(1, "B", changes, 1, certKeys)
+	if err != nil {
+		t.Fatalf("Expected invalid certificates not to block the new view, got %v", err)
+	}
+	if err := newView.Verify(1, certKeys); err != nil {
+		t.Errorf("Expected the new view to verify, got %v", err)
+	}
+	if len(newView.Proposals) != 1 || string(newView.Proposals[0].Payload) != "X" {
+		t.Errorf("Expected only C's valid certificate to be re-proposed, got %+v", newView.Proposals)
+	}
+}
+
+// TestNewViewIgnoresUnsignedCheckpoint tests that a checkpoint without a quorum's signatures cannot hide prepared entries
+func TestNewViewIgnoresUnsignedCheckpoint(t *testing.T) {
+	changes := []ViewChange{
+		{View: 1, Replica: "B", Checkpoint: &LogSummary{From: 1, To: 10, Count: 10}},
+		{View: 1, Replica: "C", Prepared: []PreparedCert{certFor(0, 1, "X", "A", "B", "C")}},
+		{View: 1, Replica: "D"},
+	}
+	newView, err := BuildNewView(1, "B", changes, 1, certKeys)
+	if err != nil {
+		t.Fatalf("BuildNewView failed: %v", err)
+	}
+	if newView.Stable != 0 || len(newView.Proposals) != 1 || string(newView.Proposals[0].Payload) != "X" {
+		t.Errorf("Expected the unsigned checkpoint to be ignored, got stable %d and %+v", newView.Stable, newView.Proposals)
+	}
+}
@@ -0,0 +1,435 @@
+package bft
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Write-ahead log.
+//
+// The log is a single file of records, each laid out as
+//
+//	seq (8 bytes) | length (4 bytes) | crc32 (4 bytes) | payload
+//
+// in big-endian order with strictly increasing sequence numbers. Alongside it
+// an index file holds one 16-byte index block (seq, offset) for every
+// IndexInterval-th record, letting readers jump close to any sequence number
+// instead of scanning from the start.
+//
+// Durability is governed by a SyncPolicy. An Append is acknowledged as soon
+// as the record is written, but only records covered by an fsync survive a
+// crash of the machine:
+//
+//   - SyncPerCommit fsyncs before every Append returns. No acknowledged
+//     record is ever lost, at the cost of one fsync per commit.
+//   - SyncGroup fsyncs in the background every Interval. Appends are cheap,
+//     but records acknowledged within the last Interval can be lost.
+//   - SyncOSCached never fsyncs and leaves flushing to the operating system.
+//     Anything not yet written back by the OS can be lost, which may be
+//     every record since the log was opened.
+//
+// A failed fsync is sticky. The records it covered may or may not be on
+// disk, and retrying cannot tell, so the log refuses every Append and Sync
+// after it with ErrWALSync. Under group sync this reaches the writers whose
+// records were in the failed group, which were acknowledged before the
+// fsync ran, as soon as they append or sync again.
+//
+// Crash simulates power loss by discarding everything written after the
+// last fsync, so the crash-recovery fault mode shows exactly which policies
+// lose acknowledged writes.
+
+const (
+	walFile   = "wal.log"
+	indexFile = "wal.idx"
+
+	recordHeaderSize = 16
+	indexBlockSize   = 16
+
+	// IndexInterval is the number of records between index blocks
+	IndexInterval = 64
+	// MaxRecordSize bounds payloads so a corrupt length cannot exhaust memory
+	MaxRecordSize = 64 << 20
+)
+
+// SyncMode selects when the log is fsynced
+type SyncMode int
+
+const (
+	SyncPerCommit SyncMode = iota
+	SyncGroup
+	SyncOSCached
+)
+
+// SyncPolicy is a durability policy for the log
+type SyncPolicy struct {
+	Mode     SyncMode
+	Interval time.Duration // Group fsync interval for SyncGroup
+}
+
+// String names the policy, e.g. "group(5ms)"
+func (p SyncPolicy) String() string {
+	switch p.Mode {
+	case SyncPerCommit:
+		return "per-commit"
+	case SyncGroup:
+		return fmt.Sprintf("group(%v)", p.Interval)
+	case SyncOSCached:
+		return "os-cached"
+	}
+	return fmt.Sprintf("SyncMode(%d)", int(p.Mode))
+}
+
+var (
+	ErrWALCorrupt  = errors.New("wal record is corrupt")
+	ErrWALSequence = errors.New("wal sequence numbers must increase")
+	ErrWALSync     = errors.New("wal fsync failed")
+)
+
+// WALRecord is a single log record
+type WALRecord struct {
+	Seq     uint64
+	Payload []byte
+}
+
+// WAL is an append-only write-ahead log in a directory
+type WAL struct {
+	Dir     string
+	file    *os.File
+	index   *os.File
+	offset  int64
+	lastSeq uint64
+	count   int
+	policy  SyncPolicy
+	synced  int64 // Offset up to which the log is known to be on disk
+	syncErr error // First failed fsync, refusing every later write
+	stop    chan struct{}
+	done    chan struct{}
+	keyring *Keyring // Seals payloads if set, see OpenEncryptedWAL
+	Lock    sync.Mutex
+}
+
+// OpenWAL opens or creates the log in dir, positioning at its end
+func OpenWAL(dir string, policy SyncPolicy) (*WAL, error) {
+	if policy.Mode == SyncGroup && policy.Interval <= 0 {
+		return nil, fmt.Errorf("group sync requires a positive interval")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, walFile), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	index, err := os.OpenFile(filepath.Join(dir, indexFile), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w := &WAL{Dir: dir, file: file, index: index, policy: policy}
+
+	// Find the end of the valid log, dropping any torn tail, and rebuild the
+	// index so it always matches the log
+	if err := index.Truncate(0); err != nil {
+		w.Close()
+		return nil, err
+	}
+	var indexErr error
+	err = scanRecords(file, 0, func(rec WALRecord, offset int64, size int) bool {
+		if w.count%IndexInterval == 0 {
+			if indexErr = w.writeIndexBlock(rec.Seq, offset); indexErr != nil {
+				return false
+			}
+		}
+		w.offset = offset + int64(size)
+		w.lastSeq = rec.Seq
+		w.count++
+		return true
+	})
+	if err == nil {
+		err = indexErr
+	}
+	if err != nil && !errors.Is(err, ErrWALCorrupt) {
+		w.Close()
+		return nil, err
+	}
+	if err := file.Truncate(w.offset); err != nil {
+		w.Close()
+		return nil, err
+	}
+	// Whatever survived to be read back is on disk
+	w.synced = w.offset
+
+	if policy.Mode == SyncGroup {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.groupSync()
+	}
+	return w, nil
+}
+
+// groupSync fsyncs the log every policy interval until the log is closed
+func (w *WAL) groupSync() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			// A failure is kept for the writers to see, see sync
+			w.Lock.Lock()
+			w.sync()
+			w.Lock.Unlock()
+		}
+	}
+}
+
+// sync fsyncs the log, failing for good once an fsync failed. The caller
+// must hold w.Lock.
+func (w *WAL) sync() error {
+	if w.syncErr != nil {
+		return w.syncErr
+	}
+	if w.synced == w.offset {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		w.syncErr = fmt.Errorf("%w: %s: %v", ErrWALSync, w.Dir, err)
+		return w.syncErr
+	}
+	w.synced = w.offset
+	return nil
+}
+
+// Sync forces an fsync regardless of policy
+func (w *WAL) Sync() error {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	return w.sync()
+}
+
+// Policy returns the log's durability policy
+func (w *WAL) Policy() SyncPolicy {
+	return w.policy
+}
+
+// Append writes a record to the end of the log
+func (w *WAL) Append(seq uint64, payload []byte) error {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+
+	if w.syncErr != nil {
+		return w.syncErr
+	}
+	if w.keyring != nil {
+		sealed, err := w.keyring.Seal(walAAD(seq), payload)
+		if err != nil {
+			return err
+		}
+		payload = sealed
+	}
+	if len(payload) > MaxRecordSize {
+		return fmt.Errorf("wal payload of %d bytes exceeds %d", len(payload), MaxRecordSize)
+	}
+	if w.count > 0 && seq <= w.lastSeq {
+		return fmt.Errorf("%w: %d after %d", ErrWALSequence, seq, w.lastSeq)
+	}
+	buf := encodeRecord(seq, payload)
+	if _, err := w.file.WriteAt(buf, w.offset); err != nil {
+		return err
+	}
+	if w.count%IndexInterval == 0 {
+		if err := w.writeIndexBlock(seq, w.offset); err != nil {
+			return err
+		}
+	}
+	w.offset += int64(len(buf))
+	w.lastSeq = seq
+	w.count++
+	if w.policy.Mode == SyncPerCommit {
+		return w.sync()
+	}
+	return nil
+}
+
+// LastSeq returns the sequence number of the last record, or 0 if empty
+func (w *WAL) LastSeq() uint64 {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	return w.lastSeq
+}
+
+// Close closes the log files. A clean close counts as a flush: the operating
+// system eventually writes back everything, so nothing acknowledged is lost.
+func (w *WAL) Close() error {
+	w.stopGroupSync()
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	w.synced = w.offset
+	return w.closeFiles()
+}
+
+// Crash simulates a machine crash: every record written after the last
+// fsync is lost and the log is closed. Reopen the directory to recover.
+func (w *WAL) Crash() error {
+	w.stopGroupSync()
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	if err := w.file.Truncate(w.synced); err != nil {
+		return err
+	}
+	return w.closeFiles()
+}
+
+func (w *WAL) stopGroupSync() {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+		w.stop = nil
+	}
+}
+
+func (w *WAL) closeFiles() error {
+	err := w.file.Close()
+	if indexErr := w.index.Close(); err == nil {
+		err = indexErr
+	}
+	return err
+}
+
+func (w *WAL) writeIndexBlock(seq uint64, offset int64) error {
+	var block [indexBlockSize]byte
+	binary.BigEndian.PutUint64(block[0:8], seq)
+	binary.BigEndian.PutUint64(block[8:16], uint64(offset))
+	_, err := w.index.WriteAt(block[:], int64(w.count/IndexInterval)*indexBlockSize)
+	return err
+}
+
+func encodeRecord(seq uint64, payload []byte) []byte {
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint64(buf[0:8], seq)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeaderSize:], payload)
+	return buf
+}
+
+// decodeRecord decodes the record at the start of buf and returns its size
+func decodeRecord(buf []byte) (WALRecord, int, error) {
+	if len(buf) < recordHeaderSize {
+		return WALRecord{}, 0, ErrWALCorrupt
+	}
+	length := int(binary.BigEndian.Uint32(buf[8:12]))
+	if length > MaxRecordSize || len(buf) < recordHeaderSize+length {
+		return WALRecord{}, 0, ErrWALCorrupt
+	}
+	payload := buf[recordHeaderSize : recordHeaderSize+length]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(buf[12:16]) {
+		return WALRecord{}, 0, ErrWALCorrupt
+	}
+	return WALRecord{
+		Seq:     binary.BigEndian.Uint64(buf[0:8]),
+		Payload: payload,
+	}, recordHeaderSize + length, nil
+}
+
+// scanRecords reads records sequentially from offset, calling fn for each
+// until it returns false or the log ends. A torn or corrupt record ends the
+// scan with ErrWALCorrupt.
+func scanRecords(file *os.File, offset int64, fn func(rec WALRecord, offset int64, size int) bool) error {
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, 1<<62))
+	var header [recordHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return ErrWALCorrupt
+		}
+		length := int(binary.BigEndian.Uint32(header[8:12]))
+		if length > MaxRecordSize {
+			return ErrWALCorrupt
+		}
+		buf := make([]byte, recordHeaderSize+length)
+		copy(buf, header[:])
+		if _, err := io.ReadFull(reader, buf[recordHeaderSize:]); err != nil {
+			return ErrWALCorrupt
+		}
+		rec, size, err := decodeRecord(buf)
+		if err != nil {
+			return err
+		}
+		if !fn(rec, offset, size) {
+			return nil
+		}
+		offset += int64(size)
+	}
+}
+
+// ReadRangeNaive returns the records with from <= seq <= to by scanning the
+// whole log from the beginning
+func ReadRangeNaive(dir string, from, to uint64) ([]WALRecord, error) {
+	file, err := os.Open(filepath.Join(dir, walFile))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []WALRecord
+	err = scanRecords(file, 0, func(rec WALRecord, _ int64, _ int) bool {
+		if rec.Seq > to {
+			return false
+		}
+		if rec.Seq >= from {
+			records = append(records, rec)
+		}
+		return true
+	})
+	return records, err
+}
+
+// CrashRecoveryResult reports how many acknowledged records a crash lost
+type CrashRecoveryResult struct {
+	Policy       SyncPolicy
+	Acknowledged int
+	Recovered    int
+	Lost         int
+}
+
+// RunCrashRecovery appends records to a fresh log in dir under the given
+// policy, crashes it, reopens it and counts the acknowledged records lost
+func RunCrashRecovery(dir string, policy SyncPolicy, writes int) (*CrashRecoveryResult, error) {
+	wal, err := OpenWAL(dir, policy)
+	if err != nil {
+		return nil, err
+	}
+	result := &CrashRecoveryResult{Policy: policy}
+	for seq := 1; seq <= writes; seq++ {
+		if err := wal.Append(uint64(seq), []byte(fmt.Sprintf("write-%d", seq))); err != nil {
+			wal.Close()
+			return nil, err
+		}
+		result.Acknowledged++
+	}
+	if err := wal.Crash(); err != nil {
+		return nil, err
+	}
+
+	recovered, err := OpenWAL(dir, policy)
+	if err != nil {
+		return nil, err
+	}
+	defer recovered.Close()
+	result.Recovered = int(recovered.LastSeq())
+	result.Lost = result.Acknowledged - result.Recovered
+	return result, nil
+}
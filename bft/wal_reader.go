@@ -0,0 +1,113 @@
+package bft
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// MmapReader reads a WAL through memory-mapped log and index files. Locating
+// a sequence number is a binary search over the index blocks followed by a
+// scan of at most IndexInterval records, so state transfer and recovery can
+// fetch any range without reading the log from the beginning.
+//
+// A reader sees the log as it was when opened; reopen it to observe later
+// appends.
+type MmapReader struct {
+	log     []byte
+	index   []byte
+	unmap   []func() error
+	files   []*os.File
+	entries int
+}
+
+// OpenMmapReader maps the WAL in dir for reading
+func OpenMmapReader(dir string) (*MmapReader, error) {
+	r := &MmapReader{}
+	for _, name := range []string{walFile, indexFile} {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.files = append(r.files, file)
+		data, unmap, err := mapFile(file)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.unmap = append(r.unmap, unmap)
+		if name == walFile {
+			r.log = data
+		} else {
+			r.index = data
+		}
+	}
+	r.entries = len(r.index) / indexBlockSize
+	return r, nil
+}
+
+// Close unmaps and closes the underlying files
+func (r *MmapReader) Close() error {
+	var firstErr error
+	for _, unmap := range r.unmap {
+		if err := unmap(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, file := range r.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	r.unmap, r.files, r.log, r.index = nil, nil, nil, nil
+	return firstErr
+}
+
+func (r *MmapReader) indexBlock(i int) (uint64, int64) {
+	block := r.index[i*indexBlockSize : (i+1)*indexBlockSize]
+	return binary.BigEndian.Uint64(block[0:8]), int64(binary.BigEndian.Uint64(block[8:16]))
+}
+
+// seek returns the offset of the last index block whose sequence is <= seq.
+// An offset outside the log means the index is corrupt.
+func (r *MmapReader) seek(seq uint64) (int64, error) {
+	i := sort.Search(r.entries, func(i int) bool {
+		blockSeq, _ := r.indexBlock(i)
+		return blockSeq > seq
+	})
+	if i == 0 {
+		return 0, nil
+	}
+	_, offset := r.indexBlock(i - 1)
+	if offset < 0 || offset > int64(len(r.log)) {
+		return 0, fmt.Errorf("%w: index block %d points at offset %d past the log", ErrWALCorrupt, i-1, offset)
+	}
+	return offset, nil
+}
+
+// ReadRange returns the records with from <= seq <= to. Payloads alias the
+// mapped log and are only valid until the reader is closed.
+func (r *MmapReader) ReadRange(from, to uint64) ([]WALRecord, error) {
+	var records []WALRecord
+	offset, err := r.seek(from)
+	if err != nil {
+		return nil, err
+	}
+	for offset < int64(len(r.log)) {
+		rec, size, err := decodeRecord(r.log[offset:])
+		if err != nil {
+			return records, err
+		}
+		if rec.Seq > to {
+			break
+		}
+		if rec.Seq >= from {
+			records = append(records, rec)
+		}
+		offset += int64(size)
+	}
+	return records, nil
+}
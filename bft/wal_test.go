@@ -0,0 +1,283 @@
+package bft
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeWAL creates a log in a temp dir with records seq = 1..n
+func writeWAL(tb testing.TB, n int) string {
+	dir := tb.TempDir()
+	wal, err := OpenWAL(dir, SyncPolicy{Mode: SyncOSCached})
+	if err != nil {
+		tb.Fatalf("Failed to open WAL: %v", err)
+	}
+	for seq := 1; seq <= n; seq++ {
+		if err := wal.Append(uint64(seq), []byte(fmt.Sprintf("entry-%d", seq))); err != nil {
+			tb.Fatalf("Append failed: %v", err)
+		}
+	}
+	if err := wal.Close(); err != nil {
+		tb.Fatalf("Close failed: %v", err)
+	}
+	return dir
+}
+
+// TestWALReadersAgree tests that the mmap reader returns the same ranges as a full scan
+func TestWALReadersAgree(t *testing.T) {
+	dir := writeWAL(t, 1000)
+	reader, err := OpenMmapReader(dir)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer reader.Close()
+
+	ranges := [][2]uint64{{1, 1}, {1, 64}, {64, 65}, {500, 520}, {990, 2000}, {2000, 3000}}
+	for _, rng := range ranges {
+		naive, err := ReadRangeNaive(dir, rng[0], rng[1])
+		if err != nil {
+			t.Fatalf("Naive read failed: %v", err)
+		}
+		mapped, err := reader.ReadRange(rng[0], rng[1])
+		if err != nil {
+			t.Fatalf("Mapped read failed: %v", err)
+		}
+		if len(naive) != len(mapped) {
+			t.Fatalf("Range %v: naive returned %d records, mmap %d", rng, len(naive), len(mapped))
+		}
+		for i := range naive {
+			if naive[i].Seq != mapped[i].Seq || string(naive[i].Payload) != string(mapped[i].Payload) {
+				t.Errorf("Range %v: record %d differs", rng, i)
+			}
+		}
+	}
+}
+
+// TestWALRejectsOutOfOrderAppend tests that sequence numbers must increase
+func TestWALRejectsOutOfOrderAppend(t *testing.T) {
+	wal, err := OpenWAL(t.TempDir(), SyncPolicy{Mode: SyncPerCommit})
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	defer wal.Close()
+	if err := wal.Append(5, nil); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := wal.Append(5, nil); err == nil {
+		t.Errorf("Expected duplicate sequence to be rejected")
+	}
+}
+
+// TestWALRecoversFromTornTail tests that a partially written record is dropped on reopen
+func TestWALRecoversFromTornTail(t *testing.T) {
+	dir := writeWAL(t, 100)
+	path := filepath.Join(dir, walFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+
+	wal, err := OpenWAL(dir, SyncPolicy{Mode: SyncPerCommit})
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	if wal.LastSeq() != 99 {
+		t.Errorf("Expected last sequence 99 after dropping torn record, got %d", wal.LastSeq())
+	}
+	if err := wal.Append(100, []byte("rewritten")); err != nil {
+		t.Fatalf("Append after recovery failed: %v", err)
+	}
+	wal.Close()
+
+	reader, err := OpenMmapReader(dir)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer reader.Close()
+	records, err := reader.ReadRange(100, 100)
+	if err != nil || len(records) != 1 || string(records[0].Payload) != "rewritten" {
+		t.Errorf("Expected rewritten record 100, got %v (%v)", records, err)
+	}
+}
+
+// TestWALReaderRejectsCorruptIndex tests that an index offset past the log is reported, not followed
+func TestWALReaderRejectsCorruptIndex(t *testing.T) {
+	dir := writeWAL(t, 200)
+	index, err := os.OpenFile(filepath.Join(dir, indexFile), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	var offset [8]byte
+	binary.BigEndian.PutUint64(offset[:], 1<<63)
+	if _, err := index.WriteAt(offset[:], indexBlockSize+8); err != nil {
+		t.Fatalf("Failed to corrupt index: %v", err)
+	}
+	index.Close()
+
+	reader, err := OpenMmapReader(dir)
+	if err != nil {
+		t.Fatalf("Failed to open reader: %v", err)
+	}
+	defer reader.Close()
+	if _, err := reader.ReadRange(IndexInterval+1, IndexInterval+2); !errors.Is(err, ErrWALCorrupt) {
+		t.Errorf("Expected ErrWALCorrupt for an out-of-range index offset, got %v", err)
+	}
+	if records, err := reader.ReadRange(1, 2); err != nil || len(records) != 2 {
+		t.Errorf("Expected reads before the corrupt block to succeed, got %d records (%v)", len(records), err)
+	}
+}
+
+// TestWALCrashRecoveryBySyncPolicy tests which durability policies lose acknowledged writes
+func TestWALCrashRecoveryBySyncPolicy(t *testing.T) {
+	tests := []struct {
+		policy SyncPolicy
+		lost   int
+	}{
+		{SyncPolicy{Mode: SyncPerCommit}, 0},
+		// The interval never elapses, so nothing is fsynced before the crash
+		{SyncPolicy{Mode: SyncGroup, Interval: time.Hour}, 20},
+		{SyncPolicy{Mode: SyncOSCached}, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			result, err := RunCrashRecovery(t.TempDir(), tt.policy, 20)
+			if err != nil {
+				t.Fatalf("Crash recovery failed: %v", err)
+			}
+			if result.Lost != tt.lost {
+				t.Errorf("Expected %d lost writes, got %d", tt.lost, result.Lost)
+			}
+		})
+	}
+}
+
+// TestWALGroupSyncPersistsAfterInterval tests that group sync covers writes once the interval passes
+func TestWALGroupSyncPersistsAfterInterval(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := OpenWAL(dir, SyncPolicy{Mode: SyncGroup, Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	for seq := uint64(1); seq <= 5; seq++ {
+		if err := wal.Append(seq, []byte("x")); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		wal.Lock.Lock()
+		synced := wal.synced == wal.offset
+		wal.Lock.Unlock()
+		if synced || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := wal.Crash(); err != nil {
+		t.Fatalf("Crash failed: %v", err)
+	}
+	recovered, err := OpenWAL(dir, SyncPolicy{Mode: SyncPerCommit})
+	if err != nil {
+		t.Fatalf("Failed to reopen WAL: %v", err)
+	}
+	defer recovered.Close()
+	if recovered.LastSeq() != 5 {
+		t.Errorf("Expected all 5 writes to survive after a group sync, got %d", recovered.LastSeq())
+	}
+}
+
+// TestWALGroupSyncFailureIsSticky tests that once a background fsync fails,
+// every later append and sync reports it
+func TestWALGroupSyncFailureIsSticky(t *testing.T) {
+	wal, err := OpenWAL(t.TempDir(), SyncPolicy{Mode: SyncGroup, Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	defer wal.Close()
+	if err := wal.Append(1, []byte("x")); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	// Closing the file under the log makes the next fsync fail
+	wal.Lock.Lock()
+	wal.file.Close()
+	wal.Lock.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for {
+		wal.Lock.Lock()
+		failed := wal.syncErr != nil
+		wal.Lock.Unlock()
+		if failed || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := wal.Append(2, []byte("y")); !errors.Is(err, ErrWALSync) {
+		t.Errorf("Expected the failed group sync to refuse the next append, got %v", err)
+	}
+	if err := wal.Sync(); !errors.Is(err, ErrWALSync) {
+		t.Errorf("Expected the failed group sync to refuse a sync, got %v", err)
+	}
+}
+
+// BenchmarkWALReadRangeNaive measures reading a range near the end by full scan
+func BenchmarkWALReadRangeNaive(b *testing.B) {
+	dir := writeWAL(b, 100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadRangeNaive(dir, 99000, 99010); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWALReadRangeMmap measures reading the same range through the index
+func BenchmarkWALReadRangeMmap(b *testing.B) {
+	dir := writeWAL(b, 100000)
+	reader, err := OpenMmapReader(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer reader.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := reader.ReadRange(99000, 99010); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkWALAppend measures append throughput under a durability policy
+func benchmarkWALAppend(b *testing.B, policy SyncPolicy) {
+	wal, err := OpenWAL(b.TempDir(), policy)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer wal.Close()
+	payload := make([]byte, 128)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := wal.Append(uint64(i+1), payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWALAppendPerCommit(b *testing.B) {
+	benchmarkWALAppend(b, SyncPolicy{Mode: SyncPerCommit})
+}
+
+func BenchmarkWALAppendGroup(b *testing.B) {
+	benchmarkWALAppend(b, SyncPolicy{Mode: SyncGroup, Interval: 5 * time.Millisecond})
+}
+
+func BenchmarkWALAppendOSCached(b *testing.B) {
+	benchmarkWALAppend(b, SyncPolicy{Mode: SyncOSCached})
+}
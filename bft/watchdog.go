@@ -0,0 +1,163 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Progress watchdog.
+//
+// A run that stops making progress without ending, because the nodes wait
+// on each other (deadlock) or keep exchanging messages and firing timers
+// without getting anywhere (livelock), would otherwise only show as a
+// missing result or a run that never returns. A Watchdog attached to a
+// scheduler fails such a run instead. The engine reports progress to the
+// scheduler whenever a replica executes a submitted request or a node
+// applies a clock update. If the next event lies more than Window of
+// virtual time past the last progress, the run is livelocked; if the queue
+// drains while Busy still reports outstanding work, it is deadlocked.
+// Either way Run stops and returns a StallReport with the state of every
+// node, the pending timers and the messages still in flight, and the
+// stalled run's events are dropped.
+
+var ErrNoProgress = errors.New("simulation made no progress")
+
+// DefaultWatchdogWindow is how long a run may go without progress
+const DefaultWatchdogWindow = 10 * time.Second
+
+// StallKind is how a run stopped making progress
+type StallKind string
+
+const (
+	StallDeadlock StallKind = "deadlock" // Nothing left to run, work outstanding
+	StallLivelock StallKind = "livelock" // Events keep running, nothing progresses
+)
+
+// Watchdog watches a scheduler for runs that stop making progress
+type Watchdog struct {
+	Window   time.Duration   // Virtual time without progress, DefaultWatchdogWindow if zero
+	System   *System         // Whose nodes to dump, if set
+	Busy     func() bool     // Reports outstanding work; without it a drained queue never stalls
+	Describe func() []string // More state to dump, a line per item
+}
+
+// QueuedEvent is an event still scheduled when the run stalled
+type QueuedEvent struct {
+	At    time.Duration
+	Label string
+}
+
+// StallReport is the watchdog's diagnosis of a stalled run
+type StallReport struct {
+	Kind         StallKind
+	At           time.Duration // Virtual time the watchdog fired
+	LastProgress time.Duration
+	Nodes        []NodeState
+	State        []string // From Describe
+	Timers       []QueuedEvent
+	Messages     []QueuedEvent
+}
+
+func (r *StallReport) Error() string {
+	return fmt.Sprintf("%v: %s at %v, last progress at %v, %d timers and %d messages queued",
+		ErrNoProgress, r.Kind, r.At, r.LastProgress, len(r.Timers), len(r.Messages))
+}
+
+func (r *StallReport) Unwrap() error {
+	return ErrNoProgress
+}
+
+// String dumps the report, a section per kind of state
+func (r *StallReport) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, r.Error())
+	if len(r.Nodes) > 0 {
+		fmt.Fprintln(&b, "Nodes:")
+		for _, node := range r.Nodes {
+			fmt.Fprintf(&b, "  %s: commit index %d, %d entries, clock %v", node.ID, node.CommitIndex, node.Entries, node.VectorClock)
+			if node.IsByzantine {
+				b.WriteString(", byzantine")
+			}
+			b.WriteString("\n")
+		}
+	}
+	for _, line := range r.State {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	for _, section := range []struct {
+		name   string
+		events []QueuedEvent
+	}{{"Timers", r.Timers}, {"Messages", r.Messages}} {
+		if len(section.events) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", section.name)
+		for _, event := range section.events {
+			fmt.Fprintf(&b, "  %v %s\n", event.At, event.Label)
+		}
+	}
+	return b.String()
+}
+
+// Watch attaches w to the scheduler, counting the time without progress
+// from now. It clears the stall of an earlier run, so a scheduler shared
+// by several runs can go on after one of them failed.
+func (s *Scheduler) Watch(w *Watchdog) {
+	s.Watchdog = w
+	s.progress = s.Now
+	s.err = nil
+}
+
+// window returns the time allowed without progress
+func (w *Watchdog) window() time.Duration {
+	if w.Window == 0 {
+		return DefaultWatchdogWindow
+	}
+	return w.Window
+}
+
+// stall builds the report of a run that stopped progressing
+func (w *Watchdog) stall(s *Scheduler, kind StallKind) *StallReport {
+	report := &StallReport{Kind: kind, At: s.Now, LastProgress: s.progress}
+	if kind == StallLivelock {
+		// The next event would have run past the window
+		report.At = s.queue[0].at
+	}
+	if w.System != nil {
+		w.System.Lock.RLock()
+		for _, id := range sortedKeys(w.System.Nodes) {
+			report.Nodes = append(report.Nodes, dumpState(w.System.Nodes[id]))
+		}
+		w.System.Lock.RUnlock()
+	}
+	if w.Describe != nil {
+		report.State = w.Describe()
+	}
+	queued := append(eventQueue(nil), s.queue...)
+	sort.Sort(queued)
+	for _, e := range queued {
+		label := e.label
+		if label == "" {
+			label = "event"
+		}
+		if e.message {
+			report.Messages = append(report.Messages, QueuedEvent{At: e.at, Label: label})
+		} else {
+			report.Timers = append(report.Timers, QueuedEvent{At: e.at, Label: label})
+		}
+	}
+	return report
+}
+
+// stallReport returns the full dump of a stalled run's error, or the error
+// itself if it is not a stall
+func stallReport(err error) string {
+	var report *StallReport
+	if errors.As(err, &report) {
+		return report.String()
+	}
+	return err.Error() + "\n"
+}
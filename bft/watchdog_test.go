@@ -0,0 +1,89 @@
+package bft
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWatchdogLivelock tests that a run whose timers keep firing without progress is stopped
+func TestWatchdogLivelock(t *testing.T) {
+	s := NewScheduler(1)
+	s.Watch(&Watchdog{Window: 5 * time.Second})
+	var tick func()
+	tick = func() { s.Timer(time.Second, "tick", tick) }
+	tick()
+	s.Deliver(time.Minute, "hello A->B", func() {})
+
+	err := s.Run()
+	var report *StallReport
+	if !errors.As(err, &report) || !errors.Is(err, ErrNoProgress) || report.Kind != StallLivelock {
+		t.Fatalf("Expected a livelock, got %v", err)
+	}
+	if report.At != 6*time.Second || report.LastProgress != 0 {
+		t.Errorf("Expected the watchdog to fire at 6s with no progress, got %v and %v", report.At, report.LastProgress)
+	}
+	if len(report.Timers) != 1 || report.Timers[0].Label != "tick" || len(report.Messages) != 1 || report.Messages[0].Label != "hello A->B" {
+		t.Errorf("Expected the tick and the message still queued, got %+v and %+v", report.Timers, report.Messages)
+	}
+	if s.Step() || s.Err() != err || s.Pending() != 0 {
+		t.Errorf("Expected the stopped run to be abandoned")
+	}
+	executed := s.Executed
+	s.Watch(&Watchdog{})
+	s.After(time.Second, func() {})
+	if err := s.Run(); err != nil || s.Executed != executed+1 {
+		t.Errorf("Expected a new watch to run again, got %v after %d events", err, s.Executed-executed)
+	}
+}
+
+// TestWatchdogProgress tests that reported progress keeps the watchdog quiet
+func TestWatchdogProgress(t *testing.T) {
+	s := NewScheduler(1)
+	s.Watch(&Watchdog{Window: 5 * time.Second, Busy: func() bool { return false }})
+	for i := 1; i <= 20; i++ {
+		s.After(time.Duration(i)*time.Second, s.Progress)
+	}
+	if err := s.Run(); err != nil || s.Now != 20*time.Second {
+		t.Errorf("Expected the run to finish at 20s, got %v at %v", err, s.Now)
+	}
+}
+
+// TestWatchdogPBFTStall tests that a PBFT run without a quorum is stopped with the replicas' state
+func TestWatchdogPBFTStall(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.ViewTimeout = time.Hour
+	pbft.Watch(2 * time.Hour)
+	for _, id := range []string{"C", "D"} {
+		if err := pbft.System.ApplyFault(FaultStep{Kind: FaultCrash, Nodes: []string{id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pbft.Submit([]byte("op-1"))
+
+	err := pbft.Run()
+	var report *StallReport
+	if !errors.As(err, &report) {
+		t.Fatalf("Expected the run to stall without a quorum, got %v", err)
+	}
+	dump := report.String()
+	for _, want := range []string{"Nodes:", "A: commit index", "Replica B: view", "Timers:"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("Expected the dump to contain %q:\n%s", want, dump)
+		}
+	}
+	if len(report.Nodes) != 4 || len(report.State) != 4 {
+		t.Errorf("Expected all four nodes and replicas in the report, got %d and %d", len(report.Nodes), len(report.State))
+	}
+}
+
+// TestWatchdogPBFTCommits tests that a healthy PBFT run passes the watchdog
+func TestWatchdogPBFTCommits(t *testing.T) {
+	pbft := newPBFT(t)
+	pbft.Watch(time.Second)
+	digest, _ := pbft.Submit([]byte("op-1"))
+	if err := pbft.Run(); err != nil || !pbft.Outcome(digest).Committed {
+		t.Errorf("Expected the request to commit without the watchdog firing, got %v", err)
+	}
+}
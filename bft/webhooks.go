@@ -0,0 +1,320 @@
+package bft
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operator webhooks.
+//
+// Automation outside the simulator reacts to the protocol through webhooks:
+// a leader change, the first time a node detects a Byzantine peer, the
+// cluster losing its commit quorum, and a partition healing are each POSTed
+// as JSON to every hook subscribed to that kind. Payloads are signed with
+// HMAC-SHA256 under the hook's shared secret, over the delivery timestamp
+// and the body, so a receiver checking them with VerifyWebhook knows the
+// event came from the cluster and is not a replay of an old one. Like audit
+// export, firing never stalls the protocol: events are queued for a
+// background sender, the newest dropped and counted if the queue is full,
+// and a delivery that fails on the network, with a 5xx or with a 429 is
+// retried with exponential backoff up to MaxAttempts times. Receivers
+// should be idempotent by the delivery ID, as a retried delivery may
+// already have arrived. Like the event stream, webhooks are attached to new
+// systems through DefaultWebhooks and not copied into clones.
+
+var (
+	ErrWebhookSignature = errors.New("webhook signature invalid")
+	ErrWebhookDelivery  = errors.New("webhook delivery failed")
+)
+
+// DefaultWebhooks is attached to new systems; nil fires nothing
+var DefaultWebhooks *Webhooks
+
+// Headers of a webhook delivery
+const (
+	WebhookSignatureHeader = "X-Wahello-Signature"
+	WebhookTimestampHeader = "X-Wahello-Timestamp"
+	WebhookDeliveryHeader  = "X-Wahello-Delivery"
+)
+
+// HookKind is the kind of event a webhook fires on
+type HookKind string
+
+const (
+	HookLeaderChange HookKind = "leader_change"
+	HookDetection    HookKind = "byzantine_detection"
+	HookQuorumLoss   HookKind = "quorum_loss"
+	HookHeal         HookKind = "heal"
+)
+
+// Webhook is an endpoint and the events it is sent
+type Webhook struct {
+	URL    string
+	Kinds  []HookKind // Every kind if empty
+	Secret []byte     // Signs deliveries
+}
+
+// subscribed reports whether the hook is sent events of kind
+func (h Webhook) subscribed(kind HookKind) bool {
+	if len(h.Kinds) == 0 {
+		return true
+	}
+	for _, k := range h.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// HookEvent is the payload of a webhook delivery
+type HookEvent struct {
+	ID     uint64    `json:"id"`
+	Time   time.Time `json:"time"`
+	Kind   HookKind  `json:"kind"`
+	View   int64     `json:"view"`
+	Node   string    `json:"node,omitempty"`
+	Peer   string    `json:"peer,omitempty"`
+	Detail string    `json:"detail"`
+}
+
+// WebhookStats counts what the dispatcher did with events
+type WebhookStats struct {
+	Delivered uint64 // Deliveries a hook accepted
+	Retried   uint64 // Attempts repeated after a failure
+	Failed    uint64 // Deliveries given up on
+	Dropped   uint64 // Events lost to a full queue
+}
+
+// Webhooks delivers protocol events to operator webhooks
+type Webhooks struct {
+	Hooks       []Webhook
+	MaxAttempts int           // Per delivery, including the first
+	Backoff     time.Duration // Delay before the first retry, doubled up to MaxBackoff
+	MaxBackoff  time.Duration
+	Client      *http.Client
+	Now         func() time.Time
+	OnFailure   func(hook Webhook, event HookEvent, err error) // Called when a delivery is given up on
+	Lock        sync.Mutex                                     // Guards the state events are fired from
+	detected    map[[2]string]bool                             // Detector and suspect pairs already fired
+	quorumLost  bool
+	start       sync.Once
+	next        atomic.Uint64
+	events      chan HookEvent
+	pending     atomic.Int64
+	delivered   atomic.Uint64
+	retried     atomic.Uint64
+	failed      atomic.Uint64
+	dropped     atomic.Uint64
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// NewWebhooks creates a dispatcher queueing up to capacity events. Its
+// sender starts on the first event, so fields may be adjusted until then.
+func NewWebhooks(capacity int, hooks ...Webhook) (*Webhooks, error) {
+	if capacity < 1 {
+		return nil, fmt.Errorf("webhook queue capacity must be positive")
+	}
+	for _, hook := range hooks {
+		if hook.URL == "" {
+			return nil, fmt.Errorf("webhook has no URL")
+		}
+	}
+	return &Webhooks{
+		Hooks:       hooks,
+		MaxAttempts: 5,
+		Backoff:     100 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+		Client:      &http.Client{Timeout: 5 * time.Second},
+		Now:         time.Now,
+		detected:    make(map[[2]string]bool),
+		events:      make(chan HookEvent, capacity),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// Fire queues an event for every hook subscribed to its kind
+func (w *Webhooks) Fire(event HookEvent) {
+	if w == nil {
+		return
+	}
+	w.start.Do(func() { go w.run() })
+	event.ID = w.next.Add(1)
+	if event.Time.IsZero() {
+		event.Time = w.Now()
+	}
+	w.pending.Add(1)
+	select {
+	case w.events <- event:
+	default:
+		w.pending.Add(-1)
+		w.dropped.Add(1)
+	}
+}
+
+// Stats returns the dispatcher's counters
+func (w *Webhooks) Stats() WebhookStats {
+	return WebhookStats{Delivered: w.delivered.Load(), Retried: w.retried.Load(), Failed: w.failed.Load(), Dropped: w.dropped.Load()}
+}
+
+// Flush waits until every fired event has been delivered or given up on
+func (w *Webhooks) Flush(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for w.pending.Load() > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %d events not delivered", ErrWebhookDelivery, w.pending.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// Close flushes for up to timeout and stops the sender
+func (w *Webhooks) Close(timeout time.Duration) error {
+	w.start.Do(func() { go w.run() })
+	err := w.Flush(timeout)
+	close(w.stop)
+	<-w.done
+	return err
+}
+
+// run delivers events in order, each to its hooks in turn
+func (w *Webhooks) run() {
+	defer close(w.done)
+	for {
+		select {
+		case event := <-w.events:
+			body, _ := json.Marshal(event)
+			for _, hook := range w.Hooks {
+				if !hook.subscribed(event.Kind) {
+					continue
+				}
+				if err := w.deliver(hook, event, body); err != nil {
+					w.failed.Add(1)
+					if w.OnFailure != nil {
+						w.OnFailure(hook, event, err)
+					}
+				}
+			}
+			w.pending.Add(-1)
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// deliver POSTs body to a hook, retrying failures that may be transient
+func (w *Webhooks) deliver(hook Webhook, event HookEvent, body []byte) error {
+	backoff := w.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		if retry, err = w.post(hook, event, body); err == nil {
+			w.delivered.Add(1)
+			return nil
+		}
+		if !retry || attempt >= w.MaxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-w.stop:
+			return err
+		}
+		w.retried.Add(1)
+		if backoff *= 2; backoff > w.MaxBackoff {
+			backoff = w.MaxBackoff
+		}
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying
+func (w *Webhooks) post(hook Webhook, event HookEvent, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrWebhookDelivery, err)
+	}
+	timestamp := strconv.FormatInt(w.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(event.ID, 10))
+	req.Header.Set(WebhookSignatureHeader, signWebhook(hook.Secret, timestamp, body))
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("%w: %v", ErrWebhookDelivery, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("%w: %s returned %s", ErrWebhookDelivery, hook.URL, resp.Status)
+}
+
+// signWebhook returns the signature header for a delivery
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks a delivery's signature against the shared secret and
+// that it was sent within tolerance of now, for receivers
+func VerifyWebhook(secret []byte, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+	timestamp := header.Get(WebhookTimestampHeader)
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp %q", ErrWebhookSignature, timestamp)
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: sent %s ago", ErrWebhookSignature, age)
+	}
+	if !hmac.Equal([]byte(header.Get(WebhookSignatureHeader)), []byte(signWebhook(secret, timestamp, body))) {
+		return ErrWebhookSignature
+	}
+	return nil
+}
+
+// notifyDetection fires the first detection of suspect by detector
+func (w *Webhooks) notifyDetection(view int64, detector, suspect, detail string) {
+	if w == nil {
+		return
+	}
+	w.Lock.Lock()
+	first := !w.detected[[2]string{detector, suspect}]
+	w.detected[[2]string{detector, suspect}] = true
+	w.Lock.Unlock()
+	if first {
+		w.Fire(HookEvent{Kind: HookDetection, View: view, Node: detector, Peer: suspect, Detail: detail})
+	}
+}
+
+// notifyQuorum fires when the leader loses its commit quorum, once until a
+// commit succeeds again
+func (w *Webhooks) notifyQuorum(view int64, leader string, err error) {
+	if w == nil {
+		return
+	}
+	w.Lock.Lock()
+	lost := err != nil && !w.quorumLost
+	w.quorumLost = err != nil
+	w.Lock.Unlock()
+	if lost {
+		w.Fire(HookEvent{Kind: HookQuorumLoss, View: view, Node: leader, Detail: err.Error()})
+	}
+}
@@ -0,0 +1,148 @@
+package bft
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookReceiver records the deliveries a test webhook endpoint accepted,
+// failing the first fail attempts with a 503
+type hookReceiver struct {
+	Secret []byte
+	fail   int
+	events []HookEvent
+	errs   []error
+	lock   sync.Mutex
+}
+
+func (r *hookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.fail > 0 {
+		r.fail--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	if err := VerifyWebhook(r.Secret, req.Header, body, time.Now(), time.Minute); err != nil {
+		r.errs = append(r.errs, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var event HookEvent
+	json.Unmarshal(body, &event)
+	r.events = append(r.events, event)
+}
+
+// newTestWebhooks serves receiver and returns webhooks delivering to it
+func newTestWebhooks(t *testing.T, receiver *hookReceiver, kinds ...HookKind) *Webhooks {
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	hooks, err := NewWebhooks(16, Webhook{URL: server.URL, Kinds: kinds, Secret: receiver.Secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks.Backoff = time.Millisecond
+	return hooks
+}
+
+// TestWebhooksOnProtocolEvents tests that leader changes, quorum loss and heals are delivered signed, quorum loss once
+func TestWebhooksOnProtocolEvents(t *testing.T) {
+	receiver := &hookReceiver{Secret: []byte("s3cret")}
+	hooks := newTestWebhooks(t, receiver)
+	system := newWorkloadSystem(t, 1)
+	system.Hooks = hooks
+
+	system.SetLeader("B")
+	system.SetPartition("C", true)
+	system.SetPartition("D", true)
+	for i := 0; i < 3; i++ {
+		if _, err := system.SubmitWrite("", "B", "x", "1"); !errors.Is(err, ErrNoQuorum) {
+			t.Fatalf("Expected ErrNoQuorum, got %v", err)
+		}
+	}
+	system.SetPartition("C", false)
+	system.SetPartition("D", false)
+	system.CreatePartition([]string{"A", "B"}, []string{"C", "D"})
+	system.HealPartition()
+	if err := hooks.Close(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []HookKind
+	for _, event := range receiver.events {
+		kinds = append(kinds, event.Kind)
+	}
+	want := []HookKind{HookLeaderChange, HookQuorumLoss, HookHeal}
+	if len(kinds) != len(want) || kinds[0] != want[0] || kinds[1] != want[1] || kinds[2] != want[2] {
+		t.Errorf("Expected %v, got %v", want, kinds)
+	}
+	if event := receiver.events[0]; event.Node != "B" || event.Peer != "A" {
+		t.Errorf("Expected the change from A to B, got %+v", event)
+	}
+	if len(receiver.errs) > 0 {
+		t.Errorf("Expected every delivery to verify, got %v", receiver.errs)
+	}
+}
+
+// TestWebhookDetectionFiredOnce tests that a detector reporting the same suspect again is not fired twice
+func TestWebhookDetectionFiredOnce(t *testing.T) {
+	receiver := &hookReceiver{Secret: []byte("s3cret")}
+	hooks := newTestWebhooks(t, receiver, HookDetection)
+	hooks.notifyDetection(1, "A", "F", "timestamp jump")
+	hooks.notifyDetection(1, "A", "F", "timestamp jump")
+	hooks.notifyDetection(1, "B", "F", "timestamp jump")
+	hooks.Fire(HookEvent{Kind: HookHeal})
+	hooks.Close(time.Second)
+	if len(receiver.events) != 2 {
+		t.Errorf("Expected one detection per detector and no heal, got %+v", receiver.events)
+	}
+}
+
+// TestWebhookRetry tests that a failing endpoint is retried until it accepts or attempts run out
+func TestWebhookRetry(t *testing.T) {
+	receiver := &hookReceiver{Secret: []byte("s3cret"), fail: 2}
+	hooks := newTestWebhooks(t, receiver)
+	hooks.Fire(HookEvent{Kind: HookHeal})
+	hooks.Flush(time.Second)
+	if stats := hooks.Stats(); stats.Delivered != 1 || stats.Retried != 2 || len(receiver.events) != 1 {
+		t.Errorf("Expected delivery on the third attempt, got %+v", stats)
+	}
+
+	receiver.fail = 10
+	var failed error
+	hooks.OnFailure = func(_ Webhook, _ HookEvent, err error) { failed = err }
+	hooks.Fire(HookEvent{Kind: HookHeal})
+	hooks.Close(time.Second)
+	if stats := hooks.Stats(); stats.Failed != 1 || !errors.Is(failed, ErrWebhookDelivery) {
+		t.Errorf("Expected the delivery to be given up on, got %+v, %v", stats, failed)
+	}
+}
+
+// TestVerifyWebhook tests that tampered, unsigned and stale deliveries are refused
+func TestVerifyWebhook(t *testing.T) {
+	secret := []byte("s3cret")
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"kind":"heal"}`)
+	header := http.Header{}
+	header.Set(WebhookTimestampHeader, "1700000000")
+	header.Set(WebhookSignatureHeader, signWebhook(secret, "1700000000", body))
+	if err := VerifyWebhook(secret, header, body, now, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyWebhook(secret, header, []byte(`{"kind":"quorum_loss"}`), now, time.Minute); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("Expected a tampered body to be refused, got %v", err)
+	}
+	if err := VerifyWebhook([]byte("other"), header, body, now, time.Minute); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("Expected another secret to be refused, got %v", err)
+	}
+	if err := VerifyWebhook(secret, header, body, now.Add(time.Hour), time.Minute); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("Expected a replayed delivery to be refused, got %v", err)
+	}
+}
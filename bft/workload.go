@@ -0,0 +1,414 @@
+package bft
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Client workloads.
+//
+// A Workload drives a system with simulated clients on its scheduler. Each
+// Client issues one operation at a time from its region, a read or a write
+// of one of its keys, at its configured rate: the next operation starts an
+// exponentially distributed think time after the previous one was invoked,
+// or when it completes if that is later. Operations take effect when they
+// are issued and complete their modeled latency later, so operations of
+// different clients overlap as they would against a real cluster.
+//
+// Stickiness decides which node a client contacts: always the leader, one
+// node picked at random and kept until a request through it fails, or a
+// random node for every request. A failed request is retried under the
+// client's RetryPolicy after an exponential backoff, until it succeeds or
+// runs out of attempts. Writes go through SubmitWrite; reads through
+// ReadIndex, or the contact's own store with LocalReads.
+//
+// Every operation is recorded in the workload's History under its client's
+// name, from invocation to the completion of its last attempt, ready for
+// DetectAnomalies and CheckLinearizability. The system's own History, if
+// set, records each attempt at the instant it is served.
+//
+// A client with a Timeout gives up on an operation whose reply takes
+// longer, without retrying: a write may have committed all the same. Each
+// write carries a request ID, the client's count of writes, and its outcome
+// goes to the system's OutcomeStore, if set, where the client can look it
+// up with Status or wait for it with Subscribe.
+
+var ErrNoScheduler = errors.New("system has no scheduler")
+
+// Stickiness is how a client picks the node it contacts
+type Stickiness string
+
+const (
+	StickToLeader Stickiness = "leader" // Always the current leader
+	StickToNode   Stickiness = "sticky" // A random node, kept until a request through it fails
+	StickToNone   Stickiness = "random" // A random node for every request
+)
+
+// RetryPolicy is how a client retries failed requests
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts per operation, 1 if zero
+	Backoff     time.Duration // Wait before the first retry, doubling for each one after
+}
+
+func (p RetryPolicy) attempts() int {
+	return max(p.MaxAttempts, 1)
+}
+
+// ClientStats count what a client did
+type ClientStats struct {
+	Reads    int
+	Writes   int
+	Retries  int
+	Failed   int // Operations that failed on every attempt
+	Switches int // Times a sticky client dropped its node
+	TimedOut int // Operations given up on while their reply was on its way
+}
+
+// Client issues operations against a system from one region
+type Client struct {
+	Name       string
+	Region     string
+	Rate       float64  // Operations per second, none if not positive
+	ReadRatio  float64  // Share of operations that are reads
+	Keys       []string // Keys operated on, "x" if empty
+	Stickiness Stickiness
+	Retry      RetryPolicy
+	LocalReads bool          // Read the contact's own store rather than through ReadIndex
+	Timeout    time.Duration // Gives up waiting for a reply after this long, never if zero
+	Stats      ClientStats
+	contact    string
+	system     *System
+	requests   map[uint64]*ClientRequest // Writes issued, by request ID
+}
+
+// Status returns the outcome of one of the client's writes from the
+// system's outcome store. A commit is reported only if its proof covers
+// the write and carries the leader's signature.
+func (c *Client) Status(requestID uint64) (RequestStatus, error) {
+	if c.system == nil || c.system.Outcomes == nil {
+		return RequestStatus{}, ErrNoOutcomes
+	}
+	status, err := c.system.Outcomes.Status(c.Name, requestID)
+	if err != nil || status.State != RequestCommitted {
+		return status, err
+	}
+	request := c.requests[requestID]
+	if request == nil || status.Proof == nil || status.Proof.Digest != request.Digest() || status.Proof.Index != status.Index {
+		return status, fmt.Errorf("%s#%d: %w", c.Name, requestID, ErrReplayedProof)
+	}
+	if err := c.system.verifyCommitProof(status.Proof); err != nil {
+		return status, fmt.Errorf("%s#%d: %w: %v", c.Name, requestID, ErrInvalidCommitProof, err)
+	}
+	return status, nil
+}
+
+// Subscribe returns a channel receiving the outcome of one of the client's
+// writes once it is decided, see OutcomeStore.Subscribe
+func (c *Client) Subscribe(requestID uint64) (<-chan RequestStatus, error) {
+	if c.system == nil || c.system.Outcomes == nil {
+		return nil, ErrNoOutcomes
+	}
+	return c.system.Outcomes.Subscribe(c.Name, requestID), nil
+}
+
+// Workload runs clients against a system for a stretch of virtual time
+type Workload struct {
+	System   *System
+	Clients  []*Client
+	Duration time.Duration // How long clients keep starting operations
+	History  *History
+	pending  int // Operations started and not completed
+}
+
+// NewWorkload creates a workload against a system running on a scheduler
+func NewWorkload(system *System, duration time.Duration, clients ...*Client) *Workload {
+	return &Workload{System: system, Clients: clients, Duration: duration, History: NewHistory()}
+}
+
+// Run starts the clients at the current virtual time, runs the scheduler
+// until Duration has passed, and then until the operations in progress
+// complete
+func (w *Workload) Run() error {
+	sched := w.System.Scheduler
+	if sched == nil {
+		return ErrNoScheduler
+	}
+	w.History.Now = sched.Elapsed()
+	end := sched.Now + w.Duration
+	for _, c := range w.Clients {
+		c.system = w.System
+		if c.Rate <= 0 {
+			continue
+		}
+		client := c
+		sched.Timer(w.think(client), "client "+client.Name, func() { w.issue(client, end) })
+	}
+	sched.RunUntil(end)
+	for w.pending > 0 && sched.Step() {
+	}
+	return sched.Err()
+}
+
+// think draws the time to the next operation of a client
+func (w *Workload) think(c *Client) time.Duration {
+	return time.Duration(w.System.Scheduler.Rand.ExpFloat64() / c.Rate * float64(time.Second))
+}
+
+// issue starts the next operation of a client, unless the workload is over
+func (w *Workload) issue(c *Client, end time.Duration) {
+	sched := w.System.Scheduler
+	if sched.Now >= end {
+		return
+	}
+	keys := c.Keys
+	if len(keys) == 0 {
+		keys = []string{"x"}
+	}
+	key := keys[sched.Rand.Intn(len(keys))]
+	kind, value := OpRead, ""
+	var requestID uint64
+	if sched.Rand.Float64() >= c.ReadRatio {
+		c.Stats.Writes++
+		kind, value = OpWrite, fmt.Sprintf("%s-%d", c.Name, c.Stats.Writes)
+		requestID = uint64(c.Stats.Writes)
+		if c.requests == nil {
+			c.requests = make(map[uint64]*ClientRequest)
+		}
+		c.requests[requestID] = NewWriteOperation(c.Name, requestID, key, value, nil).Request()
+		w.System.Outcomes.Record(RequestStatus{Client: c.Name, RequestID: requestID, State: RequestPending, Key: key})
+	} else {
+		c.Stats.Reads++
+	}
+	next := sched.Now + w.think(c)
+	id := w.History.Invoke(c.Name, "", kind, key, value)
+	w.pending++
+	w.attempt(c, id, requestID, kind, key, value, 1, func() {
+		w.pending--
+		sched.At(next, func() { w.issue(c, end) })
+	})
+}
+
+// attempt sends an operation through the client's contact and completes it
+// once the reply arrives, or retries it after the backoff. Writes carry
+// their request ID.
+func (w *Workload) attempt(c *Client, id int, requestID uint64, kind OpKind, key, value string, attempt int, done func()) {
+	sched := w.System.Scheduler
+	contact := w.contact(c)
+	var result string
+	var version int64
+	var latency time.Duration
+	var err error
+	if kind == OpWrite {
+		var write *WriteResult
+		if write, err = w.System.SubmitWrite(c.Region, contact, key, value); err == nil {
+			version, latency = write.Index, write.Total
+			w.committed(c, requestID, key, write.Index)
+		}
+	} else {
+		var read *ReadResult
+		if c.LocalReads {
+			read, err = w.System.LocalRead(c.Region, contact, key)
+		} else {
+			read, err = w.System.ReadIndex(c.Region, contact, key)
+		}
+		if err == nil {
+			result, version, latency = read.Value, read.Index, read.Latency
+		}
+	}
+	if err == nil && c.Timeout > 0 && latency > c.Timeout {
+		sched.Timer(c.Timeout, "timeout "+c.Name, func() {
+			c.Stats.TimedOut++
+			w.History.Complete(id, "", 0, false)
+			done()
+		})
+		return
+	}
+	if err == nil {
+		sched.Timer(latency, "reply "+c.Name, func() {
+			w.History.Complete(id, result, version, true)
+			done()
+		})
+		return
+	}
+
+	// The client learns of the failure a round trip to its contact later
+	latency = 2 * w.System.RegionLatency(c.Region, w.region(contact))
+	if c.Stickiness == StickToNode && c.contact != "" {
+		c.contact = ""
+		c.Stats.Switches++
+	}
+	if attempt >= c.Retry.attempts() {
+		if kind == OpWrite {
+			w.System.Outcomes.Record(RequestStatus{Client: c.Name, RequestID: requestID, State: RequestFailed, Key: key, Error: err.Error()})
+		}
+		sched.Timer(latency, "failure "+c.Name, func() {
+			c.Stats.Failed++
+			w.History.Complete(id, "", 0, false)
+			done()
+		})
+		return
+	}
+	c.Stats.Retries++
+	backoff := c.Retry.Backoff << (attempt - 1)
+	sched.Timer(latency+backoff, "retry "+c.Name, func() {
+		w.attempt(c, id, requestID, kind, key, value, attempt+1, done)
+	})
+}
+
+// committed records a client's write as committed at index, with the
+// leader's proof of it
+func (w *Workload) committed(c *Client, requestID uint64, key string, index int64) {
+	if w.System.Outcomes == nil {
+		return
+	}
+	status := RequestStatus{Client: c.Name, RequestID: requestID, State: RequestCommitted, Key: key, Index: index}
+	proof, err := w.System.IssueCommitProof(c.requests[requestID], index)
+	if err != nil {
+		status.Error = err.Error()
+	}
+	status.Proof = proof
+	w.System.Outcomes.Record(status)
+}
+
+// contact picks the node a client sends its next request to
+func (w *Workload) contact(c *Client) string {
+	switch c.Stickiness {
+	case StickToNode:
+		if c.contact == "" {
+			c.contact = w.randomNode()
+		}
+		return c.contact
+	case StickToNone:
+		return w.randomNode()
+	}
+	return w.System.GetLeader()
+}
+
+// randomNode draws a node from the scheduler's RNG
+func (w *Workload) randomNode() string {
+	w.System.Lock.RLock()
+	ids := sortedKeys(w.System.Nodes)
+	w.System.Lock.RUnlock()
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[w.System.Scheduler.Rand.Intn(len(ids))]
+}
+
+// region returns the region of a node, empty if it does not exist
+func (w *Workload) region(id string) string {
+	w.System.Lock.RLock()
+	defer w.System.Lock.RUnlock()
+	if node := w.System.Nodes[id]; node != nil {
+		return node.Region
+	}
+	return ""
+}
+
+// WorkloadCommand implements `wahello workload [-scenario file] [-seed n]
+// [-clients n] [-rate r] [-reads p] [-keys n] [-stickiness s] [-attempts n]
+// [-backoff d] [-timeout d] [-duration d] [-local-reads] [-outcomes file]`,
+// running clients in every region of the scenario, checking the history
+// they record and polling the outcome of their writes
+func WorkloadCommand(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("workload", flag.ContinueOnError)
+	scenarioPath := flags.String("scenario", "", "scenario JSON file, the default scenario if empty")
+	seed := flags.Int64("seed", 1, "seed of the run")
+	clients := flags.Int("clients", 4, "number of clients, spread over the scenario's regions")
+	rate := flags.Float64("rate", 20, "operations per second per client")
+	reads := flags.Float64("reads", 0.5, "share of operations that are reads")
+	keys := flags.Int("keys", 2, "number of keys operated on")
+	stickiness := flags.String("stickiness", string(StickToLeader), "node clients contact: leader, sticky or random")
+	attempts := flags.Int("attempts", 3, "attempts per operation")
+	backoff := flags.Duration("backoff", 50*time.Millisecond, "wait before the first retry")
+	duration := flags.Duration("duration", 5*time.Second, "virtual time clients keep starting operations")
+	localReads := flags.Bool("local-reads", false, "read the contacted node's store instead of through the leader")
+	timeout := flags.Duration("timeout", 0, "give up waiting for a reply after this long, never if zero")
+	outcomesPath := flags.String("outcomes", "", "also write request outcomes to this JSON lines file, replacing its contents")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	switch Stickiness(*stickiness) {
+	case StickToLeader, StickToNode, StickToNone:
+	default:
+		return fmt.Errorf("unknown stickiness %q", *stickiness)
+	}
+	scenario := DefaultScenario()
+	if *scenarioPath != "" {
+		var err error
+		if scenario, err = LoadScenario(*scenarioPath); err != nil {
+			return err
+		}
+	}
+
+	system := NewSystem()
+	system.UseScheduler(NewScheduler(*seed))
+	if err := scenario.Build(system, *seed); err != nil {
+		return err
+	}
+	system.Outcomes = NewOutcomeStore()
+	if *outcomesPath != "" {
+		// Outcomes of another run would not verify against this run's keys
+		if err := os.WriteFile(*outcomesPath, nil, 0o644); err != nil {
+			return err
+		}
+		var err error
+		if system.Outcomes, err = OpenOutcomeStore(*outcomesPath); err != nil {
+			return err
+		}
+		defer system.Outcomes.Close()
+	}
+	var regions []string
+	seen := make(map[string]bool)
+	for _, spec := range scenario.Nodes {
+		if !seen[spec.Region] {
+			seen[spec.Region] = true
+			regions = append(regions, spec.Region)
+		}
+	}
+	var keyNames []string
+	for i := 0; i < *keys; i++ {
+		keyNames = append(keyNames, fmt.Sprintf("k%d", i))
+	}
+	workload := NewWorkload(system, *duration)
+	for i := 0; i < *clients; i++ {
+		workload.Clients = append(workload.Clients, &Client{
+			Name:       fmt.Sprintf("client-%d", i),
+			Region:     regions[i%len(regions)],
+			Rate:       *rate,
+			ReadRatio:  *reads,
+			Keys:       keyNames,
+			Stickiness: Stickiness(*stickiness),
+			Retry:      RetryPolicy{MaxAttempts: *attempts, Backoff: *backoff},
+			LocalReads: *localReads,
+			Timeout:    *timeout,
+		})
+	}
+	if err := workload.Run(); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(workload.Clients))
+	for _, c := range workload.Clients {
+		states := make(map[RequestState]int)
+		for id := uint64(1); id <= uint64(c.Stats.Writes); id++ {
+			status, err := c.Status(id)
+			if err != nil {
+				return err
+			}
+			states[status.State]++
+		}
+		rows = append(rows, []string{c.Name, c.Region, fmt.Sprint(c.Stats.Reads), fmt.Sprint(c.Stats.Writes),
+			fmt.Sprint(c.Stats.Retries), fmt.Sprint(c.Stats.Failed), fmt.Sprint(c.Stats.Switches), fmt.Sprint(c.Stats.TimedOut),
+			fmt.Sprint(states[RequestCommitted]), fmt.Sprint(states[RequestFailed])})
+	}
+	out := NewRenderer(stdout, false)
+	out.Table([]string{"Client", "Region", "Reads", "Writes", "Retries", "Failed", "Switches", "Timed out", "Committed", "Not committed"}, rows)
+	out.Print(DetectAnomalies(scenario.Name, workload.History))
+	out.Print(CheckLinearizability(scenario.Name, workload.History))
+	return nil
+}
@@ -0,0 +1,132 @@
+package bft
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newWorkloadSystem creates a four-node cluster led by A on a scheduler
+func newWorkloadSystem(t *testing.T, seed int64) *System {
+	system := newTestSystem(t, nodeIDs(4), inRegion("us-east"))
+	system.UseScheduler(NewScheduler(seed))
+	system.SetLeader("A")
+	return system
+}
+
+// TestWorkloadThroughLeader tests that clients going through the leader record a linearizable history of overlapping operations
+func TestWorkloadThroughLeader(t *testing.T) {
+	system := newWorkloadSystem(t, 1)
+	workload := NewWorkload(system, time.Second,
+		&Client{Name: "alice", Region: "us-east", Rate: 50, ReadRatio: 0.5, Keys: []string{"x", "y"}},
+		&Client{Name: "bob", Region: "eu-west", Rate: 50, ReadRatio: 0.5, Keys: []string{"x", "y"}},
+	)
+	if err := workload.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ops := workload.History.Snapshot()
+	perClient := make(map[string]int)
+	for _, op := range ops {
+		perClient[op.Client]++
+		if !op.OK || op.Complete <= op.Invoke {
+			t.Fatalf("Expected every operation to succeed after its modeled latency, got %+v", op)
+		}
+	}
+	for _, c := range workload.Clients {
+		if c.Stats.Reads+c.Stats.Writes != perClient[c.Name] || perClient[c.Name] == 0 {
+			t.Errorf("Expected %s's %d reads and %d writes in the history, found %d", c.Name, c.Stats.Reads, c.Stats.Writes, perClient[c.Name])
+		}
+	}
+	if report := CheckLinearizability("leader", workload.History); report.Verdict != Linearizable {
+		t.Errorf("Expected a linearizable history, got %s", report)
+	}
+}
+
+// TestWorkloadStickyRetries tests that a sticky client drops a partitioned node and retries elsewhere
+func TestWorkloadStickyRetries(t *testing.T) {
+	system := newWorkloadSystem(t, 2)
+	system.SetPartition("D", true)
+	client := &Client{Name: "carol", Region: "us-east", Rate: 20, Stickiness: StickToNode,
+		Retry: RetryPolicy{MaxAttempts: 10, Backoff: 10 * time.Millisecond}, contact: "D"}
+	workload := NewWorkload(system, time.Second, client)
+	if err := workload.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if client.Stats.Switches == 0 || client.Stats.Retries == 0 || client.Stats.Failed != 0 {
+		t.Errorf("Expected D to be dropped and every operation to succeed on retry, got %+v", client.Stats)
+	}
+	first := workload.History.Snapshot()[0]
+	if first.Complete-first.Invoke < 10*time.Millisecond {
+		t.Errorf("Expected the first operation to wait out the backoff, took %v", first.Complete-first.Invoke)
+	}
+}
+
+// TestWorkloadFailsWithoutRetries tests that operations failing on every attempt are recorded as failed
+func TestWorkloadFailsWithoutRetries(t *testing.T) {
+	system := newWorkloadSystem(t, 3)
+	system.SetPartition("A", true)
+	client := &Client{Name: "dave", Region: "us-east", Rate: 20, ReadRatio: 0, Retry: RetryPolicy{MaxAttempts: 2}}
+	workload := NewWorkload(system, time.Second, client)
+	if err := workload.Run(); err != nil {
+		t.Fatal(err)
+	}
+	ops := workload.History.Snapshot()
+	if len(ops) == 0 || client.Stats.Failed != len(ops) || client.Stats.Retries != len(ops) {
+		t.Errorf("Expected all %d writes to fail after one retry, got %+v", len(ops), client.Stats)
+	}
+	if report := CheckLinearizability("failed", workload.History); report.Verdict != Linearizable {
+		t.Errorf("Expected failed writes to be linearizable, got %s", report)
+	}
+}
+
+// TestWorkloadLocalReadsGoStale tests that local reads from a lagging node show up as a linearizability violation
+func TestWorkloadLocalReadsGoStale(t *testing.T) {
+	system := newWorkloadSystem(t, 4)
+	system.SetPartition("D", true)
+	workload := NewWorkload(system, time.Second,
+		&Client{Name: "writer", Region: "us-east", Rate: 20, Keys: []string{"x"}},
+		&Client{Name: "reader", Region: "us-east", Rate: 20, ReadRatio: 1, Keys: []string{"x"}, Stickiness: StickToNode, LocalReads: true, contact: "D"},
+	)
+	if err := workload.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if report := CheckLinearizability("stale", workload.History); report.Verdict != NotLinearizable {
+		t.Errorf("Expected stale local reads to violate linearizability, got %s", report)
+	}
+}
+
+// TestWorkloadDeterministic tests that a seed reproduces a workload's history exactly
+func TestWorkloadDeterministic(t *testing.T) {
+	run := func() []HistoryOp {
+		workload := NewWorkload(newWorkloadSystem(t, 5), time.Second,
+			&Client{Name: "erin", Region: "us-east", Rate: 30, ReadRatio: 0.3, Keys: []string{"x", "y"}, Stickiness: StickToNone})
+		if err := workload.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return workload.History.Snapshot()
+	}
+	if first, second := run(), run(); !reflect.DeepEqual(first, second) {
+		t.Error("Expected the same seed to record the same history")
+	}
+}
+
+// TestWorkloadErrors tests that a workload needs a scheduler and the command known stickiness
+func TestWorkloadErrors(t *testing.T) {
+	workload := NewWorkload(NewSystem(), time.Second)
+	if err := workload.Run(); !errors.Is(err, ErrNoScheduler) {
+		t.Errorf("Expected ErrNoScheduler, got %v", err)
+	}
+	var out bytes.Buffer
+	if err := WorkloadCommand([]string{"-stickiness", "nearest"}, &out); err == nil {
+		t.Error("Expected an unknown stickiness to be rejected")
+	}
+	if err := WorkloadCommand([]string{"-duration", "500ms"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Linearizability: ") {
+		t.Errorf("Expected a linearizability verdict, got %q", out.String())
+	}
+}
@@ -0,0 +1,50 @@
+//go:build js && wasm
+
+// Command playground runs the partition simulation in a browser. Built
+// with GOOS=js GOARCH=wasm and the purego tag, it registers a global
+// wahello object with two functions for index.html:
+//
+//	wahello.defaultScenario()  the built-in scenario as JSON
+//	wahello.run(request)       runs a JSON bft.PlaygroundRequest and
+//	                           returns {result} or {error}
+//
+// See make playground.
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/fernandokarnagi/wahello/bft"
+)
+
+func main() {
+	js.Global().Set("wahello", js.ValueOf(map[string]interface{}{
+		"defaultScenario": js.FuncOf(defaultScenario),
+		"run":             js.FuncOf(run),
+	}))
+	// Keep the functions callable for the lifetime of the page
+	select {}
+}
+
+// defaultScenario returns the built-in scenario as indented JSON
+func defaultScenario(this js.Value, args []js.Value) interface{} {
+	data, err := json.MarshalIndent(bft.DefaultScenario(), "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// run runs the request in args[0] and returns an object holding either the
+// JSON result or an error message
+func run(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 || args[0].Type() != js.TypeString {
+		return map[string]interface{}{"error": "run takes one JSON request"}
+	}
+	result, err := bft.PlaygroundJSON(args[0].String())
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	return map[string]interface{}{"result": result}
+}
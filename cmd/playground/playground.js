@@ -0,0 +1,117 @@
+// Drives index.html: loads wahello.wasm, runs the simulation on the edited
+// scenario and draws its topology, results and report.
+
+const svgNS = "http://www.w3.org/2000/svg";
+const $ = (id) => document.getElementById(id);
+
+// svg creates an SVG element with the given attributes
+function svg(name, attrs, text) {
+  const el = document.createElementNS(svgNS, name);
+  for (const [key, value] of Object.entries(attrs)) {
+    el.setAttribute(key, value);
+  }
+  if (text !== undefined) {
+    el.textContent = text;
+  }
+  return el;
+}
+
+// drawTopology lays the regions out on a circle, their nodes around each
+// region's center, and draws the links between them
+function drawTopology(result) {
+  const root = $("topology");
+  root.replaceChildren();
+  root.appendChild(svg("defs", {})).appendChild(
+    svg("marker", { id: "arrow", viewBox: "0 0 10 10", refX: 22, refY: 5, markerWidth: 6, markerHeight: 6, orient: "auto" })
+  ).appendChild(svg("path", { d: "M 0 0 L 10 5 L 0 10 z", fill: "#555" }));
+
+  const regions = [...new Set(result.nodes.map((node) => node.region))];
+  const pos = {};
+  regions.forEach((region, i) => {
+    const angle = (2 * Math.PI * i) / regions.length - Math.PI / 2;
+    const cx = 240 + 120 * Math.cos(angle);
+    const cy = 180 + 110 * Math.sin(angle);
+    root.appendChild(svg("text", { x: cx, y: cy - 50, "text-anchor": "middle", fill: "#888" }, region || "(no region)"));
+    const members = result.nodes.filter((node) => node.region === region);
+    members.forEach((node, j) => {
+      const a = (2 * Math.PI * j) / members.length;
+      const r = members.length > 1 ? 30 : 0;
+      pos[node.id] = [cx + r * Math.cos(a), cy + r * Math.sin(a)];
+    });
+  });
+
+  for (const link of result.links || []) {
+    const [x1, y1] = pos[link.from];
+    const [x2, y2] = pos[link.to];
+    const line = svg("line", {
+      x1, y1, x2, y2,
+      stroke: link.cut ? "#c33" : "#555",
+      "stroke-width": 1.5,
+      "stroke-dasharray": link.cut ? "4 3" : "none",
+    });
+    if (link.one_way) {
+      line.setAttribute("marker-end", "url(#arrow)");
+    }
+    root.appendChild(line);
+  }
+  for (const node of result.nodes) {
+    const [x, y] = pos[node.id];
+    const fill = node.byzantine ? "#e55" : node.isolated ? "#bbb" : "#6a6";
+    root.appendChild(svg("circle", { cx: x, cy: y, r: 13, fill, stroke: "#333" }));
+    root.appendChild(svg("text", { x, y: y + 4, "text-anchor": "middle" }, node.id));
+  }
+}
+
+// showResults lists the headline results by name
+function showResults(result) {
+  const table = $("results");
+  table.replaceChildren();
+  const header = table.insertRow();
+  header.innerHTML = "<th>Result</th><th>Value</th>";
+  for (const key of Object.keys(result.results).sort()) {
+    const row = table.insertRow();
+    row.insertCell().textContent = key;
+    const value = row.insertCell();
+    value.className = "value";
+    value.textContent = result.results[key];
+  }
+}
+
+function run() {
+  $("error").textContent = "";
+  let scenario;
+  try {
+    scenario = JSON.parse($("scenario").value);
+  } catch (err) {
+    $("error").textContent = "Scenario is not valid JSON: " + err.message;
+    return;
+  }
+  const request = JSON.stringify({ seed: Number($("seed").value), scenario });
+  const reply = wahello.run(request);
+  if (reply.error) {
+    $("error").textContent = reply.error;
+    return;
+  }
+  const result = JSON.parse(reply.result);
+  drawTopology(result);
+  showResults(result);
+  $("output").textContent = result.output;
+}
+
+async function load() {
+  const go = new Go();
+  const { instance } = await WebAssembly.instantiateStreaming(fetch("wahello.wasm"), go.importObject);
+  go.run(instance);
+  $("scenario").value = wahello.defaultScenario();
+  $("run").textContent = "Run";
+  $("run").disabled = false;
+  $("reset").disabled = false;
+  $("run").onclick = run;
+  $("reset").onclick = () => {
+    $("scenario").value = wahello.defaultScenario();
+  };
+}
+
+load().catch((err) => {
+  $("error").textContent = "Failed to load the simulation: " + err;
+});
@@ -0,0 +1,361 @@
+// Command wahello runs the partition simulation and the tools built on the
+// bft packages: scenario checks, benchmarks, key generation, cluster
+// diagrams, run registry queries, FSM export, packet capture, wire
+// compatibility checks, parameter sweeps, determinism checks, node diffs,
+// Byzantine attack budgets, SQL queries over recorded histories, random
+// topologies, client workloads, offline verification of exported commit
+// proofs, compacted history, write-ahead logs and snapshots, and local
+// clusters of node processes.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fernandokarnagi/wahello/bft"
+	"github.com/fernandokarnagi/wahello/bft/clock"
+)
+
+// commands are the subcommands besides run, the default
+var commands = map[string]func(args []string, stdout io.Writer) error{
+	"check":              bft.CheckCommand,
+	"bench":              bft.BenchCommand,
+	"keys":               bft.KeysCommand,
+	"topology":           bft.TopologyCommand,
+	"dot":                bft.DotCommand,
+	"runs":               bft.RunsCommand,
+	"fsm":                bft.FSMCommand,
+	"capture":            bft.CaptureCommand,
+	"compat":             bft.CompatCommand,
+	"sweep":              bft.SweepCommand,
+	"diff":               bft.DiffCommand,
+	"attacks":            bft.AttacksCommand,
+	"history":            bft.HistoryCommand,
+	"workload":           bft.WorkloadCommand,
+	"verify-determinism": bft.VerifyCommand,
+	"verify-proof":       bft.VerifyProofCommand,
+	"verify-inclusion":   bft.VerifyInclusionCommand,
+	"verify-wal":         bft.VerifyWALCommand,
+	"verify-snapshot":    bft.VerifySnapshotCommand,
+	"cluster":            bft.ClusterCommand,
+	"node":               nodeCommand,
+}
+
+// nodeCommand runs a cluster node until it is interrupted
+func nodeCommand(args []string, stdout io.Writer) error {
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go func() {
+		<-interrupted
+		close(stop)
+	}()
+	return bft.NodeCommand(args, stop)
+}
+
+// printUsage lists the subcommands, run being the default
+func printUsage(w io.Writer) {
+	names := []string{"run"}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	fmt.Fprintf(w, "Usage: wahello [subcommand] [flags]\nSubcommands: %s\n", strings.Join(names, ", "))
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] != "run" && !strings.HasPrefix(args[0], "-") {
+		command, exists := commands[args[0]]
+		if !exists {
+			fmt.Fprintf(os.Stderr, "Unknown subcommand %q\n", args[0])
+			printUsage(os.Stderr)
+			os.Exit(2)
+		}
+		if err := command(args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "run" {
+		args = args[1:]
+	}
+	var experiment bft.ExperimentFlags
+	experiment.Register(flag.CommandLine)
+	registryDir := flag.String("registry", "", "record the run in this run registry directory")
+	expectPath := flag.String("expect", "", "diff the run against the expected outcomes in this YAML or JSON file, and fail on a mismatch; the scenario's <name>.expect.yaml next to it if empty")
+	reportPath := flag.String("report", "", "write the run report to this file, JSON if it ends in .json and Markdown otherwise")
+	chromeTracePath := flag.String("chrome-trace", "", "write the run's message, commit and view change events to this file in Chrome trace format, for chrome://tracing or Perfetto")
+	var tags bft.TagList
+	flag.Var(&tags, "tag", "tag to attach to the recorded run (repeatable)")
+	configPath := flag.String("config", "", "JSON file with node tunables, reloaded on SIGHUP")
+	adminAddr := flag.String("admin", "", "serve the config admin API at http://host:port/config and /reload during and after the run")
+	pcapPath := flag.String("pcap", "", "dump simulated messages to this JSON lines file")
+	historyPath := flag.String("history", "", "save the client history and PBFT executions to this SQLite file")
+	auditAddr := flag.String("audit", "", "stream security events to this host:port")
+	metricsAddr := flag.String("metrics", "", "serve Prometheus metrics at http://host:port/metrics during and after the run")
+	eventsAddr := flag.String("events", "", "stream trace events at http://host:port/events, with the filter admin API at /filter and a dashboard at /dashboard")
+	auditFormat := flag.String("audit-format", string(bft.AuditSyslog), "audit event format: syslog or json")
+	webhookURL := flag.String("webhook", "", "POST leader changes, Byzantine detections, quorum loss and heals to this URL")
+	webhookSecretFile := flag.String("webhook-secret-file", "", "file with the secret webhook payloads are signed with")
+	logLevel := flag.String("log-level", "", "log node events to stderr at this level: debug, info, warn or error; no logs if empty")
+	logFormat := flag.String("log-format", string(bft.LogText), "log format: text or json")
+	noColor := flag.Bool("no-color", false, "plain output for logs, even on a terminal")
+	clockRep := flag.String("clock", string(clock.DefaultClockRepresentation), "vector clock representation: map, sorted, sparse or dense")
+	flag.Usage = func() {
+		printUsage(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "Flags of run:")
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(args)
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected argument %q\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+	bft.Output.Color = !*noColor && bft.IsTerminal(os.Stdout)
+
+	rep, err := clock.ParseClockRepresentation(*clockRep)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	clock.DefaultClockRepresentation = rep
+
+	if *logLevel != "" {
+		level, err := bft.ParseLogLevel(*logLevel)
+		if err == nil {
+			bft.DefaultLogger, err = bft.NewLogger(os.Stderr, level, bft.LogFormat(*logFormat))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to set up logging: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	scenario, err := experiment.Prepare()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load scenario: %v\n", err)
+		os.Exit(1)
+	}
+	var expectations *bft.Expectations
+	switch {
+	case *expectPath != "":
+		expectations, err = bft.LoadExpectations(*expectPath)
+	case experiment.Scenario != "":
+		expectations, err = bft.ExpectationsFor(experiment.Scenario)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load expectations: %v\n", err)
+		os.Exit(1)
+	}
+	if experiment.Format == bft.FormatJSON {
+		bft.Output = bft.NewRenderer(io.Discard, false)
+	}
+
+	reloader, err := bft.NewConfigReloader(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	reloader.WatchSignals(stop, func(err error) {
+		fmt.Fprintf(os.Stderr, "Config reload rejected: %v\n", err)
+	})
+	bft.DefaultConfig = reloader
+	if *adminAddr != "" {
+		listener, err := net.Listen("tcp", *adminAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to serve the admin API: %v\n", err)
+			os.Exit(1)
+		}
+		go http.Serve(listener, reloader.AdminHandler())
+	}
+
+	var capture *bft.PacketCapture
+	if *pcapPath != "" {
+		f, err := os.Create(*pcapPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create capture: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		capture = bft.NewPacketCapture(f)
+	}
+
+	var audit *bft.AuditSink
+	if *auditAddr != "" {
+		audit, err = bft.NewAuditSink(*auditAddr, bft.AuditFormat(*auditFormat), 1024)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create audit sink: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *webhookURL != "" {
+		hook := bft.Webhook{URL: *webhookURL}
+		if *webhookSecretFile != "" {
+			secret, err := os.ReadFile(*webhookSecretFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read webhook secret: %v\n", err)
+				os.Exit(1)
+			}
+			hook.Secret = bytes.TrimSpace(secret)
+		}
+		if bft.DefaultWebhooks, err = bft.NewWebhooks(1024, hook); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create webhooks: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var store *bft.HistoryDB
+	if *historyPath != "" {
+		if store, err = bft.OpenHistoryDB(*historyPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open history store: %v\n", err)
+			os.Exit(1)
+		}
+		defer store.Close()
+	}
+
+	var metrics *bft.Metrics
+	if *metricsAddr != "" {
+		listener, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to serve metrics: %v\n", err)
+			os.Exit(1)
+		}
+		metrics = bft.NewMetrics()
+		go http.Serve(listener, metrics.Handler())
+	}
+
+	if *eventsAddr != "" {
+		listener, err := net.Listen("tcp", *eventsAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to serve events: %v\n", err)
+			os.Exit(1)
+		}
+		bft.DefaultEventStream = bft.NewEventStream()
+		go http.Serve(listener, bft.DefaultEventStream.Handler())
+	}
+
+	started := time.Now()
+	var report *bft.RunReport
+	usage := bft.MeasureResources(func() {
+		report = bft.SimulatePartitionReport(experiment.Seed, scenario, capture, audit, store, metrics)
+	})
+	results := report.Results
+	for key, value := range usage.Results() {
+		results[key] = value
+	}
+	var unmet error
+	if expectations != nil {
+		unmet = report.Expect(expectations)
+		bft.Output.Println()
+		bft.Output.Section("Expectations")
+		for _, mismatch := range report.Mismatches {
+			bft.Output.Println(mismatch)
+		}
+		if unmet == nil {
+			bft.Output.Println("All met")
+		}
+	}
+	if *reportPath != "" {
+		if err := report.WriteFile(*reportPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write run report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *chromeTracePath != "" {
+		f, err := os.Create(*chromeTracePath)
+		if err == nil {
+			err = report.Trace.WriteChromeTrace(f)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write Chrome trace: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if capture != nil && capture.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write capture: %v\n", capture.Err())
+	}
+	if audit != nil {
+		if err := audit.Close(5 * time.Second); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export audit events: %v\n", err)
+		}
+	}
+	if bft.DefaultWebhooks != nil {
+		if err := bft.DefaultWebhooks.Close(10 * time.Second); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to deliver webhooks: %v\n", err)
+		}
+	}
+	if *registryDir != "" {
+		tunables := reloader.Current()
+		registry, err := bft.OpenRegistry(*registryDir)
+		if err == nil {
+			err = registry.Add(&bft.RunRecord{
+				Name:        scenario.Name,
+				Started:     started,
+				Duration:    time.Since(started),
+				GitRevision: bft.GitRevision(),
+				Tags:        tags,
+				Config: map[string]string{
+					"scenario":         scenario.Name,
+					"nodes":            fmt.Sprint(len(scenario.Nodes)),
+					"seed":             fmt.Sprint(experiment.Seed),
+					"election_timeout": fmt.Sprint(tunables.ElectionTimeout),
+					"batch_size":       fmt.Sprint(tunables.BatchSize),
+					"gossip_fanout":    fmt.Sprint(tunables.GossipFanout),
+				},
+				Results: results,
+			})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to record run: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if experiment.Format == bft.FormatJSON {
+		if err := bft.WriteRunJSON(os.Stdout, scenario, experiment.Seed, results, report.Mismatches); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write results: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if metrics != nil || *eventsAddr != "" || *adminAddr != "" {
+		// Keep serving the final counts for a last scrape, the recent
+		// events for the dashboard and the tunables for inspection
+		if metrics != nil {
+			fmt.Fprintf(os.Stderr, "Serving metrics at http://%s/metrics, interrupt to stop\n", *metricsAddr)
+		}
+		if *eventsAddr != "" {
+			fmt.Fprintf(os.Stderr, "Serving the event dashboard at http://%s/dashboard, interrupt to stop\n", *eventsAddr)
+		}
+		if *adminAddr != "" {
+			fmt.Fprintf(os.Stderr, "Serving the config admin API at http://%s/config, interrupt to stop\n", *adminAddr)
+		}
+		interrupted := make(chan os.Signal, 1)
+		signal.Notify(interrupted, os.Interrupt)
+		<-interrupted
+	}
+	if unmet != nil {
+		fmt.Fprintln(os.Stderr, unmet)
+		os.Exit(1)
+	}
+}
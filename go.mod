@@ -0,0 +1,8 @@
+module github.com/fernandokarnagi/wahello
+
+go 1.24
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.52
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,452 @@
+// Command msggen generates message codecs and handler dispatch from a
+// message definition file.
+//
+// For every message it writes the type ID, protobuf wire format and JSON
+// codecs, and a case in the handler dispatch, so the binary, JSON and
+// protobuf encodings of a message cannot drift apart and no switch over
+// message types is written by hand. It also writes the matching .proto
+// schema for clients in other languages.
+//
+// Usage:
+//
+//	go run ./tools/msggen -pkg bft -in bft/messages.def -out bft/messages_gen.go -proto docs/messages.proto
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// field is one field of a message
+type field struct {
+	Num    int
+	Wire   string // Name in JSON and protobuf
+	Type   string // Definition type, e.g. "int64", "enum:MemberState" or "message:ClockUpdate"
+	GoName string
+}
+
+// message is one message definition
+type message struct {
+	Name   string
+	ID     int
+	Fields []field
+}
+
+// fieldTypes are the definition types msggen can encode
+var fieldTypes = map[string]bool{
+	"string": true, "bytes": true, "bool": true, "int": true,
+	"int64": true, "uint64": true, "[]string": true,
+}
+
+// parse reads message definitions
+func parse(r io.Reader) ([]message, error) {
+	var messages []message
+	ids := make(map[int]string)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		words := strings.Fields(text)
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "message" {
+			if len(words) != 3 {
+				return nil, fmt.Errorf("line %d: want \"message <Type> <id>\"", line)
+			}
+			id, err := strconv.Atoi(words[2])
+			if err != nil || id < 1 || id > 255 {
+				return nil, fmt.Errorf("line %d: message id %q must be in 1..255", line, words[2])
+			}
+			if other, exists := ids[id]; exists {
+				return nil, fmt.Errorf("line %d: message id %d already used by %s", line, id, other)
+			}
+			ids[id] = words[1]
+			messages = append(messages, message{Name: words[1], ID: id})
+			continue
+		}
+		if len(messages) == 0 {
+			return nil, fmt.Errorf("line %d: field outside a message", line)
+		}
+		if len(words) != 4 {
+			return nil, fmt.Errorf("line %d: want \"<num> <wire name> <type> <GoField>\"", line)
+		}
+		num, err := strconv.Atoi(words[0])
+		if err != nil || num < 1 {
+			return nil, fmt.Errorf("line %d: field number %q must be positive", line, words[0])
+		}
+		if !fieldTypes[words[2]] && !strings.HasPrefix(words[2], "enum:") && !strings.HasPrefix(words[2], "string:") && !strings.HasPrefix(words[2], "message:") {
+			return nil, fmt.Errorf("line %d: unknown field type %q", line, words[2])
+		}
+		current := &messages[len(messages)-1]
+		for _, f := range current.Fields {
+			if f.Num == num || f.Wire == words[1] {
+				return nil, fmt.Errorf("line %d: %s field %d %q is already defined", line, current.Name, num, words[1])
+			}
+		}
+		current.Fields = append(current.Fields, field{Num: num, Wire: words[1], Type: words[2], GoName: words[3]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	defined := make(map[string]bool)
+	for _, m := range messages {
+		for _, f := range m.Fields {
+			if nested := f.nested(); nested != "" && !defined[nested] {
+				return nil, fmt.Errorf("%s field %q: message %s must be defined before it", m.Name, f.Wire, nested)
+			}
+		}
+		defined[m.Name] = true
+	}
+	return messages, nil
+}
+
+// nested returns the message type of a message field, "" for other fields
+func (f field) nested() string {
+	if strings.HasPrefix(f.Type, "message:") {
+		return strings.TrimPrefix(f.Type, "message:")
+	}
+	return ""
+}
+
+// hasNested reports whether a message has message fields
+func (m message) hasNested() bool {
+	for _, f := range m.Fields {
+		if f.nested() != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// kind returns the definition type a field is encoded as: named string
+// types as strings, other fields as themselves
+func (f field) kind() string {
+	switch {
+	case strings.HasPrefix(f.Type, "string:"):
+		return "string"
+	case f.nested() != "":
+		return "message"
+	}
+	return f.Type
+}
+
+// goType returns the Go type of a field
+func (f field) goType() string {
+	switch {
+	case strings.HasPrefix(f.Type, "enum:"):
+		return strings.TrimPrefix(f.Type, "enum:")
+	case strings.HasPrefix(f.Type, "string:"):
+		return strings.TrimPrefix(f.Type, "string:")
+	case f.nested() != "":
+		return "*" + f.nested()
+	case f.Type == "bytes":
+		return "[]byte"
+	}
+	return f.Type
+}
+
+// protoType returns the protobuf type of a field
+func (f field) protoType() string {
+	switch {
+	case strings.HasPrefix(f.Type, "enum:"):
+		return "int32"
+	case f.kind() == "string":
+		return "string"
+	case f.nested() != "":
+		return f.nested()
+	case f.Type == "int":
+		return "int64"
+	case f.Type == "[]string":
+		return "repeated string"
+	}
+	return f.Type
+}
+
+// unexported lowercases the first letter of a name
+func unexported(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// generate writes the Go codecs and dispatch for messages
+func generate(w *bytes.Buffer, source, pkg string, messages []message) {
+	p := func(format string, args ...interface{}) { fmt.Fprintf(w, format+"\n", args...) }
+
+	p("// Code generated by msggen from %s. DO NOT EDIT.", source)
+	p("")
+	p("package %s", pkg)
+	p("")
+	p("import (")
+	p("\t\"encoding/json\"")
+	p("\t\"fmt\"")
+	p(")")
+	p("")
+	p("// Message type IDs, the first byte of a frame")
+	p("const (")
+	for _, m := range messages {
+		p("\tMsg%s MessageType = %d", m.Name, m.ID)
+	}
+	p(")")
+	p("")
+	p("func (t MessageType) String() string {")
+	p("\tswitch t {")
+	for _, m := range messages {
+		p("\tcase Msg%s:", m.Name)
+		p("\t\treturn %q", m.Name)
+	}
+	p("\t}")
+	p("\treturn fmt.Sprintf(\"MessageType(%%d)\", int(t))")
+	p("}")
+	p("")
+	p("// NewMessage returns an empty message of type t")
+	p("func NewMessage(t MessageType) (Message, error) {")
+	p("\tswitch t {")
+	for _, m := range messages {
+		p("\tcase Msg%s:", m.Name)
+		p("\t\treturn &%s{}, nil", m.Name)
+	}
+	p("\t}")
+	p("\treturn nil, fmt.Errorf(\"%%w: %%v\", ErrUnknownMessage, t)")
+	p("}")
+	p("")
+	p("// MessageHandler handles every generated message type")
+	p("type MessageHandler interface {")
+	for _, m := range messages {
+		p("\tHandle%s(from string, m *%s) error", m.Name, m.Name)
+	}
+	p("}")
+	p("")
+	p("// DispatchMessage calls the handler method for m's type")
+	p("func DispatchMessage(h MessageHandler, from string, m Message) error {")
+	p("\tswitch m := m.(type) {")
+	for _, m := range messages {
+		p("\tcase *%s:", m.Name)
+		p("\t\treturn h.Handle%s(from, m)", m.Name)
+	}
+	p("\t}")
+	p("\treturn fmt.Errorf(\"%%w: %%T\", ErrUnknownMessage, m)")
+	p("}")
+
+	for _, m := range messages {
+		p("")
+		p("func (m *%s) MessageType() MessageType { return Msg%s }", m.Name, m.Name)
+		p("")
+		p("// MarshalBinary encodes m in protobuf wire format")
+		p("func (m *%s) MarshalBinary() ([]byte, error) {", m.Name)
+		p("\tvar b []byte")
+		for _, f := range m.Fields {
+			switch f.kind() {
+			case "string":
+				p("\tb = appendBytesField(b, %d, []byte(m.%s))", f.Num, f.GoName)
+			case "message":
+				p("\tif m.%s != nil {", f.GoName)
+				p("\t\tnested, err := m.%s.MarshalBinary()", f.GoName)
+				p("\t\tif err != nil {")
+				p("\t\t\treturn nil, err")
+				p("\t\t}")
+				p("\t\tb = appendRepeatedField(b, %d, nested)", f.Num)
+				p("\t}")
+			case "bytes":
+				p("\tb = appendBytesField(b, %d, m.%s)", f.Num, f.GoName)
+			case "[]string":
+				p("\tfor _, v := range m.%s {", f.GoName)
+				p("\t\tb = appendRepeatedField(b, %d, []byte(v))", f.Num)
+				p("\t}")
+			case "bool":
+				p("\tif m.%s {", f.GoName)
+				p("\t\tb = appendVarintField(b, %d, 1)", f.Num)
+				p("\t}")
+			default:
+				p("\tb = appendVarintField(b, %d, uint64(m.%s))", f.Num, f.GoName)
+			}
+		}
+		p("\treturn b, nil")
+		p("}")
+		p("")
+		p("// UnmarshalBinary decodes m from protobuf wire format, skipping unknown fields")
+		p("func (m *%s) UnmarshalBinary(data []byte) error {", m.Name)
+		p("\t*m = %s{}", m.Name)
+		p("\tr := wireReader{data: data}")
+		p("\tfor !r.done() {")
+		p("\t\tnum, wireType, err := r.tag()")
+		p("\t\tif err == nil {")
+		p("\t\t\tswitch num {")
+		for _, f := range m.Fields {
+			p("\t\t\tcase %d:", f.Num)
+			switch f.kind() {
+			case "string":
+				p("\t\t\t\tvar v []byte")
+				p("\t\t\t\tv, err = r.bytes(wireType)")
+				p("\t\t\t\tm.%s = %s(v)", f.GoName, f.goType())
+			case "message":
+				p("\t\t\t\tvar v []byte")
+				p("\t\t\t\tif v, err = r.bytes(wireType); err == nil {")
+				p("\t\t\t\t\tm.%s = &%s{}", f.GoName, f.nested())
+				p("\t\t\t\t\terr = m.%s.UnmarshalBinary(v)", f.GoName)
+				p("\t\t\t\t}")
+			case "bytes":
+				p("\t\t\t\tm.%s, err = r.bytes(wireType)", f.GoName)
+			case "[]string":
+				p("\t\t\t\tvar v []byte")
+				p("\t\t\t\tif v, err = r.bytes(wireType); err == nil {")
+				p("\t\t\t\t\tm.%s = append(m.%s, string(v))", f.GoName, f.GoName)
+				p("\t\t\t\t}")
+			case "bool":
+				p("\t\t\t\tvar v uint64")
+				p("\t\t\t\tv, err = r.varint(wireType)")
+				p("\t\t\t\tm.%s = v != 0", f.GoName)
+			case "uint64":
+				p("\t\t\t\tm.%s, err = r.varint(wireType)", f.GoName)
+			default:
+				p("\t\t\t\tvar v uint64")
+				p("\t\t\t\tv, err = r.varint(wireType)")
+				p("\t\t\t\tm.%s = %s(v)", f.GoName, f.goType())
+			}
+		}
+		p("\t\t\tdefault:")
+		p("\t\t\t\terr = r.skip(wireType)")
+		p("\t\t\t}")
+		p("\t\t}")
+		p("\t\tif err != nil {")
+		p("\t\t\treturn fmt.Errorf(\"%%w: %s field %%d: %%v\", ErrMalformedMessage, num, err)", m.Name)
+		p("\t\t}")
+		p("\t}")
+		p("\treturn nil")
+		p("}")
+		p("")
+		mirror := unexported(m.Name) + "JSON"
+		p("// %s is the JSON form of %s", mirror, m.Name)
+		p("type %s struct {", mirror)
+		for _, f := range m.Fields {
+			if f.nested() != "" {
+				p("\t%s json.RawMessage `json:%q`", f.GoName, f.Wire+",omitempty")
+				continue
+			}
+			p("\t%s %s `json:%q`", f.GoName, f.goType(), f.Wire)
+		}
+		p("}")
+		p("")
+		p("// EncodeJSON encodes m with the field names of its definition")
+		p("func (m *%s) EncodeJSON() ([]byte, error) {", m.Name)
+		if !m.hasNested() {
+			p("\treturn json.Marshal(%s{", mirror)
+			for _, f := range m.Fields {
+				p("\t\t%s: m.%s,", f.GoName, f.GoName)
+			}
+			p("\t})")
+			p("}")
+		} else {
+			p("\tv := %s{", mirror)
+			for _, f := range m.Fields {
+				if f.nested() == "" {
+					p("\t\t%s: m.%s,", f.GoName, f.GoName)
+				}
+			}
+			p("\t}")
+			for _, f := range m.Fields {
+				if f.nested() == "" {
+					continue
+				}
+				p("\tif m.%s != nil {", f.GoName)
+				p("\t\tnested, err := m.%s.EncodeJSON()", f.GoName)
+				p("\t\tif err != nil {")
+				p("\t\t\treturn nil, err")
+				p("\t\t}")
+				p("\t\tv.%s = nested", f.GoName)
+				p("\t}")
+			}
+			p("\treturn json.Marshal(v)")
+			p("}")
+		}
+		p("")
+		p("// DecodeJSON decodes m from the field names of its definition")
+		p("func (m *%s) DecodeJSON(data []byte) error {", m.Name)
+		p("\tvar v %s", mirror)
+		p("\tif err := json.Unmarshal(data, &v); err != nil {")
+		p("\t\treturn fmt.Errorf(\"%%w: %s: %%v\", ErrMalformedMessage, err)", m.Name)
+		p("\t}")
+		p("\t*m = %s{", m.Name)
+		for _, f := range m.Fields {
+			if f.nested() == "" {
+				p("\t\t%s: v.%s,", f.GoName, f.GoName)
+			}
+		}
+		p("\t}")
+		for _, f := range m.Fields {
+			if f.nested() == "" {
+				continue
+			}
+			p("\tif len(v.%s) > 0 && string(v.%s) != \"null\" {", f.GoName, f.GoName)
+			p("\t\tm.%s = &%s{}", f.GoName, f.nested())
+			p("\t\tif err := m.%s.DecodeJSON(v.%s); err != nil {", f.GoName, f.GoName)
+			p("\t\t\treturn err")
+			p("\t\t}")
+			p("\t}")
+		}
+		p("\treturn nil")
+		p("}")
+	}
+}
+
+// generateProto writes the protobuf schema for messages
+func generateProto(w *bytes.Buffer, source string, messages []message) {
+	fmt.Fprintf(w, "// Code generated by msggen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(w, "syntax = \"proto3\";\n\npackage wahello;\n")
+	for _, m := range messages {
+		fmt.Fprintf(w, "\n// Type ID %d\nmessage %s {\n", m.ID, m.Name)
+		for _, f := range m.Fields {
+			fmt.Fprintf(w, "  %s %s = %d;\n", f.protoType(), f.Wire, f.Num)
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+}
+
+func main() {
+	pkg := flag.String("pkg", "bft", "package of the generated Go file")
+	in := flag.String("in", "messages.def", "message definition file")
+	out := flag.String("out", "messages_gen.go", "generated Go file")
+	proto := flag.String("proto", "", "generated .proto file, if set")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("msggen: ")
+
+	f, err := os.Open(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	messages, err := parse(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", *in, err)
+	}
+
+	var code bytes.Buffer
+	generate(&code, *in, *pkg, messages)
+	formatted, err := format.Source(code.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated code: %v", err)
+	}
+	if err := os.WriteFile(*out, formatted, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if *proto != "" {
+		var schema bytes.Buffer
+		generateProto(&schema, *in, messages)
+		if err := os.WriteFile(*proto, schema.Bytes(), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}